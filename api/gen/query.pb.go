@@ -0,0 +1,496 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
+// source: query.proto
+
+package telemetryv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ListGPUsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListGPUsRequest) Reset() {
+	*x = ListGPUsRequest{}
+	mi := &file_query_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListGPUsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListGPUsRequest) ProtoMessage() {}
+
+func (x *ListGPUsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_query_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListGPUsRequest.ProtoReflect.Descriptor instead.
+func (*ListGPUsRequest) Descriptor() ([]byte, []int) {
+	return file_query_proto_rawDescGZIP(), []int{0}
+}
+
+type ListGPUsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	GpuIds        []string               `protobuf:"bytes,1,rep,name=gpu_ids,json=gpuIds,proto3" json:"gpu_ids,omitempty"` // sorted
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListGPUsResponse) Reset() {
+	*x = ListGPUsResponse{}
+	mi := &file_query_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListGPUsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListGPUsResponse) ProtoMessage() {}
+
+func (x *ListGPUsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_query_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListGPUsResponse.ProtoReflect.Descriptor instead.
+func (*ListGPUsResponse) Descriptor() ([]byte, []int) {
+	return file_query_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListGPUsResponse) GetGpuIds() []string {
+	if x != nil {
+		return x.GpuIds
+	}
+	return nil
+}
+
+type QueryTelemetryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	GpuIds        []string               `protobuf:"bytes,1,rep,name=gpu_ids,json=gpuIds,proto3" json:"gpu_ids,omitempty"`    // GPUs to query (at most 1000); gpu_ids or host_ids is required
+	HostIds       []string               `protobuf:"bytes,2,rep,name=host_ids,json=hostIds,proto3" json:"host_ids,omitempty"` // only points reported from these hosts
+	Start         *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=start,proto3" json:"start,omitempty"`                    // inclusive; unset reads from the first point
+	End           *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=end,proto3" json:"end,omitempty"`                        // inclusive; unset reads up to the last point
+	Metrics       []string               `protobuf:"bytes,5,rep,name=metrics,proto3" json:"metrics,omitempty"`                // only these metrics; points with none of them are left out
+	Step          *durationpb.Duration   `protobuf:"bytes,6,opt,name=step,proto3" json:"step,omitempty"`                      // if set (at least 1s), one point per bucket with the mean of each metric
+	Desc          bool                   `protobuf:"varint,7,opt,name=desc,proto3" json:"desc,omitempty"`                     // newest first
+	Limit         uint32                 `protobuf:"varint,8,opt,name=limit,proto3" json:"limit,omitempty"`                   // at most this many points; 0 returns all
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryTelemetryRequest) Reset() {
+	*x = QueryTelemetryRequest{}
+	mi := &file_query_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryTelemetryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryTelemetryRequest) ProtoMessage() {}
+
+func (x *QueryTelemetryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_query_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryTelemetryRequest.ProtoReflect.Descriptor instead.
+func (*QueryTelemetryRequest) Descriptor() ([]byte, []int) {
+	return file_query_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *QueryTelemetryRequest) GetGpuIds() []string {
+	if x != nil {
+		return x.GpuIds
+	}
+	return nil
+}
+
+func (x *QueryTelemetryRequest) GetHostIds() []string {
+	if x != nil {
+		return x.HostIds
+	}
+	return nil
+}
+
+func (x *QueryTelemetryRequest) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *QueryTelemetryRequest) GetEnd() *timestamppb.Timestamp {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *QueryTelemetryRequest) GetMetrics() []string {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *QueryTelemetryRequest) GetStep() *durationpb.Duration {
+	if x != nil {
+		return x.Step
+	}
+	return nil
+}
+
+func (x *QueryTelemetryRequest) GetDesc() bool {
+	if x != nil {
+		return x.Desc
+	}
+	return false
+}
+
+func (x *QueryTelemetryRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type AggregateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metric        string                 `protobuf:"bytes,1,opt,name=metric,proto3" json:"metric,omitempty"`               // required
+	Start         *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=start,proto3" json:"start,omitempty"`                 // inclusive; unset is 5 minutes before end
+	End           *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=end,proto3" json:"end,omitempty"`                     // inclusive; unset is now
+	Agg           string                 `protobuf:"bytes,4,opt,name=agg,proto3" json:"agg,omitempty"`                     // avg (default), max, min or last
+	GpuIds        []string               `protobuf:"bytes,5,rep,name=gpu_ids,json=gpuIds,proto3" json:"gpu_ids,omitempty"` // only these GPUs; empty ranks every GPU
+	Asc           bool                   `protobuf:"varint,6,opt,name=asc,proto3" json:"asc,omitempty"`                    // lowest first
+	Limit         uint32                 `protobuf:"varint,7,opt,name=limit,proto3" json:"limit,omitempty"`                // at most this many GPUs; 0 returns all
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AggregateRequest) Reset() {
+	*x = AggregateRequest{}
+	mi := &file_query_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AggregateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AggregateRequest) ProtoMessage() {}
+
+func (x *AggregateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_query_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AggregateRequest.ProtoReflect.Descriptor instead.
+func (*AggregateRequest) Descriptor() ([]byte, []int) {
+	return file_query_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *AggregateRequest) GetMetric() string {
+	if x != nil {
+		return x.Metric
+	}
+	return ""
+}
+
+func (x *AggregateRequest) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *AggregateRequest) GetEnd() *timestamppb.Timestamp {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *AggregateRequest) GetAgg() string {
+	if x != nil {
+		return x.Agg
+	}
+	return ""
+}
+
+func (x *AggregateRequest) GetGpuIds() []string {
+	if x != nil {
+		return x.GpuIds
+	}
+	return nil
+}
+
+func (x *AggregateRequest) GetAsc() bool {
+	if x != nil {
+		return x.Asc
+	}
+	return false
+}
+
+func (x *AggregateRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type GPUValue struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	GpuId         string                 `protobuf:"bytes,1,opt,name=gpu_id,json=gpuId,proto3" json:"gpu_id,omitempty"`
+	Value         float64                `protobuf:"fixed64,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GPUValue) Reset() {
+	*x = GPUValue{}
+	mi := &file_query_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GPUValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GPUValue) ProtoMessage() {}
+
+func (x *GPUValue) ProtoReflect() protoreflect.Message {
+	mi := &file_query_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GPUValue.ProtoReflect.Descriptor instead.
+func (*GPUValue) Descriptor() ([]byte, []int) {
+	return file_query_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GPUValue) GetGpuId() string {
+	if x != nil {
+		return x.GpuId
+	}
+	return ""
+}
+
+func (x *GPUValue) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+type AggregateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Values        []*GPUValue            `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"` // highest first unless asc; ties by gpu_id
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AggregateResponse) Reset() {
+	*x = AggregateResponse{}
+	mi := &file_query_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AggregateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AggregateResponse) ProtoMessage() {}
+
+func (x *AggregateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_query_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AggregateResponse.ProtoReflect.Descriptor instead.
+func (*AggregateResponse) Descriptor() ([]byte, []int) {
+	return file_query_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *AggregateResponse) GetValues() []*GPUValue {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+var File_query_proto protoreflect.FileDescriptor
+
+const file_query_proto_rawDesc = "" +
+	"\n" +
+	"\vquery.proto\x12\ftelemetry.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x0ftelemetry.proto\"\x11\n" +
+	"\x0fListGPUsRequest\"+\n" +
+	"\x10ListGPUsResponse\x12\x17\n" +
+	"\agpu_ids\x18\x01 \x03(\tR\x06gpuIds\"\x9e\x02\n" +
+	"\x15QueryTelemetryRequest\x12\x17\n" +
+	"\agpu_ids\x18\x01 \x03(\tR\x06gpuIds\x12\x19\n" +
+	"\bhost_ids\x18\x02 \x03(\tR\ahostIds\x120\n" +
+	"\x05start\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12,\n" +
+	"\x03end\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x03end\x12\x18\n" +
+	"\ametrics\x18\x05 \x03(\tR\ametrics\x12-\n" +
+	"\x04step\x18\x06 \x01(\v2\x19.google.protobuf.DurationR\x04step\x12\x12\n" +
+	"\x04desc\x18\a \x01(\bR\x04desc\x12\x14\n" +
+	"\x05limit\x18\b \x01(\rR\x05limit\"\xdd\x01\n" +
+	"\x10AggregateRequest\x12\x16\n" +
+	"\x06metric\x18\x01 \x01(\tR\x06metric\x120\n" +
+	"\x05start\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12,\n" +
+	"\x03end\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x03end\x12\x10\n" +
+	"\x03agg\x18\x04 \x01(\tR\x03agg\x12\x17\n" +
+	"\agpu_ids\x18\x05 \x03(\tR\x06gpuIds\x12\x10\n" +
+	"\x03asc\x18\x06 \x01(\bR\x03asc\x12\x14\n" +
+	"\x05limit\x18\a \x01(\rR\x05limit\"7\n" +
+	"\bGPUValue\x12\x15\n" +
+	"\x06gpu_id\x18\x01 \x01(\tR\x05gpuId\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value\"C\n" +
+	"\x11AggregateResponse\x12.\n" +
+	"\x06values\x18\x01 \x03(\v2\x16.telemetry.v1.GPUValueR\x06values2\xf7\x01\n" +
+	"\x05Query\x12I\n" +
+	"\bListGPUs\x12\x1d.telemetry.v1.ListGPUsRequest\x1a\x1e.telemetry.v1.ListGPUsResponse\x12U\n" +
+	"\x0eQueryTelemetry\x12#.telemetry.v1.QueryTelemetryRequest\x1a\x1c.telemetry.v1.TelemetryBatch0\x01\x12L\n" +
+	"\tAggregate\x12\x1e.telemetry.v1.AggregateRequest\x1a\x1f.telemetry.v1.AggregateResponseB*Z(gpu-metric-collector/api/gen;telemetryv1b\x06proto3"
+
+var (
+	file_query_proto_rawDescOnce sync.Once
+	file_query_proto_rawDescData []byte
+)
+
+func file_query_proto_rawDescGZIP() []byte {
+	file_query_proto_rawDescOnce.Do(func() {
+		file_query_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_query_proto_rawDesc), len(file_query_proto_rawDesc)))
+	})
+	return file_query_proto_rawDescData
+}
+
+var file_query_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_query_proto_goTypes = []any{
+	(*ListGPUsRequest)(nil),       // 0: telemetry.v1.ListGPUsRequest
+	(*ListGPUsResponse)(nil),      // 1: telemetry.v1.ListGPUsResponse
+	(*QueryTelemetryRequest)(nil), // 2: telemetry.v1.QueryTelemetryRequest
+	(*AggregateRequest)(nil),      // 3: telemetry.v1.AggregateRequest
+	(*GPUValue)(nil),              // 4: telemetry.v1.GPUValue
+	(*AggregateResponse)(nil),     // 5: telemetry.v1.AggregateResponse
+	(*timestamppb.Timestamp)(nil), // 6: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),   // 7: google.protobuf.Duration
+	(*TelemetryBatch)(nil),        // 8: telemetry.v1.TelemetryBatch
+}
+var file_query_proto_depIdxs = []int32{
+	6, // 0: telemetry.v1.QueryTelemetryRequest.start:type_name -> google.protobuf.Timestamp
+	6, // 1: telemetry.v1.QueryTelemetryRequest.end:type_name -> google.protobuf.Timestamp
+	7, // 2: telemetry.v1.QueryTelemetryRequest.step:type_name -> google.protobuf.Duration
+	6, // 3: telemetry.v1.AggregateRequest.start:type_name -> google.protobuf.Timestamp
+	6, // 4: telemetry.v1.AggregateRequest.end:type_name -> google.protobuf.Timestamp
+	4, // 5: telemetry.v1.AggregateResponse.values:type_name -> telemetry.v1.GPUValue
+	0, // 6: telemetry.v1.Query.ListGPUs:input_type -> telemetry.v1.ListGPUsRequest
+	2, // 7: telemetry.v1.Query.QueryTelemetry:input_type -> telemetry.v1.QueryTelemetryRequest
+	3, // 8: telemetry.v1.Query.Aggregate:input_type -> telemetry.v1.AggregateRequest
+	1, // 9: telemetry.v1.Query.ListGPUs:output_type -> telemetry.v1.ListGPUsResponse
+	8, // 10: telemetry.v1.Query.QueryTelemetry:output_type -> telemetry.v1.TelemetryBatch
+	5, // 11: telemetry.v1.Query.Aggregate:output_type -> telemetry.v1.AggregateResponse
+	9, // [9:12] is the sub-list for method output_type
+	6, // [6:9] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_query_proto_init() }
+func file_query_proto_init() {
+	if File_query_proto != nil {
+		return
+	}
+	file_telemetry_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_query_proto_rawDesc), len(file_query_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_query_proto_goTypes,
+		DependencyIndexes: file_query_proto_depIdxs,
+		MessageInfos:      file_query_proto_msgTypes,
+	}.Build()
+	File_query_proto = out.File
+	file_query_proto_goTypes = nil
+	file_query_proto_depIdxs = nil
+}
@@ -0,0 +1,211 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.0
+// - protoc             v3.21.12
+// source: query.proto
+
+package telemetryv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Query_ListGPUs_FullMethodName       = "/telemetry.v1.Query/ListGPUs"
+	Query_QueryTelemetry_FullMethodName = "/telemetry.v1.Query/QueryTelemetry"
+	Query_Aggregate_FullMethodName      = "/telemetry.v1.Query/Aggregate"
+)
+
+// QueryClient is the client API for Query service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Query is the gateway's read API for services that would rather not parse
+// JSON. It has the same auth, tenant scoping and store as the REST API.
+type QueryClient interface {
+	ListGPUs(ctx context.Context, in *ListGPUsRequest, opts ...grpc.CallOption) (*ListGPUsResponse, error)
+	// Points come in batches ordered by time, then gpu_id (or the reverse with desc).
+	QueryTelemetry(ctx context.Context, in *QueryTelemetryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TelemetryBatch], error)
+	// Aggregates one metric per GPU over a window and ranks the GPUs.
+	Aggregate(ctx context.Context, in *AggregateRequest, opts ...grpc.CallOption) (*AggregateResponse, error)
+}
+
+type queryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewQueryClient(cc grpc.ClientConnInterface) QueryClient {
+	return &queryClient{cc}
+}
+
+func (c *queryClient) ListGPUs(ctx context.Context, in *ListGPUsRequest, opts ...grpc.CallOption) (*ListGPUsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListGPUsResponse)
+	err := c.cc.Invoke(ctx, Query_ListGPUs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) QueryTelemetry(ctx context.Context, in *QueryTelemetryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TelemetryBatch], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Query_ServiceDesc.Streams[0], Query_QueryTelemetry_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[QueryTelemetryRequest, TelemetryBatch]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Query_QueryTelemetryClient = grpc.ServerStreamingClient[TelemetryBatch]
+
+func (c *queryClient) Aggregate(ctx context.Context, in *AggregateRequest, opts ...grpc.CallOption) (*AggregateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AggregateResponse)
+	err := c.cc.Invoke(ctx, Query_Aggregate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// QueryServer is the server API for Query service.
+// All implementations must embed UnimplementedQueryServer
+// for forward compatibility.
+//
+// Query is the gateway's read API for services that would rather not parse
+// JSON. It has the same auth, tenant scoping and store as the REST API.
+type QueryServer interface {
+	ListGPUs(context.Context, *ListGPUsRequest) (*ListGPUsResponse, error)
+	// Points come in batches ordered by time, then gpu_id (or the reverse with desc).
+	QueryTelemetry(*QueryTelemetryRequest, grpc.ServerStreamingServer[TelemetryBatch]) error
+	// Aggregates one metric per GPU over a window and ranks the GPUs.
+	Aggregate(context.Context, *AggregateRequest) (*AggregateResponse, error)
+	mustEmbedUnimplementedQueryServer()
+}
+
+// UnimplementedQueryServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedQueryServer struct{}
+
+func (UnimplementedQueryServer) ListGPUs(context.Context, *ListGPUsRequest) (*ListGPUsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListGPUs not implemented")
+}
+func (UnimplementedQueryServer) QueryTelemetry(*QueryTelemetryRequest, grpc.ServerStreamingServer[TelemetryBatch]) error {
+	return status.Error(codes.Unimplemented, "method QueryTelemetry not implemented")
+}
+func (UnimplementedQueryServer) Aggregate(context.Context, *AggregateRequest) (*AggregateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Aggregate not implemented")
+}
+func (UnimplementedQueryServer) mustEmbedUnimplementedQueryServer() {}
+func (UnimplementedQueryServer) testEmbeddedByValue()               {}
+
+// UnsafeQueryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to QueryServer will
+// result in compilation errors.
+type UnsafeQueryServer interface {
+	mustEmbedUnimplementedQueryServer()
+}
+
+func RegisterQueryServer(s grpc.ServiceRegistrar, srv QueryServer) {
+	// If the following call panics, it indicates UnimplementedQueryServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Query_ServiceDesc, srv)
+}
+
+func _Query_ListGPUs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListGPUsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).ListGPUs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Query_ListGPUs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).ListGPUs(ctx, req.(*ListGPUsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_QueryTelemetry_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryTelemetryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QueryServer).QueryTelemetry(m, &grpc.GenericServerStream[QueryTelemetryRequest, TelemetryBatch]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Query_QueryTelemetryServer = grpc.ServerStreamingServer[TelemetryBatch]
+
+func _Query_Aggregate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AggregateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).Aggregate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Query_Aggregate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).Aggregate(ctx, req.(*AggregateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Query_ServiceDesc is the grpc.ServiceDesc for Query service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Query_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "telemetry.v1.Query",
+	HandlerType: (*QueryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListGPUs",
+			Handler:    _Query_ListGPUs_Handler,
+		},
+		{
+			MethodName: "Aggregate",
+			Handler:    _Query_Aggregate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "QueryTelemetry",
+			Handler:       _Query_QueryTelemetry_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "query.proto",
+}
@@ -23,14 +23,20 @@ const (
 )
 
 type TelemetryData struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	ProducerId    string                 `protobuf:"bytes,1,opt,name=producer_id,json=producerId,proto3" json:"producer_id,omitempty"`                                                     // Streamer identity (e.g., pod name)
-	HostId        string                 `protobuf:"bytes,2,opt,name=host_id,json=hostId,proto3" json:"host_id,omitempty"`                                                                 // Hostname/node
-	GpuId         string                 `protobuf:"bytes,3,opt,name=gpu_id,json=gpuId,proto3" json:"gpu_id,omitempty"`                                                                    // GPU identifier
-	Ts            *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=ts,proto3" json:"ts,omitempty"`                                                                                       // Source timestamp from streamer
-	Metrics       map[string]float64     `protobuf:"bytes,5,rep,name=metrics,proto3" json:"metrics,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"` // Arbitrary numeric metrics
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state          protoimpl.MessageState  `protogen:"open.v1"`
+	ProducerId     string                  `protobuf:"bytes,1,opt,name=producer_id,json=producerId,proto3" json:"producer_id,omitempty"`                                                     // Streamer identity (e.g., pod name)
+	HostId         string                  `protobuf:"bytes,2,opt,name=host_id,json=hostId,proto3" json:"host_id,omitempty"`                                                                 // Hostname/node
+	GpuId          string                  `protobuf:"bytes,3,opt,name=gpu_id,json=gpuId,proto3" json:"gpu_id,omitempty"`                                                                    // GPU identifier
+	Ts             *timestamppb.Timestamp  `protobuf:"bytes,4,opt,name=ts,proto3" json:"ts,omitempty"`                                                                                       // Source timestamp from streamer
+	Metrics        map[string]float64      `protobuf:"bytes,5,rep,name=metrics,proto3" json:"metrics,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"` // Arbitrary numeric metrics
+	Offset         uint64                  `protobuf:"varint,6,opt,name=offset,proto3" json:"offset,omitempty"`                                                                              // Assigned by the broker on enqueue; echoed back in Ack
+	IdempotencyKey string                  `protobuf:"bytes,7,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`                                         // Producer-assigned unique key; stores upsert on it
+	Labels         map[string]string       `protobuf:"bytes,8,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`     // Free-form attributes (cluster, rack, pod, driver version); stored as tags
+	Sequence       uint64                  `protobuf:"varint,9,opt,name=sequence,proto3" json:"sequence,omitempty"`                                                                          // Producer-assigned, 1 for a producer's first item and +1 per item after; 0 if unset
+	BatchId        string                  `protobuf:"bytes,10,opt,name=batch_id,json=batchId,proto3" json:"batch_id,omitempty"`                                                             // Producer-assigned id of the batch the item was published in
+	Values         map[string]*MetricValue `protobuf:"bytes,11,rep,name=values,proto3" json:"values,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`    // Metrics that are not plain doubles (large integers, flags, strings)
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
 func (x *TelemetryData) Reset() {
@@ -98,16 +104,174 @@ func (x *TelemetryData) GetMetrics() map[string]float64 {
 	return nil
 }
 
+func (x *TelemetryData) GetOffset() uint64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *TelemetryData) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+func (x *TelemetryData) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *TelemetryData) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *TelemetryData) GetBatchId() string {
+	if x != nil {
+		return x.BatchId
+	}
+	return ""
+}
+
+func (x *TelemetryData) GetValues() map[string]*MetricValue {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+// MetricValue is one typed metric value.
+type MetricValue struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Value:
+	//
+	//	*MetricValue_FloatValue
+	//	*MetricValue_IntValue
+	//	*MetricValue_BoolValue
+	//	*MetricValue_StringValue
+	Value         isMetricValue_Value `protobuf_oneof:"value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricValue) Reset() {
+	*x = MetricValue{}
+	mi := &file_telemetry_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricValue) ProtoMessage() {}
+
+func (x *MetricValue) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricValue.ProtoReflect.Descriptor instead.
+func (*MetricValue) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *MetricValue) GetValue() isMetricValue_Value {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *MetricValue) GetFloatValue() float64 {
+	if x != nil {
+		if x, ok := x.Value.(*MetricValue_FloatValue); ok {
+			return x.FloatValue
+		}
+	}
+	return 0
+}
+
+func (x *MetricValue) GetIntValue() int64 {
+	if x != nil {
+		if x, ok := x.Value.(*MetricValue_IntValue); ok {
+			return x.IntValue
+		}
+	}
+	return 0
+}
+
+func (x *MetricValue) GetBoolValue() bool {
+	if x != nil {
+		if x, ok := x.Value.(*MetricValue_BoolValue); ok {
+			return x.BoolValue
+		}
+	}
+	return false
+}
+
+func (x *MetricValue) GetStringValue() string {
+	if x != nil {
+		if x, ok := x.Value.(*MetricValue_StringValue); ok {
+			return x.StringValue
+		}
+	}
+	return ""
+}
+
+type isMetricValue_Value interface {
+	isMetricValue_Value()
+}
+
+type MetricValue_FloatValue struct {
+	FloatValue float64 `protobuf:"fixed64,1,opt,name=float_value,json=floatValue,proto3,oneof"`
+}
+
+type MetricValue_IntValue struct {
+	IntValue int64 `protobuf:"varint,2,opt,name=int_value,json=intValue,proto3,oneof"`
+}
+
+type MetricValue_BoolValue struct {
+	BoolValue bool `protobuf:"varint,3,opt,name=bool_value,json=boolValue,proto3,oneof"`
+}
+
+type MetricValue_StringValue struct {
+	StringValue string `protobuf:"bytes,4,opt,name=string_value,json=stringValue,proto3,oneof"`
+}
+
+func (*MetricValue_FloatValue) isMetricValue_Value() {}
+
+func (*MetricValue_IntValue) isMetricValue_Value() {}
+
+func (*MetricValue_BoolValue) isMetricValue_Value() {}
+
+func (*MetricValue_StringValue) isMetricValue_Value() {}
+
 type TelemetryBatch struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Items         []*TelemetryData       `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	BatchId       string                 `protobuf:"bytes,2,opt,name=batch_id,json=batchId,proto3" json:"batch_id,omitempty"` // Producer-assigned; a retry of the batch, or of its unaccepted rest, reuses it
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *TelemetryBatch) Reset() {
 	*x = TelemetryBatch{}
-	mi := &file_telemetry_proto_msgTypes[1]
+	mi := &file_telemetry_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -119,7 +283,7 @@ func (x *TelemetryBatch) String() string {
 func (*TelemetryBatch) ProtoMessage() {}
 
 func (x *TelemetryBatch) ProtoReflect() protoreflect.Message {
-	mi := &file_telemetry_proto_msgTypes[1]
+	mi := &file_telemetry_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -132,7 +296,7 @@ func (x *TelemetryBatch) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TelemetryBatch.ProtoReflect.Descriptor instead.
 func (*TelemetryBatch) Descriptor() ([]byte, []int) {
-	return file_telemetry_proto_rawDescGZIP(), []int{1}
+	return file_telemetry_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *TelemetryBatch) GetItems() []*TelemetryData {
@@ -142,17 +306,25 @@ func (x *TelemetryBatch) GetItems() []*TelemetryData {
 	return nil
 }
 
+func (x *TelemetryBatch) GetBatchId() string {
+	if x != nil {
+		return x.BatchId
+	}
+	return ""
+}
+
 type PublishResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Accepted      int64                  `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"` // number of items enqueued
 	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`      // OK, BACKPRESSURE, ERROR
+	Items         []*ItemStatus          `protobuf:"bytes,3,rep,name=items,proto3" json:"items,omitempty"`        // one per item not enqueued, in batch order; enqueued items are not listed
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *PublishResponse) Reset() {
 	*x = PublishResponse{}
-	mi := &file_telemetry_proto_msgTypes[2]
+	mi := &file_telemetry_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -164,7 +336,7 @@ func (x *PublishResponse) String() string {
 func (*PublishResponse) ProtoMessage() {}
 
 func (x *PublishResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_telemetry_proto_msgTypes[2]
+	mi := &file_telemetry_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -177,7 +349,7 @@ func (x *PublishResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PublishResponse.ProtoReflect.Descriptor instead.
 func (*PublishResponse) Descriptor() ([]byte, []int) {
-	return file_telemetry_proto_rawDescGZIP(), []int{2}
+	return file_telemetry_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *PublishResponse) GetAccepted() int64 {
@@ -194,17 +366,88 @@ func (x *PublishResponse) GetStatus() string {
 	return ""
 }
 
+func (x *PublishResponse) GetItems() []*ItemStatus {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+// ItemStatus says why one item of a batch was not enqueued.
+type ItemStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         uint32                 `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`  // position of the item in TelemetryBatch.items
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"` // REJECTED: invalid, do not resend; BACKPRESSURE: queue full, resend later
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ItemStatus) Reset() {
+	*x = ItemStatus{}
+	mi := &file_telemetry_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ItemStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ItemStatus) ProtoMessage() {}
+
+func (x *ItemStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ItemStatus.ProtoReflect.Descriptor instead.
+func (*ItemStatus) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ItemStatus) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *ItemStatus) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ItemStatus) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
 type SubscriptionRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"` // consumer group (optional)
-	Topic         string                 `protobuf:"bytes,2,opt,name=topic,proto3" json:"topic,omitempty"` // topic (optional for future use)
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`                              // consumer group (optional)
+	Topic         string                 `protobuf:"bytes,2,opt,name=topic,proto3" json:"topic,omitempty"`                              // topic (optional for future use)
+	ManualAck     bool                   `protobuf:"varint,3,opt,name=manual_ack,json=manualAck,proto3" json:"manual_ack,omitempty"`    // hold each delivered message until acked; redeliver on timeout or disconnect
+	ShardIndex    uint32                 `protobuf:"varint,4,opt,name=shard_index,json=shardIndex,proto3" json:"shard_index,omitempty"` // with shard_count > 0, receive only GPUs whose gpu_id hashes to this shard
+	ShardCount    uint32                 `protobuf:"varint,5,opt,name=shard_count,json=shardCount,proto3" json:"shard_count,omitempty"` // number of shards; 0 receives every GPU
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *SubscriptionRequest) Reset() {
 	*x = SubscriptionRequest{}
-	mi := &file_telemetry_proto_msgTypes[3]
+	mi := &file_telemetry_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -216,7 +459,7 @@ func (x *SubscriptionRequest) String() string {
 func (*SubscriptionRequest) ProtoMessage() {}
 
 func (x *SubscriptionRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_telemetry_proto_msgTypes[3]
+	mi := &file_telemetry_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -229,7 +472,7 @@ func (x *SubscriptionRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SubscriptionRequest.ProtoReflect.Descriptor instead.
 func (*SubscriptionRequest) Descriptor() ([]byte, []int) {
-	return file_telemetry_proto_rawDescGZIP(), []int{3}
+	return file_telemetry_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *SubscriptionRequest) GetGroup() string {
@@ -246,73 +489,873 @@ func (x *SubscriptionRequest) GetTopic() string {
 	return ""
 }
 
-var File_telemetry_proto protoreflect.FileDescriptor
+func (x *SubscriptionRequest) GetManualAck() bool {
+	if x != nil {
+		return x.ManualAck
+	}
+	return false
+}
 
-const file_telemetry_proto_rawDesc = "" +
-	"\n" +
-	"\x0ftelemetry.proto\x12\ftelemetry.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x8c\x02\n" +
-	"\rTelemetryData\x12\x1f\n" +
-	"\vproducer_id\x18\x01 \x01(\tR\n" +
-	"producerId\x12\x17\n" +
-	"\ahost_id\x18\x02 \x01(\tR\x06hostId\x12\x15\n" +
-	"\x06gpu_id\x18\x03 \x01(\tR\x05gpuId\x12*\n" +
-	"\x02ts\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x02ts\x12B\n" +
-	"\ametrics\x18\x05 \x03(\v2(.telemetry.v1.TelemetryData.MetricsEntryR\ametrics\x1a:\n" +
-	"\fMetricsEntry\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01\"C\n" +
-	"\x0eTelemetryBatch\x121\n" +
-	"\x05items\x18\x01 \x03(\v2\x1b.telemetry.v1.TelemetryDataR\x05items\"E\n" +
-	"\x0fPublishResponse\x12\x1a\n" +
-	"\baccepted\x18\x01 \x01(\x03R\baccepted\x12\x16\n" +
-	"\x06status\x18\x02 \x01(\tR\x06status\"A\n" +
-	"\x13SubscriptionRequest\x12\x14\n" +
-	"\x05group\x18\x01 \x01(\tR\x05group\x12\x14\n" +
-	"\x05topic\x18\x02 \x01(\tR\x05topic2\xa7\x01\n" +
-	"\tTelemetry\x12K\n" +
-	"\fPublishBatch\x12\x1c.telemetry.v1.TelemetryBatch\x1a\x1d.telemetry.v1.PublishResponse\x12M\n" +
-	"\tSubscribe\x12!.telemetry.v1.SubscriptionRequest\x1a\x1b.telemetry.v1.TelemetryData0\x01B7Z5gpu-metric-collector/api/gen/telemetry/v1;telemetryv1b\x06proto3"
+func (x *SubscriptionRequest) GetShardIndex() uint32 {
+	if x != nil {
+		return x.ShardIndex
+	}
+	return 0
+}
 
-var (
-	file_telemetry_proto_rawDescOnce sync.Once
-	file_telemetry_proto_rawDescData []byte
-)
+func (x *SubscriptionRequest) GetShardCount() uint32 {
+	if x != nil {
+		return x.ShardCount
+	}
+	return 0
+}
 
-func file_telemetry_proto_rawDescGZIP() []byte {
-	file_telemetry_proto_rawDescOnce.Do(func() {
-		file_telemetry_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_telemetry_proto_rawDesc), len(file_telemetry_proto_rawDesc)))
-	})
-	return file_telemetry_proto_rawDescData
+type AckRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Offsets       []uint64               `protobuf:"varint,2,rep,packed,name=offsets,proto3" json:"offsets,omitempty"` // offsets of durably persisted (or deliberately dropped) messages
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-var file_telemetry_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
-var file_telemetry_proto_goTypes = []any{
-	(*TelemetryData)(nil),         // 0: telemetry.v1.TelemetryData
-	(*TelemetryBatch)(nil),        // 1: telemetry.v1.TelemetryBatch
-	(*PublishResponse)(nil),       // 2: telemetry.v1.PublishResponse
-	(*SubscriptionRequest)(nil),   // 3: telemetry.v1.SubscriptionRequest
-	nil,                           // 4: telemetry.v1.TelemetryData.MetricsEntry
-	(*timestamppb.Timestamp)(nil), // 5: google.protobuf.Timestamp
+func (x *AckRequest) Reset() {
+	*x = AckRequest{}
+	mi := &file_telemetry_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
-var file_telemetry_proto_depIdxs = []int32{
-	5, // 0: telemetry.v1.TelemetryData.ts:type_name -> google.protobuf.Timestamp
-	4, // 1: telemetry.v1.TelemetryData.metrics:type_name -> telemetry.v1.TelemetryData.MetricsEntry
-	0, // 2: telemetry.v1.TelemetryBatch.items:type_name -> telemetry.v1.TelemetryData
-	1, // 3: telemetry.v1.Telemetry.PublishBatch:input_type -> telemetry.v1.TelemetryBatch
-	3, // 4: telemetry.v1.Telemetry.Subscribe:input_type -> telemetry.v1.SubscriptionRequest
-	2, // 5: telemetry.v1.Telemetry.PublishBatch:output_type -> telemetry.v1.PublishResponse
-	0, // 6: telemetry.v1.Telemetry.Subscribe:output_type -> telemetry.v1.TelemetryData
-	5, // [5:7] is the sub-list for method output_type
-	3, // [3:5] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+
+func (x *AckRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-func init() { file_telemetry_proto_init() }
-func file_telemetry_proto_init() {
-	if File_telemetry_proto != nil {
-		return
+func (*AckRequest) ProtoMessage() {}
+
+func (x *AckRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AckRequest.ProtoReflect.Descriptor instead.
+func (*AckRequest) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AckRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *AckRequest) GetOffsets() []uint64 {
+	if x != nil {
+		return x.Offsets
+	}
+	return nil
+}
+
+type AckResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Acked         int64                  `protobuf:"varint,1,opt,name=acked,proto3" json:"acked,omitempty"` // number of offsets that were pending and are now released
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AckResponse) Reset() {
+	*x = AckResponse{}
+	mi := &file_telemetry_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AckResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AckResponse) ProtoMessage() {}
+
+func (x *AckResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AckResponse.ProtoReflect.Descriptor instead.
+func (*AckResponse) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AckResponse) GetAcked() int64 {
+	if x != nil {
+		return x.Acked
+	}
+	return 0
+}
+
+// GpuInfo is the static description of one GPU, announced by its streamer.
+type GpuInfo struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	GpuId            string                 `protobuf:"bytes,1,opt,name=gpu_id,json=gpuId,proto3" json:"gpu_id,omitempty"`
+	Uuid             string                 `protobuf:"bytes,2,opt,name=uuid,proto3" json:"uuid,omitempty"`   // e.g. GPU-5fd4f087-...
+	Model            string                 `protobuf:"bytes,3,opt,name=model,proto3" json:"model,omitempty"` // e.g. NVIDIA H100 80GB HBM3
+	VbiosVersion     string                 `protobuf:"bytes,4,opt,name=vbios_version,json=vbiosVersion,proto3" json:"vbios_version,omitempty"`
+	DriverVersion    string                 `protobuf:"bytes,5,opt,name=driver_version,json=driverVersion,proto3" json:"driver_version,omitempty"`
+	MemoryTotalBytes uint64                 `protobuf:"varint,6,opt,name=memory_total_bytes,json=memoryTotalBytes,proto3" json:"memory_total_bytes,omitempty"`
+	PciBusId         string                 `protobuf:"bytes,7,opt,name=pci_bus_id,json=pciBusId,proto3" json:"pci_bus_id,omitempty"` // e.g. 00000000:18:00.0
+	HostId           string                 `protobuf:"bytes,8,opt,name=host_id,json=hostId,proto3" json:"host_id,omitempty"`
+	ProducerId       string                 `protobuf:"bytes,9,opt,name=producer_id,json=producerId,proto3" json:"producer_id,omitempty"`
+	RegisteredAt     *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=registered_at,json=registeredAt,proto3" json:"registered_at,omitempty"` // set by the broker when the info last changed
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *GpuInfo) Reset() {
+	*x = GpuInfo{}
+	mi := &file_telemetry_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GpuInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GpuInfo) ProtoMessage() {}
+
+func (x *GpuInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GpuInfo.ProtoReflect.Descriptor instead.
+func (*GpuInfo) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GpuInfo) GetGpuId() string {
+	if x != nil {
+		return x.GpuId
+	}
+	return ""
+}
+
+func (x *GpuInfo) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *GpuInfo) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *GpuInfo) GetVbiosVersion() string {
+	if x != nil {
+		return x.VbiosVersion
+	}
+	return ""
+}
+
+func (x *GpuInfo) GetDriverVersion() string {
+	if x != nil {
+		return x.DriverVersion
+	}
+	return ""
+}
+
+func (x *GpuInfo) GetMemoryTotalBytes() uint64 {
+	if x != nil {
+		return x.MemoryTotalBytes
+	}
+	return 0
+}
+
+func (x *GpuInfo) GetPciBusId() string {
+	if x != nil {
+		return x.PciBusId
+	}
+	return ""
+}
+
+func (x *GpuInfo) GetHostId() string {
+	if x != nil {
+		return x.HostId
+	}
+	return ""
+}
+
+func (x *GpuInfo) GetProducerId() string {
+	if x != nil {
+		return x.ProducerId
+	}
+	return ""
+}
+
+func (x *GpuInfo) GetRegisteredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.RegisteredAt
+	}
+	return nil
+}
+
+type RegisterGPUsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Gpus          []*GpuInfo             `protobuf:"bytes,1,rep,name=gpus,proto3" json:"gpus,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterGPUsRequest) Reset() {
+	*x = RegisterGPUsRequest{}
+	mi := &file_telemetry_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterGPUsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterGPUsRequest) ProtoMessage() {}
+
+func (x *RegisterGPUsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterGPUsRequest.ProtoReflect.Descriptor instead.
+func (*RegisterGPUsRequest) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *RegisterGPUsRequest) GetGpus() []*GpuInfo {
+	if x != nil {
+		return x.Gpus
+	}
+	return nil
+}
+
+type RegisterGPUsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Changed       int64                  `protobuf:"varint,1,opt,name=changed,proto3" json:"changed,omitempty"` // number of GPUs that were new or whose info changed
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterGPUsResponse) Reset() {
+	*x = RegisterGPUsResponse{}
+	mi := &file_telemetry_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterGPUsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterGPUsResponse) ProtoMessage() {}
+
+func (x *RegisterGPUsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterGPUsResponse.ProtoReflect.Descriptor instead.
+func (*RegisterGPUsResponse) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *RegisterGPUsResponse) GetChanged() int64 {
+	if x != nil {
+		return x.Changed
+	}
+	return 0
+}
+
+type ListGPUInfoRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AfterRevision uint64                 `protobuf:"varint,1,opt,name=after_revision,json=afterRevision,proto3" json:"after_revision,omitempty"` // only GPUs changed after this revision; 0 lists every GPU
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListGPUInfoRequest) Reset() {
+	*x = ListGPUInfoRequest{}
+	mi := &file_telemetry_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListGPUInfoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListGPUInfoRequest) ProtoMessage() {}
+
+func (x *ListGPUInfoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListGPUInfoRequest.ProtoReflect.Descriptor instead.
+func (*ListGPUInfoRequest) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListGPUInfoRequest) GetAfterRevision() uint64 {
+	if x != nil {
+		return x.AfterRevision
+	}
+	return 0
+}
+
+type ListGPUInfoResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Gpus          []*GpuInfo             `protobuf:"bytes,1,rep,name=gpus,proto3" json:"gpus,omitempty"`
+	Revision      uint64                 `protobuf:"varint,2,opt,name=revision,proto3" json:"revision,omitempty"` // pass as after_revision to get later changes only
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListGPUInfoResponse) Reset() {
+	*x = ListGPUInfoResponse{}
+	mi := &file_telemetry_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListGPUInfoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListGPUInfoResponse) ProtoMessage() {}
+
+func (x *ListGPUInfoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListGPUInfoResponse.ProtoReflect.Descriptor instead.
+func (*ListGPUInfoResponse) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ListGPUInfoResponse) GetGpus() []*GpuInfo {
+	if x != nil {
+		return x.Gpus
+	}
+	return nil
+}
+
+func (x *ListGPUInfoResponse) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+type GetStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsRequest) Reset() {
+	*x = GetStatsRequest{}
+	mi := &file_telemetry_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsRequest) ProtoMessage() {}
+
+func (x *GetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{13}
+}
+
+// GroupStats is the state of one subscriber group.
+type GroupStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Subscribers   uint32                 `protobuf:"varint,2,opt,name=subscribers,proto3" json:"subscribers,omitempty"`
+	Buffered      uint64                 `protobuf:"varint,3,opt,name=buffered,proto3" json:"buffered,omitempty"` // dispatched to the group's subscribers and not yet sent
+	Unacked       uint64                 `protobuf:"varint,4,opt,name=unacked,proto3" json:"unacked,omitempty"`   // sent on the group's manual_ack subscriptions and awaiting ack
+	Lag           uint64                 `protobuf:"varint,5,opt,name=lag,proto3" json:"lag,omitempty"`           // buffered + unacked
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GroupStats) Reset() {
+	*x = GroupStats{}
+	mi := &file_telemetry_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GroupStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GroupStats) ProtoMessage() {}
+
+func (x *GroupStats) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GroupStats.ProtoReflect.Descriptor instead.
+func (*GroupStats) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *GroupStats) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *GroupStats) GetSubscribers() uint32 {
+	if x != nil {
+		return x.Subscribers
+	}
+	return 0
+}
+
+func (x *GroupStats) GetBuffered() uint64 {
+	if x != nil {
+		return x.Buffered
+	}
+	return 0
+}
+
+func (x *GroupStats) GetUnacked() uint64 {
+	if x != nil {
+		return x.Unacked
+	}
+	return 0
+}
+
+func (x *GroupStats) GetLag() uint64 {
+	if x != nil {
+		return x.Lag
+	}
+	return 0
+}
+
+type GetStatsResponse struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	QueueDepth        uint64                 `protobuf:"varint,1,opt,name=queue_depth,json=queueDepth,proto3" json:"queue_depth,omitempty"` // items in the inbound queue, waiting for a subscriber
+	QueueCapacity     uint64                 `protobuf:"varint,2,opt,name=queue_capacity,json=queueCapacity,proto3" json:"queue_capacity,omitempty"`
+	Subscribers       uint32                 `protobuf:"varint,3,opt,name=subscribers,proto3" json:"subscribers,omitempty"`
+	Groups            []*GroupStats          `protobuf:"bytes,4,rep,name=groups,proto3" json:"groups,omitempty"`                                                 // sorted by group
+	Unacked           uint64                 `protobuf:"varint,5,opt,name=unacked,proto3" json:"unacked,omitempty"`                                              // all pending items, including those parked for lack of a shard owner
+	AcceptedTotal     uint64                 `protobuf:"varint,6,opt,name=accepted_total,json=acceptedTotal,proto3" json:"accepted_total,omitempty"`             // items enqueued since the broker started
+	RejectedTotal     uint64                 `protobuf:"varint,7,opt,name=rejected_total,json=rejectedTotal,proto3" json:"rejected_total,omitempty"`             // items rejected as invalid
+	BackpressureTotal uint64                 `protobuf:"varint,8,opt,name=backpressure_total,json=backpressureTotal,proto3" json:"backpressure_total,omitempty"` // publishes that hit a full queue
+	DeliveredTotal    uint64                 `protobuf:"varint,9,opt,name=delivered_total,json=deliveredTotal,proto3" json:"delivered_total,omitempty"`          // items sent to subscribers
+	AcceptRate        float64                `protobuf:"fixed64,10,opt,name=accept_rate,json=acceptRate,proto3" json:"accept_rate,omitempty"`                    // items per second over the last stats window
+	RejectRate        float64                `protobuf:"fixed64,11,opt,name=reject_rate,json=rejectRate,proto3" json:"reject_rate,omitempty"`
+	DeliverRate       float64                `protobuf:"fixed64,12,opt,name=deliver_rate,json=deliverRate,proto3" json:"deliver_rate,omitempty"`
+	WindowSeconds     float64                `protobuf:"fixed64,13,opt,name=window_seconds,json=windowSeconds,proto3" json:"window_seconds,omitempty"` // length of the window the rates cover
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *GetStatsResponse) Reset() {
+	*x = GetStatsResponse{}
+	mi := &file_telemetry_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsResponse) ProtoMessage() {}
+
+func (x *GetStatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsResponse.ProtoReflect.Descriptor instead.
+func (*GetStatsResponse) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *GetStatsResponse) GetQueueDepth() uint64 {
+	if x != nil {
+		return x.QueueDepth
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetQueueCapacity() uint64 {
+	if x != nil {
+		return x.QueueCapacity
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetSubscribers() uint32 {
+	if x != nil {
+		return x.Subscribers
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetGroups() []*GroupStats {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+func (x *GetStatsResponse) GetUnacked() uint64 {
+	if x != nil {
+		return x.Unacked
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetAcceptedTotal() uint64 {
+	if x != nil {
+		return x.AcceptedTotal
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetRejectedTotal() uint64 {
+	if x != nil {
+		return x.RejectedTotal
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetBackpressureTotal() uint64 {
+	if x != nil {
+		return x.BackpressureTotal
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetDeliveredTotal() uint64 {
+	if x != nil {
+		return x.DeliveredTotal
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetAcceptRate() float64 {
+	if x != nil {
+		return x.AcceptRate
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetRejectRate() float64 {
+	if x != nil {
+		return x.RejectRate
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetDeliverRate() float64 {
+	if x != nil {
+		return x.DeliverRate
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetWindowSeconds() float64 {
+	if x != nil {
+		return x.WindowSeconds
+	}
+	return 0
+}
+
+var File_telemetry_proto protoreflect.FileDescriptor
+
+const file_telemetry_proto_rawDesc = "" +
+	"\n" +
+	"\x0ftelemetry.proto\x12\ftelemetry.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x97\x05\n" +
+	"\rTelemetryData\x12\x1f\n" +
+	"\vproducer_id\x18\x01 \x01(\tR\n" +
+	"producerId\x12\x17\n" +
+	"\ahost_id\x18\x02 \x01(\tR\x06hostId\x12\x15\n" +
+	"\x06gpu_id\x18\x03 \x01(\tR\x05gpuId\x12*\n" +
+	"\x02ts\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x02ts\x12B\n" +
+	"\ametrics\x18\x05 \x03(\v2(.telemetry.v1.TelemetryData.MetricsEntryR\ametrics\x12\x16\n" +
+	"\x06offset\x18\x06 \x01(\x04R\x06offset\x12'\n" +
+	"\x0fidempotency_key\x18\a \x01(\tR\x0eidempotencyKey\x12?\n" +
+	"\x06labels\x18\b \x03(\v2'.telemetry.v1.TelemetryData.LabelsEntryR\x06labels\x12\x1a\n" +
+	"\bsequence\x18\t \x01(\x04R\bsequence\x12\x19\n" +
+	"\bbatch_id\x18\n" +
+	" \x01(\tR\abatchId\x12?\n" +
+	"\x06values\x18\v \x03(\v2'.telemetry.v1.TelemetryData.ValuesEntryR\x06values\x1a:\n" +
+	"\fMetricsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1aT\n" +
+	"\vValuesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12/\n" +
+	"\x05value\x18\x02 \x01(\v2\x19.telemetry.v1.MetricValueR\x05value:\x028\x01\"\x9e\x01\n" +
+	"\vMetricValue\x12!\n" +
+	"\vfloat_value\x18\x01 \x01(\x01H\x00R\n" +
+	"floatValue\x12\x1d\n" +
+	"\tint_value\x18\x02 \x01(\x03H\x00R\bintValue\x12\x1f\n" +
+	"\n" +
+	"bool_value\x18\x03 \x01(\bH\x00R\tboolValue\x12#\n" +
+	"\fstring_value\x18\x04 \x01(\tH\x00R\vstringValueB\a\n" +
+	"\x05value\"^\n" +
+	"\x0eTelemetryBatch\x121\n" +
+	"\x05items\x18\x01 \x03(\v2\x1b.telemetry.v1.TelemetryDataR\x05items\x12\x19\n" +
+	"\bbatch_id\x18\x02 \x01(\tR\abatchId\"u\n" +
+	"\x0fPublishResponse\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\x03R\baccepted\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12.\n" +
+	"\x05items\x18\x03 \x03(\v2\x18.telemetry.v1.ItemStatusR\x05items\"R\n" +
+	"\n" +
+	"ItemStatus\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\rR\x05index\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\"\xa2\x01\n" +
+	"\x13SubscriptionRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x14\n" +
+	"\x05topic\x18\x02 \x01(\tR\x05topic\x12\x1d\n" +
+	"\n" +
+	"manual_ack\x18\x03 \x01(\bR\tmanualAck\x12\x1f\n" +
+	"\vshard_index\x18\x04 \x01(\rR\n" +
+	"shardIndex\x12\x1f\n" +
+	"\vshard_count\x18\x05 \x01(\rR\n" +
+	"shardCount\"<\n" +
+	"\n" +
+	"AckRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x18\n" +
+	"\aoffsets\x18\x02 \x03(\x04R\aoffsets\"#\n" +
+	"\vAckResponse\x12\x14\n" +
+	"\x05acked\x18\x01 \x01(\x03R\x05acked\"\xdd\x02\n" +
+	"\aGpuInfo\x12\x15\n" +
+	"\x06gpu_id\x18\x01 \x01(\tR\x05gpuId\x12\x12\n" +
+	"\x04uuid\x18\x02 \x01(\tR\x04uuid\x12\x14\n" +
+	"\x05model\x18\x03 \x01(\tR\x05model\x12#\n" +
+	"\rvbios_version\x18\x04 \x01(\tR\fvbiosVersion\x12%\n" +
+	"\x0edriver_version\x18\x05 \x01(\tR\rdriverVersion\x12,\n" +
+	"\x12memory_total_bytes\x18\x06 \x01(\x04R\x10memoryTotalBytes\x12\x1c\n" +
+	"\n" +
+	"pci_bus_id\x18\a \x01(\tR\bpciBusId\x12\x17\n" +
+	"\ahost_id\x18\b \x01(\tR\x06hostId\x12\x1f\n" +
+	"\vproducer_id\x18\t \x01(\tR\n" +
+	"producerId\x12?\n" +
+	"\rregistered_at\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\fregisteredAt\"@\n" +
+	"\x13RegisterGPUsRequest\x12)\n" +
+	"\x04gpus\x18\x01 \x03(\v2\x15.telemetry.v1.GpuInfoR\x04gpus\"0\n" +
+	"\x14RegisterGPUsResponse\x12\x18\n" +
+	"\achanged\x18\x01 \x01(\x03R\achanged\";\n" +
+	"\x12ListGPUInfoRequest\x12%\n" +
+	"\x0eafter_revision\x18\x01 \x01(\x04R\rafterRevision\"\\\n" +
+	"\x13ListGPUInfoResponse\x12)\n" +
+	"\x04gpus\x18\x01 \x03(\v2\x15.telemetry.v1.GpuInfoR\x04gpus\x12\x1a\n" +
+	"\brevision\x18\x02 \x01(\x04R\brevision\"\x11\n" +
+	"\x0fGetStatsRequest\"\x8c\x01\n" +
+	"\n" +
+	"GroupStats\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12 \n" +
+	"\vsubscribers\x18\x02 \x01(\rR\vsubscribers\x12\x1a\n" +
+	"\bbuffered\x18\x03 \x01(\x04R\bbuffered\x12\x18\n" +
+	"\aunacked\x18\x04 \x01(\x04R\aunacked\x12\x10\n" +
+	"\x03lag\x18\x05 \x01(\x04R\x03lag\"\xfa\x03\n" +
+	"\x10GetStatsResponse\x12\x1f\n" +
+	"\vqueue_depth\x18\x01 \x01(\x04R\n" +
+	"queueDepth\x12%\n" +
+	"\x0equeue_capacity\x18\x02 \x01(\x04R\rqueueCapacity\x12 \n" +
+	"\vsubscribers\x18\x03 \x01(\rR\vsubscribers\x120\n" +
+	"\x06groups\x18\x04 \x03(\v2\x18.telemetry.v1.GroupStatsR\x06groups\x12\x18\n" +
+	"\aunacked\x18\x05 \x01(\x04R\aunacked\x12%\n" +
+	"\x0eaccepted_total\x18\x06 \x01(\x04R\racceptedTotal\x12%\n" +
+	"\x0erejected_total\x18\a \x01(\x04R\rrejectedTotal\x12-\n" +
+	"\x12backpressure_total\x18\b \x01(\x04R\x11backpressureTotal\x12'\n" +
+	"\x0fdelivered_total\x18\t \x01(\x04R\x0edeliveredTotal\x12\x1f\n" +
+	"\vaccept_rate\x18\n" +
+	" \x01(\x01R\n" +
+	"acceptRate\x12\x1f\n" +
+	"\vreject_rate\x18\v \x01(\x01R\n" +
+	"rejectRate\x12!\n" +
+	"\fdeliver_rate\x18\f \x01(\x01R\vdeliverRate\x12%\n" +
+	"\x0ewindow_seconds\x18\r \x01(\x01R\rwindowSeconds2\xd9\x03\n" +
+	"\tTelemetry\x12K\n" +
+	"\fPublishBatch\x12\x1c.telemetry.v1.TelemetryBatch\x1a\x1d.telemetry.v1.PublishResponse\x12M\n" +
+	"\tSubscribe\x12!.telemetry.v1.SubscriptionRequest\x1a\x1b.telemetry.v1.TelemetryData0\x01\x12:\n" +
+	"\x03Ack\x12\x18.telemetry.v1.AckRequest\x1a\x19.telemetry.v1.AckResponse\x12U\n" +
+	"\fRegisterGPUs\x12!.telemetry.v1.RegisterGPUsRequest\x1a\".telemetry.v1.RegisterGPUsResponse\x12R\n" +
+	"\vListGPUInfo\x12 .telemetry.v1.ListGPUInfoRequest\x1a!.telemetry.v1.ListGPUInfoResponse\x12I\n" +
+	"\bGetStats\x12\x1d.telemetry.v1.GetStatsRequest\x1a\x1e.telemetry.v1.GetStatsResponseB*Z(gpu-metric-collector/api/gen;telemetryv1b\x06proto3"
+
+var (
+	file_telemetry_proto_rawDescOnce sync.Once
+	file_telemetry_proto_rawDescData []byte
+)
+
+func file_telemetry_proto_rawDescGZIP() []byte {
+	file_telemetry_proto_rawDescOnce.Do(func() {
+		file_telemetry_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_telemetry_proto_rawDesc), len(file_telemetry_proto_rawDesc)))
+	})
+	return file_telemetry_proto_rawDescData
+}
+
+var file_telemetry_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
+var file_telemetry_proto_goTypes = []any{
+	(*TelemetryData)(nil),         // 0: telemetry.v1.TelemetryData
+	(*MetricValue)(nil),           // 1: telemetry.v1.MetricValue
+	(*TelemetryBatch)(nil),        // 2: telemetry.v1.TelemetryBatch
+	(*PublishResponse)(nil),       // 3: telemetry.v1.PublishResponse
+	(*ItemStatus)(nil),            // 4: telemetry.v1.ItemStatus
+	(*SubscriptionRequest)(nil),   // 5: telemetry.v1.SubscriptionRequest
+	(*AckRequest)(nil),            // 6: telemetry.v1.AckRequest
+	(*AckResponse)(nil),           // 7: telemetry.v1.AckResponse
+	(*GpuInfo)(nil),               // 8: telemetry.v1.GpuInfo
+	(*RegisterGPUsRequest)(nil),   // 9: telemetry.v1.RegisterGPUsRequest
+	(*RegisterGPUsResponse)(nil),  // 10: telemetry.v1.RegisterGPUsResponse
+	(*ListGPUInfoRequest)(nil),    // 11: telemetry.v1.ListGPUInfoRequest
+	(*ListGPUInfoResponse)(nil),   // 12: telemetry.v1.ListGPUInfoResponse
+	(*GetStatsRequest)(nil),       // 13: telemetry.v1.GetStatsRequest
+	(*GroupStats)(nil),            // 14: telemetry.v1.GroupStats
+	(*GetStatsResponse)(nil),      // 15: telemetry.v1.GetStatsResponse
+	nil,                           // 16: telemetry.v1.TelemetryData.MetricsEntry
+	nil,                           // 17: telemetry.v1.TelemetryData.LabelsEntry
+	nil,                           // 18: telemetry.v1.TelemetryData.ValuesEntry
+	(*timestamppb.Timestamp)(nil), // 19: google.protobuf.Timestamp
+}
+var file_telemetry_proto_depIdxs = []int32{
+	19, // 0: telemetry.v1.TelemetryData.ts:type_name -> google.protobuf.Timestamp
+	16, // 1: telemetry.v1.TelemetryData.metrics:type_name -> telemetry.v1.TelemetryData.MetricsEntry
+	17, // 2: telemetry.v1.TelemetryData.labels:type_name -> telemetry.v1.TelemetryData.LabelsEntry
+	18, // 3: telemetry.v1.TelemetryData.values:type_name -> telemetry.v1.TelemetryData.ValuesEntry
+	0,  // 4: telemetry.v1.TelemetryBatch.items:type_name -> telemetry.v1.TelemetryData
+	4,  // 5: telemetry.v1.PublishResponse.items:type_name -> telemetry.v1.ItemStatus
+	19, // 6: telemetry.v1.GpuInfo.registered_at:type_name -> google.protobuf.Timestamp
+	8,  // 7: telemetry.v1.RegisterGPUsRequest.gpus:type_name -> telemetry.v1.GpuInfo
+	8,  // 8: telemetry.v1.ListGPUInfoResponse.gpus:type_name -> telemetry.v1.GpuInfo
+	14, // 9: telemetry.v1.GetStatsResponse.groups:type_name -> telemetry.v1.GroupStats
+	1,  // 10: telemetry.v1.TelemetryData.ValuesEntry.value:type_name -> telemetry.v1.MetricValue
+	2,  // 11: telemetry.v1.Telemetry.PublishBatch:input_type -> telemetry.v1.TelemetryBatch
+	5,  // 12: telemetry.v1.Telemetry.Subscribe:input_type -> telemetry.v1.SubscriptionRequest
+	6,  // 13: telemetry.v1.Telemetry.Ack:input_type -> telemetry.v1.AckRequest
+	9,  // 14: telemetry.v1.Telemetry.RegisterGPUs:input_type -> telemetry.v1.RegisterGPUsRequest
+	11, // 15: telemetry.v1.Telemetry.ListGPUInfo:input_type -> telemetry.v1.ListGPUInfoRequest
+	13, // 16: telemetry.v1.Telemetry.GetStats:input_type -> telemetry.v1.GetStatsRequest
+	3,  // 17: telemetry.v1.Telemetry.PublishBatch:output_type -> telemetry.v1.PublishResponse
+	0,  // 18: telemetry.v1.Telemetry.Subscribe:output_type -> telemetry.v1.TelemetryData
+	7,  // 19: telemetry.v1.Telemetry.Ack:output_type -> telemetry.v1.AckResponse
+	10, // 20: telemetry.v1.Telemetry.RegisterGPUs:output_type -> telemetry.v1.RegisterGPUsResponse
+	12, // 21: telemetry.v1.Telemetry.ListGPUInfo:output_type -> telemetry.v1.ListGPUInfoResponse
+	15, // 22: telemetry.v1.Telemetry.GetStats:output_type -> telemetry.v1.GetStatsResponse
+	17, // [17:23] is the sub-list for method output_type
+	11, // [11:17] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
+}
+
+func init() { file_telemetry_proto_init() }
+func file_telemetry_proto_init() {
+	if File_telemetry_proto != nil {
+		return
+	}
+	file_telemetry_proto_msgTypes[1].OneofWrappers = []any{
+		(*MetricValue_FloatValue)(nil),
+		(*MetricValue_IntValue)(nil),
+		(*MetricValue_BoolValue)(nil),
+		(*MetricValue_StringValue)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -320,7 +1363,7 @@ func file_telemetry_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_telemetry_proto_rawDesc), len(file_telemetry_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   19,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -21,6 +21,10 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	Telemetry_PublishBatch_FullMethodName = "/telemetry.v1.Telemetry/PublishBatch"
 	Telemetry_Subscribe_FullMethodName    = "/telemetry.v1.Telemetry/Subscribe"
+	Telemetry_Ack_FullMethodName          = "/telemetry.v1.Telemetry/Ack"
+	Telemetry_RegisterGPUs_FullMethodName = "/telemetry.v1.Telemetry/RegisterGPUs"
+	Telemetry_ListGPUInfo_FullMethodName  = "/telemetry.v1.Telemetry/ListGPUInfo"
+	Telemetry_GetStats_FullMethodName     = "/telemetry.v1.Telemetry/GetStats"
 )
 
 // TelemetryClient is the client API for Telemetry service.
@@ -31,6 +35,14 @@ type TelemetryClient interface {
 	PublishBatch(ctx context.Context, in *TelemetryBatch, opts ...grpc.CallOption) (*PublishResponse, error)
 	// Collectors receive a server-side stream of telemetry data (work-queue style)
 	Subscribe(ctx context.Context, in *SubscriptionRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TelemetryData], error)
+	// Collectors acknowledge messages from a manual_ack subscription once persisted
+	Ack(ctx context.Context, in *AckRequest, opts ...grpc.CallOption) (*AckResponse, error)
+	// Streamers announce their GPUs' static info, once at start or when it changes
+	RegisterGPUs(ctx context.Context, in *RegisterGPUsRequest, opts ...grpc.CallOption) (*RegisterGPUsResponse, error)
+	// Collectors read the registered GPU info to persist it
+	ListGPUInfo(ctx context.Context, in *ListGPUInfoRequest, opts ...grpc.CallOption) (*ListGPUInfoResponse, error)
+	// Automation (autoscalers, CLIs) reads queue depth, group lag and rates without scraping Prometheus
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error)
 }
 
 type telemetryClient struct {
@@ -70,6 +82,46 @@ func (c *telemetryClient) Subscribe(ctx context.Context, in *SubscriptionRequest
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type Telemetry_SubscribeClient = grpc.ServerStreamingClient[TelemetryData]
 
+func (c *telemetryClient) Ack(ctx context.Context, in *AckRequest, opts ...grpc.CallOption) (*AckResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AckResponse)
+	err := c.cc.Invoke(ctx, Telemetry_Ack_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telemetryClient) RegisterGPUs(ctx context.Context, in *RegisterGPUsRequest, opts ...grpc.CallOption) (*RegisterGPUsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisterGPUsResponse)
+	err := c.cc.Invoke(ctx, Telemetry_RegisterGPUs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telemetryClient) ListGPUInfo(ctx context.Context, in *ListGPUInfoRequest, opts ...grpc.CallOption) (*ListGPUInfoResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListGPUInfoResponse)
+	err := c.cc.Invoke(ctx, Telemetry_ListGPUInfo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telemetryClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetStatsResponse)
+	err := c.cc.Invoke(ctx, Telemetry_GetStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // TelemetryServer is the server API for Telemetry service.
 // All implementations must embed UnimplementedTelemetryServer
 // for forward compatibility.
@@ -78,6 +130,14 @@ type TelemetryServer interface {
 	PublishBatch(context.Context, *TelemetryBatch) (*PublishResponse, error)
 	// Collectors receive a server-side stream of telemetry data (work-queue style)
 	Subscribe(*SubscriptionRequest, grpc.ServerStreamingServer[TelemetryData]) error
+	// Collectors acknowledge messages from a manual_ack subscription once persisted
+	Ack(context.Context, *AckRequest) (*AckResponse, error)
+	// Streamers announce their GPUs' static info, once at start or when it changes
+	RegisterGPUs(context.Context, *RegisterGPUsRequest) (*RegisterGPUsResponse, error)
+	// Collectors read the registered GPU info to persist it
+	ListGPUInfo(context.Context, *ListGPUInfoRequest) (*ListGPUInfoResponse, error)
+	// Automation (autoscalers, CLIs) reads queue depth, group lag and rates without scraping Prometheus
+	GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error)
 	mustEmbedUnimplementedTelemetryServer()
 }
 
@@ -94,6 +154,18 @@ func (UnimplementedTelemetryServer) PublishBatch(context.Context, *TelemetryBatc
 func (UnimplementedTelemetryServer) Subscribe(*SubscriptionRequest, grpc.ServerStreamingServer[TelemetryData]) error {
 	return status.Error(codes.Unimplemented, "method Subscribe not implemented")
 }
+func (UnimplementedTelemetryServer) Ack(context.Context, *AckRequest) (*AckResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Ack not implemented")
+}
+func (UnimplementedTelemetryServer) RegisterGPUs(context.Context, *RegisterGPUsRequest) (*RegisterGPUsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method RegisterGPUs not implemented")
+}
+func (UnimplementedTelemetryServer) ListGPUInfo(context.Context, *ListGPUInfoRequest) (*ListGPUInfoResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListGPUInfo not implemented")
+}
+func (UnimplementedTelemetryServer) GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetStats not implemented")
+}
 func (UnimplementedTelemetryServer) mustEmbedUnimplementedTelemetryServer() {}
 func (UnimplementedTelemetryServer) testEmbeddedByValue()                   {}
 
@@ -144,6 +216,78 @@ func _Telemetry_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) err
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type Telemetry_SubscribeServer = grpc.ServerStreamingServer[TelemetryData]
 
+func _Telemetry_Ack_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelemetryServer).Ack(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telemetry_Ack_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelemetryServer).Ack(ctx, req.(*AckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Telemetry_RegisterGPUs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterGPUsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelemetryServer).RegisterGPUs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telemetry_RegisterGPUs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelemetryServer).RegisterGPUs(ctx, req.(*RegisterGPUsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Telemetry_ListGPUInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListGPUInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelemetryServer).ListGPUInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telemetry_ListGPUInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelemetryServer).ListGPUInfo(ctx, req.(*ListGPUInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Telemetry_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelemetryServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telemetry_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelemetryServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Telemetry_ServiceDesc is the grpc.ServiceDesc for Telemetry service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -155,6 +299,22 @@ var Telemetry_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "PublishBatch",
 			Handler:    _Telemetry_PublishBatch_Handler,
 		},
+		{
+			MethodName: "Ack",
+			Handler:    _Telemetry_Ack_Handler,
+		},
+		{
+			MethodName: "RegisterGPUs",
+			Handler:    _Telemetry_RegisterGPUs_Handler,
+		},
+		{
+			MethodName: "ListGPUInfo",
+			Handler:    _Telemetry_ListGPUInfo_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _Telemetry_GetStats_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -0,0 +1,294 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
+// source: v2/telemetry.proto
+
+// telemetry.v2 adds capability negotiation and a streaming publish next to
+// the telemetry.v1 service, which brokers keep serving unchanged: a client
+// that gets UNIMPLEMENTED from GetCapabilities talks v1 only.
+
+package telemetryv2
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	gen "gpu-metric-collector/api/gen"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Feature is an optional part of the protocol a peer may support. Peers
+// ignore values they do not know, so new features can be added freely.
+type Feature int32
+
+const (
+	Feature_FEATURE_UNSPECIFIED    Feature = 0
+	Feature_FEATURE_PUBLISH_STREAM Feature = 1 // telemetry.v2 PublishStream
+	Feature_FEATURE_MANUAL_ACK     Feature = 2 // SubscriptionRequest.manual_ack and Ack
+	Feature_FEATURE_LABELS         Feature = 3 // TelemetryData.labels are kept and delivered
+	Feature_FEATURE_ITEM_STATUS    Feature = 4 // PublishResponse.items
+	Feature_FEATURE_TYPED_VALUES   Feature = 5 // TelemetryData.values
+	Feature_FEATURE_SEQUENCE       Feature = 6 // TelemetryData.sequence gap detection
+	Feature_FEATURE_GPU_REGISTRY   Feature = 7 // RegisterGPUs and ListGPUInfo
+	Feature_FEATURE_STATS          Feature = 8 // GetStats
+)
+
+// Enum value maps for Feature.
+var (
+	Feature_name = map[int32]string{
+		0: "FEATURE_UNSPECIFIED",
+		1: "FEATURE_PUBLISH_STREAM",
+		2: "FEATURE_MANUAL_ACK",
+		3: "FEATURE_LABELS",
+		4: "FEATURE_ITEM_STATUS",
+		5: "FEATURE_TYPED_VALUES",
+		6: "FEATURE_SEQUENCE",
+		7: "FEATURE_GPU_REGISTRY",
+		8: "FEATURE_STATS",
+	}
+	Feature_value = map[string]int32{
+		"FEATURE_UNSPECIFIED":    0,
+		"FEATURE_PUBLISH_STREAM": 1,
+		"FEATURE_MANUAL_ACK":     2,
+		"FEATURE_LABELS":         3,
+		"FEATURE_ITEM_STATUS":    4,
+		"FEATURE_TYPED_VALUES":   5,
+		"FEATURE_SEQUENCE":       6,
+		"FEATURE_GPU_REGISTRY":   7,
+		"FEATURE_STATS":          8,
+	}
+)
+
+func (x Feature) Enum() *Feature {
+	p := new(Feature)
+	*p = x
+	return p
+}
+
+func (x Feature) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Feature) Descriptor() protoreflect.EnumDescriptor {
+	return file_v2_telemetry_proto_enumTypes[0].Descriptor()
+}
+
+func (Feature) Type() protoreflect.EnumType {
+	return &file_v2_telemetry_proto_enumTypes[0]
+}
+
+func (x Feature) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Feature.Descriptor instead.
+func (Feature) EnumDescriptor() ([]byte, []int) {
+	return file_v2_telemetry_proto_rawDescGZIP(), []int{0}
+}
+
+type GetCapabilitiesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Client        string                 `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`                                       // Client kind and version, e.g. "streamer/2", for the server's logs
+	Features      []Feature              `protobuf:"varint,2,rep,packed,name=features,proto3,enum=telemetry.v2.Feature" json:"features,omitempty"` // Features the client can use
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCapabilitiesRequest) Reset() {
+	*x = GetCapabilitiesRequest{}
+	mi := &file_v2_telemetry_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCapabilitiesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCapabilitiesRequest) ProtoMessage() {}
+
+func (x *GetCapabilitiesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_telemetry_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCapabilitiesRequest.ProtoReflect.Descriptor instead.
+func (*GetCapabilitiesRequest) Descriptor() ([]byte, []int) {
+	return file_v2_telemetry_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetCapabilitiesRequest) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
+func (x *GetCapabilitiesRequest) GetFeatures() []Feature {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+type Capabilities struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ApiVersions   []uint32               `protobuf:"varint,1,rep,packed,name=api_versions,json=apiVersions,proto3" json:"api_versions,omitempty"`  // Major versions of the telemetry package served, e.g. 1 and 2
+	Features      []Feature              `protobuf:"varint,2,rep,packed,name=features,proto3,enum=telemetry.v2.Feature" json:"features,omitempty"` // Features the server supports
+	Server        string                 `protobuf:"bytes,3,opt,name=server,proto3" json:"server,omitempty"`                                       // Server kind and version, e.g. "mq-broker/2"
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Capabilities) Reset() {
+	*x = Capabilities{}
+	mi := &file_v2_telemetry_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Capabilities) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Capabilities) ProtoMessage() {}
+
+func (x *Capabilities) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_telemetry_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Capabilities.ProtoReflect.Descriptor instead.
+func (*Capabilities) Descriptor() ([]byte, []int) {
+	return file_v2_telemetry_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Capabilities) GetApiVersions() []uint32 {
+	if x != nil {
+		return x.ApiVersions
+	}
+	return nil
+}
+
+func (x *Capabilities) GetFeatures() []Feature {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+func (x *Capabilities) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+var File_v2_telemetry_proto protoreflect.FileDescriptor
+
+const file_v2_telemetry_proto_rawDesc = "" +
+	"\n" +
+	"\x12v2/telemetry.proto\x12\ftelemetry.v2\x1a\x0ftelemetry.proto\"c\n" +
+	"\x16GetCapabilitiesRequest\x12\x16\n" +
+	"\x06client\x18\x01 \x01(\tR\x06client\x121\n" +
+	"\bfeatures\x18\x02 \x03(\x0e2\x15.telemetry.v2.FeatureR\bfeatures\"|\n" +
+	"\fCapabilities\x12!\n" +
+	"\fapi_versions\x18\x01 \x03(\rR\vapiVersions\x121\n" +
+	"\bfeatures\x18\x02 \x03(\x0e2\x15.telemetry.v2.FeatureR\bfeatures\x12\x16\n" +
+	"\x06server\x18\x03 \x01(\tR\x06server*\xe0\x01\n" +
+	"\aFeature\x12\x17\n" +
+	"\x13FEATURE_UNSPECIFIED\x10\x00\x12\x1a\n" +
+	"\x16FEATURE_PUBLISH_STREAM\x10\x01\x12\x16\n" +
+	"\x12FEATURE_MANUAL_ACK\x10\x02\x12\x12\n" +
+	"\x0eFEATURE_LABELS\x10\x03\x12\x17\n" +
+	"\x13FEATURE_ITEM_STATUS\x10\x04\x12\x18\n" +
+	"\x14FEATURE_TYPED_VALUES\x10\x05\x12\x14\n" +
+	"\x10FEATURE_SEQUENCE\x10\x06\x12\x18\n" +
+	"\x14FEATURE_GPU_REGISTRY\x10\a\x12\x11\n" +
+	"\rFEATURE_STATS\x10\b2\xb2\x01\n" +
+	"\tTelemetry\x12S\n" +
+	"\x0fGetCapabilities\x12$.telemetry.v2.GetCapabilitiesRequest\x1a\x1a.telemetry.v2.Capabilities\x12P\n" +
+	"\rPublishStream\x12\x1c.telemetry.v1.TelemetryBatch\x1a\x1d.telemetry.v1.PublishResponse(\x010\x01B-Z+gpu-metric-collector/api/gen/v2;telemetryv2b\x06proto3"
+
+var (
+	file_v2_telemetry_proto_rawDescOnce sync.Once
+	file_v2_telemetry_proto_rawDescData []byte
+)
+
+func file_v2_telemetry_proto_rawDescGZIP() []byte {
+	file_v2_telemetry_proto_rawDescOnce.Do(func() {
+		file_v2_telemetry_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_v2_telemetry_proto_rawDesc), len(file_v2_telemetry_proto_rawDesc)))
+	})
+	return file_v2_telemetry_proto_rawDescData
+}
+
+var file_v2_telemetry_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_v2_telemetry_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_v2_telemetry_proto_goTypes = []any{
+	(Feature)(0),                   // 0: telemetry.v2.Feature
+	(*GetCapabilitiesRequest)(nil), // 1: telemetry.v2.GetCapabilitiesRequest
+	(*Capabilities)(nil),           // 2: telemetry.v2.Capabilities
+	(*gen.TelemetryBatch)(nil),     // 3: telemetry.v1.TelemetryBatch
+	(*gen.PublishResponse)(nil),    // 4: telemetry.v1.PublishResponse
+}
+var file_v2_telemetry_proto_depIdxs = []int32{
+	0, // 0: telemetry.v2.GetCapabilitiesRequest.features:type_name -> telemetry.v2.Feature
+	0, // 1: telemetry.v2.Capabilities.features:type_name -> telemetry.v2.Feature
+	1, // 2: telemetry.v2.Telemetry.GetCapabilities:input_type -> telemetry.v2.GetCapabilitiesRequest
+	3, // 3: telemetry.v2.Telemetry.PublishStream:input_type -> telemetry.v1.TelemetryBatch
+	2, // 4: telemetry.v2.Telemetry.GetCapabilities:output_type -> telemetry.v2.Capabilities
+	4, // 5: telemetry.v2.Telemetry.PublishStream:output_type -> telemetry.v1.PublishResponse
+	4, // [4:6] is the sub-list for method output_type
+	2, // [2:4] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_v2_telemetry_proto_init() }
+func file_v2_telemetry_proto_init() {
+	if File_v2_telemetry_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_v2_telemetry_proto_rawDesc), len(file_v2_telemetry_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_v2_telemetry_proto_goTypes,
+		DependencyIndexes: file_v2_telemetry_proto_depIdxs,
+		EnumInfos:         file_v2_telemetry_proto_enumTypes,
+		MessageInfos:      file_v2_telemetry_proto_msgTypes,
+	}.Build()
+	File_v2_telemetry_proto = out.File
+	file_v2_telemetry_proto_goTypes = nil
+	file_v2_telemetry_proto_depIdxs = nil
+}
@@ -0,0 +1,11 @@
+// Package api holds the gateway's API definitions: the OpenAPI document
+// (embedded here), the protobuf sources and their generated code (gen).
+package api
+
+import _ "embed"
+
+// OpenAPI is api/openapi.json. Its operations and parameters are generated
+// from the gateway's route registry; run make openapi-gen after changing it.
+//
+//go:embed openapi.json
+var OpenAPI []byte
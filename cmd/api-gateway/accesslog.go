@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// accessEntry collects what the access log line needs from inner handlers:
+// the caller is only known once auth has run.
+type accessEntry struct {
+	caller string
+}
+
+type accessEntryKey struct{}
+
+// noteCaller records id as the caller of the request for its access log line.
+func noteCaller(ctx context.Context, id *identity) {
+	if e, ok := ctx.Value(accessEntryKey{}).(*accessEntry); ok {
+		e.caller = id.Method + ":" + id.Subject
+	}
+}
+
+// withAccessLog logs one line per request once it is answered:
+// method, path, status, bytes, duration, caller (API key name or JWT
+// subject, "-" when unauthenticated), remote address and request id.
+func withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		e := &accessEntry{caller: "-"}
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), accessEntryKey{}, e)))
+		remote, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remote = r.RemoteAddr
+		}
+		log.Printf("api: access method=%s path=%q status=%d bytes=%d duration_ms=%.1f caller=%s remote=%s request_id=%s",
+			r.Method, r.URL.Path, sw.status(), sw.bytes, float64(time.Since(start).Microseconds())/1000, e.caller, remote, requestIDFrom(r.Context()))
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestAccessLog_LinePerRequest(t *testing.T) {
+	// Scenario: an authenticated request with its own X-Request-ID and an
+	// unauthenticated one, through the gateway's middleware order
+	// Expect: one line each with method, path, status, caller and request id
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	mem := storage.NewMemoryStore()
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: time.Now().UTC(), Metrics: map[string]float64{"temp": 60}})
+	path := filepath.Join(t.TempDir(), "keys.json")
+	_ = os.WriteFile(path, []byte(`{"keys":[{"name":"grafana","key":"0123456789abcdef"}]}`), 0o600)
+	a, err := newAuthenticator(authConfig{APIKeysFile: path})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	h := withRequestID(withAccessLog(a.wrap(newServer(mem))))
+
+	if w := call(h, "/api/v1/gpus", "X-API-Key", "0123456789abcdef", "X-Request-ID", "trace-7"); w.Code != http.StatusOK {
+		t.Fatalf("gpus: %d", w.Code)
+	}
+	if w := call(h, "/api/v1/gpus"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated: %d", w.Code)
+	}
+
+	var lines []string
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.Contains(l, "api: access ") {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 access lines, got %q", buf.String())
+	}
+	for _, want := range []string{`method=GET`, `path="/api/v1/gpus"`, `status=200`, `caller=api_key:grafana`, `request_id=trace-7`, `bytes=10`} {
+		if !strings.Contains(lines[0], want) {
+			t.Fatalf("missing %s in %s", want, lines[0])
+		}
+	}
+	if !strings.Contains(lines[1], "status=401") || !strings.Contains(lines[1], "caller=- ") {
+		t.Fatalf("unauthenticated line: %s", lines[1])
+	}
+}
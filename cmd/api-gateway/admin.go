@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/storage"
+)
+
+// adminHandler serves DELETE /api/v1/admin/telemetry?before=...&gpu_id=...,
+// which deletes the telemetry of gpu_id (every GPU if absent) older than
+// before (all of it if absent), and POST /api/v1/admin/retention, which runs
+// a pass of the retention job now (nil when -retention is unset). Only
+// authenticated callers named in admins, and not limited to a tenant scope,
+// may use them.
+func adminHandler(store storage.Store, retention *retentionJob, admins map[string]bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := identityFrom(r.Context())
+		if id == nil {
+			writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "admin endpoints require authentication")
+			return
+		}
+		if !admins[id.Subject] || scopeFrom(r.Context()) != nil {
+			writeError(w, r, http.StatusForbidden, codeForbidden, "caller is not an admin")
+			return
+		}
+		if r.URL.Path == "/api/v1/admin/retention" {
+			serveRetention(w, r, retention, id.Subject)
+			return
+		}
+		if r.URL.Path != "/api/v1/admin/telemetry" {
+			notFound(w, r)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			methodNotAllowed(w, r)
+			return
+		}
+		v := r.URL.Query()
+		gpuID := strings.TrimSpace(pDeleteGPU.get(v))
+		var before time.Time
+		if s := pDeleteBefore.get(v); s != "" {
+			t, err := parseTime(s, time.Now().UTC())
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, codeInvalidTimeRange, "invalid before")
+				return
+			}
+			before = t
+		}
+		if gpuID == "" && before.IsZero() {
+			writeError(w, r, http.StatusBadRequest, codeInvalidParameter, "before or gpu_id required")
+			return
+		}
+		d, ok := storage.WithContext(r.Context(), store).(storage.Deleter)
+		if !ok {
+			writeError(w, r, http.StatusNotImplemented, codeNotImplemented, "the store cannot delete telemetry")
+			return
+		}
+		n, err := d.DeleteTelemetry(gpuID, before)
+		if err != nil {
+			writeStoreError(w, r, err, "delete telemetry error gpu=%s before=%v", gpuID, before)
+			return
+		}
+		log.Printf("api: admin sub=%s deleted telemetry gpu=%q before=%v count=%d", id.Subject, gpuID, before, n)
+		resp := map[string]any{}
+		if n >= 0 {
+			resp["deleted"] = n
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// serveRetention runs the retention job for an admin and returns what each
+// rule deleted.
+func serveRetention(w http.ResponseWriter, r *http.Request, job *retentionJob, caller string) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r)
+		return
+	}
+	if job == nil {
+		writeError(w, r, http.StatusNotImplemented, codeNotImplemented, "no retention rules (see the gateway's -retention flag)")
+		return
+	}
+	log.Printf("api: admin sub=%s ran retention", caller)
+	writeJSON(w, http.StatusOK, map[string]any{"results": job.Prune(r.Context(), time.Now())})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestAdmin_DeleteTelemetry(t *testing.T) {
+	// Scenario: an admin key and a reader key; gpu-1 has an old and a new
+	// point, gpu-2 one point
+	// Expect: 401 without credentials, 403 for the reader, 400 without
+	// before or gpu_id; the admin deletes gpu-1's old point, then all of gpu-2
+	path := filepath.Join(t.TempDir(), "keys.json")
+	_ = os.WriteFile(path, []byte(`{"keys":[{"name":"ops","key":"ops-key-0123456789"},{"name":"grafana","key":"graf-key-0123456789"}]}`), 0o600)
+	a, err := newAuthenticator(authConfig{APIKeysFile: path})
+	if err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	mem := storage.NewMemoryStore()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: t0, Metrics: map[string]float64{"temp": 50}})
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: t0.Add(time.Hour), Metrics: map[string]float64{"temp": 60}})
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", Timestamp: t0, Metrics: map[string]float64{"temp": 70}})
+	h := a.wrap(adminHandler(mem, nil, map[string]bool{"ops": true}))
+	del := func(path, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodDelete, path, nil)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := del("/api/v1/admin/telemetry?gpu_id=gpu-1", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous: %d", w.Code)
+	}
+	if w := del("/api/v1/admin/telemetry?gpu_id=gpu-1", "graf-key-0123456789"); w.Code != http.StatusForbidden {
+		t.Fatalf("reader: %d", w.Code)
+	}
+	for _, p := range []string{"/api/v1/admin/telemetry", "/api/v1/admin/telemetry?before=yesterday"} {
+		if w := del(p, "ops-key-0123456789"); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d", p, w.Code)
+		}
+	}
+	if w := del("/api/v1/admin/telemetry?gpu_id=gpu-1&before=2024-01-01T00:30:00Z", "ops-key-0123456789"); w.Code != http.StatusOK || w.Body.String() != "{\"deleted\":1}\n" {
+		t.Fatalf("delete old: %d %s", w.Code, w.Body.String())
+	}
+	if w := del("/api/v1/admin/telemetry?gpu_id=gpu-2", "ops-key-0123456789"); w.Body.String() != "{\"deleted\":1}\n" {
+		t.Fatalf("delete gpu-2: %d %s", w.Code, w.Body.String())
+	}
+	ids, _ := mem.ListGPUs()
+	left, _ := mem.QueryTelemetry("gpu-1", nil, nil)
+	if len(ids) != 1 || len(left) != 1 || left[0].Metrics["temp"] != 60 {
+		t.Fatalf("left: %v %v", ids, left)
+	}
+}
+
+func TestAdmin_Retention(t *testing.T) {
+	// Scenario: a rule keeping telemetry for 1h; one point from 2h ago and
+	// one from now; POST /api/v1/admin/retention by an admin
+	// Expect: the old point is deleted and reported; GET is 405, and a
+	// gateway without rules answers 501
+	path := filepath.Join(t.TempDir(), "keys.json")
+	_ = os.WriteFile(path, []byte(`{"keys":[{"name":"ops","key":"ops-key-0123456789"}]}`), 0o600)
+	a, err := newAuthenticator(authConfig{APIKeysFile: path})
+	if err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: now.Add(-2 * time.Hour), Metrics: map[string]float64{"temp": 50}})
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: now, Metrics: map[string]float64{"temp": 60}})
+	rules, err := parseRetention("telemetry=1h")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	job, err := newRetentionJob(rules, func(string) (storage.Store, error) { return mem, nil })
+	if err != nil {
+		t.Fatalf("job: %v", err)
+	}
+	do := func(job *retentionJob, method string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/v1/admin/retention", nil)
+		r.Header.Set("X-API-Key", "ops-key-0123456789")
+		w := httptest.NewRecorder()
+		a.wrap(adminHandler(mem, job, map[string]bool{"ops": true})).ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do(job, http.MethodGet); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET: %d", w.Code)
+	}
+	if w := do(nil, http.MethodPost); w.Code != http.StatusNotImplemented {
+		t.Fatalf("no rules: %d", w.Code)
+	}
+	w := do(job, http.MethodPost)
+	var resp struct{ Results []retentionResult }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || len(resp.Results) != 1 ||
+		resp.Results[0].Target != "telemetry" || resp.Results[0].Deleted == nil || *resp.Results[0].Deleted != 1 {
+		t.Fatalf("run: %d %s", w.Code, w.Body.String())
+	}
+	if left, _ := mem.QueryTelemetry("gpu-1", nil, nil); len(left) != 1 || left[0].Metrics["temp"] != 60 {
+		t.Fatalf("left: %v", left)
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	// Scenario: valid rule lists, with metric rules, and malformed ones
+	// Expect: targets with their ages (and metrics) in order; errors for a
+	// missing target or age, a bad duration, a target or metric set twice,
+	// an empty metric and a metric rule outliving its target's
+	got, err := parseRetention(" telemetry=30d, telemetry_rollup_5m=1w,recent=2h, telemetry:sm_clock|mem_clock=7d ")
+	want := []retentionRule{{"telemetry", 30 * 24 * time.Hour, nil}, {"telemetry_rollup_5m", 7 * 24 * time.Hour, nil}, {"recent", 2 * time.Hour, nil},
+		{"telemetry", 7 * 24 * time.Hour, []string{"sm_clock", "mem_clock"}}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v %v", got, err)
+	}
+	for _, s := range []string{"telemetry", "=1h", "telemetry=forever", "telemetry=-1h", "a=1h,a=2h",
+		"a:x=1h,a:y|x=2h", "a:x|=1h", "a=1d,a:x=1d"} {
+		if _, err := parseRetention(s); err == nil {
+			t.Fatalf("%q: no error", s)
+		}
+	}
+}
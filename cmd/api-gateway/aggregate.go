@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/storage"
+)
+
+// Defaults and bounds of /api/v1/gpus/{id}/aggregate.
+const (
+	defaultAggregateWindow = time.Hour
+	defaultAggregateStep   = time.Minute
+	maxAggregateBuckets    = 10000
+)
+
+// gpuAggregate is the /api/v1/gpus/{id}/aggregate response.
+type gpuAggregate struct {
+	GPUId       string           `json:"gpu_id"`
+	Metric      string           `json:"metric"`
+	Agg         string           `json:"agg"`
+	StepSeconds float64          `json:"step_seconds"`
+	Start       time.Time        `json:"start"`
+	End         time.Time        `json:"end"`
+	Buckets     []storage.Bucket `json:"buckets"`
+}
+
+// parseAggregate reads the metric (required), agg, step and window, which
+// ends now, capped at maxAggregateBuckets buckets.
+func parseAggregate(v url.Values, now time.Time) (storage.AggregateQuery, error) {
+	q := storage.AggregateQuery{Metric: strings.TrimSpace(pAggregateMetric.get(v)), Agg: storage.AggAvg, Step: defaultAggregateStep, End: &now}
+	if q.Metric == "" {
+		return q, errors.New("metric required")
+	}
+	if s := pAggregateAgg.get(v); s != "" {
+		if !storage.ValidAgg(s) {
+			return q, errors.New("invalid agg (want avg, max, min or last)")
+		}
+		q.Agg = s
+	}
+	if s := pAggregateStep.get(v); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < minStep {
+			return q, errors.New("invalid step (want a duration of at least 1s, e.g. 5m)")
+		}
+		q.Step = d
+	}
+	window := defaultAggregateWindow
+	if s := pAggregateWindow.get(v); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < minStep {
+			return q, errors.New("invalid window (want a duration of at least 1s, e.g. 1h)")
+		}
+		window = d
+	}
+	if n := window/q.Step + 1; n > maxAggregateBuckets {
+		return q, fmt.Errorf("too many buckets (%d, max %d); use a larger step", n, maxAggregateBuckets)
+	}
+	start := now.Add(-window)
+	q.Start = &start
+	return q, nil
+}
+
+// serveAggregate answers GET /api/v1/gpus/{id}/aggregate, aggregated by the
+// store where it can.
+func serveAggregate(w http.ResponseWriter, r *http.Request, store storage.Store, gpuID string) {
+	q, err := parseAggregate(r.URL.Query(), time.Now().UTC())
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	buckets, err := storage.Aggregate(store, gpuID, q)
+	if err != nil {
+		writeStoreError(w, r, err, "aggregate error gpu=%s metric=%s", gpuID, q.Metric)
+		return
+	}
+	if len(buckets) == 0 {
+		writeError(w, r, http.StatusNotFound, codeGPUNotFound, fmt.Sprintf("no data for %s of gpu %s in the window", q.Metric, gpuID))
+		return
+	}
+	writeJSON(w, http.StatusOK, gpuAggregate{GPUId: gpuID, Metric: q.Metric, Agg: q.Agg, StepSeconds: q.Step.Seconds(), Start: *q.Start, End: *q.End, Buckets: buckets})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestAggregate_PerBucket(t *testing.T) {
+	// Scenario: gpu-1 reports temp once a minute over the last 30 minutes,
+	// rising by one each minute
+	// Expect: max per 10m bucket is each bucket's newest value; the defaults
+	// (avg per minute over 1h) give a bucket per point; 400 without metric,
+	// for a bad agg or too many buckets; 404 for a metric without data
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	for i := 0; i < 30; i++ {
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: now.Add(-time.Duration(i+1) * time.Minute),
+			Metrics: map[string]float64{"temp": float64(100 - i)}})
+	}
+	h := newServer(mem)
+
+	get := func(path string) gpuAggregate {
+		t.Helper()
+		w := call(h, path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, w.Code, w.Body.String())
+		}
+		var a gpuAggregate
+		if err := json.Unmarshal(w.Body.Bytes(), &a); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return a
+	}
+	a := get("/api/v1/gpus/gpu-1/aggregate?metric=temp&agg=max&step=10m")
+	if a.Agg != storage.AggMax || a.StepSeconds != 600 || len(a.Buckets) < 3 || len(a.Buckets) > 4 || a.Buckets[len(a.Buckets)-1].Value != 100 {
+		t.Fatalf("max per 10m: %+v", a)
+	}
+	for i, b := range a.Buckets {
+		if !b.Timestamp.Equal(storage.BucketStart(b.Timestamp, 10*time.Minute)) || (i > 0 && !b.Timestamp.After(a.Buckets[i-1].Timestamp)) {
+			t.Fatalf("buckets not aligned and ordered: %+v", a.Buckets)
+		}
+	}
+	if a := get("/api/v1/gpus/gpu-1/aggregate?metric=temp"); a.Agg != storage.AggAvg || len(a.Buckets) != 30 || a.End.Sub(a.Start) != time.Hour {
+		t.Fatalf("defaults: %+v", a)
+	}
+	for _, q := range []string{"", "?metric=temp&agg=p99", "?metric=temp&step=1s&window=24h", "?metric=temp&step=0s"} {
+		if w := call(h, "/api/v1/gpus/gpu-1/aggregate"+q); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d", q, w.Code)
+		}
+	}
+	if w := call(h, "/api/v1/gpus/gpu-1/aggregate?metric=power"); w.Code != http.StatusNotFound {
+		t.Fatalf("no data: %d", w.Code)
+	}
+}
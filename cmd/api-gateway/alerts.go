@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/alert"
+)
+
+// maxRuleBody bounds a posted alert rule.
+const maxRuleBody = 64 << 10
+
+// alertsHandler serves the alert rules CRUD API and the active alerts:
+//
+//	POST   /api/v1/alerts/rules       create a rule
+//	GET    /api/v1/alerts/rules       list rules
+//	GET    /api/v1/alerts/rules/{id}  one rule
+//	DELETE /api/v1/alerts/rules/{id}  delete a rule
+//	GET    /api/v1/alerts/firing      firing alerts (?state=pending|all)
+//
+// A tenant's rules are owned by it and evaluated within its scope; tenants
+// only see their own rules and alerts.
+func alertsHandler(eng *alert.Engine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		owner := tenantFrom(r.Context())
+		visible := func(ruleOwner string) bool { return owner == "" || ruleOwner == owner }
+		rest := strings.TrimPrefix(r.URL.Path, "/api/v1/alerts/")
+
+		switch {
+		case rest == "rules":
+			switch r.Method {
+			case http.MethodGet:
+				rules := []alert.Rule{}
+				for _, rule := range eng.Rules() {
+					if visible(rule.Owner) {
+						rules = append(rules, rule)
+					}
+				}
+				writeJSON(w, http.StatusOK, rules)
+			case http.MethodPost:
+				var rule alert.Rule
+				dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRuleBody))
+				dec.DisallowUnknownFields()
+				if err := dec.Decode(&rule); err != nil {
+					writeError(w, r, http.StatusBadRequest, codeInvalidRule, "invalid rule: "+err.Error())
+					return
+				}
+				rule.ID, rule.Owner, rule.CreatedAt = "", owner, time.Time{}
+				created, err := eng.Add(rule)
+				if err != nil {
+					var bad *alert.RuleError
+					if errors.As(err, &bad) {
+						writeError(w, r, http.StatusBadRequest, codeInvalidRule, err.Error())
+						return
+					}
+					writeStoreError(w, r, err, "save alert rule error")
+					return
+				}
+				w.Header().Set("Location", "/api/v1/alerts/rules/"+created.ID)
+				writeJSON(w, http.StatusCreated, created)
+			default:
+				methodNotAllowed(w, r)
+			}
+
+		case strings.HasPrefix(rest, "rules/") && !strings.Contains(rest[len("rules/"):], "/"):
+			id := rest[len("rules/"):]
+			rule, ok := eng.Rule(id)
+			if !ok || !visible(rule.Owner) {
+				writeError(w, r, http.StatusNotFound, codeRuleNotFound, "no alert rule "+id)
+				return
+			}
+			switch r.Method {
+			case http.MethodGet:
+				writeJSON(w, http.StatusOK, rule)
+			case http.MethodDelete:
+				if _, err := eng.Delete(id); err != nil {
+					writeStoreError(w, r, err, "delete alert rule %s error", id)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				methodNotAllowed(w, r)
+			}
+
+		case rest == "firing":
+			if r.Method != http.MethodGet {
+				methodNotAllowed(w, r)
+				return
+			}
+			state := pAlertState.get(r.URL.Query())
+			switch state {
+			case "":
+				state = alert.StateFiring
+			case alert.StateFiring, alert.StatePending, "all":
+			default:
+				writeError(w, r, http.StatusBadRequest, codeInvalidParameter, "state must be firing, pending or all")
+				return
+			}
+			alerts := []alert.Alert{}
+			for _, a := range eng.Alerts() {
+				if visible(a.Owner) && (state == "all" || a.State == state) {
+					alerts = append(alerts, a)
+				}
+			}
+			writeJSON(w, http.StatusOK, alerts)
+
+		default:
+			notFound(w, r)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/alert"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestAlerts_RulesCRUDAndFiring(t *testing.T) {
+	// Scenario: tenant "ml" (host h1) and operators ("ops", all) each create a
+	// temp > 80 rule while both GPUs run hot, then the engine evaluates
+	// Expect: ml's rule fires for gpu-1 only and ml sees only its own rule and
+	// alert; ops sees everything; bad rules get 400; deleting removes the rule
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "keys.json")
+	_ = os.WriteFile(keys, []byte(`{"keys":[{"name":"ml-grafana","key":"ml-key-0123456789"},{"name":"sre","key":"sre-key-0123456789"}]}`), 0o600)
+	tfile := filepath.Join(dir, "tenants.json")
+	_ = os.WriteFile(tfile, []byte(`{"tenants":[{"name":"ml","subjects":["ml-grafana"],"hosts":["h1"]},{"name":"ops","subjects":["sre"],"all":true}]}`), 0o600)
+	a, err := newAuthenticator(authConfig{APIKeysFile: keys})
+	if err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	tn, err := loadTenants(tfile, "")
+	if err != nil {
+		t.Fatalf("tenants: %v", err)
+	}
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: now, Metrics: map[string]float64{"temp": 90}})
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", HostId: "h2", Timestamp: now, Metrics: map[string]float64{"temp": 95}})
+	eng, err := alert.NewEngine(mem, mem, tn.scopeFor)
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	h := a.wrap(tn.wrap(alertsHandler(eng)))
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, body := range []string{`{"name":"x","expr":"temp +","op":">"}`, `{"name":"x","expr":"temp","op":"~"}`, `{"name":"x","expr":"temp","op":">","for":"soon"}`, `{"nope":1}`} {
+		if w := do(http.MethodPost, "/api/v1/alerts/rules", "ml-key-0123456789", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d %s", body, w.Code, w.Body.String())
+		}
+	}
+	var mlRule alert.Rule
+	w := do(http.MethodPost, "/api/v1/alerts/rules", "ml-key-0123456789", `{"name":"hot","expr":"temp","op":">","threshold":80,"owner":"ops"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &mlRule); w.Code != http.StatusCreated || err != nil || mlRule.ID == "" || mlRule.Owner != "ml" {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/v1/alerts/rules", "sre-key-0123456789", `{"name":"fleet hot","expr":"temp","op":">","threshold":80}`); w.Code != http.StatusCreated {
+		t.Fatalf("create ops: %d %s", w.Code, w.Body.String())
+	}
+	eng.Evaluate(now)
+
+	var rules []alert.Rule
+	_ = json.Unmarshal(do(http.MethodGet, "/api/v1/alerts/rules", "ml-key-0123456789", "").Body.Bytes(), &rules)
+	if len(rules) != 1 || rules[0].ID != mlRule.ID {
+		t.Fatalf("ml rules: %+v", rules)
+	}
+	var alerts []alert.Alert
+	_ = json.Unmarshal(do(http.MethodGet, "/api/v1/alerts/firing", "ml-key-0123456789", "").Body.Bytes(), &alerts)
+	if len(alerts) != 1 || alerts[0].Labels["gpu_id"] != "gpu-1" || alerts[0].Value != 90 {
+		t.Fatalf("ml firing: %+v", alerts)
+	}
+	alerts = nil
+	_ = json.Unmarshal(do(http.MethodGet, "/api/v1/alerts/firing", "sre-key-0123456789", "").Body.Bytes(), &alerts)
+	if len(alerts) != 3 {
+		t.Fatalf("ops firing: %+v", alerts)
+	}
+	if w := do(http.MethodGet, "/api/v1/alerts/firing?state=pending", "sre-key-0123456789", ""); w.Body.String() != "[]\n" {
+		t.Fatalf("ops pending: %s", w.Body.String())
+	}
+
+	if w := do(http.MethodGet, "/api/v1/alerts/rules/"+rules[0].ID, "ml-key-0123456789", ""); w.Code != http.StatusOK {
+		t.Fatalf("get: %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/api/v1/alerts/rules/"+rules[0].ID, "ml-key-0123456789", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/api/v1/alerts/rules/"+rules[0].ID, "sre-key-0123456789", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("get deleted: %d", w.Code)
+	}
+	if stored, _ := mem.ListRules(); len(stored) != 1 {
+		t.Fatalf("stored rules: %v", stored)
+	}
+}
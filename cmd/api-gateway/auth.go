@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// authConfig selects the accepted credentials; with neither API keys nor a
+// JWKS URL the API is left open.
+type authConfig struct {
+	// APIKeysFile is a JSON file {"keys":[{"name":"grafana","key":"..."}]}.
+	APIKeysFile string
+	// JWKSURL enables bearer JWTs signed by one of the keys it serves.
+	JWKSURL     string
+	JWKSRefresh time.Duration
+	Issuer      string // required iss, if set
+	Audience    string // required aud, if set
+	// Audit logs the caller of every authenticated request.
+	Audit bool
+}
+
+// identity is the authenticated caller. Handlers read it with identityFrom.
+type identity struct {
+	Subject string        // API key name or JWT sub
+	Method  string        // "api_key" or "jwt"
+	Claims  jwt.MapClaims // nil for API keys
+}
+
+type identityKey struct{}
+
+func withIdentity(ctx context.Context, id *identity) context.Context {
+	noteCaller(ctx, id)
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// identityFrom returns the caller of an authenticated request, or nil when
+// auth is disabled.
+func identityFrom(ctx context.Context) *identity {
+	id, _ := ctx.Value(identityKey{}).(*identity)
+	return id
+}
+
+// authenticator checks API keys (X-API-Key or Authorization: Bearer) and
+// bearer JWTs on the /api/v1 and /graphql routes.
+type authenticator struct {
+	keys     map[[sha256.Size]byte]string // sha256(key) -> name
+	jwks     *jwksCache
+	parser   *jwt.Parser
+	audit    bool
+	disabled bool
+}
+
+// protectedPath reports whether path carries data; health and docs stay open.
+func protectedPath(path string) bool {
+	return strings.HasPrefix(path, "/api/v1/") || path == "/graphql"
+}
+
+func newAuthenticator(cfg authConfig) (*authenticator, error) {
+	a := &authenticator{audit: cfg.Audit}
+	if cfg.APIKeysFile != "" {
+		keys, err := loadAPIKeys(cfg.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = keys
+	}
+	if cfg.JWKSURL != "" {
+		refresh := cfg.JWKSRefresh
+		if refresh <= 0 {
+			refresh = time.Hour
+		}
+		a.jwks = &jwksCache{url: cfg.JWKSURL, refresh: refresh, client: &http.Client{Timeout: 10 * time.Second}}
+		opts := []jwt.ParserOption{
+			jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+			jwt.WithExpirationRequired(),
+			jwt.WithLeeway(30 * time.Second),
+		}
+		if cfg.Issuer != "" {
+			opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+		}
+		if cfg.Audience != "" {
+			opts = append(opts, jwt.WithAudience(cfg.Audience))
+		}
+		a.parser = jwt.NewParser(opts...)
+	}
+	a.disabled = a.keys == nil && a.jwks == nil
+	return a, nil
+}
+
+func loadAPIKeys(path string) (map[[sha256.Size]byte]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read api keys: %w", err)
+	}
+	var f struct {
+		Keys []struct {
+			Name string `json:"name"`
+			Key  string `json:"key"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("parse api keys %s: %w", path, err)
+	}
+	keys := make(map[[sha256.Size]byte]string, len(f.Keys))
+	for i, k := range f.Keys {
+		if k.Name == "" || len(k.Key) < 16 {
+			return nil, fmt.Errorf("api keys %s: entry %d needs a name and a key of at least 16 characters", path, i)
+		}
+		keys[sha256.Sum256([]byte(k.Key))] = k.Name
+	}
+	return keys, nil
+}
+
+var errNoCredentials = errors.New("missing credentials")
+
+// authenticate returns the caller of r. Bearer tokens shaped like a JWT are
+// verified as one when JWKS is configured; other tokens are API keys.
+func (a *authenticator) authenticate(r *http.Request) (*identity, error) {
+	token := r.Header.Get("X-API-Key")
+	if token == "" {
+		if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+			token = strings.TrimSpace(h[7:])
+		}
+	}
+	if token == "" {
+		return nil, errNoCredentials
+	}
+	if a.jwks != nil && strings.Count(token, ".") == 2 {
+		claims := jwt.MapClaims{}
+		if _, err := a.parser.ParseWithClaims(token, claims, a.jwks.keyfunc); err != nil {
+			return nil, err
+		}
+		sub, _ := claims.GetSubject()
+		if sub == "" {
+			return nil, errors.New("token has no sub claim")
+		}
+		return &identity{Subject: sub, Method: "jwt", Claims: claims}, nil
+	}
+	if name, ok := a.keys[sha256.Sum256([]byte(token))]; ok {
+		return &identity{Subject: name, Method: "api_key"}, nil
+	}
+	return nil, errors.New("invalid credentials")
+}
+
+func (a *authenticator) wrap(next http.Handler) http.Handler {
+	if a.disabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !protectedPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, err := a.authenticate(r)
+		if err != nil {
+			if err != errNoCredentials {
+				log.Printf("api: auth rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gpu-telemetry"`)
+			writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "missing or invalid credentials")
+			return
+		}
+		if a.audit {
+			log.Printf("api: audit sub=%s auth=%s %s %s", id.Subject, id.Method, r.Method, r.URL.RequestURI())
+		}
+		next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), id)))
+	})
+}
+
+// jwksMinRefetch limits refetches triggered by unknown key IDs, so forged
+// kids cannot hammer the identity provider.
+const jwksMinRefetch = time.Minute
+
+// jwksCache holds the verification keys served at url by kid, refetched
+// every refresh or, at most once per jwksMinRefetch, on an unknown kid. A
+// failed fetch keeps the previous keys. Fetches run without holding mu, one
+// at a time: a request whose key is cached uses it meanwhile, and only
+// requests that need the new keys wait for the fetch.
+type jwksCache struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu       sync.Mutex
+	keys     map[string]any
+	fetched  time.Time
+	fetching chan struct{} // closed when the running fetch ends; nil if none
+}
+
+func (c *jwksCache) keyfunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	age := time.Since(c.fetched)
+	if _, ok := c.keys[kid]; age > c.refresh || (!ok && age > jwksMinRefetch) {
+		done := c.refetch()
+		if !ok {
+			c.mu.Unlock()
+			<-done
+			c.mu.Lock()
+		}
+	}
+	if k, ok := c.keys[kid]; ok {
+		return k, nil
+	}
+	if kid == "" && len(c.keys) == 1 {
+		for _, k := range c.keys {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// refetch starts a fetch unless one is running and returns a channel closed
+// once it has ended and its keys are swapped in. c.mu must be held.
+func (c *jwksCache) refetch() <-chan struct{} {
+	if c.fetching != nil {
+		return c.fetching
+	}
+	done := make(chan struct{})
+	c.fetching = done
+	go func() {
+		keys, err := c.fetch()
+		c.mu.Lock()
+		if err != nil {
+			log.Printf("api: jwks fetch %s: %v", c.url, err)
+		} else {
+			c.keys = keys
+		}
+		c.fetched = time.Now()
+		c.fetching = nil
+		c.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (c *jwksCache) fetch() (map[string]any, error) {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := map[string]any{}
+	for _, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			log.Printf("api: jwks %s: skipping key %q: %v", c.url, k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	dec := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err1 := dec(k.N)
+		e, err2 := dec(k.E)
+		if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		x, err1 := dec(k.X)
+		y, err2 := dec(k.Y)
+		if !ok || err1 != nil || err2 != nil {
+			return nil, errors.New("invalid EC key")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if _, err := pub.ECDH(); err != nil { // rejects points off the curve
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+		return pub, nil
+	case "OKP":
+		x, err := dec(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid OKP key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported kty %q", k.Kty)
+}
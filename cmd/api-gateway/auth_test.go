@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// whoami echoes the caller identity so tests can check what handlers see.
+var whoami = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	id := identityFrom(r.Context())
+	if id == nil {
+		_, _ = w.Write([]byte("anonymous"))
+		return
+	}
+	_, _ = w.Write([]byte(id.Method + ":" + id.Subject))
+})
+
+func call(h http.Handler, path string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuth_APIKeys(t *testing.T) {
+	// Scenario: one configured key; requests with it, a wrong key, none, and to an open path
+	// Expect: the key's name as identity, 401 otherwise, open paths unaffected
+	path := filepath.Join(t.TempDir(), "keys.json")
+	_ = os.WriteFile(path, []byte(`{"keys":[{"name":"grafana","key":"0123456789abcdef"}]}`), 0o600)
+	a, err := newAuthenticator(authConfig{APIKeysFile: path})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	h := a.wrap(whoami)
+	if w := call(h, "/api/v1/gpus", "X-API-Key", "0123456789abcdef"); w.Body.String() != "api_key:grafana" {
+		t.Fatalf("header key: %d %s", w.Code, w.Body.String())
+	}
+	if w := call(h, "/graphql", "Authorization", "Bearer 0123456789abcdef"); w.Body.String() != "api_key:grafana" {
+		t.Fatalf("bearer key: %d %s", w.Code, w.Body.String())
+	}
+	for _, hdr := range [][]string{nil, {"X-API-Key", "wrong-key-wrong-key"}} {
+		w := call(h, "/api/v1/gpus", hdr...)
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("%v: expected 401 with challenge, got %d", hdr, w.Code)
+		}
+	}
+	if w := call(h, "/healthz"); w.Body.String() != "anonymous" {
+		t.Fatalf("open path: %d %s", w.Code, w.Body.String())
+	}
+
+	_ = os.WriteFile(path, []byte(`{"keys":[{"name":"short","key":"abc"}]}`), 0o600)
+	if _, err := newAuthenticator(authConfig{APIKeysFile: path}); err == nil {
+		t.Fatal("expected error for a short key")
+	}
+}
+
+func TestAuth_JWTFromJWKS(t *testing.T) {
+	// Scenario: JWKS server with one RSA key; tokens signed by it, by another key, expired, wrong audience
+	// Expect: only the valid token authenticates, with its sub as identity
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "k1", "kty": "RSA", "use": "sig",
+			"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+
+	a, err := newAuthenticator(authConfig{JWKSURL: jwks.URL, Issuer: "idp", Audience: "gpu-api"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	h := a.wrap(whoami)
+	sign := func(k *rsa.PrivateKey, claims jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = "k1"
+		s, err := tok.SignedString(k)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	valid := jwt.MapClaims{"sub": "alice", "iss": "idp", "aud": "gpu-api", "exp": exp}
+	if w := call(h, "/api/v1/gpus", "Authorization", "Bearer "+sign(key, valid)); w.Body.String() != "jwt:alice" {
+		t.Fatalf("valid token: %d %s", w.Code, w.Body.String())
+	}
+	for name, tok := range map[string]string{
+		"other key": sign(other, valid),
+		"expired":   sign(key, jwt.MapClaims{"sub": "alice", "iss": "idp", "aud": "gpu-api", "exp": time.Now().Add(-time.Hour).Unix()}),
+		"audience":  sign(key, jwt.MapClaims{"sub": "alice", "iss": "idp", "aud": "other", "exp": exp}),
+		"no exp":    sign(key, jwt.MapClaims{"sub": "alice", "iss": "idp", "aud": "gpu-api"}),
+	} {
+		if w := call(h, "/api/v1/gpus", "Authorization", "Bearer "+tok); w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected 401, got %d", name, w.Code)
+		}
+	}
+}
+
+func TestJWKSCache_FetchDoesNotBlockCachedKeys(t *testing.T) {
+	// Scenario: keys k1 cached and due for refresh; the identity provider
+	// hangs on the refetch, which adds k2
+	// Expect: k1 still resolves during the fetch; k2 waits for it and then resolves
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := func(kid string) map[string]string {
+		return map[string]string{"kid": kid, "kty": "RSA", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())}
+	}
+	gate := make(chan struct{})
+	var calls atomic.Int32
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := []map[string]string{jwk("k1")}
+		if calls.Add(1) > 1 {
+			<-gate
+			keys = append(keys, jwk("k2"))
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	defer jwks.Close()
+	defer close(gate)
+
+	c := &jwksCache{url: jwks.URL, refresh: 20 * time.Millisecond, client: jwks.Client()}
+	kid := func(k string) *jwt.Token { return &jwt.Token{Header: map[string]any{"kid": k}} }
+	if _, err := c.keyfunc(kid("k1")); err != nil {
+		t.Fatalf("first fetch: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	k2 := make(chan error, 1)
+	go func() {
+		_, err := c.keyfunc(kid("k2"))
+		k2 <- err
+	}()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := c.keyfunc(kid("k1")); err != nil {
+			t.Fatalf("cached key during the fetch: %v", err)
+		}
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Fatalf("cached key waited %s for the fetch", d)
+	}
+	select {
+	case err := <-k2:
+		t.Fatalf("k2 resolved before the fetch ended: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	gate <- struct{}{}
+	select {
+	case err := <-k2:
+		if err != nil {
+			t.Fatalf("k2 after the fetch: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("k2 still waiting after the fetch")
+	}
+}
+
+func TestAuth_DisabledWithoutConfig(t *testing.T) {
+	a, err := newAuthenticator(authConfig{})
+	if err != nil || !a.disabled {
+		t.Fatalf("expected disabled authenticator: %v", err)
+	}
+	if w := call(a.wrap(whoami), "/api/v1/gpus"); w.Body.String() != "anonymous" {
+		t.Fatalf("unexpected: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTenants_ScopeQueries(t *testing.T) {
+	// Scenario: keys for tenant "ml" (host h1), tenant "ops" (all) and a key without tenant
+	// Expect: ml sees only gpu-1 in lists, fleet queries and GraphQL; ops sees both; the stray key gets 403
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "keys.json")
+	_ = os.WriteFile(keys, []byte(`{"keys":[{"name":"ml-grafana","key":"ml-key-0123456789"},{"name":"sre","key":"sre-key-0123456789"},{"name":"stray","key":"stray-key-0123456789"}]}`), 0o600)
+	tfile := filepath.Join(dir, "tenants.json")
+	_ = os.WriteFile(tfile, []byte(`{"tenants":[{"name":"ml","subjects":["ml-grafana"],"hosts":["h1"]},{"name":"ops","subjects":["sre"],"all":true}]}`), 0o600)
+	a, err := newAuthenticator(authConfig{APIKeysFile: keys})
+	if err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	tn, err := loadTenants(tfile, "")
+	if err != nil {
+		t.Fatalf("tenants: %v", err)
+	}
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: now, Metrics: map[string]float64{"temp": 1}})
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", HostId: "h2", Timestamp: now, Metrics: map[string]float64{"temp": 2}})
+	h := a.wrap(tn.wrap(newServer(mem)))
+
+	if w := call(h, "/api/v1/gpus", "X-API-Key", "ml-key-0123456789"); w.Body.String() != "[\"gpu-1\"]\n" {
+		t.Fatalf("ml gpus: %s", w.Body.String())
+	}
+	if w := call(h, "/api/v1/gpus", "X-API-Key", "sre-key-0123456789"); w.Body.String() != "[\"gpu-1\",\"gpu-2\"]\n" {
+		t.Fatalf("ops gpus: %s", w.Body.String())
+	}
+	var items []model.Telemetry
+	w := call(h, "/api/v1/telemetry?gpu_ids=gpu-1,gpu-2", "X-API-Key", "ml-key-0123456789")
+	if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil || len(items) != 1 || items[0].GPUId != "gpu-1" {
+		t.Fatalf("ml fleet: %s", w.Body.String())
+	}
+	if w := call(h, "/api/v1/gpus/gpu-2/latest", "X-API-Key", "ml-key-0123456789"); w.Code != http.StatusNotFound {
+		t.Fatalf("ml latest of foreign gpu: %d %s", w.Code, w.Body.String())
+	}
+	r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query":"{ gpus { id } }"}`))
+	r.Header.Set("X-API-Key", "ml-key-0123456789")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if !strings.Contains(rec.Body.String(), `"gpus":[{"id":"gpu-1"}]`) {
+		t.Fatalf("ml graphql: %s", rec.Body.String())
+	}
+	if w := call(h, "/api/v1/gpus", "X-API-Key", "stray-key-0123456789"); w.Code != http.StatusForbidden {
+		t.Fatalf("stray: expected 403, got %d", w.Code)
+	}
+
+	_ = os.WriteFile(tfile, []byte(`{"tenants":[{"name":"a","subjects":["x"]},{"name":"b","subjects":["x"]}]}`), 0o600)
+	if _, err := loadTenants(tfile, ""); err == nil {
+		t.Fatal("expected error for a subject in two tenants")
+	}
+}
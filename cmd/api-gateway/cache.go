@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/cache"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "gateway", Name: "cache_lookups_total", Help: "Result cache lookups by operation and result (hit or miss).",
+	}, []string{"op", "result"})
+	metricCacheErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "gateway", Name: "cache_errors_total", Help: "Result cache reads and writes that failed; the store was used instead.",
+	})
+	metricCacheBypassed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "gateway", Name: "cache_bypassed_requests_total", Help: "Requests that asked to skip the result cache.",
+	})
+	metricLatestErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "gateway", Name: "latest_index_errors_total", Help: "Failed reads and writes of the -latest_redis_url index; reads used the store instead.",
+	})
+)
+
+// cachedStore answers GPU listings, rankings and downsampled queries from a
+// TTL cache, so repeated dashboard refreshes do not each reach the store.
+// Raw queries, latest points and writes go straight to the store.
+type cachedStore struct {
+	base  storage.Store
+	cache cache.Cache
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+func newCachedStore(base storage.Store, c cache.Cache, ttl time.Duration) *cachedStore {
+	return &cachedStore{base: base, cache: c, ttl: ttl, now: time.Now}
+}
+
+// cachedLoad returns the cached value of key, or loads, caches and returns it.
+// Cache failures are counted and fall back to load.
+func cachedLoad[T any](s *cachedStore, op, key string, load func() (T, error)) (T, error) {
+	key = op + ":" + key
+	if b, ok, err := s.cache.Get(key); err != nil {
+		metricCacheErrors.Inc()
+		log.Printf("api: cache get %s: %v", op, err)
+	} else if ok {
+		var v T
+		if err := json.Unmarshal(b, &v); err == nil {
+			metricCacheLookups.WithLabelValues(op, "hit").Inc()
+			return v, nil
+		}
+	}
+	metricCacheLookups.WithLabelValues(op, "miss").Inc()
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+	if b, err := json.Marshal(v); err == nil {
+		if err := s.cache.Set(key, b, s.ttl); err != nil {
+			metricCacheErrors.Inc()
+			log.Printf("api: cache set %s: %v", op, err)
+		}
+	}
+	return v, nil
+}
+
+// cacheKey encodes the parts of a query as a key. A window that ends now
+// (no end) starts at a time that moves with every request, so its start is
+// rounded down to the TTL; the result is then at most one TTL behind, as any
+// cached result is.
+func (s *cachedStore) cacheKey(start, end *time.Time, rest any) string {
+	var k struct {
+		Start, End *time.Time
+		Rest       any
+	}
+	k.Start, k.End, k.Rest = start, end, rest
+	if start != nil && end == nil {
+		t := start.Truncate(s.ttl)
+		k.Start = &t
+	}
+	b, _ := json.Marshal(k)
+	return string(b)
+}
+
+func (s *cachedStore) WithContext(ctx context.Context) storage.Store {
+	return &cachedStore{base: storage.WithContext(ctx, s.base), cache: s.cache, ttl: s.ttl, now: s.now}
+}
+
+func (s *cachedStore) SaveTelemetry(t model.Telemetry) error { return s.base.SaveTelemetry(t) }
+
+func (s *cachedStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	return s.base.SaveTelemetryBatch(items)
+}
+
+func (s *cachedStore) ListGPUs() ([]string, error) {
+	return cachedLoad(s, "list_gpus", "", s.base.ListGPUs)
+}
+
+// ListGPUsIn keeps tenant listings apart by keying on the scope.
+func (s *cachedStore) ListGPUsIn(sc storage.Scope) ([]string, error) {
+	key, _ := json.Marshal(sc)
+	return cachedLoad(s, "list_gpus", string(key), func() ([]string, error) {
+		return storage.Scoped(s.base, sc).ListGPUs()
+	})
+}
+
+func (s *cachedStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
+	return s.base.QueryTelemetry(gpuID, start, end)
+}
+
+func (s *cachedStore) QueryTelemetryWith(gpuID string, q storage.Query) ([]model.Telemetry, error) {
+	if q.Step <= 0 {
+		return storage.Execute(s.base, gpuID, q)
+	}
+	rest := struct {
+		GPU string
+		Q   storage.Query
+	}{gpuID, q}
+	rest.Q.Start, rest.Q.End = nil, nil
+	return cachedLoad(s, "query", s.cacheKey(q.Start, q.End, rest), func() ([]model.Telemetry, error) {
+		return storage.Execute(s.base, gpuID, q)
+	})
+}
+
+func (s *cachedStore) QueryFleet(gpuIDs []string, q storage.Query) ([]model.Telemetry, error) {
+	if q.Step <= 0 {
+		return storage.ExecuteFleet(s.base, gpuIDs, q)
+	}
+	rest := struct {
+		GPUs []string
+		Q    storage.Query
+	}{gpuIDs, q}
+	rest.Q.Start, rest.Q.End = nil, nil
+	return cachedLoad(s, "fleet_query", s.cacheKey(q.Start, q.End, rest), func() ([]model.Telemetry, error) {
+		return storage.ExecuteFleet(s.base, gpuIDs, q)
+	})
+}
+
+func (s *cachedStore) LatestTelemetry(gpuID string) (*model.Telemetry, error) {
+	return storage.Latest(s.base, gpuID)
+}
+
+func (s *cachedStore) QueryLatest(gpuIDs []string, sc *storage.Scope) (map[string]*model.Telemetry, error) {
+	return storage.LatestMany(s.base, gpuIDs, sc)
+}
+
+func (s *cachedStore) TopGPUs(q storage.TopQuery) ([]storage.GPUValue, error) {
+	rest := q
+	rest.Start, rest.End = nil, nil
+	return cachedLoad(s, "top", s.cacheKey(q.Start, q.End, rest), func() ([]storage.GPUValue, error) {
+		return storage.Top(s.base, q)
+	})
+}
+
+func (s *cachedStore) AggregateTelemetry(gpuID string, q storage.AggregateQuery) ([]storage.Bucket, error) {
+	rest := struct {
+		GPU string
+		Q   storage.AggregateQuery
+	}{gpuID, q}
+	rest.Q.Start, rest.Q.End = nil, nil
+	return cachedLoad(s, "aggregate", s.cacheKey(q.Start, q.End, rest), func() ([]storage.Bucket, error) {
+		return storage.Aggregate(s.base, gpuID, q)
+	})
+}
+
+func (s *cachedStore) SummarizeTelemetry(gpuID string, q storage.Query) (map[string]storage.MetricSummary, error) {
+	rest := struct {
+		GPU string
+		Q   storage.Query
+	}{gpuID, q}
+	rest.Q.Start, rest.Q.End = nil, nil
+	return cachedLoad(s, "summary", s.cacheKey(q.Start, q.End, rest), func() (map[string]storage.MetricSummary, error) {
+		return storage.Summarize(s.base, gpuID, q)
+	})
+}
+
+func (s *cachedStore) ListMetrics(gpuIDs []string, q storage.Query) (map[string][]storage.MetricInfo, error) {
+	rest := struct {
+		GPUs []string
+		Q    storage.Query
+	}{gpuIDs, q}
+	rest.Q.Start, rest.Q.End = nil, nil
+	return cachedLoad(s, "metrics", s.cacheKey(q.Start, q.End, rest), func() (map[string][]storage.MetricInfo, error) {
+		return storage.ListMetrics(s.base, gpuIDs, q)
+	})
+}
+
+func (s *cachedStore) Ping(ctx context.Context) error {
+	if p, ok := s.base.(storage.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+type bypassCacheKey struct{}
+
+// withCacheBypass marks requests sending Cache-Control: no-cache or
+// X-Cache-Bypass: true so storeFor reads the store directly.
+func withCacheBypass(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bypass := strings.EqualFold(r.Header.Get("X-Cache-Bypass"), "true") || r.Header.Get("X-Cache-Bypass") == "1"
+		for _, d := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+			bypass = bypass || strings.EqualFold(strings.TrimSpace(d), "no-cache")
+		}
+		if bypass {
+			metricCacheBypassed.Inc()
+			r = r.WithContext(context.WithValue(r.Context(), bypassCacheKey{}, true))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// uncached returns the store under a cachedStore when the request asked to
+// bypass the cache.
+func uncached(ctx context.Context, store storage.Store) storage.Store {
+	if cs, ok := store.(*cachedStore); ok && ctx.Value(bypassCacheKey{}) != nil {
+		return cs.base
+	}
+	return store
+}
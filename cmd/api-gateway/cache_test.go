@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/cache"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// countingStore counts the reads that reach the store.
+type countingStore struct {
+	*storage.MemoryStore
+	lists, tops, queries, downsampled int
+}
+
+func (c *countingStore) ListGPUs() ([]string, error) {
+	c.lists++
+	return c.MemoryStore.ListGPUs()
+}
+
+func (c *countingStore) TopGPUs(q storage.TopQuery) ([]storage.GPUValue, error) {
+	c.tops++
+	q.Scope = nil
+	return storage.Top(c.MemoryStore, q)
+}
+
+func (c *countingStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
+	c.queries++
+	return c.MemoryStore.QueryTelemetry(gpuID, start, end)
+}
+
+func (c *countingStore) QueryTelemetryWith(gpuID string, q storage.Query) ([]model.Telemetry, error) {
+	c.downsampled++
+	return c.MemoryStore.QueryTelemetryWith(gpuID, q)
+}
+
+func TestCache_ServesRepeatsAndHonorsBypass(t *testing.T) {
+	// Scenario: a dashboard repeats the GPU list, a top-N and a downsampled query, then asks for a fresh list
+	// Expect: the store is read once per distinct query, raw queries are never cached, bypass reads the store
+	base := &countingStore{MemoryStore: storage.NewMemoryStore()}
+	now := time.Now().UTC()
+	_ = base.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: now.Add(-time.Minute), Metrics: map[string]float64{"temp": 60}})
+	srv := withCacheBypass(newServer(newCachedStore(base, cache.NewMemory(100), time.Minute)))
+	hits := testutil.ToFloat64(metricCacheLookups.WithLabelValues("list_gpus", "hit"))
+
+	for i := 0; i < 3; i++ {
+		for _, p := range []string{"/api/v1/gpus", "/api/v1/gpus/top?metric=temp", "/api/v1/gpus/gpu-1/telemetry?step=1m", "/api/v1/gpus/gpu-1/telemetry"} {
+			if w := call(srv, p); w.Code != http.StatusOK {
+				t.Fatalf("%s: %d %s", p, w.Code, w.Body.String())
+			}
+		}
+	}
+	if base.lists != 1 || base.tops != 1 || base.downsampled != 1 || base.queries != 3 {
+		t.Fatalf("store reads: lists=%d tops=%d downsampled=%d raw=%d", base.lists, base.tops, base.downsampled, base.queries)
+	}
+	if got := testutil.ToFloat64(metricCacheLookups.WithLabelValues("list_gpus", "hit")) - hits; got != 2 {
+		t.Fatalf("expected 2 list hits, got %v", got)
+	}
+
+	_ = base.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", Timestamp: now, Metrics: map[string]float64{"temp": 1}})
+	if w := call(srv, "/api/v1/gpus"); w.Body.String() != "[\"gpu-1\"]\n" {
+		t.Fatalf("cached list: %s", w.Body.String())
+	}
+	for _, hdr := range [][]string{{"Cache-Control", "no-cache"}, {"X-Cache-Bypass", "true"}} {
+		if w := call(srv, "/api/v1/gpus", hdr...); w.Body.String() != "[\"gpu-1\",\"gpu-2\"]\n" {
+			t.Fatalf("%v: %s", hdr, w.Body.String())
+		}
+	}
+	if base.lists != 3 {
+		t.Fatalf("expected bypassed lists to reach the store, got %d reads", base.lists)
+	}
+}
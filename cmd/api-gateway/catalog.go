@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"gpu-metric-collector/internal/metricspec"
+	"gpu-metric-collector/internal/storage"
+)
+
+// metricMeta describes a metric of the metricspec catalog; empty for others.
+type metricMeta struct {
+	Unit        string          `json:"unit,omitempty"`
+	Type        metricspec.Type `json:"type,omitempty"`
+	Description string          `json:"description,omitempty"`
+}
+
+func describeMetric(name string) metricMeta {
+	s, ok := metricspec.Lookup(name)
+	if !ok {
+		return metricMeta{}
+	}
+	return metricMeta{Unit: s.Unit, Type: s.Type, Description: s.Help}
+}
+
+// gpuMetric is one metric of the /api/v1/gpus/{id}/metrics response.
+type gpuMetric struct {
+	storage.MetricInfo
+	metricMeta
+}
+
+// gpuMetrics is the /api/v1/gpus/{id}/metrics response.
+type gpuMetrics struct {
+	GPUId   string      `json:"gpu_id"`
+	Metrics []gpuMetric `json:"metrics"`
+}
+
+// fleetMetric is one metric of the /api/v1/metrics response: how many GPUs
+// report it, with their samples and first and last seen combined.
+type fleetMetric struct {
+	Name      string    `json:"name"`
+	GPUs      int       `json:"gpus"`
+	Samples   int64     `json:"samples"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	metricMeta
+}
+
+// fleetMetrics is the /api/v1/metrics response.
+type fleetMetrics struct {
+	GPUs    int           `json:"gpus"`
+	Metrics []fleetMetric `json:"metrics"`
+}
+
+// parseMetricsQuery reads the window and filters of a metrics listing; the
+// whole history when there is no window. Buckets and paging do not apply.
+func parseMetricsQuery(v url.Values) (storage.Query, error) {
+	q, page, err := parseQuery(v)
+	if err != nil {
+		return q, err
+	}
+	if page != nil || q.Step > 0 {
+		return q, errors.New("metrics are listed for the whole window; step, limit, offset, cursor and order are not supported")
+	}
+	return q, nil
+}
+
+// serveGPUMetrics answers GET /api/v1/gpus/{id}/metrics.
+func serveGPUMetrics(w http.ResponseWriter, r *http.Request, store storage.Store, gpuID string) {
+	q, err := parseMetricsQuery(r.URL.Query())
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	byGPU, err := storage.ListMetrics(store, []string{gpuID}, q)
+	if err != nil {
+		writeStoreError(w, r, err, "list metrics error gpu=%s", gpuID)
+		return
+	}
+	if len(byGPU[gpuID]) == 0 {
+		writeError(w, r, http.StatusNotFound, codeGPUNotFound, "no telemetry for gpu "+gpuID)
+		return
+	}
+	out := gpuMetrics{GPUId: gpuID, Metrics: make([]gpuMetric, len(byGPU[gpuID]))}
+	for i, mi := range byGPU[gpuID] {
+		out.Metrics[i] = gpuMetric{MetricInfo: mi, metricMeta: describeMetric(mi.Name)}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// metricsHandler serves GET /api/v1/metrics: every metric of the fleet, or
+// of host_id's GPUs, with the number of GPUs reporting it.
+func metricsHandler(store storage.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		v := r.URL.Query()
+		q, err := parseMetricsQuery(v)
+		if err != nil {
+			writeBadRequest(w, r, err)
+			return
+		}
+		q.HostIDs = parseList(pHostIDs.get(v))
+		byGPU, err := storage.ListMetrics(storeFor(r.Context(), store), nil, q)
+		if err != nil {
+			writeStoreError(w, r, err, "list fleet metrics error")
+			return
+		}
+		writeJSON(w, http.StatusOK, combineMetrics(byGPU))
+	})
+}
+
+// combineMetrics sums the per-GPU listings into one entry per metric,
+// sorted by name, described from the metric catalog.
+func combineMetrics(byGPU map[string][]storage.MetricInfo) fleetMetrics {
+	out := fleetMetrics{GPUs: len(byGPU), Metrics: []fleetMetric{}}
+	idx := map[string]int{}
+	for _, list := range byGPU {
+		for _, mi := range list {
+			i, ok := idx[mi.Name]
+			if !ok {
+				idx[mi.Name] = len(out.Metrics)
+				out.Metrics = append(out.Metrics, fleetMetric{Name: mi.Name, FirstSeen: mi.FirstSeen, LastSeen: mi.LastSeen, metricMeta: describeMetric(mi.Name)})
+				i = len(out.Metrics) - 1
+			}
+			fm := &out.Metrics[i]
+			fm.GPUs++
+			fm.Samples += mi.Samples
+			if mi.FirstSeen.Before(fm.FirstSeen) {
+				fm.FirstSeen = mi.FirstSeen
+			}
+			if mi.LastSeen.After(fm.LastSeen) {
+				fm.LastSeen = mi.LastSeen
+			}
+		}
+	}
+	sort.Slice(out.Metrics, func(i, j int) bool { return out.Metrics[i].Name < out.Metrics[j].Name })
+	return out
+}
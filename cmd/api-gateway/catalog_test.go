@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestMetrics_ListPerGPUAndFleet(t *testing.T) {
+	// Scenario: gpu-1 on node-1 reports temp and util, gpu-2 on node-2
+	// reports temp, an hour apart
+	// Expect: each GPU's metrics with counts; the fleet listing counts the
+	// GPUs per metric, narrowed by host_id and by a window; 400 for a step;
+	// 404 for a GPU without data
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC().Truncate(time.Second)
+	_ = mem.SaveTelemetryBatch([]model.Telemetry{
+		{GPUId: "gpu-1", HostId: "node-1", Timestamp: now.Add(-2 * time.Hour), Metrics: map[string]float64{"temp": 40, "util": 10}},
+		{GPUId: "gpu-1", HostId: "node-1", Timestamp: now.Add(-time.Minute), Metrics: map[string]float64{"temp": 41}},
+		{GPUId: "gpu-2", HostId: "node-2", Timestamp: now.Add(-time.Hour), Metrics: map[string]float64{"temp": 50}},
+	})
+	h := newServer(mem)
+
+	w := call(h, "/api/v1/gpus/gpu-1/metrics")
+	var g gpuMetrics
+	if err := json.Unmarshal(w.Body.Bytes(), &g); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("gpu: %d %s", w.Code, w.Body.String())
+	}
+	if len(g.Metrics) != 2 || g.Metrics[0].Name != "temp" || g.Metrics[0].Samples != 2 || !g.Metrics[0].LastSeen.Equal(now.Add(-time.Minute)) || g.Metrics[1].Samples != 1 {
+		t.Fatalf("gpu: %+v", g)
+	}
+
+	fleet := func(path string) fleetMetrics {
+		t.Helper()
+		w := call(h, path)
+		var f fleetMetrics
+		if err := json.Unmarshal(w.Body.Bytes(), &f); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, w.Code, w.Body.String())
+		}
+		return f
+	}
+	if f := fleet("/api/v1/metrics"); f.GPUs != 2 || len(f.Metrics) != 2 || f.Metrics[0].Name != "temp" || f.Metrics[0].GPUs != 2 || f.Metrics[0].Samples != 3 || f.Metrics[1].GPUs != 1 {
+		t.Fatalf("fleet: %+v", f)
+	}
+	if f := fleet("/api/v1/metrics?host_id=node-2"); f.GPUs != 1 || len(f.Metrics) != 1 || f.Metrics[0].GPUs != 1 {
+		t.Fatalf("host: %+v", f)
+	}
+	if f := fleet("/api/v1/metrics?start_time=-90m"); f.GPUs != 2 || len(f.Metrics) != 1 || f.Metrics[0].Samples != 2 {
+		t.Fatalf("window: %+v", f)
+	}
+
+	if w := call(h, "/api/v1/metrics?step=1m"); w.Code != http.StatusBadRequest {
+		t.Fatalf("step: %d", w.Code)
+	}
+	if w := call(h, "/api/v1/gpus/gpu-3/metrics"); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown gpu: %d", w.Code)
+	}
+}
+
+func TestMetrics_DescribeCatalogMetrics(t *testing.T) {
+	// Scenario: a GPU reports a DCGM temperature, a lowercased DCGM
+	// utilization and a custom metric
+	// Expect: unit, type and description for the two catalog metrics in
+	// both listings, none for the custom one
+	mem := storage.NewMemoryStore()
+	_ = mem.SaveTelemetryBatch([]model.Telemetry{{GPUId: "gpu-1", Timestamp: time.Now(),
+		Metrics: map[string]float64{"DCGM_FI_DEV_GPU_TEMP": 61, "dcgm_fi_dev_gpu_util": 90, "fan": 40}}})
+	h := newServer(mem)
+
+	w := call(h, "/api/v1/gpus/gpu-1/metrics")
+	var g gpuMetrics
+	if err := json.Unmarshal(w.Body.Bytes(), &g); err != nil || len(g.Metrics) != 3 {
+		t.Fatalf("gpu: %d %s", w.Code, w.Body.String())
+	}
+	temp, util, fan := g.Metrics[0], g.Metrics[1], g.Metrics[2]
+	if temp.Unit != "C" || temp.Type != "gauge" || temp.Description == "" || util.Unit != "%" || fan.metricMeta != (metricMeta{}) {
+		t.Fatalf("gpu: %+v", g.Metrics)
+	}
+	w = call(h, "/api/v1/metrics")
+	var f fleetMetrics
+	if err := json.Unmarshal(w.Body.Bytes(), &f); err != nil || len(f.Metrics) != 3 || f.Metrics[0].Unit != "C" || f.Metrics[2].Unit != "" {
+		t.Fatalf("fleet: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/storage"
+)
+
+// Defaults and bounds for /api/v1/compare.
+const (
+	maxCompareGPUs       = 50
+	maxCompareBuckets    = 11000
+	defaultCompareWindow = time.Hour
+	defaultCompareStep   = time.Minute
+)
+
+// comparison is the /api/v1/compare response: one value per GPU and bucket,
+// null where a GPU has no point in the bucket.
+type comparison struct {
+	Metric      string          `json:"metric"`
+	StepSeconds float64         `json:"step_seconds"`
+	Timestamps  []time.Time     `json:"timestamps"`
+	Series      []compareSeries `json:"series"`
+}
+
+type compareSeries struct {
+	GPUId  string     `json:"gpu_id"`
+	Values []*float64 `json:"values"`
+}
+
+type compareQuery struct {
+	gpuIDs     []string
+	metric     string
+	start, end time.Time
+	step       time.Duration
+}
+
+// parseCompare reads gpu_ids and metric (required), window (ending now)
+// and step.
+func parseCompare(v url.Values, now time.Time) (compareQuery, error) {
+	q := compareQuery{gpuIDs: parseList(pCompareGPUs.get(v)), metric: strings.TrimSpace(pCompareMetric.get(v)), end: now, step: defaultCompareStep}
+	if len(q.gpuIDs) == 0 {
+		return q, errors.New("gpu_ids required")
+	}
+	if len(q.gpuIDs) > maxCompareGPUs {
+		return q, fmt.Errorf("too many gpu_ids (max %d)", maxCompareGPUs)
+	}
+	if q.metric == "" {
+		return q, errors.New("metric required")
+	}
+	window := defaultCompareWindow
+	if s := pCompareWindow.get(v); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < minStep {
+			return q, errors.New("invalid window (want a duration of at least 1s, e.g. 1h)")
+		}
+		window = d
+	}
+	if s := pCompareStep.get(v); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < minStep {
+			return q, errors.New("invalid step (want a duration of at least 1s, e.g. 1m)")
+		}
+		q.step = d
+	}
+	if window/q.step >= maxCompareBuckets {
+		return q, fmt.Errorf("window/step exceeds %d buckets", maxCompareBuckets)
+	}
+	q.start = now.Add(-window)
+	return q, nil
+}
+
+// compareHandler returns one metric of several GPUs downsampled to the same
+// buckets, so the series can be overlaid as they are.
+func compareHandler(store storage.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		cq, err := parseCompare(r.URL.Query(), time.Now().UTC())
+		if err != nil {
+			writeBadRequest(w, r, err)
+			return
+		}
+		q := storage.Query{Start: &cq.start, End: &cq.end, Step: cq.step, Metrics: []string{cq.metric}}
+		items, err := storage.ExecuteFleet(storeFor(r.Context(), store), cq.gpuIDs, q)
+		if err != nil {
+			writeStoreError(w, r, err, "compare error gpus=%v metric=%s", cq.gpuIDs, cq.metric)
+			return
+		}
+
+		first := storage.BucketStart(cq.start, cq.step)
+		n := int(storage.BucketStart(cq.end, cq.step).Sub(first)/cq.step) + 1
+		res := comparison{Metric: cq.metric, StepSeconds: cq.step.Seconds(), Timestamps: make([]time.Time, n), Series: make([]compareSeries, len(cq.gpuIDs))}
+		for i := range res.Timestamps {
+			res.Timestamps[i] = first.Add(time.Duration(i) * cq.step)
+		}
+		index := make(map[string]int, len(cq.gpuIDs))
+		for i, id := range cq.gpuIDs {
+			res.Series[i] = compareSeries{GPUId: id, Values: make([]*float64, n)}
+			index[id] = i
+		}
+		for _, it := range items {
+			v, ok := it.Metrics[cq.metric]
+			s, known := index[it.GPUId]
+			b := int(it.Timestamp.Sub(first) / cq.step)
+			if ok && known && b >= 0 && b < n {
+				res.Series[s].Values[b] = &v
+			}
+		}
+		writeJSON(w, http.StatusOK, res)
+	})
+}
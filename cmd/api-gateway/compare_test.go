@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestCompare_AlignsSeries(t *testing.T) {
+	// Scenario: gpu-a reports temp every minute of the last 3 minutes, gpu-b
+	// twice within one of them; compared over 5m in 1m steps, plus gpu-c
+	// without data
+	// Expect: shared bucket timestamps; gpu-a has its values, gpu-b the mean
+	// of its two points in one bucket and null elsewhere, gpu-c all nulls;
+	// 400 for missing metric or too many buckets
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	b0 := storage.BucketStart(now, time.Minute).Add(-2 * time.Minute)
+	for i := 0; i < 3; i++ {
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-a", Timestamp: b0.Add(time.Duration(i) * time.Minute), Metrics: map[string]float64{"temp": float64(50 + i)}})
+	}
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-b", Timestamp: b0.Add(time.Minute), Metrics: map[string]float64{"temp": 60}})
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-b", Timestamp: b0.Add(time.Minute + 30*time.Second), Metrics: map[string]float64{"temp": 70}})
+	h := newServer(mem)
+
+	w := call(h, "/api/v1/compare?gpu_ids=gpu-a,gpu-b,gpu-c&metric=temp&window=5m&step=1m")
+	if w.Code != http.StatusOK {
+		t.Fatalf("compare: %d %s", w.Code, w.Body.String())
+	}
+	var res comparison
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	n := len(res.Timestamps)
+	if n != 6 || res.StepSeconds != 60 || len(res.Series) != 3 || !res.Timestamps[n-1].Equal(storage.BucketStart(now, time.Minute)) {
+		t.Fatalf("shape: %d timestamps, %+v", n, res)
+	}
+	a, b, c := res.Series[0], res.Series[1], res.Series[2]
+	if a.GPUId != "gpu-a" || a.Values[n-3] == nil || *a.Values[n-3] != 50 || *a.Values[n-1] != 52 || a.Values[0] != nil {
+		t.Fatalf("gpu-a: %s", w.Body.String())
+	}
+	if *b.Values[n-2] != 65 || b.Values[n-1] != nil || b.Values[n-3] != nil {
+		t.Fatalf("gpu-b: %s", w.Body.String())
+	}
+	for _, v := range c.Values {
+		if v != nil {
+			t.Fatalf("gpu-c: %s", w.Body.String())
+		}
+	}
+
+	for _, path := range []string{"/api/v1/compare?gpu_ids=gpu-a", "/api/v1/compare?gpu_ids=gpu-a&metric=temp&window=24h&step=1s"} {
+		if w := call(h, path); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+// Derived metrics served by /api/v1/gpus/{id}/derived.
+const (
+	derivedEnergy      = "energy_wh"
+	derivedUtilPerWatt = "util_per_watt"
+)
+
+// defaultDerivedWindow is the look-back of a derived metric without window.
+const defaultDerivedWindow = 24 * time.Hour
+
+// maxEnergyGap is the longest interval between two power samples that is
+// integrated; a longer one means the GPU was not reporting, and guessing its
+// draw would make up energy.
+const maxEnergyGap = 5 * time.Minute
+
+// powerMetric (watts) and utilMetric (percent) are the stored metrics the
+// derived metrics are computed from.
+var (
+	powerMetric = "DCGM_FI_DEV_POWER_USAGE"
+	utilMetric  = "DCGM_FI_DEV_GPU_UTIL"
+)
+
+// derivedValue is the /api/v1/gpus/{id}/derived response.
+type derivedValue struct {
+	GPUId   string    `json:"gpu_id"`
+	Metric  string    `json:"metric"`
+	Value   float64   `json:"value"`
+	Unit    string    `json:"unit"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Samples int       `json:"samples"`
+}
+
+// parseDerived reads the derived metric and its window, which ends now.
+func parseDerived(v url.Values, now time.Time) (string, time.Time, error) {
+	metric := pDerivedMetric.get(v)
+	if metric != derivedEnergy && metric != derivedUtilPerWatt {
+		return "", time.Time{}, fmt.Errorf("invalid metric (want %s or %s)", derivedEnergy, derivedUtilPerWatt)
+	}
+	window := defaultDerivedWindow
+	if s := pDerivedWindow.get(v); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < minStep {
+			return "", time.Time{}, errors.New("invalid window (want a duration of at least 1s, e.g. 24h)")
+		}
+		window = d
+	}
+	return metric, now.Add(-window), nil
+}
+
+// serveDerived answers GET /api/v1/gpus/{id}/derived from the GPU's raw
+// power (and utilization) points over the window.
+func serveDerived(w http.ResponseWriter, r *http.Request, store storage.Store, gpuID string) {
+	end := time.Now().UTC()
+	metric, start, err := parseDerived(r.URL.Query(), end)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	q := storage.Query{Start: &start, End: &end, Metrics: []string{powerMetric}}
+	if metric == derivedUtilPerWatt {
+		q.Metrics = append(q.Metrics, utilMetric)
+	}
+	items, err := storage.Execute(store, gpuID, q)
+	if err != nil {
+		writeStoreError(w, r, err, "derived %s error gpu=%s", metric, gpuID)
+		return
+	}
+	out := derivedValue{GPUId: gpuID, Metric: metric, Start: start, End: end}
+	if metric == derivedEnergy {
+		out.Value, out.Samples = energyWh(items)
+		out.Unit = "Wh"
+	} else {
+		out.Value, out.Samples = utilPerWatt(items)
+		out.Unit = "%/W"
+	}
+	if out.Samples == 0 {
+		writeError(w, r, http.StatusNotFound, codeGPUNotFound, fmt.Sprintf("no data for %s of gpu %s in the window", metric, gpuID))
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// energyWh integrates power over time-ordered points with the trapezoidal
+// rule, skipping gaps longer than maxEnergyGap. It returns watt-hours and
+// the number of power samples.
+func energyWh(items []model.Telemetry) (float64, int) {
+	var (
+		joules float64
+		n      int
+		prev   model.Telemetry
+	)
+	for _, it := range items {
+		p, ok := it.Metrics[powerMetric]
+		if !ok {
+			continue
+		}
+		if n > 0 {
+			if dt := it.Timestamp.Sub(prev.Timestamp); dt <= maxEnergyGap {
+				joules += (p + prev.Metrics[powerMetric]) / 2 * dt.Seconds()
+			}
+		}
+		prev = it
+		n++
+	}
+	return joules / 3600, n
+}
+
+// utilPerWatt is the mean utilization over the mean power draw of the points
+// that have both; points drawing no power still count towards the means.
+// It returns the ratio and the number of points used.
+func utilPerWatt(items []model.Telemetry) (float64, int) {
+	var util, power float64
+	n := 0
+	for _, it := range items {
+		p, okP := it.Metrics[powerMetric]
+		u, okU := it.Metrics[utilMetric]
+		if okP && okU {
+			util += u
+			power += p
+			n++
+		}
+	}
+	if power == 0 {
+		return 0, n
+	}
+	return util / power, n
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestDerived_EnergyAndUtilPerWatt(t *testing.T) {
+	// Scenario: gpu-1 draws 100W at 50% util for 30 minutes, stops reporting
+	// for 10 minutes and draws 300W at 90% util for another 30 minutes
+	// Expect: 50+150 Wh (the gap is not integrated), util_per_watt of
+	// (50+90)/2 over (100+300)/2; a 45m window only sees the last half hour;
+	// 400 without a known metric; 404 for a GPU without power data
+	mem := storage.NewMemoryStore()
+	start := time.Now().UTC().Add(-80 * time.Minute).Truncate(time.Minute)
+	for i := 0; i <= 30; i++ {
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: start.Add(time.Duration(i) * time.Minute),
+			Metrics: map[string]float64{powerMetric: 100, utilMetric: 50}})
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: start.Add(time.Duration(40+i) * time.Minute),
+			Metrics: map[string]float64{powerMetric: 300, utilMetric: 90}})
+	}
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", Timestamp: start, Metrics: map[string]float64{"temp": 60}})
+	h := newServer(mem)
+
+	get := func(path string) derivedValue {
+		t.Helper()
+		w := call(h, path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, w.Code, w.Body.String())
+		}
+		var v derivedValue
+		if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return v
+	}
+	if v := get("/api/v1/gpus/gpu-1/derived?metric=energy_wh"); math.Abs(v.Value-200) > 1e-9 || v.Unit != "Wh" || v.Samples != 62 {
+		t.Fatalf("energy: %+v", v)
+	}
+	if v := get("/api/v1/gpus/gpu-1/derived?metric=energy_wh&window=45m"); math.Abs(v.Value-150) > 1e-9 || v.Samples != 31 {
+		t.Fatalf("energy over 45m: %+v", v)
+	}
+	if v := get("/api/v1/gpus/gpu-1/derived?metric=util_per_watt"); math.Abs(v.Value-0.35) > 1e-9 || v.Unit != "%/W" {
+		t.Fatalf("util_per_watt: %+v", v)
+	}
+	if w := call(h, "/api/v1/gpus/gpu-1/derived?metric=joules"); w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown metric: %d", w.Code)
+	}
+	if w := call(h, "/api/v1/gpus/gpu-2/derived?metric=energy_wh"); w.Code != http.StatusNotFound {
+		t.Fatalf("no power data: %d", w.Code)
+	}
+}
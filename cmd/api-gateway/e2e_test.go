@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/e2e"
+	"gpu-metric-collector/internal/model"
+)
+
+func TestE2E_GatewayServesPublishedTelemetry(t *testing.T) {
+	// Scenario: points published to a real broker and stored by a collector are read back through the gateway
+	// Expect: /api/v1/gpus lists the GPUs and a GPU's telemetry window returns its points with their metrics
+	h := e2e.Start(t, e2e.Options{Gateway: newServer})
+	src := e2e.Source{
+		Producer: "streamer-e2e",
+		Host:     "node-1",
+		GPUs:     []string{"0", "1"},
+		Metrics:  []string{"DCGM_FI_DEV_GPU_TEMP"},
+		Start:    time.Now().Add(-time.Hour).Truncate(time.Second),
+		Interval: time.Second,
+	}
+	points := src.Points(10)
+	h.Publish(points, 5)
+	h.AssertDelivered(points, 5*time.Second)
+
+	var gpus []string
+	h.GetJSON("/api/v1/gpus", &gpus)
+	if fmt.Sprint(gpus) != "[0 1]" {
+		t.Fatalf("gpus = %v, want [0 1]", gpus)
+	}
+	var got []model.Telemetry
+	q := url.Values{"start_time": {src.Start.Format(time.RFC3339)}, "end_time": {src.Start.Add(time.Minute).Format(time.RFC3339)}}
+	h.GetJSON("/api/v1/gpus/1/telemetry?"+q.Encode(), &got)
+	if len(got) != 10 {
+		t.Fatalf("GPU 1 returned %d points, want 10", len(got))
+	}
+	if got[9].HostId != "node-1" || got[9].Metrics["DCGM_FI_DEV_GPU_TEMP"] != 9010 {
+		t.Fatalf("last point = %+v, want host node-1 and temperature 9010", got[9])
+	}
+}
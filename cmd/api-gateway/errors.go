@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Error codes of the JSON error envelope. Clients should branch on these
+// rather than on messages, which may change.
+const (
+	codeInvalidParameter   = "invalid_parameter"
+	codeInvalidTimeRange   = "invalid_time_range"
+	codeInvalidExpression  = "invalid_expression"
+	codeInvalidRule        = "invalid_rule"
+	codeInvalidWebhook     = "invalid_webhook"
+	codeInvalidBody        = "invalid_body"
+	codeQueryRejected      = "query_rejected"
+	codeNotFound           = "not_found"
+	codeGPUNotFound        = "gpu_not_found"
+	codeHostNotFound       = "host_not_found"
+	codeRuleNotFound       = "rule_not_found"
+	codeWebhookNotFound    = "webhook_not_found"
+	codeMethodNotAllowed   = "method_not_allowed"
+	codeUnauthorized       = "unauthorized"
+	codeForbidden          = "forbidden"
+	codeRateLimited        = "rate_limited"
+	codeBackpressure       = "backpressure"
+	codePartialWrite       = "partial_write"
+	codeStoreTimeout       = "store_timeout"
+	codeInternal           = "internal_error"
+	codeNotImplemented     = "not_implemented"
+	codeMetricNameConflict = "metric_name_conflict"
+)
+
+// apiError is the body of every error response:
+// {"code":"gpu_not_found","message":"...","details":{...},"request_id":"..."}.
+type apiError struct {
+	Code      string         `json:"code"`
+	Message   string         `json:"message"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+// writeError writes the error envelope with status.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeErrorDetails(w, r, status, code, message, nil)
+}
+
+// writeErrorDetails is writeError with details, e.g. the limit exceeded.
+func writeErrorDetails(w http.ResponseWriter, r *http.Request, status int, code, message string, details map[string]any) {
+	writeJSON(w, status, apiError{Code: code, Message: message, Details: details, RequestID: requestIDFrom(r.Context())})
+}
+
+// paramError is an invalid request parameter with a more specific code than
+// invalid_parameter.
+type paramError struct {
+	code string
+	msg  string
+}
+
+func (e *paramError) Error() string { return e.msg }
+
+func timeRangeError(msg string) error { return &paramError{code: codeInvalidTimeRange, msg: msg} }
+
+// writeBadRequest answers a parameter error with 400, using the paramError
+// code if err has one.
+func writeBadRequest(w http.ResponseWriter, r *http.Request, err error) {
+	code := codeInvalidParameter
+	var pe *paramError
+	if errors.As(err, &pe) {
+		code = pe.code
+	}
+	writeError(w, r, http.StatusBadRequest, code, err.Error())
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, codeNotFound, "no such endpoint: "+r.URL.Path)
+}
+
+type requestIDKey struct{}
+
+// maxRequestIDLen bounds a client-supplied X-Request-ID.
+const maxRequestIDLen = 128
+
+// withRequestID gives every request an id, taken from a well-formed
+// X-Request-ID header or generated, and echoes it in the response header.
+// Error bodies and store error logs carry it.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			var b [8]byte
+			_, _ = rand.Read(b[:])
+			id = hex.EncodeToString(b[:])
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDFrom returns the request's id, or "" outside withRequestID.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logRequestf logs a line about r tagged with its request id, so it can be
+// matched to the access log and the error body.
+func logRequestf(r *http.Request, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if id := requestIDFrom(r.Context()); id != "" {
+		msg += " request_id=" + id
+	}
+	log.Print("api: " + msg)
+}
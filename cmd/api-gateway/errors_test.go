@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestErrors_Envelope(t *testing.T) {
+	// Scenario: requests failing in different ways through withRequestID,
+	// one with its own X-Request-ID
+	// Expect: each gets the JSON envelope with the status's code and the
+	// request id in both the body and the X-Request-ID header
+	mem := storage.NewMemoryStore()
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: time.Now().UTC(), Metrics: map[string]float64{"temp": 60}})
+	h := withRequestID(newServer(mem))
+
+	cases := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/api/v1/gpus/gpu-9/latest", http.StatusNotFound, codeGPUNotFound},
+		{"/api/v1/hosts/h9/gpus", http.StatusNotFound, codeHostNotFound},
+		{"/api/v1/gpus/gpu-1/telemetry?start_time=2024-01-02T00:00:00Z&end_time=2024-01-01T00:00:00Z", http.StatusBadRequest, codeInvalidTimeRange},
+		{"/api/v1/gpus/gpu-1/telemetry?start_time=yesterday", http.StatusBadRequest, codeInvalidTimeRange},
+		{"/api/v1/gpus/gpu-1/telemetry?limit=0", http.StatusBadRequest, codeInvalidParameter},
+		{"/api/v1/query?expr=temp%7B", http.StatusBadRequest, codeInvalidExpression},
+		{"/api/v1/gpus/gpu-1/nope", http.StatusNotFound, codeNotFound},
+		{"/nope", http.StatusNotFound, codeNotFound},
+	}
+	for _, c := range cases {
+		w := call(h, c.path)
+		var e apiError
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || w.Code != c.status || e.Code != c.code || e.Message == "" {
+			t.Fatalf("%s: %d %s", c.path, w.Code, w.Body.String())
+		}
+		if e.RequestID == "" || e.RequestID != w.Header().Get("X-Request-ID") {
+			t.Fatalf("%s: request id %q, header %q", c.path, e.RequestID, w.Header().Get("X-Request-ID"))
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/gpus", nil)
+	r.Header.Set("X-Request-ID", "trace-42")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var e apiError
+	_ = json.Unmarshal(w.Body.Bytes(), &e)
+	if w.Code != http.StatusMethodNotAllowed || e.Code != codeMethodNotAllowed || e.RequestID != "trace-42" {
+		t.Fatalf("method: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestErrors_RateLimitDetails(t *testing.T) {
+	// Scenario: a client allowed one request makes two
+	// Expect: the second gets 429 rate_limited with retry_after_seconds
+	h := newRateLimiter(rateRule{Rate: 0.001, Burst: 1}, nil, "").wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	_ = call(h, "/api/v1/gpus")
+	w := call(h, "/api/v1/gpus")
+	var e apiError
+	_ = json.Unmarshal(w.Body.Bytes(), &e)
+	if w.Code != http.StatusTooManyRequests || e.Code != codeRateLimited || e.Details["retry_after_seconds"] == nil {
+		t.Fatalf("%d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/snappy"
+)
+
+const parquetContentType = "application/vnd.apache.parquet"
+
+// Export formats for /api/v1/gpus/{id}/telemetry/export.
+const (
+	exportCSV     = "csv"
+	exportParquet = "parquet"
+)
+
+// exportMetrics returns the metric names present in items, sorted; they become
+// one column each.
+func exportMetrics(items []model.Telemetry) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, it := range items {
+		for k := range it.Metrics {
+			if !seen[k] {
+				seen[k] = true
+				out = append(out, k)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// exportFilename makes a download name from a GPU id, which may contain
+// characters that are not safe in a header or a file system.
+func exportFilename(gpuID, format string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, gpuID)
+	return safe + "-telemetry." + format
+}
+
+// writeExport sends items as a downloadable file in format, one row per point
+// with a column per metric; a point without a metric leaves its cell empty.
+func writeExport(w http.ResponseWriter, r *http.Request, gpuID, format string, items []model.Telemetry) error {
+	metrics := exportMetrics(items)
+	for _, m := range metrics {
+		if m == "timestamp" || m == "gpu_id" || m == "host_id" {
+			writeError(w, r, http.StatusUnprocessableEntity, codeMetricNameConflict, fmt.Sprintf("metric %q clashes with a fixed column", m))
+			return fmt.Errorf("metric %q clashes with a fixed column", m)
+		}
+	}
+	switch format {
+	case exportCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	case exportParquet:
+		w.Header().Set("Content-Type", parquetContentType)
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportFilename(gpuID, format)))
+	w.WriteHeader(http.StatusOK)
+	if format == exportParquet {
+		return writeParquet(w, items, metrics)
+	}
+	return writeCSV(w, items, metrics)
+}
+
+// writeCSV writes a header row (timestamp, gpu_id, host_id, metrics...) and
+// then the points; timestamps are RFC 3339 in UTC.
+func writeCSV(w io.Writer, items []model.Telemetry, metrics []string) error {
+	cw := csv.NewWriter(bufio.NewWriterSize(w, streamBufSize))
+	row := append([]string{"timestamp", "gpu_id", "host_id"}, metrics...)
+	if err := cw.Write(row); err != nil {
+		return err
+	}
+	for _, it := range items {
+		row = append(row[:0], it.Timestamp.UTC().Format(time.RFC3339Nano), it.GPUId, it.HostId)
+		for _, m := range metrics {
+			if v, ok := it.Metrics[m]; ok {
+				row = append(row, strconv.FormatFloat(v, 'g', -1, 64))
+			} else {
+				row = append(row, "")
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeParquet writes a snappy-compressed file with a millisecond UTC
+// timestamp, gpu_id and host_id, and an optional double column per metric.
+func writeParquet(w io.Writer, items []model.Telemetry, metrics []string) error {
+	group := parquet.Group{
+		"timestamp": parquet.Timestamp(parquet.Millisecond),
+		"gpu_id":    parquet.String(),
+		"host_id":   parquet.String(),
+	}
+	for _, m := range metrics {
+		group[m] = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+	}
+	schema := parquet.NewSchema("telemetry", group)
+	pw := parquet.NewWriter(w, schema, parquet.Compression(&snappy.Codec{}))
+	fields := schema.Fields() // column order, sorted by name
+	rows := make([]parquet.Row, 1)
+	for _, it := range items {
+		row := rows[0][:0]
+		for col, f := range fields {
+			var v parquet.Value
+			switch f.Name() {
+			case "timestamp":
+				v = parquet.Int64Value(it.Timestamp.UnixMilli())
+			case "gpu_id":
+				v = parquet.ByteArrayValue([]byte(it.GPUId))
+			case "host_id":
+				v = parquet.ByteArrayValue([]byte(it.HostId))
+			default:
+				if x, ok := it.Metrics[f.Name()]; ok {
+					row = append(row, parquet.DoubleValue(x).Level(0, 1, col))
+				} else {
+					row = append(row, parquet.NullValue().Level(0, 0, col))
+				}
+				continue
+			}
+			row = append(row, v.Level(0, 0, col))
+		}
+		rows[0] = row
+		if _, err := pw.WriteRows(rows); err != nil {
+			return err
+		}
+	}
+	return pw.Close()
+}
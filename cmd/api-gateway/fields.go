@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+// fieldSet is a parsed fields param: the keys of each telemetry item to
+// write and, from metrics.<name> entries, the metrics to keep in the
+// metrics map (all when empty).
+type fieldSet struct {
+	keys    map[string]bool
+	metrics []string
+}
+
+// telemetryFields are the keys fields may select.
+var telemetryFields = []string{"timestamp", "gpu_id", "host_id", "producer_id", "metrics", "labels", "values"}
+
+// parseFields reads a comma-separated fields param; nil means whole items.
+func parseFields(s string) (*fieldSet, error) {
+	names := parseList(s)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	fs := &fieldSet{keys: map[string]bool{}}
+	for _, n := range names {
+		if m, ok := strings.CutPrefix(n, "metrics."); ok && m != "" {
+			fs.keys["metrics"] = true
+			fs.metrics = append(fs.metrics, m)
+			continue
+		}
+		if !slices.Contains(telemetryFields, n) {
+			return nil, fmt.Errorf("unknown field %q (want %s or metrics.<name>)", n, strings.Join(telemetryFields, ", "))
+		}
+		fs.keys[n] = true
+	}
+	return fs, nil
+}
+
+// narrow lets the store filter by the metrics named in fields when the
+// query does not name any itself.
+func (fs *fieldSet) narrow(q *storage.Query) {
+	if fs != nil && len(q.Metrics) == 0 {
+		q.Metrics = fs.metrics
+	}
+}
+
+// shapedTelemetry is a telemetry item with only the selected fields set.
+type shapedTelemetry struct {
+	GPUId      string                 `json:"gpu_id,omitempty"`
+	HostId     string                 `json:"host_id,omitempty"`
+	ProducerId string                 `json:"producer_id,omitempty"`
+	Timestamp  *time.Time             `json:"timestamp,omitempty"`
+	Metrics    map[string]float64     `json:"metrics,omitempty"`
+	Labels     map[string]string      `json:"labels,omitempty"`
+	Values     map[string]model.Value `json:"values,omitempty"`
+}
+
+func (fs *fieldSet) shape(it model.Telemetry) shapedTelemetry {
+	var out shapedTelemetry
+	if fs.keys["gpu_id"] {
+		out.GPUId = it.GPUId
+	}
+	if fs.keys["host_id"] {
+		out.HostId = it.HostId
+	}
+	if fs.keys["producer_id"] {
+		out.ProducerId = it.ProducerId
+	}
+	if fs.keys["timestamp"] {
+		out.Timestamp = &it.Timestamp
+	}
+	if fs.keys["labels"] {
+		out.Labels = it.Labels
+	}
+	if fs.keys["values"] {
+		out.Values = it.Values
+	}
+	if fs.keys["metrics"] {
+		out.Metrics = it.Metrics
+		if len(fs.metrics) > 0 {
+			out.Metrics = make(map[string]float64, len(fs.metrics))
+			for _, m := range fs.metrics {
+				if v, ok := it.Metrics[m]; ok {
+					out.Metrics[m] = v
+				}
+			}
+		}
+	}
+	return out
+}
+
+// shapedPage is a telemetryPage of shaped items.
+type shapedPage struct {
+	Items []shapedTelemetry `json:"items"`
+	Next  string            `json:"next,omitempty"`
+}
+
+func (fs *fieldSet) shapeAll(items []model.Telemetry) []shapedTelemetry {
+	out := make([]shapedTelemetry, len(items))
+	for i := range items {
+		out[i] = fs.shape(items[i])
+	}
+	return out
+}
+
+// writeTelemetry answers a telemetry query: a page envelope when paging was
+// asked for, otherwise a streamed array, with items shaped by fields.
+func writeTelemetry(w http.ResponseWriter, items []model.Telemetry, page *pageRequest, fields *fieldSet) {
+	switch {
+	case page != nil && fields != nil:
+		p := page.finish(items)
+		writeJSON(w, http.StatusOK, shapedPage{Items: fields.shapeAll(p.Items), Next: p.Next})
+	case page != nil:
+		writeJSON(w, http.StatusOK, page.finish(items))
+	case fields != nil:
+		writeJSONArray(w, http.StatusOK, fields.shapeAll(items))
+	default:
+		writeJSONArray(w, http.StatusOK, items)
+	}
+}
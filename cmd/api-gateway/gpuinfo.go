@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+// gpuInfoHandler serves GET /api/v1/gpus/{id}/info from the inventory the
+// collectors keep, and passes other requests to next. Within a tenant scope
+// a GPU without telemetry in the scope is not found, as for its other
+// resources.
+func gpuInfoHandler(inv storage.InventoryStore, store storage.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gpuID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/gpus/"), "/info")
+		if !ok || gpuID == "" || strings.Contains(gpuID, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		if inv == nil {
+			writeError(w, r, http.StatusNotImplemented, codeNotImplemented, "the store cannot keep GPU inventory")
+			return
+		}
+		if scopeFrom(r.Context()) != nil {
+			it, err := storage.Latest(storeFor(r.Context(), store), gpuID)
+			if err != nil {
+				writeStoreError(w, r, err, "gpu info scope check gpu=%s", gpuID)
+				return
+			}
+			if it == nil {
+				writeError(w, r, http.StatusNotFound, codeGPUNotFound, "no info registered for gpu "+gpuID)
+				return
+			}
+		}
+		docs, err := inv.ListGPUInfo()
+		if err != nil {
+			writeStoreError(w, r, err, "gpu info error gpu=%s", gpuID)
+			return
+		}
+		doc, ok := docs[gpuID]
+		if !ok {
+			writeError(w, r, http.StatusNotFound, codeGPUNotFound, "no info registered for gpu "+gpuID)
+			return
+		}
+		var info model.GPUInfo
+		if err := json.Unmarshal(doc, &info); err != nil {
+			writeStoreError(w, r, err, "gpu info decode gpu=%s", gpuID)
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+	})
+}
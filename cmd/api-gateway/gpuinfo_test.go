@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestGPUInfo_ServesRegisteredInfo(t *testing.T) {
+	// Scenario: gpu-1 on node-1 has registered info and telemetry; gpu-2 has
+	// telemetry only; a tenant scoped to node-2; a store without inventory
+	// Expect: gpu-1's info; 404 for gpu-2 and for gpu-1 within the node-2
+	// scope; other /gpus paths still served; 501 without an inventory store
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC().Truncate(time.Second)
+	_ = mem.SaveTelemetryBatch([]model.Telemetry{
+		{GPUId: "gpu-1", HostId: "node-1", Timestamp: now, Metrics: map[string]float64{"temp": 40}},
+		{GPUId: "gpu-2", HostId: "node-2", Timestamp: now, Metrics: map[string]float64{"temp": 50}},
+	})
+	doc, _ := json.Marshal(model.GPUInfo{GPUId: "gpu-1", Model: "H100", DriverVersion: "535.129.03", HostId: "node-1", RegisteredAt: now})
+	_ = mem.SaveGPUInfo("gpu-1", doc)
+	h := gpuInfoHandler(mem, mem, newServer(mem))
+
+	w := call(h, "/api/v1/gpus/gpu-1/info")
+	var info model.GPUInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil || w.Code != http.StatusOK || info.Model != "H100" || !info.RegisteredAt.Equal(now) {
+		t.Fatalf("gpu-1: %d %s", w.Code, w.Body.String())
+	}
+	if w := call(h, "/api/v1/gpus/gpu-2/info"); w.Code != http.StatusNotFound {
+		t.Fatalf("gpu-2: %d", w.Code)
+	}
+	if w := call(h, "/api/v1/gpus/gpu-1/latest"); w.Code != http.StatusOK {
+		t.Fatalf("latest: %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/gpus/gpu-1/info", nil)
+	req = req.WithContext(context.WithValue(req.Context(), scopeKey{}, &storage.Scope{HostIDs: []string{"node-2"}}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("out of scope: %d", w.Code)
+	}
+
+	if w := call(gpuInfoHandler(nil, mem, newServer(mem)), "/api/v1/gpus/gpu-1/info"); w.Code != http.StatusNotImplemented {
+		t.Fatalf("no inventory: %d", w.Code)
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"github.com/graph-gophers/graphql-go"
+)
+
+// graphqlSchema exposes the REST read APIs as one graph. Query arguments
+// mirror the REST params and share their limits.
+const graphqlSchema = `
+schema {
+  query: Query
+}
+
+scalar Time
+
+enum Agg {
+  AVG
+  MAX
+  MIN
+  LAST
+}
+
+type Query {
+  # All GPUs with stored telemetry.
+  gpus: [GPU!]!
+  gpu(id: ID!): GPU
+  # Hosts, as reported by each GPU's latest point.
+  hosts: [Host!]!
+  # Points of several GPUs ordered by time, then GPU; gpuIds or hostIds is required.
+  telemetry(gpuIds: [ID!], hostIds: [String!], start: Time, end: Time, step: String, metrics: [String!], limit: Int = 1000, desc: Boolean = false): [Telemetry!]!
+  # GPUs ranked by one metric over the window ending now, highest first unless asc.
+  top(metric: String!, n: Int = 10, window: String = "5m", agg: Agg = AVG, asc: Boolean = false): [GPUValue!]!
+}
+
+type GPU {
+  id: ID!
+  host: String
+  latest: Telemetry
+  telemetry(start: Time, end: Time, step: String, metrics: [String!], limit: Int = 1000, desc: Boolean = false): [Telemetry!]!
+  # Aggregates of one metric over [start, end], or the window ending now; null without data.
+  stats(metric: String!, start: Time, end: Time, window: String): MetricStats
+}
+
+type Host {
+  id: String!
+  gpus: [GPU!]!
+}
+
+type Telemetry {
+  gpuId: ID!
+  hostId: String
+  producerId: String
+  timestamp: Time!
+  metrics(names: [String!]): [Metric!]!
+  value(metric: String!): Float
+  labels: [Label!]!
+}
+
+type Metric {
+  name: String!
+  value: Float!
+}
+
+type Label {
+  name: String!
+  value: String!
+}
+
+type GPUValue {
+  gpu: GPU!
+  value: Float!
+}
+
+type MetricStats {
+  count: Int!
+  avg: Float!
+  min: Float!
+  max: Float!
+  last: Float!
+}
+`
+
+// graphqlMaxDepth bounds query nesting (e.g. hosts > gpus > telemetry).
+const graphqlMaxDepth = 8
+
+func newGraphQLSchema(store storage.Store) (*graphql.Schema, error) {
+	return graphql.ParseSchema(graphqlSchema, &gqlRoot{store: store}, graphql.UseFieldResolvers(), graphql.MaxDepth(graphqlMaxDepth))
+}
+
+type gqlRoot struct {
+	store storage.Store
+}
+
+func (r *gqlRoot) Gpus(ctx context.Context) ([]*gqlGPU, error) {
+	store := storeFor(ctx, r.store)
+	ids, err := store.ListGPUs()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*gqlGPU, len(ids))
+	for i, id := range ids {
+		out[i] = &gqlGPU{store: store, id: id}
+	}
+	return out, nil
+}
+
+func (r *gqlRoot) Gpu(ctx context.Context, args struct{ ID graphql.ID }) (*gqlGPU, error) {
+	g := &gqlGPU{store: storeFor(ctx, r.store), id: string(args.ID)}
+	latest, err := g.Latest()
+	if err != nil || latest == nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+type gqlHost struct {
+	ID   string
+	Gpus []*gqlGPU
+}
+
+func (r *gqlRoot) Hosts(ctx context.Context) ([]*gqlHost, error) {
+	gpus, err := r.Gpus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string]*gqlHost{}
+	for _, g := range gpus {
+		host, err := g.Host()
+		if err != nil {
+			return nil, err
+		}
+		if host == nil {
+			continue
+		}
+		h := byID[*host]
+		if h == nil {
+			h = &gqlHost{ID: *host}
+			byID[*host] = h
+		}
+		h.Gpus = append(h.Gpus, g)
+	}
+	out := make([]*gqlHost, 0, len(byID))
+	for _, h := range byID {
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// gqlWindow holds the window arguments shared by telemetry fields.
+type gqlWindow struct {
+	Start   *graphql.Time
+	End     *graphql.Time
+	Step    *string
+	Metrics *[]string
+	Limit   int32
+	Desc    bool
+}
+
+func (a gqlWindow) query() (storage.Query, error) {
+	q := storage.Query{Desc: a.Desc, Limit: int(a.Limit)}
+	if a.Limit < 1 || a.Limit > maxPageLimit {
+		return q, fmt.Errorf("invalid limit (want 1..%d)", maxPageLimit)
+	}
+	if a.Start != nil {
+		q.Start = &a.Start.Time
+	}
+	if a.End != nil {
+		q.End = &a.End.Time
+	}
+	if a.Step != nil {
+		d, err := time.ParseDuration(*a.Step)
+		if err != nil || d < minStep {
+			return q, errors.New("invalid step (want a duration of at least 1s, e.g. 5m)")
+		}
+		q.Step = d
+	}
+	if a.Metrics != nil {
+		q.Metrics = *a.Metrics
+	}
+	return q, nil
+}
+
+func (r *gqlRoot) Telemetry(ctx context.Context, args struct {
+	GpuIds  *[]graphql.ID
+	HostIds *[]string
+	Start   *graphql.Time
+	End     *graphql.Time
+	Step    *string
+	Metrics *[]string
+	Limit   int32
+	Desc    bool
+}) ([]*gqlTelemetry, error) {
+	q, err := gqlWindow{args.Start, args.End, args.Step, args.Metrics, args.Limit, args.Desc}.query()
+	if err != nil {
+		return nil, err
+	}
+	var gpuIDs []string
+	if args.GpuIds != nil {
+		for _, id := range *args.GpuIds {
+			gpuIDs = append(gpuIDs, string(id))
+		}
+	}
+	if args.HostIds != nil {
+		q.HostIDs = *args.HostIds
+	}
+	if len(gpuIDs) == 0 && len(q.HostIDs) == 0 {
+		return nil, errors.New("gpuIds or hostIds required")
+	}
+	if len(gpuIDs) > maxFleetGPUs {
+		return nil, fmt.Errorf("too many gpuIds (max %d)", maxFleetGPUs)
+	}
+	items, err := storage.ExecuteFleet(storeFor(ctx, r.store), gpuIDs, q)
+	return wrapTelemetry(items), err
+}
+
+func (r *gqlRoot) Top(ctx context.Context, args struct {
+	Metric string
+	N      int32
+	Window string
+	Agg    string
+	Asc    bool
+}) ([]*gqlGPUValue, error) {
+	if args.N < 1 || args.N > maxTopN {
+		return nil, fmt.Errorf("invalid n (want 1..%d)", maxTopN)
+	}
+	window, err := time.ParseDuration(args.Window)
+	if err != nil || window < minStep {
+		return nil, errors.New("invalid window (want a duration of at least 1s, e.g. 5m)")
+	}
+	start := time.Now().Add(-window)
+	store := storeFor(ctx, r.store)
+	vals, err := storage.Top(store, storage.TopQuery{Metric: args.Metric, Start: &start, Agg: strings.ToLower(args.Agg), Asc: args.Asc, N: int(args.N)})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*gqlGPUValue, len(vals))
+	for i, v := range vals {
+		out[i] = &gqlGPUValue{Gpu: &gqlGPU{store: store, id: v.GPUId}, Value: v.Value}
+	}
+	return out, nil
+}
+
+type gqlGPUValue struct {
+	Gpu   *gqlGPU
+	Value float64
+}
+
+// gqlGPU resolves GPU fields lazily; latest is fetched at most once, even
+// when sibling fields resolve concurrently.
+type gqlGPU struct {
+	store  storage.Store
+	id     string
+	once   sync.Once
+	latest *model.Telemetry
+	err    error
+}
+
+func (g *gqlGPU) ID() graphql.ID { return graphql.ID(g.id) }
+
+func (g *gqlGPU) latestPoint() (*model.Telemetry, error) {
+	g.once.Do(func() { g.latest, g.err = storage.Latest(g.store, g.id) })
+	return g.latest, g.err
+}
+
+func (g *gqlGPU) Latest() (*gqlTelemetry, error) {
+	it, err := g.latestPoint()
+	if err != nil || it == nil {
+		return nil, err
+	}
+	return &gqlTelemetry{t: *it}, nil
+}
+
+func (g *gqlGPU) Host() (*string, error) {
+	it, err := g.latestPoint()
+	if err != nil || it == nil || it.HostId == "" {
+		return nil, err
+	}
+	return &it.HostId, nil
+}
+
+func (g *gqlGPU) Telemetry(args gqlWindow) ([]*gqlTelemetry, error) {
+	q, err := args.query()
+	if err != nil {
+		return nil, err
+	}
+	items, err := storage.Execute(g.store, g.id, q)
+	return wrapTelemetry(items), err
+}
+
+type gqlStats struct {
+	Count               int32
+	Avg, Min, Max, Last float64
+}
+
+func (g *gqlGPU) Stats(args struct {
+	Metric string
+	Start  *graphql.Time
+	End    *graphql.Time
+	Window *string
+}) (*gqlStats, error) {
+	q := storage.Query{Metrics: []string{args.Metric}}
+	if args.Window != nil {
+		if args.Start != nil {
+			return nil, errors.New("window and start are mutually exclusive")
+		}
+		d, err := time.ParseDuration(*args.Window)
+		if err != nil || d < minStep {
+			return nil, errors.New("invalid window (want a duration of at least 1s, e.g. 5m)")
+		}
+		start := time.Now().Add(-d)
+		q.Start = &start
+	} else if args.Start != nil {
+		q.Start = &args.Start.Time
+	}
+	if args.End != nil {
+		q.End = &args.End.Time
+	}
+	items, err := storage.Execute(g.store, g.id, q)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	s := &gqlStats{Min: items[0].Metrics[args.Metric], Max: items[0].Metrics[args.Metric]}
+	var sum float64
+	for _, it := range items {
+		v := it.Metrics[args.Metric]
+		sum += v
+		s.Min, s.Max, s.Last = min(s.Min, v), max(s.Max, v), v
+	}
+	s.Count, s.Avg = int32(len(items)), sum/float64(len(items))
+	return s, nil
+}
+
+type gqlTelemetry struct {
+	t model.Telemetry
+}
+
+func wrapTelemetry(items []model.Telemetry) []*gqlTelemetry {
+	out := make([]*gqlTelemetry, len(items))
+	for i := range items {
+		out[i] = &gqlTelemetry{t: items[i]}
+	}
+	return out
+}
+
+func optString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func (t *gqlTelemetry) GpuId() graphql.ID       { return graphql.ID(t.t.GPUId) }
+func (t *gqlTelemetry) HostId() *string         { return optString(t.t.HostId) }
+func (t *gqlTelemetry) ProducerId() *string     { return optString(t.t.ProducerId) }
+func (t *gqlTelemetry) Timestamp() graphql.Time { return graphql.Time{Time: t.t.Timestamp} }
+
+type gqlPair[V any] struct {
+	Name  string
+	Value V
+}
+
+// Metrics returns the named metrics (all when names is null) sorted by name.
+func (t *gqlTelemetry) Metrics(args struct{ Names *[]string }) []gqlPair[float64] {
+	var out []gqlPair[float64]
+	if args.Names != nil {
+		for _, n := range *args.Names {
+			if v, ok := t.t.Metrics[n]; ok {
+				out = append(out, gqlPair[float64]{n, v})
+			}
+		}
+		return out
+	}
+	for n, v := range t.t.Metrics {
+		out = append(out, gqlPair[float64]{n, v})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (t *gqlTelemetry) Value(args struct{ Metric string }) *float64 {
+	v, ok := t.t.Metrics[args.Metric]
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+func (t *gqlTelemetry) Labels() []gqlPair[string] {
+	out := make([]gqlPair[string], 0, len(t.t.Labels))
+	for k, v := range t.t.Labels {
+		out = append(out, gqlPair[string]{k, v})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/storage"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// queryStreamBatch is how many points each QueryTelemetry message carries.
+const queryStreamBatch = 1000
+
+// queryServer serves the Query gRPC service from the same store as the REST
+// API, with the same validation.
+type queryServer struct {
+	telemetryv1.UnimplementedQueryServer
+	store   storage.Store
+	timeout time.Duration
+}
+
+// bound applies the request timeout, as withTimeout does for REST calls.
+func (s *queryServer) bound(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+func (s *queryServer) ListGPUs(ctx context.Context, _ *telemetryv1.ListGPUsRequest) (*telemetryv1.ListGPUsResponse, error) {
+	ctx, cancel := s.bound(ctx)
+	defer cancel()
+	ids, err := storeFor(ctx, s.store).ListGPUs()
+	if err != nil {
+		return nil, storeStatus(ctx, err, "list gpus")
+	}
+	return &telemetryv1.ListGPUsResponse{GpuIds: ids}, nil
+}
+
+func (s *queryServer) QueryTelemetry(req *telemetryv1.QueryTelemetryRequest, stream grpc.ServerStreamingServer[telemetryv1.TelemetryBatch]) error {
+	if len(req.GetGpuIds()) == 0 && len(req.GetHostIds()) == 0 {
+		return status.Error(codes.InvalidArgument, "gpu_ids or host_ids required")
+	}
+	if len(req.GetGpuIds()) > maxFleetGPUs {
+		return status.Errorf(codes.InvalidArgument, "too many gpu_ids (max %d)", maxFleetGPUs)
+	}
+	q := storage.Query{HostIDs: req.GetHostIds(), Metrics: req.GetMetrics(), Desc: req.GetDesc(), Limit: int(req.GetLimit())}
+	if req.Start != nil {
+		t := req.Start.AsTime()
+		q.Start = &t
+	}
+	if req.End != nil {
+		t := req.End.AsTime()
+		q.End = &t
+	}
+	if q.Start != nil && q.End != nil && q.End.Before(*q.Start) {
+		return status.Error(codes.InvalidArgument, "end before start")
+	}
+	if req.Step != nil {
+		if q.Step = req.Step.AsDuration(); q.Step < minStep {
+			return status.Error(codes.InvalidArgument, "invalid step (want at least 1s)")
+		}
+	}
+	ctx, cancel := s.bound(stream.Context())
+	defer cancel()
+	items, err := storage.ExecuteFleet(storeFor(ctx, s.store), req.GetGpuIds(), q)
+	if err != nil {
+		return storeStatus(ctx, err, fmt.Sprintf("fleet query gpus=%v hosts=%v", req.GetGpuIds(), q.HostIDs))
+	}
+	for len(items) > 0 {
+		n := min(len(items), queryStreamBatch)
+		if err := stream.Send(toBatch(items[:n])); err != nil {
+			return err
+		}
+		items = items[n:]
+	}
+	return nil
+}
+
+func (s *queryServer) Aggregate(ctx context.Context, req *telemetryv1.AggregateRequest) (*telemetryv1.AggregateResponse, error) {
+	q := storage.TopQuery{Metric: req.GetMetric(), Agg: storage.AggAvg, Asc: req.GetAsc(), N: int(req.GetLimit())}
+	if q.Metric == "" {
+		return nil, status.Error(codes.InvalidArgument, "metric required")
+	}
+	if req.GetAgg() != "" {
+		if !storage.ValidAgg(req.GetAgg()) {
+			return nil, status.Error(codes.InvalidArgument, "invalid agg (want avg, max, min or last)")
+		}
+		q.Agg = req.GetAgg()
+	}
+	end := time.Now().UTC()
+	if req.End != nil {
+		end = req.End.AsTime()
+	}
+	start := end.Add(-defaultTopWindow)
+	if req.Start != nil {
+		start = req.Start.AsTime()
+	}
+	if end.Before(start) {
+		return nil, status.Error(codes.InvalidArgument, "end before start")
+	}
+	q.Start, q.End = &start, &end
+	// the limit applies after filtering by gpu_ids, so rank everything first
+	only := map[string]bool{}
+	for _, id := range req.GetGpuIds() {
+		only[id] = true
+	}
+	if len(only) > 0 {
+		q.N = 0
+	}
+	ctx, cancel := s.bound(ctx)
+	defer cancel()
+	vals, err := storage.Top(storeFor(ctx, s.store), q)
+	if err != nil {
+		return nil, storeStatus(ctx, err, "aggregate metric="+q.Metric)
+	}
+	if len(only) > 0 {
+		var kept []storage.GPUValue
+		for _, v := range vals {
+			if only[v.GPUId] {
+				kept = append(kept, v)
+			}
+		}
+		vals = storage.RankValues(kept, q.Asc, int(req.GetLimit()))
+	}
+	resp := &telemetryv1.AggregateResponse{Values: make([]*telemetryv1.GPUValue, len(vals))}
+	for i, v := range vals {
+		resp.Values[i] = &telemetryv1.GPUValue{GpuId: v.GPUId, Value: v.Value}
+	}
+	return resp, nil
+}
+
+// storeStatus maps a failed store call to a gRPC status the way
+// writeStoreError maps it to an HTTP one.
+func storeStatus(ctx context.Context, err error, what string) error {
+	ctxErr := ctx.Err()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctxErr, context.DeadlineExceeded):
+		log.Printf("api: grpc %s: timed out: %v", what, err)
+		return status.Error(codes.DeadlineExceeded, "store query timed out")
+	case errors.Is(err, context.Canceled) || errors.Is(ctxErr, context.Canceled):
+		return status.Error(codes.Canceled, "client went away")
+	default:
+		log.Printf("api: grpc %s: %v", what, err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// grpcAuth returns interceptors that authenticate gRPC calls with the REST
+// API's credentials, sent as x-api-key or authorization metadata, and attach
+// the caller's tenant scope. tn may be nil.
+func grpcAuth(a *authenticator, tn *tenants) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	check := func(ctx context.Context, method string) (context.Context, error) {
+		if a.disabled {
+			return ctx, nil
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		r := &http.Request{Header: http.Header{}}
+		for _, k := range []string{"X-API-Key", "Authorization"} {
+			if v := md.Get(k); len(v) > 0 {
+				r.Header.Set(k, v[0])
+			}
+		}
+		id, err := a.authenticate(r)
+		if err != nil {
+			if err != errNoCredentials {
+				log.Printf("api: auth rejected grpc %s: %v", method, err)
+			}
+			return ctx, status.Error(codes.Unauthenticated, "missing or invalid credentials")
+		}
+		if a.audit {
+			log.Printf("api: audit sub=%s auth=%s grpc %s", id.Subject, id.Method, method)
+		}
+		ctx = withIdentity(ctx, id)
+		if tn != nil {
+			var ok bool
+			if ctx, ok = tn.attach(ctx, id); !ok {
+				return ctx, status.Error(codes.PermissionDenied, "caller has no tenant")
+			}
+		}
+		return ctx, nil
+	}
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := check(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := check(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, ctxStream{ServerStream: ss, ctx: ctx})
+	}
+	return unary, stream
+}
+
+// ctxStream is a server stream with the context set by an interceptor.
+type ctxStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s ctxStream) Context() context.Context { return s.ctx }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestGRPC_QueryService(t *testing.T) {
+	// Scenario: tenant "ml" (host h1) and tenant "ops" (all) call the Query
+	// service over a real listener; gpu-1 on h1 has 2500 points, gpu-2 on h2 one
+	// Expect: ml lists only gpu-1 and its telemetry comes in batches of 1000;
+	// ops aggregates both; bad requests are InvalidArgument; a call without
+	// credentials is Unauthenticated
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "keys.json")
+	_ = os.WriteFile(keys, []byte(`{"keys":[{"name":"ml-grafana","key":"ml-key-0123456789"},{"name":"sre","key":"sre-key-0123456789"}]}`), 0o600)
+	tfile := filepath.Join(dir, "tenants.json")
+	_ = os.WriteFile(tfile, []byte(`{"tenants":[{"name":"ml","subjects":["ml-grafana"],"hosts":["h1"]},{"name":"ops","subjects":["sre"],"all":true}]}`), 0o600)
+	a, err := newAuthenticator(authConfig{APIKeysFile: keys})
+	if err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	tn, err := loadTenants(tfile, "")
+	if err != nil {
+		t.Fatalf("tenants: %v", err)
+	}
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC().Truncate(time.Second)
+	batch := make([]model.Telemetry, 2500)
+	for i := range batch {
+		batch[i] = model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: now.Add(time.Duration(i-2500) * time.Millisecond), Metrics: map[string]float64{"temp": 60}}
+	}
+	_ = mem.SaveTelemetryBatch(batch)
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", HostId: "h2", Timestamp: now, Metrics: map[string]float64{"temp": 90}})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	unary, stream := grpcAuth(a, tn)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(unary), grpc.ChainStreamInterceptor(stream))
+	telemetryv1.RegisterQueryServer(srv, &queryServer{store: mem, timeout: 5 * time.Second})
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	c := telemetryv1.NewQueryClient(conn)
+	as := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+	}
+
+	list, err := c.ListGPUs(as("ml-key-0123456789"), &telemetryv1.ListGPUsRequest{})
+	if err != nil || len(list.GetGpuIds()) != 1 || list.GetGpuIds()[0] != "gpu-1" {
+		t.Fatalf("ml list: %v %v", list, err)
+	}
+
+	qs, err := c.QueryTelemetry(as("ml-key-0123456789"), &telemetryv1.QueryTelemetryRequest{GpuIds: []string{"gpu-1", "gpu-2"}})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	var sizes []int
+	for {
+		b, err := qs.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		for _, it := range b.GetItems() {
+			if it.GetGpuId() != "gpu-1" {
+				t.Fatalf("ml got %s", it.GetGpuId())
+			}
+		}
+		sizes = append(sizes, len(b.GetItems()))
+	}
+	if len(sizes) != 3 || sizes[0] != 1000 || sizes[2] != 500 {
+		t.Fatalf("batch sizes: %v", sizes)
+	}
+
+	agg, err := c.Aggregate(as("sre-key-0123456789"), &telemetryv1.AggregateRequest{Metric: "temp", Agg: "max"})
+	if err != nil || len(agg.GetValues()) != 2 || agg.GetValues()[0].GetGpuId() != "gpu-2" || agg.GetValues()[0].GetValue() != 90 {
+		t.Fatalf("ops aggregate: %v %v", agg, err)
+	}
+	agg, err = c.Aggregate(as("sre-key-0123456789"), &telemetryv1.AggregateRequest{Metric: "temp", GpuIds: []string{"gpu-1"}, Start: timestamppb.New(now.Add(-time.Minute)), End: timestamppb.New(now)})
+	if err != nil || len(agg.GetValues()) != 1 || agg.GetValues()[0].GetGpuId() != "gpu-1" {
+		t.Fatalf("filtered aggregate: %v %v", agg, err)
+	}
+
+	qs, err = c.QueryTelemetry(as("sre-key-0123456789"), &telemetryv1.QueryTelemetryRequest{})
+	if err == nil {
+		_, err = qs.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("no ids: expected InvalidArgument, got %v", err)
+	}
+	if _, err := c.Aggregate(as("sre-key-0123456789"), &telemetryv1.AggregateRequest{Metric: "temp", Agg: "p99"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("bad agg: expected InvalidArgument, got %v", err)
+	}
+	if _, err := c.ListGPUs(context.Background(), &telemetryv1.ListGPUsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("no credentials: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// streamBufSize is how much of a streamed JSON array is buffered before it is
+// written to the client.
+const streamBufSize = 32 << 10
+
+var gzipPool = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+
+// acceptsGzip reports whether the client listed gzip in Accept-Encoding
+// without refusing it (q=0).
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc, params, _ := strings.Cut(part, ";")
+		if strings.TrimSpace(enc) != "gzip" {
+			continue
+		}
+		if qs, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(qs, 64)
+			return err == nil && q > 0
+		}
+		return true
+	}
+	return false
+}
+
+// withGzip compresses responses for clients that accept gzip. Whether to
+// compress is decided when the handler writes its header, so event streams,
+// range responses and responses that are already encoded or compressed
+// (Parquet) pass through untouched.
+func withGzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+type gzipWriter struct {
+	http.ResponseWriter
+	zw          *gzip.Writer // nil until WriteHeader decides to compress
+	wroteHeader bool
+}
+
+func (g *gzipWriter) WriteHeader(status int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	h := g.Header()
+	ct := h.Get("Content-Type")
+	if status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" && !strings.HasPrefix(ct, "text/event-stream") && ct != parquetContentType {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		g.zw = gzipPool.Get().(*gzip.Writer)
+		g.zw.Reset(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gzipWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		if g.Header().Get("Content-Type") == "" {
+			g.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.zw == nil {
+		return g.ResponseWriter.Write(b)
+	}
+	return g.zw.Write(b)
+}
+
+func (g *gzipWriter) Flush() {
+	if g.zw != nil {
+		_ = g.zw.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (g *gzipWriter) Unwrap() http.ResponseWriter { return g.ResponseWriter }
+
+func (g *gzipWriter) close() {
+	if g.zw == nil {
+		return
+	}
+	_ = g.zw.Close()
+	g.zw.Reset(io.Discard)
+	gzipPool.Put(g.zw)
+	g.zw = nil
+}
+
+// writeJSONArray writes items as a JSON array one element at a time, so a
+// large result is never held in memory a second time as encoded JSON. The
+// output matches writeJSON's.
+func writeJSONArray[T any](w http.ResponseWriter, status int, items []T) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	bw := bufio.NewWriterSize(w, streamBufSize)
+	_ = bw.WriteByte('[')
+	for i := range items {
+		b, err := json.Marshal(items[i])
+		if err != nil {
+			log.Printf("api: encode item %d: %v", i, err)
+			return
+		}
+		if i > 0 {
+			_ = bw.WriteByte(',')
+		}
+		if _, err := bw.Write(b); err != nil {
+			return // client went away
+		}
+	}
+	_, _ = bw.WriteString("]\n")
+	_ = bw.Flush()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/storage"
+)
+
+// hostInfo is one host and the GPUs whose latest point it reported.
+type hostInfo struct {
+	HostId   string    `json:"host_id"`
+	GPUs     []string  `json:"gpus"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// listHosts groups the GPUs by the host_id of their latest point, as the
+// GraphQL hosts field does, so a GPU that moved is listed under its new host
+// only. GPUs without a host_id are left out. Hosts and GPUs are sorted.
+func listHosts(store storage.Store) ([]hostInfo, error) {
+	ids, err := store.ListGPUs()
+	if err != nil {
+		return nil, err
+	}
+	latest, err := storage.LatestMany(store, ids, nil)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string]*hostInfo{}
+	for id, it := range latest {
+		if it.HostId == "" {
+			continue
+		}
+		h := byID[it.HostId]
+		if h == nil {
+			h = &hostInfo{HostId: it.HostId}
+			byID[it.HostId] = h
+		}
+		h.GPUs = append(h.GPUs, id)
+		if it.Timestamp.After(h.LastSeen) {
+			h.LastSeen = it.Timestamp.UTC()
+		}
+	}
+	out := make([]hostInfo, 0, len(byID))
+	for _, h := range byID {
+		sort.Strings(h.GPUs)
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].HostId < out[j].HostId })
+	return out, nil
+}
+
+// hostsHandler serves GET /api/v1/hosts (every host with its GPUs) and
+// GET /api/v1/hosts/{id}/gpus (the GPU ids of one host, 404 if unknown).
+func hostsHandler(store storage.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		hostID := ""
+		if r.URL.Path != "/api/v1/hosts" {
+			p := strings.TrimPrefix(r.URL.Path, "/api/v1/hosts/")
+			id, rest, ok := strings.Cut(p, "/")
+			if !ok || id == "" || rest != "gpus" {
+				notFound(w, r)
+				return
+			}
+			hostID = id
+		}
+		hosts, err := listHosts(storeFor(r.Context(), store))
+		if err != nil {
+			writeStoreError(w, r, err, "list hosts error")
+			return
+		}
+		if hostID == "" {
+			writeJSON(w, http.StatusOK, hosts)
+			return
+		}
+		for _, h := range hosts {
+			if h.HostId == hostID {
+				writeJSON(w, http.StatusOK, h.GPUs)
+				return
+			}
+		}
+		writeError(w, r, http.StatusNotFound, codeHostNotFound, "no gpus for host "+hostID)
+	})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+	"gpu-metric-collector/internal/telemetrypb"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxIngestBody bounds a posted telemetry batch, maxIngestItems its points.
+const (
+	maxIngestBody  = 8 << 20
+	maxIngestItems = 10000
+)
+
+var (
+	metricIngested = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "gateway", Name: "ingested_items_total", Help: "Telemetry points accepted by POST /api/v1/telemetry.",
+	})
+	metricIngestRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "gateway", Name: "ingest_rejected_batches_total", Help: "POST /api/v1/telemetry batches rejected as invalid, out of scope, or not taken by the store or broker.",
+	})
+)
+
+// ingestSink takes a validated batch into the pipeline. It returns how many
+// items it accepted: on a *storage.BatchError all but the failed ones, on
+// other errors the leading ones.
+type ingestSink interface {
+	Ingest(ctx context.Context, items []model.Telemetry) (int, error)
+}
+
+// storeSink writes posted batches straight to the store.
+type storeSink struct{ store storage.Store }
+
+func (s storeSink) Ingest(ctx context.Context, items []model.Telemetry) (int, error) {
+	err := storage.WithContext(ctx, s.store).SaveTelemetryBatch(items)
+	var be *storage.BatchError
+	if errors.As(err, &be) {
+		return len(items) - len(be.Failed), err
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(items), nil
+}
+
+// errBackpressure reports a broker queue too full to take the whole batch.
+var errBackpressure = errors.New("broker queue full")
+
+// brokerSink publishes posted batches to the broker, as the streamer does, so
+// they pass through the collectors' pipeline.
+type brokerSink struct{ client telemetryv1.TelemetryClient }
+
+func (s brokerSink) Ingest(ctx context.Context, items []model.Telemetry) (int, error) {
+	ctx, span := tracer.Start(ctx, "broker.PublishBatch", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int("batch.items", len(items))))
+	defer span.End()
+	resp, err := s.client.PublishBatch(ctx, toBatch(items))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, err
+	}
+	// items before the first that did not fit are handled; the broker lists
+	// invalid ones as rejected
+	leading := len(items)
+	var rejected map[int]error
+	for _, st := range resp.GetItems() {
+		switch i := int(st.GetIndex()); {
+		case i >= len(items):
+		case st.GetStatus() == "BACKPRESSURE":
+			leading = min(leading, i)
+		case st.GetStatus() == "REJECTED":
+			if rejected == nil {
+				rejected = map[int]error{}
+			}
+			rejected[i] = errors.New(st.GetReason())
+		}
+	}
+	if resp.GetStatus() == "BACKPRESSURE" {
+		if len(resp.GetItems()) == 0 {
+			leading = int(resp.GetAccepted())
+		}
+		span.SetAttributes(attribute.Int("batch.accepted", int(resp.GetAccepted())))
+		span.SetStatus(codes.Error, errBackpressure.Error())
+		return leading, errBackpressure
+	}
+	if rejected != nil {
+		span.SetStatus(codes.Error, "items rejected")
+		return len(items) - len(rejected), &storage.BatchError{Failed: rejected}
+	}
+	return len(items), nil
+}
+
+// ingestItem is a posted point: the Telemetry of the query endpoints plus an
+// optional idempotency_key, so a resent batch is not stored twice.
+type ingestItem struct {
+	model.Telemetry
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// ingestHandler serves POST /api/v1/telemetry, a JSON array of points, and
+// passes other methods to next. Tenants may only post points within their
+// scope. A nil sink answers 405: ingestion is off unless -ingest is set.
+func ingestHandler(sink ingestSink, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if sink == nil {
+			writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "ingestion is disabled (see the gateway's -ingest flag)")
+			return
+		}
+		var posted []ingestItem
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxIngestBody))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&posted); err != nil {
+			metricIngestRejected.Inc()
+			writeError(w, r, http.StatusBadRequest, codeInvalidBody, "invalid telemetry batch: "+err.Error())
+			return
+		}
+		if len(posted) == 0 || len(posted) > maxIngestItems {
+			metricIngestRejected.Inc()
+			writeErrorDetails(w, r, http.StatusBadRequest, codeInvalidBody, fmt.Sprintf("want 1..%d items", maxIngestItems), map[string]any{"max_items": maxIngestItems})
+			return
+		}
+		sc := scopeFrom(r.Context())
+		items := make([]model.Telemetry, len(posted))
+		for i, p := range posted {
+			it := p.Telemetry
+			it.IdempotencyKey = p.IdempotencyKey
+			if msg := checkIngestItem(it); msg != "" {
+				metricIngestRejected.Inc()
+				writeErrorDetails(w, r, http.StatusBadRequest, codeInvalidBody, fmt.Sprintf("item %d: %s", i, msg), map[string]any{"index": i})
+				return
+			}
+			if sc != nil && !sc.Allows(it) {
+				metricIngestRejected.Inc()
+				writeErrorDetails(w, r, http.StatusForbidden, codeForbidden, fmt.Sprintf("item %d is outside the caller's hosts and clusters", i), map[string]any{"index": i})
+				return
+			}
+			items[i] = it
+		}
+
+		n, err := sink.Ingest(r.Context(), items)
+		metricIngested.Add(float64(n))
+		if errors.Is(err, errBackpressure) {
+			metricIngestRejected.Inc()
+			w.Header().Set("Retry-After", "1")
+			writeErrorDetails(w, r, http.StatusServiceUnavailable, codeBackpressure, fmt.Sprintf("broker queue full; resend the items after the first %d", n), map[string]any{"accepted": n})
+			return
+		}
+		var be *storage.BatchError
+		if errors.As(err, &be) {
+			metricIngestRejected.Inc()
+			failed := make([]int, 0, len(be.Failed))
+			for i := range be.Failed {
+				failed = append(failed, i)
+			}
+			sort.Ints(failed)
+			writeErrorDetails(w, r, http.StatusUnprocessableEntity, codePartialWrite, fmt.Sprintf("%d of %d items were not stored: %v", len(failed), len(items), be.Failed[failed[0]]),
+				map[string]any{"accepted": n, "failed": failed})
+			return
+		}
+		if err != nil {
+			metricIngestRejected.Inc()
+			writeStoreError(w, r, err, "ingest error items=%d", len(items))
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]int{"accepted": n})
+	})
+}
+
+// checkIngestItem returns what is wrong with a posted point, or "".
+func checkIngestItem(it model.Telemetry) string {
+	switch {
+	case strings.TrimSpace(it.GPUId) == "":
+		return "gpu_id required"
+	case it.Timestamp.IsZero():
+		return "timestamp required"
+	case len(it.Metrics) == 0 && len(it.Values) == 0:
+		return "metrics or values required"
+	}
+	return ""
+}
+
+// toBatch converts points to their wire form.
+func toBatch(items []model.Telemetry) *telemetryv1.TelemetryBatch {
+	batch := make([]*telemetryv1.TelemetryData, len(items))
+	for i, it := range items {
+		batch[i] = &telemetryv1.TelemetryData{
+			ProducerId:     it.ProducerId,
+			HostId:         it.HostId,
+			GpuId:          it.GPUId,
+			Ts:             timestamppb.New(it.Timestamp),
+			Metrics:        it.Metrics,
+			Labels:         it.Labels,
+			IdempotencyKey: it.IdempotencyKey,
+			Values:         telemetrypb.Values(it.Values),
+		}
+	}
+	return &telemetryv1.TelemetryBatch{Items: batch}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"google.golang.org/grpc"
+)
+
+func post(h http.Handler, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestIngest_Store(t *testing.T) {
+	// Scenario: a batch of two points posted with the store sink, then bad
+	// batches, then a POST with ingestion disabled
+	// Expect: 202 with accepted=2 and both points queryable; 400 naming the
+	// bad item; 405 when disabled; GET still served by the wrapped handler
+	mem := storage.NewMemoryStore()
+	srv := newServer(mem)
+	h := ingestHandler(storeSink{store: mem}, srv)
+
+	w := post(h, "/api/v1/telemetry", `[
+		{"gpu_id":"gpu-1","host_id":"h1","timestamp":"2024-01-01T00:00:00Z","metrics":{"temp":60},"idempotency_key":"a-1"},
+		{"gpu_id":"gpu-1","host_id":"h1","timestamp":"2024-01-01T00:00:10Z","metrics":{"temp":61}}]`)
+	if w.Code != http.StatusAccepted || w.Body.String() != "{\"accepted\":2}\n" {
+		t.Fatalf("post: %d %s", w.Code, w.Body.String())
+	}
+	var items []map[string]any
+	_ = json.Unmarshal(call(h, "/api/v1/telemetry?gpu_ids=gpu-1").Body.Bytes(), &items)
+	if len(items) != 2 {
+		t.Fatalf("stored: %v", items)
+	}
+
+	for body, index := range map[string]float64{
+		`[{"gpu_id":"gpu-1","timestamp":"2024-01-01T00:00:00Z","metrics":{"temp":1}},{"timestamp":"2024-01-01T00:00:00Z","metrics":{"temp":1}}]`: 1,
+		`[{"gpu_id":"gpu-1","metrics":{"temp":1}}]`:               0,
+		`[{"gpu_id":"gpu-1","timestamp":"2024-01-01T00:00:00Z"}]`: 0,
+	} {
+		w := post(h, "/api/v1/telemetry", body)
+		var e apiError
+		_ = json.Unmarshal(w.Body.Bytes(), &e)
+		if w.Code != http.StatusBadRequest || e.Code != codeInvalidBody || e.Details["index"] != index {
+			t.Fatalf("%s: %d %s", body, w.Code, w.Body.String())
+		}
+	}
+	for _, body := range []string{`[]`, `{"gpu_id":"gpu-1"}`, `[{"gpu":"x"}]`} {
+		if w := post(h, "/api/v1/telemetry", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d %s", body, w.Code, w.Body.String())
+		}
+	}
+
+	if w := post(ingestHandler(nil, srv), "/api/v1/telemetry", `[]`); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("disabled: %d", w.Code)
+	}
+}
+
+type publishClient struct {
+	telemetryv1.TelemetryClient
+	got  []*telemetryv1.TelemetryData
+	resp *telemetryv1.PublishResponse
+}
+
+func (c *publishClient) PublishBatch(ctx context.Context, in *telemetryv1.TelemetryBatch, opts ...grpc.CallOption) (*telemetryv1.PublishResponse, error) {
+	c.got = append(c.got, in.GetItems()...)
+	return c.resp, nil
+}
+
+func TestIngest_BrokerBackpressure(t *testing.T) {
+	// Scenario: the broker takes the first of two posted points and reports backpressure
+	// Expect: both published with their idempotency key; 503 backpressure with accepted=1
+	c := &publishClient{resp: &telemetryv1.PublishResponse{Accepted: 1, Status: "BACKPRESSURE"}}
+	h := ingestHandler(brokerSink{client: c}, http.NotFoundHandler())
+	w := post(h, "/api/v1/telemetry", `[
+		{"gpu_id":"gpu-1","timestamp":"2024-01-01T00:00:00Z","metrics":{"temp":60},"idempotency_key":"k1"},
+		{"gpu_id":"gpu-2","timestamp":"2024-01-01T00:00:00Z","metrics":{"temp":61}}]`)
+	var e apiError
+	_ = json.Unmarshal(w.Body.Bytes(), &e)
+	if w.Code != http.StatusServiceUnavailable || e.Code != codeBackpressure || e.Details["accepted"] != float64(1) || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("%d %s", w.Code, w.Body.String())
+	}
+	if len(c.got) != 2 || c.got[0].GetIdempotencyKey() != "k1" || c.got[1].GetGpuId() != "gpu-2" || c.got[0].GetMetrics()["temp"] != 60 {
+		t.Fatalf("published: %v", c.got)
+	}
+}
+
+func TestIngest_BrokerRejectsItems(t *testing.T) {
+	// Scenario: the broker rejects the second of three posted points
+	// Expect: 422 partial write naming item 1, with accepted=2
+	c := &publishClient{resp: &telemetryv1.PublishResponse{Accepted: 2, Status: "OK", Items: []*telemetryv1.ItemStatus{
+		{Index: 1, Status: "REJECTED", Reason: "gpu_id required"},
+	}}}
+	h := ingestHandler(brokerSink{client: c}, http.NotFoundHandler())
+	w := post(h, "/api/v1/telemetry", `[
+		{"gpu_id":"gpu-1","timestamp":"2024-01-01T00:00:00Z","metrics":{"temp":60}},
+		{"gpu_id":"gpu-2","timestamp":"2024-01-01T00:00:00Z","metrics":{"temp":61}},
+		{"gpu_id":"gpu-3","timestamp":"2024-01-01T00:00:00Z","metrics":{"temp":62}}]`)
+	var e apiError
+	_ = json.Unmarshal(w.Body.Bytes(), &e)
+	if w.Code != http.StatusUnprocessableEntity || e.Code != codePartialWrite || e.Details["accepted"] != float64(2) || !strings.Contains(e.Message, "gpu_id required") {
+		t.Fatalf("%d %s", w.Code, w.Body.String())
+	}
+	if failed, _ := e.Details["failed"].([]any); len(failed) != 1 || failed[0] != float64(1) {
+		t.Fatalf("failed: %v", e.Details["failed"])
+	}
+}
+
+// rejectingStore fails the batch items whose GPU is bad and keeps the rest.
+type rejectingStore struct{ *storage.MemoryStore }
+
+func (s rejectingStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	failed := map[int]error{}
+	for i, it := range items {
+		if it.GPUId == "bad" {
+			failed[i] = errors.New("rejected")
+		} else if err := s.SaveTelemetry(it); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return &storage.BatchError{Failed: failed}
+	}
+	return nil
+}
+
+func TestIngest_StorePartialFailure(t *testing.T) {
+	// Scenario: the store rejects items 1 and 3 of a four-point batch
+	// Expect: 422 partial_write with accepted=2 and failed=[1,3]; the other
+	// two points are stored
+	mem := storage.NewMemoryStore()
+	h := ingestHandler(storeSink{store: rejectingStore{mem}}, newServer(mem))
+	w := post(h, "/api/v1/telemetry", `[
+		{"gpu_id":"gpu-1","timestamp":"2024-01-01T00:00:00Z","metrics":{"temp":60}},
+		{"gpu_id":"bad","timestamp":"2024-01-01T00:00:00Z","metrics":{"temp":60}},
+		{"gpu_id":"gpu-1","timestamp":"2024-01-01T00:00:10Z","metrics":{"temp":61}},
+		{"gpu_id":"bad","timestamp":"2024-01-01T00:00:10Z","metrics":{"temp":61}}]`)
+	var e apiError
+	_ = json.Unmarshal(w.Body.Bytes(), &e)
+	if w.Code != http.StatusUnprocessableEntity || e.Code != codePartialWrite || e.Details["accepted"] != float64(2) || fmt.Sprint(e.Details["failed"]) != "[1 3]" {
+		t.Fatalf("%d %s", w.Code, w.Body.String())
+	}
+	if got, _ := mem.QueryTelemetry("gpu-1", nil, nil); len(got) != 2 {
+		t.Fatalf("stored: %v", got)
+	}
+}
@@ -2,45 +2,422 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/alert"
+	"gpu-metric-collector/internal/cache"
+	"gpu-metric-collector/internal/grpcclient"
 	"gpu-metric-collector/internal/storage"
+	"gpu-metric-collector/internal/tracing"
+	"gpu-metric-collector/internal/webhook"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
 	addr := flag.String("addr", ":8080", "HTTP listen address")
+	var tlsOpts tlsSettings
+	flag.StringVar(&tlsOpts.CertFile, "tls_cert", "", "Serve HTTPS (and TLS on -grpc_addr) with this PEM certificate; needs -tls_key")
+	flag.StringVar(&tlsOpts.KeyFile, "tls_key", "", "PEM private key for -tls_cert")
+	flag.StringVar(&tlsOpts.ClientCAFile, "tls_client_ca", "", "Verify client certificates against this PEM CA bundle (mutual TLS)")
+	flag.StringVar(&tlsOpts.ClientAuth, "tls_client_auth", clientAuthRequire, "With -tls_client_ca: \"require\" a client certificate, or verify it only if one is sent (\"optional\")")
+	flag.DurationVar(&tlsOpts.HSTS, "tls_hsts", 365*24*time.Hour, "Strict-Transport-Security max-age sent over HTTPS (0 disables)")
+	grpcAddr := flag.String("grpc_addr", "", "gRPC listen address for the Query service (ListGPUs, QueryTelemetry, Aggregate); empty disables")
+	metricsAddr := flag.String("metrics_addr", ":9103", "Metrics HTTP listen address (empty serves /metrics on -addr, behind auth)")
+	storeURIFlag := flag.String("store_uri", "", "Storage backend URI, e.g. influx://host:8086?org=o&bucket=b&token=t, victoria://host:8428, sqlite://telemetry.db, bolt://telemetry.db or mem://; overrides the backend flags below")
 	influxURL := flag.String("influx_url", "", "InfluxDB URL, e.g. http://localhost:8086")
 	influxOrg := flag.String("influx_org", "", "InfluxDB organization")
 	influxBucket := flag.String("influx_bucket", "", "InfluxDB bucket")
 	influxToken := flag.String("influx_token", "", "InfluxDB API token")
+	victoriaURL := flag.String("victoria_url", "", "VictoriaMetrics URL, e.g. http://localhost:8428, used when InfluxDB is not configured")
+	boltPath := flag.String("bolt_path", "", "Embedded bbolt database file, used when neither InfluxDB nor VictoriaMetrics is configured (empty keeps telemetry in memory)")
+	var memLimits storage.MemoryLimits
+	flag.IntVar(&memLimits.MaxPointsPerGPU, "memory_max_points", 100000, "Points kept per GPU by the in-memory store (used without InfluxDB); older ones are evicted (0 = unlimited)")
+	flag.DurationVar(&memLimits.MaxAge, "memory_max_age", 0, "Evict points older than this from the in-memory store (0 = keep)")
+	recentSQLite := flag.String("recent_sqlite", "", "SQLite database holding recent telemetry; reads within -recent_window are served from it, older ones from the main store (empty disables)")
+	recentWindow := flag.Duration("recent_window", time.Hour, "How far back -recent_sqlite holds data")
+	rollupTiers := flag.String("rollup_tiers", "", "Maintain rollups of the main store at these steps, e.g. 1m,1h, and answer downsampled queries from them (empty disables)")
+	rollupInterval := flag.Duration("rollup_interval", time.Minute, "How often closed buckets are rolled up")
+	rollupBackfill := flag.Duration("rollup_backfill", 24*time.Hour, "How far back a rollup that has no points of a GPU yet starts")
+	hotWindow := flag.Duration("hot_window", 0, "Keep telemetry written through the gateway for this long in memory as well, and serve reads within it from there (0 disables)")
+	retention := flag.String("retention", "", "Delete telemetry older than a max age per target, e.g. telemetry=30d,telemetry_rollup_5m=1y,recent=2h: InfluxDB measurements, telemetry for the in-memory store, recent for -recent_sqlite (empty disables)")
+	retentionInterval := flag.Duration("retention_interval", time.Hour, "How often the -retention rules are applied (0 only applies them on POST /api/v1/admin/retention)")
+	var auth authConfig
+	flag.StringVar(&auth.APIKeysFile, "auth_api_keys", "", "JSON file of accepted API keys: {\"keys\":[{\"name\":...,\"key\":...}]}")
+	flag.StringVar(&auth.JWKSURL, "auth_jwks_url", "", "JWKS URL; enables bearer JWTs signed by its keys")
+	flag.DurationVar(&auth.JWKSRefresh, "auth_jwks_refresh", time.Hour, "How often to refetch the JWKS")
+	flag.StringVar(&auth.Issuer, "auth_jwt_issuer", "", "Required JWT iss claim (optional)")
+	flag.StringVar(&auth.Audience, "auth_jwt_audience", "", "Required JWT aud claim (optional)")
+	flag.BoolVar(&auth.Audit, "auth_audit", false, "Log the caller of every authenticated request")
+	accessLog := flag.Bool("access_log", true, "Log one line per request with its status, duration, caller and request id")
+	adminSubjects := flag.String("admin_subjects", "", "Comma-separated callers (API key names or JWT subjects) allowed to use /api/v1/admin (requires auth)")
+	tenantsFile := flag.String("tenants", "", "JSON file mapping callers to the hosts/clusters they may see (requires auth)")
+	tenantClaim := flag.String("tenant_claim", "", "JWT claim naming the caller's tenant (optional; otherwise matched by subject)")
+	var limit rateRule
+	flag.Float64Var(&limit.Rate, "rate_limit", 0, "Requests per second allowed per client (API key, JWT subject or IP) across the API; 0 disables")
+	flag.Float64Var(&limit.Burst, "rate_burst", 20, "Requests a client may burst above -rate_limit")
+	routeLimits := flag.String("rate_limit_routes", "", "Per-route limits overriding -rate_limit, e.g. /api/v1/telemetry=2:10,/graphql=5 (prefix=rate[:burst])")
+	rateClientHeader := flag.String("rate_client_header", "", "Header carrying the client IP behind a trusted proxy, e.g. X-Forwarded-For")
+	gzipOn := flag.Bool("gzip", true, "Gzip responses for clients that send Accept-Encoding: gzip")
+	flag.DurationVar(&promMaxAge, "prom_max_age", promMaxAge, "Leave GPUs whose latest point is older than this out of /api/v1/prom (0 = keep all)")
+	flag.StringVar(&powerMetric, "power_metric", powerMetric, "Power draw metric (watts) behind /api/v1/gpus/{id}/derived")
+	flag.StringVar(&utilMetric, "util_metric", utilMetric, "Utilization metric (percent) behind /api/v1/gpus/{id}/derived")
+	requestTimeout := flag.Duration("request_timeout", 30*time.Second, "Deadline for each API request's store queries; slower requests get 504 (0 disables; streams are exempt)")
+	cacheTTL := flag.Duration("cache_ttl", 0, "Cache GPU lists, top-N rankings and downsampled queries for this long (0 disables)")
+	cacheMaxEntries := flag.Int("cache_max_entries", 10000, "Entries kept by the in-process cache")
+	latestRedisURL := flag.String("latest_redis_url", "", "Serve each GPU's latest point from this Redis index, kept current by collectors with the same flag and by -ingest=store, e.g. redis://redis:6379/0 (empty disables)")
+	cacheRedisURL := flag.String("cache_redis_url", "", "Share the cache through Redis instead of process memory, e.g. redis://redis:6379/0")
+	alertInterval := flag.Duration("alert_interval", 30*time.Second, "How often the gateway evaluates alert rules (0 disables evaluation)")
+	webhookInterval := flag.Duration("webhook_interval", 30*time.Second, "How often the gateway checks webhook subscriptions for threshold crossings (0 disables evaluation)")
+	var webhookCfg webhook.Config
+	flag.IntVar(&webhookCfg.MaxAttempts, "webhook_max_attempts", 5, "Posts of one webhook event before it is marked failed")
+	flag.DurationVar(&webhookCfg.Backoff, "webhook_backoff", time.Second, "Wait before the first webhook retry, doubled after each")
+	webhookAllowedHosts := flag.String("webhook_allowed_hosts", "", "Comma-separated hosts webhooks may post to at any address, e.g. receiver.ops.svc.cluster.local or .svc.cluster.local for its subdomains; others must be public addresses")
+	ingestMode := flag.String("ingest", "", "Accept POST /api/v1/telemetry and write it to the \"store\" or publish it to the \"broker\" (empty disables)")
+	brokerAddr := flag.String("broker", "127.0.0.1:9000", "Broker gRPC address for -ingest=broker")
+	var brokerSec grpcclient.Security
+	flag.BoolVar(&brokerSec.TLS, "broker_tls", false, "Use TLS for the broker connection (implied by -broker_ca or -broker_cert)")
+	flag.StringVar(&brokerSec.CAFile, "broker_ca", "", "CA bundle (PEM) used to verify the broker certificate")
+	flag.StringVar(&brokerSec.CertFile, "broker_cert", "", "Client certificate (PEM) for mutual TLS with the broker")
+	flag.StringVar(&brokerSec.KeyFile, "broker_key", "", "Client private key (PEM) for mutual TLS with the broker")
+	flag.StringVar(&brokerSec.ServerName, "broker_server_name", "", "Override the server name used to verify the broker certificate")
+	flag.StringVar(&brokerSec.TokenFile, "broker_token_file", "", "File containing the bearer token sent to the broker")
+	tracesEndpoint := flag.String("otlp_traces_endpoint", "", "OTLP/gRPC endpoint to send request traces to, e.g. otel-collector:4317 (empty disables)")
+	var tracesSec grpcclient.Security
+	flag.BoolVar(&tracesSec.TLS, "otlp_traces_tls", false, "Use TLS for the traces connection (implied by -otlp_traces_ca)")
+	flag.StringVar(&tracesSec.CAFile, "otlp_traces_ca", "", "CA bundle (PEM) used to verify the traces endpoint")
+	tracesSample := flag.Float64("otlp_traces_sample", 1, "Fraction of requests traced when the caller sent no sampled traceparent (0-1)")
+	flag.DurationVar(&streamPoll, "stream_poll", streamPoll, "How often /api/v1/stream checks the store for new points")
 	flag.Parse()
 
-	var store storage.Store
-	if *influxURL != "" && *influxOrg != "" && *influxBucket != "" && *influxToken != "" {
-		s, err := storage.NewInfluxStore(*influxURL, *influxOrg, *influxBucket, *influxToken)
+	if *tracesEndpoint != "" {
+		shutdown, err := tracing.Setup(tracing.Config{Endpoint: *tracesEndpoint, Security: tracesSec, ServiceName: "api-gateway", SampleRatio: *tracesSample})
+		if err != nil {
+			log.Fatalf("tracing: %v", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = shutdown(ctx)
+		}()
+		log.Printf("api-gateway: sending traces to %s (sample=%g)", *tracesEndpoint, *tracesSample)
+	}
+
+	uri, err := gatewayStoreURI(*storeURIFlag, *influxURL, *influxOrg, *influxBucket, *influxToken, *victoriaURL, *boltPath)
+	if err != nil {
+		log.Fatalf("store: %v", err)
+	}
+	store, err := storage.Open(uri, storage.Options{Memory: memLimits})
+	if err != nil {
+		log.Fatalf("open store: %v", err)
+	}
+	if c, ok := store.(io.Closer); ok {
+		defer c.Close()
+	}
+	if mem, ok := store.(*storage.MemoryStore); ok {
+		prometheus.MustRegister(memoryEvictionMetrics(mem)...)
+		log.Printf("api-gateway: using in-memory store (max %d points per GPU, max age %s)", memLimits.MaxPointsPerGPU, memLimits.MaxAge)
+	} else {
+		log.Printf("api-gateway: using store %s", storage.RedactURI(uri))
+	}
+	// measurement opens another series on the main store's backend
+	var closers []io.Closer
+	measurement := func(m string) (storage.Store, error) {
+		s, err := storage.Open(uri, storage.Options{Measurement: m})
+		if c, ok := s.(io.Closer); ok && err == nil {
+			closers = append(closers, c)
+		}
+		return s, err
+	}
+	defer func() {
+		for _, c := range closers {
+			_ = c.Close()
+		}
+	}()
+
+	authn, err := newAuthenticator(auth)
+	if err != nil {
+		log.Fatalf("auth: %v", err)
+	}
+	if authn.disabled {
+		log.Printf("api-gateway: warning: no -auth_api_keys or -auth_jwks_url, the API is unauthenticated")
+	}
+	admins := map[string]bool{}
+	for _, s := range parseList(*adminSubjects) {
+		admins[s] = true
+	}
+	if len(admins) > 0 && authn.disabled {
+		log.Fatalf("-admin_subjects requires -auth_api_keys or -auth_jwks_url")
+	}
+	var tn *tenants
+	var scopeFor func(string) (*storage.Scope, bool)
+	if *tenantsFile != "" {
+		if authn.disabled {
+			log.Fatalf("-tenants requires -auth_api_keys or -auth_jwks_url")
+		}
+		if tn, err = loadTenants(*tenantsFile, *tenantClaim); err != nil {
+			log.Fatalf("tenants: %v", err)
+		}
+		scopeFor = tn.scopeFor
+	}
+	// VictoriaMetrics only holds numbers, so rules and webhooks live in memory there
+	var docs *storage.MemoryStore
+	ruleStore, ok := store.(storage.RuleStore)
+	if !ok {
+		docs = storage.NewMemoryStore()
+		ruleStore = docs
+		log.Printf("api-gateway: warning: the store cannot persist alert rules and webhooks, they are kept in memory until restart")
+	}
+	// base is the main store, with rollups for downsampled reads
+	base := store
+	var rollups *storage.RollupStore
+	if steps, err := parseRollupTiers(*rollupTiers); err != nil {
+		log.Fatalf("rollup_tiers: %v", err)
+	} else if len(steps) > 0 {
+		tiers := make([]storage.RollupTier, len(steps))
+		for i, step := range steps {
+			if _, ok := store.(*storage.MemoryStore); ok {
+				log.Fatalf("-rollup_tiers needs a store other than memory")
+			}
+			m := rollupMeasurement(step)
+			s, err := measurement(m)
+			if err != nil {
+				log.Fatalf("open rollup store %s: %v", m, err)
+			}
+			tiers[i] = storage.RollupTier{Step: step, Store: s}
+		}
+		rollups = storage.NewRollupStore(store, tiers, storage.RollupConfig{Backfill: *rollupBackfill})
+		base = rollups
+		log.Printf("api-gateway: rolling up telemetry every %s at %s", *rollupInterval, *rollupTiers)
+	}
+	readBase := base
+	var recent storage.Store
+	if *recentSQLite != "" {
+		if recent, err = storage.NewSQLiteStore(*recentSQLite); err != nil {
+			log.Fatalf("open recent store: %v", err)
+		}
+		readBase = storage.NewReadRouter(recent, base, *recentWindow)
+		log.Printf("api-gateway: reading the last %s from %s", *recentWindow, *recentSQLite)
+	}
+	// deletions go to every tier holding telemetry
+	deletes := base
+	if *hotWindow > 0 {
+		if _, ok := store.(*storage.MemoryStore); ok {
+			log.Fatalf("-hot_window needs a store other than memory")
+		}
+		if recent != nil {
+			log.Fatalf("-hot_window and -recent_sqlite cannot be combined")
+		}
+		tiered := storage.NewTieredStore(base, *hotWindow)
+		readBase, deletes = tiered, tiered
+		log.Printf("api-gateway: keeping the last %s of telemetry in memory", *hotWindow)
+	}
+	if *latestRedisURL != "" {
+		idx, err := storage.NewRedisLatest(*latestRedisURL, "gpu-telemetry:")
+		if err != nil {
+			log.Fatalf("latest index: %v", err)
+		}
+		defer idx.Close()
+		onErr := func(err error) {
+			metricLatestErrors.Inc()
+			log.Printf("api-gateway: %v", err)
+		}
+		readBase = storage.NewLatestCache(readBase, idx, onErr)
+		deletes = storage.NewLatestCache(deletes, idx, onErr)
+		log.Printf("api-gateway: serving latest points from %s", storage.RedactURI(*latestRedisURL))
+	}
+	// rules and deletions use the store itself; everything else is timed
+	timed := newInstrumentedStore(readBase)
+	alerts, err := alert.NewEngine(timed, ruleStore, scopeFor)
+	if err != nil {
+		log.Fatalf("alerts: %v", err)
+	}
+	webhookStore, ok := store.(storage.WebhookStore)
+	if !ok {
+		if docs == nil {
+			docs = storage.NewMemoryStore()
+		}
+		webhookStore = docs
+	}
+	webhookCfg.AllowedHosts = strings.Split(*webhookAllowedHosts, ",")
+	webhooks, err := webhook.NewNotifier(timed, webhookStore, scopeFor, webhookCfg)
+	if err != nil {
+		log.Fatalf("webhooks: %v", err)
+	}
+	var pruner *retentionJob
+	if rules, err := parseRetention(*retention); err != nil {
+		log.Fatalf("retention: %v", err)
+	} else if len(rules) > 0 {
+		_, isInflux := store.(*storage.InfluxStore)
+		pruner, err = newRetentionJob(rules, func(target string) (storage.Store, error) {
+			switch {
+			case target == "recent" && recent != nil:
+				return recent, nil
+			case target == "telemetry":
+				return deletes, nil
+			case isInflux:
+				return measurement(target)
+			}
+			return nil, errors.New("unknown target; measurements other than telemetry need InfluxDB")
+		})
+		if err != nil {
+			log.Fatalf("retention: %v", err)
+		}
+		log.Printf("api-gateway: retention %s every %s", *retention, *retentionInterval)
+	}
+	var readStore storage.Store = timed
+	if *cacheTTL > 0 {
+		var c cache.Cache = cache.NewMemory(*cacheMaxEntries)
+		if *cacheRedisURL != "" {
+			r, err := cache.NewRedis(*cacheRedisURL, "gpu-gateway:")
+			if err != nil {
+				log.Fatalf("cache: %v", err)
+			}
+			defer r.Close()
+			c = r
+		}
+		readStore = newCachedStore(timed, c, *cacheTTL)
+		log.Printf("api-gateway: caching results for %s (redis=%t)", *cacheTTL, *cacheRedisURL != "")
+	}
+	var sink ingestSink
+	switch *ingestMode {
+	case "":
+	case "store":
+		sink = storeSink{store: timed}
+	case "broker":
+		opts, err := brokerSec.DialOptions()
 		if err != nil {
-			log.Fatalf("open influx store: %v", err)
+			log.Fatalf("broker security: %v", err)
 		}
-		store = s
-		log.Printf("api-gateway: using influx store url=%s org=%s bucket=%s", *influxURL, *influxOrg, *influxBucket)
+		conn, err := grpc.Dial(*brokerAddr, opts...)
+		if err != nil {
+			log.Fatalf("dial broker: %v", err)
+		}
+		defer conn.Close()
+		sink = brokerSink{client: telemetryv1.NewTelemetryClient(conn)}
+	default:
+		log.Fatalf("-ingest must be store or broker, got %q", *ingestMode)
+	}
+	if sink != nil {
+		log.Printf("api-gateway: accepting POST /api/v1/telemetry into the %s", *ingestMode)
+	}
+	prometheus.MustRegister(metricCacheLookups, metricCacheErrors, metricCacheBypassed, metricLatestErrors, metricIngested, metricIngestRejected,
+		metricRequests, metricRequestDuration, metricInFlight, metricRetentionDeleted, metricRetentionErrors)
+	prometheus.MustRegister(storeMetrics.Collectors()...)
+	srv := newServer(readStore)
+	mux := http.NewServeMux()
+	if *metricsAddr == "" {
+		mux.Handle("/metrics", promhttp.Handler())
 	} else {
-		store = storage.NewMemoryStore()
-		log.Printf("api-gateway: using in-memory store")
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", promhttp.Handler())
+		go func() {
+			log.Printf("api-gateway: metrics on %s", *metricsAddr)
+			if err := http.ListenAndServe(*metricsAddr, metricsMux); err != nil {
+				log.Fatalf("metrics server: %v", err)
+			}
+		}()
+	}
+	mux.Handle("/api/v1/alerts/", alertsHandler(alerts))
+	mux.Handle("/api/v1/webhooks", webhooksHandler(webhooks))
+	mux.Handle("/api/v1/webhooks/", webhooksHandler(webhooks))
+	mux.Handle("/api/v1/admin/", adminHandler(deletes, pruner, admins))
+	mux.Handle("/api/v1/telemetry", ingestHandler(sink, srv))
+	inventoryStore, _ := store.(storage.InventoryStore)
+	mux.Handle("/api/v1/gpus/", gpuInfoHandler(inventoryStore, readStore, srv))
+	mux.Handle("/", srv)
+	var handler http.Handler = withTimeout(*requestTimeout, withCacheBypass(mux))
+	if tn != nil {
+		handler = tn.wrap(handler)
+	}
+	routes, err := parseRouteLimits(*routeLimits)
+	if err != nil {
+		log.Fatalf("rate_limit_routes: %v", err)
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	handler = newRateLimiter(limit, routes, *rateClientHeader).wrap(handler)
+	handler = authn.wrap(handler)
+	if *gzipOn {
+		handler = withGzip(handler)
+	}
+	handler = withTracing(withMetrics(handler))
+	if *accessLog {
+		handler = withAccessLog(handler)
+	}
+	handler = withRequestID(handler)
+	var tlsCfg *tls.Config
+	if tlsOpts.enabled() {
+		if tlsCfg, err = tlsOpts.config(); err != nil {
+			log.Fatalf("tls: %v", err)
+		}
+		handler = withHSTS(tlsOpts.HSTS, handler)
+	}
+	// cancelled on shutdown so open streams end instead of holding it up
+	baseCtx, cancelStreams := context.WithCancel(context.Background())
+	if *alertInterval > 0 {
+		go alerts.Run(baseCtx, *alertInterval)
+	}
+	if *webhookInterval > 0 {
+		go webhooks.Run(baseCtx, *webhookInterval)
+	}
+	if rollups != nil && *rollupInterval > 0 {
+		go runRollups(baseCtx, rollups, *rollupInterval)
+	}
+	if pruner != nil && *retentionInterval > 0 {
+		go pruner.Run(baseCtx, *retentionInterval)
+	}
+	server := &http.Server{Addr: *addr, Handler: handler, BaseContext: func(net.Listener) context.Context { return baseCtx }}
+	if tlsCfg != nil {
+		server.TLSConfig = tlsCfg.Clone()
 	}
 
-	handler := newServer(store)
-	server := &http.Server{Addr: *addr, Handler: handler}
+	var grpcServer *grpc.Server
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatalf("grpc listen: %v", err)
+		}
+		unary, stream := grpcAuth(authn, tn)
+		opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(unary), grpc.ChainStreamInterceptor(stream)}
+		if tlsCfg != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg.Clone())))
+		}
+		grpcServer = grpc.NewServer(opts...)
+		telemetryv1.RegisterQueryServer(grpcServer, &queryServer{store: readStore, timeout: *requestTimeout})
+		go func() {
+			log.Printf("api-gateway: gRPC Query service on %s", *grpcAddr)
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Fatalf("grpc server: %v", err)
+			}
+		}()
+	}
 
 	// graceful shutdown
 	go func() {
-		log.Printf("api-gateway: listening on %s with /api/v1 endpoints", *addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		serve := server.ListenAndServe
+		if tlsCfg != nil {
+			serve = func() error { return server.ListenAndServeTLS("", "") }
+		}
+		log.Printf("api-gateway: listening on %s with /api/v1 endpoints (tls=%t)", *addr, tlsCfg != nil)
+		if err := serve(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("http server: %v", err)
 		}
 	}()
@@ -48,7 +425,28 @@ func main() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	<-sigCh
+	cancelStreams()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	_ = server.Shutdown(ctx)
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	webhooks.Close()
+}
+
+// gatewayStoreURI returns the -store_uri, or the URI of the first configured
+// of InfluxDB, VictoriaMetrics and bolt, else mem://.
+func gatewayStoreURI(uri, influxURL, org, bucket, token, victoriaURL, boltPath string) (string, error) {
+	switch {
+	case uri != "":
+		return uri, nil
+	case influxURL != "" && org != "" && bucket != "" && token != "":
+		return storage.BackendURI("influx", influxURL, url.Values{"org": {org}, "bucket": {bucket}, "token": {token}})
+	case victoriaURL != "":
+		return storage.BackendURI("victoria", victoriaURL, nil)
+	case boltPath != "":
+		return "bolt://" + boltPath, nil
+	}
+	return "mem://", nil
 }
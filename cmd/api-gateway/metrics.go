@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/storage"
+	"gpu-metric-collector/internal/storemetrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "gateway", Name: "requests_total", Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	metricRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gpu_telemetry", Subsystem: "gateway", Name: "request_duration_seconds", Help: "HTTP request latency by route and status code; streams are left out.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "code"})
+	metricInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gpu_telemetry", Subsystem: "gateway", Name: "requests_in_flight", Help: "HTTP requests being served, open streams included.",
+	})
+	// storeMetrics times the calls that reach the store; cache hits do not
+	storeMetrics = storemetrics.New("gateway")
+)
+
+// routeOther labels requests that match no route of apiRoutes.
+const routeOther = "other"
+
+var routeTemplates = func() [][]string {
+	seen := map[string]bool{}
+	var out [][]string
+	for _, rt := range apiRoutes {
+		if !seen[rt.Path] {
+			seen[rt.Path] = true
+			out = append(out, strings.Split(rt.Path, "/"))
+		}
+	}
+	return out
+}()
+
+// routeLabel returns the apiRoutes path matching path, e.g.
+// /api/v1/gpus/{id}/latest, so the route label has one value per operation
+// rather than one per GPU. A literal segment beats a {placeholder}, so
+// /api/v1/gpus/top is not taken for a GPU called top.
+func routeLabel(path string) string {
+	segs := strings.Split(path, "/")
+	best, bestVars := routeOther, len(segs)+1
+	for _, tmpl := range routeTemplates {
+		if len(tmpl) != len(segs) {
+			continue
+		}
+		vars := 0
+		for i, t := range tmpl {
+			if strings.HasPrefix(t, "{") {
+				if segs[i] == "" {
+					vars = -1
+					break
+				}
+				vars++
+			} else if t != segs[i] {
+				vars = -1
+				break
+			}
+		}
+		if vars >= 0 && vars < bestVars {
+			best, bestVars = strings.Join(tmpl, "/"), vars
+		}
+	}
+	return best
+}
+
+// withMetrics counts and times every request by route and status. Requests
+// rejected by auth or the rate limiter are counted as well when it wraps them.
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeLabel(r.URL.Path)
+		metricInFlight.Inc()
+		defer metricInFlight.Dec()
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		code := strconv.Itoa(sw.status())
+		metricRequests.WithLabelValues(route, r.Method, code).Inc()
+		// a stream lasts as long as its client, which says nothing about latency
+		if route != "/api/v1/stream" {
+			metricRequestDuration.WithLabelValues(route, code).Observe(time.Since(start).Seconds())
+		}
+	})
+}
+
+// statusWriter records the status a handler writes and the bytes of its
+// body; Flush keeps streams working through it.
+type statusWriter struct {
+	http.ResponseWriter
+	code  int
+	bytes int64
+}
+
+func (s *statusWriter) WriteHeader(status int) {
+	if s.code == 0 {
+		s.code = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusWriter) Write(b []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusWriter) Flush() {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusWriter) Unwrap() http.ResponseWriter { return s.ResponseWriter }
+
+// status is what the client saw: 200 when the handler wrote nothing.
+func (s *statusWriter) status() int {
+	if s.code == 0 {
+		return http.StatusOK
+	}
+	return s.code
+}
+
+// newInstrumentedStore times every call that reaches base and, when the
+// store is bound to a request's context, records it as a span of the
+// request's trace. It sits under the cache, so cache hits are not observed.
+func newInstrumentedStore(base storage.Store) *storemetrics.Store {
+	return storeMetrics.Wrap(base, tracer)
+}
+
+// memoryEvictionMetrics counts the points a bounded memory store dropped,
+// labelled by the limit that dropped them.
+func memoryEvictionMetrics(m *storage.MemoryStore) []prometheus.Collector {
+	counter := func(reason string, n func(storage.MemoryEvictions) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "gpu_telemetry", Subsystem: "gateway", Name: "memory_evicted_points_total", Help: "Points the in-memory store dropped to stay within -memory_max_points (capacity) or -memory_max_age (age).",
+			ConstLabels: prometheus.Labels{"reason": reason},
+		}, func() float64 { return float64(n(m.Evictions())) })
+	}
+	return []prometheus.Collector{
+		counter("capacity", func(e storage.MemoryEvictions) uint64 { return e.Capacity }),
+		counter("age", func(e storage.MemoryEvictions) uint64 { return e.Age }),
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMetrics_RouteLabel(t *testing.T) {
+	// Scenario: request paths of templated, literal and unknown routes
+	// Expect: the apiRoutes template, literals preferred over {id}, other for the rest
+	for path, want := range map[string]string{
+		"/api/v1/gpus":                    "/api/v1/gpus",
+		"/api/v1/gpus/gpu-1/latest":       "/api/v1/gpus/{id}/latest",
+		"/api/v1/gpus/top":                "/api/v1/gpus/top",
+		"/api/v1/hosts/h1/gpus":           "/api/v1/hosts/{id}/gpus",
+		"/api/v1/alerts/rules/r1":         "/api/v1/alerts/rules/{id}",
+		"/api/v1/gpus//latest":            routeOther,
+		"/api/v1/gpus/gpu-1/nope":         routeOther,
+		"/healthz":                        routeOther,
+		"/readyz":                         routeOther,
+		"/api/v1/gpus/gpu-1/telemetry/x/": routeOther,
+	} {
+		if got := routeLabel(path); got != want {
+			t.Errorf("%s: got %s, want %s", path, got, want)
+		}
+	}
+}
+
+// sampleCount returns how many observations h has recorded.
+func sampleCount(t *testing.T, h prometheus.Observer) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMetrics_CountsRequestsAndStoreCalls(t *testing.T) {
+	// Scenario: a latest query that succeeds and one for an unknown GPU, through
+	// withMetrics and an instrumented store
+	// Expect: requests counted by route template and status, latency observed
+	// for both, one store latency sample per store call, nothing left in flight
+	mem := storage.NewMemoryStore()
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: time.Now().UTC(), Metrics: map[string]float64{"temp": 60}})
+	h := withMetrics(newServer(newInstrumentedStore(mem)))
+	route := "/api/v1/gpus/{id}/latest"
+	ok := testutil.ToFloat64(metricRequests.WithLabelValues(route, "GET", "200"))
+	missing := testutil.ToFloat64(metricRequests.WithLabelValues(route, "GET", "404"))
+	latency := sampleCount(t, metricRequestDuration.WithLabelValues(route, "200"))
+	store := sampleCount(t, storeMetrics.Duration.WithLabelValues("latest", "ok"))
+
+	if w := call(h, "/api/v1/gpus/gpu-1/latest"); w.Code != http.StatusOK {
+		t.Fatalf("latest: %d %s", w.Code, w.Body.String())
+	}
+	if w := call(h, "/api/v1/gpus/gpu-9/latest"); w.Code != http.StatusNotFound {
+		t.Fatalf("missing: %d %s", w.Code, w.Body.String())
+	}
+
+	if got := testutil.ToFloat64(metricRequests.WithLabelValues(route, "GET", "200")) - ok; got != 1 {
+		t.Fatalf("200s: %v", got)
+	}
+	if got := testutil.ToFloat64(metricRequests.WithLabelValues(route, "GET", "404")) - missing; got != 1 {
+		t.Fatalf("404s: %v", got)
+	}
+	if got := sampleCount(t, metricRequestDuration.WithLabelValues(route, "200")) - latency; got != 1 {
+		t.Fatalf("latency samples: %d", got)
+	}
+	if got := sampleCount(t, storeMetrics.Duration.WithLabelValues("latest", "ok")) - store; got != 2 {
+		t.Fatalf("store samples: %d", got)
+	}
+	if got := testutil.ToFloat64(metricInFlight); got != 0 {
+		t.Fatalf("in flight: %v", got)
+	}
+}
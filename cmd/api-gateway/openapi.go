@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gpu-metric-collector/api"
+)
+
+// openAPISpec is the document served at /openapi.json. It is generated at
+// startup too, so the served operations always match apiRoutes.
+var openAPISpec = func() []byte {
+	b, err := generateSpec(api.OpenAPI)
+	if err != nil {
+		// the embedded spec is a constant; failing to parse it is a programming error
+		panic(err)
+	}
+	return b
+}()
+
+// generateSpec returns the OpenAPI document base with its operations
+// rebuilt from apiRoutes: operations not in apiRoutes are dropped, new ones
+// are added, and each operation's operationId, summary, description and
+// parameters are replaced. Everything else in base is kept. Keys come out
+// sorted, so the result only depends on base and apiRoutes.
+func generateSpec(base []byte) ([]byte, error) {
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(base))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	old, _ := doc["paths"].(map[string]any)
+	paths := map[string]any{}
+	for _, rt := range apiRoutes {
+		method := strings.ToLower(rt.Method)
+		item, _ := paths[rt.Path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[rt.Path] = item
+		}
+		oldItem, _ := old[rt.Path].(map[string]any)
+		op, _ := oldItem[method].(map[string]any)
+		if op == nil {
+			op = map[string]any{"responses": map[string]any{"200": map[string]any{"description": "OK"}}}
+		}
+		op["operationId"] = rt.OperationID
+		op["summary"] = rt.Summary
+		delete(op, "description")
+		if rt.Description != "" {
+			op["description"] = rt.Description
+		}
+		delete(op, "parameters")
+		if len(rt.Params) > 0 {
+			op["parameters"] = rt.Params
+		}
+		item[method] = op
+	}
+	doc["paths"] = paths
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gpu-metric-collector/api"
+	"gpu-metric-collector/internal/storage"
+)
+
+var updateSpec = flag.Bool("update", false, "rewrite api/openapi.json from apiRoutes")
+
+func TestOpenAPI_SpecMatchesRoutes(t *testing.T) {
+	// Scenario: regenerate the spec from apiRoutes over the embedded one
+	// Expect: nothing changes (with -update, the file is rewritten instead)
+	got, err := generateSpec(api.OpenAPI)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if *updateSpec {
+		if err := os.WriteFile("../../api/openapi.json", got, 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		return
+	}
+	if !bytes.Equal(got, api.OpenAPI) {
+		t.Fatalf("api/openapi.json is out of date with apiRoutes; run make openapi-gen")
+	}
+}
+
+func TestOpenAPI_RoutesAreConsistent(t *testing.T) {
+	// Scenario: every registered operation
+	// Expect: unique operation ids, one path param per {id} segment, no
+	// duplicate params, and no path left to the catch-all 404
+	srv := newServer(storage.NewMemoryStore())
+	ids := map[string]bool{}
+	for _, rt := range apiRoutes {
+		if ids[rt.OperationID] {
+			t.Fatalf("duplicate operationId %s", rt.OperationID)
+		}
+		ids[rt.OperationID] = true
+		seen := map[string]bool{}
+		paths := 0
+		for _, p := range rt.Params {
+			if seen[p.In+p.Name] || (p.In != "query" && p.In != "path") {
+				t.Fatalf("%s %s: bad param %+v", rt.Method, rt.Path, p)
+			}
+			seen[p.In+p.Name] = true
+			if p.In == "path" {
+				paths++
+			}
+		}
+		if n := len(regexp.MustCompile(`\{[a-z_]+\}`).FindAllString(rt.Path, -1)); n != paths {
+			t.Fatalf("%s %s: %d path params documented, %d in the path", rt.Method, rt.Path, paths, n)
+		}
+		// routes mounted in main (alerts, webhooks, admin, GPU info) are not part of newServer
+		if rt.Path == "/api/v1/alerts/rules" || rt.Path == "/api/v1/alerts/rules/{id}" || rt.Path == "/api/v1/alerts/firing" ||
+			strings.HasPrefix(rt.Path, "/api/v1/admin/") || strings.HasPrefix(rt.Path, "/api/v1/webhooks") || rt.Path == "/api/v1/gpus/{id}/info" {
+			continue
+		}
+		w := call(srv, regexp.MustCompile(`\{[a-z_]+\}`).ReplaceAllString(rt.Path, "x"))
+		var e apiError
+		if json.Unmarshal(w.Body.Bytes(), &e) == nil && e.Code == codeNotFound {
+			t.Fatalf("%s is not served", rt.Path)
+		}
+	}
+}
+
+func TestOpenAPI_Served(t *testing.T) {
+	// Scenario: GET /openapi.json
+	// Expect: the generated spec as JSON
+	w := call(newServer(storage.NewMemoryStore()), "/openapi.json")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" || !bytes.Equal(w.Body.Bytes(), openAPISpec) {
+		t.Fatalf("%d %s", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+const (
+	defaultPageLimit = 1000
+	maxPageLimit     = 10000
+)
+
+// telemetryPage is the response envelope for paged telemetry queries.
+type telemetryPage struct {
+	Items []model.Telemetry `json:"items"`
+	// Next is passed back as ?cursor= (with the same window and step) to get
+	// the following page; empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// cursor is the opaque position carried in telemetryPage.Next. A keyset
+// cursor resumes after the Skip items at timestamp T that were already
+// returned, so pages stay stable while new data arrives. A cursor from an
+// ?offset= request keeps counting from the window start instead.
+type cursor struct {
+	T    int64 `json:"t,omitempty"` // unix nanos of the last item returned
+	Skip int   `json:"s,omitempty"` // items at T already returned
+	Off  int   `json:"o,omitempty"` // offset-based cursor when T is zero
+	Desc bool  `json:"d,omitempty"`
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Skip < 0 || c.Off < 0 {
+		return nil, errors.New("invalid cursor")
+	}
+	return &c, nil
+}
+
+// pageRequest holds the paging query params; nil from parsePage means none
+// were given and the response stays a bare array.
+type pageRequest struct {
+	limit  int
+	offset int
+	desc   bool
+	cursor *cursor
+}
+
+func parsePage(v url.Values) (*pageRequest, error) {
+	if pLimit.get(v) == "" && pCursor.get(v) == "" && pOffset.get(v) == "" && pOrder.get(v) == "" {
+		return nil, nil
+	}
+	p := &pageRequest{limit: defaultPageLimit}
+	if s := pLimit.get(v); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return nil, errors.New("invalid limit (want 1.." + strconv.Itoa(maxPageLimit) + ")")
+		}
+		p.limit = n
+	}
+	switch pOrder.get(v) {
+	case "", "asc":
+	case "desc":
+		p.desc = true
+	default:
+		return nil, errors.New("invalid order (want asc or desc)")
+	}
+	if s := pOffset.get(v); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid offset")
+		}
+		p.offset = n
+	}
+	if s := pCursor.get(v); s != "" {
+		if pOffset.get(v) != "" {
+			return nil, errors.New("cursor and offset are mutually exclusive")
+		}
+		c, err := decodeCursor(s)
+		if err != nil {
+			return nil, err
+		}
+		if pOrder.get(v) != "" && c.Desc != p.desc {
+			return nil, errors.New("order does not match cursor")
+		}
+		p.desc, p.cursor = c.Desc, c
+	}
+	return p, nil
+}
+
+// apply narrows q's window to resume after the cursor and asks for one item
+// more than the limit, to learn whether another page follows.
+func (p *pageRequest) apply(q *storage.Query) {
+	q.Desc, q.Offset, q.Limit = p.desc, p.offset, p.limit+1
+	c := p.cursor
+	if c == nil {
+		return
+	}
+	if c.T == 0 {
+		q.Offset = c.Off
+		return
+	}
+	t := time.Unix(0, c.T).UTC()
+	if p.desc {
+		if q.End == nil || t.Before(*q.End) {
+			q.End = &t
+		}
+	} else if q.Start == nil || t.After(*q.Start) {
+		q.Start = &t
+	}
+	q.Offset = c.Skip
+}
+
+// finish trims the extra item fetched by query and returns the page with its
+// next cursor.
+func (p *pageRequest) finish(items []model.Telemetry) telemetryPage {
+	if items == nil {
+		items = []model.Telemetry{}
+	}
+	if len(items) <= p.limit {
+		return telemetryPage{Items: items}
+	}
+	items = items[:p.limit]
+	if (p.cursor == nil && p.offset > 0) || (p.cursor != nil && p.cursor.T == 0) {
+		off := p.offset
+		if p.cursor != nil {
+			off = p.cursor.Off
+		}
+		return telemetryPage{Items: items, Next: cursor{Off: off + p.limit, Desc: p.desc}.encode()}
+	}
+	last := items[len(items)-1].Timestamp
+	next := cursor{T: last.UnixNano(), Desc: p.desc}
+	for _, it := range items {
+		if it.Timestamp.Equal(last) {
+			next.Skip++
+		}
+	}
+	// the whole page sat on the cursor's timestamp: keep counting from it
+	if c := p.cursor; c != nil && c.T == next.T {
+		next.Skip += c.Skip
+	}
+	return telemetryPage{Items: items, Next: next.encode()}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// promMaxAge hides GPUs whose latest point is older, so a GPU that stopped
+// reporting disappears from scrapes (absent() alerts) instead of freezing.
+var promMaxAge = 5 * time.Minute
+
+// promHandler exposes each GPU's latest point in the Prometheus text format:
+// one gauge per metric, labelled gpu_id, host_id and the point's labels, and
+// gpu_telemetry_last_timestamp_seconds for freshness.
+func promHandler(store storage.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(&latestCollector{store: storeFor(r.Context(), store), maxAge: promMaxAge, now: time.Now})
+		promhttp.HandlerFor(reg, promhttp.HandlerOpts{ErrorHandling: promhttp.HTTPErrorOnError}).ServeHTTP(w, r)
+	})
+}
+
+// latestCollector is an unchecked collector: its families depend on which
+// metrics the fleet reports.
+type latestCollector struct {
+	store  storage.Store
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+func (c *latestCollector) Describe(chan<- *prometheus.Desc) {}
+
+var promLastTimestamp = prometheus.NewDesc("gpu_telemetry_last_timestamp_seconds",
+	"Unix time of the GPU's latest telemetry point.", []string{"gpu_id", "host_id"}, nil)
+
+func (c *latestCollector) Collect(ch chan<- prometheus.Metric) {
+	points, err := c.latest()
+	if err != nil {
+		log.Printf("api: prom latest error: %v", err)
+		ch <- prometheus.NewInvalidMetric(promLastTimestamp, err)
+		return
+	}
+
+	// A family's label names must be the same for every GPU, so each one gets
+	// the union of the label keys seen with it; GPUs without a key get "".
+	type family struct {
+		metric string
+		labels []string
+	}
+	families := map[string]*family{}
+	for _, p := range points {
+		for m := range p.Metrics {
+			name := promName(m)
+			f := families[name]
+			if f == nil {
+				f = &family{metric: m}
+				families[name] = f
+			}
+			if f.metric != m {
+				if m < f.metric { // two metrics map to one name: keep the first by name
+					*f = family{metric: m}
+				} else {
+					continue
+				}
+			}
+			for k := range p.Labels {
+				if l := promLabel(k); l != "" && !slices.Contains(f.labels, l) {
+					f.labels = append(f.labels, l)
+				}
+			}
+		}
+	}
+
+	for _, p := range points {
+		ch <- prometheus.MustNewConstMetric(promLastTimestamp, prometheus.GaugeValue,
+			float64(p.Timestamp.UnixNano())/1e9, p.GPUId, p.HostId)
+	}
+	for name, f := range families {
+		sort.Strings(f.labels)
+		desc := prometheus.NewDesc(name, "Latest value of "+f.metric+" per GPU.", append([]string{"gpu_id", "host_id"}, f.labels...), nil)
+		for _, p := range points {
+			v, ok := p.Metrics[f.metric]
+			if !ok {
+				continue
+			}
+			values := []string{p.GPUId, p.HostId}
+			for _, l := range f.labels {
+				values = append(values, promLabelValue(p.Labels, l))
+			}
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, values...)
+		}
+	}
+}
+
+// latest returns the latest point of every GPU that reported within maxAge.
+func (c *latestCollector) latest() ([]model.Telemetry, error) {
+	ids, err := c.store.ListGPUs()
+	if err != nil {
+		return nil, err
+	}
+	byGPU, err := storage.LatestMany(c.store, ids, nil)
+	cutoff := c.now().Add(-c.maxAge)
+	var out []model.Telemetry
+	for _, it := range byGPU {
+		if c.maxAge <= 0 || !it.Timestamp.Before(cutoff) {
+			out = append(out, *it)
+		}
+	}
+	return out, err
+}
+
+// promName maps a metric name to a valid Prometheus metric name.
+func promName(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+		case r >= '0' && r <= '9' && i > 0:
+		case r >= '0' && r <= '9':
+			b.WriteByte('_')
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// promLabel maps a telemetry label key to a Prometheus label name, or "" for
+// keys that would clash with gpu_id/host_id or reserved names.
+func promLabel(k string) string {
+	l := strings.ReplaceAll(promName(k), ":", "_")
+	if l == "gpu_id" || l == "host_id" || strings.HasPrefix(l, "__") {
+		return ""
+	}
+	return l
+}
+
+// promLabelValue returns the value of the label whose key maps to l.
+func promLabelValue(labels map[string]string, l string) string {
+	if v, ok := labels[l]; ok {
+		return v
+	}
+	for k, v := range labels {
+		if promLabel(k) == l {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateRule is a token bucket: Rate requests per second on average, bursts
+// of up to Burst. A zero Rate means unlimited.
+type rateRule struct {
+	Rate  float64
+	Burst float64
+}
+
+type routeRule struct {
+	prefix string
+	rateRule
+}
+
+// rateLimiter throttles protected routes per client, keyed by the caller's
+// identity when authenticated and by IP otherwise. Each route prefix with
+// its own rule has separate buckets; other routes share the global rule.
+type rateLimiter struct {
+	global       rateRule
+	routes       []routeRule // longest prefix first
+	clientHeader string      // header carrying the client IP behind a proxy
+	now          func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// bucketIdle is how long an unused bucket is kept; by then it is full anyway.
+const bucketIdle = 10 * time.Minute
+
+func newRateLimiter(global rateRule, routes []routeRule, clientHeader string) *rateLimiter {
+	sort.SliceStable(routes, func(i, j int) bool { return len(routes[i].prefix) > len(routes[j].prefix) })
+	return &rateLimiter{global: global, routes: routes, clientHeader: clientHeader, now: time.Now, buckets: map[string]*bucket{}}
+}
+
+// parseRouteLimits parses "prefix=rate:burst,..." (burst defaults to rate),
+// e.g. "/api/v1/telemetry=2:10,/graphql=5".
+func parseRouteLimits(s string) ([]routeRule, error) {
+	var out []routeRule
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		prefix, spec, ok := strings.Cut(part, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("invalid route limit %q (want /prefix=rate[:burst])", part)
+		}
+		rs, bs, hasBurst := strings.Cut(spec, ":")
+		rate, err := strconv.ParseFloat(rs, 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid rate in %q", part)
+		}
+		burst := math.Max(rate, 1)
+		if hasBurst {
+			if burst, err = strconv.ParseFloat(bs, 64); err != nil || burst < 1 {
+				return nil, fmt.Errorf("invalid burst in %q", part)
+			}
+		}
+		out = append(out, routeRule{prefix: prefix, rateRule: rateRule{Rate: rate, Burst: burst}})
+	}
+	return out, nil
+}
+
+// enabled reports whether any rule limits anything.
+func (l *rateLimiter) enabled() bool {
+	if l.global.Rate > 0 {
+		return true
+	}
+	for _, r := range l.routes {
+		if r.Rate > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *rateLimiter) rule(path string) (string, rateRule) {
+	for _, r := range l.routes {
+		if strings.HasPrefix(path, r.prefix) {
+			return r.prefix, r.rateRule
+		}
+	}
+	return "", l.global
+}
+
+// client names the caller for bucketing.
+func (l *rateLimiter) client(r *http.Request) string {
+	if id := identityFrom(r.Context()); id != nil {
+		return id.Method + ":" + id.Subject
+	}
+	if l.clientHeader != "" {
+		if v := r.Header.Get(l.clientHeader); v != "" {
+			first, _, _ := strings.Cut(v, ",")
+			return "ip:" + strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// allow takes a token from key's bucket, or reports how long until one is
+// available.
+func (l *rateLimiter) allow(key string, rule rateRule) (bool, time.Duration) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > bucketIdle {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > bucketIdle {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: rule.Burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(rule.Burst, b.tokens+now.Sub(b.last).Seconds()*rule.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rule.Rate * float64(time.Second))
+}
+
+func (l *rateLimiter) wrap(next http.Handler) http.Handler {
+	if !l.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !protectedPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		prefix, rule := l.rule(r.URL.Path)
+		if rule.Rate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok, wait := l.allow(l.client(r)+"|"+prefix, rule); !ok {
+			retry := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retry))
+			writeErrorDetails(w, r, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded", map[string]any{"retry_after_seconds": retry})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
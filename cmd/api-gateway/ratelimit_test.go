@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimit_PerClientAndRoute(t *testing.T) {
+	// Scenario: global 1 rps burst 2, /api/v1/telemetry at 1 rps burst 1; two clients by IP header
+	// Expect: 429 with Retry-After once a bucket is empty, clients and routes independent, refill over time
+	routes, err := parseRouteLimits("/api/v1/telemetry=1:1")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	l := newRateLimiter(rateRule{Rate: 1, Burst: 2}, routes, "X-Forwarded-For")
+	now := time.Unix(1_700_000_000, 0)
+	l.now = func() time.Time { return now }
+	h := l.wrap(whoami)
+
+	for i := 0; i < 2; i++ {
+		if w := call(h, "/api/v1/gpus", "X-Forwarded-For", "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d within burst: %d", i, w.Code)
+		}
+	}
+	w := call(h, "/api/v1/gpus", "X-Forwarded-For", "10.0.0.1, 10.9.9.9")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected 429 with Retry-After 1, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := call(h, "/api/v1/gpus", "X-Forwarded-For", "10.0.0.2"); w.Code != http.StatusOK {
+		t.Fatalf("other client: %d", w.Code)
+	}
+	if w := call(h, "/api/v1/telemetry", "X-Forwarded-For", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("route bucket: %d", w.Code)
+	}
+	if w := call(h, "/api/v1/telemetry", "X-Forwarded-For", "10.0.0.1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("route burst of 1: %d", w.Code)
+	}
+	if w := call(h, "/healthz", "X-Forwarded-For", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("open path limited: %d", w.Code)
+	}
+	now = now.Add(time.Second)
+	if w := call(h, "/api/v1/gpus", "X-Forwarded-For", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("after refill: %d", w.Code)
+	}
+
+	for _, bad := range []string{"api/v1=1", "/x=abc", "/x=1:0", "/x"} {
+		if _, err := parseRouteLimits(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
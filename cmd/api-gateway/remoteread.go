@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/api/gen/prompb"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxRemoteReadBody bounds the compressed request; queries are small.
+const maxRemoteReadBody = 1 << 20
+
+// maxRemoteReadSamples bounds one request so a wide query cannot exhaust
+// the gateway; Prometheus reports the error to the querier. The store is
+// asked for no more points than are left of it. A variable so tests can
+// lower it.
+var maxRemoteReadSamples = 5_000_000
+
+// remoteReadHandler serves the Prometheus remote_read protocol (SAMPLES
+// responses). Series use the /api/v1/prom names and labels, so the same
+// PromQL works on scraped and historical data.
+func remoteReadHandler(store storage.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, r)
+			return
+		}
+		compressed, err := io.ReadAll(io.LimitReader(r.Body, maxRemoteReadBody+1))
+		if err != nil || len(compressed) > maxRemoteReadBody {
+			writeError(w, r, http.StatusBadRequest, codeInvalidBody, "request body unreadable or too large")
+			return
+		}
+		raw, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidBody, "snappy: "+err.Error())
+			return
+		}
+		var req prompb.ReadRequest
+		if err := proto.Unmarshal(raw, &req); err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidBody, "decode read request: "+err.Error())
+			return
+		}
+		if types := req.GetAcceptedResponseTypes(); len(types) > 0 {
+			ok := false
+			for _, t := range types {
+				ok = ok || t == prompb.ReadRequest_SAMPLES
+			}
+			if !ok {
+				writeError(w, r, http.StatusBadRequest, codeInvalidParameter, "only SAMPLES responses are supported")
+				return
+			}
+		}
+
+		store := storeFor(r.Context(), store)
+		resp := &prompb.ReadResponse{}
+		budget := maxRemoteReadSamples
+		for _, q := range req.GetQueries() {
+			res, err := remoteReadQuery(store, q, &budget)
+			if err != nil {
+				var badQuery *remoteReadError
+				if errors.As(err, &badQuery) {
+					writeError(w, r, http.StatusBadRequest, codeQueryRejected, err.Error())
+					return
+				}
+				writeStoreError(w, r, err, "remote read error")
+				return
+			}
+			resp.Results = append(resp.Results, res)
+		}
+		out, err := proto.Marshal(resp)
+		if err != nil {
+			logRequestf(r, "remote read encode: %v", err)
+			writeError(w, r, http.StatusInternalServerError, codeInternal, "internal error")
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Header().Set("Content-Encoding", "snappy")
+		_, _ = w.Write(snappy.Encode(nil, out))
+	})
+}
+
+// remoteReadError is a problem with the query rather than the store.
+type remoteReadError struct{ msg string }
+
+func (e *remoteReadError) Error() string { return e.msg }
+
+func errRemoteReadSamples() error {
+	return &remoteReadError{fmt.Sprintf("query selects more than %d samples; narrow the window or matchers", maxRemoteReadSamples)}
+}
+
+// promMatcher is a compiled LabelMatcher.
+type promMatcher struct {
+	name  string
+	typ   prompb.LabelMatcher_Type
+	value string
+	re    *regexp.Regexp
+}
+
+func (m *promMatcher) matches(v string) bool {
+	switch m.typ {
+	case prompb.LabelMatcher_EQ:
+		return v == m.value
+	case prompb.LabelMatcher_NEQ:
+		return v != m.value
+	case prompb.LabelMatcher_RE:
+		return m.re.MatchString(v)
+	default:
+		return !m.re.MatchString(v)
+	}
+}
+
+// remoteReadQuery answers one query. Equality matchers on gpu_id and
+// host_id, and on __name__ when only the stored metric of that name is
+// exposed under it, are pushed into the store query; every matcher is then
+// checked against each series. The store query is limited to the budget left,
+// as every point loaded holds at least one sample.
+func remoteReadQuery(store storage.Store, q *prompb.Query, budget *int) (*prompb.QueryResult, error) {
+	start := time.UnixMilli(q.GetStartTimestampMs()).UTC()
+	end := time.UnixMilli(q.GetEndTimestampMs()).UTC()
+	sq := storage.Query{Start: &start, End: &end}
+	var gpuIDs []string
+	var matchers []*promMatcher
+	for _, lm := range q.GetMatchers() {
+		m := &promMatcher{name: lm.GetName(), typ: lm.GetType(), value: lm.GetValue()}
+		if m.typ == prompb.LabelMatcher_RE || m.typ == prompb.LabelMatcher_NRE {
+			re, err := regexp.Compile("^(?:" + m.value + ")$")
+			if err != nil {
+				return nil, &remoteReadError{fmt.Sprintf("matcher %s: %v", m.name, err)}
+			}
+			m.re = re
+		}
+		if m.typ == prompb.LabelMatcher_EQ && m.value != "" {
+			switch m.name {
+			case "__name__":
+				// series are named promName(metric), which turns invalid
+				// characters into '_': gpu_temp may be stored as gpu.temp
+				if !strings.Contains(m.value, "_") {
+					sq.Metrics = []string{m.value}
+				}
+			case "gpu_id":
+				gpuIDs = []string{m.value}
+			case "host_id":
+				sq.HostIDs = []string{m.value}
+			}
+		}
+		matchers = append(matchers, m)
+	}
+
+	sq.Limit = *budget + 1
+	items, err := storage.ExecuteFleet(store, gpuIDs, sq)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > *budget {
+		return nil, errRemoteReadSamples()
+	}
+	series := map[string]*prompb.TimeSeries{}
+	for _, it := range items { // time-ordered
+		for metric, v := range it.Metrics {
+			labels := promSeriesLabels(metric, it)
+			if !matchAll(matchers, labels) {
+				continue
+			}
+			key := promSeriesKey(labels)
+			ts := series[key]
+			if ts == nil {
+				ts = &prompb.TimeSeries{Labels: labels}
+				series[key] = ts
+			}
+			if *budget--; *budget < 0 {
+				return nil, errRemoteReadSamples()
+			}
+			ts.Samples = append(ts.Samples, &prompb.Sample{Value: v, Timestamp: it.Timestamp.UnixMilli()})
+		}
+	}
+	keys := make([]string, 0, len(series))
+	for k := range series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := &prompb.QueryResult{}
+	for _, k := range keys {
+		res.Timeseries = append(res.Timeseries, series[k])
+	}
+	return res, nil
+}
+
+// promSeriesLabels builds the sorted label set of metric in it, matching the
+// /api/v1/prom exposition.
+func promSeriesLabels(metric string, it model.Telemetry) []*prompb.Label {
+	labels := []*prompb.Label{
+		{Name: "__name__", Value: promName(metric)},
+		{Name: "gpu_id", Value: it.GPUId},
+	}
+	if it.HostId != "" {
+		labels = append(labels, &prompb.Label{Name: "host_id", Value: it.HostId})
+	}
+	for k, v := range it.Labels {
+		if l := promLabel(k); l != "" && v != "" {
+			labels = append(labels, &prompb.Label{Name: l, Value: v})
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels
+}
+
+// matchAll applies PromQL semantics: a missing label has the empty value.
+func matchAll(matchers []*promMatcher, labels []*prompb.Label) bool {
+	for _, m := range matchers {
+		v := ""
+		for _, l := range labels {
+			if l.Name == m.name {
+				v = l.Value
+				break
+			}
+		}
+		if !m.matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func promSeriesKey(labels []*prompb.Label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.Name)
+		b.WriteByte(0)
+		b.WriteString(l.Value)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gpu-metric-collector/internal/expr"
+	"gpu-metric-collector/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricRetentionDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "gateway", Name: "retention_deleted_total", Help: "Points deleted by the retention job, by target (metric values for target:metric rules); InfluxDB does not report counts, so its targets stay at 0.",
+	}, []string{"target"})
+	metricRetentionErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "gateway", Name: "retention_errors_total", Help: "Retention deletions that failed, by target.",
+	}, []string{"target"})
+)
+
+// retentionRule keeps the points of a target (an InfluxDB measurement, or
+// the telemetry table of a store) for MaxAge, or with Metrics only those
+// metrics of its points.
+type retentionRule struct {
+	Target  string
+	MaxAge  time.Duration
+	Metrics []string
+}
+
+// name is the rule as written before its age, e.g. "telemetry:sm_clock".
+func (r retentionRule) name() string {
+	if len(r.Metrics) == 0 {
+		return r.Target
+	}
+	return r.Target + ":" + strings.Join(r.Metrics, "|")
+}
+
+// parseRetention parses -retention, e.g. "telemetry=30d,recent=2h", where a
+// target may be narrowed to metrics, e.g. "telemetry:sm_clock|mem_clock=7d".
+// A metric rule must keep its metrics for less time than the rule of its
+// whole target, which would otherwise delete them first.
+func parseRetention(s string) ([]retentionRule, error) {
+	var out []retentionRule
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, age, ok := strings.Cut(part, "=")
+		target, metrics, narrowed := strings.Cut(strings.TrimSpace(key), ":")
+		target = strings.TrimSpace(target)
+		if !ok || target == "" {
+			return nil, fmt.Errorf("invalid retention rule %q (want target=max_age or target:metric|metric=max_age)", part)
+		}
+		r := retentionRule{Target: target}
+		if narrowed {
+			for _, m := range strings.Split(metrics, "|") {
+				if m = strings.TrimSpace(m); m == "" {
+					return nil, fmt.Errorf("invalid retention rule %q: empty metric name", part)
+				}
+				if seen[target+":"+m] {
+					return nil, fmt.Errorf("retention for metric %q of %q set twice", m, target)
+				}
+				seen[target+":"+m] = true
+				r.Metrics = append(r.Metrics, m)
+			}
+		} else if seen[target] {
+			return nil, fmt.Errorf("retention for %q set twice", target)
+		} else {
+			seen[target] = true
+		}
+		d, err := expr.ParseDuration(strings.TrimSpace(age))
+		if err != nil {
+			return nil, fmt.Errorf("retention for %q: %w", r.name(), err)
+		}
+		r.MaxAge = d
+		out = append(out, r)
+	}
+	whole := map[string]time.Duration{}
+	for _, r := range out {
+		if len(r.Metrics) == 0 {
+			whole[r.Target] = r.MaxAge
+		}
+	}
+	for _, r := range out {
+		if keep, ok := whole[r.Target]; ok && len(r.Metrics) > 0 && r.MaxAge >= keep {
+			return nil, fmt.Errorf("retention for %q: %s is not shorter than the %s kept of all of %q", r.name(), r.MaxAge, keep, r.Target)
+		}
+	}
+	return out, nil
+}
+
+// retentionResult is what one pass did to one target, or to the metrics of
+// a metric rule. Deleted counts points, or metric values for a metric rule;
+// it is absent when the store cannot count, or the deletion failed.
+type retentionResult struct {
+	Target  string    `json:"target"`
+	Metrics []string  `json:"metrics,omitempty"`
+	Before  time.Time `json:"before"`
+	Deleted *int64    `json:"deleted,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// retentionJob deletes the points of each rule's target older than its
+// max age, every interval and when an admin asks for it.
+type retentionJob struct {
+	rules   []retentionRule
+	targets map[string]storage.Store
+	mu      sync.Mutex // one pass at a time
+}
+
+// newRetentionJob resolves each rule's target with open, which fails for
+// targets the gateway does not know.
+func newRetentionJob(rules []retentionRule, open func(target string) (storage.Store, error)) (*retentionJob, error) {
+	j := &retentionJob{rules: rules, targets: map[string]storage.Store{}}
+	for _, r := range rules {
+		s, err := open(r.Target)
+		if err != nil {
+			return nil, fmt.Errorf("retention target %q: %w", r.Target, err)
+		}
+		if _, ok := s.(storage.Deleter); !ok {
+			return nil, fmt.Errorf("retention target %q: the store cannot delete telemetry", r.Target)
+		}
+		if _, ok := s.(storage.MetricDeleter); len(r.Metrics) > 0 && !ok {
+			return nil, fmt.Errorf("retention target %q: the store cannot delete single metrics", r.Target)
+		}
+		j.targets[r.Target] = s
+	}
+	return j, nil
+}
+
+// Run prunes every interval until ctx is done.
+func (j *retentionJob) Run(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			j.Prune(ctx, now)
+		}
+	}
+}
+
+// Prune deletes what each rule no longer keeps at now. A failed target is
+// reported and logged; the others are still pruned.
+func (j *retentionJob) Prune(ctx context.Context, now time.Time) []retentionResult {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make([]retentionResult, 0, len(j.rules))
+	for _, r := range j.rules {
+		res := retentionResult{Target: r.Target, Metrics: r.Metrics, Before: now.Add(-r.MaxAge).UTC()}
+		s := storage.WithContext(ctx, j.targets[r.Target])
+		if _, ok := s.(storage.Deleter); !ok { // only a bound copy could lose it
+			s = j.targets[r.Target]
+		}
+		var (
+			n    int64
+			err  error
+			what = "points"
+		)
+		if len(r.Metrics) > 0 {
+			d, ok := s.(storage.MetricDeleter)
+			if !ok {
+				d = j.targets[r.Target].(storage.MetricDeleter)
+			}
+			n, err = d.DeleteMetrics("", r.Metrics, res.Before)
+			what = "values"
+		} else {
+			n, err = s.(storage.Deleter).DeleteTelemetry("", res.Before)
+		}
+		switch name := r.name(); {
+		case err != nil:
+			metricRetentionErrors.WithLabelValues(name).Inc()
+			res.Error = err.Error()
+			log.Printf("retention: %s before %v: %v", name, res.Before, err)
+		case n >= 0:
+			metricRetentionDeleted.WithLabelValues(name).Add(float64(n))
+			res.Deleted = &n
+			log.Printf("retention: %s deleted %d %s before %v", name, n, what, res.Before)
+		default:
+			log.Printf("retention: %s deleted %s before %v", name, what, res.Before)
+		}
+		out = append(out, res)
+	}
+	return out
+}
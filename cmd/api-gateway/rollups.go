@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gpu-metric-collector/internal/rollup"
+	"gpu-metric-collector/internal/storage"
+)
+
+// parseRollupTiers parses -rollup_tiers, e.g. "1m,1h", into ascending steps
+// of whole seconds.
+func parseRollupTiers(s string) ([]time.Duration, error) {
+	var out []time.Duration
+	seen := map[time.Duration]bool{}
+	for _, f := range parseList(s) {
+		d, err := time.ParseDuration(f)
+		if err != nil || d < time.Second || d%time.Second != 0 {
+			return nil, fmt.Errorf("invalid tier %q (want a duration of whole seconds, e.g. 1m)", f)
+		}
+		if seen[d] {
+			return nil, fmt.Errorf("tier %s listed twice", f)
+		}
+		seen[d] = true
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
+
+// rollupMeasurement names the measurement holding the rollups of step. It
+// does not start with the raw measurement's "telemetry_", which
+// VictoriaMetrics would read as raw metrics.
+func rollupMeasurement(step time.Duration) string {
+	return "rollup_mean_" + rollup.Name(step)
+}
+
+// runRollups refreshes the rollups every interval until ctx is done. A
+// failed refresh is logged and picked up by the next one.
+func runRollups(ctx context.Context, rs *storage.RollupStore, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		if err := rs.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("api-gateway: rollups: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRollupTiers(t *testing.T) {
+	// Scenario: a valid tier list out of order and malformed ones
+	// Expect: ascending steps; errors for a bad duration, a step under 1s
+	// or not whole seconds, and a step listed twice
+	got, err := parseRollupTiers(" 1h, 1m ")
+	if err != nil || !reflect.DeepEqual(got, []time.Duration{time.Minute, time.Hour}) {
+		t.Fatalf("got %v %v", got, err)
+	}
+	for _, s := range []string{"soon", "500ms", "1500ms", "1m,60s"} {
+		if _, err := parseRollupTiers(s); err == nil {
+			t.Fatalf("%q: no error", s)
+		}
+	}
+	if m := rollupMeasurement(time.Hour); m != "rollup_mean_1h" {
+		t.Fatalf("measurement: %s", m)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import "net/url"
+
+// param is a query or path parameter of an API operation. Handlers read
+// query params through these definitions, so the spec documents exactly
+// the names they parse.
+type param struct {
+	Name        string      `json:"name"`
+	In          string      `json:"in"`
+	Required    bool        `json:"required"`
+	Schema      paramSchema `json:"schema"`
+	Description string      `json:"description"`
+}
+
+type paramSchema struct {
+	Type    string   `json:"type"`
+	Format  string   `json:"format,omitempty"`
+	Enum    []string `json:"enum,omitempty"`
+	Default any      `json:"default,omitempty"`
+	Minimum any      `json:"minimum,omitempty"`
+	Maximum any      `json:"maximum,omitempty"`
+	Example string   `json:"example,omitempty"`
+}
+
+func (p param) get(v url.Values) string { return v.Get(p.Name) }
+
+func queryParam(name, typ, desc string) param {
+	return param{Name: name, In: "query", Schema: paramSchema{Type: typ}, Description: desc}
+}
+
+func pathParam(desc string) param {
+	return param{Name: "id", In: "path", Required: true, Schema: paramSchema{Type: "string"}, Description: desc}
+}
+
+func (p param) required() param              { p.Required = true; return p }
+func (p param) format(f string) param        { p.Schema.Format = f; return p }
+func (p param) enum(values ...string) param  { p.Schema.Enum = values; return p }
+func (p param) def(v any) param              { p.Schema.Default = v; return p }
+func (p param) between(min, max any) param   { p.Schema.Minimum, p.Schema.Maximum = min, max; return p }
+func (p param) example(example string) param { p.Schema.Example = example; return p }
+
+// Telemetry window, downsampling, metric and attribution filters and paging
+// (parseQuery).
+var (
+	pStartTime = queryParam("start_time", "string", "Start time (inclusive): RFC3339, now, or relative to now such as -1h or now-2d").example("-1h")
+	pEndTime   = queryParam("end_time", "string", "End time (inclusive): RFC3339, now, or relative to now such as -5m").example("now")
+	pStart     = queryParam("start", "string", "Alias for start_time")
+	pEnd       = queryParam("end", "string", "Alias for end_time")
+	pMetrics   = queryParam("metrics", "string", "Comma-separated metric or typed value names to return; points with none of them are omitted").example("DCGM_FI_DEV_GPU_TEMP,DCGM_FI_DEV_POWER_USAGE")
+	pMetric    = queryParam("metric", "string", "Alias for metrics")
+	pProducers = queryParam("producer_id", "string", "Comma-separated producer identifiers; only points from these producers are returned").example("streamer-1")
+	pLabels    = queryParam("labels", "string", "Comma-separated name=value label matchers; only points carrying all of them are returned").example("cluster=c1,rack=r2")
+	pStep      = queryParam("step", "string", "Downsample to one point per bucket of this duration (at least 1s), with the mean of each metric. Buckets are aligned to the Unix epoch; host_id, producer_id and labels are omitted.").example("5m")
+	pInterval  = queryParam("interval", "string", "Alias for step")
+	pLimit     = queryParam("limit", "integer", "Page size. Any paging parameter switches the response to a TelemetryPage envelope.").def(defaultPageLimit).between(1, maxPageLimit)
+	pOrder     = queryParam("order", "string", "Time order of the results").enum("asc", "desc").def("asc")
+	pOffset    = queryParam("offset", "integer", "Items to skip from the start of the window (not with cursor)").between(0, nil)
+	pFields    = queryParam("fields", "string", "Comma-separated item fields to return: timestamp, gpu_id, host_id, producer_id, metrics, labels, values, or metrics.<name> for one metric; default all").example("timestamp,metrics.DCGM_FI_DEV_GPU_TEMP")
+	pCursor    = queryParam("cursor", "string", "The next value of the previous page; repeat the same window and step")
+)
+
+var (
+	pFormat = queryParam("format", "string", "File format. Columns are timestamp, gpu_id, host_id and one per metric; a missing metric is an empty cell (CSV) or null (Parquet).").enum(exportCSV, exportParquet).def(exportCSV)
+
+	pGPUIDs     = queryParam("gpu_ids", "string", "Comma-separated GPU identifiers (at most 1000). gpu_ids or host_id is required.").example("0,1,2")
+	pHostIDs    = queryParam("host_id", "string", "Comma-separated host identifiers; only points reported from these hosts are returned").example("node-1")
+	pFleetOrder = queryParam("order", "string", "Time order of the results; equal timestamps are ordered by gpu_id").enum("asc", "desc").def("asc")
+
+	pTopMetric = queryParam("metric", "string", "Metric to rank by").required().example("DCGM_FI_DEV_GPU_TEMP")
+	pTopN      = queryParam("n", "integer", "Number of GPUs to return").def(defaultTopN).between(1, maxTopN)
+	pTopWindow = queryParam("window", "string", "Look-back duration ending now (at least 1s)").def("5m")
+	pTopAgg    = queryParam("agg", "string", "Per-GPU aggregation over the window").enum("avg", "max", "min", "last").def("avg")
+	pTopOrder  = queryParam("order", "string", "desc ranks highest first; ties are ordered by gpu_id").enum("desc", "asc").def("desc")
+
+	pDerivedMetric = queryParam("metric", "string", "energy_wh integrates power draw over the window (gaps over 5m are skipped); util_per_watt is mean utilization over mean power draw").required().enum(derivedEnergy, derivedUtilPerWatt)
+	pDerivedWindow = queryParam("window", "string", "Look-back duration ending now (at least 1s)").def("24h")
+
+	pSummaryWindow  = queryParam("window", "string", "Look-back duration ending now (at least 1s)").def("24h")
+	pSummaryMetrics = queryParam("metrics", "string", "Comma-separated metrics to summarize (alias metric; default all)")
+
+	pListMetrics = queryParam("metrics", "string", "Comma-separated metrics to list (alias metric; default all)")
+
+	pAggregateMetric = queryParam("metric", "string", "Metric to aggregate").required().example("DCGM_FI_DEV_GPU_TEMP")
+	pAggregateAgg    = queryParam("agg", "string", "Aggregation per bucket").enum("avg", "max", "min", "last").def("avg")
+	pAggregateStep   = queryParam("step", "string", "Bucket width (at least 1s); buckets are aligned to the Unix epoch").def("1m")
+	pAggregateWindow = queryParam("window", "string", "Look-back duration ending now (at least 1s), at most 10000 steps").def("1h")
+
+	pCompareGPUs   = queryParam("gpu_ids", "string", "Comma-separated GPU identifiers (at most 50)").required().example("0,1,2")
+	pCompareMetric = queryParam("metric", "string", "Metric to compare").required().example("DCGM_FI_DEV_GPU_TEMP")
+	pCompareWindow = queryParam("window", "string", "Look-back duration ending now (at least 1s)").def("1h")
+	pCompareStep   = queryParam("step", "string", "Bucket size (at least 1s, at most 11000 buckets per window); buckets are aligned to the Unix epoch").def("1m")
+
+	pStaleAfter    = queryParam("stale_after", "string", "A GPU without data for longer than this is stale (Go duration, at least 1s)").def("5m")
+	pStatusMetrics = queryParam("metrics", "string", "Comma-separated metrics to include (alias metric; default all)")
+
+	pExpr      = queryParam("expr", "string", `Expression, e.g. avg_over_time(temp{gpu_id="gpu-1"}[1h])`).required()
+	pExprTime  = queryParam("time", "string", "Evaluation time for an instant query (RFC3339 or relative to now such as -1h, default now)")
+	pExprStart = queryParam("start_time", "string", "Start of a range query (RFC3339 or relative to now such as -1h)")
+	pExprEnd   = queryParam("end_time", "string", "End of a range query (RFC3339 or relative to now, default now)")
+	pExprStep  = queryParam("step", "string", "Range query step, e.g. 1m (at least 1s, at most 11000 steps)")
+
+	pAlertState = queryParam("state", "string", "pending lists series still waiting out the rule's for duration").enum("firing", "pending", "all").def("firing")
+
+	pStreamGPUs    = queryParam("gpu_id", "string", "Comma-separated GPU identifiers (at most 100)").required().example("0,1")
+	pStreamMetrics = queryParam("metrics", "string", "Comma-separated metric names to include")
+
+	pDeleteBefore = queryParam("before", "string", "Delete points older than this (RFC3339 or relative to now such as -30d); all points of gpu_id if absent")
+	pDeleteGPU    = queryParam("gpu_id", "string", "Only this GPU; every GPU if absent")
+)
+
+// apiRoute is one operation of the API. apiRoutes is the source of the
+// operations, summaries and parameters in api/openapi.json; responses,
+// request bodies and schemas are written in the spec itself.
+type apiRoute struct {
+	Method      string
+	Path        string
+	OperationID string
+	Summary     string
+	Description string
+	Params      []param
+}
+
+var telemetryParams = []param{pStartTime, pEndTime, pStart, pEnd, pMetrics, pMetric, pProducers, pLabels, pStep, pInterval}
+
+var apiRoutes = []apiRoute{
+	{Method: "GET", Path: "/api/v1/gpus", OperationID: "listGpus", Summary: "List all GPUs"},
+	{Method: "GET", Path: "/api/v1/hosts", OperationID: "listHosts", Summary: "List hosts",
+		Description: "GPUs grouped by the host_id of their latest point. GPUs without a host_id are left out."},
+	{Method: "GET", Path: "/api/v1/hosts/{id}/gpus", OperationID: "listHostGPUs", Summary: "List a host's GPUs",
+		Params: []param{pathParam("Host ID")}},
+	{Method: "GET", Path: "/api/v1/gpus/top", OperationID: "topGPUs", Summary: "Rank GPUs by a metric",
+		Params: []param{pTopMetric, pTopN, pTopWindow, pTopAgg, pTopOrder}},
+	{Method: "GET", Path: "/api/v1/gpus/status", OperationID: "gpuStatus", Summary: "Fleet health status",
+		Description: "Every GPU's last-seen time, whether it is stale (no data for stale_after) and its latest metric values, ordered by gpu_id.",
+		Params:      []param{pStaleAfter, pStatusMetrics}},
+	{Method: "GET", Path: "/api/v1/gpus/{id}/telemetry", OperationID: "queryTelemetry", Summary: "Query telemetry for a GPU",
+		Params: concatParams([]param{pathParam("GPU identifier")}, telemetryParams, []param{pFields, pLimit, pOrder, pOffset, pCursor})},
+	{Method: "GET", Path: "/api/v1/gpus/{id}/telemetry/export", OperationID: "exportTelemetry", Summary: "Download a GPU's telemetry as CSV or Parquet",
+		Params: concatParams([]param{pathParam("GPU identifier")}, telemetryParams, []param{pFormat})},
+	{Method: "GET", Path: "/api/v1/gpus/{id}/latest", OperationID: "latestTelemetry", Summary: "Most recent sample for a GPU",
+		Params: []param{pathParam("GPU identifier")}},
+	{Method: "GET", Path: "/api/v1/gpus/{id}/derived", OperationID: "derivedMetric", Summary: "A metric derived from a GPU's power and utilization",
+		Description: "Computed from the raw points of the gateway's -power_metric (watts) and -util_metric (percent) over the window.",
+		Params:      []param{pathParam("GPU identifier"), pDerivedMetric, pDerivedWindow}},
+	{Method: "GET", Path: "/api/v1/gpus/{id}/summary", OperationID: "summarizeGPU", Summary: "Per-metric statistics of a GPU over a window",
+		Description: "Count, min, max, mean, population standard deviation and nearest-rank 95th percentile of each metric's raw points, computed by the store where it can.",
+		Params:      []param{pathParam("GPU identifier"), pSummaryWindow, pSummaryMetrics}},
+	{Method: "GET", Path: "/api/v1/gpus/{id}/metrics", OperationID: "listGPUMetrics", Summary: "Metrics a GPU has reported",
+		Description: "Each metric's first and last seen time and number of values, over the GPU's whole history unless a window is given.",
+		Params:      []param{pathParam("GPU identifier"), pStartTime, pEndTime, pStart, pEnd, pListMetrics, pMetric, pProducers, pLabels}},
+	{Method: "GET", Path: "/api/v1/gpus/{id}/info", OperationID: "getGPUInfo", Summary: "Static info of a GPU",
+		Description: "The uuid, model, VBIOS and driver versions, memory size, PCI bus and host its streamer registered with the broker, as saved by the collectors. 404 for a GPU that was never registered; 501 when the store cannot keep inventory (VictoriaMetrics).",
+		Params:      []param{pathParam("GPU identifier")}},
+	{Method: "GET", Path: "/api/v1/metrics", OperationID: "listMetrics", Summary: "Metrics reported across the fleet",
+		Description: "Each metric with the number of GPUs reporting it, their values and the first and last seen time, over the whole history unless a window is given.",
+		Params:      []param{pStartTime, pEndTime, pStart, pEnd, pListMetrics, pMetric, pHostIDs, pProducers, pLabels}},
+	{Method: "GET", Path: "/api/v1/gpus/{id}/aggregate", OperationID: "aggregateGPU", Summary: "One metric of a GPU aggregated per time bucket",
+		Description: "The metric's avg, max, min or last value per step-wide bucket over the window, computed by the store where it can. Buckets without points are left out.",
+		Params:      []param{pathParam("GPU identifier"), pAggregateMetric, pAggregateAgg, pAggregateStep, pAggregateWindow}},
+	{Method: "GET", Path: "/api/v1/telemetry", OperationID: "queryFleetTelemetry", Summary: "Query telemetry across GPUs and hosts",
+		Params: concatParams([]param{pGPUIDs, pHostIDs}, telemetryParams, []param{pFields, pLimit, pFleetOrder, pOffset, pCursor})},
+	{Method: "GET", Path: "/api/v1/compare", OperationID: "compareGPUs", Summary: "Compare a metric across GPUs",
+		Description: "The mean of the metric per GPU and step bucket, aligned to one list of bucket timestamps so the series can be overlaid. A GPU without a point in a bucket has null there.",
+		Params:      []param{pCompareGPUs, pCompareMetric, pCompareWindow, pCompareStep}},
+	{Method: "POST", Path: "/api/v1/telemetry", OperationID: "ingestTelemetry", Summary: "Ingest a batch of telemetry points",
+		Description: "Enabled with the gateway's -ingest flag: points are written to the store or published to the broker. With -ingest=broker they pass through the collectors' pipeline."},
+	{Method: "DELETE", Path: "/api/v1/admin/telemetry", OperationID: "deleteTelemetry", Summary: "Delete telemetry by GPU and/or age (admin)",
+		Description: "Only callers listed in the gateway's -admin_subjects may call it, and with tenants only if their tenant sees everything.",
+		Params:      []param{pDeleteBefore, pDeleteGPU}},
+	{Method: "POST", Path: "/api/v1/admin/retention", OperationID: "runRetention", Summary: "Apply the retention rules now (admin)",
+		Description: "Deletes what the gateway's -retention rules no longer keep, as the background job does every -retention_interval. Only callers listed in -admin_subjects may call it, and with tenants only if their tenant sees everything."},
+	{Method: "GET", Path: "/api/v1/query", OperationID: "queryExpr", Summary: "Evaluate a PromQL-like expression",
+		Description: `Selectors (temp{gpu_id="gpu-1", host_id=~"node-.*"}), range functions (avg_over_time, min_over_time, max_over_time, sum_over_time, count_over_time, last_over_time, delta, rate) over range selectors (temp[1h]), numbers, parentheses and + - * /. Instant query at time (default now), or range query with start_time, end_time and step.`,
+		Params:      []param{pExpr, pExprTime, pExprStart, pExprEnd, pStart, pEnd, pExprStep}},
+	{Method: "GET", Path: "/api/v1/alerts/rules", OperationID: "listAlertRules", Summary: "List alert rules",
+		Description: "Tenants only see their own rules."},
+	{Method: "POST", Path: "/api/v1/alerts/rules", OperationID: "createAlertRule", Summary: "Create an alert rule",
+		Description: "The rule is saved in the store and evaluated by the gateway every -alert_interval. A tenant's rule only sees the tenant's part of the fleet. id, owner and created_at are set by the server."},
+	{Method: "GET", Path: "/api/v1/alerts/rules/{id}", OperationID: "getAlertRule", Summary: "Get an alert rule",
+		Params: []param{pathParam("Rule id")}},
+	{Method: "DELETE", Path: "/api/v1/alerts/rules/{id}", OperationID: "deleteAlertRule", Summary: "Delete an alert rule",
+		Params: []param{pathParam("Rule id")}},
+	{Method: "GET", Path: "/api/v1/alerts/firing", OperationID: "listFiringAlerts", Summary: "List active alerts",
+		Description: "One alert per series matching a rule. Tenants only see alerts of their own rules.",
+		Params:      []param{pAlertState}},
+	{Method: "GET", Path: "/api/v1/webhooks", OperationID: "listWebhooks", Summary: "List webhook subscriptions",
+		Description: "Tenants only see their own subscriptions."},
+	{Method: "POST", Path: "/api/v1/webhooks", OperationID: "createWebhook", Summary: "Subscribe a webhook to threshold crossings",
+		Description: "The gateway checks each GPU's latest value every -webhook_interval and POSTs a WebhookEvent to url when it crosses the threshold in the direction (a GPU already beyond it when first seen counts). Failed posts (network errors, 429 and 5xx) are retried with backoff up to -webhook_max_attempts; the X-Webhook-Delivery header is the same on retries. A tenant's subscription only sees the tenant's part of the fleet. id, owner and created_at are set by the server."},
+	{Method: "GET", Path: "/api/v1/webhooks/{id}", OperationID: "getWebhook", Summary: "Get a webhook subscription",
+		Params: []param{pathParam("Webhook id")}},
+	{Method: "DELETE", Path: "/api/v1/webhooks/{id}", OperationID: "deleteWebhook", Summary: "Delete a webhook subscription",
+		Params: []param{pathParam("Webhook id")}},
+	{Method: "GET", Path: "/api/v1/webhooks/{id}/deliveries", OperationID: "listWebhookDeliveries", Summary: "Recent deliveries of a webhook",
+		Description: "The last 100 events of the subscription with the outcome of posting them, newest first. Deliveries are kept in the gateway's memory only.",
+		Params:      []param{pathParam("Webhook id")}},
+	{Method: "GET", Path: "/api/v1/stream", OperationID: "streamTelemetry", Summary: "Stream live telemetry (Server-Sent Events)",
+		Params: []param{pStreamGPUs, pStreamMetrics, pMetric}},
+	{Method: "GET", Path: "/api/v1/prom", OperationID: "promLatest", Summary: "Latest value of every GPU metric in the Prometheus text format",
+		Description: "One gauge per metric, named after it (invalid characters become _), labelled gpu_id, host_id and the point's labels, plus gpu_telemetry_last_timestamp_seconds. GPUs whose latest point is older than -prom_max_age are left out."},
+	{Method: "POST", Path: "/api/v1/read", OperationID: "remoteRead", Summary: "Prometheus remote_read",
+		Description: "Snappy-compressed protobuf prometheus.ReadRequest in, ReadResponse out (SAMPLES only). Series are named and labelled as in /api/v1/prom."},
+	{Method: "POST", Path: "/graphql", OperationID: "graphql", Summary: "GraphQL query",
+		Description: "GPUs, hosts, telemetry windows, stats and rankings in one schema; use introspection for the full schema."},
+}
+
+func concatParams(lists ...[]param) []param {
+	var out []param
+	for _, l := range lists {
+		out = append(out, l...)
+	}
+	return out
+}
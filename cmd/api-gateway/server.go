@@ -1,17 +1,46 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"gpu-metric-collector/internal/expr"
+	"gpu-metric-collector/internal/model"
 	"gpu-metric-collector/internal/storage"
+
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+// maxFleetGPUs caps gpu_ids on the fleet query, which fans out per GPU on
+// stores that cannot query several at once.
+const maxFleetGPUs = 1000
+
+// Defaults and bounds for /api/v1/gpus/top.
+const (
+	defaultTopN      = 10
+	maxTopN          = 1000
+	defaultTopWindow = 5 * time.Minute
 )
 
+// minStep is the smallest downsampling step accepted; stores keep at most
+// second resolution in some backends.
+const minStep = time.Second
+
+// readyTimeout bounds the store ping of /readyz.
+const readyTimeout = 2 * time.Second
+
+// maxExprSteps caps the evaluations of one /api/v1/query range query.
+const maxExprSteps = 11000
+
 // newServer builds an http.Handler with all routes, for testing and for main().
+// Handlers read through storeFor, so tenant scopes set by middleware apply.
 func newServer(store storage.Store) http.Handler {
 	mux := http.NewServeMux()
 
@@ -20,76 +49,282 @@ func newServer(store storage.Store) http.Handler {
 		_, _ = w.Write([]byte("ok"))
 	})
 
+	// readiness pings the store, so a dead backend takes the gateway out of
+	// rotation instead of failing every request
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		status, code, checks := "ok", http.StatusOK, map[string]string{"store": "ok"}
+		if p, ok := store.(storage.Pinger); ok {
+			if err := p.Ping(ctx); err != nil {
+				status, code, checks["store"] = "fail", http.StatusServiceUnavailable, err.Error()
+			}
+		}
+		writeJSON(w, code, map[string]any{"status": status, "checks": checks})
+	})
+
 	mux.HandleFunc("/api/v1/gpus", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			methodNotAllowed(w, r)
 			return
 		}
-		gpus, err := store.ListGPUs()
+		gpus, err := storeFor(r.Context(), store).ListGPUs()
 		if err != nil {
-			log.Printf("api: list gpus error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeStoreError(w, r, err, "list gpus error")
 			return
 		}
 		writeJSON(w, http.StatusOK, gpus)
 	})
 
+	// GraphQL over the same read APIs (POST {"query": ...})
+	schema, err := newGraphQLSchema(store)
+	if err != nil {
+		// the schema is a constant; failing to parse it is a programming error
+		panic(fmt.Sprintf("graphql schema: %v", err))
+	}
+	mux.Handle("/graphql", &relay.Handler{Schema: schema})
+
+	// Live telemetry over Server-Sent Events
+	mux.Handle("/api/v1/stream", newStreamHub(store))
+
+	// Latest value of every GPU metric in the Prometheus text format
+	mux.Handle("/api/v1/prom", promHandler(store))
+	// Prometheus remote_read over the stored history
+	mux.Handle("/api/v1/read", remoteReadHandler(store))
+
+	// PromQL-like expressions: instant (time) or range (start_time, end_time, step)
+	mux.HandleFunc("/api/v1/query", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		v := r.URL.Query()
+		e, err := expr.Parse(pExpr.get(v))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidExpression, err.Error())
+			return
+		}
+		src := expr.StoreSource(storeFor(r.Context(), store))
+		if pExprStart.get(v) == "" && pStart.get(v) == "" {
+			at := time.Now().UTC()
+			if s := pExprTime.get(v); s != "" {
+				if at, err = parseTime(s, at); err != nil {
+					writeError(w, r, http.StatusBadRequest, codeInvalidTimeRange, "invalid time")
+					return
+				}
+			}
+			res, err := expr.Eval(e, src, at)
+			if err != nil {
+				writeExprError(w, r, err)
+				return
+			}
+			if res.IsScalar {
+				writeJSON(w, http.StatusOK, map[string]any{"type": "scalar", "time": at, "value": res.Scalar})
+				return
+			}
+			if res.Vector == nil {
+				res.Vector = []expr.Sample{}
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"type": "vector", "time": at, "result": res.Vector})
+			return
+		}
+		start, end, step, err := parseExprRange(v, time.Now().UTC())
+		if err != nil {
+			writeBadRequest(w, r, err)
+			return
+		}
+		series, err := expr.EvalRange(e, src, start, end, step)
+		if err != nil {
+			writeExprError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"type": "matrix", "result": series})
+	})
+
+	// Top-N GPUs by one metric over a recent window
+	mux.HandleFunc("/api/v1/gpus/top", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		q, err := parseTop(r.URL.Query(), time.Now())
+		if err != nil {
+			writeBadRequest(w, r, err)
+			return
+		}
+		top, err := storage.Top(storeFor(r.Context(), store), q)
+		if err != nil {
+			writeStoreError(w, r, err, "top gpus error metric=%s", q.Metric)
+			return
+		}
+		writeJSON(w, http.StatusOK, top)
+	})
+
+	// Hosts and the GPUs each one reports
+	hosts := hostsHandler(store)
+	mux.Handle("/api/v1/hosts", hosts)
+	mux.Handle("/api/v1/hosts/", hosts)
+
+	// Fleet health: last-seen, staleness and latest metrics of every GPU
+	mux.Handle("/api/v1/gpus/status", statusHandler(store))
+
+	// Several GPUs' series of one metric on shared buckets
+	mux.Handle("/api/v1/compare", compareHandler(store))
+
+	// Metric names and their cardinality, for discovering what to query
+	mux.Handle("/api/v1/metrics", metricsHandler(store))
+
 	mux.HandleFunc("/api/v1/gpus/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			methodNotAllowed(w, r)
 			return
 		}
 		p := strings.TrimPrefix(r.URL.Path, "/api/v1/gpus/")
 		parts := strings.Split(p, "/")
-		if len(parts) != 2 || parts[1] != "telemetry" || parts[0] == "" {
-			w.WriteHeader(http.StatusNotFound)
+		export := len(parts) == 3 && parts[1] == "telemetry" && parts[2] == "export"
+		if (len(parts) != 2 && !export) || parts[0] == "" || (parts[1] != "telemetry" && parts[1] != "latest" && parts[1] != "derived" && parts[1] != "summary" && parts[1] != "metrics" && parts[1] != "aggregate") {
+			notFound(w, r)
 			return
 		}
 		gpuID := parts[0]
+		store := storeFor(r.Context(), store)
 
-		var startPtr, endPtr *time.Time
-		if s := r.URL.Query().Get("start_time"); s != "" {
-			t, err := time.Parse(time.RFC3339, s)
+		if export {
+			format := pFormat.get(r.URL.Query())
+			if format == "" {
+				format = exportCSV
+			}
+			if format != exportCSV && format != exportParquet {
+				writeError(w, r, http.StatusBadRequest, codeInvalidParameter, "format must be csv or parquet")
+				return
+			}
+			q, page, err := parseQuery(r.URL.Query())
+			if err != nil {
+				writeBadRequest(w, r, err)
+				return
+			}
+			if page != nil {
+				writeError(w, r, http.StatusBadRequest, codeInvalidParameter, "export returns the whole window; limit, offset, cursor and order are not supported")
+				return
+			}
+			items, err := storage.Execute(store, gpuID, q)
 			if err != nil {
-				http.Error(w, "invalid start_time", http.StatusBadRequest)
+				writeStoreError(w, r, err, "export telemetry error gpu=%s", gpuID)
 				return
 			}
-			startPtr = &t
+			if err := writeExport(w, r, gpuID, format, items); err != nil {
+				logRequestf(r, "export telemetry gpu=%s format=%s: %v", gpuID, format, err)
+			}
+			return
 		}
-		if s := r.URL.Query().Get("end_time"); s != "" {
-			t, err := time.Parse(time.RFC3339, s)
+
+		if parts[1] == "derived" {
+			serveDerived(w, r, store, gpuID)
+			return
+		}
+
+		if parts[1] == "summary" {
+			serveSummary(w, r, store, gpuID)
+			return
+		}
+
+		if parts[1] == "metrics" {
+			serveGPUMetrics(w, r, store, gpuID)
+			return
+		}
+
+		if parts[1] == "aggregate" {
+			serveAggregate(w, r, store, gpuID)
+			return
+		}
+
+		if parts[1] == "latest" {
+			it, err := storage.Latest(store, gpuID)
 			if err != nil {
-				http.Error(w, "invalid end_time", http.StatusBadRequest)
+				writeStoreError(w, r, err, "latest telemetry error gpu=%s", gpuID)
+				return
+			}
+			if it == nil {
+				writeError(w, r, http.StatusNotFound, codeGPUNotFound, "no telemetry for gpu "+gpuID)
 				return
 			}
-			endPtr = &t
+			writeJSON(w, http.StatusOK, latestSample{Telemetry: *it, AgeSeconds: time.Since(it.Timestamp).Seconds()})
+			return
 		}
 
-		items, err := store.QueryTelemetry(gpuID, startPtr, endPtr)
+		q, page, err := parseQuery(r.URL.Query())
 		if err != nil {
-			log.Printf("api: query telemetry error gpu=%s start=%v end=%v: %v", gpuID, startPtr, endPtr, err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeBadRequest(w, r, err)
 			return
 		}
-		writeJSON(w, http.StatusOK, items)
+		fields, err := parseFields(pFields.get(r.URL.Query()))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+			return
+		}
+		fields.narrow(&q)
+		startPtr, endPtr := q.Start, q.End
+		if page != nil {
+			page.apply(&q)
+		}
+		var items []model.Telemetry
+		if q.Step == 0 && len(q.Metrics) == 0 && len(q.ProducerIDs) == 0 && len(q.Labels) == 0 && page == nil {
+			items, err = store.QueryTelemetry(gpuID, startPtr, endPtr)
+		} else {
+			items, err = storage.Execute(store, gpuID, q)
+		}
+		if err != nil {
+			writeStoreError(w, r, err, "query telemetry error gpu=%s start=%v end=%v", gpuID, startPtr, endPtr)
+			return
+		}
+		writeTelemetry(w, items, page, fields)
 	})
 
-	// mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
-	// 	http.ServeFile(w, r, "api/openapi.json")
-	// })
+	// Fleet-wide query: many GPUs (by id and/or host) in one call
+	mux.HandleFunc("/api/v1/telemetry", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		q, page, err := parseQuery(r.URL.Query())
+		if err != nil {
+			writeBadRequest(w, r, err)
+			return
+		}
+		fields, err := parseFields(pFields.get(r.URL.Query()))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+			return
+		}
+		fields.narrow(&q)
+		gpuIDs := parseList(pGPUIDs.get(r.URL.Query()))
+		q.HostIDs = parseList(pHostIDs.get(r.URL.Query()))
+		if len(gpuIDs) == 0 && len(q.HostIDs) == 0 {
+			writeError(w, r, http.StatusBadRequest, codeInvalidParameter, "gpu_ids or host_id required")
+			return
+		}
+		if len(gpuIDs) > maxFleetGPUs {
+			writeErrorDetails(w, r, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("too many gpu_ids (max %d)", maxFleetGPUs), map[string]any{"max_gpu_ids": maxFleetGPUs})
+			return
+		}
+		if page != nil {
+			page.apply(&q)
+		}
+		items, err := storage.ExecuteFleet(storeFor(r.Context(), store), gpuIDs, q)
+		if err != nil {
+			writeStoreError(w, r, err, "fleet query error gpus=%v hosts=%v", gpuIDs, q.HostIDs)
+			return
+		}
+		writeTelemetry(w, items, page, fields)
+	})
 
-	// Serve OpenAPI spec from absolute path baked into the image and provide an alias.
-	if _, err := os.Stat("/api/openapi.json"); err != nil {
-		log.Printf("api: warning: openapi spec not found at /api/openapi.json: %v", err)
-	} else {
-		log.Printf("api: openapi spec found at /api/openapi.json")
+	// OpenAPI spec, embedded in the binary and generated from apiRoutes, with an alias
+	serveSpec := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(openAPISpec)
 	}
-	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "/api/openapi.json")
-	})
-	mux.HandleFunc("/api/openapi.json", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "/api/openapi.json")
-	})
+	mux.HandleFunc("/openapi.json", serveSpec)
+	mux.HandleFunc("/api/openapi.json", serveSpec)
 
 	// Simple Swagger UI via CDN at /docs
 	mux.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
@@ -111,12 +346,201 @@ func newServer(store storage.Store) http.Handler {
 </html>`))
 	})
 
+	// Dashboard over the JSON API, embedded in the binary
+	ui := uiHandler()
+	mux.Handle("/ui", ui)
+	mux.Handle("/ui/", ui)
+
 	// Serve static Swagger UI if generated at /api/swagger
 	mux.Handle("/swagger/", http.StripPrefix("/swagger/", http.FileServer(http.Dir("/api/swagger"))))
 
+	// Anything else gets the JSON error envelope rather than a text 404
+	mux.HandleFunc("/", notFound)
+
 	return mux
 }
 
+// latestSample is a GPU's most recent point with its age at response time.
+type latestSample struct {
+	model.Telemetry
+	AgeSeconds float64 `json:"age_seconds"`
+}
+
+// parseQuery reads the params shared by the telemetry endpoints: window, step
+// (alias interval), metrics (alias metric) and paging.
+func parseQuery(v url.Values) (storage.Query, *pageRequest, error) {
+	var q storage.Query
+	now := time.Now().UTC()
+	if s := aliased(v, pStartTime, pStart); s != "" {
+		t, err := parseTime(s, now)
+		if err != nil {
+			return q, nil, timeRangeError("invalid start_time")
+		}
+		q.Start = &t
+	}
+	// end_time=now is left open, as without end_time, so a cached window
+	// that ends now keeps one key
+	if s := aliased(v, pEndTime, pEnd); s != "" && s != "now" {
+		t, err := parseTime(s, now)
+		if err != nil {
+			return q, nil, timeRangeError("invalid end_time")
+		}
+		q.End = &t
+	}
+	if q.Start != nil && q.End != nil && q.End.Before(*q.Start) {
+		return q, nil, timeRangeError("end_time is before start_time")
+	}
+
+	// step (alias interval) returns the mean per bucket instead of raw points
+	stepParam := pStep.get(v)
+	if stepParam == "" {
+		stepParam = pInterval.get(v)
+	}
+	if stepParam != "" {
+		d, err := time.ParseDuration(stepParam)
+		if err != nil || d < minStep {
+			return q, nil, errors.New("invalid step (want a duration of at least 1s, e.g. 5m)")
+		}
+		q.Step = d
+	}
+
+	metrics := pMetrics.get(v)
+	if metrics == "" {
+		metrics = pMetric.get(v)
+	}
+	q.Metrics = parseList(metrics)
+	q.ProducerIDs = parseList(pProducers.get(v))
+	for _, m := range parseList(pLabels.get(v)) {
+		name, value, ok := strings.Cut(m, "=")
+		if !ok || name == "" {
+			return q, nil, fmt.Errorf("invalid labels matcher %q (want name=value)", m)
+		}
+		if q.Labels == nil {
+			q.Labels = map[string]string{}
+		}
+		q.Labels[name] = value
+	}
+
+	page, err := parsePage(v)
+	if err != nil {
+		return q, nil, err
+	}
+	return q, page, nil
+}
+
+// parseTop reads the top-N params: metric (required), n, window (ending
+// now), agg and order.
+func parseTop(v url.Values, now time.Time) (storage.TopQuery, error) {
+	q := storage.TopQuery{Metric: strings.TrimSpace(pTopMetric.get(v)), N: defaultTopN, Agg: storage.AggAvg}
+	if q.Metric == "" {
+		return q, errors.New("metric required")
+	}
+	if s := pTopN.get(v); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxTopN {
+			return q, fmt.Errorf("invalid n (want 1..%d)", maxTopN)
+		}
+		q.N = n
+	}
+	window := defaultTopWindow
+	if s := pTopWindow.get(v); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < minStep {
+			return q, errors.New("invalid window (want a duration of at least 1s, e.g. 5m)")
+		}
+		window = d
+	}
+	start := now.Add(-window)
+	q.Start = &start
+	if s := pTopAgg.get(v); s != "" {
+		if !storage.ValidAgg(s) {
+			return q, errors.New("invalid agg (want avg, max, min or last)")
+		}
+		q.Agg = s
+	}
+	switch pTopOrder.get(v) {
+	case "", "desc":
+	case "asc":
+		q.Asc = true
+	default:
+		return q, errors.New("invalid order (want asc or desc)")
+	}
+	return q, nil
+}
+
+// parseExprRange reads a range query's start_time, end_time (default now) and
+// step, capped at maxExprSteps evaluations.
+func parseExprRange(v url.Values, now time.Time) (start, end time.Time, step time.Duration, err error) {
+	if start, err = parseTime(aliased(v, pExprStart, pStart), now); err != nil {
+		return start, end, step, timeRangeError("invalid start_time")
+	}
+	end = now
+	if s := aliased(v, pExprEnd, pEnd); s != "" {
+		if end, err = parseTime(s, now); err != nil {
+			return start, end, step, timeRangeError("invalid end_time")
+		}
+	}
+	if step, err = expr.ParseDuration(pExprStep.get(v)); err != nil || step < minStep {
+		return start, end, step, errors.New("invalid step (want a duration of at least 1s, e.g. 1m)")
+	}
+	if end.Before(start) {
+		return start, end, step, timeRangeError("end_time is before start_time")
+	}
+	if n := end.Sub(start)/step + 1; n > maxExprSteps {
+		return start, end, step, fmt.Errorf("too many steps (%d, max %d); use a larger step", n, maxExprSteps)
+	}
+	return start, end, step, nil
+}
+
+// writeExprError answers an evaluation error: 422 for queries that load too
+// much or mix series ambiguously, which the caller can fix; see
+// writeStoreError otherwise.
+func writeExprError(w http.ResponseWriter, r *http.Request, err error) {
+	var bad *expr.Error
+	if errors.As(err, &bad) {
+		writeError(w, r, http.StatusUnprocessableEntity, codeQueryRejected, err.Error())
+		return
+	}
+	writeStoreError(w, r, err, "query expression error")
+}
+
+// parseList splits a comma-separated query param, dropping blanks and repeats.
+// parseTime reads an RFC3339 time, or one relative to now: "now", "-1h" or
+// "now-1h", with the units of expression durations (s, m, h, d, w, ...).
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "now" {
+		return now, nil
+	}
+	if rel, ok := strings.CutPrefix(strings.TrimPrefix(s, "now"), "-"); ok {
+		d, err := expr.ParseDuration(rel)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// aliased returns the value of p, or of its alias when p is absent.
+func aliased(v url.Values, p, alias param) string {
+	if s := p.get(v); s != "" {
+		return s
+	}
+	return alias.get(v)
+}
+
+func parseList(s string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" && !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
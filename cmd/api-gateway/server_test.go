@@ -1,13 +1,28 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	"gpu-metric-collector/api/gen/prompb"
 	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/parquet-go/parquet-go"
+	"google.golang.org/protobuf/proto"
 )
 
 // fakeStore implements storage.Store for handler tests
@@ -18,7 +33,10 @@ type fakeStore struct {
 }
 
 func (f *fakeStore) SaveTelemetry(t model.Telemetry) error { return f.saveErr }
-func (f *fakeStore) ListGPUs() ([]string, error)           { return f.gpus, nil }
+func (f *fakeStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	return storage.SaveEach(f.SaveTelemetry, items)
+}
+func (f *fakeStore) ListGPUs() ([]string, error) { return f.gpus, nil }
 func (f *fakeStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
 	items := f.tel[gpuID]
 	// filter by window inclusively if provided
@@ -53,6 +71,32 @@ func TestListGPUs_OK(t *testing.T) {
 	}
 }
 
+// pingStore is a fakeStore whose Ping returns err
+type pingStore struct {
+	fakeStore
+	err error
+}
+
+func (p *pingStore) Ping(ctx context.Context) error { return p.err }
+
+func TestReadyz_PingsStore(t *testing.T) {
+	// Scenario: /readyz over a store whose ping succeeds, then fails
+	// Expect: 200 with the store check ok, then 503 with the ping error
+	ps := &pingStore{}
+	if w := call(newServer(ps), "/readyz"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"store":"ok"`) {
+		t.Fatalf("ready: %d %s", w.Code, w.Body)
+	}
+	ps.err = errors.New("connection refused")
+	w := call(newServer(ps), "/readyz")
+	var got struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusServiceUnavailable || got.Status != "fail" || got.Checks["store"] != "connection refused" {
+		t.Fatalf("not ready: %d %s", w.Code, w.Body)
+	}
+}
+
 func TestQueryTelemetry_OK_WithWindow(t *testing.T) {
 	// Prepare telemetry across times
 	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
@@ -91,6 +135,35 @@ func TestQueryTelemetry_BadTime(t *testing.T) {
 	}
 }
 
+func TestQueryTelemetry_RelativeTimes(t *testing.T) {
+	// Scenario: points 3h, 90m and 10m ago queried with relative windows and
+	// the start/end aliases
+	// Expect: -2h..now-30m holds the 90m point, start=-1h the newest one,
+	// start=now-4h&end=now all three; a bad duration is 400
+	now := time.Now().UTC()
+	items := []model.Telemetry{
+		{GPUId: "gpu-1", Timestamp: now.Add(-3 * time.Hour), Metrics: map[string]float64{"temp": 70}},
+		{GPUId: "gpu-1", Timestamp: now.Add(-90 * time.Minute), Metrics: map[string]float64{"temp": 71}},
+		{GPUId: "gpu-1", Timestamp: now.Add(-10 * time.Minute), Metrics: map[string]float64{"temp": 72}},
+	}
+	srv := newServer(&fakeStore{tel: map[string][]model.Telemetry{"gpu-1": items}})
+	for query, want := range map[string]int{
+		"start_time=-2h&end_time=now-30m": 1,
+		"start=-1h":                       1,
+		"start=now-4h&end=now":            3,
+		"start_time=-1d":                  3,
+	} {
+		w := call(srv, "/api/v1/gpus/gpu-1/telemetry?"+query)
+		var got []map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got) != want {
+			t.Fatalf("%s: want %d items, got %d %s", query, want, w.Code, w.Body.String())
+		}
+	}
+	if w := call(srv, "/api/v1/gpus/gpu-1/telemetry?start_time=-1x"); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad duration: expected 400, got %d", w.Code)
+	}
+}
+
 func TestQueryTelemetry_NotFoundPath(t *testing.T) {
 	fs := &fakeStore{}
 	srv := newServer(fs)
@@ -101,3 +174,776 @@ func TestQueryTelemetry_NotFoundPath(t *testing.T) {
 		t.Fatalf("expected 404, got %d", w.Code)
 	}
 }
+
+func TestQueryTelemetry_IncludesHostAndProducer(t *testing.T) {
+	items := []model.Telemetry{{GPUId: "gpu-1", HostId: "node-1", ProducerId: "streamer-1", Timestamp: time.Now(), Metrics: map[string]float64{"temp": 70}}}
+	fs := &fakeStore{tel: map[string][]model.Telemetry{"gpu-1": items}}
+	srv := newServer(fs)
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/gpus/gpu-1/telemetry", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	var got []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if len(got) != 1 || got[0]["host_id"] != "node-1" || got[0]["producer_id"] != "streamer-1" {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
+
+func TestQueryTelemetry_Downsampled(t *testing.T) {
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	var items []model.Telemetry
+	for i := 0; i < 4; i++ {
+		items = append(items, model.Telemetry{GPUId: "gpu-1", Timestamp: base.Add(time.Duration(i) * 30 * time.Second), Metrics: map[string]float64{"temp": float64(70 + i)}})
+	}
+	fs := &fakeStore{tel: map[string][]model.Telemetry{"gpu-1": items}}
+	srv := newServer(fs)
+	for _, q := range []string{"step=1m", "interval=1m"} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/gpus/gpu-1/telemetry?"+q, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", q, w.Code)
+		}
+		var got []model.Telemetry
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		if len(got) != 2 || got[0].Metrics["temp"] != 70.5 || got[1].Metrics["temp"] != 72.5 {
+			t.Fatalf("%s: unexpected body: %s", q, w.Body.String())
+		}
+	}
+
+	for _, q := range []string{"step=soon", "step=10ms"} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/gpus/gpu-1/telemetry?"+q, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
+// pageAll follows next cursors from the first page and returns every item's temp.
+func pageAll(t *testing.T, srv http.Handler, first string) []float64 {
+	t.Helper()
+	var temps []float64
+	url := first
+	for pages := 0; ; pages++ {
+		if pages > 20 {
+			t.Fatal("too many pages")
+		}
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", url, w.Code, w.Body.String())
+		}
+		var page struct {
+			Items []model.Telemetry `json:"items"`
+			Next  string            `json:"next"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		for _, it := range page.Items {
+			temps = append(temps, it.Metrics["temp"])
+		}
+		if page.Next == "" {
+			return temps
+		}
+		url = "/api/v1/gpus/gpu-1/telemetry?cursor=" + page.Next
+	}
+}
+
+func TestQueryTelemetry_PaginatesWithCursor(t *testing.T) {
+	// 7 points, three of them sharing one timestamp across a page boundary
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	offsets := []int{0, 1, 2, 2, 2, 3, 4}
+	var items []model.Telemetry
+	for i, o := range offsets {
+		items = append(items, model.Telemetry{GPUId: "gpu-1", Timestamp: base.Add(time.Duration(o) * time.Second), Metrics: map[string]float64{"temp": float64(i)}})
+	}
+	mem := storage.NewMemoryStore()
+	_ = mem.SaveTelemetryBatch(items)
+	stores := map[string]storage.Store{"pager": mem, "generic": &fakeStore{tel: map[string][]model.Telemetry{"gpu-1": items}}}
+	for name, st := range stores {
+		srv := newServer(st)
+		asc := pageAll(t, srv, "/api/v1/gpus/gpu-1/telemetry?limit=2")
+		if fmt.Sprint(asc) != "[0 1 2 3 4 5 6]" {
+			t.Fatalf("%s asc = %v", name, asc)
+		}
+		desc := pageAll(t, srv, "/api/v1/gpus/gpu-1/telemetry?limit=3&order=desc")
+		if fmt.Sprint(desc) != "[6 5 4 3 2 1 0]" {
+			t.Fatalf("%s desc = %v", name, desc)
+		}
+		off := pageAll(t, srv, "/api/v1/gpus/gpu-1/telemetry?limit=2&offset=3")
+		if fmt.Sprint(off) != "[3 4 5 6]" {
+			t.Fatalf("%s offset = %v", name, off)
+		}
+	}
+}
+
+func TestQueryTelemetry_BadPageParams(t *testing.T) {
+	srv := newServer(&fakeStore{})
+	for _, q := range []string{"limit=0", "limit=100000", "order=sideways", "offset=-1", "cursor=!!", "cursor=e30&offset=1"} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/gpus/gpu-1/telemetry?"+q, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
+func TestQueryTelemetry_MetricFilter(t *testing.T) {
+	now := time.Now().UTC()
+	items := []model.Telemetry{
+		{GPUId: "gpu-1", Timestamp: now, Metrics: map[string]float64{"temp": 70, "power": 250, "util": 90}},
+		{GPUId: "gpu-1", Timestamp: now.Add(time.Second), Metrics: map[string]float64{"util": 91}},
+	}
+	srv := newServer(&fakeStore{tel: map[string][]model.Telemetry{"gpu-1": items}})
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/gpus/gpu-1/telemetry?metrics=temp,+power,temp", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	var got []model.Telemetry
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if len(got) != 1 || len(got[0].Metrics) != 2 || got[0].Metrics["power"] != 250 {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
+
+func TestQueryTelemetry_AttributionFilters(t *testing.T) {
+	// Scenario: points of gpu-1 from two producers and racks, queried by
+	// producer and labels, then with a malformed labels matcher
+	// Expect: only the point of streamer-1 in rack r1; 400 for the matcher
+	now := time.Now().UTC()
+	items := []model.Telemetry{
+		{GPUId: "gpu-1", ProducerId: "streamer-1", Timestamp: now, Labels: map[string]string{"rack": "r1", "pod": "a"}, Metrics: map[string]float64{"temp": 70}},
+		{GPUId: "gpu-1", ProducerId: "streamer-2", Timestamp: now.Add(time.Second), Labels: map[string]string{"rack": "r1"}, Metrics: map[string]float64{"temp": 71}},
+		{GPUId: "gpu-1", ProducerId: "streamer-1", Timestamp: now.Add(2 * time.Second), Labels: map[string]string{"rack": "r2"}, Metrics: map[string]float64{"temp": 72}},
+	}
+	srv := newServer(&fakeStore{tel: map[string][]model.Telemetry{"gpu-1": items}})
+	w := call(srv, "/api/v1/gpus/gpu-1/telemetry?producer_id=streamer-1&labels=rack=r1,pod=a")
+	var got []model.Telemetry
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if len(got) != 1 || got[0].Metrics["temp"] != 70 {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+	if w := call(srv, "/api/v1/gpus/gpu-1/telemetry?labels=rack"); w.Code != http.StatusBadRequest {
+		t.Fatalf("malformed matcher: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestQueryTelemetry_Fields(t *testing.T) {
+	// Scenario: one point with host, labels and three metrics, asked for
+	// timestamps and one metric, for ids only with paging, and for a bad field
+	// Expect: only the asked keys in each item (in the page too); 400 otherwise
+	now := time.Now().UTC().Truncate(time.Second)
+	items := []model.Telemetry{
+		{GPUId: "gpu-1", HostId: "h1", Timestamp: now, Metrics: map[string]float64{"temp": 70, "power": 250, "util": 90}, Labels: map[string]string{"model": "H100"}},
+	}
+	srv := newServer(&fakeStore{tel: map[string][]model.Telemetry{"gpu-1": items}})
+	w := call(srv, "/api/v1/gpus/gpu-1/telemetry?fields=timestamp,metrics.power")
+	want := `[{"timestamp":"` + now.Format(time.RFC3339) + `","metrics":{"power":250}}]`
+	if strings.TrimSpace(w.Body.String()) != want {
+		t.Fatalf("got %s, want %s", w.Body.String(), want)
+	}
+	w = call(srv, "/api/v1/gpus/gpu-1/telemetry?fields=gpu_id,host_id&limit=10")
+	if strings.TrimSpace(w.Body.String()) != `{"items":[{"gpu_id":"gpu-1","host_id":"h1"}]}` {
+		t.Fatalf("page: %s", w.Body.String())
+	}
+	if w := call(srv, "/api/v1/gpus/gpu-1/telemetry?fields=temp"); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad field: expected 400, got %d", w.Code)
+	}
+}
+
+func TestFleetTelemetry_AcrossGPUsAndHosts(t *testing.T) {
+	// Scenario: three GPUs on two hosts; query by gpu_ids, then by host
+	// Expect: one time-ordered array with points from each matching GPU
+	t0 := time.Now().UTC().Truncate(time.Second)
+	st := &fakeStore{gpus: []string{"a", "b", "c"}, tel: map[string][]model.Telemetry{
+		"a": {{GPUId: "a", HostId: "h1", Timestamp: t0, Metrics: map[string]float64{"temp": 1, "util": 5}}},
+		"b": {{GPUId: "b", HostId: "h1", Timestamp: t0.Add(-time.Second), Metrics: map[string]float64{"temp": 2}}},
+		"c": {{GPUId: "c", HostId: "h2", Timestamp: t0, Metrics: map[string]float64{"temp": 3}}},
+	}}
+	srv := newServer(st)
+	get := func(q string) []model.Telemetry {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/telemetry?"+q, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", q, w.Code, w.Body.String())
+		}
+		var got []model.Telemetry
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		return got
+	}
+	got := get("gpu_ids=a,b,c&metric=temp")
+	if len(got) != 3 || got[0].GPUId != "b" || got[1].GPUId != "a" || got[2].GPUId != "c" || len(got[1].Metrics) != 1 {
+		t.Fatalf("unexpected gpu_ids result: %+v", got)
+	}
+	got = get("host_id=h1")
+	if len(got) != 2 || got[0].GPUId != "b" || got[1].GPUId != "a" {
+		t.Fatalf("unexpected host result: %+v", got)
+	}
+	if got = get("host_id=h2&gpu_ids=a"); len(got) != 0 {
+		t.Fatalf("expected no points, got %+v", got)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/telemetry?metric=temp", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without gpu_ids/host_id, got %d", w.Code)
+	}
+}
+
+func TestLatest_ReturnsNewestWithAge(t *testing.T) {
+	// Scenario: memory store with three points, newest 30s old
+	// Expect: the newest point, age about 30s; unknown GPU -> 404
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	for i := 3; i >= 1; i-- {
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: now.Add(-time.Duration(i) * 30 * time.Second), Metrics: map[string]float64{"temp": float64(i)}})
+	}
+	srv := newServer(mem)
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/gpus/gpu-1/latest", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var got latestSample
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if got.GPUId != "gpu-1" || got.HostId != "h1" || got.Metrics["temp"] != 1 || got.AgeSeconds < 29 || got.AgeSeconds > 60 {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/gpus/gpu-9/latest", nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestStatus_ReportsStaleGPUs(t *testing.T) {
+	// Scenario: gpu-1 reported 30s ago, gpu-2 10 minutes ago
+	// Expect: gpu-2 stale under the default 5m, neither stale with stale_after=1h; metrics filter applies
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: now.Add(-30 * time.Second), Metrics: map[string]float64{"temp": 60, "power": 200}})
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", HostId: "h2", Timestamp: now.Add(-10 * time.Minute), Metrics: map[string]float64{"temp": 70}})
+	srv := newServer(mem)
+
+	var got fleetStatus
+	w := call(srv, "/api/v1/gpus/status?metrics=temp")
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if got.Total != 2 || got.Stale != 1 || len(got.GPUs) != 2 || got.GPUs[0].Stale || !got.GPUs[1].Stale {
+		t.Fatalf("unexpected status: %s", w.Body.String())
+	}
+	if g := got.GPUs[0]; g.HostId != "h1" || len(g.Metrics) != 1 || g.Metrics["temp"] != 60 || *g.AgeSeconds < 29 {
+		t.Fatalf("unexpected gpu-1: %+v", g)
+	}
+	got = fleetStatus{}
+	_ = json.Unmarshal(call(srv, "/api/v1/gpus/status?stale_after=1h").Body.Bytes(), &got)
+	if got.Stale != 0 || len(got.GPUs[0].Metrics) != 2 {
+		t.Fatalf("unexpected status with stale_after=1h: %+v", got)
+	}
+	if w := call(srv, "/api/v1/gpus/status?stale_after=soon"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestHosts_ListAndGPUs(t *testing.T) {
+	// Scenario: gpu-1 and gpu-2 on h1, gpu-3 moved from h1 to h2, gpu-4 without host
+	// Expect: hosts grouped by each GPU's latest host; per-host GPU ids; unknown host -> 404
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	for _, it := range []model.Telemetry{
+		{GPUId: "gpu-2", HostId: "h1", Timestamp: now},
+		{GPUId: "gpu-1", HostId: "h1", Timestamp: now.Add(-time.Minute)},
+		{GPUId: "gpu-3", HostId: "h1", Timestamp: now.Add(-time.Hour)},
+		{GPUId: "gpu-3", HostId: "h2", Timestamp: now},
+		{GPUId: "gpu-4", Timestamp: now},
+	} {
+		it.Metrics = map[string]float64{"temp": 1}
+		_ = mem.SaveTelemetry(it)
+	}
+	srv := newServer(mem)
+
+	var hosts []hostInfo
+	w := call(srv, "/api/v1/hosts")
+	if err := json.Unmarshal(w.Body.Bytes(), &hosts); err != nil || len(hosts) != 2 {
+		t.Fatalf("hosts %d: %s", w.Code, w.Body.String())
+	}
+	if hosts[0].HostId != "h1" || strings.Join(hosts[0].GPUs, ",") != "gpu-1,gpu-2" || !hosts[0].LastSeen.Equal(now) || strings.Join(hosts[1].GPUs, ",") != "gpu-3" {
+		t.Fatalf("unexpected hosts: %s", w.Body.String())
+	}
+	if w := call(srv, "/api/v1/hosts/h2/gpus"); w.Body.String() != "[\"gpu-3\"]\n" {
+		t.Fatalf("h2 gpus: %d %s", w.Code, w.Body.String())
+	}
+	for _, p := range []string{"/api/v1/hosts/h9/gpus", "/api/v1/hosts/h1", "/api/v1/hosts/h1/gpus/x"} {
+		if w := call(srv, p); w.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected 404, got %d", p, w.Code)
+		}
+	}
+}
+
+func TestTopGPUs(t *testing.T) {
+	// Scenario: three GPUs; one only has stale points outside the window
+	// Expect: ranked by mean temp within the window, n and order honored
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	add := func(id string, ago time.Duration, temp float64) {
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: id, Timestamp: now.Add(-ago), Metrics: map[string]float64{"temp": temp}})
+	}
+	add("a", time.Minute, 60)
+	add("a", 2*time.Minute, 80)
+	add("b", time.Minute, 75)
+	add("c", time.Hour, 99)
+	srv := newServer(mem)
+	get := func(q string) []storage.GPUValue {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/gpus/top?"+q, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", q, w.Code, w.Body.String())
+		}
+		var got []storage.GPUValue
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		return got
+	}
+	if got := get("metric=temp"); len(got) != 2 || got[0].GPUId != "b" || got[1].Value != 70 {
+		t.Fatalf("avg ranking: %+v", got)
+	}
+	if got := get("metric=temp&agg=max&n=1"); len(got) != 1 || got[0].GPUId != "a" || got[0].Value != 80 {
+		t.Fatalf("max ranking: %+v", got)
+	}
+	if got := get("metric=temp&window=2h&order=asc&n=1"); len(got) != 1 || got[0].GPUId != "a" {
+		t.Fatalf("asc ranking: %+v", got)
+	}
+	for _, q := range []string{"", "metric=temp&n=0", "metric=temp&window=x", "metric=temp&agg=p99", "metric=temp&order=up"} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/gpus/top?"+q, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%q: expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
+func TestStream_PushesNewPoints(t *testing.T) {
+	// Scenario: a client streams gpu-1 (one stored point), then two more points are saved
+	// Expect: the latest point first, then the new ones in order, with the metric filter applied
+	oldPoll := streamPoll
+	streamPoll = 10 * time.Millisecond
+	defer func() { streamPoll = oldPoll }()
+
+	mem := storage.NewMemoryStore()
+	t0 := time.Now().UTC()
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: t0, Metrics: map[string]float64{"temp": 1, "util": 9}})
+	srv := httptest.NewServer(newServer(mem))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/stream?gpu_id=gpu-1&metrics=temp")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+	events := make(chan model.Telemetry, 8)
+	go func() {
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+				var it model.Telemetry
+				if json.Unmarshal([]byte(data), &it) == nil {
+					events <- it
+				}
+			}
+		}
+	}()
+	next := func() model.Telemetry {
+		t.Helper()
+		select {
+		case it := <-events:
+			return it
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+		return model.Telemetry{}
+	}
+	if it := next(); it.Metrics["temp"] != 1 || len(it.Metrics) != 1 {
+		t.Fatalf("first event: %+v", it)
+	}
+	// same timestamp as the stored point, then a newer one
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: t0, Metrics: map[string]float64{"temp": 2}})
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: t0.Add(time.Second), Metrics: map[string]float64{"temp": 3}})
+	if a, b := next(), next(); a.Metrics["temp"] != 2 || b.Metrics["temp"] != 3 {
+		t.Fatalf("streamed %+v then %+v", a, b)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/stream", nil)
+	w := httptest.NewRecorder()
+	newServer(mem).ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without gpu_id, got %d", w.Code)
+	}
+}
+
+func TestGraphQL_ShapesOneRequest(t *testing.T) {
+	// Scenario: one GraphQL request for hosts with their GPUs' latest temp, a window and stats
+	// Expect: the requested shape, with values from the store
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, temp := range []float64{60, 70, 80} {
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: now.Add(time.Duration(i-3) * time.Second), Metrics: map[string]float64{"temp": temp, "util": 5}})
+	}
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", HostId: "h2", Timestamp: now, Metrics: map[string]float64{"temp": 50}})
+	srv := newServer(mem)
+	post := func(query string) map[string]any {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"query": query})
+		r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		var out map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("json: %v: %s", err, w.Body.String())
+		}
+		return out
+	}
+
+	out := post(`{
+  hosts { id gpus { id latest { value(metric: "temp") } } }
+  gpu(id: "gpu-1") {
+    telemetry(limit: 2, desc: true, metrics: ["temp"]) { timestamp metrics { name value } }
+    stats(metric: "temp", window: "1h") { count avg max last }
+  }
+  top(metric: "temp", n: 1) { gpu { id host } value }
+}`)
+	if out["errors"] != nil {
+		t.Fatalf("errors: %v", out["errors"])
+	}
+	got, _ := json.Marshal(out["data"])
+	for _, want := range []string{
+		`"hosts":[{"gpus":[{"id":"gpu-1","latest":{"value":80}}],"id":"h1"},{"gpus":[{"id":"gpu-2","latest":{"value":50}}],"id":"h2"}]`,
+		`"metrics":[{"name":"temp","value":80}]`,
+		`"stats":{"avg":70,"count":3,"last":80,"max":80}`,
+		`"top":[{"gpu":{"host":"h1","id":"gpu-1"},"value":70}]`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Fatalf("missing %s in %s", want, got)
+		}
+	}
+
+	if out := post(`{ telemetry(metrics: ["temp"]) { gpuId } }`); out["errors"] == nil {
+		t.Fatalf("expected an error without gpuIds/hostIds: %v", out)
+	}
+}
+
+func TestGzip_CompressesJSONButNotStreams(t *testing.T) {
+	// Scenario: telemetry fetched with and without Accept-Encoding: gzip, plus an SSE response
+	// Expect: gzip body decodes to the same JSON as writeJSON; no gzip when not accepted or for event streams
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	var items []model.Telemetry
+	for i := 0; i < 50; i++ {
+		items = append(items, model.Telemetry{GPUId: "gpu-1", Timestamp: base.Add(time.Duration(i) * time.Second), Metrics: map[string]float64{"temp": float64(i)}})
+	}
+	h := withGzip(newServer(&fakeStore{tel: map[string][]model.Telemetry{"gpu-1": items}}))
+
+	want := httptest.NewRecorder()
+	writeJSON(want, http.StatusOK, items)
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/gpus/gpu-1/telemetry", nil)
+	r.Header.Set("Accept-Encoding", "br, gzip;q=0.8")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip, headers %v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	got, _ := io.ReadAll(zr)
+	if string(got) != want.Body.String() {
+		t.Fatalf("body differs from writeJSON:\n%s\n%s", got, want.Body.String())
+	}
+
+	if w := call(h, "/api/v1/gpus/gpu-1/telemetry", "Accept-Encoding", "gzip;q=0"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != want.Body.String() {
+		t.Fatalf("refused gzip: %v", w.Header())
+	}
+	sse := withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(": ping\n\n"))
+		w.(http.Flusher).Flush()
+	}))
+	if w := call(sse, "/api/v1/stream", "Accept-Encoding", "gzip"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != ": ping\n\n" {
+		t.Fatalf("event stream compressed: %v %q", w.Header(), w.Body.String())
+	}
+}
+
+func TestExport_CSVAndParquet(t *testing.T) {
+	// Scenario: two points with different metric sets exported as csv, parquet and an unknown format
+	// Expect: a column per metric with empty/null cells for missing ones, attachment headers, 400 for the bad format
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	items := []model.Telemetry{
+		{GPUId: "gpu:1", HostId: "h1", Timestamp: base, Metrics: map[string]float64{"temp": 70, "power": 250.5}},
+		{GPUId: "gpu:1", HostId: "h1", Timestamp: base.Add(time.Second), Metrics: map[string]float64{"temp": 71}},
+	}
+	srv := newServer(&fakeStore{tel: map[string][]model.Telemetry{"gpu:1": items}})
+
+	w := call(srv, "/api/v1/gpus/gpu:1/telemetry/export?format=csv")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Disposition") != `attachment; filename="gpu_1-telemetry.csv"` {
+		t.Fatalf("csv: %d %v", w.Code, w.Header())
+	}
+	want := "timestamp,gpu_id,host_id,power,temp\n" +
+		"2026-01-26T12:00:00Z,gpu:1,h1,250.5,70\n" +
+		"2026-01-26T12:00:01Z,gpu:1,h1,,71\n"
+	if w.Body.String() != want {
+		t.Fatalf("csv body:\n%s", w.Body.String())
+	}
+
+	w = call(srv, "/api/v1/gpus/gpu:1/telemetry/export?format=parquet")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != parquetContentType {
+		t.Fatalf("parquet: %d %v", w.Code, w.Header())
+	}
+	type row struct {
+		Timestamp time.Time `parquet:"timestamp,timestamp(millisecond)"`
+		GPUId     string    `parquet:"gpu_id"`
+		Power     *float64  `parquet:"power,optional"`
+		Temp      *float64  `parquet:"temp,optional"`
+	}
+	rows, err := parquet.Read[row](bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("read parquet: %v", err)
+	}
+	if len(rows) != 2 || !rows[1].Timestamp.Equal(base.Add(time.Second)) || rows[1].GPUId != "gpu:1" ||
+		rows[0].Power == nil || *rows[0].Power != 250.5 || rows[1].Power != nil || *rows[1].Temp != 71 {
+		t.Fatalf("parquet rows: %+v", rows)
+	}
+
+	if w := call(srv, "/api/v1/gpus/gpu:1/telemetry/export?format=xlsx"); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad format: %d", w.Code)
+	}
+}
+
+func TestProm_ExposesLatestPerGPU(t *testing.T) {
+	// Scenario: gpu-1 reported twice (one point labelled), gpu-2 only long ago
+	// Expect: gauges for gpu-1's latest values with its labels; gpu-2 left out as stale
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: now.Add(-time.Minute), Metrics: map[string]float64{"DCGM_FI_DEV_GPU_TEMP": 60}})
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: now, Metrics: map[string]float64{"DCGM_FI_DEV_GPU_TEMP": 65, "power.draw": 300}, Labels: map[string]string{"cluster": "c1"}})
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", HostId: "h2", Timestamp: now.Add(-time.Hour), Metrics: map[string]float64{"DCGM_FI_DEV_GPU_TEMP": 90}})
+
+	w := call(newServer(mem), "/api/v1/prom")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`DCGM_FI_DEV_GPU_TEMP{cluster="c1",gpu_id="gpu-1",host_id="h1"} 65`,
+		`power_draw{cluster="c1",gpu_id="gpu-1",host_id="h1"} 300`,
+		`gpu_telemetry_last_timestamp_seconds{gpu_id="gpu-1",host_id="h1"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %q in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "gpu-2") {
+		t.Fatalf("stale gpu exposed:\n%s", body)
+	}
+}
+
+// remoteRead posts req to /api/v1/read of a server over store.
+func remoteRead(store storage.Store, req *prompb.ReadRequest) *httptest.ResponseRecorder {
+	raw, _ := proto.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/read", bytes.NewReader(snappy.Encode(nil, raw)))
+	w := httptest.NewRecorder()
+	newServer(store).ServeHTTP(w, r)
+	return w
+}
+
+func decodeReadResponse(t *testing.T, w *httptest.ResponseRecorder) *prompb.ReadResponse {
+	t.Helper()
+	if w.Header().Get("Content-Encoding") != "snappy" {
+		t.Fatalf("remote read not snappy: %d %s", w.Code, w.Body.String())
+	}
+	out, err := snappy.Decode(nil, w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("snappy: %v", err)
+	}
+	var resp prompb.ReadResponse
+	if err := proto.Unmarshal(out, &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return &resp
+}
+
+func TestRemoteRead_ReturnsMatchingSeries(t *testing.T) {
+	// Scenario: two GPUs with temp and power; remote_read for temp on gpu-1 and for a regex over both GPUs
+	// Expect: one series per (metric, gpu) with /api/v1/prom labels and ms samples in time order
+	mem := storage.NewMemoryStore()
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		ts := base.Add(time.Duration(i) * time.Minute)
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: ts, Metrics: map[string]float64{"temp": float64(60 + i), "power": 200}})
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", HostId: "h2", Timestamp: ts, Metrics: map[string]float64{"temp": float64(80 + i)}})
+	}
+	read := func(req *prompb.ReadRequest) *prompb.ReadResponse {
+		t.Helper()
+		w := remoteRead(mem, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("remote read: %d %s", w.Code, w.Body.String())
+		}
+		return decodeReadResponse(t, w)
+	}
+	window := func(matchers ...*prompb.LabelMatcher) *prompb.Query {
+		return &prompb.Query{StartTimestampMs: base.UnixMilli(), EndTimestampMs: base.Add(90 * time.Second).UnixMilli(), Matchers: matchers}
+	}
+
+	resp := read(&prompb.ReadRequest{Queries: []*prompb.Query{
+		window(&prompb.LabelMatcher{Name: "__name__", Value: "temp"}, &prompb.LabelMatcher{Name: "gpu_id", Value: "gpu-1"}),
+		window(&prompb.LabelMatcher{Name: "__name__", Type: prompb.LabelMatcher_RE, Value: "temp|power"}, &prompb.LabelMatcher{Name: "gpu_id", Type: prompb.LabelMatcher_NEQ, Value: "gpu-1"}),
+	}})
+	if len(resp.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(resp.Results))
+	}
+	one := resp.Results[0].Timeseries
+	if len(one) != 1 || len(one[0].Samples) != 2 || one[0].Samples[1].Value != 61 || one[0].Samples[1].Timestamp != base.Add(time.Minute).UnixMilli() {
+		t.Fatalf("gpu-1 temp: %v", one)
+	}
+	var names []string
+	for _, l := range one[0].Labels {
+		names = append(names, l.Name+"="+l.Value)
+	}
+	if strings.Join(names, ",") != "__name__=temp,gpu_id=gpu-1,host_id=h1" {
+		t.Fatalf("labels: %v", names)
+	}
+	if two := resp.Results[1].Timeseries; len(two) != 1 || two[0].Samples[0].Value != 80 {
+		t.Fatalf("regex query: %v", two)
+	}
+}
+
+// limitStore records the Limit of every fleet query.
+type limitStore struct {
+	*storage.MemoryStore
+	limits []int
+}
+
+func (s *limitStore) QueryFleet(gpuIDs []string, q storage.Query) ([]model.Telemetry, error) {
+	s.limits = append(s.limits, q.Limit)
+	return storage.ExecuteFleet(s.MemoryStore, gpuIDs, q)
+}
+
+func TestRemoteRead_PromNamesAndSampleBudget(t *testing.T) {
+	// Scenario: metrics stored as gpu.temp and mem-used, read by their
+	// exposed names gpu_temp and mem_used; then a budget of 4 samples for a
+	// window of 6 points
+	// Expect: both series found; the store asked for at most 5 points and
+	// the query rejected
+	mem := storage.NewMemoryStore()
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		ts := base.Add(time.Duration(i) * time.Minute)
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: ts, Metrics: map[string]float64{"gpu.temp": float64(60 + i), "mem-used": 10}})
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", Timestamp: ts, Metrics: map[string]float64{"gpu.temp": 80}})
+	}
+	window := func(name string) *prompb.Query {
+		return &prompb.Query{StartTimestampMs: base.UnixMilli(), EndTimestampMs: base.Add(2 * time.Minute).UnixMilli(),
+			Matchers: []*prompb.LabelMatcher{{Name: "__name__", Value: name}}}
+	}
+	w := remoteRead(mem, &prompb.ReadRequest{Queries: []*prompb.Query{window("gpu_temp"), window("mem_used")}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("remote read: %d %s", w.Code, w.Body.String())
+	}
+	resp := decodeReadResponse(t, w)
+	if temp := resp.Results[0].Timeseries; len(temp) != 2 || len(temp[0].Samples) != 3 {
+		t.Fatalf("gpu_temp: %v", temp)
+	}
+	if used := resp.Results[1].Timeseries; len(used) != 1 || used[0].Samples[0].Value != 10 {
+		t.Fatalf("mem_used: %v", used)
+	}
+
+	old := maxRemoteReadSamples
+	maxRemoteReadSamples = 4
+	defer func() { maxRemoteReadSamples = old }()
+	st := &limitStore{MemoryStore: mem}
+	if w := remoteRead(st, &prompb.ReadRequest{Queries: []*prompb.Query{window("gpu_temp")}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("over budget: %d %s", w.Code, w.Body.String())
+	}
+	if len(st.limits) != 1 || st.limits[0] != 5 {
+		t.Fatalf("store limits %v, want [5]", st.limits)
+	}
+}
+
+func TestQueryExpr_InstantAndRange(t *testing.T) {
+	// Scenario: one GPU's temp once a minute; an instant avg_over_time, a range query and bad input
+	// Expect: vector and matrix results, 400 for syntax errors, 422 for a non-finite scalar
+	mem := storage.NewMemoryStore()
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	for i := 0; i <= 10; i++ {
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: base.Add(time.Duration(i) * time.Minute), Metrics: map[string]float64{"temp": float64(60 + i)}})
+	}
+	srv := newServer(mem)
+	at := base.Add(10 * time.Minute).Format(time.RFC3339)
+	q := url.Values{"expr": {`avg_over_time(temp{gpu_id="gpu-1"}[5m]) - 60`}, "time": {at}}
+	w := call(srv, "/api/v1/query?"+q.Encode())
+	var inst struct {
+		Type   string
+		Result []struct {
+			Labels map[string]string
+			Value  float64
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &inst); err != nil || inst.Type != "vector" || len(inst.Result) != 1 ||
+		inst.Result[0].Value != 8 || inst.Result[0].Labels["gpu_id"] != "gpu-1" {
+		t.Fatalf("instant: %d %s", w.Code, w.Body.String())
+	}
+
+	q = url.Values{"expr": {"temp"}, "start_time": {base.Format(time.RFC3339)}, "end_time": {at}, "step": {"5m"}}
+	w = call(srv, "/api/v1/query?"+q.Encode())
+	var rng struct {
+		Type   string
+		Result []struct{ Points []struct{ Value float64 } }
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &rng); err != nil || rng.Type != "matrix" || len(rng.Result) != 1 || len(rng.Result[0].Points) != 3 ||
+		rng.Result[0].Points[2].Value != 70 {
+		t.Fatalf("range: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := call(srv, "/api/v1/query?"+url.Values{"expr": {"temp{"}}.Encode()); w.Code != http.StatusBadRequest {
+		t.Fatalf("syntax error: %d", w.Code)
+	}
+	if w := call(srv, "/api/v1/query?"+url.Values{"expr": {"1/0"}}.Encode()); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("1/0: %d %s", w.Code, w.Body.String())
+	}
+	q = url.Values{"expr": {"temp"}, "start_time": {base.Format(time.RFC3339)}, "end_time": {at}, "step": {"1s"}}
+	if w := call(srv, "/api/v1/query?"+q.Encode()); w.Code != http.StatusOK {
+		t.Fatalf("601 steps: %d", w.Code)
+	}
+	q.Set("start_time", base.Add(-24*time.Hour).Format(time.RFC3339))
+	if w := call(srv, "/api/v1/query?"+q.Encode()); w.Code != http.StatusBadRequest {
+		t.Fatalf("too many steps: %d", w.Code)
+	}
+}
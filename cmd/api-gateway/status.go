@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"gpu-metric-collector/internal/storage"
+)
+
+// defaultStaleAfter is how long a GPU may go without data before
+// /api/v1/gpus/status calls it stale.
+const defaultStaleAfter = 5 * time.Minute
+
+// gpuStatus is one GPU's entry in the fleet status. LastSeen and AgeSeconds
+// are absent for a GPU that is listed but has no readable point.
+type gpuStatus struct {
+	GPUId      string             `json:"gpu_id"`
+	HostId     string             `json:"host_id,omitempty"`
+	LastSeen   *time.Time         `json:"last_seen,omitempty"`
+	AgeSeconds *float64           `json:"age_seconds,omitempty"`
+	Stale      bool               `json:"stale"`
+	Metrics    map[string]float64 `json:"metrics,omitempty"`
+}
+
+// fleetStatus is the /api/v1/gpus/status response.
+type fleetStatus struct {
+	Total             int         `json:"total"`
+	Stale             int         `json:"stale"`
+	StaleAfterSeconds float64     `json:"stale_after_seconds"`
+	GPUs              []gpuStatus `json:"gpus"`
+}
+
+// statusHandler reports every GPU's last-seen time, staleness and latest
+// metric values (all of them, or those named by metrics), ordered by gpu_id.
+func statusHandler(store storage.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		v := r.URL.Query()
+		staleAfter := defaultStaleAfter
+		if s := pStaleAfter.get(v); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d < minStep {
+				writeError(w, r, http.StatusBadRequest, codeInvalidParameter, "invalid stale_after (want a duration of at least 1s, e.g. 5m)")
+				return
+			}
+			staleAfter = d
+		}
+		metrics := pStatusMetrics.get(v)
+		if metrics == "" {
+			metrics = pMetric.get(v)
+		}
+		keep := parseList(metrics)
+
+		store := storeFor(r.Context(), store)
+		ids, err := store.ListGPUs()
+		if err != nil {
+			writeStoreError(w, r, err, "status list gpus error")
+			return
+		}
+		latest, err := storage.LatestMany(store, ids, nil)
+		if err != nil {
+			writeStoreError(w, r, err, "status latest error")
+			return
+		}
+
+		now := time.Now()
+		res := fleetStatus{Total: len(ids), StaleAfterSeconds: staleAfter.Seconds(), GPUs: make([]gpuStatus, 0, len(ids))}
+		for _, id := range ids {
+			st := gpuStatus{GPUId: id, Stale: true}
+			if it := latest[id]; it != nil {
+				ts := it.Timestamp.UTC()
+				age := now.Sub(ts).Seconds()
+				st.HostId, st.LastSeen, st.AgeSeconds = it.HostId, &ts, &age
+				st.Stale = now.Sub(ts) > staleAfter
+				st.Metrics = it.Metrics
+				if len(keep) > 0 {
+					st.Metrics = map[string]float64{}
+					for _, m := range keep {
+						if val, ok := it.Metrics[m]; ok {
+							st.Metrics[m] = val
+						}
+					}
+				}
+			}
+			if st.Stale {
+				res.Stale++
+			}
+			res.GPUs = append(res.GPUs, st)
+		}
+		sort.Slice(res.GPUs, func(i, j int) bool { return res.GPUs[i].GPUId < res.GPUs[j].GPUId })
+		writeJSON(w, http.StatusOK, res)
+	})
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+// Stream settings; vars so tests can shorten them and main can set the poll
+// interval from a flag.
+var (
+	streamPoll      = time.Second
+	streamHeartbeat = 15 * time.Second
+	streamClientBuf = 256
+)
+
+const maxStreamGPUs = 100
+
+// streamHub fans new telemetry out to Server-Sent Events clients. Each
+// watched GPU has one poller, shared by all of its clients, that queries the
+// store for points after the last one it saw; it stops with its last client.
+type streamHub struct {
+	store storage.Store
+
+	mu      sync.Mutex
+	watches map[string]*gpuWatch
+}
+
+type gpuWatch struct {
+	subs  map[*streamClient]struct{}
+	stop  chan struct{}
+	ready chan struct{} // closed once the poller has its starting position
+}
+
+// streamClient receives points from the pollers of every GPU it watches.
+// When it falls streamClientBuf points behind, overflow is closed and the
+// handler ends the stream so the browser reconnects.
+type streamClient struct {
+	ch       chan model.Telemetry
+	overflow chan struct{}
+	once     sync.Once
+	scope    *storage.Scope // tenant scope; nil sees everything
+}
+
+func (c *streamClient) send(t model.Telemetry) {
+	if c.scope != nil && !c.scope.Allows(t) {
+		return
+	}
+	select {
+	case c.ch <- t:
+	default:
+		c.once.Do(func() { close(c.overflow) })
+	}
+}
+
+func newStreamHub(store storage.Store) *streamHub {
+	return &streamHub{store: store, watches: map[string]*gpuWatch{}}
+}
+
+// subscribe adds c to gpuID's poller, starting one if needed, and returns a
+// channel closed once the poller will deliver everything stored from then on.
+func (h *streamHub) subscribe(gpuID string, c *streamClient) <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w := h.watches[gpuID]
+	if w == nil {
+		w = &gpuWatch{subs: map[*streamClient]struct{}{}, stop: make(chan struct{}), ready: make(chan struct{})}
+		h.watches[gpuID] = w
+		go h.poll(gpuID, w)
+	}
+	w.subs[c] = struct{}{}
+	return w.ready
+}
+
+func (h *streamHub) unsubscribe(gpuID string, c *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w := h.watches[gpuID]
+	if w == nil {
+		return
+	}
+	delete(w.subs, c)
+	if len(w.subs) == 0 {
+		close(w.stop)
+		delete(h.watches, gpuID)
+	}
+}
+
+// streamCursor remembers the newest timestamp delivered and how many points
+// at it, so a poll starting at that timestamp skips exactly those.
+type streamCursor struct {
+	last time.Time
+	skip int
+}
+
+// next returns the points stored after the cursor and advances it. Points
+// that arrive late with older timestamps are not seen.
+func (c *streamCursor) next(store storage.Store, gpuID string) ([]model.Telemetry, error) {
+	var q storage.Query
+	if !c.last.IsZero() {
+		q.Start = &c.last
+	}
+	items, err := storage.Execute(store, gpuID, q)
+	if err != nil {
+		return nil, err
+	}
+	if c.skip > len(items) {
+		c.skip = len(items)
+	}
+	items = items[c.skip:]
+	for _, it := range items {
+		if it.Timestamp.Equal(c.last) {
+			c.skip++
+		} else {
+			c.last, c.skip = it.Timestamp, 1
+		}
+	}
+	return items, nil
+}
+
+func (h *streamHub) poll(gpuID string, w *gpuWatch) {
+	var cur streamCursor
+	// start at the newest stored point; clients get it from the handler
+	if it, err := storage.Latest(h.store, gpuID); err == nil && it != nil {
+		cur.last = it.Timestamp
+		_, _ = cur.next(h.store, gpuID)
+	}
+	close(w.ready)
+	t := time.NewTicker(streamPoll)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-t.C:
+		}
+		items, err := cur.next(h.store, gpuID)
+		if err != nil {
+			log.Printf("api: stream poll error gpu=%s: %v", gpuID, err)
+			continue
+		}
+		if len(items) == 0 {
+			continue
+		}
+		h.mu.Lock()
+		for c := range w.subs {
+			for _, it := range items {
+				c.send(it)
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// ServeHTTP streams telemetry of the GPUs in ?gpu_id= (comma-separated) as
+// "telemetry" events, starting with each GPU's latest point. A point saved
+// while the client connects may be sent twice.
+func (h *streamHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+	gpuIDs := parseList(pStreamGPUs.get(r.URL.Query()))
+	if len(gpuIDs) == 0 || len(gpuIDs) > maxStreamGPUs {
+		writeErrorDetails(w, r, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("gpu_id required (comma-separated, at most %d)", maxStreamGPUs), map[string]any{"max_gpu_ids": maxStreamGPUs})
+		return
+	}
+	metrics := pStreamMetrics.get(r.URL.Query())
+	if metrics == "" {
+		metrics = pMetric.get(r.URL.Query())
+	}
+	names := parseList(metrics)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "streaming unsupported")
+		return
+	}
+
+	c := &streamClient{ch: make(chan model.Telemetry, streamClientBuf), overflow: make(chan struct{}), scope: scopeFrom(r.Context())}
+	for _, id := range gpuIDs {
+		ready := h.subscribe(id, c)
+		defer h.unsubscribe(id, c)
+		select {
+		case <-ready:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx: do not buffer the stream
+	w.WriteHeader(http.StatusOK)
+	write := func(t model.Telemetry) bool {
+		items := storage.FilterMetrics([]model.Telemetry{t}, names)
+		if len(items) == 0 {
+			return true
+		}
+		b, _ := json.Marshal(items[0])
+		_, err := fmt.Fprintf(w, "event: telemetry\ndata: %s\n\n", b)
+		return err == nil
+	}
+	// one store call for every GPU's newest point; what it found is sent even
+	// if some GPUs failed
+	latest, _ := storage.LatestMany(storeFor(r.Context(), h.store), gpuIDs, nil)
+	for _, id := range gpuIDs {
+		if it := latest[id]; it != nil && !write(*it) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	hb := time.NewTicker(streamHeartbeat)
+	defer hb.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c.overflow:
+			_, _ = fmt.Fprint(w, "event: overflow\ndata: {}\n\n")
+			flusher.Flush()
+			return
+		case <-hb.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case t := <-c.ch:
+			if !write(t) {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
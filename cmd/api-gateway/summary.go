@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gpu-metric-collector/internal/storage"
+)
+
+// defaultSummaryWindow is the look-back of a summary without window.
+const defaultSummaryWindow = 24 * time.Hour
+
+// gpuSummary is the /api/v1/gpus/{id}/summary response.
+type gpuSummary struct {
+	GPUId   string                           `json:"gpu_id"`
+	Start   time.Time                        `json:"start"`
+	End     time.Time                        `json:"end"`
+	Metrics map[string]storage.MetricSummary `json:"metrics"`
+}
+
+// parseSummary reads the summary window, which ends now, and the metrics to
+// summarize (all when empty).
+func parseSummary(v url.Values, now time.Time) (time.Time, []string, error) {
+	window := defaultSummaryWindow
+	if s := pSummaryWindow.get(v); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < minStep {
+			return time.Time{}, nil, errors.New("invalid window (want a duration of at least 1s, e.g. 24h)")
+		}
+		window = d
+	}
+	return now.Add(-window), parseList(aliased(v, pSummaryMetrics, pMetric)), nil
+}
+
+// serveSummary answers GET /api/v1/gpus/{id}/summary, summarized by the
+// store where it can.
+func serveSummary(w http.ResponseWriter, r *http.Request, store storage.Store, gpuID string) {
+	end := time.Now().UTC()
+	start, metrics, err := parseSummary(r.URL.Query(), end)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	sums, err := storage.Summarize(store, gpuID, storage.Query{Start: &start, End: &end, Metrics: metrics})
+	if err != nil {
+		writeStoreError(w, r, err, "summary error gpu=%s", gpuID)
+		return
+	}
+	if len(sums) == 0 {
+		writeError(w, r, http.StatusNotFound, codeGPUNotFound, fmt.Sprintf("no telemetry for gpu %s in the window", gpuID))
+		return
+	}
+	writeJSON(w, http.StatusOK, gpuSummary{GPUId: gpuID, Start: start, End: end, Metrics: sums})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestSummary_PerMetricStats(t *testing.T) {
+	// Scenario: gpu-1 reports temp 41..60 and util 80 once a minute over the
+	// last 20 minutes, and temp 99 two hours ago
+	// Expect: both metrics summarized over the default 24h, the old point
+	// dropped by window=1h, only temp with metrics=temp; 400 for a bad
+	// window; 404 for a GPU without data in the window
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	for i := 0; i < 20; i++ {
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: now.Add(-time.Duration(i+1) * time.Minute),
+			Metrics: map[string]float64{"temp": float64(60 - i), "util": 80}})
+	}
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: now.Add(-2 * time.Hour), Metrics: map[string]float64{"temp": 99}})
+	h := newServer(mem)
+
+	get := func(path string) gpuSummary {
+		t.Helper()
+		w := call(h, path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, w.Code, w.Body.String())
+		}
+		var s gpuSummary
+		if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return s
+	}
+	if s := get("/api/v1/gpus/gpu-1/summary"); len(s.Metrics) != 2 || s.Metrics["temp"].Count != 21 || s.Metrics["temp"].Max != 99 || s.Metrics["util"].Mean != 80 {
+		t.Fatalf("24h: %+v", s)
+	}
+	s := get("/api/v1/gpus/gpu-1/summary?window=1h&metrics=temp")
+	if temp := s.Metrics["temp"]; len(s.Metrics) != 1 || temp.Count != 20 || temp.Min != 41 || temp.Max != 60 || temp.Mean != 50.5 || temp.P95 != 59 {
+		t.Fatalf("1h temp: %+v", s)
+	}
+	if s.GPUId != "gpu-1" || s.End.Sub(s.Start) != time.Hour {
+		t.Fatalf("window: %+v", s)
+	}
+	if w := call(h, "/api/v1/gpus/gpu-1/summary?window=soon"); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad window: %d", w.Code)
+	}
+	if w := call(h, "/api/v1/gpus/gpu-2/summary"); w.Code != http.StatusNotFound {
+		t.Fatalf("no data: %d", w.Code)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"gpu-metric-collector/internal/storage"
+)
+
+// tenant is one team's slice of the fleet. Callers are matched by subject
+// (API key name or JWT sub) or, with -tenant_claim, by a JWT claim naming
+// the tenant.
+type tenant struct {
+	Name     string   `json:"name"`
+	Subjects []string `json:"subjects"`
+	Hosts    []string `json:"hosts"`
+	Clusters []string `json:"clusters"`
+	// All sees the whole fleet (operators).
+	All bool `json:"all"`
+}
+
+// tenants resolves callers to scopes; see loadTenants for the file format.
+type tenants struct {
+	claim     string
+	byName    map[string]*tenant
+	bySubject map[string]*tenant
+}
+
+// loadTenants reads {"tenants":[{"name":"ml","subjects":["grafana-ml"],
+// "hosts":["node-1"],"clusters":["c1"]}]}. A subject may belong to one
+// tenant only.
+func loadTenants(path, claim string) (*tenants, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tenants: %w", err)
+	}
+	var f struct {
+		Tenants []*tenant `json:"tenants"`
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("parse tenants %s: %w", path, err)
+	}
+	t := &tenants{claim: claim, byName: map[string]*tenant{}, bySubject: map[string]*tenant{}}
+	for i, tn := range f.Tenants {
+		if tn.Name == "" {
+			return nil, fmt.Errorf("tenants %s: entry %d has no name", path, i)
+		}
+		if t.byName[tn.Name] != nil {
+			return nil, fmt.Errorf("tenants %s: duplicate tenant %q", path, tn.Name)
+		}
+		t.byName[tn.Name] = tn
+		for _, s := range tn.Subjects {
+			if prev := t.bySubject[s]; prev != nil {
+				return nil, fmt.Errorf("tenants %s: subject %q is in both %q and %q", path, s, prev.Name, tn.Name)
+			}
+			t.bySubject[s] = tn
+		}
+	}
+	return t, nil
+}
+
+// lookup returns id's tenant, by claim first, or nil.
+func (t *tenants) lookup(id *identity) *tenant {
+	if t.claim != "" && id.Claims != nil {
+		if name, ok := id.Claims[t.claim].(string); ok && t.byName[name] != nil {
+			return t.byName[name]
+		}
+	}
+	return t.bySubject[id.Subject]
+}
+
+type (
+	scopeKey  struct{}
+	tenantKey struct{}
+)
+
+// storeFor returns store bound to the request context, limited to the
+// caller's tenant scope, if any, and without the result cache if the caller
+// asked to bypass it.
+func storeFor(ctx context.Context, store storage.Store) storage.Store {
+	store = storage.WithContext(ctx, uncached(ctx, store))
+	if sc, ok := ctx.Value(scopeKey{}).(*storage.Scope); ok {
+		return storage.Scoped(store, *sc)
+	}
+	return store
+}
+
+// scopeFrom returns the caller's tenant scope, or nil when unscoped.
+func scopeFrom(ctx context.Context) *storage.Scope {
+	sc, _ := ctx.Value(scopeKey{}).(*storage.Scope)
+	return sc
+}
+
+// tenantFrom returns the name of the caller's tenant, or "" when unscoped
+// (no tenants configured, or a tenant that sees the whole fleet).
+func tenantFrom(ctx context.Context) string {
+	name, _ := ctx.Value(tenantKey{}).(string)
+	return name
+}
+
+// scopeFor resolves a tenant name to its scope, nil for tenants that see
+// the whole fleet; false means there is no such tenant.
+func (t *tenants) scopeFor(name string) (*storage.Scope, bool) {
+	if name == "" {
+		return nil, true
+	}
+	tn := t.byName[name]
+	if tn == nil {
+		return nil, false
+	}
+	if tn.All {
+		return nil, true
+	}
+	return &storage.Scope{HostIDs: tn.Hosts, Clusters: tn.Clusters}, true
+}
+
+// wrap attaches the caller's scope to protected requests and rejects
+// callers without a tenant. It must run after authentication.
+func (t *tenants) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !protectedPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id := identityFrom(r.Context())
+		if id == nil {
+			writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "missing or invalid credentials")
+			return
+		}
+		ctx, ok := t.attach(r.Context(), id)
+		if !ok {
+			writeError(w, r, http.StatusForbidden, codeForbidden, "caller has no tenant")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// attach returns ctx carrying id's tenant and scope (none for a tenant that
+// sees the whole fleet), or false when id has no tenant.
+func (t *tenants) attach(ctx context.Context, id *identity) (context.Context, bool) {
+	tn := t.lookup(id)
+	if tn == nil {
+		log.Printf("api: no tenant for sub=%s auth=%s", id.Subject, id.Method)
+		return ctx, false
+	}
+	if tn.All {
+		return ctx, true
+	}
+	sc, _ := t.scopeFor(tn.Name)
+	ctx = context.WithValue(ctx, scopeKey{}, sc)
+	return context.WithValue(ctx, tenantKey{}, tn.Name), true
+}
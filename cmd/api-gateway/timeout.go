@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// withTimeout gives each protected request a deadline that bounds its store
+// calls. Streams are left alone: they are meant to stay open.
+func withTimeout(d time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d <= 0 || !protectedPath(r.URL.Path) || r.URL.Path == "/api/v1/stream" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// writeStoreError answers a failed store call: 504 when the request's
+// deadline passed, nothing when the client went away (there is nobody to
+// answer), and 500 otherwise. format and args describe the call in the log,
+// tagged with the request id so it can be matched to the error body.
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error, format string, args ...any) {
+	what := fmt.Sprintf(format, args...)
+	ctxErr := r.Context().Err()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctxErr, context.DeadlineExceeded):
+		logRequestf(r, "%s: timed out: %v", what, err)
+		writeError(w, r, http.StatusGatewayTimeout, codeStoreTimeout, "store query timed out")
+	case errors.Is(err, context.Canceled) || errors.Is(ctxErr, context.Canceled):
+		logRequestf(r, "%s: client went away", what)
+	default:
+		logRequestf(r, "%s: %v", what, err)
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "internal error")
+	}
+}
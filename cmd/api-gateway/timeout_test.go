@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/storage"
+)
+
+// slowStore blocks every listing until its bound context is done.
+type slowStore struct {
+	*storage.MemoryStore
+	ctx context.Context
+}
+
+func (s *slowStore) WithContext(ctx context.Context) storage.Store {
+	return &slowStore{MemoryStore: s.MemoryStore, ctx: ctx}
+}
+
+func (s *slowStore) ListGPUs() ([]string, error) {
+	if s.ctx == nil {
+		return nil, nil
+	}
+	<-s.ctx.Done()
+	return nil, s.ctx.Err()
+}
+
+func TestTimeout_SlowStoreGets504(t *testing.T) {
+	// Scenario: a store that never answers and a 20ms request timeout
+	// Expect: the request context reaches the store, which gives up; the client gets 504
+	srv := withTimeout(20*time.Millisecond, newServer(&slowStore{MemoryStore: storage.NewMemoryStore()}))
+	start := time.Now()
+	w := call(srv, "/api/v1/gpus")
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d %s", w.Code, w.Body.String())
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("request took %s", time.Since(start))
+	}
+}
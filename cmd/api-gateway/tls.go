@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Client certificate policies for -tls_client_auth.
+const (
+	clientAuthRequire  = "require"
+	clientAuthOptional = "optional"
+)
+
+// tlsSettings is how the gateway terminates TLS itself. The zero value
+// serves plain HTTP.
+type tlsSettings struct {
+	CertFile, KeyFile string
+	// ClientCAFile, if set, verifies client certificates against this CA;
+	// ClientAuth says whether clients must present one.
+	ClientCAFile string
+	ClientAuth   string
+	// HSTS is the Strict-Transport-Security max-age; 0 sends none.
+	HSTS time.Duration
+}
+
+func (s tlsSettings) enabled() bool { return s.CertFile != "" || s.KeyFile != "" }
+
+// config returns a TLS 1.2+ server config limited to forward-secret AEAD
+// suites. HTTP/2 is negotiated by net/http on top of it.
+func (s tlsSettings) config() (*tls.Config, error) {
+	if s.CertFile == "" || s.KeyFile == "" {
+		return nil, errors.New("tls cert and key must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load tls cert: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates:     []tls.Certificate{cert},
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		// TLS 1.3 suites are not configurable and all qualify
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+	if s.ClientCAFile == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(s.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client ca file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client ca file %s: no certificates found", s.ClientCAFile)
+	}
+	cfg.ClientCAs = pool
+	switch s.ClientAuth {
+	case "", clientAuthRequire:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	case clientAuthOptional:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("tls client auth must be %s or %s, got %q", clientAuthRequire, clientAuthOptional, s.ClientAuth)
+	}
+	return cfg, nil
+}
+
+// withHSTS tells browsers to use HTTPS for the next maxAge.
+func withHSTS(maxAge time.Duration, next http.Handler) http.Handler {
+	if maxAge <= 0 {
+		return next
+	}
+	value := "max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+		next.ServeHTTP(w, r)
+	})
+}
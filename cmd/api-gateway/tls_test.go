@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for tls tests and writes them as PEM files.
+type testCA struct {
+	t    *testing.T
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test ca"}, IsCA: true, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("ca: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	ca := &testCA{t: t, dir: t.TempDir(), cert: cert, key: key, pool: x509.NewCertPool()}
+	ca.pool.AddCert(cert)
+	ca.write("ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) write(name, typ string, der []byte) string {
+	path := filepath.Join(ca.dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		ca.t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+// issue returns the cert and key files of a certificate named name.
+func (ca *testCA) issue(name string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(time.Now().UnixNano()), Subject: pkix.Name{CommonName: name},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}, ExtKeyUsage: []x509.ExtKeyUsage{usage},
+		KeyUsage: x509.KeyUsageDigitalSignature, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		ca.t.Fatalf("issue %s: %v", name, err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return ca.write(name+".pem", "CERTIFICATE", der), ca.write(name+"-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func TestTLS_ServesHTTP2WithHSTSAndClientCerts(t *testing.T) {
+	// Scenario: the gateway's TLS config with a client CA (required), served
+	// with net/http; a client with a CA-issued cert, then one without
+	// Expect: HTTP/2 over TLS 1.2+ with the HSTS header; the handshake fails
+	// without a client cert; bad settings are rejected
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue("gateway", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue("grafana", x509.ExtKeyUsageClientAuth)
+	settings := tlsSettings{CertFile: certFile, KeyFile: keyFile, ClientCAFile: filepath.Join(ca.dir, "ca.pem"), HSTS: time.Hour}
+	cfg, err := settings.config()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: withHSTS(settings.HSTS, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})), TLSConfig: cfg}
+	go func() { _ = srv.ServeTLS(lis, "", "") }()
+	defer srv.Close()
+	url := "https://" + lis.Addr().String() + "/healthz"
+
+	pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("client cert: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{ForceAttemptHTTP2: true,
+		TLSClientConfig: &tls.Config{RootCAs: ca.pool, Certificates: []tls.Certificate{pair}}}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Fatalf("want HTTP/2 over TLS, got %s", resp.Proto)
+	}
+	if got := resp.Header.Get("Strict-Transport-Security"); got != "max-age=3600" {
+		t.Fatalf("hsts: %q", got)
+	}
+
+	anon := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool}}}
+	if resp, err := anon.Get(url); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the handshake to fail without a client cert")
+	}
+
+	for _, bad := range []tlsSettings{
+		{CertFile: certFile},
+		{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile + ".missing"},
+		{CertFile: certFile, KeyFile: keyFile, ClientCAFile: filepath.Join(ca.dir, "ca.pem"), ClientAuth: "sometimes"},
+	} {
+		if _, err := bad.config(); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the gateway's spans. Until tracing.Setup installs a
+// provider (-otlp_traces_endpoint) it is a no-op.
+var tracer = otel.Tracer("gpu-metric-collector/api-gateway")
+
+// withTracing starts a server span per request, named after its method and
+// route template and continuing the caller's trace from a traceparent header.
+// Store calls and broker publishes made for the request are its children.
+func withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeLabel(r.URL.Path)
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("request.id", requestIDFrom(r.Context())),
+		))
+		defer span.End()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetAttributes(attribute.Int("http.response.status_code", sw.status()))
+		if sw.status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status()))
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing_RequestAndStoreSpans(t *testing.T) {
+	// Scenario: a latest query carrying a caller's traceparent, traced into a recorder
+	// Expect: a server span named after the route template in the caller's trace,
+	// with the status code, and a store.latest span as its child
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	mem := storage.NewMemoryStore()
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: time.Now().UTC(), Metrics: map[string]float64{"temp": 60}})
+	h := withTracing(newServer(newInstrumentedStore(mem)))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	if w := call(h, "/api/v1/gpus/gpu-1/latest", "traceparent", "00-"+traceID+"-00f067aa0ba902b7-01"); w.Code != http.StatusOK {
+		t.Fatalf("latest: %d %s", w.Code, w.Body.String())
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	store, server := spans[0], spans[1]
+	if server.Name() != "GET /api/v1/gpus/{id}/latest" || server.SpanContext().TraceID().String() != traceID || server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("server span: %s trace=%s parent=%s", server.Name(), server.SpanContext().TraceID(), server.Parent().SpanID())
+	}
+	var status attribute.Value
+	for _, kv := range server.Attributes() {
+		if kv.Key == "http.response.status_code" {
+			status = kv.Value
+		}
+	}
+	if status.AsInt64() != http.StatusOK {
+		t.Fatalf("status attribute: %v", server.Attributes())
+	}
+	if store.Name() != "store.latest" || store.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Fatalf("store span: %s parent=%s", store.Name(), store.Parent().SpanID())
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// uiFiles is the dashboard at /ui: static files that call the JSON API from
+// the browser, sending the API key the user saved there.
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the dashboard. Like /docs it needs no credentials; the
+// data it shows is fetched, and authorized, through /api/v1.
+func uiHandler() http.Handler {
+	sub, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err) // the embedded tree always has ui
+	}
+	files := http.StripPrefix("/ui/", http.FileServer(http.FS(sub)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ui" {
+			http.Redirect(w, r, "/ui/", http.StatusMovedPermanently)
+			return
+		}
+		// only our own scripts and styles, and API calls to this origin
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		files.ServeHTTP(w, r)
+	})
+}
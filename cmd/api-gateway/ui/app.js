@@ -0,0 +1,184 @@
+// Dashboard for the gateway's JSON API: the fleet from /api/v1/gpus/status,
+// and one GPU's latest values and a downsampled series of one metric.
+'use strict';
+
+const REFRESH_MS = 15000;
+const CHART_POINTS = 240; // buckets per window
+const W = 800, H = 300, PAD = { left: 56, right: 12, top: 12, bottom: 24 };
+const WINDOW_SECONDS = { '15m': 900, '1h': 3600, '6h': 21600, '24h': 86400, '168h': 604800 };
+
+const $ = (id) => document.getElementById(id);
+const state = { gpus: [], selected: null, metric: '' };
+
+async function api(path) {
+  const headers = {};
+  const key = localStorage.getItem('apiKey');
+  if (key) headers['X-API-Key'] = key;
+  const resp = await fetch(path, { headers });
+  if (!resp.ok) {
+    let msg = resp.status + ' ' + resp.statusText;
+    try {
+      const body = await resp.json();
+      if (body.message) msg = body.message + ' (' + body.code + ')';
+    } catch (e) { /* not the error envelope */ }
+    throw new Error(msg);
+  }
+  return resp.json();
+}
+
+function showError(err) {
+  $('error').textContent = err ? String(err.message || err) : '';
+}
+
+function age(seconds) {
+  if (seconds == null) return 'never';
+  if (seconds < 90) return Math.round(seconds) + 's ago';
+  if (seconds < 5400) return Math.round(seconds / 60) + 'm ago';
+  if (seconds < 129600) return Math.round(seconds / 3600) + 'h ago';
+  return Math.round(seconds / 86400) + 'd ago';
+}
+
+function fmt(v) {
+  if (!isFinite(v)) return String(v);
+  const a = Math.abs(v);
+  if (a !== 0 && (a >= 1e6 || a < 1e-2)) return v.toExponential(2);
+  return Number(v.toFixed(2)).toString();
+}
+
+async function loadFleet() {
+  const status = await api('/api/v1/gpus/status');
+  state.gpus = status.gpus || [];
+  $('summary').textContent = status.total + ' GPUs, ' + status.stale + ' stale';
+  renderFleet();
+  if (state.selected) {
+    const g = state.gpus.find((x) => x.gpu_id === state.selected);
+    if (g) renderLatest(g);
+  }
+}
+
+function renderFleet() {
+  const filter = $('filter').value.trim().toLowerCase();
+  const body = $('gpus');
+  body.replaceChildren();
+  for (const g of state.gpus) {
+    if (filter && !g.gpu_id.toLowerCase().includes(filter) && !(g.host_id || '').toLowerCase().includes(filter)) continue;
+    const tr = document.createElement('tr');
+    for (const text of [g.gpu_id, g.host_id || '', g.stale ? 'stale, ' + age(g.age_seconds) : age(g.age_seconds)]) {
+      const td = document.createElement('td');
+      td.textContent = text;
+      tr.appendChild(td);
+    }
+    tr.classList.toggle('stale', g.stale);
+    tr.classList.toggle('selected', g.gpu_id === state.selected);
+    tr.addEventListener('click', () => select(g.gpu_id));
+    body.appendChild(tr);
+  }
+}
+
+function renderLatest(g) {
+  $('gpu-title').textContent = g.gpu_id + (g.host_id ? ' on ' + g.host_id : '') + ' – ' + age(g.age_seconds);
+  const latest = $('latest');
+  latest.replaceChildren();
+  const names = Object.keys(g.metrics || {}).sort();
+  for (const name of names) {
+    const div = document.createElement('div');
+    div.className = 'value';
+    const label = document.createElement('span');
+    label.textContent = name;
+    const value = document.createElement('b');
+    value.textContent = fmt(g.metrics[name]);
+    div.append(label, value);
+    latest.appendChild(div);
+  }
+  const select = $('metric');
+  if (select.options.length !== names.length || names.some((n, i) => select.options[i].value !== n)) {
+    select.replaceChildren(...names.map((n) => new Option(n, n)));
+  }
+  if (!names.includes(state.metric)) state.metric = names[0] || '';
+  select.value = state.metric;
+}
+
+function select(id) {
+  state.selected = id;
+  location.hash = encodeURIComponent(id);
+  $('detail').hidden = false;
+  renderFleet();
+  const g = state.gpus.find((x) => x.gpu_id === id);
+  if (g) renderLatest(g);
+  loadChart().catch(showError);
+}
+
+async function loadChart() {
+  const id = state.selected, metric = state.metric, win = $('window').value;
+  const svg = $('chart');
+  if (!id || !metric) {
+    svg.replaceChildren();
+    $('chart-note').textContent = 'No metrics reported.';
+    return;
+  }
+  const step = Math.max(1, Math.ceil(WINDOW_SECONDS[win] / CHART_POINTS));
+  const params = new URLSearchParams({ start: '-' + win, step: step + 's', metrics: metric });
+  const items = await api('/api/v1/gpus/' + encodeURIComponent(id) + '/telemetry?' + params);
+  if (id !== state.selected || metric !== state.metric) return; // selection changed meanwhile
+  const points = items
+    .filter((it) => it.metrics && metric in it.metrics)
+    .map((it) => [Date.parse(it.timestamp), it.metrics[metric]]);
+  $('chart-note').textContent = points.length + ' points, mean per ' + step + 's over the last ' + win;
+  drawChart(svg, points, Date.now() - WINDOW_SECONDS[win] * 1000, Date.now());
+}
+
+function svgEl(name, attrs, text) {
+  const el = document.createElementNS('http://www.w3.org/2000/svg', name);
+  for (const [k, v] of Object.entries(attrs)) el.setAttribute(k, v);
+  if (text != null) el.textContent = text;
+  return el;
+}
+
+function drawChart(svg, points, t0, t1) {
+  svg.replaceChildren();
+  if (points.length === 0) {
+    svg.appendChild(svgEl('text', { x: W / 2, y: H / 2, 'text-anchor': 'middle' }, 'No data in this window'));
+    return;
+  }
+  let lo = Math.min(...points.map((p) => p[1]));
+  let hi = Math.max(...points.map((p) => p[1]));
+  if (lo === hi) { lo -= 1; hi += 1; }
+  const x = (t) => PAD.left + (t - t0) / (t1 - t0) * (W - PAD.left - PAD.right);
+  const y = (v) => H - PAD.bottom - (v - lo) / (hi - lo) * (H - PAD.top - PAD.bottom);
+
+  for (let i = 0; i <= 4; i++) {
+    const v = lo + (hi - lo) * i / 4;
+    svg.appendChild(svgEl('line', { x1: PAD.left, x2: W - PAD.right, y1: y(v), y2: y(v) }));
+    svg.appendChild(svgEl('text', { x: PAD.left - 6, y: y(v) + 4, 'text-anchor': 'end' }, fmt(v)));
+  }
+  for (let i = 0; i <= 4; i++) {
+    const t = t0 + (t1 - t0) * i / 4;
+    const label = new Date(t).toLocaleString([], { month: 'numeric', day: 'numeric', hour: '2-digit', minute: '2-digit' });
+    svg.appendChild(svgEl('text', { x: x(t), y: H - 6, 'text-anchor': i === 0 ? 'start' : i === 4 ? 'end' : 'middle' }, label));
+  }
+  svg.appendChild(svgEl('polyline', { points: points.map((p) => x(p[0]).toFixed(1) + ',' + y(p[1]).toFixed(1)).join(' ') }));
+}
+
+function refresh() {
+  showError(null);
+  loadFleet()
+    .then(() => (state.selected ? loadChart() : null))
+    .catch(showError);
+}
+
+$('key').value = localStorage.getItem('apiKey') || '';
+$('auth').addEventListener('submit', (e) => {
+  e.preventDefault();
+  localStorage.setItem('apiKey', $('key').value.trim());
+  refresh();
+});
+$('filter').addEventListener('input', renderFleet);
+$('metric').addEventListener('change', () => { state.metric = $('metric').value; loadChart().catch(showError); });
+$('window').addEventListener('change', () => loadChart().catch(showError));
+
+if (location.hash.length > 1) {
+  state.selected = decodeURIComponent(location.hash.slice(1));
+  $('detail').hidden = false;
+}
+refresh();
+setInterval(refresh, REFRESH_MS);
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestUI_ServesEmbeddedDashboard(t *testing.T) {
+	// Scenario: GET /ui, /ui/, its script and a missing file
+	// Expect: a redirect to /ui/, the page and script from the binary with a
+	// same-origin CSP, and 404 for the missing file
+	h := newServer(storage.NewMemoryStore())
+	if w := call(h, "/ui"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/ui/" {
+		t.Fatalf("/ui: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	w := call(h, "/ui/")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<script src="app.js">`) || !strings.Contains(w.Header().Get("Content-Security-Policy"), "default-src 'self'") {
+		t.Fatalf("/ui/: %d %s", w.Code, w.Header())
+	}
+	w = call(h, "/ui/app.js")
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Type"), "javascript") || !strings.Contains(w.Body.String(), "/api/v1/gpus/status") {
+		t.Fatalf("/ui/app.js: %d %s", w.Code, w.Header())
+	}
+	if w := call(h, "/ui/nope.js"); w.Code != http.StatusNotFound {
+		t.Fatalf("/ui/nope.js: %d", w.Code)
+	}
+}
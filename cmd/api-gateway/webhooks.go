@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/webhook"
+)
+
+// webhooksHandler serves the webhook subscriptions API:
+//
+//	POST   /api/v1/webhooks                  subscribe
+//	GET    /api/v1/webhooks                  list subscriptions
+//	GET    /api/v1/webhooks/{id}             one subscription
+//	DELETE /api/v1/webhooks/{id}             unsubscribe
+//	GET    /api/v1/webhooks/{id}/deliveries  recent deliveries, newest first
+//
+// Like alert rules, a tenant's subscriptions are owned by it, see only its
+// scope and are only visible to it.
+func webhooksHandler(n *webhook.Notifier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		owner := tenantFrom(r.Context())
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/webhooks"), "/")
+
+		if rest == "" {
+			switch r.Method {
+			case http.MethodGet:
+				subs := []webhook.Subscription{}
+				for _, s := range n.Subscriptions() {
+					if owner == "" || s.Owner == owner {
+						subs = append(subs, s)
+					}
+				}
+				writeJSON(w, http.StatusOK, subs)
+			case http.MethodPost:
+				var s webhook.Subscription
+				dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRuleBody))
+				dec.DisallowUnknownFields()
+				if err := dec.Decode(&s); err != nil {
+					writeError(w, r, http.StatusBadRequest, codeInvalidWebhook, "invalid webhook: "+err.Error())
+					return
+				}
+				s.ID, s.Owner, s.CreatedAt = "", owner, time.Time{}
+				created, err := n.Add(s)
+				if err != nil {
+					var bad *webhook.SubscriptionError
+					if errors.As(err, &bad) {
+						writeError(w, r, http.StatusBadRequest, codeInvalidWebhook, err.Error())
+						return
+					}
+					writeStoreError(w, r, err, "save webhook error")
+					return
+				}
+				w.Header().Set("Location", "/api/v1/webhooks/"+created.ID)
+				writeJSON(w, http.StatusCreated, created)
+			default:
+				methodNotAllowed(w, r)
+			}
+			return
+		}
+
+		id, sub, _ := strings.Cut(rest, "/")
+		if sub != "" && sub != "deliveries" {
+			notFound(w, r)
+			return
+		}
+		s, ok := n.Subscription(id)
+		if !ok || (owner != "" && s.Owner != owner) {
+			writeError(w, r, http.StatusNotFound, codeWebhookNotFound, "no webhook "+id)
+			return
+		}
+		switch {
+		case sub == "deliveries" && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, n.Deliveries(id))
+		case sub == "" && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, s)
+		case sub == "" && r.Method == http.MethodDelete:
+			if _, err := n.Delete(id); err != nil {
+				writeStoreError(w, r, err, "delete webhook %s error", id)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			methodNotAllowed(w, r)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+	"gpu-metric-collector/internal/webhook"
+)
+
+func TestWebhooks_SubscribeAndInspectDeliveries(t *testing.T) {
+	// Scenario: tenant "ml" (host h1) and operators ("ops", all) each
+	// subscribe to temp above 80 while both GPUs run hot, then the notifier
+	// evaluates
+	// Expect: ml's receiver hears about gpu-1 only and ml sees only its own
+	// subscription and deliveries; ops sees both; bad subscriptions get 400;
+	// deleting removes the subscription
+	var got []webhook.Event
+	recv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e webhook.Event
+		_ = json.NewDecoder(r.Body).Decode(&e)
+		got = append(got, e)
+	}))
+	defer recv.Close()
+
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "keys.json")
+	_ = os.WriteFile(keys, []byte(`{"keys":[{"name":"ml-grafana","key":"ml-key-0123456789"},{"name":"sre","key":"sre-key-0123456789"}]}`), 0o600)
+	tfile := filepath.Join(dir, "tenants.json")
+	_ = os.WriteFile(tfile, []byte(`{"tenants":[{"name":"ml","subjects":["ml-grafana"],"hosts":["h1"]},{"name":"ops","subjects":["sre"],"all":true}]}`), 0o600)
+	a, err := newAuthenticator(authConfig{APIKeysFile: keys})
+	if err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	tn, err := loadTenants(tfile, "")
+	if err != nil {
+		t.Fatalf("tenants: %v", err)
+	}
+	mem := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: now, Metrics: map[string]float64{"temp": 90}})
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", HostId: "h2", Timestamp: now, Metrics: map[string]float64{"temp": 95}})
+	n, err := webhook.NewNotifier(mem, mem, tn.scopeFor, webhook.Config{AllowedHosts: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatalf("notifier: %v", err)
+	}
+	defer n.Close()
+	h := a.wrap(tn.wrap(webhooksHandler(n)))
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, body := range []string{`{"metric":"temp","threshold":80,"direction":"up","url":"` + recv.URL + `"}`,
+		`{"metric":"temp","threshold":80,"direction":"above","url":"not a url"}`, `{"nope":1}`} {
+		if w := do(http.MethodPost, "/api/v1/webhooks", "ml-key-0123456789", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d %s", body, w.Code, w.Body.String())
+		}
+	}
+	var ml webhook.Subscription
+	w := do(http.MethodPost, "/api/v1/webhooks", "ml-key-0123456789", `{"metric":"temp","threshold":80,"direction":"above","url":"`+recv.URL+`"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &ml); w.Code != http.StatusCreated || err != nil || ml.ID == "" || ml.Owner != "ml" {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/v1/webhooks/", "sre-key-0123456789", `{"metric":"temp","threshold":80,"direction":"above","url":"`+recv.URL+`"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create ops: %d %s", w.Code, w.Body.String())
+	}
+
+	n.Evaluate(now)
+	n.Wait()
+	if len(got) != 3 {
+		t.Fatalf("expected 3 events (1 for ml, 2 for ops), got %+v", got)
+	}
+
+	var subs []webhook.Subscription
+	_ = json.Unmarshal(do(http.MethodGet, "/api/v1/webhooks", "ml-key-0123456789", "").Body.Bytes(), &subs)
+	if len(subs) != 1 || subs[0].ID != ml.ID {
+		t.Fatalf("ml should see only its subscription: %+v", subs)
+	}
+	_ = json.Unmarshal(do(http.MethodGet, "/api/v1/webhooks", "sre-key-0123456789", "").Body.Bytes(), &subs)
+	if len(subs) != 2 {
+		t.Fatalf("ops should see both subscriptions: %+v", subs)
+	}
+	var ds []webhook.Delivery
+	w = do(http.MethodGet, "/api/v1/webhooks/"+ml.ID+"/deliveries", "ml-key-0123456789", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &ds); err != nil || len(ds) != 1 || ds[0].Event.GPUId != "gpu-1" || ds[0].Status != webhook.StatusDelivered {
+		t.Fatalf("deliveries: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/v1/webhooks/"+subs[1].ID, "ml-key-0123456789", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("ml must not see ops' subscription: %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/api/v1/webhooks/"+ml.ID, "ml-key-0123456789", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/v1/webhooks/"+ml.ID, "ml-key-0123456789", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("deleted subscription: %d", w.Code)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// inflightBudget bounds telemetry held by the collector between Recv and a
+// completed store write (pending batch, queued jobs and jobs being written).
+// A zero limit disables that dimension.
+type inflightBudget struct {
+	maxItems int64
+	maxBytes int64
+
+	mu       sync.Mutex
+	items    int64
+	bytes    int64
+	released chan struct{}
+}
+
+func newInflightBudget(maxItems, maxBytes int64) *inflightBudget {
+	return &inflightBudget{maxItems: maxItems, maxBytes: maxBytes, released: make(chan struct{}, 1)}
+}
+
+func (b *inflightBudget) acquire(items, bytes int64) {
+	b.mu.Lock()
+	b.items += items
+	b.bytes += bytes
+	b.report()
+	b.mu.Unlock()
+}
+
+func (b *inflightBudget) release(items, bytes int64) {
+	b.mu.Lock()
+	b.items -= items
+	b.bytes -= bytes
+	b.report()
+	b.mu.Unlock()
+	select {
+	case b.released <- struct{}{}:
+	default:
+	}
+}
+
+func (b *inflightBudget) exceeded() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return (b.maxItems > 0 && b.items >= b.maxItems) || (b.maxBytes > 0 && b.bytes >= b.maxBytes)
+}
+
+// wait blocks until the budget has room again or ctx is done.
+func (b *inflightBudget) wait(ctx context.Context) error {
+	for b.exceeded() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.released:
+		}
+	}
+	return nil
+}
+
+// pauseBackoff grows the pause of a loop waiting out an exhausted budget
+// once it can no longer block on its context: doubled each time from 10ms,
+// capped at 1s.
+func pauseBackoff(d time.Duration) time.Duration {
+	return min(max(2*d, 10*time.Millisecond), time.Second)
+}
+
+// report must be called with mu held.
+func (b *inflightBudget) report() {
+	metricInflightItems.Set(float64(b.items))
+	metricInflightBytes.Set(float64(b.bytes))
+}
+
+// approxSize estimates the heap footprint of t for budgeting purposes.
+func approxSize(t model.Telemetry) int64 {
+	const mapEntryOverhead = 48
+	n := int64(64 + len(t.GPUId) + len(t.IdempotencyKey))
+	for k := range t.Metrics {
+		n += int64(len(k)) + 8 + mapEntryOverhead
+	}
+	for k, v := range t.Labels {
+		n += int64(len(k)+len(v)) + mapEntryOverhead
+	}
+	return n
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"gpu-metric-collector/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// influxAsyncConfig configures the non-blocking writes of -influx_async.
+// Batches the store gives up on go to -dead_letter_file.
+func influxAsyncConfig() (*storage.InfluxAsync, error) {
+	cfg := storage.InfluxAsync{
+		BatchSize:        uint(max(*flagInfluxBatch, 0)),
+		FlushInterval:    *flagInfluxFlush,
+		RetryBufferLimit: uint(max(*flagInfluxBuffer, 0)),
+		MaxRetries:       uint(max(*flagInfluxRetry, 0)),
+	}
+	dl, err := openDeadLetters(stringsTrim(*flagDeadLetter))
+	if err != nil {
+		return nil, err
+	}
+	cfg.OnWriteFailed = dl.write
+	return &cfg, nil
+}
+
+// registerInfluxWriteMetrics exports the write failures of an InfluxDB
+// store opened with -influx_async as influx_write_errors_total and
+// influx_dropped_batches_total.
+func registerInfluxWriteMetrics(s *storage.InfluxStore) {
+	prometheus.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "gpu_telemetry", Subsystem: "collector", Name: "influx_write_errors_total", Help: "Failed InfluxDB write requests with -influx_async, retried ones included.",
+		}, func() float64 { return float64(s.WriteStats().Errors) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "gpu_telemetry", Subsystem: "collector", Name: "influx_dropped_batches_total", Help: "InfluxDB batches given up with -influx_async: rejected by the server, or failed after their last retry.",
+		}, func() float64 { return float64(s.WriteStats().Dropped) }),
+	)
+}
+
+// deadLetters appends the line protocol of batches the store gave up on to a
+// file, from where `influx write` can replay them. Without a file they are
+// only logged and counted.
+type deadLetters struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openDeadLetters(path string) (*deadLetters, error) {
+	if path == "" {
+		return &deadLetters{}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open dead letter file: %w", err)
+	}
+	log.Printf("collector: dead-lettering failed influx batches to %s", path)
+	return &deadLetters{f: f}, nil
+}
+
+func (d *deadLetters) write(lines string, cause error) {
+	n := strings.Count(strings.TrimRight(lines, "\n"), "\n") + 1
+	if d.f == nil {
+		log.Printf("collector: dropped influx batch of %d points: %v", n, cause)
+		return
+	}
+	if !strings.HasSuffix(lines, "\n") {
+		lines += "\n"
+	}
+	d.mu.Lock()
+	_, err := d.f.WriteString(lines)
+	d.mu.Unlock()
+	if err != nil {
+		metricDeadLettered.WithLabelValues("error").Inc()
+		log.Printf("collector: dropped influx batch of %d points (%v): dead letter file: %v", n, cause, err)
+		return
+	}
+	metricDeadLettered.WithLabelValues("ok").Inc()
+	log.Printf("collector: dead-lettered influx batch of %d points: %v", n, cause)
+}
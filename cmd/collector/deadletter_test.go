@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeadLetters_AppendsBatches(t *testing.T) {
+	// Scenario: two failed batches, the first without a trailing newline,
+	// written to a dead letter file that already has a line
+	// Expect: the file keeps its line and gains both batches, one line per point
+	path := filepath.Join(t.TempDir(), "dead.lp")
+	_ = os.WriteFile(path, []byte("telemetry,gpu_id=0 temp=1 1\n"), 0o600)
+	dl, err := openDeadLetters(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	dl.write("telemetry,gpu_id=1 temp=2 2\ntelemetry,gpu_id=2 temp=3 3", errors.New("503"))
+	dl.write("telemetry,gpu_id=3 temp=4 4\n", errors.New("503"))
+	b, _ := os.ReadFile(path)
+	want := "telemetry,gpu_id=0 temp=1 1\ntelemetry,gpu_id=1 temp=2 2\ntelemetry,gpu_id=2 temp=3 3\ntelemetry,gpu_id=3 temp=4 4\n"
+	if string(b) != want {
+		t.Fatalf("file:\n%s", b)
+	}
+}
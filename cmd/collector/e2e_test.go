@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/e2e"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestE2E_CollectorLoopStoresEveryPoint(t *testing.T) {
+	// Scenario: the collector loop, with 2 workers and 50ms flushes, consumes a real broker fed by a synthetic streamer
+	// Expect: every published point is stored once, across worker partitions and size and timer flushes
+	h := e2e.Start(t, e2e.Options{Collector: func(ctx context.Context, client telemetryv1.TelemetryClient, store storage.Store) error {
+		stream, err := client.Subscribe(ctx, &telemetryv1.SubscriptionRequest{Group: "collectors"})
+		if err != nil {
+			return err
+		}
+		return runCollectorLoop(ctx, stream, store, 40, 50, 2)
+	}})
+	points := e2e.Source{
+		Producer: "streamer-e2e",
+		Host:     "node-1",
+		GPUs:     []string{"0", "1", "2", "3"},
+		Metrics:  []string{"DCGM_FI_DEV_GPU_TEMP", "DCGM_FI_DEV_POWER_USAGE"},
+		Start:    time.Now().Add(-time.Hour).Truncate(time.Second),
+		Interval: time.Second,
+	}.Points(30)
+	h.Publish(points, 25)
+	h.AssertDelivered(points, 5*time.Second)
+}
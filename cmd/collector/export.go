@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"gpu-metric-collector/internal/grpcclient"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/otlp"
+)
+
+// exportFn forwards persisted raw telemetry to a secondary sink (OTLP); nil disables it.
+var exportFn func(ctx context.Context, items []model.Telemetry) error
+
+// newOTLPExporter builds the OTLP sink from flags; it returns nil when -otlp_endpoint is unset.
+func newOTLPExporter() (*otlp.Exporter, error) {
+	endpoint := stringsTrim(*flagOTLPEndpoint)
+	if endpoint == "" {
+		return nil, nil
+	}
+	headers, err := parseHeaders(*flagOTLPHeaders)
+	if err != nil {
+		return nil, err
+	}
+	var counters []string
+	for _, c := range strings.Split(*flagOTLPCounters, ",") {
+		if c = stringsTrim(c); c != "" {
+			counters = append(counters, c)
+		}
+	}
+	e, err := otlp.New(otlp.Config{
+		Endpoint: endpoint,
+		Security: grpcclient.Security{TLS: *flagOTLPTLS, CAFile: stringsTrim(*flagOTLPCA)},
+		Headers:  headers,
+		Timeout:  *flagOTLPTimeout,
+		Counters: counters,
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("collector: exporting to OTLP endpoint %s", endpoint)
+	return e, nil
+}
+
+// parseHeaders parses "key=value,key2=value2".
+func parseHeaders(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		kv = stringsTrim(kv)
+		if kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || stringsTrim(k) == "" {
+			return nil, fmt.Errorf("otlp header %q: want key=value", kv)
+		}
+		out[strings.ToLower(stringsTrim(k))] = stringsTrim(v)
+	}
+	return out, nil
+}
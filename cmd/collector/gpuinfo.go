@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+// gpuInfoSync copies the GPU info streamers register with the broker into
+// the store's inventory, fetching only what changed since its last read.
+// Every collector copies every GPU; saving the same document twice is
+// harmless.
+type gpuInfoSync struct {
+	client telemetryv1.TelemetryClient
+	store  storage.InventoryStore
+	rev    uint64
+}
+
+// sync saves the GPUs changed since the last successful sync.
+func (g *gpuInfoSync) sync(ctx context.Context) error {
+	resp, err := g.client.ListGPUInfo(ctx, &telemetryv1.ListGPUInfoRequest{AfterRevision: g.rev})
+	if err != nil {
+		return fmt.Errorf("list gpu info: %w", err)
+	}
+	for _, info := range resp.GetGpus() {
+		doc, err := json.Marshal(fromGPUInfo(info))
+		if err != nil {
+			return err
+		}
+		// the revision is kept, so a failed save is retried with the rest
+		if err := g.store.SaveGPUInfo(info.GetGpuId(), doc); err != nil {
+			return fmt.Errorf("save gpu info %s: %w", info.GetGpuId(), err)
+		}
+	}
+	g.rev = resp.GetRevision()
+	return nil
+}
+
+func (g *gpuInfoSync) run(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		if err := g.sync(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("collector: gpu inventory sync: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func fromGPUInfo(m *telemetryv1.GpuInfo) model.GPUInfo {
+	return model.GPUInfo{
+		GPUId:            m.GetGpuId(),
+		UUID:             m.GetUuid(),
+		Model:            m.GetModel(),
+		VBIOSVersion:     m.GetVbiosVersion(),
+		DriverVersion:    m.GetDriverVersion(),
+		MemoryTotalBytes: m.GetMemoryTotalBytes(),
+		PCIBusId:         m.GetPciBusId(),
+		HostId:           m.GetHostId(),
+		ProducerId:       m.GetProducerId(),
+		RegisteredAt:     m.GetRegisteredAt().AsTime(),
+	}
+}
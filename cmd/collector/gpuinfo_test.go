@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/broker"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"google.golang.org/grpc"
+)
+
+// inventoryClient answers ListGPUInfo from a broker in process.
+type inventoryClient struct {
+	telemetryv1.TelemetryClient
+	srv *broker.Server
+}
+
+func (c inventoryClient) ListGPUInfo(ctx context.Context, in *telemetryv1.ListGPUInfoRequest, _ ...grpc.CallOption) (*telemetryv1.ListGPUInfoResponse, error) {
+	return c.srv.ListGPUInfo(ctx, in)
+}
+
+// failingInventory fails every save while fail is set.
+type failingInventory struct {
+	*storage.MemoryStore
+	fail bool
+}
+
+func (f *failingInventory) SaveGPUInfo(gpuID string, doc []byte) error {
+	if f.fail {
+		return errors.New("store down")
+	}
+	return f.MemoryStore.SaveGPUInfo(gpuID, doc)
+}
+
+func TestGPUInfoSync_CopiesRegisteredInfo(t *testing.T) {
+	// Scenario: a streamer registers a GPU while the store is down, then the
+	// store recovers, then the driver changes
+	// Expect: the failed sync is retried in full; the store then holds the
+	// GPU's info and, after the next sync, the new driver
+	ctx := context.Background()
+	srv := broker.NewServer(10, 1)
+	store := &failingInventory{MemoryStore: storage.NewMemoryStore(), fail: true}
+	g := &gpuInfoSync{client: inventoryClient{srv: srv}, store: store}
+	register := func(driver string) {
+		t.Helper()
+		if _, err := srv.RegisterGPUs(ctx, &telemetryv1.RegisterGPUsRequest{Gpus: []*telemetryv1.GpuInfo{
+			{GpuId: "0", Uuid: "GPU-abc", Model: "H100", DriverVersion: driver, MemoryTotalBytes: 80 << 30, HostId: "node-1"},
+		}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored := func() model.GPUInfo {
+		t.Helper()
+		docs, _ := store.ListGPUInfo()
+		var info model.GPUInfo
+		if err := json.Unmarshal(docs["0"], &info); err != nil {
+			t.Fatalf("doc %q: %v", docs["0"], err)
+		}
+		return info
+	}
+
+	register("535")
+	if err := g.sync(ctx); err == nil {
+		t.Fatal("expected the save error")
+	}
+	store.fail = false
+	if err := g.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if info := stored(); info.UUID != "GPU-abc" || info.DriverVersion != "535" || info.MemoryTotalBytes != 80<<30 || info.RegisteredAt.IsZero() {
+		t.Fatalf("stored %+v", info)
+	}
+	register("550")
+	if err := g.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if info := stored(); info.DriverVersion != "550" {
+		t.Fatalf("stored %+v", info)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"gpu-metric-collector/internal/storage"
+)
+
+// healthState backs /healthz and /readyz. The loop, workers and broker
+// stream update it; the handlers only read.
+type healthState struct {
+	connected atomic.Bool  // broker subscription is up
+	saturated atomic.Bool  // in-flight budget exhausted; Recv is paused
+	pending   atomic.Int64 // flush jobs queued or being written
+	progress  atomic.Int64 // unix nanos of the last job start or completion
+	store     atomic.Pointer[storage.Store]
+}
+
+var health = &healthState{}
+
+// jobQueued records a job handed to the workers.
+func (h *healthState) jobQueued() {
+	if h.pending.Add(1) == 1 {
+		h.progress.Store(time.Now().UnixNano())
+	}
+}
+
+// jobDone records a finished job, successful or not.
+func (h *healthState) jobDone() {
+	h.pending.Add(-1)
+	h.progress.Store(time.Now().UnixNano())
+}
+
+// stalled reports whether jobs are pending but none has finished within d.
+func (h *healthState) stalled(d time.Duration) bool {
+	return h.pending.Load() > 0 && time.Since(time.Unix(0, h.progress.Load())) > d
+}
+
+func (h *healthState) setStore(s storage.Store) { h.store.Store(&s) }
+
+func (h *healthState) pingStore(ctx context.Context) error {
+	sp := h.store.Load()
+	if sp == nil {
+		return nil
+	}
+	if p, ok := (*sp).(storage.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// livenessHandler fails when flush workers have stopped making progress, so the
+// orchestrator restarts a stuck collector.
+func (h *healthState) livenessHandler(stall time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := map[string]string{"flush": "ok"}
+		if h.stalled(stall) {
+			checks["flush"] = "stalled: no batch written in " + stall.String()
+		}
+		writeHealth(w, checks)
+	}
+}
+
+// readinessHandler reports whether the collector can take work: subscribed to
+// the broker, store reachable, and in-flight budget not exhausted.
+func (h *healthState) readinessHandler(timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := map[string]string{"broker": "ok", "store": "ok", "backlog": "ok"}
+		if !h.connected.Load() {
+			checks["broker"] = "not subscribed"
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		if err := h.pingStore(ctx); err != nil {
+			checks["store"] = err.Error()
+		}
+		if h.saturated.Load() {
+			checks["backlog"] = "in-flight budget exhausted"
+		}
+		writeHealth(w, checks)
+	}
+}
+
+func writeHealth(w http.ResponseWriter, checks map[string]string) {
+	status, code := "ok", http.StatusOK
+	for _, v := range checks {
+		if v != "ok" {
+			status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": status, "checks": checks})
+}
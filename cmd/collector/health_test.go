@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/storage"
+)
+
+type pingStore struct {
+	storage.Store
+	err error
+}
+
+func (p pingStore) Ping(ctx context.Context) error { return p.err }
+
+func probe(t *testing.T, h http.Handler) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestReadiness(t *testing.T) {
+	h := &healthState{}
+	ready := h.readinessHandler(time.Second)
+
+	if code, body := probe(t, ready); code != http.StatusServiceUnavailable || !strings.Contains(body, "not subscribed") {
+		t.Fatalf("expected unready before subscribing, got %d %s", code, body)
+	}
+	h.connected.Store(true)
+	h.setStore(pingStore{Store: storage.NewMemoryStore()})
+	if code, body := probe(t, ready); code != http.StatusOK {
+		t.Fatalf("expected ready, got %d %s", code, body)
+	}
+	h.setStore(pingStore{Store: storage.NewMemoryStore(), err: errors.New("connection refused")})
+	if code, body := probe(t, ready); code != http.StatusServiceUnavailable || !strings.Contains(body, "connection refused") {
+		t.Fatalf("expected unready on store ping failure, got %d %s", code, body)
+	}
+	h.setStore(storage.NewMemoryStore())
+	h.saturated.Store(true)
+	if code, body := probe(t, ready); code != http.StatusServiceUnavailable || !strings.Contains(body, "budget") {
+		t.Fatalf("expected unready while saturated, got %d %s", code, body)
+	}
+}
+
+func TestLiveness_StalledFlush(t *testing.T) {
+	h := &healthState{}
+	live := h.livenessHandler(20 * time.Millisecond)
+
+	if code, _ := probe(t, live); code != http.StatusOK {
+		t.Fatalf("idle collector should be live, got %d", code)
+	}
+	h.jobQueued()
+	if code, _ := probe(t, live); code != http.StatusOK {
+		t.Fatalf("fresh job should be live, got %d", code)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if code, body := probe(t, live); code != http.StatusServiceUnavailable || !strings.Contains(body, "stalled") {
+		t.Fatalf("expected stalled, got %d %s", code, body)
+	}
+	h.jobDone()
+	if code, _ := probe(t, live); code != http.StatusOK {
+		t.Fatalf("expected live after the job finished, got %d", code)
+	}
+}
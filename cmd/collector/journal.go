@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+	"gpu-metric-collector/internal/wal"
+)
+
+// journal, when set, makes raw batches durable on local disk before they are
+// acked to the broker. Workers commit a record once all of it is written; the
+// items of a record whose write failed are written again, with backoff, and
+// records left uncommitted at shutdown or a crash are replayed when the
+// collector starts again. nil disables the journal.
+var journal *wal.Log
+
+// journalRetryMin and journalRetryMax bound the backoff between attempts to
+// write the failed items of a journaled record.
+var journalRetryMin, journalRetryMax = 500 * time.Millisecond, 30 * time.Second
+
+// spooler feeds journaled batches to the flush workers. A batch goes straight
+// to the workers while the in-flight budget has room; otherwise it stays on
+// disk and the spooler reads it back once the workers catch up, so a slow
+// store fills the journal instead of holding up the broker. While any batch is
+// spooled, later ones queue behind it to keep per-GPU order.
+type spooler struct {
+	log      *wal.Log
+	maxBytes int64
+	budget   *inflightBudget
+	store    storage.Store
+	enqueue  func(job)
+
+	mu       sync.Mutex
+	spooling bool
+	next     uint64 // first spooled seq not yet handed to a worker
+	last     uint64 // last journaled seq
+	export   func(ctx context.Context, items []model.Telemetry) error
+	wake     chan struct{}
+	room     chan struct{}
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	closed  bool // under mu; no retries are started once set
+	retries sync.WaitGroup
+}
+
+// newSpooler starts the spooler; records left in the journal by a previous run
+// are replayed ahead of anything new.
+func newSpooler(l *wal.Log, maxBytes int64, budget *inflightBudget, store storage.Store, enqueue func(job)) *spooler {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &spooler{log: l, maxBytes: maxBytes, budget: budget, store: store, enqueue: enqueue, export: exportFn,
+		wake: make(chan struct{}, 1), room: make(chan struct{}, 1), ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	if first, last := l.Pending(); first <= last {
+		log.Printf("collector: replaying %d journaled batches", last-first+1)
+		s.spooling, s.next, s.last = true, first, last
+	}
+	metricWALBytes.Set(float64(l.Size()))
+	go s.run(ctx)
+	return s
+}
+
+// write journals j and acks its offsets. It reports false when the journal
+// write failed and j must go through the unjournaled path instead.
+func (s *spooler) write(j job) bool {
+	var seq uint64
+	if len(j.items) > 0 {
+		var err error
+		if seq, err = s.log.Append(j.items); err != nil {
+			metricWALErrors.WithLabelValues("append").Inc()
+			log.Printf("collector: journal append of %d items failed; writing unjournaled: %v", len(j.items), err)
+			return false
+		}
+		metricWALBytes.Set(float64(s.log.Size()))
+	}
+	ack(append(j.offsets, j.skipped...))
+	if len(j.items) > 0 {
+		s.offer(seq, j)
+	}
+	return true
+}
+
+func (s *spooler) offer(seq uint64, j job) {
+	j.offsets, j.skipped = nil, nil
+	s.mu.Lock()
+	s.last, s.export = seq, j.export
+	if !s.spooling && !s.budget.exceeded() {
+		s.mu.Unlock()
+		s.enqueue(s.track(seq, j, 0))
+		return
+	}
+	if !s.spooling {
+		s.spooling, s.next = true, seq
+	}
+	s.mu.Unlock()
+	// the batch is safe on disk; stop counting it as held in memory
+	s.budget.release(int64(len(j.items)), j.bytes)
+	metricWALSpooled.Inc()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *spooler) run(ctx context.Context) {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		spooling, seq, export := s.spooling, s.next, s.export
+		s.mu.Unlock()
+		if !spooling {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+				continue
+			}
+		}
+		if err := s.budget.wait(ctx); err != nil {
+			return
+		}
+		items, err := s.log.Read(seq)
+		if err != nil {
+			// an unreadable record would stall the journal forever; drop it
+			metricWALErrors.WithLabelValues("read").Inc()
+			log.Printf("collector: journal record %d unreadable, dropping it: %v", seq, err)
+			s.commit(seq)
+		} else {
+			j := job{sink: rawSink, store: s.store, items: items, export: export}
+			for _, it := range items {
+				j.bytes += approxSize(it)
+			}
+			s.budget.acquire(int64(len(items)), j.bytes)
+			s.enqueue(s.track(seq, j, 0))
+		}
+		s.mu.Lock()
+		s.next++
+		if s.next > s.last {
+			s.spooling = false
+		}
+		s.mu.Unlock()
+	}
+}
+
+// track makes j commit record seq once every part of it is written. The items
+// that failed are retried after attempt failures; until they are written, the
+// journal cannot release the record or any later one.
+func (s *spooler) track(seq uint64, j job, attempt int) job {
+	j.done = func(failed []model.Telemetry) {
+		if len(failed) > 0 {
+			metricWALErrors.WithLabelValues("write").Inc()
+			s.retry(seq, failed, attempt+1)
+			return
+		}
+		s.commit(seq)
+	}
+	return j
+}
+
+// retry writes the failed items of record seq again once the backoff of
+// attempt has passed. Only those items are written, so a store without
+// idempotent writes does not duplicate the rest of the record; they are not
+// exported again. On shutdown the record is left for replay on the next start,
+// which writes all of it again.
+func (s *spooler) retry(seq uint64, items []model.Telemetry, attempt int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		log.Printf("collector: journal record %d not fully written; keeping it for replay", seq)
+		return
+	}
+	delay := journalRetryMax
+	if attempt < 16 {
+		delay = min(journalRetryMin<<(attempt-1), journalRetryMax)
+	}
+	log.Printf("collector: journal record %d not fully written; retrying %d items in %s", seq, len(items), delay)
+	s.retries.Add(1)
+	go func() {
+		defer s.retries.Done()
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-t.C:
+		}
+		j := job{sink: rawSink, store: s.store, items: items}
+		for _, it := range items {
+			j.bytes += approxSize(it)
+		}
+		s.budget.acquire(int64(len(items)), j.bytes)
+		s.enqueue(s.track(seq, j, attempt))
+	}()
+}
+
+func (s *spooler) commit(seq uint64) {
+	if err := s.log.Commit(seq); err != nil {
+		metricWALErrors.WithLabelValues("commit").Inc()
+		log.Printf("collector: journal commit of record %d failed: %v", seq, err)
+	}
+	metricWALBytes.Set(float64(s.log.Size()))
+	select {
+	case s.room <- struct{}{}:
+	default:
+	}
+}
+
+// full reports whether the journal has reached its size limit; the loop then
+// stops receiving, as it does when the in-flight budget is exhausted.
+func (s *spooler) full() bool {
+	return s.maxBytes > 0 && s.log.Size() >= s.maxBytes
+}
+
+// waitRoom blocks until the journal is below its size limit or ctx is done.
+func (s *spooler) waitRoom(ctx context.Context) error {
+	for s.full() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.room:
+		}
+	}
+	return nil
+}
+
+// close stops handing spooled batches to the workers and retrying failed
+// ones; what is left stays in the journal for the next start.
+func (s *spooler) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.cancel()
+	<-s.done
+	s.retries.Wait()
+}
+
+// joinDone gives every part of a partitioned job a share of done, which runs
+// once the last part finishes with the failed items of all parts.
+func joinDone(done func(failed []model.Telemetry), parts []*job) {
+	n := int32(0)
+	for _, p := range parts {
+		if p != nil {
+			n++
+		}
+	}
+	var left atomic.Int32
+	var mu sync.Mutex
+	var all []model.Telemetry
+	left.Store(n)
+	for _, p := range parts {
+		if p == nil {
+			continue
+		}
+		p.done = func(failed []model.Telemetry) {
+			mu.Lock()
+			all = append(all, failed...)
+			mu.Unlock()
+			if left.Add(-1) == 0 {
+				done(all)
+			}
+		}
+	}
+}
@@ -3,13 +3,21 @@ package main
 import (
 	"context"
 	"errors"
+	"math"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	telemetryv1 "gpu-metric-collector/api/gen"
 	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/pipeline"
+	"gpu-metric-collector/internal/rollup"
+	"gpu-metric-collector/internal/storage"
+	"gpu-metric-collector/internal/validation"
+	"gpu-metric-collector/internal/wal"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -66,6 +74,9 @@ func (s *captureStore) SaveTelemetry(t model.Telemetry) error {
 	s.items = append(s.items, t)
 	return nil
 }
+func (s *captureStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	return storage.SaveEach(s.SaveTelemetry, items)
+}
 func (s *captureStore) ListGPUs() ([]string, error) { return nil, nil }
 func (s *captureStore) QueryTelemetry(string, *time.Time, *time.Time) ([]model.Telemetry, error) {
 	return nil, nil
@@ -175,3 +186,651 @@ func TestCollector_GracefulFlushOnStreamClose(t *testing.T) {
 		t.Fatalf("expected graceful flush of 5 items, got %d", len(st.items))
 	}
 }
+
+func TestCollector_RollupsFlushedOnClose(t *testing.T) {
+	ctx := context.Background()
+	fs := newFakeStream(ctx, 10)
+	st := &captureStore{}
+	rst := &captureStore{}
+
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	defer func() { tickerFn = oldTicker }()
+	oldStages, oldSinks := stages, sinks
+	stages = pipeline.New(&rollupStage{agg: rollup.NewAggregator(rollup.Spec{"temp": {time.Minute}})})
+	sinks = map[string]storage.Store{rollupSink(time.Minute): rst}
+	defer func() { stages, sinks = oldStages, oldSinks }()
+
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(ctx, fs, st, 100, 1000, 1)
+		close(done)
+	}()
+
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	for i, v := range []float64{60, 80} {
+		fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: timestamppb.New(base.Add(time.Duration(i) * time.Second)), Metrics: map[string]float64{"temp": v}}
+	}
+	fs.close()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting loop to finish")
+	}
+
+	if len(st.items) != 2 {
+		t.Fatalf("expected 2 raw items, got %d", len(st.items))
+	}
+	if len(rst.items) != 1 || rst.items[0].Metrics["temp_avg"] != 70 {
+		t.Fatalf("expected one 1m rollup with avg 70, got %#v", rst.items)
+	}
+}
+
+func TestCollector_ValidationRules(t *testing.T) {
+	ctx := context.Background()
+	fs := newFakeStream(ctx, 10)
+	st := &captureStore{}
+
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	defer func() { tickerFn = oldTicker }()
+	oldStages := stages
+	r, err := validation.Parse([]byte(`{"rules":[{"metric":"temp","min":0,"max":120,"policy":"clamp"},{"metric":"util","max":100,"policy":"drop"}]}`))
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+	stages = pipeline.New(&validateStage{rules: r})
+	defer func() { stages = oldStages }()
+
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(ctx, fs, st, 100, 1000, 1)
+		close(done)
+	}()
+
+	ts := timestamppb.Now()
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: ts, Metrics: map[string]float64{"temp": 500}}
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: ts, Metrics: map[string]float64{"util": 150}}
+	fs.close()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting loop to finish")
+	}
+
+	if len(st.items) != 1 {
+		t.Fatalf("expected 1 item after dropping out-of-range util, got %d", len(st.items))
+	}
+	if st.items[0].Metrics["temp"] != 120 {
+		t.Fatalf("expected temp clamped to 120, got %v", st.items[0].Metrics["temp"])
+	}
+}
+
+func TestCollector_ExportsRawBatchesOnly(t *testing.T) {
+	ctx := context.Background()
+	fs := newFakeStream(ctx, 10)
+	st := &captureStore{}
+	rst := &captureStore{}
+
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	defer func() { tickerFn = oldTicker }()
+	oldStages, oldSinks, oldExport := stages, sinks, exportFn
+	stages = pipeline.New(&rollupStage{agg: rollup.NewAggregator(rollup.Spec{"temp": {time.Minute}})})
+	sinks = map[string]storage.Store{rollupSink(time.Minute): rst}
+	var mu sync.Mutex
+	var exported []model.Telemetry
+	exportFn = func(ctx context.Context, items []model.Telemetry) error {
+		mu.Lock()
+		defer mu.Unlock()
+		exported = append(exported, items...)
+		return nil
+	}
+	defer func() { stages, sinks, exportFn = oldStages, oldSinks, oldExport }()
+
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(ctx, fs, st, 100, 1000, 1)
+		close(done)
+	}()
+	ts := timestamppb.Now()
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: ts, Metrics: map[string]float64{"temp": 60}}
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g2", Ts: ts, Metrics: map[string]float64{"temp": 70}}
+	fs.close()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting loop to finish")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(rst.items) != 2 {
+		t.Fatalf("expected 2 rollups, got %d", len(rst.items))
+	}
+	if len(exported) != 2 || exported[0].Metrics["temp"] != 60 {
+		t.Fatalf("expected the 2 raw samples exported, got %#v", exported)
+	}
+}
+
+// closableStream is a drainable fakeStream: its context is independent of the
+// loop's, and Close ends it like the resubscribing broker stream does.
+type closableStream struct{ *fakeStream }
+
+func (c closableStream) Close() { c.close() }
+
+func TestCollector_DrainsStreamOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	fs := closableStream{newFakeStream(context.Background(), 10)}
+	st := &captureStore{}
+
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	defer func() { tickerFn = oldTicker }()
+	oldDrain, oldIdle := *flagDrainMs, *flagDrainIdleMs
+	*flagDrainMs, *flagDrainIdleMs = 5000, 100
+	defer func() { *flagDrainMs, *flagDrainIdleMs = oldDrain, oldIdle }()
+
+	done := make(chan error, 1)
+	go func() { done <- runCollectorLoop(ctx, fs, st, 100, 1000, 1) }()
+
+	ts := timestamppb.Now()
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: ts}
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	// messages already on their way from the broker arrive after the signal
+	time.Sleep(20 * time.Millisecond)
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g2", Ts: ts}
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g3", Ts: ts}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected clean shutdown, got %v", err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("drain should end after the idle gap, long before the 5s deadline")
+	}
+	if len(st.items) != 3 {
+		t.Fatalf("expected 3 items including the 2 drained after shutdown, got %d", len(st.items))
+	}
+}
+
+func TestCollector_ReloadSwapsStagesKeepingBatch(t *testing.T) {
+	ctx := context.Background()
+	fs := newFakeStream(ctx, 10)
+	st := &captureStore{}
+	rst := &captureStore{}
+
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	defer func() { tickerFn = oldTicker }()
+	oldStages, oldSinks, oldReloads := stages, sinks, reloads
+	stages = pipeline.New(&rollupStage{agg: rollup.NewAggregator(rollup.Spec{"temp": {time.Minute}})})
+	sinks = map[string]storage.Store{rollupSink(time.Minute): rst}
+	reloads = make(chan *stageSet)
+	defer func() { stages, sinks, reloads = oldStages, oldSinks, oldReloads }()
+
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(ctx, fs, st, 100, 1000, 1)
+		close(done)
+	}()
+
+	r, err := validation.Parse([]byte(`{"rules":[{"metric":"temp","max":100,"policy":"drop"}]}`))
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+	ts := timestamppb.Now()
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: ts, Metrics: map[string]float64{"temp": 150}}
+	time.Sleep(20 * time.Millisecond)
+	// the loop is now blocked in Recv; it applies the reload after the next message
+	applied := make(chan struct{})
+	go func() {
+		reloads <- &stageSet{stages: pipeline.New(&validateStage{rules: r}), sinks: map[string]storage.Store{}}
+		close(applied)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: ts, Metrics: map[string]float64{"temp": 60}}
+	select {
+	case <-applied:
+	case <-time.After(1 * time.Second):
+		t.Fatal("reload not applied")
+	}
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: ts, Metrics: map[string]float64{"temp": 150}}
+	fs.close()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting loop to finish")
+	}
+	if len(st.items) != 2 {
+		t.Fatalf("expected the 2 pre-reload samples kept in the batch and the post-reload 150 dropped, got %d", len(st.items))
+	}
+	if len(rst.items) != 1 {
+		t.Fatalf("expected the old rollup window flushed on reload, got %d", len(rst.items))
+	}
+}
+
+// captureAcks swaps ackFn for a recorder and returns a getter plus a restore func.
+func captureAcks() (func() []uint64, func()) {
+	var mu sync.Mutex
+	var acked []uint64
+	old := ackFn
+	ackFn = func(ctx context.Context, offsets []uint64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		acked = append(acked, offsets...)
+		return nil
+	}
+	get := func() []uint64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]uint64(nil), acked...)
+	}
+	return get, func() { ackFn = old }
+}
+
+func TestCollector_AcksPersistedAndDroppedOffsets(t *testing.T) {
+	ctx := context.Background()
+	fs := newFakeStream(ctx, 10)
+	st := &captureStore{}
+
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	defer func() { tickerFn = oldTicker }()
+	acked, restore := captureAcks()
+	defer restore()
+
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(ctx, fs, st, 100, 1000, 1)
+		close(done)
+	}()
+
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: timestamppb.Now(), Offset: 1}
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "", Ts: timestamppb.Now(), Offset: 2} // invalid, acked as dropped
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: timestamppb.Now(), Offset: 3}
+	fs.close()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting loop to finish")
+	}
+	if got := acked(); len(got) != 3 {
+		t.Fatalf("expected offsets 1,2,3 acked, got %v", got)
+	}
+}
+
+func TestCollector_NoAckOnFailedWrite(t *testing.T) {
+	ctx := context.Background()
+	fs := newFakeStream(ctx, 10)
+	st := &captureStore{fail: true}
+
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	defer func() { tickerFn = oldTicker }()
+	acked, restore := captureAcks()
+	defer restore()
+
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(ctx, fs, st, 100, 1000, 1)
+		close(done)
+	}()
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: timestamppb.Now(), Offset: 4}
+	fs.close()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting loop to finish")
+	}
+	if got := acked(); len(got) != 0 {
+		t.Fatalf("expected no acks for failed writes, got %v", got)
+	}
+}
+
+// partialStore rejects items whose GPU id is "bad" and writes the rest.
+type partialStore struct{ captureStore }
+
+func (s *partialStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	return storage.SaveEach(func(t model.Telemetry) error {
+		if t.GPUId == "bad" {
+			return errors.New("rejected")
+		}
+		return s.SaveTelemetry(t)
+	}, items)
+}
+
+func TestCollector_PartialBatchFailureAcksWrittenItems(t *testing.T) {
+	ctx := context.Background()
+	fs := newFakeStream(ctx, 10)
+	st := &partialStore{}
+
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	defer func() { tickerFn = oldTicker }()
+	acked, restore := captureAcks()
+	defer restore()
+
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(ctx, fs, st, 100, 1000, 1)
+		close(done)
+	}()
+	ts := timestamppb.Now()
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: ts, Offset: 1}
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "bad", Ts: ts, Offset: 2}
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g2", Ts: ts, Offset: 3}
+	fs.close()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting loop to finish")
+	}
+	if len(st.items) != 2 {
+		t.Fatalf("expected 2 items written, got %d", len(st.items))
+	}
+	if got := acked(); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Fatalf("expected acks for offsets 1 and 3 only, got %v", got)
+	}
+}
+
+// blockingStore holds every SaveTelemetry until release is closed.
+type blockingStore struct {
+	captureStore
+	release chan struct{}
+}
+
+func (s *blockingStore) SaveTelemetry(t model.Telemetry) error {
+	<-s.release
+	return s.captureStore.SaveTelemetry(t)
+}
+
+func (s *blockingStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	return storage.SaveEach(s.SaveTelemetry, items)
+}
+
+func TestCollector_InflightBudgetStopsRecv(t *testing.T) {
+	ctx := context.Background()
+	fs := newFakeStream(ctx, 10)
+	st := &blockingStore{release: make(chan struct{})}
+
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	defer func() { tickerFn = oldTicker }()
+	oldMax := *flagMaxItems
+	*flagMaxItems = 2
+	defer func() { *flagMaxItems = oldMax }()
+
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(ctx, fs, st, 100, 1000, 1)
+		close(done)
+	}()
+	for i := 0; i < 5; i++ {
+		fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: timestamppb.Now()}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if left := len(fs.ch); left != 3 {
+		t.Fatalf("expected loop to stop after 2 in-flight items leaving 3 unread, got %d unread", left)
+	}
+
+	close(st.release)
+	fs.close()
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting loop to finish")
+	}
+	if len(st.items) != 5 {
+		t.Fatalf("expected all 5 items written once the store recovered, got %d", len(st.items))
+	}
+}
+
+func TestCollector_ClosedDrainWaitsOutBudgetWithoutSpinning(t *testing.T) {
+	// Scenario: the in-flight budget is exhausted by a stuck store when the
+	// drain closes the stream; the store recovers 200ms later
+	// Expect: the loop blocks instead of retrying the budget in a busy loop,
+	// then exits with every item written
+	streamCtx, closeStream := context.WithCancel(context.Background())
+	fs := closableStream{newFakeStream(streamCtx, 10)}
+	st := &blockingStore{release: make(chan struct{})}
+
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	defer func() { tickerFn = oldTicker }()
+	oldMax := *flagMaxItems
+	*flagMaxItems = 2
+	defer func() { *flagMaxItems = oldMax }()
+
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(context.Background(), fs, st, 100, 1000, 1)
+		close(done)
+	}()
+	for i := 0; i < 2; i++ {
+		fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: timestamppb.Now()}
+	}
+	time.Sleep(50 * time.Millisecond)
+	before := testutil.ToFloat64(metricBudgetWaits)
+	closeStream()
+	time.Sleep(200 * time.Millisecond)
+	if waits := testutil.ToFloat64(metricBudgetWaits) - before; waits > 20 {
+		t.Fatalf("loop retried the exhausted budget %v times in 200ms", waits)
+	}
+
+	close(st.release)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting loop to finish")
+	}
+	if len(st.items) != 2 {
+		t.Fatalf("expected both items written once the store recovered, got %d", len(st.items))
+	}
+}
+
+func TestCollector_JournalAcksBeforeStoreAndReplays(t *testing.T) {
+	// Scenario: journal enabled, store down; then a restart with the store back
+	// Expect: offsets acked without a successful write; the restart writes the journaled items
+	dir := t.TempDir()
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	defer func() { tickerFn = oldTicker; journal = nil }()
+	acked, restore := captureAcks()
+	defer restore()
+
+	l, err := wal.Open(dir, 0)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	journal = l
+	down := &captureStore{fail: true}
+	fs := newFakeStream(context.Background(), 10)
+	ts := timestamppb.Now()
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: ts, Offset: 1}
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g2", Ts: ts, Offset: 2}
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "", Ts: ts, Offset: 3}
+	fs.close()
+	_ = runCollectorLoop(context.Background(), fs, down, 100, 1000, 2)
+	if got := acked(); len(got) != 3 {
+		t.Fatalf("acked %v, want all 3 offsets", got)
+	}
+	if first, last := l.Pending(); first > last {
+		t.Fatal("failed batch was committed")
+	}
+	l.Close()
+
+	if journal, err = wal.Open(dir, 0); err != nil {
+		t.Fatalf("reopen journal: %v", err)
+	}
+	defer journal.Close()
+	up := &captureStore{}
+	fs = newFakeStream(context.Background(), 1)
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(context.Background(), fs, up, 100, 1000, 2)
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if first, last := journal.Pending(); first > last {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("journal not replayed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	fs.close()
+	<-done
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if len(up.items) != 2 {
+		t.Fatalf("replayed %d items, want 2", len(up.items))
+	}
+}
+
+// flakyStore fails its first fails batch writes, then writes like captureStore.
+type flakyStore struct {
+	captureStore
+	fails int
+}
+
+func (s *flakyStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	s.mu.Lock()
+	if s.fails > 0 {
+		s.fails--
+		s.mu.Unlock()
+		return errors.New("store unavailable")
+	}
+	s.mu.Unlock()
+	return storage.SaveEach(s.SaveTelemetry, items)
+}
+
+// poisonOnceStore writes through to a Store, but the first batch containing
+// the GPU poison has that item's temp replaced with NaN, which SQLite refuses.
+type poisonOnceStore struct {
+	storage.Store
+	poison string
+	mu     sync.Mutex
+	done   bool
+}
+
+func (s *poisonOnceStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := items
+	for i, it := range items {
+		if it.GPUId == s.poison && !s.done {
+			s.done = true
+			out = append([]model.Telemetry(nil), items...)
+			out[i].Metrics = map[string]float64{"temp": math.NaN()}
+		}
+	}
+	return s.Store.SaveTelemetryBatch(out)
+}
+
+func TestCollector_JournalRetriesOnlyFailedItems(t *testing.T) {
+	// Scenario: journal enabled; SQLite without upsert fails one item of a three-item batch once
+	// Expect: only that item is written again; every GPU ends up with exactly one point
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	oldMin, oldMax := journalRetryMin, journalRetryMax
+	journalRetryMin, journalRetryMax = 5*time.Millisecond, 20*time.Millisecond
+	defer func() { tickerFn = oldTicker; journalRetryMin, journalRetryMax = oldMin, oldMax; journal = nil }()
+
+	l, err := wal.Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer l.Close()
+	journal = l
+	db, err := storage.NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "telemetry.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	st := &poisonOnceStore{Store: db, poison: "g2"}
+	fs := newFakeStream(context.Background(), 10)
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(context.Background(), fs, st, 3, 1000, 1)
+		close(done)
+	}()
+	ts := timestamppb.Now()
+	for i, gpu := range []string{"g1", "g2", "g3"} {
+		fs.ch <- &telemetryv1.TelemetryData{GpuId: gpu, Ts: ts, Offset: uint64(i + 1), Metrics: map[string]float64{"temp": 60}}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		retried, _ := db.QueryTelemetry("g2", nil, nil)
+		if first, last := l.Pending(); len(retried) > 0 && first > last {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("failed item not retried")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	fs.close()
+	<-done
+	for _, gpu := range []string{"g1", "g2", "g3"} {
+		got, err := db.QueryTelemetry(gpu, nil, nil)
+		if err != nil || len(got) != 1 {
+			t.Fatalf("%s: %d points, want 1 (%v)", gpu, len(got), err)
+		}
+	}
+}
+
+func TestCollector_JournalRetriesFailedRecords(t *testing.T) {
+	// Scenario: journal enabled; the store fails the first two writes of a batch, then recovers
+	// Expect: the record is written again without a restart and the journal checkpoint moves past it
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	oldMin, oldMax := journalRetryMin, journalRetryMax
+	journalRetryMin, journalRetryMax = 5*time.Millisecond, 20*time.Millisecond
+	defer func() { tickerFn = oldTicker; journalRetryMin, journalRetryMax = oldMin, oldMax; journal = nil }()
+
+	l, err := wal.Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer l.Close()
+	journal = l
+	st := &flakyStore{fails: 2}
+	fs := newFakeStream(context.Background(), 10)
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(context.Background(), fs, st, 2, 1000, 1)
+		close(done)
+	}()
+	ts := timestamppb.Now()
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: ts, Offset: 1}
+	fs.ch <- &telemetryv1.TelemetryData{GpuId: "g2", Ts: ts, Offset: 2}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		st.mu.Lock()
+		written := len(st.items)
+		st.mu.Unlock()
+		if first, last := l.Pending(); written == 2 && first > last {
+			break
+		}
+		if time.Now().After(deadline) {
+			first, last := l.Pending()
+			t.Fatalf("record not retried: %d items written, pending %d..%d", written, first, last)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	fs.close()
+	<-done
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"strings"
@@ -14,27 +16,85 @@ import (
 	"time"
 
 	telemetryv1 "gpu-metric-collector/api/gen"
+	telemetryv2 "gpu-metric-collector/api/gen/v2"
+	"gpu-metric-collector/internal/compression"
+	"gpu-metric-collector/internal/config"
+	"gpu-metric-collector/internal/grpcclient"
+	"gpu-metric-collector/internal/inventory"
 	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/shard"
 	"gpu-metric-collector/internal/storage"
+	"gpu-metric-collector/internal/storemetrics"
+	"gpu-metric-collector/internal/wal"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 var (
+	flagConfig       = flag.String("config", "", "Path to YAML config file (env: COLLECTOR_CONFIG); flags override file and COLLECTOR_* env values")
 	flagBroker       = flag.String("broker", "127.0.0.1:9000", "Broker gRPC address")
 	flagGroup        = flag.String("group", "default", "Consumer group")
+	flagBrokerTLS    = flag.Bool("broker_tls", false, "Use TLS for the broker connection (implied by -broker_ca or -broker_cert)")
+	flagBrokerCA     = flag.String("broker_ca", "", "CA bundle (PEM) used to verify the broker certificate")
+	flagBrokerCert   = flag.String("broker_cert", "", "Client certificate (PEM) for mutual TLS with the broker")
+	flagBrokerKey    = flag.String("broker_key", "", "Client private key (PEM) for mutual TLS with the broker")
+	flagBrokerSNI    = flag.String("broker_server_name", "", "Override the server name used to verify the broker certificate")
+	flagBrokerToken  = flag.String("broker_token", "", "Bearer token sent to the broker (prefer -broker_token_file)")
+	flagBrokerTokenF = flag.String("broker_token_file", "", "File containing the bearer token sent to the broker")
+	flagCompress     = flag.String("grpc_compression", compression.None, "Compress requests to the broker with gzip or zstd, and have it answer in kind (none disables; needs a broker that accepts it)")
 	flagBatchSize    = flag.Int("batch", 500, "Collector batch size")
 	flagFlushMs      = flag.Int("flush_ms", 1000, "Max flush interval in ms")
 	flagWorkers      = flag.Int("workers", 4, "Flush worker count")
 	flagMetrics      = flag.String("metrics_addr", ":9102", "Metrics HTTP listen address")
+	flagStore        = flag.String("store", "", "Storage backend: influx, victoria, memory, or empty to use influx or victoria when configured")
+	flagStoreURI     = flag.String("store_uri", "", "Storage backend URI, e.g. influx://host:8086?org=o&bucket=b&token=t, victoria://host:8428, sqlite://telemetry.db, bolt://telemetry.db or mem://; overrides -store and the backend flags")
+	flagLatestRedis  = flag.String("latest_redis_url", "", "Also keep each GPU's newest point in Redis, e.g. redis://redis:6379/0, for the gateway's current-state reads (empty disables)")
+	flagVictoriaURL  = flag.String("victoria_url", "", "VictoriaMetrics URL, e.g. http://localhost:8428")
+	flagMemMaxPoints = flag.Int("memory_max_points", 100000, "Points kept per GPU by the memory store; older ones are evicted (0 = unlimited)")
+	flagMemMaxAge    = flag.Duration("memory_max_age", 0, "Evict points older than this from the memory store (0 = keep)")
 	flagInfluxURL    = flag.String("influx_url", "", "InfluxDB URL, e.g. http://localhost:8086")
 	flagInfluxOrg    = flag.String("influx_org", "", "InfluxDB organization")
 	flagInfluxBucket = flag.String("influx_bucket", "", "InfluxDB bucket")
 	flagInfluxToken  = flag.String("influx_token", "", "InfluxDB API token")
+	flagInfluxAsync  = flag.Bool("influx_async", false, "Write raw telemetry with InfluxDB's non-blocking batching API; a flush returns before points are stored, so not with -manual_ack or -wal_dir")
+	flagInfluxBatch  = flag.Int("influx_batch", 5000, "Points per InfluxDB write request with -influx_async")
+	flagInfluxFlush  = flag.Duration("influx_flush", time.Second, "Send a partial InfluxDB batch after this long with -influx_async")
+	flagInfluxBuffer = flag.Int("influx_retry_buffer", 50000, "Points kept for retrying failed InfluxDB writes with -influx_async; the oldest batch is dropped when full")
+	flagInfluxRetry  = flag.Int("influx_max_retries", 5, "Retries of an InfluxDB batch after a connection error, 429 or 5xx with -influx_async")
+	flagDeadLetter   = flag.String("dead_letter_file", "", "Append InfluxDB batches given up after their retries to this file as line protocol (with -influx_async; empty only counts them)")
+	flagMaxItems     = flag.Int64("max_inflight_items", 50000, "Stop receiving from the broker while this many items are buffered or being written (0 = unlimited)")
+	flagMaxBytes     = flag.Int64("max_inflight_bytes", 0, "Stop receiving from the broker while this many bytes (approx.) are buffered or being written (0 = unlimited)")
 	flagShutdownMs   = flag.Int("shutdown_timeout_ms", 5000, "Max time to wait for flush workers on shutdown (ms)")
+	flagDrainMs      = flag.Int("drain_ms", 2000, "On shutdown keep receiving from the broker for up to this long before unsubscribing (ms, 0 unsubscribes at once)")
+	flagDrainIdleMs  = flag.Int("drain_idle_ms", 200, "End the shutdown drain early once no message arrives for this long (ms)")
+	flagStallTimeout = flag.Duration("stall_timeout", 2*time.Minute, "Fail /healthz when queued batches make no progress for this long")
+	flagShardIndex   = flag.Uint("shard_index", 0, "This collector's shard in [0, shard_count); the broker sends it only GPUs whose gpu_id hashes to it")
+	flagShardCount   = flag.Uint("shard_count", 0, "Number of collector shards sharing the broker (0 = unsharded, receive every GPU)")
+	flagManualAck    = flag.Bool("manual_ack", false, "Ack messages to the broker only after they are persisted (exactly-once with idempotent stores)")
+	flagBackoffMs    = flag.Int("reconnect_backoff_ms", 200, "Initial delay before resubscribing after a broker error (ms)")
+	flagBackoffMaxMs = flag.Int("reconnect_backoff_max_ms", 10000, "Max delay between resubscribe attempts (ms)")
+	flagRules        = flag.String("rules", "", "Path to JSON validation rules file (per-metric ranges and drop/clamp/flag policies)")
+	flagSpecBounds   = flag.String("spec_bounds", "", "Check the metrics of the built-in catalog against its bounds with this policy (drop, clamp or flag; empty disables); -rules for a metric win")
+	flagInventory    = flag.String("inventory", "", "GPU inventory source (JSON file path or http(s) URL) used to label telemetry with model/host/rack/cluster")
+	flagInventoryRef = flag.Duration("inventory_refresh", 0, "Reload the inventory source at this interval (0 disables)")
+	flagGPUInfoSync  = flag.Duration("inventory_sync", 30*time.Second, "Copy the GPU info streamers register with the broker into the store at this interval (0 disables)")
+	flagAnomalyZ     = flag.Float64("anomaly_z", 0, "Flag samples whose EWMA z-score reaches this value (0 disables anomaly detection)")
+	flagAnomalyAlpha = flag.Float64("anomaly_alpha", 0.1, "EWMA smoothing factor for anomaly detection")
+	flagAnomalyWarm  = flag.Int("anomaly_warmup", 30, "Samples per (gpu, metric) before anomalies are flagged")
+	flagRollups      = flag.String("rollups", "", "Rollup windows per metric, e.g. \"temp=1m,5m;*=5m\" (empty disables)")
+	flagOTLPEndpoint = flag.String("otlp_endpoint", "", "OTLP/gRPC endpoint to also export persisted telemetry to, e.g. otel-collector:4317 (empty disables)")
+	flagOTLPTLS      = flag.Bool("otlp_tls", false, "Use TLS for the OTLP connection (implied by -otlp_ca)")
+	flagOTLPCA       = flag.String("otlp_ca", "", "CA bundle (PEM) used to verify the OTLP endpoint")
+	flagOTLPHeaders  = flag.String("otlp_headers", "", "Headers sent with every OTLP export, e.g. \"x-api-key=abc\"")
+	flagOTLPTimeout  = flag.Duration("otlp_timeout", 10*time.Second, "Timeout for one OTLP export")
+	flagOTLPCounters = flag.String("otlp_counters", "", "Comma-separated metrics exported as monotonic cumulative sums (others are gauges)")
+	flagPipeline     = flag.String("pipeline", defaultPipeline, "Comma-separated processor stages in execution order; unconfigured stages are skipped")
+	flagDedupWindow  = flag.Int("dedup_window", 0, "Drop samples whose idempotency key (or gpu/producer/timestamp) repeats within this many recent samples (0 disables)")
+	flagWALDir       = flag.String("wal_dir", "", "Directory for a local write-ahead journal; batches are acked to the broker once journaled and written to the store asynchronously (empty disables)")
+	flagWALSegmentMB = flag.Int("wal_segment_mb", 64, "Size at which the journal starts a new segment file (MiB)")
+	flagWALMaxMB     = flag.Int("wal_max_mb", 1024, "Stop receiving from the broker while the journal holds this much unwritten data (MiB, 0 = unlimited)")
 )
 
 var (
@@ -60,16 +120,98 @@ var (
 		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "flush_latency_seconds", Help: "Latency of batch flush to storage.",
 		Buckets: prometheus.DefBuckets,
 	})
+	metricInflightItems = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "inflight_items", Help: "Items buffered or being written to storage.",
+	})
+	metricInflightBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "inflight_bytes", Help: "Approximate bytes buffered or being written to storage.",
+	})
+	metricJobsQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "jobs_queued", Help: "Flush jobs waiting for a worker.",
+	})
+	metricBudgetWaits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "backpressure_waits_total", Help: "Times the collector paused receiving because the in-flight budget was exhausted.",
+	})
+	metricBrokerConnected = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "broker_connected", Help: "1 while the broker subscription is up, 0 otherwise.",
+	})
+	metricReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "reconnects_total", Help: "Broker resubscriptions after a stream error.",
+	})
+	metricAckErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "ack_errors_total", Help: "Failed Ack calls to the broker (messages will be redelivered).",
+	})
+	metricRuleActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "validation_actions_total", Help: "Validation rule actions taken, by metric and policy.",
+	}, []string{"metric", "action"})
+	metricAnomalies = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "anomalies_total", Help: "Anomalous samples detected, by metric and direction.",
+	}, []string{"metric", "direction"})
+	metricRollups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "rollups_emitted_total", Help: "Closed rollup windows emitted, by window.",
+	}, []string{"window"})
+	metricExported = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "otlp_exported_total", Help: "Messages exported to the OTLP endpoint.",
+	})
+	metricExportErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "otlp_export_errors_total", Help: "Failed OTLP export requests.",
+	})
+	metricSaveLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "batch_save_seconds", Help: "Latency of one SaveTelemetryBatch call, by sink.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"sink"})
+	metricPartialFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "batch_partial_failures_total", Help: "Batches where the store wrote some items and rejected others.",
+	})
+	metricLatestErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "latest_index_errors_total", Help: "Failed updates of the -latest_redis_url index of each GPU's newest point.",
+	})
+	// storeMetrics times every call to the raw telemetry store
+	storeMetrics  = storemetrics.New("collector")
+	metricReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "config_reloads_total", Help: "SIGHUP config reloads, by result.",
+	}, []string{"result"})
+	metricDrained = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "messages_drained_total", Help: "Messages received from the broker while draining on shutdown.",
+	})
+	metricStageDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "messages_dropped_total", Help: "Messages dropped by a pipeline stage, by stage.",
+	}, []string{"stage"})
+	metricForeignShard = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "messages_foreign_shard_total", Help: "Messages received for GPUs outside this collector's shard (processed anyway; check broker routing).",
+	})
+	metricWALBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "wal_bytes", Help: "Bytes held in the local write-ahead journal.",
+	})
+	metricWALSpooled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "wal_spooled_batches_total", Help: "Journaled batches left on disk because the in-flight budget was exhausted.",
+	})
+	metricWALErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "wal_errors_total", Help: "Journal failures, by operation (append, read, write, commit).",
+	}, []string{"op"})
+	metricDeadLettered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "collector", Name: "dead_letter_batches_total", Help: "InfluxDB batches given up after their retries, by result of appending them to -dead_letter_file (ok or error).",
+	}, []string{"result"})
 )
 
 func init() {
-	prometheus.MustRegister(metricReceived, metricBatched, metricFlushed, metricDroppedInvalid, metricFlushErrors, metricBacklog, metricFlushLatency)
+	prometheus.MustRegister(metricReceived, metricBatched, metricFlushed, metricDroppedInvalid, metricFlushErrors, metricBacklog, metricFlushLatency, metricInflightItems, metricInflightBytes, metricJobsQueued, metricBudgetWaits, metricBrokerConnected, metricReconnects, metricAckErrors, metricRuleActions, metricAnomalies, metricRollups, metricStageDropped, metricExported, metricExportErrors, metricDrained, metricSaveLatency, metricPartialFailures, metricReloads, metricForeignShard, metricWALBytes, metricWALSpooled, metricWALErrors, metricDeadLettered, metricLatestErrors)
+	prometheus.MustRegister(storeMetrics.Collectors()...)
 }
 
 func main() {
+	var cfg config.Collector
+	if err := config.Bind(flag.CommandLine, &cfg, config.PathFromArgs(os.Args[1:], "COLLECTOR_CONFIG"), "COLLECTOR"); err != nil {
+		log.Fatalf("collector: %v", err)
+	}
 	flag.Parse()
+	if *flagConfig != "" {
+		log.Printf("collector: loaded config %s", *flagConfig)
+	}
 
 	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/healthz", health.livenessHandler(*flagStallTimeout))
+	http.Handle("/readyz", health.readinessHandler(2*time.Second))
 	go func() {
 		log.Printf("collector: metrics on %s", *flagMetrics)
 		_ = http.ListenAndServe(*flagMetrics, nil)
@@ -81,67 +223,380 @@ func main() {
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	go func() { <-sigCh; log.Printf("collector: shutdown signal"); cancel() }()
 
-	if err := run(ctx); err != nil {
+	if err := run(ctx, cfg); err != nil {
 		log.Fatalf("collector error: %v", err)
 	}
 }
 
-func run(ctx context.Context) error {
-	var store storage.Store
-	// Prefer InfluxDB if configured; otherwise use in-memory
-	if stringsTrim(*flagInfluxURL) != "" && stringsTrim(*flagInfluxOrg) != "" && stringsTrim(*flagInfluxBucket) != "" && stringsTrim(*flagInfluxToken) != "" {
-		s, err := storage.NewInfluxStore(stringsTrim(*flagInfluxURL), stringsTrim(*flagInfluxOrg), stringsTrim(*flagInfluxBucket), stringsTrim(*flagInfluxToken))
+func run(ctx context.Context, cfg config.Collector) error {
+	if *flagShardCount > 0 && *flagShardIndex >= *flagShardCount {
+		return fmt.Errorf("-shard_index %d out of range for -shard_count %d", *flagShardIndex, *flagShardCount)
+	}
+	if *flagInfluxAsync && (*flagManualAck || stringsTrim(*flagWALDir) != "") {
+		return fmt.Errorf("-influx_async cannot be combined with -manual_ack or -wal_dir: writes return before the points are stored")
+	}
+	raw, err := openStore()
+	if err != nil {
+		return err
+	}
+	inventoryStore, _ := raw.(storage.InventoryStore)
+	if c, ok := raw.(io.Closer); ok {
+		defer c.Close() // sends what non-blocking writes still buffer
+	}
+	if u := stringsTrim(*flagLatestRedis); u != "" {
+		idx, err := storage.NewRedisLatest(u, "gpu-telemetry:")
+		if err != nil {
+			return fmt.Errorf("latest index: %w", err)
+		}
+		defer idx.Close()
+		raw = storage.NewLatestCache(raw, idx, func(err error) {
+			metricLatestErrors.Inc()
+			log.Printf("collector: %v", err)
+		})
+		log.Printf("collector: keeping each GPU's newest point in %s", storage.RedactURI(u))
+	}
+	store := storeMetrics.Wrap(raw, nil)
+	health.setStore(store)
+
+	if dir := stringsTrim(*flagWALDir); dir != "" {
+		l, err := wal.Open(dir, int64(*flagWALSegmentMB)<<20)
 		if err != nil {
-			return fmt.Errorf("open influx store: %w", err)
+			return fmt.Errorf("open journal: %w", err)
 		}
-		store = s
-		log.Printf("collector: using influx store url=%s org=%s bucket=%s", *flagInfluxURL, *flagInfluxOrg, *flagInfluxBucket)
-	} else {
-		store = storage.NewMemoryStore()
-		log.Printf("collector: using in-memory store")
+		defer l.Close()
+		journal = l
+		log.Printf("collector: journaling batches in %s", dir)
 	}
 
-	conn, err := grpc.Dial(*flagBroker, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	rl := newReloader(ctx)
+	defer rl.close()
+	set, err := rl.build(cfg)
+	if err != nil {
+		return err
+	}
+	stages, sinks, exportFn = set.stages, set.sinks, set.export
+	reloads = make(chan *stageSet)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go rl.watch(hup)
+
+	sec := grpcclient.Security{
+		TLS:        *flagBrokerTLS,
+		CAFile:     stringsTrim(*flagBrokerCA),
+		CertFile:   stringsTrim(*flagBrokerCert),
+		KeyFile:    stringsTrim(*flagBrokerKey),
+		ServerName: stringsTrim(*flagBrokerSNI),
+		Token:      stringsTrim(*flagBrokerToken),
+		TokenFile:  stringsTrim(*flagBrokerTokenF),
+	}
+	dialOpts, err := sec.DialOptions()
+	if err != nil {
+		return fmt.Errorf("broker security: %w", err)
+	}
+	if err := compression.Check(*flagCompress); err != nil {
+		return fmt.Errorf("-grpc_compression: %w", err)
+	}
+	dialOpts = append(dialOpts, compression.DialOptions(*flagCompress)...)
+	dialOpts = append(dialOpts, grpc.WithStatsHandler(compression.NewStatsHandler("collector", prometheus.DefaultRegisterer)))
+	conn, err := grpc.Dial(*flagBroker, dialOpts...)
 	if err != nil {
 		return fmt.Errorf("dial broker: %w", err)
 	}
 	defer conn.Close()
 	client := telemetryv1.NewTelemetryClient(conn)
-
-	stream, err := client.Subscribe(ctx, &telemetryv1.SubscriptionRequest{Group: *flagGroup})
+	// flags may be rewritten by a reload; the subscription keeps its startup values
+	group, manualAck := *flagGroup, *flagManualAck
+	caps, err := negotiate(ctx, conn, manualAck)
 	if err != nil {
-		return fmt.Errorf("subscribe: %w", err)
+		return err
+	}
+	if every := *flagGPUInfoSync; every > 0 {
+		if inventoryStore == nil {
+			log.Printf("collector: the store cannot keep GPU inventory; registered GPU info is not saved")
+		} else if !caps.Legacy && !caps.Has(telemetryv2.Feature_FEATURE_GPU_REGISTRY) {
+			log.Printf("collector: the broker keeps no GPU registry; registered GPU info is not saved")
+		} else {
+			go (&gpuInfoSync{client: client, store: inventoryStore}).run(ctx, every)
+		}
+	}
+	shardIndex, shardCount := uint32(*flagShardIndex), uint32(*flagShardCount)
+	if shardCount > 0 {
+		log.Printf("collector: shard %d of %d", shardIndex, shardCount)
 	}
+
+	subscribe := func(ctx context.Context) (subscribeStream, error) {
+		return client.Subscribe(ctx, &telemetryv1.SubscriptionRequest{Group: group, ManualAck: manualAck, ShardIndex: shardIndex, ShardCount: shardCount})
+	}
+	if manualAck {
+		ackFn = func(ctx context.Context, offsets []uint64) error {
+			_, err := client.Ack(ctx, &telemetryv1.AckRequest{Group: group, Offsets: offsets})
+			return err
+		}
+		log.Printf("collector: manual ack enabled")
+	}
+	// The subscription outlives ctx so the loop can drain it on shutdown; the loop closes it.
+	stream := newResubscribingStream(context.WithoutCancel(ctx), subscribe, time.Duration(*flagBackoffMs)*time.Millisecond, time.Duration(*flagBackoffMaxMs)*time.Millisecond)
+	defer stream.Close()
 	return runCollectorLoop(ctx, stream, store, *flagBatchSize, *flagFlushMs, *flagWorkers)
 }
 
+// negotiate asks the broker for its capabilities and fails if it cannot
+// take the acks manualAck needs. Brokers that predate telemetry.v2, or that
+// cannot be asked yet, are assumed to support what the collector uses.
+func negotiate(ctx context.Context, conn grpc.ClientConnInterface, manualAck bool) (grpcclient.Capabilities, error) {
+	want := []telemetryv2.Feature{telemetryv2.Feature_FEATURE_LABELS, telemetryv2.Feature_FEATURE_TYPED_VALUES, telemetryv2.Feature_FEATURE_GPU_REGISTRY}
+	if manualAck {
+		want = append(want, telemetryv2.Feature_FEATURE_MANUAL_ACK)
+	}
+	nctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	caps, err := grpcclient.Negotiate(nctx, conn, "collector/2", want...)
+	switch {
+	case err != nil:
+		log.Printf("collector: broker capabilities unknown: %v", err)
+		return grpcclient.Capabilities{Legacy: true}, nil
+	case caps.Legacy:
+		log.Printf("collector: broker predates telemetry.v2")
+	case manualAck && !caps.Has(telemetryv2.Feature_FEATURE_MANUAL_ACK):
+		return caps, fmt.Errorf("broker %s does not support -manual_ack", caps.Server)
+	default:
+		log.Printf("collector: broker %s api versions %v", caps.Server, caps.Versions)
+	}
+	return caps, nil
+}
+
+// influxConfigured reports whether all InfluxDB flags are set.
+func influxConfigured() bool {
+	return stringsTrim(*flagInfluxURL) != "" && stringsTrim(*flagInfluxOrg) != "" && stringsTrim(*flagInfluxBucket) != "" && stringsTrim(*flagInfluxToken) != ""
+}
+
+// storeURI returns -store_uri, or the URI the -store and backend flags name.
+func storeURI() (string, error) {
+	if u := stringsTrim(*flagStoreURI); u != "" {
+		return u, nil
+	}
+	kind := stringsTrim(*flagStore)
+	if kind == "" {
+		// Prefer InfluxDB if configured; otherwise use in-memory
+		kind = "memory"
+		if influxConfigured() {
+			kind = "influx"
+		} else if stringsTrim(*flagVictoriaURL) != "" {
+			kind = "victoria"
+		}
+	}
+	switch kind {
+	case "influx":
+		return storage.BackendURI("influx", stringsTrim(*flagInfluxURL), url.Values{
+			"org": {stringsTrim(*flagInfluxOrg)}, "bucket": {stringsTrim(*flagInfluxBucket)}, "token": {stringsTrim(*flagInfluxToken)},
+		})
+	case "victoria":
+		return storage.BackendURI("victoria", stringsTrim(*flagVictoriaURL), nil)
+	case "memory":
+		return "mem://", nil
+	}
+	return "", fmt.Errorf("unknown store %q (want influx, victoria or memory)", kind)
+}
+
+func openStore() (storage.Store, error) {
+	uri, err := storeURI()
+	if err != nil {
+		return nil, err
+	}
+	opts := storage.Options{Memory: memoryLimits()}
+	if *flagInfluxAsync {
+		if !strings.HasPrefix(uri, "influx") {
+			return nil, fmt.Errorf("-influx_async needs an InfluxDB store")
+		}
+		if opts.InfluxAsync, err = influxAsyncConfig(); err != nil {
+			return nil, err
+		}
+	}
+	s, err := storage.Open(uri, opts)
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
+	}
+	switch st := s.(type) {
+	case *storage.MemoryStore:
+		registerEvictionMetrics(st)
+		log.Printf("collector: using in-memory store (max %d points per GPU, max age %s)", *flagMemMaxPoints, *flagMemMaxAge)
+		return s, nil
+	case *storage.InfluxStore:
+		if opts.InfluxAsync != nil {
+			registerInfluxWriteMetrics(st)
+			log.Printf("collector: using store %s (non-blocking writes, batches of %d)", storage.RedactURI(uri), *flagInfluxBatch)
+			return s, nil
+		}
+	}
+	log.Printf("collector: using store %s", storage.RedactURI(uri))
+	return s, nil
+}
+
+// openSinkStore opens a secondary store for derived data (rollups, anomaly events)
+// on the same backend as raw telemetry but in its own measurement.
+func openSinkStore(measurement string) (storage.Store, error) {
+	uri, err := storeURI()
+	if err != nil {
+		return nil, err
+	}
+	return storage.Open(uri, storage.Options{Measurement: measurement, Memory: memoryLimits()})
+}
+
+func memoryLimits() storage.MemoryLimits {
+	return storage.MemoryLimits{MaxPointsPerGPU: *flagMemMaxPoints, MaxAge: *flagMemMaxAge}
+}
+
+// registerEvictionMetrics exports the evictions of the memory store for raw
+// telemetry as memory_evicted_points_total{reason}.
+func registerEvictionMetrics(mem *storage.MemoryStore) {
+	for reason, n := range map[string]func(storage.MemoryEvictions) uint64{
+		"capacity": func(e storage.MemoryEvictions) uint64 { return e.Capacity },
+		"age":      func(e storage.MemoryEvictions) uint64 { return e.Age },
+	} {
+		prometheus.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "gpu_telemetry", Subsystem: "collector", Name: "memory_evicted_points_total", Help: "Points the memory store dropped to stay within -memory_max_points (capacity) or -memory_max_age (age).",
+			ConstLabels: prometheus.Labels{"reason": reason},
+		}, func() float64 { return float64(n(mem.Evictions())) }))
+	}
+}
+
+func refreshInventory(ctx context.Context, inv *inventory.Inventory, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := inv.Reload(ctx); err != nil {
+				log.Printf("collector: inventory reload failed (keeping previous): %v", err)
+			}
+		}
+	}
+}
+
 type subscribeStream interface {
 	Recv() (*telemetryv1.TelemetryData, error)
 	Context() context.Context
 }
 
+// drainableStream is a subscribeStream whose lifetime is independent of the
+// loop's context. On shutdown the loop keeps receiving until the drain deadline
+// or an idle gap, then calls Close; messages still buffered at the broker are
+// requeued there, and unacked manual-ack messages are redelivered.
+type drainableStream interface {
+	subscribeStream
+	Close()
+}
+
 var tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(d) }
 
+// ackFn acknowledges broker offsets once their messages are persisted or
+// deliberately dropped; nil when the subscription does not use manual ack.
+var ackFn func(ctx context.Context, offsets []uint64) error
+
+func ack(offsets []uint64) {
+	if ackFn == nil || len(offsets) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ackFn(ctx, offsets); err != nil {
+		metricAckErrors.Inc()
+		log.Printf("collector: ack of %d offsets failed (broker will redeliver): %v", len(offsets), err)
+	}
+}
+
+// rawSink labels batches of raw telemetry, as opposed to derived-data sinks.
+const rawSink = "telemetry"
+
 func runCollectorLoop(ctx context.Context, stream subscribeStream, store storage.Store, batchSize, flushMs, workers int) error {
-	type job struct{ items []model.Telemetry }
-	jobs := make(chan job, 64)
+	if workers < 1 {
+		workers = 1
+	}
+	// one queue per worker; partition routes each GPU to a fixed worker so its
+	// points are never written out of order by two workers racing
+	queues := make([]chan job, workers)
+	for i := range queues {
+		queues[i] = make(chan job, 64)
+	}
+	queued := func() (n int) {
+		for _, q := range queues {
+			n += len(q)
+		}
+		return n
+	}
+	closeQueues := func() {
+		for _, q := range queues {
+			close(q)
+		}
+	}
+	shutdownTimeout := time.Duration(*flagShutdownMs) * time.Millisecond
+	shardIndex, shardCount := uint32(*flagShardIndex), uint32(*flagShardCount)
+	budget := newInflightBudget(*flagMaxItems, *flagMaxBytes)
+	enqueue := func(j job) {
+		parts := partition(j, workers)
+		if j.done != nil {
+			joinDone(j.done, parts)
+		}
+		for w, p := range parts {
+			if p == nil {
+				continue
+			}
+			health.jobQueued()
+			queues[w] <- *p
+		}
+		metricJobsQueued.Set(float64(queued()))
+	}
 	var wg sync.WaitGroup
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
-			for j := range jobs {
+			for j := range queues[id] {
+				metricJobsQueued.Set(float64(queued()))
 				start := time.Now()
 				n := 0
-				for _, it := range j.items {
-					if err := store.SaveTelemetry(it); err != nil {
+				acks := j.skipped
+				var failed map[int]error
+				var unwritten []model.Telemetry
+				if len(j.items) > 0 {
+					err := j.store.SaveTelemetryBatch(j.items)
+					metricSaveLatency.WithLabelValues(j.sink).Observe(time.Since(start).Seconds())
+					failed = storage.FailedItems(err, len(j.items))
+					if len(failed) > 0 && len(failed) < len(j.items) {
+						metricPartialFailures.Inc()
+						log.Printf("collector: partial flush sink=%s failed=%d of %d", j.sink, len(failed), len(j.items))
+					}
+				}
+				for i, it := range j.items {
+					if err, bad := failed[i]; bad {
 						metricFlushErrors.Inc()
 						log.Printf("collector: flush error gpu=%s ts=%s: %v", it.GPUId, it.Timestamp.UTC().Format(time.RFC3339), err)
+						unwritten = append(unwritten, it)
+						continue
+					}
+					metricFlushed.Inc()
+					n++
+					if i < len(j.offsets) && j.offsets[i] != 0 {
+						acks = append(acks, j.offsets[i])
+					}
+				}
+				ack(acks)
+				if j.export != nil && len(j.items) > 0 {
+					if err := j.export(context.Background(), j.items); err != nil {
+						metricExportErrors.Inc()
+						log.Printf("collector: otlp export of %d items failed: %v", len(j.items), err)
 					} else {
-						metricFlushed.Inc()
-						n++
+						metricExported.Add(float64(len(j.items)))
 					}
 				}
+				budget.release(int64(len(j.items)), j.bytes)
+				if j.done != nil {
+					j.done(unwritten)
+				}
+				health.jobDone()
 				dur := time.Since(start)
 				metricFlushLatency.Observe(dur.Seconds())
 				log.Printf("collector: worker=%d flushed=%d in %s", id, n, dur)
@@ -149,65 +604,198 @@ func runCollectorLoop(ctx context.Context, stream subscribeStream, store storage
 		}(i)
 	}
 
+	// with a journal, raw batches reach the workers through the spooler; it
+	// must stop before the queues are closed
+	var spool *spooler
+	stopSpool := func() {}
+	if journal != nil {
+		spool = newSpooler(journal, int64(*flagWALMaxMB)<<20, budget, store, enqueue)
+		stopSpool = spool.close
+	}
+
 	ticker := tickerFn(time.Duration(flushMs) * time.Millisecond)
 	defer ticker.Stop()
 
 	batch := make([]model.Telemetry, 0, batchSize)
+	var offsets, skipped []uint64
+	var batchBytes int64
+	var pause time.Duration
 
 	flush := func() {
-		if len(batch) == 0 {
+		if len(batch) == 0 && len(skipped) == 0 {
 			return
 		}
-		copyBatch := make([]model.Telemetry, len(batch))
-		copy(copyBatch, batch)
+		j := job{sink: rawSink, store: store, items: make([]model.Telemetry, len(batch)), export: exportFn}
+		copy(j.items, batch)
+		if ackFn != nil {
+			j.offsets = append([]uint64(nil), offsets...)
+			j.skipped = append([]uint64(nil), skipped...)
+		}
+		j.bytes = batchBytes
 		batch = batch[:0]
+		offsets = offsets[:0]
+		skipped = skipped[:0]
+		batchBytes = 0
 		metricBacklog.Set(0)
-		select {
-		case jobs <- job{items: copyBatch}:
-		default:
-			jobs <- job{items: copyBatch}
+		if spool != nil && spool.write(j) {
+			return
+		}
+		enqueue(j)
+	}
+
+	// derived enqueues rollup/anomaly output under the same in-flight budget.
+	derived := func(sink string, st storage.Store, items []model.Telemetry) {
+		var n int64
+		for _, it := range items {
+			n += approxSize(it)
+		}
+		budget.acquire(int64(len(items)), n)
+		enqueue(job{sink: sink, store: st, items: items, bytes: n})
+	}
+
+	// emit routes stage output to the store registered for its sink.
+	emit := func(sink string, items []model.Telemetry) {
+		st, ok := sinks[sink]
+		if !ok {
+			log.Printf("collector: no store for sink %q; dropping %d items", sink, len(items))
+			return
+		}
+		derived(sink, st, items)
+	}
+
+	// With a drainable stream, shutdown is driven by closing the stream: Recv
+	// keeps returning messages until the drain ends, then fails and the loop
+	// takes the stream-error exit below.
+	done := ctx.Done()
+	waitCtx := ctx
+	touch := func() {}
+	if ds, ok := stream.(drainableStream); ok {
+		done = nil
+		waitCtx = ds.Context()
+		drain := time.Duration(*flagDrainMs) * time.Millisecond
+		idle := time.Duration(*flagDrainIdleMs) * time.Millisecond
+		var mu sync.Mutex
+		var idleTimer, deadline *time.Timer
+		stop := context.AfterFunc(ctx, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			log.Printf("collector: shutdown; draining broker stream for up to %s", drain)
+			deadline = time.AfterFunc(drain, ds.Close)
+			idleTimer = time.AfterFunc(min(idle, drain), ds.Close)
+		})
+		defer func() {
+			stop()
+			mu.Lock()
+			defer mu.Unlock()
+			if deadline != nil {
+				deadline.Stop()
+				idleTimer.Stop()
+			}
+		}()
+		touch = func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if idleTimer != nil {
+				metricDrained.Inc()
+				idleTimer.Reset(idle)
+			}
 		}
 	}
 
 	for {
 		select {
-		case <-ctx.Done():
+		case <-done:
 			flush()
-			close(jobs)
+			stages.Flush(emit)
+			stopSpool()
+			closeQueues()
 			waitDone := make(chan struct{})
 			go func() { wg.Wait(); close(waitDone) }()
 			select {
 			case <-waitDone:
 				return nil
-			case <-time.After(time.Duration(*flagShutdownMs) * time.Millisecond):
-				log.Printf("collector: shutdown timeout after %dms; exiting now", *flagShutdownMs)
+			case <-time.After(shutdownTimeout):
+				log.Printf("collector: shutdown timeout after %s; exiting now", shutdownTimeout)
 				return nil
 			}
+		case set := <-reloads:
+			// close the old stages' open windows into their own sinks before swapping
+			stages.Flush(emit)
+			stages, sinks, exportFn = set.stages, set.sinks, set.export
+			log.Printf("collector: reloaded; pipeline stages=%v", stages.Names())
 		case <-ticker.C:
 			log.Printf("collector: timer flush batch=%d", len(batch))
 			flush()
 		default:
+			// with a journal only a full journal stops receiving; the spooler
+			// holds batches on disk while the in-flight budget is exhausted
+			exceeded, wait := budget.exceeded(), budget.wait
+			if spool != nil {
+				exceeded, wait = spool.full(), spool.waitRoom
+			}
+			health.saturated.Store(exceeded)
+			if exceeded {
+				// hand the pending batch to the workers and stop reading until they catch up;
+				// the unread stream backs up into the broker, which signals backpressure upstream
+				flush()
+				metricBudgetWaits.Inc()
+				if err := wait(waitCtx); err != nil {
+					// the drained stream is closed while the workers still
+					// hold the budget: block until they release some, for a
+					// growing pause, rather than spinning back here
+					pause = pauseBackoff(pause)
+					pctx, cancel := context.WithTimeout(context.Background(), pause)
+					_ = wait(pctx)
+					cancel()
+					continue
+				}
+				pause = 0
+			}
 			msg, err := stream.Recv()
 			if err != nil {
 				flush()
-				close(jobs)
+				stages.Flush(emit)
+				stopSpool()
+				closeQueues()
+				if ctx.Err() != nil {
+					// drained on shutdown; not a stream failure
+					err = nil
+				} else {
+					err = fmt.Errorf("recv: %w", err)
+				}
 				waitDone := make(chan struct{})
 				go func() { wg.Wait(); close(waitDone) }()
 				select {
 				case <-waitDone:
-					return fmt.Errorf("recv: %w", err)
-				case <-time.After(time.Duration(*flagShutdownMs) * time.Millisecond):
-					log.Printf("collector: shutdown timeout after %dms; exiting now", *flagShutdownMs)
-					return fmt.Errorf("recv: %w", err)
+					return err
+				case <-time.After(shutdownTimeout):
+					log.Printf("collector: shutdown timeout after %s; exiting now", shutdownTimeout)
+					return err
 				}
 			}
+			touch()
 			metricReceived.Inc()
 			if ok := validate(msg); !ok {
 				metricDroppedInvalid.Inc()
+				skipped = append(skipped, msg.GetOffset())
 				continue
 			}
+			if !shard.Owns(shardIndex, shardCount, msg.GetGpuId()) {
+				// the broker does not route by shard; processing it is still safe
+				// since it was delivered to this collector only
+				metricForeignShard.Inc()
+			}
 			t := toModel(msg)
+			if keep, by := stages.Process(&t, emit); !keep {
+				metricStageDropped.WithLabelValues(by).Inc()
+				skipped = append(skipped, msg.GetOffset())
+				continue
+			}
 			batch = append(batch, t)
+			offsets = append(offsets, msg.GetOffset())
+			sz := approxSize(t)
+			batchBytes += sz
+			budget.acquire(1, sz)
 			metricBatched.Inc()
 			metricBacklog.Set(float64(len(batch)))
 			if len(batch) >= batchSize {
@@ -235,12 +823,42 @@ func stringsTrim(s string) string { return strings.TrimSpace(s) }
 
 func toModel(m *telemetryv1.TelemetryData) model.Telemetry {
 	out := model.Telemetry{
-		GPUId:     m.GetGpuId(),
-		Timestamp: m.GetTs().AsTime(),
-		Metrics:   map[string]float64{},
+		GPUId:          m.GetGpuId(),
+		HostId:         m.GetHostId(),
+		ProducerId:     m.GetProducerId(),
+		Timestamp:      m.GetTs().AsTime(),
+		Metrics:        map[string]float64{},
+		IdempotencyKey: m.GetIdempotencyKey(),
 	}
 	for k, v := range m.GetMetrics() {
 		out.Metrics[k] = v
 	}
+	if len(m.GetLabels()) > 0 {
+		out.Labels = make(map[string]string, len(m.GetLabels()))
+		for k, v := range m.GetLabels() {
+			out.Labels[k] = v
+		}
+	}
+	for k, v := range m.GetValues() {
+		var tv model.Value
+		switch x := v.GetValue().(type) {
+		case *telemetryv1.MetricValue_FloatValue:
+			// a plain float is a metric, whichever field it came in
+			out.Metrics[k] = x.FloatValue
+			continue
+		case *telemetryv1.MetricValue_IntValue:
+			tv = model.IntValue(x.IntValue)
+		case *telemetryv1.MetricValue_BoolValue:
+			tv = model.BoolValue(x.BoolValue)
+		case *telemetryv1.MetricValue_StringValue:
+			tv = model.StringValue(x.StringValue)
+		default:
+			continue
+		}
+		if out.Values == nil {
+			out.Values = make(map[string]model.Value, len(m.GetValues()))
+		}
+		out.Values[k] = tv
+	}
 	return out
 }
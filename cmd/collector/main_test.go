@@ -1,11 +1,23 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"reflect"
 	"testing"
 	"time"
 
 	telemetryv1 "gpu-metric-collector/api/gen"
+	telemetryv2 "gpu-metric-collector/api/gen/v2"
+	"gpu-metric-collector/internal/config"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/pipeline"
+	"gpu-metric-collector/internal/validation"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -76,6 +88,22 @@ func TestToModel_Mapping(t *testing.T) {
 	}
 }
 
+func TestToModel_Values(t *testing.T) {
+	// Scenario: typed values of each kind, one of them a float
+	// Expect: int, bool and string as model values; the float as a metric
+	m := &telemetryv1.TelemetryData{GpuId: "g1", Ts: timestamppb.Now(), Values: map[string]*telemetryv1.MetricValue{
+		"serial": {Value: &telemetryv1.MetricValue_IntValue{IntValue: 1 << 60}},
+		"ecc":    {Value: &telemetryv1.MetricValue_BoolValue{BoolValue: true}},
+		"pstate": {Value: &telemetryv1.MetricValue_StringValue{StringValue: "P0"}},
+		"temp":   {Value: &telemetryv1.MetricValue_FloatValue{FloatValue: 61}},
+	}}
+	got := toModel(m)
+	want := map[string]model.Value{"serial": model.IntValue(1 << 60), "ecc": model.BoolValue(true), "pstate": model.StringValue("P0")}
+	if !reflect.DeepEqual(got.Values, want) || got.Metrics["temp"] != 61 {
+		t.Fatalf("values %v metrics %v", got.Values, got.Metrics)
+	}
+}
+
 func TestValidate_WhitespaceGPU(t *testing.T) {
 	// Scenario: gpu id contains only whitespace
 	// Input: TelemetryData{GpuId: "   ", Ts: now}
@@ -100,3 +128,162 @@ func TestToModel_DeepCopyMetrics(t *testing.T) {
 		t.Fatalf("expected deep copy to preserve 70, got %v", got.Metrics["temp"])
 	}
 }
+
+func TestConfigSchemaFlagsExist(t *testing.T) {
+	// Scenario: every `flag` tag in the config schema must name a registered collector flag
+	// Expect: flag.Lookup succeeds for each tag
+	var walk func(rt reflect.Type)
+	walk = func(rt reflect.Type) {
+		for i := 0; i < rt.NumField(); i++ {
+			f := rt.Field(i)
+			if name := f.Tag.Get("flag"); name != "" && flag.Lookup(name) == nil {
+				t.Fatalf("config field %s binds unknown flag -%s", f.Name, name)
+			}
+			if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Duration(0)) {
+				walk(f.Type)
+			}
+		}
+	}
+	walk(reflect.TypeOf(config.Collector{}))
+}
+
+func TestToModel_HostAndProducer(t *testing.T) {
+	// Scenario: producer and host identity must survive the mapping
+	// Expect: HostId/ProducerId copied from the message
+	m := &telemetryv1.TelemetryData{GpuId: "g1", HostId: "node-1", ProducerId: "streamer-1", Ts: timestamppb.Now()}
+	got := toModel(m)
+	if got.HostId != "node-1" || got.ProducerId != "streamer-1" {
+		t.Fatalf("host/producer lost: %#v", got)
+	}
+}
+
+func TestToModel_Labels(t *testing.T) {
+	// Scenario: a message with labels, mutated after the mapping
+	// Expect: the labels are copied, not shared
+	m := &telemetryv1.TelemetryData{GpuId: "g1", Ts: timestamppb.Now(), Labels: map[string]string{"cluster": "c1", "rack": "r7"}}
+	got := toModel(m)
+	m.Labels["cluster"] = "c2"
+	if len(got.Labels) != 2 || got.Labels["cluster"] != "c1" || got.Labels["rack"] != "r7" {
+		t.Fatalf("labels: %#v", got.Labels)
+	}
+}
+
+func TestBuildPipeline_FollowsConfiguredOrder(t *testing.T) {
+	// Scenario: -pipeline lists transform before dedup; validate/enrich are listed but unconfigured
+	// Expect: only configured stages, in the listed order
+	oldPipeline, oldDedup := *flagPipeline, *flagDedupWindow
+	defer func() { *flagPipeline, *flagDedupWindow = oldPipeline, oldDedup }()
+	*flagPipeline = "validate,transform,enrich,dedup"
+	*flagDedupWindow = 100
+	cfg := config.Collector{Pipeline: config.Pipeline{Transforms: []pipeline.TransformRule{{Metric: "power_mw", Rename: "power_w", Scale: 0.001}}}}
+
+	p, _, err := buildPipeline(context.Background(), cfg, nil)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if got := p.Names(); !reflect.DeepEqual(got, []string{"transform", "dedup"}) {
+		t.Fatalf("stages = %v", got)
+	}
+
+	*flagPipeline = "validate,bogus"
+	if _, _, err := buildPipeline(context.Background(), cfg, nil); err == nil {
+		t.Fatal("expected error for unknown stage")
+	}
+}
+
+func TestBuildPipeline_SpecBounds(t *testing.T) {
+	// Scenario: -spec_bounds=drop with an inline clamp rule for the GPU
+	// temperature
+	// Expect: the temperature is clamped by its explicit rule, a utilization
+	// above 100% is dropped by the catalog's bound
+	oldPipeline, oldSpec := *flagPipeline, *flagSpecBounds
+	defer func() { *flagPipeline, *flagSpecBounds = oldPipeline, oldSpec }()
+	*flagPipeline, *flagSpecBounds = "validate", "drop"
+	hi := 90.0
+	cfg := config.Collector{Validation: config.Validation{Rules: []validation.Rule{{Metric: "DCGM_FI_DEV_GPU_TEMP", Max: &hi, Policy: validation.PolicyClamp}}}}
+
+	p, _, err := buildPipeline(context.Background(), cfg, nil)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	hot := &model.Telemetry{GPUId: "g1", Timestamp: time.Now(), Metrics: map[string]float64{"DCGM_FI_DEV_GPU_TEMP": 200}}
+	if keep, _ := p.Process(hot, nil); !keep || hot.Metrics["DCGM_FI_DEV_GPU_TEMP"] != 90 {
+		t.Fatalf("keep=%v metrics=%v", keep, hot.Metrics)
+	}
+	busy := &model.Telemetry{GPUId: "g1", Timestamp: time.Now(), Metrics: map[string]float64{"DCGM_FI_DEV_GPU_UTIL": 140}}
+	if keep, by := p.Process(busy, nil); keep || by != "validate" {
+		t.Fatalf("keep=%v droppedBy=%q", keep, by)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	got, err := parseHeaders(" X-Api-Key = abc ,tenant=gpu,")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !reflect.DeepEqual(got, map[string]string{"x-api-key": "abc", "tenant": "gpu"}) {
+		t.Fatalf("headers = %v", got)
+	}
+	if _, err := parseHeaders("novalue"); err == nil {
+		t.Fatal("expected error for header without '='")
+	}
+}
+
+func TestReloader_ReusesSinkStores(t *testing.T) {
+	// Scenario: two builds with anomaly detection enabled (in-memory sinks)
+	// Expect: the second build reuses the anomaly sink store, keeping its data
+	oldZ, oldPipeline := *flagAnomalyZ, *flagPipeline
+	defer func() { *flagAnomalyZ, *flagPipeline = oldZ, oldPipeline }()
+	*flagAnomalyZ = 3
+	*flagPipeline = "anomaly"
+
+	r := newReloader(context.Background())
+	defer r.close()
+	first, err := r.build(config.Collector{})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	second, err := r.build(config.Collector{})
+	if err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if first.sinks[anomalySink] == nil || first.sinks[anomalySink] != second.sinks[anomalySink] {
+		t.Fatalf("anomaly sink not reused: %v vs %v", first.sinks, second.sinks)
+	}
+}
+
+// capsConn answers GetCapabilities with caps, or with err when set.
+type capsConn struct {
+	grpc.ClientConnInterface
+	caps *telemetryv2.Capabilities
+	err  error
+}
+
+func (c capsConn) Invoke(_ context.Context, _ string, _, reply any, _ ...grpc.CallOption) error {
+	if c.err != nil {
+		return c.err
+	}
+	proto.Merge(reply.(proto.Message), c.caps)
+	return nil
+}
+
+func TestNegotiate_ManualAck(t *testing.T) {
+	// Scenario: -manual_ack against a v2 broker without acks, one with them,
+	// and a broker from before telemetry.v2
+	// Expect: an error only for the first; the legacy broker is assumed able
+	noAck := capsConn{caps: &telemetryv2.Capabilities{ApiVersions: []uint32{1, 2}, Features: []telemetryv2.Feature{telemetryv2.Feature_FEATURE_LABELS}}}
+	if _, err := negotiate(context.Background(), noAck, true); err == nil {
+		t.Fatal("expected an error for a broker without acks")
+	}
+	if _, err := negotiate(context.Background(), noAck, false); err != nil {
+		t.Fatalf("without -manual_ack: %v", err)
+	}
+	acks := capsConn{caps: &telemetryv2.Capabilities{ApiVersions: []uint32{1, 2}, Features: []telemetryv2.Feature{telemetryv2.Feature_FEATURE_MANUAL_ACK}}}
+	if caps, err := negotiate(context.Background(), acks, true); err != nil || caps.Legacy {
+		t.Fatalf("acks: %+v %v", caps, err)
+	}
+	legacy := capsConn{err: status.Error(codes.Unimplemented, "unknown service telemetry.v2.Telemetry")}
+	if caps, err := negotiate(context.Background(), legacy, true); err != nil || !caps.Legacy {
+		t.Fatalf("legacy: %+v %v", caps, err)
+	}
+}
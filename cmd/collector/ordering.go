@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+// job is one unit of work for a flush worker. offsets[i] is the broker offset
+// of items[i] (0 for derived data); skipped holds offsets of messages that
+// were dropped and only need acking. done, if set, is called once the job has
+// been written, with the items whose write failed (none if every item was).
+type job struct {
+	sink    string
+	store   storage.Store
+	items   []model.Telemetry
+	offsets []uint64
+	skipped []uint64
+	bytes   int64
+	export  func(ctx context.Context, items []model.Telemetry) error
+	done    func(failed []model.Telemetry)
+}
+
+// workerFor maps a GPU to a flush worker. Every batch containing the GPU goes
+// to the same worker, whose queue is FIFO, so the GPU's points are persisted in
+// the order they were received.
+func workerFor(gpuID string, workers int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(gpuID))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// partition splits j into one job per worker by GPU. Within each part items are
+// stably sorted by timestamp, so a batch that arrived slightly out of order is
+// still written in time order per GPU. Parts with nothing to do are nil;
+// skipped offsets ride on the first non-nil part.
+func partition(j job, workers int) []*job {
+	parts := make([]*job, workers)
+	idx := make([][]int, workers)
+	for i, it := range j.items {
+		w := workerFor(it.GPUId, workers)
+		idx[w] = append(idx[w], i)
+	}
+	for w, ii := range idx {
+		if len(ii) == 0 {
+			continue
+		}
+		sort.SliceStable(ii, func(a, b int) bool { return j.items[ii[a]].Timestamp.Before(j.items[ii[b]].Timestamp) })
+		p := &job{sink: j.sink, store: j.store, export: j.export, items: make([]model.Telemetry, len(ii))}
+		if j.offsets != nil {
+			p.offsets = make([]uint64, len(ii))
+		}
+		for k, i := range ii {
+			p.items[k] = j.items[i]
+			if j.offsets != nil {
+				p.offsets[k] = j.offsets[i]
+			}
+			p.bytes += approxSize(j.items[i])
+		}
+		parts[w] = p
+	}
+	if len(j.skipped) > 0 {
+		first := 0
+		for first < workers-1 && parts[first] == nil {
+			first++
+		}
+		if parts[first] == nil {
+			parts[first] = &job{sink: j.sink, store: j.store}
+		}
+		parts[first].skipped = j.skipped
+	}
+	return parts
+}
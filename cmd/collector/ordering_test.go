@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestPartition_GroupsByGPUAndSortsByTime(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	j := job{
+		sink: rawSink,
+		items: []model.Telemetry{
+			{GPUId: "g1", Timestamp: base.Add(2 * time.Second)},
+			{GPUId: "g2", Timestamp: base},
+			{GPUId: "g1", Timestamp: base},
+			{GPUId: "g3", Timestamp: base.Add(time.Second)},
+		},
+		offsets: []uint64{1, 2, 3, 4},
+		skipped: []uint64{9},
+	}
+	parts := partition(j, 3)
+	var items, skipped int
+	for w, p := range parts {
+		if p == nil {
+			continue
+		}
+		items += len(p.items)
+		skipped += len(p.skipped)
+		for k, it := range p.items {
+			if workerFor(it.GPUId, 3) != w {
+				t.Fatalf("gpu %s routed to worker %d", it.GPUId, w)
+			}
+			if k > 0 && p.items[k].GPUId == p.items[k-1].GPUId && p.items[k].Timestamp.Before(p.items[k-1].Timestamp) {
+				t.Fatalf("worker %d items out of order: %v", w, p.items)
+			}
+			if it.GPUId == "g1" && it.Timestamp.Equal(base) && p.offsets[k] != 3 {
+				t.Fatalf("offset not kept with its item: %v", p.offsets)
+			}
+		}
+	}
+	if items != 4 || skipped != 1 {
+		t.Fatalf("expected 4 items and 1 skipped offset across parts, got %d and %d", items, skipped)
+	}
+}
+
+// jitterStore records save order and sleeps a little per batch so workers race.
+type jitterStore struct {
+	mu    sync.Mutex
+	items []model.Telemetry
+}
+
+func (s *jitterStore) SaveTelemetry(t model.Telemetry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append(s.items, t)
+	return nil
+}
+func (s *jitterStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+	return storage.SaveEach(s.SaveTelemetry, items)
+}
+func (s *jitterStore) ListGPUs() ([]string, error) { return nil, nil }
+func (s *jitterStore) QueryTelemetry(string, *time.Time, *time.Time) ([]model.Telemetry, error) {
+	return nil, nil
+}
+
+func TestCollector_PerGPUOrderAcrossWorkers(t *testing.T) {
+	ctx := context.Background()
+	fs := newFakeStream(ctx, 200)
+	st := &jitterStore{}
+
+	oldTicker := tickerFn
+	tickerFn = func(d time.Duration) *time.Ticker { return time.NewTicker(24 * time.Hour) }
+	defer func() { tickerFn = oldTicker }()
+
+	done := make(chan struct{})
+	go func() {
+		_ = runCollectorLoop(ctx, fs, st, 3, 1000, 4)
+		close(done)
+	}()
+	base := time.Unix(1700000000, 0)
+	for i := 0; i < 150; i++ {
+		gpu := []string{"g0", "g1", "g2", "g3", "g4"}[i%5]
+		fs.ch <- &telemetryv1.TelemetryData{GpuId: gpu, Ts: timestamppb.New(base.Add(time.Duration(i) * time.Second))}
+	}
+	fs.close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting loop to finish")
+	}
+
+	if len(st.items) != 150 {
+		t.Fatalf("expected 150 items, got %d", len(st.items))
+	}
+	last := map[string]time.Time{}
+	for _, it := range st.items {
+		if it.Timestamp.Before(last[it.GPUId]) {
+			t.Fatalf("gpu %s written out of order: %s after %s", it.GPUId, it.Timestamp, last[it.GPUId])
+		}
+		last[it.GPUId] = it.Timestamp
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/anomaly"
+	"gpu-metric-collector/internal/config"
+	"gpu-metric-collector/internal/inventory"
+	"gpu-metric-collector/internal/metricspec"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/pipeline"
+	"gpu-metric-collector/internal/rollup"
+	"gpu-metric-collector/internal/storage"
+	"gpu-metric-collector/internal/validation"
+)
+
+// defaultPipeline is the stage order used when -pipeline is not set. Stages
+// that are not configured (no rules, no inventory, ...) are skipped.
+const defaultPipeline = "validate,dedup,enrich,transform,anomaly,rollup"
+
+// stages is applied to every sample that passes basic validation; nil passes
+// samples through unchanged.
+var stages *pipeline.Pipeline
+
+// sinks maps the sink names stages emit to onto the stores derived data is
+// written to, so rollups and anomaly events land apart from raw telemetry.
+var sinks = map[string]storage.Store{}
+
+// sinkSet collects the sink stores opened while building a pipeline. Stores
+// from the previous build are reused by name, so a reload keeps their
+// connections and, for in-memory sinks, their data.
+type sinkSet struct {
+	prev, cur map[string]storage.Store
+}
+
+func (s *sinkSet) open(name, measurement string) (storage.Store, error) {
+	st, ok := s.prev[name]
+	if !ok {
+		var err error
+		if st, err = openSinkStore(measurement); err != nil {
+			return nil, err
+		}
+	}
+	s.cur[name] = st
+	return st, nil
+}
+
+// newStageRegistry registers the collector's built-in stages. Custom stages
+// (e.g. site-specific unit conversions) can be added with Register before Build.
+func newStageRegistry(ctx context.Context, cfg config.Collector, out *sinkSet) *pipeline.Registry {
+	reg := pipeline.NewRegistry()
+	reg.Register("validate", func() (pipeline.Processor, error) {
+		var r *validation.Rules
+		var err error
+		if p := stringsTrim(*flagRules); p != "" {
+			if r, err = validation.Load(p); err != nil {
+				return nil, err
+			}
+			log.Printf("collector: loaded %d validation rules from %s", r.Len(), p)
+		} else if len(cfg.Validation.Rules) > 0 {
+			if r, err = validation.New(cfg.Validation.Rules); err != nil {
+				return nil, err
+			}
+			log.Printf("collector: loaded %d inline validation rules", r.Len())
+		}
+		if p := stringsTrim(*flagSpecBounds); p != "" {
+			if r, err = r.WithDefaults(specRules(validation.Policy(p))); err != nil {
+				return nil, err
+			}
+			log.Printf("collector: checking catalog bounds with policy %s (%d rules)", p, r.Len())
+		}
+		if r == nil {
+			return nil, nil
+		}
+		return &validateStage{rules: r}, nil
+	})
+	reg.Register("dedup", func() (pipeline.Processor, error) {
+		if *flagDedupWindow <= 0 {
+			return nil, nil
+		}
+		log.Printf("collector: dedup window=%d", *flagDedupWindow)
+		return pipeline.NewDedup(*flagDedupWindow), nil
+	})
+	reg.Register("enrich", func() (pipeline.Processor, error) {
+		src := stringsTrim(*flagInventory)
+		if src == "" {
+			return nil, nil
+		}
+		inv := inventory.New(src)
+		if err := inv.Reload(ctx); err != nil {
+			return nil, err
+		}
+		log.Printf("collector: loaded inventory for %d gpus from %s", inv.Len(), src)
+		if *flagInventoryRef > 0 {
+			go refreshInventory(ctx, inv, *flagInventoryRef)
+		}
+		return &enrichStage{inv: inv}, nil
+	})
+	reg.Register("transform", func() (pipeline.Processor, error) {
+		if len(cfg.Pipeline.Transforms) == 0 {
+			return nil, nil
+		}
+		log.Printf("collector: loaded %d metric transforms", len(cfg.Pipeline.Transforms))
+		return pipeline.NewTransform(cfg.Pipeline.Transforms), nil
+	})
+	reg.Register("anomaly", func() (pipeline.Processor, error) {
+		if *flagAnomalyZ <= 0 {
+			return nil, nil
+		}
+		if _, err := out.open(anomalySink, "telemetry_anomalies"); err != nil {
+			return nil, fmt.Errorf("open anomaly store: %w", err)
+		}
+		log.Printf("collector: anomaly detection z>=%.2f alpha=%.2f warmup=%d", *flagAnomalyZ, *flagAnomalyAlpha, *flagAnomalyWarm)
+		return &anomalyStage{det: anomaly.NewDetector(anomaly.Config{Alpha: *flagAnomalyAlpha, Threshold: *flagAnomalyZ, Warmup: *flagAnomalyWarm})}, nil
+	})
+	reg.Register("rollup", func() (pipeline.Processor, error) {
+		spec, err := rollup.ParseSpec(*flagRollups)
+		if err != nil {
+			return nil, err
+		}
+		windows := spec.Windows()
+		if len(windows) == 0 {
+			return nil, nil
+		}
+		for _, w := range windows {
+			measurement := "telemetry_rollup_" + rollup.Name(w)
+			if _, err := out.open(rollupSink(w), measurement); err != nil {
+				return nil, fmt.Errorf("open rollup store %s: %w", measurement, err)
+			}
+			log.Printf("collector: rollups window=%s measurement=%s", rollup.Name(w), measurement)
+		}
+		return &rollupStage{agg: rollup.NewAggregator(spec)}, nil
+	})
+	return reg
+}
+
+// buildPipeline assembles the stages named by -pipeline in order and returns
+// the sink stores they emit to; prev holds the sinks of the pipeline being
+// replaced, if any.
+func buildPipeline(ctx context.Context, cfg config.Collector, prev map[string]storage.Store) (*pipeline.Pipeline, map[string]storage.Store, error) {
+	out := &sinkSet{prev: prev, cur: map[string]storage.Store{}}
+	p, err := newStageRegistry(ctx, cfg, out).Build(strings.Split(*flagPipeline, ","))
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("collector: pipeline stages=%v", p.Names())
+	return p, out.cur, nil
+}
+
+// specRules turns the bounds of the metricspec catalog into rules with
+// policy.
+func specRules(policy validation.Policy) []validation.Rule {
+	var rules []validation.Rule
+	for _, s := range metricspec.All() {
+		if s.Min == nil && s.Max == nil {
+			continue
+		}
+		rules = append(rules, validation.Rule{Metric: s.Name, Min: s.Min, Max: s.Max, Policy: policy})
+	}
+	return rules
+}
+
+// validateStage applies per-metric range rules.
+type validateStage struct {
+	rules *validation.Rules
+}
+
+func (s *validateStage) Name() string { return "validate" }
+
+func (s *validateStage) Process(t *model.Telemetry, _ pipeline.Emit) bool {
+	keep, actions := s.rules.Apply(t)
+	for _, a := range actions {
+		metricRuleActions.WithLabelValues(a.Metric, string(a.Policy)).Inc()
+	}
+	if !keep {
+		metricDroppedInvalid.Inc()
+	}
+	return keep
+}
+
+// enrichStage labels telemetry with static GPU inventory info.
+type enrichStage struct {
+	inv *inventory.Inventory
+}
+
+func (s *enrichStage) Name() string { return "enrich" }
+
+func (s *enrichStage) Process(t *model.Telemetry, _ pipeline.Emit) bool {
+	s.inv.Enrich(t)
+	return true
+}
+
+const anomalySink = "anomalies"
+
+// anomalyStage emits anomaly events for samples that deviate from their EWMA baseline.
+type anomalyStage struct {
+	det *anomaly.Detector
+}
+
+func (s *anomalyStage) Name() string { return "anomaly" }
+
+func (s *anomalyStage) Process(t *model.Telemetry, emit pipeline.Emit) bool {
+	events := s.det.Observe(*t)
+	if len(events) == 0 {
+		return true
+	}
+	items := make([]model.Telemetry, 0, len(events))
+	for _, e := range events {
+		metricAnomalies.WithLabelValues(e.Metric, e.Direction()).Inc()
+		items = append(items, e.Telemetry())
+	}
+	emit(anomalySink, items)
+	return true
+}
+
+// rollupSink names the sink that receives rollups for window w.
+func rollupSink(w time.Duration) string { return "rollup_" + rollup.Name(w) }
+
+// rollupStage emits closed min/max/avg windows, one sink per window.
+type rollupStage struct {
+	agg *rollup.Aggregator
+}
+
+func (s *rollupStage) Name() string { return "rollup" }
+
+func (s *rollupStage) Process(t *model.Telemetry, emit pipeline.Emit) bool {
+	s.emit(s.agg.Add(*t), emit)
+	return true
+}
+
+func (s *rollupStage) Flush(emit pipeline.Emit) {
+	s.emit(s.agg.Flush(), emit)
+}
+
+func (s *rollupStage) emit(points []rollup.Point, emit pipeline.Emit) {
+	if len(points) == 0 {
+		return
+	}
+	byWindow := map[time.Duration][]model.Telemetry{}
+	for _, p := range points {
+		byWindow[p.Window] = append(byWindow[p.Window], p.Telemetry)
+	}
+	for w, items := range byWindow {
+		metricRollups.WithLabelValues(rollup.Name(w)).Add(float64(len(items)))
+		emit(rollupSink(w), items)
+	}
+}
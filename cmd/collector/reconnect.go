@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+)
+
+// subscribeFunc opens a new broker subscription.
+type subscribeFunc func(ctx context.Context) (subscribeStream, error)
+
+// resubscribingStream is a subscribeStream that survives broker restarts and
+// network errors: on any Recv or Subscribe failure it backs off exponentially
+// and subscribes again, so the collector loop (and its pending batch) keeps running.
+// It only returns an error once ctx is done.
+//
+// When the broken stream's subscriber is dropped the broker requeues the
+// messages it had not acked, so with manual ack they are redelivered after the
+// resubscribe, to this or another collector; store writes are idempotent by
+// offset, so redelivered messages already stored are not duplicated.
+type resubscribingStream struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	subscribe  subscribeFunc
+	cur        subscribeStream
+	backoff    time.Duration
+	backoffMin time.Duration
+	backoffMax time.Duration
+}
+
+func newResubscribingStream(ctx context.Context, subscribe subscribeFunc, backoffMin, backoffMax time.Duration) *resubscribingStream {
+	ctx, cancel := context.WithCancel(ctx)
+	return &resubscribingStream{
+		ctx:        ctx,
+		cancel:     cancel,
+		subscribe:  subscribe,
+		backoff:    backoffMin,
+		backoffMin: backoffMin,
+		backoffMax: backoffMax,
+	}
+}
+
+func (r *resubscribingStream) Context() context.Context { return r.ctx }
+
+// Close ends the subscription; a blocked Recv returns the context error.
+func (r *resubscribingStream) Close() { r.cancel() }
+
+func (r *resubscribingStream) Recv() (*telemetryv1.TelemetryData, error) {
+	for {
+		if err := r.ctx.Err(); err != nil {
+			return nil, err
+		}
+		if r.cur == nil {
+			s, err := r.subscribe(r.ctx)
+			if err != nil {
+				if r.ctx.Err() != nil {
+					return nil, r.ctx.Err()
+				}
+				log.Printf("collector: subscribe failed: %v (retrying in %s)", err, r.backoff)
+				if err := r.wait(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			r.cur = s
+			metricBrokerConnected.Set(1)
+			health.connected.Store(true)
+			log.Printf("collector: subscribed to broker")
+		}
+		msg, err := r.cur.Recv()
+		if err == nil {
+			r.backoff = r.backoffMin
+			return msg, nil
+		}
+		r.cur = nil
+		metricBrokerConnected.Set(0)
+		health.connected.Store(false)
+		if r.ctx.Err() != nil {
+			return nil, r.ctx.Err()
+		}
+		metricReconnects.Inc()
+		log.Printf("collector: stream error: %v (resubscribing in %s)", err, r.backoff)
+		if err := r.wait(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait sleeps for the current backoff and doubles it up to backoffMax.
+func (r *resubscribingStream) wait() error {
+	select {
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	case <-time.After(r.backoff):
+	}
+	if r.backoff < r.backoffMax {
+		r.backoff *= 2
+		if r.backoff > r.backoffMax {
+			r.backoff = r.backoffMax
+		}
+	}
+	return nil
+}
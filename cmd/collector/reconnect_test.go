@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestResubscribingStream_ReconnectsAfterError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := newFakeStream(ctx, 1)
+	first.ch <- &telemetryv1.TelemetryData{GpuId: "g1", Ts: timestamppb.Now()}
+	first.close() // second Recv on this stream fails
+	second := newFakeStream(ctx, 1)
+	second.ch <- &telemetryv1.TelemetryData{GpuId: "g2", Ts: timestamppb.Now()}
+
+	calls := 0
+	subscribe := func(ctx context.Context) (subscribeStream, error) {
+		calls++
+		switch calls {
+		case 1:
+			return first, nil
+		case 2:
+			return nil, errors.New("broker unavailable")
+		default:
+			return second, nil
+		}
+	}
+	rs := newResubscribingStream(ctx, subscribe, time.Millisecond, 4*time.Millisecond)
+
+	for _, want := range []string{"g1", "g2"} {
+		msg, err := rs.Recv()
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		if msg.GetGpuId() != want {
+			t.Fatalf("expected %s, got %s", want, msg.GetGpuId())
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 subscribe attempts, got %d", calls)
+	}
+	if rs.backoff != time.Millisecond {
+		t.Fatalf("expected backoff reset after successful recv, got %s", rs.backoff)
+	}
+}
+
+func TestResubscribingStream_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	subscribe := func(ctx context.Context) (subscribeStream, error) {
+		return nil, errors.New("broker unavailable")
+	}
+	rs := newResubscribingStream(ctx, subscribe, time.Hour, time.Hour)
+	done := make(chan error, 1)
+	go func() { _, err := rs.Recv(); done <- err }()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Recv did not return after cancel")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gpu-metric-collector/internal/config"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/otlp"
+	"gpu-metric-collector/internal/pipeline"
+	"gpu-metric-collector/internal/storage"
+)
+
+// stageSet is what a reload swaps into the running loop.
+type stageSet struct {
+	stages *pipeline.Pipeline
+	sinks  map[string]storage.Store
+	export func(ctx context.Context, items []model.Telemetry) error
+}
+
+// reloads hands rebuilt stage sets to the loop, which applies them between
+// messages; the subscription and the pending batch are left alone. nil
+// disables reloading.
+var reloads chan *stageSet
+
+// reloader builds stage sets from the current flags and owns what outlives a
+// single build: sink stores, the OTLP exporter and background refreshers.
+type reloader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	sinks  map[string]storage.Store
+	exp    *otlp.Exporter
+	expKey string
+	grace  time.Duration
+}
+
+func newReloader(ctx context.Context) *reloader {
+	return &reloader{ctx: ctx, grace: time.Duration(*flagShutdownMs)*time.Millisecond + *flagOTLPTimeout}
+}
+
+// build creates a stage set for cfg. On success it becomes the reloader's
+// current build: the previous build's refreshers are stopped, and a replaced
+// exporter is closed once in-flight exports have had time to finish.
+func (r *reloader) build(cfg config.Collector) (*stageSet, error) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	p, sinks, err := buildPipeline(ctx, cfg, r.sinks)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	exp := r.exp
+	key := fmt.Sprint(*flagOTLPEndpoint, *flagOTLPTLS, *flagOTLPCA, *flagOTLPHeaders, *flagOTLPTimeout, *flagOTLPCounters)
+	if r.cancel == nil || key != r.expKey {
+		if exp, err = newOTLPExporter(); err != nil {
+			cancel()
+			return nil, err
+		}
+		if old := r.exp; old != nil {
+			time.AfterFunc(r.grace, func() { _ = old.Close() })
+		}
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.cancel, r.sinks, r.exp, r.expKey = cancel, sinks, exp, key
+
+	set := &stageSet{stages: p, sinks: sinks}
+	if exp != nil {
+		set.export = exp.Export
+	}
+	return set, nil
+}
+
+func (r *reloader) close() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	if r.exp != nil {
+		_ = r.exp.Close()
+	}
+}
+
+// watch rebuilds the stage set on every signal from hup and hands it to the loop.
+// A config that fails to load or build is logged and the running set is kept.
+func (r *reloader) watch(hup <-chan os.Signal) {
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-hup:
+		}
+		log.Printf("collector: SIGHUP; reloading config")
+		cfg, err := reloadConfig()
+		var set *stageSet
+		if err == nil {
+			set, err = r.build(cfg)
+		}
+		if err != nil {
+			metricReloads.WithLabelValues("error").Inc()
+			log.Printf("collector: reload failed, keeping current config: %v", err)
+			continue
+		}
+		select {
+		case reloads <- set:
+			metricReloads.WithLabelValues("ok").Inc()
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// reloadConfig re-reads the config file and environment into the flags, then
+// replays the command line so explicit flags keep precedence. Settings removed
+// from the file keep their previous value.
+func reloadConfig() (config.Collector, error) {
+	var cfg config.Collector
+	if err := config.Bind(flag.CommandLine, &cfg, config.PathFromArgs(os.Args[1:], "COLLECTOR_CONFIG"), "COLLECTOR"); err != nil {
+		return cfg, err
+	}
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// series names the three metrics gputop charts.
+type series struct {
+	Util, Temp, Power string
+}
+
+// gpuRow is what the board knows of one GPU.
+type gpuRow struct {
+	id, host string
+	lastSeen time.Time
+	// latest values; NaN until the GPU reports the metric
+	util, temp, power float64
+	// recent values, oldest first, at most history long
+	utilHist, tempHist, powerHist []float64
+}
+
+// board holds the latest values and recent history of every GPU seen. The
+// source goroutine updates it while the render loop draws it.
+type board struct {
+	mu      sync.Mutex
+	metrics series
+	history int
+	rows    map[string]*gpuRow
+	// the source's last error and when it happened, shown under the table
+	err   error
+	errAt time.Time
+}
+
+func newBoard(metrics series, history int) *board {
+	return &board{metrics: metrics, history: max(history, 1), rows: map[string]*gpuRow{}}
+}
+
+// update records a point of gpuID taken at ts. Points no newer than the
+// last one recorded are ignored, so a source may report the same point
+// repeatedly.
+func (b *board) update(gpuID, host string, ts time.Time, metrics map[string]float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := b.rows[gpuID]
+	if r == nil {
+		r = &gpuRow{id: gpuID, util: math.NaN(), temp: math.NaN(), power: math.NaN()}
+		b.rows[gpuID] = r
+	}
+	if !ts.After(r.lastSeen) {
+		return
+	}
+	r.lastSeen = ts
+	if host != "" {
+		r.host = host
+	}
+	push := func(latest *float64, hist *[]float64, name string) {
+		v, ok := metrics[name]
+		if !ok {
+			return
+		}
+		*latest = v
+		*hist = append(*hist, v)
+		if len(*hist) > b.history {
+			*hist = (*hist)[len(*hist)-b.history:]
+		}
+	}
+	push(&r.util, &r.utilHist, b.metrics.Util)
+	push(&r.temp, &r.tempHist, b.metrics.Temp)
+	push(&r.power, &r.powerHist, b.metrics.Power)
+}
+
+// fail records an error of the source; nil clears it.
+func (b *board) fail(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err, b.errAt = err, time.Now()
+}
+
+// view selects and orders the rows drawn.
+type view struct {
+	// Sort is gpu, util, temp or power; the metrics sort highest first.
+	Sort string
+	// Top caps the rows drawn; 0 draws every GPU.
+	Top int
+	// Stale marks GPUs silent for longer than this; 0 never does.
+	Stale time.Duration
+	// Title heads the frame, e.g. the source.
+	Title string
+}
+
+// sparkBlocks are the levels of a sparkline, lowest first.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws vs scaled between lo and hi, one block per value. With
+// lo >= hi it scales to the values' own range; a flat series is drawn low.
+func sparkline(vs []float64, lo, hi float64) string {
+	if len(vs) == 0 {
+		return ""
+	}
+	if lo >= hi {
+		lo, hi = vs[0], vs[0]
+		for _, v := range vs {
+			lo, hi = min(lo, v), max(hi, v)
+		}
+	}
+	var b strings.Builder
+	for _, v := range vs {
+		i := 0
+		if hi > lo {
+			f := (min(max(v, lo), hi) - lo) / (hi - lo)
+			i = int(math.Round(f * float64(len(sparkBlocks)-1)))
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+// render writes one frame of the board as seen at now.
+func (b *board) render(w io.Writer, now time.Time, v view) error {
+	b.mu.Lock()
+	rows := make([]gpuRow, 0, len(b.rows))
+	for _, r := range b.rows {
+		rows = append(rows, *r)
+	}
+	srcErr, errAt := b.err, b.errAt
+	b.mu.Unlock()
+
+	key := func(r gpuRow) float64 {
+		switch v.Sort {
+		case "util":
+			return r.util
+		case "temp":
+			return r.temp
+		case "power":
+			return r.power
+		}
+		return 0
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		ki, kj := key(rows[i]), key(rows[j])
+		switch {
+		case math.IsNaN(ki) != math.IsNaN(kj):
+			return !math.IsNaN(ki) // GPUs without the metric go last
+		case ki != kj && !math.IsNaN(ki):
+			return ki > kj
+		}
+		return rows[i].id < rows[j].id
+	})
+	stale := 0
+	for _, r := range rows {
+		if v.Stale > 0 && now.Sub(r.lastSeen) > v.Stale {
+			stale++
+		}
+	}
+	fmt.Fprintf(w, "gputop  %s  %d GPUs", v.Title, len(rows))
+	if stale > 0 {
+		fmt.Fprintf(w, " (%d stale)", stale)
+	}
+	fmt.Fprintf(w, "  %s\n\n", now.Format("15:04:05"))
+	if v.Top > 0 && len(rows) > v.Top {
+		rows = rows[:v.Top]
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GPU\tHOST\tUTIL %\tTEMP C\tPOWER W\tAGE\tUTIL\tTEMP\tPOWER")
+	for _, r := range rows {
+		age := now.Sub(r.lastSeen).Truncate(time.Second).String()
+		if v.Stale > 0 && now.Sub(r.lastSeen) > v.Stale {
+			age += " stale"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.id, orDash(r.host),
+			formatValue(r.util), formatValue(r.temp), formatValue(r.power), age,
+			sparkline(r.utilHist, 0, 100), sparkline(r.tempHist, 0, 0), sparkline(r.powerHist, 0, 0))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if srcErr != nil {
+		_, err := fmt.Fprintf(w, "\n%s ago: %v\n", now.Sub(errAt).Truncate(time.Second), srcErr)
+		return err
+	}
+	return nil
+}
+
+func formatValue(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testSeries = series{Util: "util", Temp: "temp", Power: "power"}
+
+func TestPollGateway_RecordsNewPointsOnly(t *testing.T) {
+	// Scenario: a gateway whose status reports g1's point at 0s three times,
+	// then at 1s; g2 has no point
+	// Expect: the API key and metrics are sent; g1's history holds two points
+	// and g2 is not shown
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var polls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "k" || r.URL.Query().Get("metrics") != "util,temp,power" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		sec := 0
+		if polls.Add(1) > 3 {
+			sec = 1
+		}
+		fmt.Fprintf(w, `{"gpus":[{"gpu_id":"g1","host_id":"h1","last_seen":%q,"metrics":{"util":%d,"temp":60,"power":200}},{"gpu_id":"g2","stale":true}]}`,
+			base.Add(time.Duration(sec)*time.Second).Format(time.RFC3339), 40+sec*50)
+	}))
+	defer srv.Close()
+
+	b := newBoard(testSeries, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { pollGateway(ctx, srv.URL, "k", time.Millisecond, b); close(done) }()
+	for polls.Load() < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	r := b.rows["g1"]
+	if len(b.rows) != 1 || r == nil || len(r.utilHist) != 2 || r.util != 90 || r.host != "h1" || b.err != nil {
+		t.Fatalf("rows = %d, g1 = %+v, err %v; want g1 with 2 points, latest util 90", len(b.rows), r, b.err)
+	}
+}
+
+func TestRender_SortsMarksStaleAndShowsErrors(t *testing.T) {
+	// Scenario: g1 (util 20) and g2 (util 80) report, g3 reports only power
+	// and long ago; rendered sorted by util after a source error
+	// Expect: g2, g1, then g3 without util; g3 marked stale; the error shown
+	now := time.Date(2026, 1, 1, 0, 10, 0, 0, time.UTC)
+	b := newBoard(testSeries, 10)
+	for i, u := range []float64{10, 20} {
+		b.update("g1", "h1", now.Add(time.Duration(i-2)*time.Second), map[string]float64{"util": u, "temp": 50, "power": 100})
+	}
+	b.update("g2", "h2", now.Add(-time.Second), map[string]float64{"util": 80, "temp": 70})
+	b.update("g3", "", now.Add(-5*time.Minute), map[string]float64{"power": 300})
+	b.fail(fmt.Errorf("gateway: 503"))
+
+	var out bytes.Buffer
+	if err := b.render(&out, now, view{Sort: "util", Stale: time.Minute, Title: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if !strings.Contains(lines[0], "3 GPUs (1 stale)") {
+		t.Fatalf("header = %q", lines[0])
+	}
+	var order []string
+	for _, l := range lines[3:6] {
+		order = append(order, strings.Fields(l)[0])
+	}
+	if strings.Join(order, ",") != "g2,g1,g3" {
+		t.Fatalf("rows in order %v, want g2,g1,g3:\n%s", order, out.String())
+	}
+	if !strings.Contains(lines[4], "▂▂") || !strings.Contains(lines[5], "5m0s stale") || !strings.Contains(out.String(), "gateway: 503") {
+		t.Fatalf("frame:\n%s", out.String())
+	}
+}
+
+func TestSparkline_Scales(t *testing.T) {
+	// Scenario: values drawn on a fixed 0-100 scale, on their own range, and flat
+	// Expect: blocks from lowest to highest; a flat series drawn low
+	for _, c := range []struct {
+		vs     []float64
+		lo, hi float64
+		want   string
+	}{
+		{[]float64{0, 50, 100, 150}, 0, 100, "▁▅██"},
+		{[]float64{60, 61, 62}, 0, 0, "▁▅█"},
+		{[]float64{7, 7}, 0, 0, "▁▁"},
+		{nil, 0, 100, ""},
+	} {
+		if got := sparkline(c.vs, c.lo, c.hi); got != c.want {
+			t.Errorf("sparkline(%v, %v, %v) = %q, want %q", c.vs, c.lo, c.hi, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Command gputop is a live terminal dashboard of the fleet for quick
+// inspection over SSH: a table of every GPU's latest utilization,
+// temperature and power with sparklines of their recent values.
+//
+//	gputop -gateway http://localhost:8080
+//	gputop -source broker -broker 127.0.0.1:9000 -sort util -top 20
+//
+// By default it polls the API gateway's fleet status every -interval. With
+// -source broker it subscribes to the broker instead and sees every point as
+// it is published, but the broker hands each message to one subscriber, so
+// next to running collectors gputop only sees its share of the points and
+// takes them from the collectors. Use it that way on a broker of its own or
+// while no collector runs.
+//
+// Sparklines hold one value per point received; utilization is drawn on a
+// 0-100 scale, temperature and power on the range of their own values.
+// -once prints a single frame without redrawing, for scripts.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/compression"
+	"gpu-metric-collector/internal/grpcclient"
+
+	"google.golang.org/grpc"
+)
+
+var (
+	flagSource   = flag.String("source", "gateway", "Where to read telemetry: gateway (poll the fleet status) or broker (subscribe)")
+	flagGateway  = flag.String("gateway", "http://localhost:8080", "API gateway base URL")
+	flagAPIKey   = flag.String("api_key", os.Getenv("TELEMETRY_API_KEY"), "API key sent to the gateway as X-API-Key (default: $TELEMETRY_API_KEY)")
+	flagBroker   = flag.String("broker", "127.0.0.1:9000", "Broker gRPC address")
+	flagGroup    = flag.String("group", "gputop", "Consumer group used with -source broker")
+	flagCompress = flag.String("grpc_compression", compression.None, "Compress requests to the broker with gzip or zstd")
+	flagInterval = flag.Duration("interval", 2*time.Second, "How often to redraw and to poll the gateway")
+	flagHistory  = flag.Int("history", 30, "Points kept per sparkline")
+	flagSort     = flag.String("sort", "gpu", "Row order: gpu, or util, temp or power highest first")
+	flagTop      = flag.Int("top", 0, "Show at most this many GPUs (0 = all)")
+	flagStale    = flag.Duration("stale", time.Minute, "Mark GPUs without data for longer than this (0 = never)")
+	flagOnce     = flag.Bool("once", false, "Print one frame after one poll (or one -interval of the broker) and exit")
+	flagUtil     = flag.String("util_metric", "DCGM_FI_DEV_GPU_UTIL", "Metric shown as utilization (percent)")
+	flagTemp     = flag.String("temp_metric", "DCGM_FI_DEV_GPU_TEMP", "Metric shown as temperature (Celsius)")
+	flagPower    = flag.String("power_metric", "DCGM_FI_DEV_POWER_USAGE", "Metric shown as power (watts)")
+)
+
+// The terminal control sequences gputop draws with.
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l" // alternate screen, cursor hidden
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	clearScreen = "\x1b[H\x1b[2J"
+)
+
+func main() {
+	var sec grpcclient.Security
+	flag.BoolVar(&sec.TLS, "broker_tls", false, "Use TLS for the broker connection (implied by -broker_ca or -broker_cert)")
+	flag.StringVar(&sec.CAFile, "broker_ca", "", "CA bundle (PEM) used to verify the broker certificate")
+	flag.StringVar(&sec.CertFile, "broker_cert", "", "Client certificate (PEM) for mutual TLS with the broker")
+	flag.StringVar(&sec.KeyFile, "broker_key", "", "Client private key (PEM) for mutual TLS with the broker")
+	flag.StringVar(&sec.ServerName, "broker_server_name", "", "Override the server name used to verify the broker certificate")
+	flag.StringVar(&sec.Token, "broker_token", "", "Bearer token sent to the broker (prefer -broker_token_file)")
+	flag.StringVar(&sec.TokenFile, "broker_token_file", "", "File containing the bearer token sent to the broker")
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("gputop: ")
+
+	switch *flagSort {
+	case "gpu", "util", "temp", "power":
+	default:
+		log.Fatalf("-sort %q: want gpu, util, temp or power", *flagSort)
+	}
+	if *flagInterval <= 0 {
+		log.Fatal("-interval must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	b := newBoard(series{Util: *flagUtil, Temp: *flagTemp, Power: *flagPower}, *flagHistory)
+	v := view{Sort: *flagSort, Top: *flagTop, Stale: *flagStale}
+
+	switch *flagSource {
+	case "gateway":
+		v.Title = "gateway " + *flagGateway
+		if *flagOnce {
+			st, err := fetchStatus(ctx, statusURL(*flagGateway, b.metrics), *flagAPIKey)
+			if err != nil {
+				log.Fatal(err)
+			}
+			record(b, st)
+			if err := b.render(os.Stdout, time.Now(), v); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		go pollGateway(ctx, *flagGateway, *flagAPIKey, *flagInterval, b)
+	case "broker":
+		v.Title = "broker " + *flagBroker
+		if err := compression.Check(*flagCompress); err != nil {
+			log.Fatalf("-grpc_compression: %v", err)
+		}
+		opts, err := sec.DialOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		conn, err := grpc.NewClient(*flagBroker, append(opts, compression.DialOptions(*flagCompress)...)...)
+		if err != nil {
+			log.Fatalf("dial broker: %v", err)
+		}
+		defer conn.Close()
+		go subscribeBroker(ctx, telemetryv1.NewTelemetryClient(conn), *flagGroup, *flagInterval, b)
+		if *flagOnce {
+			select {
+			case <-ctx.Done():
+			case <-time.After(*flagInterval):
+			}
+			if err := b.render(os.Stdout, time.Now(), v); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	default:
+		log.Fatalf("-source %q: want gateway or broker", *flagSource)
+	}
+
+	if err := draw(ctx, b, v, *flagInterval); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// draw redraws the board on the alternate screen every interval until ctx
+// ends, then restores the terminal.
+func draw(ctx context.Context, b *board, v view, interval time.Duration) error {
+	fmt.Print(enterScreen)
+	defer fmt.Print(leaveScreen)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var frame bytes.Buffer
+	for {
+		// build the frame first and write it at once so it does not flicker
+		frame.Reset()
+		frame.WriteString(clearScreen)
+		if err := b.render(&frame, time.Now(), v); err != nil {
+			return err
+		}
+		if _, err := os.Stdout.Write(frame.Bytes()); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+)
+
+// fleetStatus is the part of the gateway's /api/v1/gpus/status response
+// gputop reads.
+type fleetStatus struct {
+	GPUs []struct {
+		GPUId    string             `json:"gpu_id"`
+		HostId   string             `json:"host_id"`
+		LastSeen *time.Time         `json:"last_seen"`
+		Metrics  map[string]float64 `json:"metrics"`
+	} `json:"gpus"`
+}
+
+// statusURL is the gateway's fleet status URL, asking for the metrics
+// gputop charts.
+func statusURL(base string, m series) string {
+	q := url.Values{"metrics": {strings.Join([]string{m.Util, m.Temp, m.Power}, ",")}}
+	return strings.TrimRight(base, "/") + "/api/v1/gpus/status?" + q.Encode()
+}
+
+// record records each GPU's latest point of st on b.
+func record(b *board, st fleetStatus) {
+	for _, g := range st.GPUs {
+		if g.LastSeen != nil {
+			b.update(g.GPUId, g.HostId, *g.LastSeen, g.Metrics)
+		}
+	}
+}
+
+// pollGateway reads every GPU's latest point from the gateway's fleet status
+// each interval and records it on b until ctx ends. A failed poll is shown
+// on b until one succeeds.
+func pollGateway(ctx context.Context, base, apiKey string, interval time.Duration, b *board) {
+	u := statusURL(base, b.metrics)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		st, err := fetchStatus(ctx, u, apiKey)
+		if ctx.Err() == nil {
+			b.fail(err)
+		}
+		record(b, st)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func fetchStatus(ctx context.Context, u, apiKey string) (fleetStatus, error) {
+	var st fleetStatus
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return st, err
+	}
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return st, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return st, fmt.Errorf("gateway: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return st, fmt.Errorf("gateway: decode status: %w", err)
+	}
+	return st, nil
+}
+
+// subscribeBroker records every message the broker delivers to group on b
+// until ctx ends, resubscribing after retry when the stream fails. The last
+// failure is shown on b.
+func subscribeBroker(ctx context.Context, client telemetryv1.TelemetryClient, group string, retry time.Duration, b *board) {
+	for ctx.Err() == nil {
+		stream, err := client.Subscribe(ctx, &telemetryv1.SubscriptionRequest{Group: group})
+		for err == nil {
+			var msg *telemetryv1.TelemetryData
+			if msg, err = stream.Recv(); err == nil {
+				b.update(msg.GetGpuId(), msg.GetHostId(), msg.GetTs().AsTime(), msg.GetMetrics())
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		b.fail(fmt.Errorf("broker: %w", err))
+		select {
+		case <-ctx.Done():
+		case <-time.After(retry):
+		}
+	}
+}
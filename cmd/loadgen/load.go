@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/metricspec"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// config is one load run.
+type config struct {
+	Producers int           `json:"producers"`
+	GPUs      int           `json:"gpus_per_producer"`
+	Metrics   int           `json:"metrics_per_item"`
+	Rate      float64       `json:"rate"`
+	Batch     int           `json:"batch"`
+	Duration  time.Duration `json:"-"`
+	Drain     time.Duration `json:"-"`
+	Subscribe bool          `json:"subscribe"`
+	Group     string        `json:"group,omitempty"`
+}
+
+// maxSamples caps the latencies kept per series; past it they are sampled.
+const maxSamples = 100000
+
+// samples is a reservoir of latencies.
+type samples struct {
+	mu   sync.Mutex
+	seen int
+	vals []time.Duration
+}
+
+func (s *samples) add(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen++
+	if len(s.vals) < maxSamples {
+		s.vals = append(s.vals, d)
+	} else if i := rand.Intn(s.seen); i < maxSamples {
+		s.vals[i] = d
+	}
+}
+
+// run holds the counters of a load run.
+type run struct {
+	cfg    config
+	client telemetryv1.TelemetryClient
+	id     string // prefix of the run's producer IDs
+
+	published, accepted, rejected, backpressured, errors, delivered atomic.Uint64
+
+	publishLatency, deliveryLatency samples
+}
+
+func newRun(cfg config, client telemetryv1.TelemetryClient) *run {
+	return &run{cfg: cfg, client: client, id: fmt.Sprintf("loadgen-%d", time.Now().UnixNano())}
+}
+
+// metricNames returns n metric names: the catalog's first, then synthetic
+// ones once it runs out.
+func metricNames(n int) []string {
+	names := make([]string, 0, n)
+	for _, s := range metricspec.All() {
+		if len(names) == n {
+			return names
+		}
+		names = append(names, s.Name)
+	}
+	for i := len(names); i < n; i++ {
+		names = append(names, "LOADGEN_METRIC_"+strconv.Itoa(i))
+	}
+	return names
+}
+
+// Run publishes for the configured duration and, with Subscribe, consumes
+// what the broker delivers until Drain after the last publish. It returns
+// the report of the run.
+func (r *run) Run(ctx context.Context) (*report, error) {
+	before, _ := r.client.GetStats(ctx, &telemetryv1.GetStatsRequest{})
+
+	var sinkDone chan struct{}
+	sinkCtx, stopSink := context.WithCancel(ctx)
+	defer stopSink()
+	if r.cfg.Subscribe {
+		stream, err := r.client.Subscribe(sinkCtx, &telemetryv1.SubscriptionRequest{Group: r.cfg.Group})
+		if err != nil {
+			return nil, fmt.Errorf("subscribe: %w", err)
+		}
+		sinkDone = make(chan struct{})
+		go func() {
+			defer close(sinkDone)
+			r.sink(stream)
+		}()
+		if err := r.waitSubscribed(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	pctx, stop := context.WithTimeout(ctx, r.cfg.Duration)
+	var wg sync.WaitGroup
+	for p := 0; p < r.cfg.Producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			r.produce(pctx, p)
+		}(p)
+	}
+	wg.Wait()
+	stop()
+	elapsed := time.Since(start)
+
+	if sinkDone != nil {
+		r.drain(ctx)
+		stopSink()
+		<-sinkDone
+	}
+	after, _ := r.client.GetStats(context.WithoutCancel(ctx), &telemetryv1.GetStatsRequest{})
+	return r.report(start, elapsed, before, after), nil
+}
+
+// waitSubscribed waits until the broker lists the sink's group, so no item
+// is published before the sink can receive it. Brokers without GetStats get
+// a moment instead.
+func (r *run) waitSubscribed(ctx context.Context) error {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s, err := r.client.GetStats(ctx, &telemetryv1.GetStatsRequest{})
+		if status.Code(err) == codes.Unimplemented {
+			time.Sleep(200 * time.Millisecond)
+			return nil
+		}
+		for _, g := range s.GetGroups() {
+			if g.GetGroup() == r.cfg.Group && g.GetSubscribers() > 0 {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	return fmt.Errorf("subscriber of group %q did not show up in the broker's stats", r.cfg.Group)
+}
+
+// drain waits until everything accepted was delivered, or for Drain.
+func (r *run) drain(ctx context.Context) {
+	deadline := time.Now().Add(r.cfg.Drain)
+	for r.delivered.Load() < r.accepted.Load() && time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// produce publishes producer p's share of the rate in batches until ctx
+// ends. A slow broker lowers the rate achieved rather than queueing calls.
+func (r *run) produce(ctx context.Context, p int) {
+	producer := fmt.Sprintf("%s-p%d", r.id, p)
+	gpus := make([]string, r.cfg.GPUs)
+	for i := range gpus {
+		gpus[i] = fmt.Sprintf("%s-g%d", producer, i)
+	}
+	names := metricNames(r.cfg.Metrics)
+	perProducer := r.cfg.Rate / float64(r.cfg.Producers)
+	ticker := time.NewTicker(max(time.Duration(float64(r.cfg.Batch)/perProducer*float64(time.Second)), time.Microsecond))
+	defer ticker.Stop()
+
+	var seq, batches uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		batches++
+		batch := &telemetryv1.TelemetryBatch{BatchId: producer + "-b" + strconv.FormatUint(batches, 10)}
+		now := timestamppb.Now()
+		for i := 0; i < r.cfg.Batch; i++ {
+			seq++
+			item := &telemetryv1.TelemetryData{
+				ProducerId:     producer,
+				HostId:         r.id,
+				GpuId:          gpus[int(seq)%len(gpus)],
+				Ts:             now,
+				Metrics:        make(map[string]float64, len(names)),
+				IdempotencyKey: producer + "-" + strconv.FormatUint(seq, 10),
+				Sequence:       seq,
+				BatchId:        batch.BatchId,
+			}
+			for _, n := range names {
+				item.Metrics[n] = rand.Float64() * 100
+			}
+			batch.Items = append(batch.Items, item)
+		}
+		start := time.Now()
+		resp, err := r.client.PublishBatch(context.WithoutCancel(ctx), batch)
+		r.publishLatency.add(time.Since(start))
+		r.published.Add(uint64(len(batch.Items)))
+		if err != nil {
+			r.errors.Add(1)
+			continue
+		}
+		r.accepted.Add(uint64(resp.GetAccepted()))
+		for _, it := range resp.GetItems() {
+			if it.GetStatus() == "REJECTED" {
+				r.rejected.Add(1)
+			} else {
+				r.backpressured.Add(1)
+			}
+		}
+	}
+}
+
+// sink counts the run's items the broker delivers and their latency from
+// publish to delivery. Items of other producers are ignored.
+func (r *run) sink(stream telemetryv1.Telemetry_SubscribeClient) {
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return
+		}
+		if !strings.HasPrefix(msg.GetProducerId(), r.id+"-") {
+			continue
+		}
+		r.delivered.Add(1)
+		r.deliveryLatency.add(time.Since(msg.GetTs().AsTime()))
+	}
+}
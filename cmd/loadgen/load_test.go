@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/broker"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func startBroker(t *testing.T) telemetryv1.TelemetryClient {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	telemetryv1.RegisterTelemetryServer(srv, broker.NewServer(10000, 1024))
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return telemetryv1.NewTelemetryClient(conn)
+}
+
+func TestRun_DeliversEverythingAccepted(t *testing.T) {
+	// Scenario: 2 producers publish batches of 10 at 400 items/s for 300ms to an in-process broker, with a sink
+	// Expect: items are published and accepted, the sink receives all of them, and latencies and broker totals are reported
+	cfg := config{Producers: 2, GPUs: 3, Metrics: 40, Rate: 400, Batch: 10, Duration: 300 * time.Millisecond, Drain: 2 * time.Second, Subscribe: true, Group: "loadgen-test"}
+	rep, err := newRun(cfg, startBroker(t)).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Published == 0 || rep.Accepted != rep.Published {
+		t.Fatalf("published=%d accepted=%d, want all of a non-zero number accepted", rep.Published, rep.Accepted)
+	}
+	if rep.Delivery == nil || rep.Delivery.Delivered != rep.Accepted || rep.Delivery.Ratio != 1 {
+		t.Fatalf("delivery = %+v, want all %d accepted items", rep.Delivery, rep.Accepted)
+	}
+	if rep.PublishLatency.Count == 0 || rep.Delivery.Latency.Count != int(rep.Accepted) {
+		t.Fatalf("latencies = %+v / %+v", rep.PublishLatency, rep.Delivery.Latency)
+	}
+	if rep.Broker == nil || rep.Broker.Accepted != rep.Accepted {
+		t.Fatalf("broker = %+v, want accepted=%d", rep.Broker, rep.Accepted)
+	}
+
+	var md bytes.Buffer
+	if err := rep.writeMarkdown(&md); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# Load report", "| end to end |", "## Broker"} {
+		if !strings.Contains(md.String(), want) {
+			t.Errorf("markdown report lacks %q:\n%s", want, md.String())
+		}
+	}
+}
+
+func TestMetricNames_CatalogThenSynthetic(t *testing.T) {
+	// Scenario: more metrics are asked for than the catalog has
+	// Expect: n distinct names, the last ones synthetic
+	names := metricNames(100)
+	seen := map[string]bool{}
+	for _, n := range names {
+		seen[n] = true
+	}
+	if len(names) != 100 || len(seen) != 100 {
+		t.Fatalf("got %d names, %d distinct; want 100", len(names), len(seen))
+	}
+	if !strings.HasPrefix(names[99], "LOADGEN_METRIC_") {
+		t.Fatalf("last name = %q, want a synthetic one", names[99])
+	}
+}
+
+func TestSummarize_NearestRank(t *testing.T) {
+	// Scenario: latencies of 1..100ms
+	// Expect: p50=50, p90=90, p99=99, max=100
+	var s samples
+	for i := 100; i >= 1; i-- {
+		s.add(time.Duration(i) * time.Millisecond)
+	}
+	got := summarize(&s)
+	if got.Count != 100 || got.P50 != 50 || got.P90 != 90 || got.P99 != 99 || got.Max != 100 {
+		t.Fatalf("summary = %+v", got)
+	}
+}
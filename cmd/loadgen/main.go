@@ -0,0 +1,115 @@
+// Command loadgen benchmarks a broker: it simulates a fleet of producers
+// publishing at a set rate and, as a consuming sink, measures how much of
+// what the broker accepted is delivered and how long it takes.
+//
+//	loadgen -broker 127.0.0.1:9000 -producers 20 -gpus 8 -rate 5000 -duration 1m -format markdown
+//
+// The broker hands each message to one subscriber, so run it against a
+// broker without collectors, or the sink only sees its share of the items.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/compression"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var (
+	flagBroker    = flag.String("broker", "127.0.0.1:9000", "Broker gRPC address")
+	flagProducers = flag.Int("producers", 10, "Simulated producers, each publishing on its own")
+	flagGPUs      = flag.Int("gpus", 8, "GPUs per producer")
+	flagMetrics   = flag.Int("metrics", 10, "Metrics per item (catalog names first, then synthetic ones)")
+	flagRate      = flag.Float64("rate", 1000, "Items per second across all producers")
+	flagBatch     = flag.Int("batch", 100, "Items per PublishBatch call")
+	flagDuration  = flag.Duration("duration", 30*time.Second, "How long to publish")
+	flagDrain     = flag.Duration("drain", 5*time.Second, "How long to wait for deliveries after publishing stops")
+	flagSubscribe = flag.Bool("subscribe", true, "Consume from the broker to measure delivery and end-to-end latency")
+	flagGroup     = flag.String("group", "loadgen", "Consumer group of the sink")
+	flagFormat    = flag.String("format", "json", "Report format: json or markdown")
+	flagOut       = flag.String("out", "", "File to write the report to (default: stdout)")
+	flagCompress  = flag.String("grpc_compression", compression.None, "Compress requests to the broker with gzip or zstd")
+)
+
+func main() {
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("loadgen: ")
+
+	cfg := config{
+		Producers: *flagProducers,
+		GPUs:      *flagGPUs,
+		Metrics:   *flagMetrics,
+		Rate:      *flagRate,
+		Batch:     *flagBatch,
+		Duration:  *flagDuration,
+		Drain:     *flagDrain,
+		Subscribe: *flagSubscribe,
+		Group:     *flagGroup,
+	}
+	if err := cfg.check(); err != nil {
+		log.Fatal(err)
+	}
+	if *flagFormat != "json" && *flagFormat != "markdown" {
+		log.Fatalf("-format %q: want json or markdown", *flagFormat)
+	}
+	if err := compression.Check(*flagCompress); err != nil {
+		log.Fatalf("-grpc_compression: %v", err)
+	}
+	conn, err := grpc.NewClient(*flagBroker, append(compression.DialOptions(*flagCompress),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+	if err != nil {
+		log.Fatalf("dial broker: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("publishing %.0f items/s from %d producers for %s", cfg.Rate, cfg.Producers, cfg.Duration)
+	rep, err := newRun(cfg, telemetryv1.NewTelemetryClient(conn)).Run(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *flagOut != "" {
+		f, err := os.Create(*flagOut)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if *flagFormat == "markdown" {
+		err = rep.writeMarkdown(w)
+	} else {
+		err = rep.writeJSON(w)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// check rejects configurations that cannot run.
+func (c config) check() error {
+	switch {
+	case c.Producers < 1, c.GPUs < 1, c.Metrics < 1, c.Batch < 1:
+		return fmt.Errorf("-producers, -gpus, -metrics and -batch must be at least 1")
+	case c.Rate <= 0:
+		return fmt.Errorf("-rate must be positive")
+	case c.Duration <= 0:
+		return fmt.Errorf("-duration must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+)
+
+// report is the outcome of a load run, written as JSON or Markdown.
+type report struct {
+	Config         config    `json:"config"`
+	Start          time.Time `json:"start"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+
+	// Items by their fate at the broker; Errors counts failed calls.
+	Published     uint64 `json:"published"`
+	Accepted      uint64 `json:"accepted"`
+	Rejected      uint64 `json:"rejected"`
+	Backpressured uint64 `json:"backpressured"`
+	Errors        uint64 `json:"errors"`
+
+	PublishRate    float64         `json:"publish_rate"` // items/s offered
+	AcceptRate     float64         `json:"accept_rate"`  // items/s accepted
+	PublishLatency latencySummary  `json:"publish_latency"`
+	Delivery       *deliveryReport `json:"delivery,omitempty"`
+	Broker         *brokerReport   `json:"broker,omitempty"`
+}
+
+// deliveryReport is what the sink received of the accepted items.
+type deliveryReport struct {
+	Delivered uint64         `json:"delivered"`
+	Ratio     float64        `json:"ratio"` // delivered / accepted
+	Latency   latencySummary `json:"latency"`
+}
+
+// brokerReport is the change in the broker's own totals over the run, from
+// GetStats, which includes other producers' traffic.
+type brokerReport struct {
+	Accepted     uint64  `json:"accepted"`
+	Rejected     uint64  `json:"rejected"`
+	Backpressure uint64  `json:"backpressure"`
+	Delivered    uint64  `json:"delivered"`
+	AcceptRate   float64 `json:"accept_rate"`
+	QueueDepth   uint64  `json:"queue_depth"`
+}
+
+// latencySummary is in milliseconds.
+type latencySummary struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+func summarize(s *samples) latencySummary {
+	s.mu.Lock()
+	vals := append([]time.Duration(nil), s.vals...)
+	s.mu.Unlock()
+	if len(vals) == 0 {
+		return latencySummary{}
+	}
+	sort.Slice(vals, func(i, j int) bool { return vals[i] < vals[j] })
+	// nearest rank
+	q := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(vals)))) - 1
+		return ms(vals[max(i, 0)])
+	}
+	return latencySummary{Count: len(vals), P50: q(0.5), P90: q(0.9), P99: q(0.99), Max: ms(vals[len(vals)-1])}
+}
+
+func ms(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+
+func (r *run) report(start time.Time, elapsed time.Duration, before, after *telemetryv1.GetStatsResponse) *report {
+	secs := elapsed.Seconds()
+	rep := &report{
+		Config:         r.cfg,
+		Start:          start.UTC(),
+		ElapsedSeconds: secs,
+		Published:      r.published.Load(),
+		Accepted:       r.accepted.Load(),
+		Rejected:       r.rejected.Load(),
+		Backpressured:  r.backpressured.Load(),
+		Errors:         r.errors.Load(),
+		PublishLatency: summarize(&r.publishLatency),
+	}
+	if secs > 0 {
+		rep.PublishRate = float64(rep.Published) / secs
+		rep.AcceptRate = float64(rep.Accepted) / secs
+	}
+	if r.cfg.Subscribe {
+		d := &deliveryReport{Delivered: r.delivered.Load(), Latency: summarize(&r.deliveryLatency)}
+		if rep.Accepted > 0 {
+			d.Ratio = float64(d.Delivered) / float64(rep.Accepted)
+		}
+		rep.Delivery = d
+	}
+	if before != nil && after != nil {
+		b := &brokerReport{
+			Accepted:     after.GetAcceptedTotal() - before.GetAcceptedTotal(),
+			Rejected:     after.GetRejectedTotal() - before.GetRejectedTotal(),
+			Backpressure: after.GetBackpressureTotal() - before.GetBackpressureTotal(),
+			Delivered:    after.GetDeliveredTotal() - before.GetDeliveredTotal(),
+			QueueDepth:   after.GetQueueDepth(),
+		}
+		if secs > 0 {
+			b.AcceptRate = float64(b.Accepted) / secs
+		}
+		rep.Broker = b
+	}
+	return rep
+}
+
+func (rep *report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+func (rep *report) writeMarkdown(w io.Writer) error {
+	c := rep.Config
+	p := func(format string, args ...any) { fmt.Fprintf(w, format, args...) }
+	p("# Load report\n\n")
+	p("%s, %.1fs: %d producers x %d GPUs, %d metrics per item, batches of %d at %.0f items/s\n\n",
+		rep.Start.Format(time.RFC3339), rep.ElapsedSeconds, c.Producers, c.GPUs, c.Metrics, c.Batch, c.Rate)
+	p("## Publish\n\n")
+	p("| | items | items/s |\n|---|---:|---:|\n")
+	p("| published | %d | %.1f |\n", rep.Published, rep.PublishRate)
+	p("| accepted | %d | %.1f |\n", rep.Accepted, rep.AcceptRate)
+	p("| rejected | %d | |\n", rep.Rejected)
+	p("| backpressured | %d | |\n\n", rep.Backpressured)
+	p("Failed calls: %d\n\n", rep.Errors)
+	p("## Latency (ms)\n\n")
+	p("| | count | p50 | p90 | p99 | max |\n|---|---:|---:|---:|---:|---:|\n")
+	row := func(name string, l latencySummary) {
+		p("| %s | %d | %.2f | %.2f | %.2f | %.2f |\n", name, l.Count, l.P50, l.P90, l.P99, l.Max)
+	}
+	row("publish call", rep.PublishLatency)
+	if d := rep.Delivery; d != nil {
+		row("end to end", d.Latency)
+		p("\nDelivered to the sink: %d of %d accepted (%.1f%%)\n", d.Delivered, rep.Accepted, 100*d.Ratio)
+	}
+	if b := rep.Broker; b != nil {
+		p("\n## Broker\n\n")
+		p("| accepted | rejected | backpressure | delivered | accepted/s | queue depth at end |\n|---:|---:|---:|---:|---:|---:|\n")
+		p("| %d | %d | %d | %d | %.1f | %d |\n", b.Accepted, b.Rejected, b.Backpressure, b.Delivered, b.AcceptRate, b.QueueDepth)
+	}
+	return nil
+}
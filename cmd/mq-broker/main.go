@@ -6,15 +6,19 @@ import (
     "log"
     "net"
     "net/http"
+    "time"
 
     "google.golang.org/grpc"
     health "google.golang.org/grpc/health"
     healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
+    "github.com/prometheus/client_golang/prometheus"
     "github.com/prometheus/client_golang/prometheus/promhttp"
 
     telemetryv1 "gpu-metric-collector/api/gen"
+    telemetryv2 "gpu-metric-collector/api/gen/v2"
     "gpu-metric-collector/internal/broker"
+    "gpu-metric-collector/internal/compression"
 )
 
 var (
@@ -22,24 +26,48 @@ var (
     flagMetrics = flag.String("metrics_addr", ":9001", "Broker metrics listen addr")
     flagQCap    = flag.Int("queue_cap", 10000, "Inbound queue capacity")
     flagSBuf    = flag.Int("sub_buf", 256, "Per-subscriber buffer")
+    flagAckMs   = flag.Int("ack_timeout_ms", 30000, "Redeliver manual-ack messages not acked within this time (ms)")
+    flagComp    = flag.String("grpc_compression", compression.None, "Compress responses with gzip or zstd when the client accepts it (none sends uncompressed; compressed requests are always accepted)")
+
+    sec security
 )
 
+func init() {
+    flag.StringVar(&sec.CertFile, "tls_cert", "", "Serve gRPC over TLS with this PEM certificate; needs -tls_key")
+    flag.StringVar(&sec.KeyFile, "tls_key", "", "PEM private key for -tls_cert")
+    flag.StringVar(&sec.ClientCAFile, "client_ca", "", "Require client certificates issued by this PEM CA bundle (mutual TLS; needs -tls_cert)")
+    flag.StringVar(&sec.TokenFile, "token_file", "", "File containing the bearer token every RPC except health checks must carry")
+}
+
 func main() {
     flag.Parse()
+    if err := compression.Check(*flagComp); err != nil {
+        log.Fatalf("-grpc_compression: %v", err)
+    }
     addr := *flagGRPC
     lis, err := net.Listen("tcp", addr)
     if err != nil {
         log.Fatalf("listen: %v", err)
     }
 
-    grpcServer := grpc.NewServer()
+    secOpts, err := sec.serverOptions()
+    if err != nil {
+        log.Fatalf("security: %v", err)
+    }
+    opts := append(compression.ServerOptions(*flagComp), grpc.StatsHandler(compression.NewStatsHandler("broker", prometheus.DefaultRegisterer)))
+    opts = append(opts, secOpts...)
+    grpcServer := grpc.NewServer(opts...)
 
     // health service
     h := health.NewServer()
     healthpb.RegisterHealthServer(grpcServer, h)
 
     // telemetry broker
-    telemetryv1.RegisterTelemetryServer(grpcServer, broker.NewServer(*flagQCap, *flagSBuf))
+    b := broker.NewServer(*flagQCap, *flagSBuf)
+    b.SetAckTimeout(time.Duration(*flagAckMs) * time.Millisecond)
+    telemetryv1.RegisterTelemetryServer(grpcServer, b)
+    // telemetry.v2 adds GetCapabilities and PublishStream; v1 clients are unaffected
+    telemetryv2.RegisterTelemetryServer(grpcServer, broker.NewV2(b))
 
     // metrics server
     http.Handle("/metrics", promhttp.Handler())
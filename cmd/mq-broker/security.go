@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// security is how the broker secures its gRPC listener; the client side is
+// grpcclient.Security. The zero value serves plaintext without a token check.
+type security struct {
+	CertFile, KeyFile string
+	// ClientCAFile, if set, requires client certificates issued by this CA.
+	ClientCAFile string
+	// TokenFile holds the bearer token every RPC must carry.
+	TokenFile string
+}
+
+// healthPrefix is exempt from the token check so probes need no secret.
+const healthPrefix = "/grpc.health.v1.Health/"
+
+// serverOptions returns the transport credentials and token check for s.
+func (s security) serverOptions() ([]grpc.ServerOption, error) {
+	var opts []grpc.ServerOption
+	if s.CertFile != "" || s.KeyFile != "" {
+		cfg, err := s.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(cfg)))
+	} else if s.ClientCAFile != "" {
+		return nil, errors.New("a client ca needs a tls cert and key")
+	}
+	if s.TokenFile == "" {
+		return opts, nil
+	}
+	b, err := os.ReadFile(s.TokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return nil, fmt.Errorf("token file %s is empty", s.TokenFile)
+	}
+	check := func(ctx context.Context, method string) error {
+		if strings.HasPrefix(method, healthPrefix) {
+			return nil
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get("authorization") {
+			if got, ok := strings.CutPrefix(v, "Bearer "); ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+	}
+	return append(opts,
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := check(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := check(ss.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		})), nil
+}
+
+func (s security) tlsConfig() (*tls.Config, error) {
+	if s.CertFile == "" || s.KeyFile == "" {
+		return nil, errors.New("tls cert and key must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load tls cert: %w", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if s.ClientCAFile == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(s.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client ca file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client ca file %s: no certificates found", s.ClientCAFile)
+	}
+	cfg.ClientCAs, cfg.ClientAuth = pool, tls.RequireAndVerifyClientCert
+	return cfg, nil
+}
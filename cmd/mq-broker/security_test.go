@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/broker"
+	"gpu-metric-collector/internal/grpcclient"
+)
+
+// writePEM writes der as a PEM block of typ to dir/name.
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+// testPKI writes a CA and a server and a client certificate it issued to dir.
+func testPKI(t *testing.T, dir string) (caFile, serverCert, serverKey, clientCert, clientKey string) {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test ca"}, IsCA: true, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("ca: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		tmpl := &x509.Certificate{SerialNumber: big.NewInt(serial), Subject: pkix.Name{CommonName: name},
+			IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}, ExtKeyUsage: []x509.ExtKeyUsage{usage},
+			KeyUsage: x509.KeyUsageDigitalSignature, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("issue %s: %v", name, err)
+		}
+		keyDER, _ := x509.MarshalECPrivateKey(key)
+		return writePEM(t, dir, name+".pem", "CERTIFICATE", der), writePEM(t, dir, name+"-key.pem", "EC PRIVATE KEY", keyDER)
+	}
+	serverCert, serverKey = issue("broker", 2, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey = issue("collector", 3, x509.ExtKeyUsageClientAuth)
+	return writePEM(t, dir, "ca.pem", "CERTIFICATE", caDER), serverCert, serverKey, clientCert, clientKey
+}
+
+func TestSecurity_BrokerRequiresClientCertAndToken(t *testing.T) {
+	// Scenario: the broker served with -tls_cert/-tls_key, -client_ca and
+	// -token_file; clients dialing with grpcclient.Security
+	// Expect: a client with the cert and token is served; a wrong or missing
+	// token is Unauthenticated, on the subscribe stream too; no client cert
+	// fails the handshake; health checks need no token
+	dir := t.TempDir()
+	caFile, serverCert, serverKey, clientCert, clientKey := testPKI(t, dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	opts, err := security{CertFile: serverCert, KeyFile: serverKey, ClientCAFile: caFile, TokenFile: tokenFile}.serverOptions()
+	if err != nil {
+		t.Fatalf("server options: %v", err)
+	}
+	srv := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	telemetryv1.RegisterTelemetryServer(srv, broker.NewServer(10, 10))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	dial := func(sec grpcclient.Security) *grpc.ClientConn {
+		t.Helper()
+		dialOpts, err := sec.DialOptions()
+		if err != nil {
+			t.Fatalf("dial options: %v", err)
+		}
+		conn, err := grpc.NewClient(lis.Addr().String(), dialOpts...)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	stats := func(conn *grpc.ClientConn) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := telemetryv1.NewTelemetryClient(conn).GetStats(ctx, &telemetryv1.GetStatsRequest{})
+		return err
+	}
+	mtls := grpcclient.Security{CAFile: caFile, CertFile: clientCert, KeyFile: clientKey}
+
+	ok := mtls
+	ok.Token = "s3cret"
+	if err := stats(dial(ok)); err != nil {
+		t.Fatalf("authorized client: %v", err)
+	}
+	for _, token := range []string{"", "wrong"} {
+		sec := mtls
+		sec.Token = token
+		if err := stats(dial(sec)); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("token %q: %v, want Unauthenticated", token, err)
+		}
+	}
+	sub, err := telemetryv1.NewTelemetryClient(dial(mtls)).Subscribe(context.Background(), &telemetryv1.SubscriptionRequest{})
+	if err == nil {
+		_, err = sub.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("subscribe without token: %v, want Unauthenticated", err)
+	}
+	noCert := grpcclient.Security{CAFile: caFile, Token: "s3cret"}
+	if err := stats(dial(noCert)); err == nil || status.Code(err) == codes.Unauthenticated {
+		t.Fatalf("client without cert: %v, want handshake failure", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(dial(mtls)).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("health check without token: %v", err)
+	}
+
+	if _, err := (security{ClientCAFile: caFile}).serverOptions(); err == nil {
+		t.Fatalf("expected error for a client ca without a cert")
+	}
+	if _, err := (security{TokenFile: filepath.Join(dir, "missing")}).serverOptions(); err == nil {
+		t.Fatalf("expected error for a missing token file")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"gpu-metric-collector/internal/kube"
+)
+
+// healthState backs /readyz. Publishing updates it; the handler only reads.
+type healthState struct {
+	published atomic.Bool // a publish has reached the broker
+	failing   atomic.Bool // the last publish failed
+	// node is the node metadata of DaemonSet mode, nil otherwise
+	node atomic.Pointer[kube.NodeMeta]
+}
+
+var health = &healthState{}
+
+// publishDone records the outcome of a publish; backpressure counts as
+// reaching the broker.
+func (h *healthState) publishDone(err error) {
+	h.failing.Store(err != nil)
+	if err == nil {
+		h.published.Store(true)
+	}
+}
+
+// readinessHandler reports whether the streamer is delivering: a publish has
+// reached the broker and the last one did not fail, and in DaemonSet mode the
+// node's metadata has been read, so nothing is published without its node
+// and pod labels. A rolling update of the DaemonSet thus waits for each new
+// pod to deliver before moving on.
+func (h *healthState) readinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := map[string]string{"broker": "ok"}
+		switch {
+		case h.failing.Load():
+			checks["broker"] = "last publish failed"
+		case !h.published.Load():
+			checks["broker"] = "nothing published yet"
+		}
+		if node := h.node.Load(); node != nil {
+			checks["node"] = "ok"
+			if !node.Loaded() {
+				checks["node"] = "node metadata not read yet"
+			}
+		}
+		writeHealth(w, checks)
+	}
+}
+
+func writeHealth(w http.ResponseWriter, checks map[string]string) {
+	status, code := "ok", http.StatusOK
+	for _, v := range checks {
+		if v != "ok" {
+			status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": status, "checks": checks})
+}
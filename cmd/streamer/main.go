@@ -17,22 +17,46 @@ import (
 	"time"
 
 	telemetryv1 "gpu-metric-collector/api/gen"
+	telemetryv2 "gpu-metric-collector/api/gen/v2"
+	"gpu-metric-collector/internal/compression"
+	"gpu-metric-collector/internal/grpcclient"
+	"gpu-metric-collector/internal/kube"
+	"gpu-metric-collector/internal/metricspec"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/telemetrypb"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var (
 	flagCSV       = flag.String("csv", "dcgm_metrics_20250718_134233.csv", "Path to telemetry CSV file")
 	flagBroker    = flag.String("broker", "127.0.0.1:9000", "Broker gRPC address")
+	flagBrokerTLS = flag.Bool("broker_tls", false, "Use TLS for the broker connection (implied by -broker_ca or -broker_cert)")
+	flagBrokerCA  = flag.String("broker_ca", "", "CA bundle (PEM) used to verify the broker certificate")
+	flagBrokerCrt = flag.String("broker_cert", "", "Client certificate (PEM) for mutual TLS with the broker")
+	flagBrokerKey = flag.String("broker_key", "", "Client private key (PEM) for mutual TLS with the broker")
+	flagBrokerSNI = flag.String("broker_server_name", "", "Override the server name used to verify the broker certificate")
+	flagBrokerTok = flag.String("broker_token", "", "Bearer token sent to the broker (prefer -broker_token_file)")
+	flagBrokerTkF = flag.String("broker_token_file", "", "File containing the bearer token sent to the broker")
 	flagBatchSize = flag.Int("batch", 50, "Batch size for publish")
 	flagTickMs    = flag.Int("tick_ms", 500, "Flush interval in ms")
 	flagMetrics   = flag.String("metrics_addr", ":9101", "Metrics HTTP listen address")
 	flagProducer  = flag.String("producer_id", "streamer-1", "Producer ID")
 	flagHost      = flag.String("host_id", "", "Override host ID (default: os.Hostname)")
+	flagLabels    = flag.String("labels", "", "Labels added to every item as comma-separated key=value pairs, e.g. cluster=c1,rack=r7; a row's own labels win")
+	flagCompress  = flag.String("grpc_compression", compression.None, "Compress requests to the broker with gzip or zstd (none disables; needs a broker that accepts it)")
+	flagStream    = flag.Bool("publish_stream", true, "Publish over one telemetry.v2 stream when the broker supports it (unary telemetry.v1 calls otherwise)")
+
+	flagK8s           = flag.String("k8s", "auto", "DaemonSet mode: on, off, or auto (on when running in a Kubernetes pod with -k8s_node set)")
+	flagK8sNode       = flag.String("k8s_node", os.Getenv("NODE_NAME"), "Node the pod runs on, from the downward API (default: $NODE_NAME)")
+	flagK8sNodeLabels = flag.String("k8s_node_labels", "topology.kubernetes.io/zone,node.kubernetes.io/instance-type,nvidia.com/gpu.product", "Node labels copied to telemetry, comma-separated keys, each optionally =name (default name: the key's last segment, e.g. zone)")
+	flagK8sAnnot      = flag.String("k8s_gpu_annotation", "", "Pod annotation listing the GPUs assigned to the pod (comma-separated indices or UUIDs), as written by device plugins or GPU schedulers that annotate pods")
+	flagK8sRefresh    = flag.Duration("k8s_refresh", 30*time.Second, "How often DaemonSet mode re-reads the node and its pods")
+	flagProcRoot      = flag.String("proc_root", "/proc", "Where to find the NVIDIA driver's driver/nvidia/gpus in DaemonSet mode, e.g. the host's /proc mounted at /host/proc")
 )
 
 var (
@@ -48,6 +72,9 @@ var (
 	metricErrors = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "gpu_telemetry", Subsystem: "streamer", Name: "errors_total", Help: "Errors encountered.",
 	})
+	metricRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "streamer", Name: "items_rejected_total", Help: "Telemetry items the broker rejected as invalid.",
+	})
 	metricPublishLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
 		Namespace: "gpu_telemetry", Subsystem: "streamer", Name: "publish_latency_seconds", Help: "Latency of PublishBatch calls.",
 		Buckets: prometheus.DefBuckets,
@@ -55,15 +82,35 @@ var (
 	metricBatchPending = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: "gpu_telemetry", Subsystem: "streamer", Name: "batch_pending", Help: "Current items buffered before publish.",
 	})
+	metricSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu_telemetry", Subsystem: "streamer", Name: "rows_skipped_total", Help: "Rows of GPUs not on this node, in DaemonSet mode.",
+	})
 )
 
 func init() {
-	prometheus.MustRegister(metricIngested, metricPublished, metricBackpressure, metricErrors, metricPublishLatency, metricBatchPending)
+	prometheus.MustRegister(metricIngested, metricPublished, metricBackpressure, metricErrors, metricRejected, metricPublishLatency, metricBatchPending, metricSkipped)
+}
+
+// clientName and clientFeatures are what the streamer tells the broker when
+// negotiating capabilities.
+const clientName = "streamer/2"
+
+var clientFeatures = []telemetryv2.Feature{
+	telemetryv2.Feature_FEATURE_PUBLISH_STREAM,
+	telemetryv2.Feature_FEATURE_LABELS,
+	telemetryv2.Feature_FEATURE_ITEM_STATUS,
+	telemetryv2.Feature_FEATURE_TYPED_VALUES,
+	telemetryv2.Feature_FEATURE_SEQUENCE,
+	telemetryv2.Feature_FEATURE_GPU_REGISTRY,
 }
 
 func main() {
 	flag.Parse()
 
+	labels, err := parseLabels(*flagLabels)
+	if err != nil {
+		log.Fatalf("-labels: %v", err)
+	}
 	hostname := *flagHost
 	if hostname == "" {
 		if h, err := os.Hostname(); err == nil {
@@ -73,21 +120,71 @@ func main() {
 		}
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var node *nodeScope
+	switch *flagK8s {
+	case "on":
+		node = startDaemonSetMode(ctx)
+	case "auto":
+		if kube.InCluster() && *flagK8sNode != "" {
+			node = startDaemonSetMode(ctx)
+		}
+	case "off":
+	default:
+		log.Fatalf("-k8s %q: want on, off or auto", *flagK8s)
+	}
+	if node != nil {
+		explicit := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		if !explicit["host_id"] {
+			hostname = *flagK8sNode
+		}
+		if !explicit["producer_id"] {
+			*flagProducer = "streamer-" + *flagK8sNode
+		}
+	}
+
 	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/readyz", health.readinessHandler())
 	go func() {
 		log.Printf("streamer: metrics on %s", *flagMetrics)
 		_ = http.ListenAndServe(*flagMetrics, nil)
 	}()
 
-	conn, err := grpc.Dial(*flagBroker, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err := compression.Check(*flagCompress); err != nil {
+		log.Fatalf("-grpc_compression: %v", err)
+	}
+	sec := grpcclient.Security{TLS: *flagBrokerTLS, CAFile: *flagBrokerCA, CertFile: *flagBrokerCrt, KeyFile: *flagBrokerKey,
+		ServerName: *flagBrokerSNI, Token: *flagBrokerTok, TokenFile: *flagBrokerTkF}
+	dialOpts, err := sec.DialOptions()
+	if err != nil {
+		log.Fatalf("broker security: %v", err)
+	}
+	dialOpts = append(dialOpts, compression.DialOptions(*flagCompress)...)
+	dialOpts = append(dialOpts, grpc.WithStatsHandler(compression.NewStatsHandler("streamer", prometheus.DefaultRegisterer)))
+	conn, err := grpc.Dial(*flagBroker, dialOpts...)
 	if err != nil {
 		log.Fatalf("dial broker: %v", err)
 	}
 	defer conn.Close()
-	client := telemetryv1.NewTelemetryClient(conn)
+	var client telemetryv1.TelemetryClient = telemetryv1.NewTelemetryClient(conn)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	nctx, ncancel := context.WithTimeout(ctx, 5*time.Second)
+	caps, err := grpcclient.Negotiate(nctx, conn, clientName, clientFeatures...)
+	ncancel()
+	switch {
+	case err != nil:
+		log.Printf("streamer: broker capabilities unknown, using telemetry.v1: %v", err)
+	case caps.Legacy:
+		log.Printf("streamer: broker predates telemetry.v2, using telemetry.v1")
+	case *flagStream && caps.Has(telemetryv2.Feature_FEATURE_PUBLISH_STREAM):
+		sc := newStreamClient(client, telemetryv2.NewTelemetryClient(conn))
+		defer sc.Close()
+		client = sc
+		log.Printf("streamer: broker %s supports streaming publish", caps.Server)
+	}
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -97,12 +194,69 @@ func main() {
 		cancel()
 	}()
 
-	if err := runStreamer(ctx, client, hostname, *flagProducer, *flagCSV, *flagBatchSize, time.Duration(*flagTickMs)*time.Millisecond); err != nil {
+	if node != nil {
+		waitNodeMeta(ctx, node.meta)
+	}
+	if err := runStreamer(ctx, client, hostname, *flagProducer, labels, node, *flagCSV, *flagBatchSize, time.Duration(*flagTickMs)*time.Millisecond); err != nil {
 		log.Fatalf("streamer error: %v", err)
 	}
 }
 
-func runStreamer(ctx context.Context, client telemetryv1.TelemetryClient, hostID, producerID, csvPath string, batchSize int, tick time.Duration) error {
+// startDaemonSetMode discovers the node's GPUs and starts refreshing its
+// metadata from the API server; the first read is left to waitNodeMeta.
+func startDaemonSetMode(ctx context.Context) *nodeScope {
+	if *flagK8sNode == "" {
+		log.Fatal("-k8s=on needs -k8s_node or $NODE_NAME")
+	}
+	nodeLabels, err := parseNodeLabels(*flagK8sNodeLabels)
+	if err != nil {
+		log.Fatalf("-k8s_node_labels: %v", err)
+	}
+	if *flagK8sRefresh <= 0 {
+		log.Fatal("-k8s_refresh must be positive")
+	}
+	client, err := kube.NewInCluster()
+	if err != nil {
+		log.Fatal(err)
+	}
+	gpus, err := discoverGPUs(*flagProcRoot)
+	if err != nil {
+		log.Fatalf("discover gpus: %v", err)
+	}
+	ids := make([]string, 0, len(gpus))
+	for _, g := range gpus {
+		ids = append(ids, g.GpuId)
+	}
+	log.Printf("streamer: DaemonSet mode on node %s, %d GPUs in %s %v", *flagK8sNode, len(gpus), *flagProcRoot, ids)
+	meta := kube.NewNodeMeta(client, kube.MetaConfig{Node: *flagK8sNode, NodeLabels: nodeLabels, Annotation: *flagK8sAnnot})
+	health.node.Store(meta)
+	go refreshNodeMeta(ctx, meta, *flagK8sRefresh)
+	return newNodeScope(gpus, meta)
+}
+
+// waitNodeMeta reads the node's metadata, retrying until it succeeds or ctx
+// ends, so nothing is published without its node and pod labels.
+func waitNodeMeta(ctx context.Context, meta *kube.NodeMeta) {
+	for ctx.Err() == nil {
+		rctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := meta.Reload(rctx)
+		cancel()
+		if err == nil {
+			if n := meta.GPUs(); n > 0 {
+				log.Printf("streamer: node %s has %d GPUs allocatable by the device plugin", *flagK8sNode, n)
+			}
+			return
+		}
+		metricErrors.Inc()
+		log.Printf("streamer: read node metadata: %v (retrying in 5s)", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func runStreamer(ctx context.Context, client telemetryv1.TelemetryClient, hostID, producerID string, labels map[string]string, node *nodeScope, csvPath string, batchSize int, tick time.Duration) error {
 	file, err := os.Open(csvPath)
 	if err != nil {
 		return fmt.Errorf("open csv: %w", err)
@@ -125,19 +279,22 @@ func runStreamer(ctx context.Context, client telemetryv1.TelemetryClient, hostID
 
 	backoff := 100 * time.Millisecond
 	const backoffMax = 5 * time.Second
+	keys := newKeyGen(producerID)
+	reg := newRegistrar(client)
 
 	for {
 		select {
 		case <-ctx.Done():
 			if len(batch) > 0 {
-				drainRemaining(context.Background(), client, batch, &backoff, backoffMax)
+				drainRemaining(context.Background(), client, keys.stampBatch(batch), &backoff, backoffMax)
 			}
 			log.Printf("streamer: exiting")
 			return nil
 		case <-flushTicker.C:
+			reg.flush(ctx)
 			if len(batch) > 0 {
 				log.Printf("streamer: timer flush batch=%d", len(batch))
-				drainRemaining(ctx, client, batch, &backoff, backoffMax)
+				drainRemaining(ctx, client, keys.stampBatch(batch), &backoff, backoffMax)
 				batch = batch[:0]
 				metricBatchPending.Set(0)
 			}
@@ -165,12 +322,22 @@ func runStreamer(ctx context.Context, client telemetryv1.TelemetryClient, hostID
 			item := toTelemetry(headers, rec, hostID, producerID)
 			fmt.Printf("item - %+v \n", item)
 			if item != nil && item.GpuId != "" && item.GpuId != "gpu-unknown" {
-				batch = append(batch, item)
+				info := toGPUInfo(headers, rec, item)
+				if node.apply(item, info) {
+					item.IdempotencyKey = keys.next()
+					item.Sequence = keys.seq
+					addLabels(item, labels)
+					reg.observe(info)
+					batch = append(batch, item)
+				} else {
+					metricSkipped.Inc()
+				}
 			}
 			metricBatchPending.Set(float64(len(batch)))
 			if len(batch) >= batchSize {
+				reg.flush(ctx)
 				log.Printf("streamer: size flush batch=%d", len(batch))
-				drainRemaining(ctx, client, batch, &backoff, backoffMax)
+				drainRemaining(ctx, client, keys.stampBatch(batch), &backoff, backoffMax)
 				batch = batch[:0]
 				metricBatchPending.Set(0)
 			}
@@ -187,7 +354,7 @@ func drainRemaining(ctx context.Context, client telemetryv1.TelemetryClient, rem
 			return
 		default:
 		}
-		acc, bp, err := publishBatch(ctx, client, remaining)
+		acc, rest, err := publishBatch(ctx, client, remaining)
 		if err != nil {
 			metricErrors.Inc()
 			// if context canceled, exit without further retries
@@ -205,13 +372,9 @@ func drainRemaining(ctx context.Context, client telemetryv1.TelemetryClient, rem
 			}
 			continue
 		}
-		if bp {
-			if acc > 0 {
-				remaining = remaining[acc:]
-				log.Printf("streamer: backpressure accepted=%d remaining=%d", acc, len(remaining))
-			} else {
-				log.Printf("streamer: backpressure accepted=0 remaining=%d", len(remaining))
-			}
+		if len(rest) > 0 {
+			remaining = rest
+			log.Printf("streamer: backpressure accepted=%d remaining=%d", acc, len(remaining))
 			select {
 			case <-ctx.Done():
 				return
@@ -228,27 +391,95 @@ func drainRemaining(ctx context.Context, client telemetryv1.TelemetryClient, rem
 	}
 }
 
-// publishBatch returns (accepted, backpressure, err)
-func publishBatch(ctx context.Context, client telemetryv1.TelemetryClient, batch []*telemetryv1.TelemetryData) (int, bool, error) {
+// publishBatch returns how many items the broker accepted and, on
+// backpressure, the items to resend. Items the broker rejected as invalid
+// are logged and dropped.
+func publishBatch(ctx context.Context, client telemetryv1.TelemetryClient, batch []*telemetryv1.TelemetryData) (int, []*telemetryv1.TelemetryData, error) {
 	start := time.Now()
-	resp, err := client.PublishBatch(ctx, &telemetryv1.TelemetryBatch{Items: batch})
+	resp, err := client.PublishBatch(ctx, &telemetryv1.TelemetryBatch{Items: batch, BatchId: batch[0].GetBatchId()})
 	metricPublishLatency.Observe(time.Since(start).Seconds())
+	health.publishDone(err)
 	if err != nil {
-		return 0, false, err
+		return 0, nil, err
 	}
 	accepted := int(resp.GetAccepted())
 	metricPublished.Add(float64(accepted))
+	var rest []*telemetryv1.TelemetryData
+	for _, st := range resp.GetItems() {
+		if int(st.GetIndex()) >= len(batch) {
+			continue
+		}
+		switch st.GetStatus() {
+		case "REJECTED":
+			metricRejected.Inc()
+			log.Printf("streamer: broker rejected item gpu=%q: %s", batch[st.GetIndex()].GetGpuId(), st.GetReason())
+		case "BACKPRESSURE":
+			rest = append(rest, batch[st.GetIndex()])
+		}
+	}
 	if resp.GetStatus() == "BACKPRESSURE" {
 		metricBackpressure.Inc()
-		return accepted, true, nil
+		if len(resp.GetItems()) == 0 {
+			// a broker without item statuses accepts a leading run
+			rest = batch[min(accepted, len(batch)):]
+		}
+		return accepted, rest, nil
 	}
 	log.Printf("streamer: published ok accepted=%d", accepted)
-	return accepted, false, nil
+	return accepted, nil, nil
 }
 
+// keyGen issues idempotency keys unique across producers and restarts:
+// <producer>-<process start nanos>-<sequence>. The sequence is also sent as
+// the item's sequence number, and batch ids share the prefix.
+type keyGen struct {
+	prefix  string
+	seq     uint64
+	batches uint64
+}
+
+func newKeyGen(producerID string) *keyGen {
+	return &keyGen{prefix: fmt.Sprintf("%s-%d", producerID, time.Now().UnixNano())}
+}
+
+func (k *keyGen) next() string {
+	k.seq++
+	return k.prefix + "-" + strconv.FormatUint(k.seq, 10)
+}
+
+// stampBatch gives every item of batch the next batch id,
+// <prefix>-b<n>, and returns batch.
+func (k *keyGen) stampBatch(batch []*telemetryv1.TelemetryData) []*telemetryv1.TelemetryData {
+	k.batches++
+	id := k.prefix + "-b" + strconv.FormatUint(k.batches, 10)
+	for _, item := range batch {
+		item.BatchId = id
+	}
+	return batch
+}
+
+// labelColumns maps the CSV columns kept as labels to their label names.
+var labelColumns = map[string]string{
+	"modelname": "model",
+	"pod":       "pod",
+	"namespace": "namespace",
+	"container": "container",
+}
+
+// rawLabelKeys maps the exporter labels picked from a labels_raw column to
+// their label names.
+var rawLabelKeys = map[string]string{
+	"DCGM_FI_DRIVER_VERSION": "driver_version",
+}
+
+// toTelemetry converts a CSV row to a point. Metrics of the metricspec
+// catalog get their canonical DCGM name; others keep the lowercased column or
+// metric name.
 func toTelemetry(headers, rec []string, hostID, producerID string) *telemetryv1.TelemetryData {
 	gpuID := ""
 	metrics := make(map[string]float64)
+	labels := make(map[string]string)
+	var values map[string]*telemetryv1.MetricValue
 	// detect a metric-name column common in DCGM/Influx exports
 	fieldNameIdx := -1
 	for i, h2 := range headers {
@@ -268,28 +499,172 @@ func toTelemetry(headers, rec []string, hostID, producerID string) *telemetryv1.
 			continue
 		case "host", "host_id", "hostname":
 			continue
+		case "labels_raw":
+			for k, v := range parseRawLabels(val) {
+				if name, ok := rawLabelKeys[k]; ok && v != "" {
+					labels[name] = v
+				}
+			}
+			continue
+		}
+		if name, ok := labelColumns[h]; ok {
+			if val != "" {
+				labels[name] = val
+			}
+			continue
+		}
+		// a generic value column is keyed by the metric-name column; only
+		// such values are kept when they are not plain floats, as other
+		// text columns are attributes such as device or timestamp
+		key := ""
+		if (h == "value" || h == "_value") && fieldNameIdx >= 0 && fieldNameIdx < len(rec) {
+			key = metricspec.Canonical(strings.ToLower(strings.TrimSpace(rec[fieldNameIdx])))
+		}
+		if v, ok := model.ParseValue(val); ok && key != "" && val != "" {
+			if values == nil {
+				values = map[string]*telemetryv1.MetricValue{}
+			}
+			values[key] = telemetrypb.Value(v)
+			continue
 		}
 		if f, err := strconv.ParseFloat(val, 64); err == nil {
-			// If numeric column is generic and we have a metric-name column, use that as key
-			if (h == "value" || h == "_value") && fieldNameIdx >= 0 && fieldNameIdx < len(rec) {
-				key := strings.TrimSpace(rec[fieldNameIdx])
-				key = strings.ToLower(key)
-				if key != "" {
-					metrics[key] = f
-					continue
-				}
+			if key != "" {
+				metrics[key] = f
+				continue
 			}
-			metrics[h] = f
+			metrics[metricspec.Canonical(h)] = f
 		}
 	}
 	if gpuID == "" {
 		return nil
 	}
-	return &telemetryv1.TelemetryData{
+	out := &telemetryv1.TelemetryData{
 		ProducerId: producerID,
 		HostId:     hostID,
 		GpuId:      gpuID,
 		Ts:         timestamppb.Now(),
 		Metrics:    metrics,
 	}
+	if len(labels) > 0 {
+		out.Labels = labels
+	}
+	out.Values = values
+	return out
+}
+
+// toGPUInfo returns the static info of item's GPU: the model and driver
+// labels of the row, and its uuid, vbios and PCI bus columns if present.
+func toGPUInfo(headers, rec []string, item *telemetryv1.TelemetryData) *telemetryv1.GpuInfo {
+	info := &telemetryv1.GpuInfo{
+		GpuId:         item.GetGpuId(),
+		Model:         item.GetLabels()["model"],
+		DriverVersion: item.GetLabels()["driver_version"],
+		HostId:        item.GetHostId(),
+		ProducerId:    item.GetProducerId(),
+	}
+	for i, h := range headers {
+		if i >= len(rec) {
+			continue
+		}
+		val := strings.TrimSpace(rec[i])
+		switch h {
+		case "uuid", "gpu_uuid":
+			info.Uuid = val
+		case "vbios", "vbios_version":
+			info.VbiosVersion = val
+		case "pci_bus_id", "pci_bus":
+			info.PciBusId = val
+		case "memory_total_bytes":
+			info.MemoryTotalBytes, _ = strconv.ParseUint(val, 10, 64)
+		}
+	}
+	return info
+}
+
+// registrar announces each GPU's info to the broker the first time the GPU
+// is seen and whenever its info changes, retrying failed registrations.
+type registrar struct {
+	client  telemetryv1.TelemetryClient
+	known   map[string]*telemetryv1.GpuInfo // registered with the broker
+	pending map[string]*telemetryv1.GpuInfo
+}
+
+func newRegistrar(client telemetryv1.TelemetryClient) *registrar {
+	return &registrar{client: client, known: map[string]*telemetryv1.GpuInfo{}, pending: map[string]*telemetryv1.GpuInfo{}}
+}
+
+func (r *registrar) observe(info *telemetryv1.GpuInfo) {
+	if known, ok := r.known[info.GpuId]; ok && proto.Equal(known, info) {
+		delete(r.pending, info.GpuId)
+		return
+	}
+	r.pending[info.GpuId] = info
+}
+
+// flush registers the pending GPUs; on error they stay pending.
+func (r *registrar) flush(ctx context.Context) {
+	if len(r.pending) == 0 {
+		return
+	}
+	req := &telemetryv1.RegisterGPUsRequest{}
+	for _, info := range r.pending {
+		req.Gpus = append(req.Gpus, info)
+	}
+	if _, err := r.client.RegisterGPUs(ctx, req); err != nil {
+		metricErrors.Inc()
+		log.Printf("streamer: register gpus: %v (retrying on the next flush)", err)
+		return
+	}
+	for id, info := range r.pending {
+		r.known[id] = info
+	}
+	clear(r.pending)
+}
+
+// parseRawLabels reads a Prometheus-style label list, k1="v1",k2="v2", as
+// DCGM exporter dumps carry it. Malformed input yields the pairs read so far.
+func parseRawLabels(raw string) map[string]string {
+	out := map[string]string{}
+	for raw != "" {
+		k, rest, ok := strings.Cut(raw, `="`)
+		if !ok {
+			break
+		}
+		v, rest, ok := strings.Cut(rest, `"`)
+		if !ok {
+			break
+		}
+		out[strings.TrimSpace(k)] = v
+		raw = strings.TrimPrefix(rest, ",")
+	}
+	return out
+}
+
+// parseLabels parses the -labels flag: comma-separated key=value pairs.
+func parseLabels(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if k = strings.TrimSpace(k); !ok || k == "" {
+			return nil, fmt.Errorf("%q is not key=value", kv)
+		}
+		out[k] = strings.TrimSpace(v)
+	}
+	return out, nil
+}
+
+// addLabels sets the labels item does not carry already.
+func addLabels(item *telemetryv1.TelemetryData, labels map[string]string) {
+	for k, v := range labels {
+		if _, ok := item.Labels[k]; ok {
+			continue
+		}
+		if item.Labels == nil {
+			item.Labels = map[string]string{}
+		}
+		item.Labels[k] = v
+	}
 }
@@ -3,12 +3,16 @@ package main
 import (
 	"context"
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/metricspec"
 
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
 )
 
 // fakeTelemetryClient is a controllable fake for TelemetryClient used to simulate
@@ -20,6 +24,9 @@ type fakeTelemetryClient struct {
 	script    []*telemetryv1.PublishResponse
 	scriptErr []error
 	calls     int
+	// RegisterGPUs records the GPUs registered, or fails with registerErr
+	registered  []*telemetryv1.GpuInfo
+	registerErr error
 }
 
 func (f *fakeTelemetryClient) PublishBatch(ctx context.Context, req *telemetryv1.TelemetryBatch, opts ...grpc.CallOption) (*telemetryv1.PublishResponse, error) {
@@ -45,18 +52,38 @@ func (f *fakeTelemetryClient) Subscribe(ctx context.Context, in *telemetryv1.Sub
 	return &fakeSubStream{}, nil
 }
 
+func (f *fakeTelemetryClient) Ack(ctx context.Context, in *telemetryv1.AckRequest, opts ...grpc.CallOption) (*telemetryv1.AckResponse, error) {
+	return &telemetryv1.AckResponse{}, nil
+}
+
+func (f *fakeTelemetryClient) RegisterGPUs(ctx context.Context, in *telemetryv1.RegisterGPUsRequest, opts ...grpc.CallOption) (*telemetryv1.RegisterGPUsResponse, error) {
+	if f.registerErr != nil {
+		return nil, f.registerErr
+	}
+	f.registered = append(f.registered, in.GetGpus()...)
+	return &telemetryv1.RegisterGPUsResponse{Changed: int64(len(in.GetGpus()))}, nil
+}
+
+func (f *fakeTelemetryClient) ListGPUInfo(ctx context.Context, in *telemetryv1.ListGPUInfoRequest, opts ...grpc.CallOption) (*telemetryv1.ListGPUInfoResponse, error) {
+	return &telemetryv1.ListGPUInfoResponse{}, nil
+}
+
+func (f *fakeTelemetryClient) GetStats(ctx context.Context, in *telemetryv1.GetStatsRequest, opts ...grpc.CallOption) (*telemetryv1.GetStatsResponse, error) {
+	return &telemetryv1.GetStatsResponse{}, nil
+}
+
 func TestPublishBatch_OK(t *testing.T) {
 	// Scenario: broker accepts all items with status OK
 	// Input: batch of 3, response Accepted=3, Status=OK
-	// Expect: accepted=3, backpressure=false, err=nil
+	// Expect: accepted=3, nothing to resend, err=nil
 	fc := &fakeTelemetryClient{resp: &telemetryv1.PublishResponse{Accepted: 3, Status: "OK"}}
 	batch := []*telemetryv1.TelemetryData{{}, {}, {}}
-	acc, bp, err := publishBatch(context.Background(), fc, batch)
+	acc, rest, err := publishBatch(context.Background(), fc, batch)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
-	if bp {
-		t.Fatalf("expected no backpressure")
+	if len(rest) != 0 {
+		t.Fatalf("expected nothing to resend")
 	}
 	if acc != 3 {
 		t.Fatalf("expected accepted=3 got %d", acc)
@@ -66,21 +93,35 @@ func TestPublishBatch_OK(t *testing.T) {
 func TestPublishBatch_BackpressurePartial(t *testing.T) {
 	// Scenario: broker returns BACKPRESSURE after partially accepting some items
 	// Input: batch of 5, response Accepted=2, Status=BACKPRESSURE
-	// Expect: accepted=2, backpressure=true, err=nil
+	// Expect: accepted=2, the last 3 items to resend, err=nil
 	fc := &fakeTelemetryClient{resp: &telemetryv1.PublishResponse{Accepted: 2, Status: "BACKPRESSURE"}}
 	batch := []*telemetryv1.TelemetryData{{}, {}, {}, {}, {}}
-	acc, bp, err := publishBatch(context.Background(), fc, batch)
+	acc, rest, err := publishBatch(context.Background(), fc, batch)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
-	if !bp {
-		t.Fatalf("expected backpressure=true")
+	if len(rest) != 3 || rest[0] != batch[2] {
+		t.Fatalf("expected the last 3 items to resend, got %d", len(rest))
 	}
 	if acc != 2 {
 		t.Fatalf("expected accepted=2 got %d", acc)
 	}
 }
 
+func TestPublishBatch_ItemStatuses(t *testing.T) {
+	// Scenario: the broker rejects item 1 and runs out of room at item 3 of 5
+	// Expect: items 3 and 4 to resend; the rejected item is dropped, not resent
+	batch := []*telemetryv1.TelemetryData{{GpuId: "0"}, {}, {GpuId: "2"}, {GpuId: "3"}, {GpuId: "4"}}
+	fc := &fakeTelemetryClient{resp: &telemetryv1.PublishResponse{Accepted: 2, Status: "BACKPRESSURE", Items: []*telemetryv1.ItemStatus{
+		{Index: 1, Status: "REJECTED", Reason: "gpu_id required"},
+		{Index: 3, Status: "BACKPRESSURE"}, {Index: 4, Status: "BACKPRESSURE"},
+	}}}
+	acc, rest, err := publishBatch(context.Background(), fc, batch)
+	if err != nil || acc != 2 || len(rest) != 2 || rest[0] != batch[3] || rest[1] != batch[4] {
+		t.Fatalf("accepted %d rest %v err %v", acc, rest, err)
+	}
+}
+
 func TestPublishBatch_Error(t *testing.T) {
 	// Scenario: broker call returns an error
 	// Input: any batch, client error
@@ -146,3 +187,134 @@ func TestToTelemetry_Mapping(t *testing.T) {
 		t.Fatalf("power metric mismatch: %v", got)
 	}
 }
+
+func TestToTelemetry_Labels(t *testing.T) {
+	// Scenario: a DCGM export row with model, pod and exporter labels, then
+	// the -labels flag's static labels added
+	// Expect: model, pod and driver_version labels from the row, no label for
+	// the empty namespace, no label column parsed as a metric; static labels
+	// fill only keys the row did not set
+	headers := []string{"metric_name", "gpu_id", "modelname", "pod", "namespace", "value", "labels_raw"}
+	rec := []string{"DCGM_FI_DEV_GPU_UTIL", "0", "NVIDIA H100 80GB HBM3", "7", "", "42",
+		`DCGM_FI_DRIVER_VERSION="535.129.03",Hostname="node-1",gpu="0"`}
+	out := toTelemetry(headers, rec, "host-a", "producer-x")
+	want := map[string]string{"model": "NVIDIA H100 80GB HBM3", "pod": "7", "driver_version": "535.129.03"}
+	if !reflect.DeepEqual(out.GetLabels(), want) || len(out.GetMetrics()) != 1 || out.GetMetrics()["DCGM_FI_DEV_GPU_UTIL"] != 42 {
+		t.Fatalf("labels %v metrics %v", out.GetLabels(), out.GetMetrics())
+	}
+
+	static, err := parseLabels(" cluster=c1, pod=ignored ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addLabels(out, static)
+	if out.GetLabels()["cluster"] != "c1" || out.GetLabels()["pod"] != "7" {
+		t.Fatalf("static labels: %v", out.GetLabels())
+	}
+	if _, err := parseLabels("cluster"); err == nil {
+		t.Fatal("expected an error for a pair without =")
+	}
+}
+
+func TestToTelemetry_TypedValues(t *testing.T) {
+	// Scenario: long-format rows whose value is a P-state, a flag, a serial
+	// too long for a float64 and a plain number
+	// Expect: the first three as string, bool and int values keyed by metric
+	// name, the number as a metric; no values from the other text columns
+	headers := []string{"timestamp", "metric_name", "gpu_id", "device", "value"}
+	want := map[string]*telemetryv1.MetricValue{
+		"DCGM_FI_DEV_PSTATE":  {Value: &telemetryv1.MetricValue_StringValue{StringValue: "P0"}},
+		"dcgm_fi_dev_ecc_on":  {Value: &telemetryv1.MetricValue_BoolValue{BoolValue: true}},
+		"dcgm_fi_dev_serial":  {Value: &telemetryv1.MetricValue_IntValue{IntValue: 1324021012345678901}},
+		"dcgm_fi_dev_gpu_tmp": nil,
+	}
+	for _, row := range [][]string{
+		{"DCGM_FI_DEV_PSTATE", "P0"}, {"DCGM_FI_DEV_ECC_ON", "true"}, {"DCGM_FI_DEV_SERIAL", "1324021012345678901"}, {"DCGM_FI_DEV_GPU_TMP", "61"},
+	} {
+		out := toTelemetry(headers, []string{"2025-07-18T20:42:34Z", row[0], "0", "nvidia0", row[1]}, "host-a", "producer-x")
+		key := metricspec.Canonical(strings.ToLower(row[0]))
+		if w := want[key]; w == nil {
+			if len(out.GetValues()) != 0 || out.GetMetrics()[key] != 61 {
+				t.Fatalf("%s: values %v metrics %v", key, out.GetValues(), out.GetMetrics())
+			}
+		} else if len(out.GetValues()) != 1 || !proto.Equal(out.GetValues()[key], w) || len(out.GetMetrics()) != 0 {
+			t.Fatalf("%s: values %v metrics %v", key, out.GetValues(), out.GetMetrics())
+		}
+	}
+}
+
+func TestToTelemetry_CanonicalNames(t *testing.T) {
+	// Scenario: a wide-format row with a lowercased DCGM column, an
+	// nvidia-smi column and a column the catalog does not know
+	// Expect: the first two under their canonical DCGM names, the last as is
+	headers := []string{"gpu_id", "dcgm_fi_dev_gpu_temp", "utilization.gpu", "fan_speed"}
+	out := toTelemetry(headers, []string{"0", "61", "97", "40"}, "host-a", "producer-x")
+	want := map[string]float64{"DCGM_FI_DEV_GPU_TEMP": 61, "DCGM_FI_DEV_GPU_UTIL": 97, "fan_speed": 40}
+	if !reflect.DeepEqual(out.GetMetrics(), want) {
+		t.Fatalf("metrics %v", out.GetMetrics())
+	}
+}
+
+func TestRegistrar_RegistersNewAndChangedGPUs(t *testing.T) {
+	// Scenario: rows of two GPUs, repeated; a failed registration; then a
+	// driver upgrade on one GPU
+	// Expect: each GPU registered once with its uuid, model and driver; a
+	// failed registration retried on the next flush; the upgrade registered
+	headers := []string{"gpu_id", "uuid", "modelname", "value", "labels_raw"}
+	row := func(gpu, driver string) []string {
+		return []string{gpu, "GPU-" + gpu, "H100", "1", `DCGM_FI_DRIVER_VERSION="` + driver + `"`}
+	}
+	fc := &fakeTelemetryClient{registerErr: errors.New("unavailable")}
+	reg := newRegistrar(fc)
+	see := func(rec []string) {
+		item := toTelemetry(headers, rec, "node-1", "p1")
+		reg.observe(toGPUInfo(headers, rec, item))
+	}
+	see(row("0", "535"))
+	reg.flush(context.Background())
+	fc.registerErr = nil
+	see(row("1", "535"))
+	see(row("0", "535"))
+	reg.flush(context.Background())
+	if len(fc.registered) != 2 {
+		t.Fatalf("registered %v", fc.registered)
+	}
+	if g := fc.registered[0]; g.GetUuid() != "GPU-"+g.GetGpuId() || g.GetModel() != "H100" || g.GetDriverVersion() != "535" || g.GetHostId() != "node-1" {
+		t.Fatalf("info %v", g)
+	}
+	see(row("0", "535"))
+	see(row("1", "550"))
+	reg.flush(context.Background())
+	if len(fc.registered) != 3 || fc.registered[2].GetGpuId() != "1" || fc.registered[2].GetDriverVersion() != "550" {
+		t.Fatalf("after upgrade %v", fc.registered)
+	}
+}
+
+func TestKeyGen_Unique(t *testing.T) {
+	// Scenario: consecutive keys from one generator and keys from two producers
+	// Expect: all keys distinct and prefixed by producer id
+	a, b := newKeyGen("p1"), newKeyGen("p2")
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		for _, k := range []string{a.next(), b.next()} {
+			if seen[k] {
+				t.Fatalf("duplicate key %s", k)
+			}
+			seen[k] = true
+		}
+	}
+	if k := a.next(); k[:3] != "p1-" {
+		t.Fatalf("unexpected key prefix: %s", k)
+	}
+}
+
+func TestKeyGen_StampBatch(t *testing.T) {
+	// Scenario: two batches stamped by one generator
+	// Expect: every item of a batch shares its id; the batches' ids differ
+	k := newKeyGen("p1")
+	first := k.stampBatch([]*telemetryv1.TelemetryData{{}, {}})
+	second := k.stampBatch([]*telemetryv1.TelemetryData{{}})
+	if id := first[0].GetBatchId(); id == "" || first[1].GetBatchId() != id || second[0].GetBatchId() == id {
+		t.Fatalf("batch ids %q %q %q", id, first[1].GetBatchId(), second[0].GetBatchId())
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/kube"
+)
+
+// discoverGPUs lists the GPUs the NVIDIA driver reports under procRoot, one
+// directory per GPU in driver/nvidia/gpus holding an information file. This
+// is the device list NVML reads, without linking NVML. A GPU's ID is its
+// device minor number, the N of /dev/nvidiaN. No driver means no GPUs.
+func discoverGPUs(procRoot string) ([]*telemetryv1.GpuInfo, error) {
+	files, err := filepath.Glob(filepath.Join(procRoot, "driver", "nvidia", "gpus", "*", "information"))
+	if err != nil {
+		return nil, err
+	}
+	var out []*telemetryv1.GpuInfo
+	for _, path := range files {
+		info, err := readGPUInformation(path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, _ := strconv.Atoi(out[i].GpuId)
+		b, _ := strconv.Atoi(out[j].GpuId)
+		return a < b
+	})
+	return out, nil
+}
+
+// readGPUInformation parses a driver information file, lines of
+// "Key: value" such as "GPU UUID: GPU-5fd4f087-...".
+func readGPUInformation(path string) (*telemetryv1.GpuInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info := &telemetryv1.GpuInfo{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch strings.TrimSpace(k) {
+		case "Model":
+			info.Model = v
+		case "GPU UUID":
+			info.Uuid = v
+		case "Video BIOS":
+			info.VbiosVersion = v
+		case "Bus Location":
+			info.PciBusId = v
+		case "Device Minor":
+			info.GpuId = v
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if info.GpuId == "" {
+		return nil, fmt.Errorf("%s: no Device Minor", path)
+	}
+	return info, nil
+}
+
+// nodeScope is the DaemonSet mode's view of the node the streamer runs on:
+// the GPUs on it and the labels their telemetry gets. A nil *nodeScope
+// keeps every row and adds nothing.
+type nodeScope struct {
+	// gpus are the discovered GPUs, by ID and by UUID
+	gpus map[string]*telemetryv1.GpuInfo
+	meta *kube.NodeMeta
+}
+
+func newNodeScope(gpus []*telemetryv1.GpuInfo, meta *kube.NodeMeta) *nodeScope {
+	s := &nodeScope{gpus: map[string]*telemetryv1.GpuInfo{}, meta: meta}
+	for _, g := range gpus {
+		s.gpus[g.GpuId] = g
+		if g.Uuid != "" {
+			s.gpus[g.Uuid] = g
+		}
+	}
+	return s
+}
+
+// local returns the discovered GPU item is of, matched by its ID or by the
+// UUID of its row. ok reports whether the GPU is on this node: without
+// discovered GPUs, IDs below the node's GPU capacity are, and without a
+// capacity either, every GPU is.
+func (s *nodeScope) local(item *telemetryv1.TelemetryData, uuid string) (gpu *telemetryv1.GpuInfo, ok bool) {
+	if g := s.gpus[item.GetGpuId()]; g != nil {
+		return g, true
+	}
+	if g := s.gpus[uuid]; g != nil && uuid != "" {
+		return g, true
+	}
+	if len(s.gpus) > 0 {
+		return nil, false
+	}
+	if n := s.meta.GPUs(); n > 0 {
+		i, err := strconv.Atoi(item.GetGpuId())
+		return nil, err == nil && i >= 0 && i < n
+	}
+	return nil, true
+}
+
+// apply reports whether item, with the static info of its row, is of a GPU
+// on this node. If so, it adds the node's and the GPU's pod labels to item,
+// where the row does not have them, and completes info from the discovered
+// GPU.
+func (s *nodeScope) apply(item *telemetryv1.TelemetryData, info *telemetryv1.GpuInfo) bool {
+	if s == nil {
+		return true
+	}
+	gpu, ok := s.local(item, info.GetUuid())
+	if !ok {
+		return false
+	}
+	ids := []string{item.GetGpuId(), info.GetUuid()}
+	if gpu != nil {
+		ids = append(ids, gpu.GpuId, gpu.Uuid)
+		if info.Uuid == "" {
+			info.Uuid = gpu.Uuid
+		}
+		if info.Model == "" {
+			info.Model = gpu.Model
+		}
+		if info.VbiosVersion == "" {
+			info.VbiosVersion = gpu.VbiosVersion
+		}
+		if info.PciBusId == "" {
+			info.PciBusId = gpu.PciBusId
+		}
+	}
+	addLabels(item, s.meta.Labels(ids...))
+	return true
+}
+
+// refreshNodeMeta reloads meta every interval until ctx ends, so pods
+// started or gone since are attributed correctly.
+func refreshNodeMeta(ctx context.Context, meta *kube.NodeMeta, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			rctx, cancel := context.WithTimeout(ctx, every)
+			if err := meta.Reload(rctx); err != nil && ctx.Err() == nil {
+				metricErrors.Inc()
+				log.Printf("streamer: reload node metadata: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// parseNodeLabels parses the -k8s_node_labels flag: comma-separated node
+// label keys, each optionally =name to set the telemetry label it is copied
+// to (default kube.LabelName of the key).
+func parseNodeLabels(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		k, name, ok := strings.Cut(kv, "=")
+		k, name = strings.TrimSpace(k), strings.TrimSpace(name)
+		if !ok {
+			name = kube.LabelName(k)
+		}
+		if k == "" || name == "" {
+			return nil, fmt.Errorf("%q is not a label key or key=name", kv)
+		}
+		out[k] = name
+	}
+	return out, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/kube"
+)
+
+// writeGPU writes the driver's information file of a GPU under root.
+func writeGPU(t *testing.T, root, bus, minor, uuid string) {
+	t.Helper()
+	dir := filepath.Join(root, "driver", "nvidia", "gpus", bus)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	info := "Model: \t\t NVIDIA H100 80GB HBM3\nIRQ:   \t\t 42\nGPU UUID: \t " + uuid + "\nVideo BIOS: \t 96.00.74.00.01\n" +
+		"Bus Type: \t PCIe\nBus Location: \t " + bus + "\nDevice Minor: \t " + minor + "\nGPU Excluded:\t No\n"
+	if err := os.WriteFile(filepath.Join(dir, "information"), []byte(info), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// nodeMeta returns metadata of node n1, with 2 GPUs and zone z1, whose pod
+// "train" is annotated with GPU 1.
+func nodeMeta(t *testing.T) *kube.NodeMeta {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/v1/nodes/") {
+			_, _ = w.Write([]byte(`{"metadata":{"name":"n1","labels":{"topology.kubernetes.io/zone":"z1"}},"status":{"capacity":{"nvidia.com/gpu":"2"}}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"items":[{"metadata":{"namespace":"ml","name":"train","annotations":{"gpus":"1"}}}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	m := kube.NewNodeMeta(kube.NewClient(srv.URL, "", srv.Client()),
+		kube.MetaConfig{Node: "n1", Annotation: "gpus", NodeLabels: map[string]string{"topology.kubernetes.io/zone": "zone"}})
+	if err := m.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestDiscoverGPUs_ReadsDriverInformation(t *testing.T) {
+	// Scenario: the driver reports GPUs with minors 10 and 2; no driver at all
+	// Expect: both in minor order with UUID, model, vbios and bus; none without a driver
+	root := t.TempDir()
+	writeGPU(t, root, "0000:c8:00.0", "10", "GPU-c8")
+	writeGPU(t, root, "0000:18:00.0", "2", "GPU-18")
+	gpus, err := discoverGPUs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gpus) != 2 || gpus[0].GpuId != "2" || gpus[1].GpuId != "10" {
+		t.Fatalf("gpus = %v", gpus)
+	}
+	if g := gpus[0]; g.Uuid != "GPU-18" || g.Model != "NVIDIA H100 80GB HBM3" || g.VbiosVersion != "96.00.74.00.01" || g.PciBusId != "0000:18:00.0" {
+		t.Fatalf("gpu 2 = %v", g)
+	}
+	if gpus, err := discoverGPUs(t.TempDir()); err != nil || len(gpus) != 0 {
+		t.Fatalf("without a driver: %v %v", gpus, err)
+	}
+}
+
+func TestNodeScope_FiltersAndLabels(t *testing.T) {
+	// Scenario: GPUs 0 and 1 discovered; rows of GPU 0, of GPU-1 by UUID with
+	// its own pod label, and of GPU 5
+	// Expect: GPU 5 skipped; node labels added; the annotated pod on GPU 1
+	// loses to the row's own; GPU info completed from discovery
+	s := newNodeScope([]*telemetryv1.GpuInfo{
+		{GpuId: "0", Uuid: "GPU-0", Model: "H100", PciBusId: "0000:18:00.0"},
+		{GpuId: "1", Uuid: "GPU-1", Model: "H100"},
+	}, nodeMeta(t))
+
+	item, info := &telemetryv1.TelemetryData{GpuId: "0"}, &telemetryv1.GpuInfo{GpuId: "0"}
+	if !s.apply(item, info) {
+		t.Fatal("gpu 0 skipped")
+	}
+	if !reflect.DeepEqual(item.Labels, map[string]string{"node": "n1", "zone": "z1"}) || info.Uuid != "GPU-0" || info.PciBusId != "0000:18:00.0" {
+		t.Fatalf("gpu 0: labels %v, info %v", item.Labels, info)
+	}
+	item = &telemetryv1.TelemetryData{GpuId: "gpu-x", Labels: map[string]string{"pod": "from-row"}}
+	if !s.apply(item, &telemetryv1.GpuInfo{Uuid: "GPU-1"}) || item.Labels["pod"] != "from-row" || item.Labels["namespace"] != "ml" {
+		t.Fatalf("gpu 1 by uuid: %v", item.Labels)
+	}
+	if s.apply(&telemetryv1.TelemetryData{GpuId: "5"}, &telemetryv1.GpuInfo{}) {
+		t.Fatal("gpu 5 not skipped")
+	}
+	var none *nodeScope
+	if item := (&telemetryv1.TelemetryData{GpuId: "5"}); !none.apply(item, &telemetryv1.GpuInfo{}) || item.Labels != nil {
+		t.Fatal("nil scope filtered or labelled")
+	}
+}
+
+func TestNodeScope_CapacityWithoutDiscovery(t *testing.T) {
+	// Scenario: no GPUs discovered on a node the device plugin gives 2 GPUs
+	// Expect: GPUs 0 and 1 kept, with the pod of GPU 1; GPU 2 and non-index IDs skipped
+	s := newNodeScope(nil, nodeMeta(t))
+	item := &telemetryv1.TelemetryData{GpuId: "1"}
+	if !s.apply(item, &telemetryv1.GpuInfo{}) || item.Labels["pod"] != "train" {
+		t.Fatalf("gpu 1: %v", item.Labels)
+	}
+	for _, id := range []string{"2", "gpu-a", "-1"} {
+		if s.apply(&telemetryv1.TelemetryData{GpuId: id}, &telemetryv1.GpuInfo{}) {
+			t.Errorf("gpu %q kept", id)
+		}
+	}
+}
+
+func TestReadiness_BrokerAndNode(t *testing.T) {
+	// Scenario: readiness before any publish, after a success, after a
+	// failure, and in DaemonSet mode before and after the node is read
+	// Expect: ready only after a successful last publish and, with a node, once it is read
+	h := &healthState{}
+	ready := func() bool {
+		rec := httptest.NewRecorder()
+		h.readinessHandler()(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code == http.StatusOK
+	}
+	if ready() {
+		t.Fatal("ready before publishing")
+	}
+	h.publishDone(nil)
+	if !ready() {
+		t.Fatal("not ready after publishing")
+	}
+	h.publishDone(errors.New("unavailable"))
+	if ready() {
+		t.Fatal("ready after a failed publish")
+	}
+	h.publishDone(nil)
+	h.node.Store(kube.NewNodeMeta(nil, kube.MetaConfig{}))
+	if ready() {
+		t.Fatal("ready before reading the node")
+	}
+	h.node.Store(nodeMeta(t))
+	if !ready() {
+		t.Fatal("not ready with the node read")
+	}
+}
+
+func TestParseNodeLabels(t *testing.T) {
+	got, err := parseNodeLabels("topology.kubernetes.io/zone, node.kubernetes.io/instance-type=type,,rack")
+	want := map[string]string{"topology.kubernetes.io/zone": "zone", "node.kubernetes.io/instance-type": "type", "rack": "rack"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v %v, want %v", got, err, want)
+	}
+	if _, err := parseNodeLabels("=zone"); err == nil {
+		t.Fatal("empty key accepted")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	telemetryv2 "gpu-metric-collector/api/gen/v2"
+
+	"google.golang.org/grpc"
+)
+
+// streamClient publishes over one telemetry.v2 PublishStream instead of a
+// unary call per batch, for brokers that advertise it; its other methods
+// are the v1 client's. A failed stream is reopened on the next publish.
+type streamClient struct {
+	telemetryv1.TelemetryClient
+	v2 telemetryv2.TelemetryClient
+
+	mu     sync.Mutex
+	stream telemetryv2.Telemetry_PublishStreamClient
+	cancel context.CancelFunc
+}
+
+func newStreamClient(v1 telemetryv1.TelemetryClient, v2 telemetryv2.TelemetryClient) *streamClient {
+	return &streamClient{TelemetryClient: v1, v2: v2}
+}
+
+// PublishBatch sends batch on the stream and waits for its response. The
+// stream outlives ctx, which only bounds opening it.
+func (c *streamClient) PublishBatch(ctx context.Context, batch *telemetryv1.TelemetryBatch, _ ...grpc.CallOption) (*telemetryv1.PublishResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.stream == nil {
+		sctx, cancel := context.WithCancel(context.Background())
+		stream, err := c.v2.PublishStream(sctx)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		c.stream, c.cancel = stream, cancel
+	}
+	err := c.stream.Send(batch)
+	var resp *telemetryv1.PublishResponse
+	if err == nil {
+		resp, err = c.stream.Recv()
+	}
+	if err != nil {
+		c.reset()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Close ends the stream.
+func (c *streamClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stream != nil {
+		_ = c.stream.CloseSend()
+		c.reset()
+	}
+}
+
+func (c *streamClient) reset() {
+	c.cancel()
+	c.stream, c.cancel = nil, nil
+}
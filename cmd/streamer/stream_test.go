@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	telemetryv2 "gpu-metric-collector/api/gen/v2"
+
+	"google.golang.org/grpc"
+)
+
+// fakeV2Client opens fakePublishStreams; sendErr makes the next Send fail.
+type fakeV2Client struct {
+	telemetryv2.TelemetryClient
+	opened  int
+	sendErr error
+}
+
+func (f *fakeV2Client) PublishStream(ctx context.Context, _ ...grpc.CallOption) (grpc.BidiStreamingClient[telemetryv1.TelemetryBatch, telemetryv1.PublishResponse], error) {
+	f.opened++
+	return &fakePublishStream{client: f}, nil
+}
+
+type fakePublishStream struct {
+	grpc.ClientStream
+	client *fakeV2Client
+	last   *telemetryv1.TelemetryBatch
+	closed bool
+}
+
+func (s *fakePublishStream) Send(b *telemetryv1.TelemetryBatch) error {
+	if err := s.client.sendErr; err != nil {
+		s.client.sendErr = nil
+		return err
+	}
+	s.last = b
+	return nil
+}
+
+func (s *fakePublishStream) Recv() (*telemetryv1.PublishResponse, error) {
+	return &telemetryv1.PublishResponse{Status: "OK", Accepted: int64(len(s.last.GetItems()))}, nil
+}
+
+func (s *fakePublishStream) CloseSend() error { s.closed = true; return nil }
+
+func TestStreamClient_ReusesAndReopensStream(t *testing.T) {
+	// Scenario: two publishes, a publish whose send fails, then another
+	// Expect: the first two share one stream; the failure is returned and
+	// the next publish opens a new stream
+	v2 := &fakeV2Client{}
+	c := newStreamClient(nil, v2)
+	batch := &telemetryv1.TelemetryBatch{Items: []*telemetryv1.TelemetryData{{GpuId: "0"}, {GpuId: "1"}}}
+	for i := 0; i < 2; i++ {
+		if resp, err := c.PublishBatch(context.Background(), batch); err != nil || resp.GetAccepted() != 2 {
+			t.Fatalf("publish %d: %v %v", i, resp, err)
+		}
+	}
+	v2.sendErr = errors.New("stream broken")
+	if _, err := c.PublishBatch(context.Background(), batch); err == nil {
+		t.Fatal("expected the send error")
+	}
+	if _, err := c.PublishBatch(context.Background(), batch); err != nil || v2.opened != 2 {
+		t.Fatalf("reopen: opened=%d err=%v", v2.opened, err)
+	}
+	stream := c.stream.(*fakePublishStream)
+	c.Close()
+	if !stream.closed || c.stream != nil {
+		t.Fatal("stream not closed")
+	}
+
+	// a canceled publish does not touch the stream
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.PublishBatch(ctx, batch); !errors.Is(err, context.Canceled) || v2.opened != 2 {
+		t.Fatalf("canceled: opened=%d err=%v", v2.opened, err)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/compression"
+	"gpu-metric-collector/internal/grpcclient"
+	"gpu-metric-collector/internal/metricspec"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// brokerFlags adds the flags selecting the broker and securing the
+// connection to it to fs.
+func brokerFlags(fs *flag.FlagSet) func() (*grpc.ClientConn, error) {
+	addr := fs.String("broker", "127.0.0.1:9000", "Broker gRPC address")
+	var sec grpcclient.Security
+	fs.BoolVar(&sec.TLS, "broker_tls", false, "Use TLS for the broker connection (implied by -broker_ca or -broker_cert)")
+	fs.StringVar(&sec.CAFile, "broker_ca", "", "CA bundle (PEM) used to verify the broker certificate")
+	fs.StringVar(&sec.CertFile, "broker_cert", "", "Client certificate (PEM) for mutual TLS with the broker")
+	fs.StringVar(&sec.KeyFile, "broker_key", "", "Client private key (PEM) for mutual TLS with the broker")
+	fs.StringVar(&sec.ServerName, "broker_server_name", "", "Override the server name used to verify the broker certificate")
+	fs.StringVar(&sec.Token, "broker_token", "", "Bearer token sent to the broker (prefer -broker_token_file)")
+	fs.StringVar(&sec.TokenFile, "broker_token_file", "", "File containing the bearer token sent to the broker")
+	comp := fs.String("grpc_compression", compression.None, "Compress requests to the broker with gzip or zstd")
+	return func() (*grpc.ClientConn, error) {
+		if err := compression.Check(*comp); err != nil {
+			return nil, fmt.Errorf("-grpc_compression: %w", err)
+		}
+		opts, err := sec.DialOptions()
+		if err != nil {
+			return nil, err
+		}
+		return grpc.NewClient(*addr, append(opts, compression.DialOptions(*comp)...)...)
+	}
+}
+
+// defaultPublishMetrics are the metrics publish sends unless told otherwise.
+const defaultPublishMetrics = "DCGM_FI_DEV_GPU_TEMP,DCGM_FI_DEV_GPU_UTIL,DCGM_FI_DEV_POWER_USAGE"
+
+func publish(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	dial := brokerFlags(fs)
+	gpuIDs := fs.String("gpu", "telemetryctl-0", "Comma-separated GPU IDs to publish for")
+	host := fs.String("host", "", "Host ID of the points (default: os.Hostname)")
+	producer := fs.String("producer", "telemetryctl", "Producer ID of the points")
+	metrics := fs.String("metrics", defaultPublishMetrics, "Comma-separated metrics, each given a random value within its catalog bounds")
+	count := fs.Int("count", 1, "Points to publish per GPU")
+	interval := fs.Duration("interval", time.Second, "Time between a GPU's points")
+	_ = fs.Parse(args)
+
+	if *host == "" {
+		if h, err := os.Hostname(); err == nil {
+			*host = h
+		}
+	}
+	names := strings.Split(*metrics, ",")
+	ids := strings.Split(*gpuIDs, ",")
+	conn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client := telemetryv1.NewTelemetryClient(conn)
+
+	prefix := fmt.Sprintf("%s-%d", *producer, time.Now().UnixNano())
+	var seq uint64
+	var accepted, rejected int64
+	for i := 0; i < *count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(*interval):
+			}
+		}
+		batch := &telemetryv1.TelemetryBatch{BatchId: fmt.Sprintf("%s-b%d", prefix, i+1)}
+		now := timestamppb.Now()
+		for _, id := range ids {
+			seq++
+			item := &telemetryv1.TelemetryData{
+				ProducerId:     *producer,
+				HostId:         *host,
+				GpuId:          id,
+				Ts:             now,
+				Metrics:        make(map[string]float64, len(names)),
+				IdempotencyKey: fmt.Sprintf("%s-%d", prefix, seq),
+				Sequence:       seq,
+				BatchId:        batch.BatchId,
+			}
+			for _, n := range names {
+				item.Metrics[n] = sampleValue(n)
+			}
+			batch.Items = append(batch.Items, item)
+		}
+		resp, err := client.PublishBatch(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("publish: %w", err)
+		}
+		accepted += resp.GetAccepted()
+		for _, it := range resp.GetItems() {
+			rejected++
+			fmt.Fprintf(os.Stderr, "%s: %s %s\n", batch.Items[it.GetIndex()].GetGpuId(), it.GetStatus(), it.GetReason())
+		}
+	}
+	fmt.Printf("published %d points, %d not accepted\n", accepted, rejected)
+	if rejected > 0 {
+		return fmt.Errorf("%d points were not accepted", rejected)
+	}
+	return nil
+}
+
+// sampleValue returns a random value of the metric name within its catalog
+// bounds; metrics without an upper bound get up to 100 above their lower.
+func sampleValue(name string) float64 {
+	lo, hi := 0.0, 100.0
+	if s, ok := metricspec.Lookup(name); ok {
+		if s.Min != nil {
+			lo, hi = *s.Min, *s.Min+100
+		}
+		if s.Max != nil {
+			hi = *s.Max
+		}
+	}
+	return lo + rand.Float64()*(hi-lo)
+}
+
+func stats(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	dial := brokerFlags(fs)
+	asJSON := fs.Bool("json", false, "Print the stats as JSON")
+	_ = fs.Parse(args)
+
+	conn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	s, err := telemetryv1.NewTelemetryClient(conn).GetStats(ctx, &telemetryv1.GetStatsRequest{})
+	if err != nil {
+		return fmt.Errorf("stats: %w", err)
+	}
+	if *asJSON {
+		b, err := protojson.MarshalOptions{Multiline: true, EmitUnpopulated: true}.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Printf("%s\n", b)
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "queue\t%d/%d\n", s.GetQueueDepth(), s.GetQueueCapacity())
+	fmt.Fprintf(tw, "subscribers\t%d\n", s.GetSubscribers())
+	fmt.Fprintf(tw, "unacked\t%d\n", s.GetUnacked())
+	fmt.Fprintf(tw, "accepted\t%d\t%.1f/s\n", s.GetAcceptedTotal(), s.GetAcceptRate())
+	fmt.Fprintf(tw, "rejected\t%d\t%.1f/s\n", s.GetRejectedTotal(), s.GetRejectRate())
+	fmt.Fprintf(tw, "delivered\t%d\t%.1f/s\n", s.GetDeliveredTotal(), s.GetDeliverRate())
+	fmt.Fprintf(tw, "backpressure\t%d\n", s.GetBackpressureTotal())
+	if len(s.GetGroups()) > 0 {
+		fmt.Fprintf(tw, "\nGROUP\tSUBSCRIBERS\tBUFFERED\tUNACKED\tLAG\n")
+		for _, g := range s.GetGroups() {
+			group := g.GetGroup()
+			if group == "" {
+				group = "(none)"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", group, g.GetSubscribers(), g.GetBuffered(), g.GetUnacked(), g.GetLag())
+		}
+	}
+	return tw.Flush()
+}
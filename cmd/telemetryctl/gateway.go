@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+// gateway is a client of the API gateway's REST API.
+type gateway struct {
+	base   string
+	apiKey string
+	http   *http.Client
+}
+
+// gatewayFlags adds the flags selecting the gateway to fs.
+func gatewayFlags(fs *flag.FlagSet) func() *gateway {
+	addr := fs.String("gateway", "http://localhost:8080", "API gateway base URL")
+	key := fs.String("api_key", os.Getenv("TELEMETRY_API_KEY"), "API key sent as X-API-Key (default: $TELEMETRY_API_KEY)")
+	return func() *gateway {
+		return &gateway{base: strings.TrimRight(*addr, "/"), apiKey: *key, http: http.DefaultClient}
+	}
+}
+
+// gatewayError is the gateway's JSON error envelope.
+type gatewayError struct {
+	Status    int    `json:"-"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+func (e *gatewayError) Error() string {
+	msg := fmt.Sprintf("gateway: %d %s: %s", e.Status, e.Code, e.Message)
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// open sends a GET for path with query and returns the response of a 2xx
+// status; others are read into a gatewayError.
+func (g *gateway) open(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := g.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if g.apiKey != "" {
+		req.Header.Set("X-API-Key", g.apiKey)
+	}
+	resp, err := g.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	e := &gatewayError{Status: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(body, e) != nil || e.Code == "" {
+		e.Code, e.Message = http.StatusText(resp.StatusCode), strings.TrimSpace(string(body))
+	}
+	return nil, e
+}
+
+// get decodes the JSON response to a GET into out.
+func (g *gateway) get(ctx context.Context, path string, query url.Values, out any) error {
+	resp, err := g.open(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("gateway: decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// tail calls fn with every point of the gateway's live stream until ctx
+// ends, the gateway closes the stream or fn fails.
+func (g *gateway) tail(ctx context.Context, query url.Values, fn func(t model.Telemetry, raw []byte) error) error {
+	resp, err := g.open(ctx, "/api/v1/stream", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 0, 64<<10), 4<<20)
+	event := ""
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			event = ""
+		case strings.HasPrefix(line, ":"):
+			// heartbeat
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data := []byte(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+			switch event {
+			case "overflow":
+				return errors.New("gateway closed the stream: this client fell behind")
+			case "telemetry":
+				var t model.Telemetry
+				if err := json.Unmarshal(data, &t); err != nil {
+					return fmt.Errorf("gateway: decode stream event: %w", err)
+				}
+				if err := fn(t, data); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return errors.New("gateway closed the stream")
+}
+
+func gpus(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("gpus", flag.ExitOnError)
+	gw := gatewayFlags(fs)
+	_ = fs.Parse(args)
+
+	var ids []string
+	if err := gw().get(ctx, "/api/v1/gpus", nil, &ids); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		fmt.Println(id)
+	}
+	return nil
+}
+
+func tail(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	gw := gatewayFlags(fs)
+	gpuIDs := fs.String("gpu", "", "Comma-separated GPU IDs to follow (required)")
+	metrics := fs.String("metrics", "", "Comma-separated metrics to show (default: all)")
+	asJSON := fs.Bool("json", false, "Print each point as a JSON line")
+	_ = fs.Parse(args)
+
+	if *gpuIDs == "" {
+		return fmt.Errorf("-gpu is required")
+	}
+	q := url.Values{"gpu_id": {*gpuIDs}}
+	if *metrics != "" {
+		q.Set("metrics", *metrics)
+	}
+	return gw().tail(ctx, q, func(t model.Telemetry, raw []byte) error {
+		if *asJSON {
+			_, err := fmt.Printf("%s\n", raw)
+			return err
+		}
+		names := metricNames([]model.Telemetry{t})
+		fields := make([]string, 0, len(names))
+		for _, n := range names {
+			fields = append(fields, n+"="+formatValue(t.Metrics[n]))
+		}
+		_, err := fmt.Printf("%s %s %s\n", t.Timestamp.Format(time.RFC3339Nano), t.GPUId, strings.Join(fields, " "))
+		return err
+	})
+}
+
+func query(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	gw := gatewayFlags(fs)
+	gpuIDs := fs.String("gpu", "", "Comma-separated GPU IDs (one GPU or -host is required)")
+	host := fs.String("host", "", "Host ID whose GPUs to query")
+	start := fs.String("start", "-1h", "Start of the window: RFC3339, now, or relative to now such as -1h")
+	end := fs.String("end", "", "End of the window, in the -start forms (default: now)")
+	metrics := fs.String("metrics", "", "Comma-separated metrics to return (default: all)")
+	step := fs.String("step", "", "Downsample to the mean of each metric per bucket of this duration, e.g. 5m")
+	asJSON := fs.Bool("json", false, "Print the gateway's JSON response")
+	_ = fs.Parse(args)
+
+	q := url.Values{"start_time": {*start}}
+	for k, v := range map[string]string{"end_time": *end, "metrics": *metrics, "step": *step} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	path := "/api/v1/telemetry"
+	switch {
+	case *gpuIDs == "" && *host == "":
+		return fmt.Errorf("-gpu or -host is required")
+	case *host == "" && !strings.Contains(*gpuIDs, ","):
+		path = "/api/v1/gpus/" + url.PathEscape(*gpuIDs) + "/telemetry"
+	default:
+		if *gpuIDs != "" {
+			q.Set("gpu_ids", *gpuIDs)
+		}
+		if *host != "" {
+			q.Set("host_id", *host)
+		}
+	}
+	var points []model.Telemetry
+	if err := gw().get(ctx, path, q, &points); err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(points)
+	}
+	names := metricNames(points)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "TIMESTAMP\tGPU\t%s\n", strings.Join(names, "\t"))
+	for _, p := range points {
+		row := []string{p.Timestamp.Format(time.RFC3339), p.GPUId}
+		for _, n := range names {
+			if v, ok := p.Metrics[n]; ok {
+				row = append(row, formatValue(v))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// aggregateResponse is the /api/v1/gpus/{id}/aggregate response.
+type aggregateResponse struct {
+	GPUId       string           `json:"gpu_id"`
+	Metric      string           `json:"metric"`
+	Agg         string           `json:"agg"`
+	StepSeconds float64          `json:"step_seconds"`
+	Start       time.Time        `json:"start"`
+	End         time.Time        `json:"end"`
+	Buckets     []storage.Bucket `json:"buckets"`
+}
+
+func aggregate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	gw := gatewayFlags(fs)
+	gpu := fs.String("gpu", "", "GPU ID (required)")
+	metric := fs.String("metric", "", "Metric to aggregate (required)")
+	agg := fs.String("agg", "avg", "Aggregation per bucket: avg, max, min or last")
+	step := fs.String("step", "1m", "Bucket width")
+	window := fs.String("window", "1h", "Look-back duration ending now")
+	asJSON := fs.Bool("json", false, "Print the gateway's JSON response")
+	_ = fs.Parse(args)
+
+	if *gpu == "" || *metric == "" {
+		return fmt.Errorf("-gpu and -metric are required")
+	}
+	q := url.Values{"metric": {*metric}, "agg": {*agg}, "step": {*step}, "window": {*window}}
+	var resp aggregateResponse
+	if err := gw().get(ctx, "/api/v1/gpus/"+url.PathEscape(*gpu)+"/aggregate", q, &resp); err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(resp)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "TIMESTAMP\t%s(%s)\n", strings.ToUpper(resp.Agg), resp.Metric)
+	for _, b := range resp.Buckets {
+		fmt.Fprintf(tw, "%s\t%s\n", b.Timestamp.Format(time.RFC3339), formatValue(b.Value))
+	}
+	return tw.Flush()
+}
+
+// metricNames returns the sorted names of the metrics of points.
+func metricNames(points []model.Telemetry) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, p := range points {
+		for n := range p.Metrics {
+			if !seen[n] {
+				seen[n] = true
+				names = append(names, n)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatValue(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
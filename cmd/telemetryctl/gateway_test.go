@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gpu-metric-collector/internal/model"
+)
+
+func TestGateway_ErrorEnvelope(t *testing.T) {
+	// Scenario: the gateway answers 404 with its JSON error envelope
+	// Expect: a gatewayError carrying the status, code and request id; the API key is sent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "k" {
+			t.Errorf("X-API-Key = %q", r.Header.Get("X-API-Key"))
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"code":"gpu_not_found","message":"no such GPU","request_id":"r-1"}`)
+	}))
+	defer srv.Close()
+
+	g := &gateway{base: srv.URL, apiKey: "k", http: srv.Client()}
+	var out []model.Telemetry
+	err := g.get(context.Background(), "/api/v1/gpus/9/telemetry", nil, &out)
+	var ge *gatewayError
+	if !errors.As(err, &ge) {
+		t.Fatalf("err = %v, want a gatewayError", err)
+	}
+	if ge.Status != http.StatusNotFound || ge.Code != "gpu_not_found" || ge.RequestID != "r-1" {
+		t.Fatalf("err = %+v", ge)
+	}
+}
+
+func TestGateway_Tail(t *testing.T) {
+	// Scenario: the stream sends a heartbeat, two points and then overflows
+	// Expect: both points are decoded in order; the overflow ends tail with an error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("gpu_id") != "0" {
+			t.Errorf("gpu_id = %q", r.URL.Query().Get("gpu_id"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": ping\n\n")
+		fmt.Fprint(w, "event: telemetry\ndata: {\"gpu_id\":\"0\",\"timestamp\":\"2026-01-01T00:00:00Z\",\"metrics\":{\"t\":60}}\n\n")
+		fmt.Fprint(w, "event: telemetry\ndata: {\"gpu_id\":\"0\",\"timestamp\":\"2026-01-01T00:00:01Z\",\"metrics\":{\"t\":61}}\n\n")
+		fmt.Fprint(w, "event: overflow\ndata: {}\n\n")
+	}))
+	defer srv.Close()
+
+	g := &gateway{base: srv.URL, http: srv.Client()}
+	var got []float64
+	err := g.tail(context.Background(), map[string][]string{"gpu_id": {"0"}}, func(p model.Telemetry, _ []byte) error {
+		got = append(got, p.Metrics["t"])
+		return nil
+	})
+	if err == nil {
+		t.Fatal("tail returned nil after an overflow")
+	}
+	if len(got) != 2 || got[0] != 60 || got[1] != 61 {
+		t.Fatalf("points = %v, want [60 61]", got)
+	}
+}
+
+func TestSampleValue_WithinBounds(t *testing.T) {
+	// Scenario: publish draws values for a bounded catalog metric
+	// Expect: every value is within the catalog's 0-150 C range
+	for i := 0; i < 1000; i++ {
+		if v := sampleValue("DCGM_FI_DEV_GPU_TEMP"); v < 0 || v > 150 {
+			t.Fatalf("sampleValue = %v, want within [0, 150]", v)
+		}
+	}
+}
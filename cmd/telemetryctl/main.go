@@ -0,0 +1,257 @@
+// Command telemetryctl operates a telemetry pipeline from the command line:
+// it reads from the API gateway, talks to the broker and administers
+// telemetry stores offline.
+//
+//	telemetryctl gpus
+//	telemetryctl tail -gpu 0,1 -metrics DCGM_FI_DEV_GPU_TEMP
+//	telemetryctl query -gpu 0 -start -6h -step 5m
+//	telemetryctl aggregate -gpu 0 -metric DCGM_FI_DEV_GPU_TEMP -agg max -step 5m -window 6h
+//	telemetryctl publish -broker 127.0.0.1:9000 -gpu test-0,test-1 -count 10
+//	telemetryctl stats -broker 127.0.0.1:9000
+//	telemetryctl replay -store_uri sqlite:///data/telemetry.db -start 2026-01-26T10:00:00Z -end 2026-01-26T11:00:00Z -speed 60
+//	telemetryctl backup  -store_uri sqlite:///data/telemetry.db -out tel.parquet
+//	telemetryctl restore -store_uri 'influx://influx:8086?org=o&bucket=b&token=t' -in tel.parquet
+//
+// A backup copies a time range of any store into a compressed JSON lines
+// (.jsonl.gz) or Parquet (.parquet) archive; a restore saves an archive into
+// any store, so the pair migrates data between backends.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"gpu-metric-collector/internal/archive"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+const usage = `usage: telemetryctl <command> [flags]
+
+gateway commands:
+  gpus       list the GPUs that have reported telemetry
+  tail       follow the live telemetry of GPUs
+  query      print the telemetry of GPUs over a window
+  aggregate  print one metric of a GPU aggregated per time bucket
+
+broker commands:
+  publish    publish test telemetry to the broker
+  stats      show the broker's queue, subscriber groups and rates
+  replay     republish a window of a store to the broker, paced as recorded
+
+store commands:
+  backup     copy a time range of a store into an archive file
+  restore    save the points of an archive file into a store
+
+Run telemetryctl <command> -h for the command's flags.
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("telemetryctl: ")
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "gpus":
+		err = gpus(ctx, args)
+	case "tail":
+		err = tail(ctx, args)
+	case "query":
+		err = query(ctx, args)
+	case "aggregate":
+		err = aggregate(ctx, args)
+	case "publish":
+		err = publish(ctx, args)
+	case "stats":
+		err = stats(ctx, args)
+	case "replay":
+		err = replay(ctx, args)
+	case "backup":
+		err = backup(args)
+	case "restore":
+		err = restore(args)
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		stop()
+		log.Fatal(err)
+	}
+}
+
+// storeFlags adds the flags selecting a store to fs.
+func storeFlags(fs *flag.FlagSet) (uri, measurement *string) {
+	uri = fs.String("store_uri", "", "Store URI (mem://, sqlite://path, bolt://path, influx[s]://host:port?org=&bucket=&token=, victoria[s]://host:port)")
+	measurement = fs.String("measurement", "", "Measurement to read or write (default: telemetry)")
+	return uri, measurement
+}
+
+func openStore(uri, measurement string) (storage.Store, func(), error) {
+	if uri == "" {
+		return nil, nil, fmt.Errorf("-store_uri is required")
+	}
+	s, err := storage.Open(uri, storage.Options{Measurement: measurement})
+	if err != nil {
+		return nil, nil, err
+	}
+	closer := func() {}
+	if c, ok := s.(interface{ Close() error }); ok {
+		closer = func() {
+			if err := c.Close(); err != nil {
+				log.Printf("close store: %v", err)
+			}
+		}
+	}
+	return s, closer, nil
+}
+
+// parseTime reads an RFC3339 time; empty is nil.
+func parseTime(name, v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return nil, fmt.Errorf("-%s: %w", name, err)
+	}
+	return &t, nil
+}
+
+// archiveFormat is the -format flag's format, or the one path's extension
+// names.
+func archiveFormat(flagValue, path string) (archive.Format, error) {
+	switch archive.Format(flagValue) {
+	case "":
+		return archive.FormatOf(path)
+	case archive.JSONL, archive.Parquet:
+		return archive.Format(flagValue), nil
+	}
+	return "", fmt.Errorf("-format %q: want jsonl or parquet", flagValue)
+}
+
+func backup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	uri, measurement := storeFlags(fs)
+	out := fs.String("out", "", "Archive file to write (.jsonl.gz or .parquet)")
+	format := fs.String("format", "", "Archive format, jsonl or parquet (default: from the -out extension)")
+	startFlag := fs.String("start", "", "Oldest point to copy, RFC3339 (default: each GPU's first)")
+	endFlag := fs.String("end", "", "Newest point to copy, RFC3339 (default: now)")
+	gpus := fs.String("gpus", "", "Comma-separated GPU IDs to copy (default: all)")
+	chunk := fs.Duration("chunk", 24*time.Hour, "Span of a GPU's history read from the store at a time")
+	_ = fs.Parse(args)
+
+	if *out == "" {
+		return fmt.Errorf("-out is required")
+	}
+	f, err := archiveFormat(*format, *out)
+	if err != nil {
+		return err
+	}
+	opts := archive.BackupOptions{Chunk: *chunk}
+	if opts.Start, err = parseTime("start", *startFlag); err != nil {
+		return err
+	}
+	if opts.End, err = parseTime("end", *endFlag); err != nil {
+		return err
+	}
+	if *gpus != "" {
+		opts.GPUs = strings.Split(*gpus, ",")
+	}
+	src, closeStore, err := openStore(*uri, *measurement)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	// write next to the target and rename at the end, so a failed backup
+	// never leaves a truncated archive under the requested name
+	tmp := *out + ".partial"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp) }()
+	w, err := archive.NewWriter(file, f)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	n, err := archive.Backup(src, w, opts)
+	if err == nil {
+		err = w.Close()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	if err := os.Rename(tmp, *out); err != nil {
+		return err
+	}
+	log.Printf("backed up %d points from %s to %s", n, storage.RedactURI(*uri), *out)
+	return nil
+}
+
+func restore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	uri, measurement := storeFlags(fs)
+	in := fs.String("in", "", "Archive file to read (.jsonl.gz or .parquet)")
+	format := fs.String("format", "", "Archive format, jsonl or parquet (default: from the -in extension)")
+	batch := fs.Int("batch", 1000, "Points saved per batch write")
+	_ = fs.Parse(args)
+
+	if *in == "" {
+		return fmt.Errorf("-in is required")
+	}
+	f, err := archiveFormat(*format, *in)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	r, err := archive.NewReader(file, info.Size(), f)
+	if err != nil {
+		return err
+	}
+	dst, closeStore, err := openStore(*uri, *measurement)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	res, err := archive.Restore(dst, r, *batch, func(t model.Telemetry, err error) {
+		log.Printf("rejected %s at %s: %v", t.GPUId, t.Timestamp.Format(time.RFC3339Nano), err)
+	})
+	if err != nil {
+		return fmt.Errorf("restore after %d points: %w", res.Read, err)
+	}
+	log.Printf("restored %d points from %s to %s (%d rejected)", res.Read-res.Failed, *in, storage.RedactURI(*uri), res.Failed)
+	if res.Failed > 0 {
+		return fmt.Errorf("%d points were rejected", res.Failed)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+	"gpu-metric-collector/internal/telemetrypb"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// replayBackoff is the wait before resending what the broker refused with
+// backpressure.
+const replayBackoff = 100 * time.Millisecond
+
+// replayer republishes stored points to the broker.
+type replayer struct {
+	client telemetryv1.TelemetryClient
+	// Speed scales the original spacing of the points: 2 replays an hour in
+	// half an hour. 0 publishes as fast as the broker takes them.
+	speed float64
+	batch int
+	// retime stamps each point with the time it is published, with a new
+	// idempotency key, instead of its original time and key.
+	retime    bool
+	gpuPrefix string
+	producer  string
+
+	id            string // prefix of batch ids and, with retime, keys
+	seq, batches  uint64
+	base          time.Time // timestamp of the first point
+	wallStart     time.Time // when it was published
+	published     int64
+	rejected      int64
+	backpressured int64
+}
+
+// replayOptions selects what to replay.
+type replayOptions struct {
+	GPUs       []string
+	Start, End time.Time
+	Chunk      time.Duration
+}
+
+// Replay reads the points of src in opts' window chunk by chunk, across
+// GPUs in time order, and publishes them paced by their timestamps.
+func (r *replayer) Replay(ctx context.Context, src storage.Store, opts replayOptions) error {
+	chunk := max(opts.Chunk.Truncate(time.Second), time.Second)
+	for a := opts.Start; !a.After(opts.End); a = a.Add(chunk) {
+		from, to := a, a.Add(chunk-time.Nanosecond)
+		if to.After(opts.End) {
+			to = opts.End
+		}
+		items, err := storage.ExecuteFleet(src, opts.GPUs, storage.Query{Start: &from, End: &to})
+		if err != nil {
+			return fmt.Errorf("read %s..%s: %w", from.Format(time.RFC3339), to.Format(time.RFC3339), err)
+		}
+		if err := r.publishPaced(ctx, items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishPaced publishes items, which are in time order, each no earlier
+// than its offset from the first point of the replay divided by the speed.
+// Points due together go out in one batch.
+func (r *replayer) publishPaced(ctx context.Context, items []model.Telemetry) error {
+	var pending []model.Telemetry
+	for _, it := range items {
+		if r.base.IsZero() {
+			r.base, r.wallStart = it.Timestamp, time.Now()
+		}
+		if r.speed > 0 {
+			due := r.wallStart.Add(time.Duration(float64(it.Timestamp.Sub(r.base)) / r.speed))
+			if wait := time.Until(due); wait > 0 {
+				if err := r.flush(ctx, pending); err != nil {
+					return err
+				}
+				pending = pending[:0]
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+		pending = append(pending, it)
+		if len(pending) >= r.batch {
+			if err := r.flush(ctx, pending); err != nil {
+				return err
+			}
+			pending = pending[:0]
+		}
+	}
+	return r.flush(ctx, pending)
+}
+
+// flush publishes items as one batch, resending what the broker refuses
+// with backpressure until it is taken.
+func (r *replayer) flush(ctx context.Context, items []model.Telemetry) error {
+	if len(items) == 0 {
+		return nil
+	}
+	r.batches++
+	batch := &telemetryv1.TelemetryBatch{BatchId: r.id + "-b" + strconv.FormatUint(r.batches, 10)}
+	now := time.Now()
+	for _, it := range items {
+		batch.Items = append(batch.Items, r.toData(it, batch.BatchId, now))
+	}
+	for len(batch.Items) > 0 {
+		resp, err := r.client.PublishBatch(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("publish: %w", err)
+		}
+		r.published += resp.GetAccepted()
+		var resend []*telemetryv1.TelemetryData
+		for _, st := range resp.GetItems() {
+			item := batch.Items[st.GetIndex()]
+			if st.GetStatus() == "BACKPRESSURE" {
+				resend = append(resend, item)
+				continue
+			}
+			r.rejected++
+			log.Printf("rejected %s at %s: %s", item.GetGpuId(), item.GetTs().AsTime().Format(time.RFC3339Nano), st.GetReason())
+		}
+		if len(resend) == 0 {
+			return nil
+		}
+		r.backpressured += int64(len(resend))
+		batch.Items = resend
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(replayBackoff):
+		}
+	}
+	return nil
+}
+
+// toData converts a stored point to its wire form.
+func (r *replayer) toData(it model.Telemetry, batchID string, now time.Time) *telemetryv1.TelemetryData {
+	d := &telemetryv1.TelemetryData{
+		ProducerId:     it.ProducerId,
+		HostId:         it.HostId,
+		GpuId:          r.gpuPrefix + it.GPUId,
+		Ts:             timestamppb.New(it.Timestamp),
+		Metrics:        it.Metrics,
+		Labels:         it.Labels,
+		IdempotencyKey: it.IdempotencyKey,
+		BatchId:        batchID,
+		Values:         telemetrypb.Values(it.Values),
+	}
+	if r.producer != "" {
+		d.ProducerId = r.producer
+	}
+	if r.retime {
+		r.seq++
+		d.Ts = timestamppb.New(now)
+		d.IdempotencyKey = r.id + "-" + strconv.FormatUint(r.seq, 10)
+	}
+	return d
+}
+
+func replay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	uri, measurement := storeFlags(fs)
+	dial := brokerFlags(fs)
+	startFlag := fs.String("start", "", "Oldest point to replay, RFC3339 (required)")
+	endFlag := fs.String("end", "", "Newest point to replay, RFC3339 (default: now)")
+	gpus := fs.String("gpus", "", "Comma-separated GPU IDs to replay (default: all)")
+	speed := fs.Float64("speed", 1, "Pace relative to the original: 1 is real time, 60 replays an hour in a minute, 0 is as fast as the broker takes them")
+	batch := fs.Int("batch", 500, "Most points published per batch")
+	retime := fs.Bool("retime", false, "Stamp points with the time they are published, with new idempotency keys, instead of their original time")
+	gpuPrefix := fs.String("gpu_prefix", "", "Prefix added to replayed GPU IDs, e.g. replay- to keep them apart from live GPUs")
+	producer := fs.String("producer", "", "Producer ID of the replayed points (default: each point's own)")
+	chunk := fs.Duration("chunk", time.Hour, "Span of history read from the store at a time")
+	_ = fs.Parse(args)
+
+	if *speed < 0 {
+		return fmt.Errorf("-speed must not be negative")
+	}
+	if *batch < 1 {
+		return fmt.Errorf("-batch must be at least 1")
+	}
+	start, err := parseTime("start", *startFlag)
+	if err != nil {
+		return err
+	}
+	if start == nil {
+		return fmt.Errorf("-start is required")
+	}
+	end, err := parseTime("end", *endFlag)
+	if err != nil {
+		return err
+	}
+	opts := replayOptions{Start: *start, End: time.Now(), Chunk: *chunk}
+	if end != nil {
+		opts.End = *end
+	}
+	if *gpus != "" {
+		opts.GPUs = strings.Split(*gpus, ",")
+	}
+	src, closeStore, err := openStore(*uri, *measurement)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+	conn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	r := &replayer{
+		client:    telemetryv1.NewTelemetryClient(conn),
+		speed:     *speed,
+		batch:     *batch,
+		retime:    *retime,
+		gpuPrefix: *gpuPrefix,
+		producer:  *producer,
+		id:        fmt.Sprintf("replay-%d", time.Now().UnixNano()),
+	}
+	err = r.Replay(ctx, src, opts)
+	log.Printf("replayed %d points from %s (%d rejected, %d resent after backpressure)", r.published, storage.RedactURI(*uri), r.rejected, r.backpressured)
+	if err != nil {
+		return fmt.Errorf("replay: %w", err)
+	}
+	if r.rejected > 0 {
+		return fmt.Errorf("%d points were rejected", r.rejected)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"google.golang.org/grpc"
+)
+
+// recordingClient records published batches and when they arrived. With
+// backpressure set, the first call refuses every item after the first.
+type recordingClient struct {
+	telemetryv1.TelemetryClient
+	backpressure bool
+	batches      []*telemetryv1.TelemetryBatch
+	at           []time.Time
+}
+
+func (c *recordingClient) PublishBatch(ctx context.Context, b *telemetryv1.TelemetryBatch, _ ...grpc.CallOption) (*telemetryv1.PublishResponse, error) {
+	c.batches = append(c.batches, b)
+	c.at = append(c.at, time.Now())
+	if c.backpressure && len(c.batches) == 1 {
+		resp := &telemetryv1.PublishResponse{Accepted: 1, Status: "BACKPRESSURE"}
+		for i := 1; i < len(b.Items); i++ {
+			resp.Items = append(resp.Items, &telemetryv1.ItemStatus{Index: uint32(i), Status: "BACKPRESSURE"})
+		}
+		return resp, nil
+	}
+	return &telemetryv1.PublishResponse{Accepted: int64(len(b.Items)), Status: "OK"}, nil
+}
+
+func replayStore(t *testing.T, base time.Time) storage.Store {
+	t.Helper()
+	st := storage.NewMemoryStore()
+	for i, p := range []struct {
+		gpu string
+		sec int
+	}{{"0", 0}, {"1", 0}, {"0", 2}, {"1", 4}} {
+		err := st.SaveTelemetry(model.Telemetry{GPUId: p.gpu, Timestamp: base.Add(time.Duration(p.sec) * time.Second), Metrics: map[string]float64{"t": float64(i)}, IdempotencyKey: fmt.Sprintf("k%d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return st
+}
+
+func TestReplay_PacedAcrossGPUs(t *testing.T) {
+	// Scenario: points of two GPUs at 0s, 0s, 2s and 4s replayed at speed 20, in 1s chunks
+	// Expect: three batches in time order, ~100ms and ~200ms apart; original timestamps kept
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &recordingClient{}
+	r := &replayer{client: c, speed: 20, batch: 100, id: "replay-test"}
+	err := r.Replay(context.Background(), replayStore(t, base), replayOptions{Start: base, End: base.Add(10 * time.Second), Chunk: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.batches) != 3 || len(c.batches[0].Items) != 2 || r.published != 4 {
+		t.Fatalf("batches = %d (first %d items), published %d; want 3 batches, 2 items first, 4 published", len(c.batches), len(c.batches[0].Items), r.published)
+	}
+	if gap := c.at[1].Sub(c.at[0]); gap < 80*time.Millisecond || gap > 400*time.Millisecond {
+		t.Errorf("gap between 0s and 2s points = %v, want ~100ms", gap)
+	}
+	if gap := c.at[2].Sub(c.at[0]); gap < 180*time.Millisecond || gap > 600*time.Millisecond {
+		t.Errorf("gap between 0s and 4s points = %v, want ~200ms", gap)
+	}
+	if got := c.batches[2].Items[0]; got.GetGpuId() != "1" || !got.GetTs().AsTime().Equal(base.Add(4*time.Second)) || got.GetIdempotencyKey() != "k3" {
+		t.Errorf("last item = %v, want gpu 1 at its original time and key", got)
+	}
+}
+
+func TestReplay_RetimeAndBackpressure(t *testing.T) {
+	// Scenario: unpaced replay with -retime and -gpu_prefix; the broker refuses all but one item once
+	// Expect: the refused items are resent; every item is stamped at publish time with a new key and the prefix
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &recordingClient{backpressure: true}
+	r := &replayer{client: c, batch: 100, retime: true, gpuPrefix: "replay-", id: "replay-test"}
+	before := time.Now()
+	err := r.Replay(context.Background(), replayStore(t, base), replayOptions{Start: base, End: base.Add(10 * time.Second), Chunk: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.batches) != 2 || len(c.batches[1].Items) != 3 || r.published != 4 || r.backpressured != 3 {
+		t.Fatalf("batches = %d, published %d, backpressured %d; want 2, 4, 3", len(c.batches), r.published, r.backpressured)
+	}
+	for _, it := range c.batches[0].Items {
+		if it.GetTs().AsTime().Before(before) || it.GetIdempotencyKey() == "k0" || it.GetGpuId()[:7] != "replay-" {
+			t.Errorf("item = %v, want retimed with a new key and prefixed GPU", it)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+// Package alert evaluates threshold rules over expr expressions and tracks
+// the alerts they raise. Rules are persisted through a storage.RuleStore.
+package alert
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gpu-metric-collector/internal/expr"
+	"gpu-metric-collector/internal/storage"
+)
+
+// Alert states. A matching series is pending until it has matched for the
+// rule's For duration, then firing; it is dropped once it stops matching.
+const (
+	StatePending = "pending"
+	StateFiring  = "firing"
+)
+
+// Rule raises an alert for every series of Expr whose value compares to
+// Threshold with Op for at least For.
+type Rule struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Expr      string            `json:"expr"`
+	Op        string            `json:"op"`
+	Threshold float64           `json:"threshold"`
+	For       string            `json:"for,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// Owner is the tenant that created the rule; its scope limits what the
+	// rule sees. Empty for fleet-wide rules.
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	expr   expr.Expr
+	forDur time.Duration
+}
+
+// RuleError reports an invalid rule.
+type RuleError struct{ msg string }
+
+func (e *RuleError) Error() string { return e.msg }
+
+var ops = map[string]func(v, t float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+// Validate checks the rule and compiles its expression and duration.
+func (r *Rule) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return &RuleError{"rule needs a name"}
+	}
+	if ops[r.Op] == nil {
+		return &RuleError{fmt.Sprintf("op %q must be one of > >= < <= == !=", r.Op)}
+	}
+	e, err := expr.Parse(r.Expr)
+	if err != nil {
+		return &RuleError{err.Error()}
+	}
+	r.expr = e
+	r.forDur = 0
+	if r.For != "" {
+		d, err := expr.ParseDuration(r.For)
+		if err != nil {
+			return &RuleError{"for: " + err.Error()}
+		}
+		r.forDur = d
+	}
+	return nil
+}
+
+// Alert is one series of a rule that currently matches.
+type Alert struct {
+	RuleID   string            `json:"rule_id"`
+	RuleName string            `json:"rule_name"`
+	Owner    string            `json:"owner,omitempty"`
+	State    string            `json:"state"`
+	Labels   map[string]string `json:"labels"`
+	Value    float64           `json:"value"`
+	ActiveAt time.Time         `json:"active_at"`
+}
+
+// Engine holds the rules and evaluates them against the store.
+type Engine struct {
+	store storage.Store
+	rules storage.RuleStore
+	// scopeFor resolves a rule owner to its scope (nil for the whole
+	// fleet); false means the owner no longer exists.
+	scopeFor func(owner string) (*storage.Scope, bool)
+
+	mu     sync.Mutex
+	byID   map[string]*Rule
+	alerts map[string]map[string]*Alert // rule id -> series key -> alert
+}
+
+// NewEngine loads the persisted rules. scopeFor may be nil when every rule
+// sees the whole fleet.
+func NewEngine(store storage.Store, rules storage.RuleStore, scopeFor func(owner string) (*storage.Scope, bool)) (*Engine, error) {
+	if scopeFor == nil {
+		scopeFor = func(string) (*storage.Scope, bool) { return nil, true }
+	}
+	e := &Engine{store: store, rules: rules, scopeFor: scopeFor, byID: map[string]*Rule{}, alerts: map[string]map[string]*Alert{}}
+	docs, err := rules.ListRules()
+	if err != nil {
+		return nil, fmt.Errorf("load alert rules: %w", err)
+	}
+	for id, doc := range docs {
+		r := &Rule{}
+		if err := json.Unmarshal(doc, r); err != nil {
+			log.Printf("alert: skipping rule %s: %v", id, err)
+			continue
+		}
+		if err := r.Validate(); err != nil {
+			log.Printf("alert: skipping rule %s: %v", id, err)
+			continue
+		}
+		r.ID = id
+		e.byID[id] = r
+	}
+	return e, nil
+}
+
+// Add validates r, assigns it an id and persists it.
+func (e *Engine) Add(r Rule) (Rule, error) {
+	if err := r.Validate(); err != nil {
+		return Rule{}, err
+	}
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return Rule{}, fmt.Errorf("rule id: %w", err)
+	}
+	r.ID = hex.EncodeToString(b[:])
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now().UTC()
+	}
+	doc, err := json.Marshal(r)
+	if err != nil {
+		return Rule{}, err
+	}
+	if err := e.rules.SaveRule(r.ID, doc); err != nil {
+		return Rule{}, err
+	}
+	e.mu.Lock()
+	e.byID[r.ID] = &r
+	e.mu.Unlock()
+	return r, nil
+}
+
+// Delete removes a rule and its alerts, reporting whether it existed.
+func (e *Engine) Delete(id string) (bool, error) {
+	ok, err := e.rules.DeleteRule(id)
+	if err != nil {
+		return false, err
+	}
+	e.mu.Lock()
+	_, known := e.byID[id]
+	delete(e.byID, id)
+	delete(e.alerts, id)
+	e.mu.Unlock()
+	return ok || known, nil
+}
+
+// Rule returns the rule with the given id.
+func (e *Engine) Rule(id string) (Rule, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r, ok := e.byID[id]
+	if !ok {
+		return Rule{}, false
+	}
+	return *r, true
+}
+
+// Rules returns every rule, oldest first.
+func (e *Engine) Rules() []Rule {
+	e.mu.Lock()
+	out := make([]Rule, 0, len(e.byID))
+	for _, r := range e.byID {
+		out = append(out, *r)
+	}
+	e.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Alerts returns the active alerts, ordered by rule name then labels.
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	var out []Alert
+	for _, series := range e.alerts {
+		for _, a := range series {
+			out = append(out, *a)
+		}
+	}
+	e.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].RuleName != out[j].RuleName {
+			return out[i].RuleName < out[j].RuleName
+		}
+		if out[i].RuleID != out[j].RuleID {
+			return out[i].RuleID < out[j].RuleID
+		}
+		return seriesKey(out[i].Labels) < seriesKey(out[j].Labels)
+	})
+	return out
+}
+
+// Run evaluates every interval until ctx is done.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			e.Evaluate(now)
+		}
+	}
+}
+
+// Evaluate runs every rule at t. A rule that fails to evaluate keeps its
+// previous alerts, so a store outage does not resolve them.
+func (e *Engine) Evaluate(t time.Time) {
+	e.mu.Lock()
+	rules := make([]*Rule, 0, len(e.byID))
+	for _, r := range e.byID {
+		rules = append(rules, r)
+	}
+	e.mu.Unlock()
+
+	for _, r := range rules {
+		matches, err := e.evalRule(r, t)
+		if err != nil {
+			log.Printf("alert: rule %s (%s): %v", r.ID, r.Name, err)
+			continue
+		}
+		e.mu.Lock()
+		if _, ok := e.byID[r.ID]; ok { // not deleted meanwhile
+			e.alerts[r.ID] = e.advance(r, e.alerts[r.ID], matches, t)
+		}
+		e.mu.Unlock()
+	}
+}
+
+// evalRule returns the samples of r's expression that satisfy its condition.
+func (e *Engine) evalRule(r *Rule, t time.Time) ([]expr.Sample, error) {
+	store := e.store
+	sc, ok := e.scopeFor(r.Owner)
+	if !ok {
+		return nil, nil // owner removed: the rule sees nothing
+	}
+	if sc != nil {
+		store = storage.Scoped(store, *sc)
+	}
+	res, err := expr.Eval(r.expr, expr.StoreSource(store), t)
+	if err != nil {
+		return nil, err
+	}
+	samples := res.Vector
+	if res.IsScalar {
+		samples = []expr.Sample{{Labels: map[string]string{}, Value: res.Scalar}}
+	}
+	var out []expr.Sample
+	for _, s := range samples {
+		if ops[r.Op](s.Value, r.Threshold) {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// advance moves prev to the state at t given the currently matching samples.
+func (e *Engine) advance(r *Rule, prev map[string]*Alert, matches []expr.Sample, t time.Time) map[string]*Alert {
+	next := make(map[string]*Alert, len(matches))
+	for _, s := range matches {
+		labels := make(map[string]string, len(s.Labels)+len(r.Labels))
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		for k, v := range r.Labels {
+			labels[k] = v
+		}
+		key := seriesKey(s.Labels)
+		a := prev[key]
+		if a == nil {
+			a = &Alert{RuleID: r.ID, RuleName: r.Name, Owner: r.Owner, State: StatePending, ActiveAt: t}
+		}
+		a.Labels = labels
+		a.Value = s.Value
+		if t.Sub(a.ActiveAt) >= r.forDur {
+			a.State = StateFiring
+		}
+		next[key] = a
+	}
+	return next
+}
+
+func seriesKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(0)
+		b.WriteString(labels[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
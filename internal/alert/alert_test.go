@@ -0,0 +1,87 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestEngine_PendingFiringResolved(t *testing.T) {
+	// Scenario: a rule "temp > 80 for 2m" over two GPUs, only one of which
+	// runs hot, evaluated once a minute.
+	// Expect: pending, then firing after 2m, then gone once it cools; the
+	// rule survives a restart through the store.
+	mem := storage.NewMemoryStore()
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	save := func(ts time.Time, hot float64) {
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: ts, Metrics: map[string]float64{"temp": hot}})
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", HostId: "h2", Timestamp: ts, Metrics: map[string]float64{"temp": 60}})
+	}
+	eng, err := NewEngine(mem, mem, nil)
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	if _, err := eng.Add(Rule{Name: "hot", Expr: "temp", Op: ">", Threshold: 80, For: "2m", Labels: map[string]string{"severity": "page"}}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if _, err := eng.Add(Rule{Name: "bad", Expr: "temp[5m]", Op: ">"}); err == nil {
+		t.Fatalf("expected invalid rule to be rejected")
+	}
+
+	states := []string{}
+	for i, v := range []float64{90, 91, 92, 70} {
+		ts := base.Add(time.Duration(i) * time.Minute)
+		save(ts, v)
+		eng.Evaluate(ts)
+		alerts := eng.Alerts()
+		if len(alerts) == 0 {
+			states = append(states, "none")
+			continue
+		}
+		a := alerts[0]
+		if len(alerts) != 1 || a.Labels["gpu_id"] != "gpu-1" || a.Labels["severity"] != "page" || a.Value != v {
+			t.Fatalf("step %d: unexpected alerts %+v", i, alerts)
+		}
+		states = append(states, a.State)
+	}
+	if got := states; got[0] != StatePending || got[1] != StatePending || got[2] != StateFiring || got[3] != "none" {
+		t.Fatalf("unexpected states %v", got)
+	}
+
+	reloaded, err := NewEngine(mem, mem, nil)
+	if err != nil || len(reloaded.Rules()) != 1 || reloaded.Rules()[0].Name != "hot" {
+		t.Fatalf("rules not reloaded: %+v %v", reloaded.Rules(), err)
+	}
+	id := reloaded.Rules()[0].ID
+	if ok, err := reloaded.Delete(id); !ok || err != nil {
+		t.Fatalf("delete: %v %v", ok, err)
+	}
+	if rules, _ := mem.ListRules(); len(rules) != 0 {
+		t.Fatalf("rule still persisted: %v", rules)
+	}
+}
+
+func TestEngine_OwnerScope(t *testing.T) {
+	// Scenario: a tenant's rule matches every GPU, but the tenant only sees h1.
+	// Expect: alerts only for the GPU on h1.
+	mem := storage.NewMemoryStore()
+	now := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: now, Metrics: map[string]float64{"temp": 90}})
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", HostId: "h2", Timestamp: now, Metrics: map[string]float64{"temp": 90}})
+	eng, _ := NewEngine(mem, mem, func(owner string) (*storage.Scope, bool) {
+		if owner == "ml" {
+			return &storage.Scope{HostIDs: []string{"h1"}}, true
+		}
+		return nil, owner == ""
+	})
+	if _, err := eng.Add(Rule{Name: "hot", Expr: "temp", Op: ">=", Threshold: 90, Owner: "ml"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	eng.Evaluate(now)
+	alerts := eng.Alerts()
+	if len(alerts) != 1 || alerts[0].Labels["gpu_id"] != "gpu-1" || alerts[0].State != StateFiring {
+		t.Fatalf("unexpected alerts %+v", alerts)
+	}
+}
@@ -0,0 +1,101 @@
+package anomaly
+
+import (
+	"math"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// Config tunes the detector.
+type Config struct {
+	// Alpha is the EWMA smoothing factor in (0, 1]; larger adapts faster.
+	Alpha float64
+	// Threshold is the absolute z-score at or above which a sample is an anomaly.
+	Threshold float64
+	// Warmup is the number of samples per series observed before flagging.
+	Warmup int
+}
+
+// Event describes one anomalous sample.
+type Event struct {
+	GPUId     string
+	Metric    string
+	Timestamp time.Time
+	Value     float64
+	Mean      float64
+	StdDev    float64
+	Z         float64
+}
+
+// Direction is "high" for values above the running mean and "low" otherwise.
+func (e Event) Direction() string {
+	if e.Z >= 0 {
+		return "high"
+	}
+	return "low"
+}
+
+// Telemetry renders the event as a telemetry point so it can be written with any Store:
+// the metric name and direction become labels, the statistics become metrics.
+func (e Event) Telemetry() model.Telemetry {
+	return model.Telemetry{
+		GPUId:     e.GPUId,
+		Timestamp: e.Timestamp,
+		Metrics:   map[string]float64{"value": e.Value, "mean": e.Mean, "stddev": e.StdDev, "zscore": e.Z},
+		Labels:    map[string]string{"metric": e.Metric, "direction": e.Direction()},
+	}
+}
+
+type key struct {
+	gpuID  string
+	metric string
+}
+
+type series struct {
+	mean, variance float64
+	n              int
+}
+
+// Detector keeps an exponentially weighted mean and variance per (gpu_id, metric)
+// and flags samples whose z-score against the prior estimate exceeds the threshold.
+// It is not safe for concurrent use.
+type Detector struct {
+	cfg    Config
+	series map[key]*series
+}
+
+func NewDetector(cfg Config) *Detector {
+	if cfg.Alpha <= 0 || cfg.Alpha > 1 {
+		cfg.Alpha = 0.1
+	}
+	return &Detector{cfg: cfg, series: make(map[key]*series)}
+}
+
+// Observe updates the per-series statistics with t and returns any anomalies it contains.
+func (d *Detector) Observe(t model.Telemetry) []Event {
+	var out []Event
+	for name, v := range t.Metrics {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		k := key{gpuID: t.GPUId, metric: name}
+		s := d.series[k]
+		if s == nil {
+			d.series[k] = &series{mean: v, n: 1}
+			continue
+		}
+		std := math.Sqrt(s.variance)
+		if s.n >= d.cfg.Warmup && std > 0 {
+			z := (v - s.mean) / std
+			if math.Abs(z) >= d.cfg.Threshold {
+				out = append(out, Event{GPUId: t.GPUId, Metric: name, Timestamp: t.Timestamp, Value: v, Mean: s.mean, StdDev: std, Z: z})
+			}
+		}
+		diff := v - s.mean
+		s.mean += d.cfg.Alpha * diff
+		s.variance = (1 - d.cfg.Alpha) * (s.variance + d.cfg.Alpha*diff*diff)
+		s.n++
+	}
+	return out
+}
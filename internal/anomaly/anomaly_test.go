@@ -0,0 +1,50 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+func TestDetector_FlagsPowerDrop(t *testing.T) {
+	d := NewDetector(Config{Alpha: 0.2, Threshold: 4, Warmup: 10})
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 50; i++ {
+		v := 300.0 + float64(i%3) // stable power with small jitter
+		if ev := d.Observe(model.Telemetry{GPUId: "g1", Timestamp: base.Add(time.Duration(i) * time.Second), Metrics: map[string]float64{"power": v}}); len(ev) != 0 {
+			t.Fatalf("unexpected anomaly at %d: %#v", i, ev)
+		}
+	}
+	ev := d.Observe(model.Telemetry{GPUId: "g1", Timestamp: base.Add(time.Minute), Metrics: map[string]float64{"power": 50}})
+	if len(ev) != 1 {
+		t.Fatalf("expected 1 anomaly, got %d", len(ev))
+	}
+	if ev[0].Metric != "power" || ev[0].Direction() != "low" || ev[0].Z > -4 {
+		t.Fatalf("unexpected event: %#v", ev[0])
+	}
+	tel := ev[0].Telemetry()
+	if tel.Labels["metric"] != "power" || tel.Labels["direction"] != "low" || tel.Metrics["value"] != 50 {
+		t.Fatalf("unexpected telemetry rendering: %#v", tel)
+	}
+}
+
+func TestDetector_Warmup(t *testing.T) {
+	d := NewDetector(Config{Alpha: 0.5, Threshold: 1, Warmup: 100})
+	for i, v := range []float64{10, 11, 10, 500} {
+		if ev := d.Observe(model.Telemetry{GPUId: "g1", Metrics: map[string]float64{"temp": v}}); len(ev) != 0 {
+			t.Fatalf("no anomalies expected during warmup (sample %d)", i)
+		}
+	}
+}
+
+func TestDetector_SeriesAreIndependent(t *testing.T) {
+	d := NewDetector(Config{Alpha: 0.2, Threshold: 4, Warmup: 5})
+	for i := 0; i < 20; i++ {
+		d.Observe(model.Telemetry{GPUId: "g1", Metrics: map[string]float64{"temp": 60 + float64(i%2)}})
+	}
+	// first sample for a new gpu never flags
+	if ev := d.Observe(model.Telemetry{GPUId: "g2", Metrics: map[string]float64{"temp": 120}}); len(ev) != 0 {
+		t.Fatalf("new series must not flag: %#v", ev)
+	}
+}
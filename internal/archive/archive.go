@@ -0,0 +1,243 @@
+// Package archive copies telemetry between a store and a portable file, for
+// backups and for migrating between backends: gzip-compressed JSON lines, or
+// Parquet with one row per point.
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+)
+
+// Format is the encoding of an archive.
+type Format string
+
+const (
+	// JSONL is a gzip-compressed header line, then one Point per line.
+	JSONL Format = "jsonl"
+	// Parquet is a zstd-compressed Parquet file of Points.
+	Parquet Format = "parquet"
+)
+
+// Version is the archive layout written; readers reject newer ones.
+const Version = 1
+
+// archiveName marks a file as an archive: the JSONL header's "archive" and
+// the Parquet metadata key holding the version.
+const archiveName = "gpu-telemetry-archive"
+
+// FormatOf picks the format from a file name: .parquet, or .jsonl.gz (and
+// .jsonl, .gz) for JSONL.
+func FormatOf(path string) (Format, error) {
+	switch {
+	case strings.HasSuffix(path, ".parquet"):
+		return Parquet, nil
+	case strings.HasSuffix(path, ".jsonl.gz"), strings.HasSuffix(path, ".jsonl"), strings.HasSuffix(path, ".gz"):
+		return JSONL, nil
+	}
+	return "", fmt.Errorf("archive %s: unknown format (want a .jsonl.gz or .parquet name)", path)
+}
+
+// Point is one archived point, a model.Telemetry as stored.
+type Point struct {
+	GPUId      string             `json:"gpu_id" parquet:"gpu_id"`
+	HostId     string             `json:"host_id,omitempty" parquet:"host_id"`
+	ProducerId string             `json:"producer_id,omitempty" parquet:"producer_id"`
+	Timestamp  time.Time          `json:"timestamp" parquet:"timestamp,timestamp(nanosecond)"`
+	Metrics    map[string]float64 `json:"metrics" parquet:"metrics"`
+	Labels     map[string]string  `json:"labels,omitempty" parquet:"labels"`
+	// Values holds each typed value's JSON, e.g. "P0" quoted or true.
+	Values map[string]string `json:"values,omitempty" parquet:"values"`
+}
+
+// FromTelemetry returns t as an archived point.
+func FromTelemetry(t model.Telemetry) Point {
+	p := Point{GPUId: t.GPUId, HostId: t.HostId, ProducerId: t.ProducerId, Timestamp: t.Timestamp.UTC(),
+		Metrics: t.Metrics, Labels: t.Labels}
+	for k, v := range t.Values {
+		b, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		if p.Values == nil {
+			p.Values = make(map[string]string, len(t.Values))
+		}
+		p.Values[k] = string(b)
+	}
+	return p
+}
+
+// Telemetry returns p as a point to store. Values that do not decode are
+// left out.
+func (p Point) Telemetry() model.Telemetry {
+	var labels map[string]string
+	if len(p.Labels) > 0 {
+		labels = p.Labels
+	}
+	t := model.Telemetry{GPUId: p.GPUId, HostId: p.HostId, ProducerId: p.ProducerId, Timestamp: p.Timestamp,
+		Metrics: p.Metrics, Labels: labels}
+	for k, raw := range p.Values {
+		var v model.Value
+		if json.Unmarshal([]byte(raw), &v) != nil {
+			continue
+		}
+		if t.Values == nil {
+			t.Values = make(map[string]model.Value, len(p.Values))
+		}
+		t.Values[k] = v
+	}
+	return t
+}
+
+// header is the first line of a JSONL archive.
+type header struct {
+	Archive string `json:"archive"`
+	Version int    `json:"version"`
+}
+
+// Writer appends points to an archive; Close completes it.
+type Writer interface {
+	Write(t model.Telemetry) error
+	Close() error
+}
+
+// NewWriter starts an archive of format on w. Closing the Writer does not
+// close w.
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	switch format {
+	case JSONL:
+		zw := gzip.NewWriter(w)
+		bw := bufio.NewWriter(zw)
+		jw := &jsonlWriter{zw: zw, bw: bw, enc: json.NewEncoder(bw)}
+		if err := jw.enc.Encode(header{Archive: archiveName, Version: Version}); err != nil {
+			return nil, err
+		}
+		return jw, nil
+	case Parquet:
+		pw := parquet.NewGenericWriter[Point](w, parquet.Compression(&zstd.Codec{}),
+			parquet.KeyValueMetadata(archiveName, fmt.Sprint(Version)))
+		return &parquetWriter{pw: pw}, nil
+	}
+	return nil, fmt.Errorf("unknown archive format %q", format)
+}
+
+type jsonlWriter struct {
+	zw  *gzip.Writer
+	bw  *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *jsonlWriter) Write(t model.Telemetry) error { return w.enc.Encode(FromTelemetry(t)) }
+
+func (w *jsonlWriter) Close() error {
+	if err := w.bw.Flush(); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+// parquetRowGroup is how many points a Parquet row group holds.
+const parquetRowGroup = 100000
+
+type parquetWriter struct {
+	pw *parquet.GenericWriter[Point]
+	n  int
+}
+
+func (w *parquetWriter) Write(t model.Telemetry) error {
+	if _, err := w.pw.Write([]Point{FromTelemetry(t)}); err != nil {
+		return err
+	}
+	if w.n++; w.n%parquetRowGroup == 0 {
+		return w.pw.Flush()
+	}
+	return nil
+}
+
+func (w *parquetWriter) Close() error { return w.pw.Close() }
+
+// Reader returns an archive's points in order; Read returns io.EOF after
+// the last.
+type Reader interface {
+	Read() (model.Telemetry, error)
+}
+
+// NewReader opens an archive of format in r, of size bytes; JSONL only
+// reads r sequentially.
+func NewReader(r io.ReaderAt, size int64, format Format) (Reader, error) {
+	switch format {
+	case JSONL:
+		zr, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, fmt.Errorf("archive: %w", err)
+		}
+		dec := json.NewDecoder(bufio.NewReader(zr))
+		var h header
+		if err := dec.Decode(&h); err != nil || h.Archive != archiveName {
+			return nil, fmt.Errorf("archive: not a telemetry archive")
+		}
+		if h.Version > Version {
+			return nil, fmt.Errorf("archive: version %d is newer than this tool's %d", h.Version, Version)
+		}
+		return &jsonlReader{dec: dec}, nil
+	case Parquet:
+		f, err := parquet.OpenFile(r, size)
+		if err != nil {
+			return nil, fmt.Errorf("archive: %w", err)
+		}
+		v, ok := f.Lookup(archiveName)
+		if !ok {
+			return nil, fmt.Errorf("archive: not a telemetry archive")
+		}
+		if v != fmt.Sprint(Version) {
+			return nil, fmt.Errorf("archive: unsupported version %s", v)
+		}
+		return &parquetReader{pr: parquet.NewGenericReader[Point](f), buf: make([]Point, 1024)}, nil
+	}
+	return nil, fmt.Errorf("unknown archive format %q", format)
+}
+
+type jsonlReader struct{ dec *json.Decoder }
+
+func (r *jsonlReader) Read() (model.Telemetry, error) {
+	var p Point
+	if err := r.dec.Decode(&p); err != nil {
+		if errors.Is(err, io.EOF) {
+			return model.Telemetry{}, io.EOF
+		}
+		return model.Telemetry{}, fmt.Errorf("archive: %w", err)
+	}
+	return p.Telemetry(), nil
+}
+
+type parquetReader struct {
+	pr   *parquet.GenericReader[Point]
+	buf  []Point
+	next []Point
+}
+
+func (r *parquetReader) Read() (model.Telemetry, error) {
+	for len(r.next) == 0 {
+		n, err := r.pr.Read(r.buf)
+		r.next = r.buf[:n]
+		if n == 0 && err != nil {
+			if errors.Is(err, io.EOF) {
+				return model.Telemetry{}, io.EOF
+			}
+			return model.Telemetry{}, fmt.Errorf("archive: %w", err)
+		}
+	}
+	p := r.next[0]
+	r.next = r.next[1:]
+	return p.Telemetry(), nil
+}
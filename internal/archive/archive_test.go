@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestBackupRestore_RoundTrip(t *testing.T) {
+	// Scenario: two GPUs, one with points across several chunks, backed up
+	// over a window in each format and restored into an empty store twice
+	// Expect: the store holds exactly the points in the window, with host,
+	// producer, labels, exact values and typed values; the second restore
+	// adds nothing
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	src := storage.NewMemoryStore()
+	var want []model.Telemetry
+	for i := 0; i < 10; i++ {
+		p := model.Telemetry{GPUId: "g1", HostId: "h1", ProducerId: "p1", Timestamp: t0.Add(time.Duration(i) * time.Hour),
+			Metrics: map[string]float64{"temp": 60.123456789012345 + float64(i)}, Labels: map[string]string{"rack": "r1"},
+			Values: map[string]model.Value{"pstate": model.StringValue("P0"), "serial": model.IntValue(1<<60 + int64(i)), "ecc": model.BoolValue(i%2 == 0)}}
+		if err := src.SaveTelemetry(p); err != nil {
+			t.Fatal(err)
+		}
+		if i >= 2 {
+			want = append(want, p)
+		}
+	}
+	late := model.Telemetry{GPUId: "g2", Timestamp: t0.Add(5 * time.Hour), Metrics: map[string]float64{"util": 1}}
+	_ = src.SaveTelemetry(late)
+	_ = src.SaveTelemetry(model.Telemetry{GPUId: "g2", Timestamp: t0.Add(-time.Hour), Metrics: map[string]float64{"util": 0}})
+	start := t0.Add(2 * time.Hour)
+
+	for _, f := range []Format{JSONL, Parquet} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := Backup(src, w, BackupOptions{Start: &start, Chunk: 3 * time.Hour})
+		if err != nil || n != int64(len(want)+1) {
+			t.Fatalf("%s backup: %v %d", f, err, n)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		dst := storage.NewMemoryStore()
+		for run := 0; run < 2; run++ {
+			r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), f)
+			if err != nil {
+				t.Fatalf("%s open: %v", f, err)
+			}
+			if res, err := Restore(dst, r, 4, nil); err != nil || res.Read != n || res.Failed != 0 {
+				t.Fatalf("%s restore: %v %+v", f, err, res)
+			}
+		}
+		got, _ := dst.QueryTelemetry("g1", nil, nil)
+		if len(got) != len(want) {
+			t.Fatalf("%s: %d points, want %d", f, len(got), len(want))
+		}
+		for i := range want {
+			g, w := got[i], want[i]
+			if !g.Timestamp.Equal(w.Timestamp) || g.HostId != w.HostId || g.ProducerId != w.ProducerId ||
+				!reflect.DeepEqual(g.Metrics, w.Metrics) || !reflect.DeepEqual(g.Labels, w.Labels) || !reflect.DeepEqual(g.Values, w.Values) {
+				t.Fatalf("%s point %d: %+v, want %+v", f, i, g, w)
+			}
+		}
+		if g2, _ := dst.QueryTelemetry("g2", nil, nil); len(g2) != 1 || !g2[0].Timestamp.Equal(late.Timestamp) {
+			t.Fatalf("%s g2: %+v", f, g2)
+		}
+	}
+}
+
+func TestNewReader_RejectsOtherFiles(t *testing.T) {
+	for _, f := range []Format{JSONL, Parquet} {
+		b := []byte("gpu_id,temp\ng1,1\n")
+		if _, err := NewReader(bytes.NewReader(b), int64(len(b)), f); err == nil {
+			t.Fatalf("%s: expected an error", f)
+		}
+	}
+	if f, err := FormatOf("backup.jsonl.gz"); err != nil || f != JSONL {
+		t.Fatalf("jsonl: %v %s", err, f)
+	}
+	if _, err := FormatOf("backup.csv"); err == nil {
+		t.Fatal("expected an error for an unknown extension")
+	}
+}
@@ -0,0 +1,139 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+// BackupOptions selects what Backup copies.
+type BackupOptions struct {
+	// Start and End bound the points copied, both inclusive; a nil Start
+	// begins at each GPU's oldest point and a nil End at the time of the
+	// backup.
+	Start, End *time.Time
+	// GPUs limits the backup to these GPUs; empty copies every GPU.
+	GPUs []string
+	// Chunk is the span read from the store at a time, 24h when zero; it
+	// bounds the memory a GPU with a long history needs.
+	Chunk time.Duration
+}
+
+// Backup writes the points of src selected by opts to w, GPU by GPU in time
+// order, and returns how many it wrote.
+func Backup(src storage.Store, w Writer, opts BackupOptions) (int64, error) {
+	chunk := opts.Chunk
+	if chunk <= 0 {
+		chunk = 24 * time.Hour
+	}
+	// whole seconds, so a chunk boundary never splits a point in a store
+	// keeping seconds
+	chunk = max(chunk.Truncate(time.Second), time.Second)
+	end := time.Now()
+	if opts.End != nil {
+		end = *opts.End
+	}
+	gpus := opts.GPUs
+	if len(gpus) == 0 {
+		var err error
+		if gpus, err = src.ListGPUs(); err != nil {
+			return 0, fmt.Errorf("list gpus: %w", err)
+		}
+	}
+	var n int64
+	for _, gpu := range gpus {
+		var start time.Time
+		if opts.Start != nil {
+			start = *opts.Start
+		} else {
+			first, err := storage.Execute(src, gpu, storage.Query{End: &end, Limit: 1})
+			if err != nil {
+				return n, fmt.Errorf("gpu %s: %w", gpu, err)
+			}
+			if len(first) == 0 {
+				continue
+			}
+			start = first[0].Timestamp
+		}
+		for a := start.Truncate(time.Second); !a.After(end); a = a.Add(chunk) {
+			from, to := a, a.Add(chunk-time.Nanosecond)
+			if from.Before(start) {
+				from = start
+			}
+			if to.After(end) {
+				to = end
+			}
+			items, err := storage.Execute(src, gpu, storage.Query{Start: &from, End: &to})
+			if err != nil {
+				return n, fmt.Errorf("gpu %s: %w", gpu, err)
+			}
+			for _, t := range items {
+				if err := w.Write(t); err != nil {
+					return n, fmt.Errorf("write archive: %w", err)
+				}
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+// RestoreResult counts what Restore did.
+type RestoreResult struct {
+	// Read is the number of points in the archive, Failed those the store
+	// rejected.
+	Read, Failed int64
+}
+
+// Restore saves the points of r into dst in batches of batch (1000 when not
+// positive). Each point is keyed by its GPU, host, producer and timestamp,
+// so a store that skips duplicate keys keeps one copy when a restore is run
+// again. Points the store rejects are counted, not fatal; onFail, if set, is
+// told of each.
+func Restore(dst storage.Store, r Reader, batch int, onFail func(model.Telemetry, error)) (RestoreResult, error) {
+	if batch <= 0 {
+		batch = 1000
+	}
+	var res RestoreResult
+	buf := make([]model.Telemetry, 0, batch)
+	flush := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+		err := dst.SaveTelemetryBatch(buf)
+		if _, partial := err.(*storage.BatchError); err != nil && !partial {
+			// the store itself failed, e.g. it is down: stop rather than
+			// count the rest of the archive as rejected
+			return fmt.Errorf("save: %w", err)
+		}
+		for i, ferr := range storage.FailedItems(err, len(buf)) {
+			res.Failed++
+			if onFail != nil {
+				onFail(buf[i], ferr)
+			}
+		}
+		buf = buf[:0]
+		return nil
+	}
+	for {
+		t, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return res, err
+		}
+		res.Read++
+		t.IdempotencyKey = fmt.Sprintf("restore:%s:%s:%s:%d", t.GPUId, t.HostId, t.ProducerId, t.Timestamp.UnixNano())
+		if buf = append(buf, t); len(buf) == batch {
+			if err := flush(); err != nil {
+				return res, err
+			}
+		}
+	}
+	return res, flush()
+}
@@ -4,17 +4,33 @@ import (
     "context"
     "errors"
     "log"
+    "strings"
     "sync"
+    "sync/atomic"
     "time"
 
     telemetryv1 "gpu-metric-collector/api/gen"
+    "gpu-metric-collector/internal/shard"
 
     "github.com/prometheus/client_golang/prometheus"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
 )
 
 type subscriber struct {
-    id string
-    ch chan *telemetryv1.TelemetryData
+    id    string
+    group string
+    ch    chan *telemetryv1.TelemetryData
+    // shard/shards select the GPUs this subscriber receives; shards 0 takes all
+    shard  uint32
+    shards uint32
+}
+
+// pendingAck is a message delivered on a manual_ack subscription and not yet acked.
+type pendingAck struct {
+    msg      *telemetryv1.TelemetryData
+    subID    string
+    deadline time.Time
 }
 
 type Server struct {
@@ -26,6 +42,16 @@ type Server struct {
     inbound  chan *telemetryv1.TelemetryData
     queueCap int
     subBuf   int
+
+    offset     atomic.Uint64
+    ackMu      sync.Mutex
+    pending    map[uint64]*pendingAck
+    ackTimeout time.Duration
+
+    inventory inventory
+    sequences sequences
+    counts    counts
+    rates     rates
 }
 
 var (
@@ -65,19 +91,68 @@ var (
         Name:      "queue_depth",
         Help:      "Current depth of the inbound queue.",
     })
+    metricAcked = prometheus.NewCounter(prometheus.CounterOpts{
+        Namespace: "gpu_telemetry",
+        Subsystem: "broker",
+        Name:      "messages_acked_total",
+        Help:      "Total messages acknowledged by manual-ack subscribers.",
+    })
+    metricRedelivered = prometheus.NewCounter(prometheus.CounterOpts{
+        Namespace: "gpu_telemetry",
+        Subsystem: "broker",
+        Name:      "messages_redelivered_total",
+        Help:      "Total unacked messages requeued after ack timeout or subscriber loss.",
+    })
+    metricUnacked = prometheus.NewGauge(prometheus.GaugeOpts{
+        Namespace: "gpu_telemetry",
+        Subsystem: "broker",
+        Name:      "unacked",
+        Help:      "Messages delivered to manual-ack subscribers and awaiting ack.",
+    })
+    metricUnrouted = prometheus.NewCounter(prometheus.CounterOpts{
+        Namespace: "gpu_telemetry",
+        Subsystem: "broker",
+        Name:      "messages_unrouted_total",
+        Help:      "Times a message was parked because no subscriber owns its GPU's shard.",
+    })
+    metricGPUsRegistered = prometheus.NewGauge(prometheus.GaugeOpts{
+        Namespace: "gpu_telemetry",
+        Subsystem: "broker",
+        Name:      "gpus_registered",
+        Help:      "GPUs whose static info streamers have registered.",
+    })
+    metricRejected = prometheus.NewCounter(prometheus.CounterOpts{
+        Namespace: "gpu_telemetry",
+        Subsystem: "broker",
+        Name:      "messages_rejected_total",
+        Help:      "Published items rejected as invalid.",
+    })
+    metricGaps = prometheus.NewCounter(prometheus.CounterOpts{
+        Namespace: "gpu_telemetry",
+        Subsystem: "broker",
+        Name:      "gaps_detected_total",
+        Help:      "Times a producer's accepted items skipped sequence numbers.",
+    })
 )
 
 func init() {
-    prometheus.MustRegister(metricEnqueued, metricDelivered, metricBackpressure, metricRequeued, metricSubscribers, metricQueueDepth)
+    prometheus.MustRegister(metricEnqueued, metricDelivered, metricBackpressure, metricRequeued, metricSubscribers, metricQueueDepth, metricAcked, metricRedelivered, metricUnacked, metricUnrouted, metricGPUsRegistered, metricRejected, metricGaps)
 }
 
+// DefaultAckTimeout is how long a manual-ack message may stay unacked before redelivery.
+const DefaultAckTimeout = 30 * time.Second
+
 func NewServer(queueCap, subBuf int) *Server {
     s := &Server{
-        inbound:  make(chan *telemetryv1.TelemetryData, queueCap),
-        queueCap: queueCap,
-        subBuf:   subBuf,
+        inbound:    make(chan *telemetryv1.TelemetryData, queueCap),
+        queueCap:   queueCap,
+        subBuf:     subBuf,
+        pending:    make(map[uint64]*pendingAck),
+        ackTimeout: DefaultAckTimeout,
     }
     go s.dispatcher()
+    go s.redeliverExpired()
+    go s.sampleRates()
     // queue depth sampler
     go func() {
         ticker := time.NewTicker(200 * time.Millisecond)
@@ -89,38 +164,97 @@ func NewServer(queueCap, subBuf int) *Server {
     return s
 }
 
+// PublishBatch enqueues the items of req in order. Invalid items are
+// rejected and skipped; when the queue fills, the item that did not fit and
+// all after it are left for the producer to resend. Each item not enqueued
+// is listed with its status.
 func (s *Server) PublishBatch(ctx context.Context, req *telemetryv1.TelemetryBatch) (*telemetryv1.PublishResponse, error) {
     if req == nil {
         return nil, errors.New("nil request")
     }
     accepted := 0
+    var statuses []*telemetryv1.ItemStatus
     for i := range req.Items {
         item := req.Items[i]
+        if reason := rejectReason(item); reason != "" {
+            metricRejected.Inc()
+            s.counts.rejected.Add(1)
+            statuses = append(statuses, &telemetryv1.ItemStatus{Index: uint32(i), Status: StatusRejected, Reason: reason})
+            if item != nil {
+                // a rejected item is handled, not lost
+                s.sequences.observe(item)
+            }
+            continue
+        }
+        // offsets are the broker's: a producer's value is ignored, as two
+        // items sharing one would overwrite each other's pending ack
+        item.Offset = s.offset.Add(1)
+        if item.GetBatchId() == "" {
+            item.BatchId = req.GetBatchId()
+        }
         select {
         case s.inbound <- item:
             accepted++
             metricEnqueued.Inc()
+            s.counts.accepted.Add(1)
+            s.sequences.observe(item)
             if accepted%1000 == 0 {
                 log.Printf("broker: enqueued accepted=%d", accepted)
             }
         default:
             metricBackpressure.Inc()
+            s.counts.backpressure.Add(1)
             log.Printf("broker: backpressure after accepted=%d depth=%d", accepted, len(s.inbound))
-            return &telemetryv1.PublishResponse{Accepted: int64(accepted), Status: "BACKPRESSURE"}, nil
+            for j := i; j < len(req.Items); j++ {
+                statuses = append(statuses, &telemetryv1.ItemStatus{Index: uint32(j), Status: StatusBackpressure, Reason: "queue full"})
+            }
+            return &telemetryv1.PublishResponse{Accepted: int64(accepted), Status: StatusBackpressure, Items: statuses}, nil
         }
     }
-    return &telemetryv1.PublishResponse{Accepted: int64(accepted), Status: "OK"}, nil
+    return &telemetryv1.PublishResponse{Accepted: int64(accepted), Status: "OK", Items: statuses}, nil
+}
+
+// Item statuses of a PublishResponse; StatusBackpressure is also the
+// response's status when any item did not fit.
+const (
+    StatusRejected     = "REJECTED"
+    StatusBackpressure = "BACKPRESSURE"
+)
+
+// rejectReason says why item cannot be enqueued, or "" if it can. Items
+// need a GPU to be routed to a shard.
+func rejectReason(item *telemetryv1.TelemetryData) string {
+    switch {
+    case item == nil:
+        return "empty item"
+    case strings.TrimSpace(item.GetGpuId()) == "":
+        return "gpu_id required"
+    }
+    return ""
 }
 
 func (s *Server) Subscribe(req *telemetryv1.SubscriptionRequest, stream telemetryv1.Telemetry_SubscribeServer) error {
+    if req.GetShardCount() > 0 && req.GetShardIndex() >= req.GetShardCount() {
+        return status.Errorf(codes.InvalidArgument, "shard_index %d out of range for shard_count %d", req.GetShardIndex(), req.GetShardCount())
+    }
     id := time.Now().UTC().Format("20060102T150405.000000000")
     sub := &subscriber{
-        id: id,
-        ch: make(chan *telemetryv1.TelemetryData, s.subBuf),
+        id:     id,
+        group:  req.GetGroup(),
+        ch:     make(chan *telemetryv1.TelemetryData, s.subBuf),
+        shard:  req.GetShardIndex(),
+        shards: req.GetShardCount(),
     }
     s.addSubscriber(sub)
-    log.Printf("broker: subscriber added id=%s", id)
-    defer s.removeSubscriber(sub.id)
+    if sub.shards > 0 {
+        log.Printf("broker: subscriber added id=%s shard=%d/%d", id, sub.shard, sub.shards)
+    } else {
+        log.Printf("broker: subscriber added id=%s", id)
+    }
+    defer func() {
+        s.removeSubscriber(sub.id)
+        s.requeueBuffered(sub)
+    }()
 
     for {
         select {
@@ -130,9 +264,16 @@ func (s *Server) Subscribe(req *telemetryv1.SubscriptionRequest, stream telemetr
             if msg == nil {
                 return nil
             }
+            if req.GetManualAck() {
+                s.track(msg, sub.id)
+            }
             if err := stream.Send(msg); err != nil {
                 // drop subscriber, re-enqueue the message
                 s.removeSubscriber(sub.id)
+                if req.GetManualAck() {
+                    // removeSubscriber already requeued it with the rest of the unacked set
+                    return err
+                }
                 select {
                 case s.inbound <- msg:
                     metricRequeued.Inc()
@@ -143,6 +284,7 @@ func (s *Server) Subscribe(req *telemetryv1.SubscriptionRequest, stream telemetr
                 return err
             }
             metricDelivered.Inc()
+            s.counts.delivered.Add(1)
         }
     }
 }
@@ -156,7 +298,6 @@ func (s *Server) addSubscriber(sub *subscriber) {
 
 func (s *Server) removeSubscriber(id string) {
     s.mu.Lock()
-    defer s.mu.Unlock()
     n := 0
     for _, sub := range s.subs {
         if sub.id != id {
@@ -167,6 +308,104 @@ func (s *Server) removeSubscriber(id string) {
     s.subs = s.subs[:n]
     metricSubscribers.Set(float64(len(s.subs)))
     log.Printf("broker: subscriber removed id=%s remain=%d", id, len(s.subs))
+    s.mu.Unlock()
+
+    s.requeuePending(func(p *pendingAck) bool { return p.subID == id })
+}
+
+// requeueBuffered returns messages that were dispatched to a departed subscriber
+// but never sent, e.g. when a collector unsubscribes after draining on shutdown.
+// If the inbound queue is full they are parked for the redelivery sweeper
+// rather than dropped.
+func (s *Server) requeueBuffered(sub *subscriber) {
+    n := 0
+    for {
+        select {
+        case msg := <-sub.ch:
+            if msg == nil {
+                continue
+            }
+            n++
+            select {
+            case s.inbound <- msg:
+                metricRequeued.Inc()
+            default:
+                s.ackMu.Lock()
+                s.pending[msg.GetOffset()] = &pendingAck{msg: msg, deadline: time.Now()}
+                metricUnacked.Set(float64(len(s.pending)))
+                s.ackMu.Unlock()
+            }
+        default:
+            if n > 0 {
+                log.Printf("broker: requeued %d buffered messages from subscriber id=%s", n, sub.id)
+            }
+            return
+        }
+    }
+}
+
+// SetAckTimeout changes how long manual-ack messages wait for an ack before redelivery.
+func (s *Server) SetAckTimeout(d time.Duration) {
+    s.ackMu.Lock()
+    defer s.ackMu.Unlock()
+    s.ackTimeout = d
+}
+
+// Ack releases pending manual-ack messages. Unknown offsets (already acked or
+// already redelivered and acked elsewhere) are ignored.
+func (s *Server) Ack(ctx context.Context, req *telemetryv1.AckRequest) (*telemetryv1.AckResponse, error) {
+    if req == nil {
+        return nil, errors.New("nil request")
+    }
+    s.ackMu.Lock()
+    defer s.ackMu.Unlock()
+    var acked int64
+    for _, off := range req.GetOffsets() {
+        if _, ok := s.pending[off]; ok {
+            delete(s.pending, off)
+            acked++
+        }
+    }
+    metricAcked.Add(float64(acked))
+    metricUnacked.Set(float64(len(s.pending)))
+    return &telemetryv1.AckResponse{Acked: acked}, nil
+}
+
+func (s *Server) track(msg *telemetryv1.TelemetryData, subID string) {
+    s.ackMu.Lock()
+    defer s.ackMu.Unlock()
+    s.pending[msg.GetOffset()] = &pendingAck{msg: msg, subID: subID, deadline: time.Now().Add(s.ackTimeout)}
+    metricUnacked.Set(float64(len(s.pending)))
+}
+
+// requeuePending puts matching unacked messages back on the inbound queue. If the
+// queue is full they stay pending and are retried by the redelivery sweeper.
+func (s *Server) requeuePending(match func(*pendingAck) bool) {
+    s.ackMu.Lock()
+    defer s.ackMu.Unlock()
+    for off, p := range s.pending {
+        if !match(p) {
+            continue
+        }
+        select {
+        case s.inbound <- p.msg:
+            delete(s.pending, off)
+            metricRedelivered.Inc()
+        default:
+            p.subID = ""
+            p.deadline = time.Now().Add(s.ackTimeout)
+        }
+    }
+    metricUnacked.Set(float64(len(s.pending)))
+}
+
+func (s *Server) redeliverExpired() {
+    ticker := time.NewTicker(time.Second)
+    defer ticker.Stop()
+    for range ticker.C {
+        now := time.Now()
+        s.requeuePending(func(p *pendingAck) bool { return now.After(p.deadline) })
+    }
 }
 
 func (s *Server) snapshotSubs() []*subscriber {
@@ -177,8 +416,22 @@ func (s *Server) snapshotSubs() []*subscriber {
     return out
 }
 
+// park holds msg for the redelivery sweeper, which puts it back on the queue
+// within a second; used when no subscriber owns the message's shard, so one
+// missing shard does not hold up the others.
+func (s *Server) park(msg *telemetryv1.TelemetryData) {
+    s.ackMu.Lock()
+    defer s.ackMu.Unlock()
+    s.pending[msg.GetOffset()] = &pendingAck{msg: msg, deadline: time.Now()}
+    metricUnacked.Set(float64(len(s.pending)))
+    metricUnrouted.Inc()
+}
+
+// dispatcher delivers each message to exactly one subscriber, round-robin
+// among those owning the message's shard.
 func (s *Server) dispatcher() {
     for msg := range s.inbound {
+    deliver:
         for {
             subs := s.snapshotSubs()
             if len(subs) == 0 {
@@ -186,24 +439,28 @@ func (s *Server) dispatcher() {
                 time.Sleep(5 * time.Millisecond)
                 continue
             }
-            delivered := false
+            owned := false
             start := s.next
             for i := 0; i < len(subs); i++ {
                 idx := (start + i) % len(subs)
                 sel := subs[idx]
+                if !shard.Owns(sel.shard, sel.shards, msg.GetGpuId()) {
+                    continue
+                }
+                owned = true
                 select {
                 case sel.ch <- msg:
                     // advance round-robin pointer
                     s.mu.Lock()
                     s.next = (idx + 1) % len(subs)
                     s.mu.Unlock()
-                    delivered = true
-                    break
+                    break deliver
                 default:
                     // target is full, try next
                 }
             }
-            if delivered {
+            if !owned {
+                s.park(msg)
                 break
             }
             // all subscriber queues are full; brief backoff
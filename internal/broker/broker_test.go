@@ -2,13 +2,18 @@ package broker
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
 
 	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/shard"
 
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // fakeStream implements telemetryv1.Telemetry_SubscribeServer with a controllable Context and Send behavior.
@@ -43,6 +48,27 @@ func TestPublishBackpressure(t *testing.T) {
 	}
 }
 
+func TestPublishBatch_ItemStatuses(t *testing.T) {
+	// Scenario: a queue with room for two items and no dispatcher; a batch
+	// whose second item has no gpu_id and whose fourth does not fit
+	// Expect: two accepted; item 1 rejected with a reason, items 3 and 4
+	// listed as backpressure
+	s := &Server{inbound: make(chan *telemetryv1.TelemetryData, 2)}
+	batch := &telemetryv1.TelemetryBatch{Items: []*telemetryv1.TelemetryData{{GpuId: "g0"}, {GpuId: " "}, {GpuId: "g2"}, {GpuId: "g3"}, {GpuId: "g4"}}}
+	resp, err := s.PublishBatch(context.Background(), batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, st := range resp.GetItems() {
+		got = append(got, fmt.Sprintf("%d:%s:%s", st.GetIndex(), st.GetStatus(), st.GetReason()))
+	}
+	want := []string{"1:REJECTED:gpu_id required", "3:BACKPRESSURE:queue full", "4:BACKPRESSURE:queue full"}
+	if resp.GetStatus() != StatusBackpressure || resp.GetAccepted() != 2 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s accepted=%d items=%v", resp.GetStatus(), resp.GetAccepted(), got)
+	}
+}
+
 func TestSubscribeRoundRobinDelivery(t *testing.T) {
 	s := NewServer(10, 10)
 
@@ -143,3 +169,250 @@ func TestRequeueOnSendErrorToAnotherSubscriber(t *testing.T) {
 		}
 	}
 }
+
+func TestManualAck_RedeliversOnDisconnectAndReleasesOnAck(t *testing.T) {
+	s := NewServer(10, 10)
+
+	// first subscriber receives the message but disconnects without acking
+	firstCtx, firstCancel := context.WithCancel(context.Background())
+	got := make(chan *telemetryv1.TelemetryData, 1)
+	first := &fakeStream{ctx: firstCtx, sendFn: func(d *telemetryv1.TelemetryData) error {
+		got <- d
+		return nil
+	}}
+	firstDone := make(chan struct{})
+	go func() { _ = s.Subscribe(&telemetryv1.SubscriptionRequest{ManualAck: true}, first); close(firstDone) }()
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := s.PublishBatch(context.Background(), &telemetryv1.TelemetryBatch{Items: []*telemetryv1.TelemetryData{{GpuId: "g0"}}}); err != nil {
+		t.Fatalf("PublishBatch error: %v", err)
+	}
+	var msg *telemetryv1.TelemetryData
+	select {
+	case msg = <-got:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for first delivery")
+	}
+	if msg.GetOffset() == 0 {
+		t.Fatalf("expected broker-assigned offset")
+	}
+	firstCancel()
+	<-firstDone
+
+	// second subscriber gets the redelivered message and acks it
+	secondCtx, secondCancel := context.WithCancel(context.Background())
+	defer secondCancel()
+	redelivered := make(chan *telemetryv1.TelemetryData, 1)
+	second := &fakeStream{ctx: secondCtx, sendFn: func(d *telemetryv1.TelemetryData) error {
+		redelivered <- d
+		return nil
+	}}
+	go func() { _ = s.Subscribe(&telemetryv1.SubscriptionRequest{ManualAck: true}, second) }()
+	select {
+	case d := <-redelivered:
+		if d.GetOffset() != msg.GetOffset() {
+			t.Fatalf("expected same offset on redelivery: %d vs %d", d.GetOffset(), msg.GetOffset())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for redelivery")
+	}
+	resp, err := s.Ack(context.Background(), &telemetryv1.AckRequest{Offsets: []uint64{msg.GetOffset(), 9999}})
+	if err != nil {
+		t.Fatalf("Ack error: %v", err)
+	}
+	if resp.GetAcked() != 1 {
+		t.Fatalf("expected 1 acked, got %d", resp.GetAcked())
+	}
+}
+
+func TestManualAck_RedeliversAfterTimeout(t *testing.T) {
+	s := NewServer(10, 10)
+	s.SetAckTimeout(10 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	deliveries := 0
+	fs := &fakeStream{ctx: ctx, sendFn: func(d *telemetryv1.TelemetryData) error {
+		mu.Lock()
+		deliveries++
+		mu.Unlock()
+		return nil
+	}}
+	go func() { _ = s.Subscribe(&telemetryv1.SubscriptionRequest{ManualAck: true}, fs) }()
+	time.Sleep(20 * time.Millisecond)
+	if _, err := s.PublishBatch(context.Background(), &telemetryv1.TelemetryBatch{Items: []*telemetryv1.TelemetryData{{GpuId: "g0"}}}); err != nil {
+		t.Fatalf("PublishBatch error: %v", err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := deliveries
+		mu.Unlock()
+		if n >= 2 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("expected unacked message to be redelivered after timeout")
+}
+
+func TestManualAck_IgnoresProducerOffsets(t *testing.T) {
+	// Scenario: a producer presets offsets, two items sharing offset 7 and one
+	// with offset 1, which the broker would also assign; a manual-ack subscriber
+	// Expect: every item delivered with its own broker offset, and each ack
+	// releases exactly one pending message
+	s := NewServer(10, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	got := make(chan *telemetryv1.TelemetryData, 10)
+	fs := &fakeStream{ctx: ctx, sendFn: func(d *telemetryv1.TelemetryData) error {
+		got <- d
+		return nil
+	}}
+	go func() { _ = s.Subscribe(&telemetryv1.SubscriptionRequest{ManualAck: true}, fs) }()
+	time.Sleep(20 * time.Millisecond)
+
+	items := []*telemetryv1.TelemetryData{{GpuId: "g0"}, {GpuId: "g1", Offset: 7}, {GpuId: "g2", Offset: 7}, {GpuId: "g3", Offset: 1}}
+	if _, err := s.PublishBatch(context.Background(), &telemetryv1.TelemetryBatch{Items: items}); err != nil {
+		t.Fatalf("PublishBatch error: %v", err)
+	}
+	seen := map[uint64]string{}
+	for range items {
+		select {
+		case d := <-got:
+			if prev, dup := seen[d.GetOffset()]; dup {
+				t.Fatalf("offset %d delivered for %s and %s", d.GetOffset(), prev, d.GetGpuId())
+			}
+			seen[d.GetOffset()] = d.GetGpuId()
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout: delivered %v", seen)
+		}
+	}
+	for off, gpu := range seen {
+		resp, err := s.Ack(context.Background(), &telemetryv1.AckRequest{Offsets: []uint64{off}})
+		if err != nil || resp.GetAcked() != 1 {
+			t.Fatalf("ack of %s at offset %d: acked %d, err %v", gpu, off, resp.GetAcked(), err)
+		}
+	}
+	s.ackMu.Lock()
+	left := len(s.pending)
+	s.ackMu.Unlock()
+	if left != 0 {
+		t.Fatalf("%d messages still pending after acking all", left)
+	}
+}
+
+func TestBufferedMessagesRequeuedWhenSubscriberLeaves(t *testing.T) {
+	s := NewServer(10, 10)
+
+	// First subscriber holds the first message in Send until it goes away; the
+	// other two sit in its buffer and must not be lost with it.
+	leftCtx, leave := context.WithCancel(context.Background())
+	first := &fakeStream{ctx: leftCtx, sendFn: func(d *telemetryv1.TelemetryData) error {
+		<-leftCtx.Done()
+		return leftCtx.Err()
+	}}
+	firstDone := make(chan struct{})
+	go func() { _ = s.Subscribe(&telemetryv1.SubscriptionRequest{}, first); close(firstDone) }()
+	time.Sleep(20 * time.Millisecond)
+
+	batch := &telemetryv1.TelemetryBatch{Items: []*telemetryv1.TelemetryData{{GpuId: "g0"}, {GpuId: "g1"}, {GpuId: "g2"}}}
+	if _, err := s.PublishBatch(context.Background(), batch); err != nil {
+		t.Fatalf("PublishBatch error: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	leave()
+	<-firstDone
+
+	var mu sync.Mutex
+	got := map[string]bool{}
+	all := make(chan struct{})
+	okCtx, okCancel := context.WithCancel(context.Background())
+	defer okCancel()
+	second := &fakeStream{ctx: okCtx, sendFn: func(d *telemetryv1.TelemetryData) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got[d.GetGpuId()] = true
+		if len(got) == 3 {
+			close(all)
+		}
+		return nil
+	}}
+	go func() { _ = s.Subscribe(&telemetryv1.SubscriptionRequest{}, second) }()
+
+	select {
+	case <-all:
+	case <-time.After(2 * time.Second):
+		mu.Lock()
+		defer mu.Unlock()
+		t.Fatalf("expected all 3 messages redelivered, got %v", got)
+	}
+}
+
+func TestShardedSubscribersReceiveOnlyTheirGPUs(t *testing.T) {
+	s := NewServer(100, 100)
+
+	var mu sync.Mutex
+	got := map[uint32][]string{}
+	sub := func(idx uint32) {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		fs := &fakeStream{ctx: ctx, sendFn: func(d *telemetryv1.TelemetryData) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got[idx] = append(got[idx], d.GetGpuId())
+			return nil
+		}}
+		go func() { _ = s.Subscribe(&telemetryv1.SubscriptionRequest{ShardIndex: idx, ShardCount: 2}, fs) }()
+	}
+	// only shard 0 is up at first; shard 1's messages must wait for it, not go to shard 0
+	sub(0)
+	time.Sleep(20 * time.Millisecond)
+
+	var items []*telemetryv1.TelemetryData
+	for i := 0; i < 20; i++ {
+		items = append(items, &telemetryv1.TelemetryData{GpuId: fmt.Sprintf("gpu-%d", i)})
+	}
+	if _, err := s.PublishBatch(context.Background(), &telemetryv1.TelemetryBatch{Items: items}); err != nil {
+		t.Fatalf("PublishBatch error: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	sub(1)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		mu.Lock()
+		n := len(got[0]) + len(got[1])
+		mu.Unlock()
+		if n == len(items) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivered %d of %d messages", n, len(items))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for idx, ids := range got {
+		for _, id := range ids {
+			if shard.Of(id, 2) != idx {
+				t.Fatalf("shard %d received %s", idx, id)
+			}
+		}
+	}
+	if len(got[0]) == 0 || len(got[1]) == 0 {
+		t.Fatalf("expected both shards to receive messages: %v", got)
+	}
+}
+
+func TestSubscribeRejectsShardOutOfRange(t *testing.T) {
+	s := NewServer(1, 1)
+	fs := &fakeStream{ctx: context.Background(), sendFn: func(*telemetryv1.TelemetryData) error { return nil }}
+	err := s.Subscribe(&telemetryv1.SubscriptionRequest{ShardIndex: 2, ShardCount: 2}, fs)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+}
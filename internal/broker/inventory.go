@@ -0,0 +1,90 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// inventory holds the latest registered info of each GPU. Every change gets
+// the next revision, so collectors can fetch only what changed since their
+// last read. It lives in memory: after a broker restart it fills again as
+// streamers re-register.
+type inventory struct {
+	mu    sync.Mutex
+	byGPU map[string]*registered
+	rev   uint64
+}
+
+type registered struct {
+	info *telemetryv1.GpuInfo
+	rev  uint64
+}
+
+// RegisterGPUs records the info of each GPU. Info equal to what is
+// registered, apart from registered_at, is not a change.
+func (s *Server) RegisterGPUs(ctx context.Context, req *telemetryv1.RegisterGPUsRequest) (*telemetryv1.RegisterGPUsResponse, error) {
+	if req == nil {
+		return nil, errors.New("nil request")
+	}
+	for _, g := range req.GetGpus() {
+		if strings.TrimSpace(g.GetGpuId()) == "" {
+			return nil, status.Error(codes.InvalidArgument, "gpu_id required")
+		}
+	}
+	inv := &s.inventory
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.byGPU == nil {
+		inv.byGPU = map[string]*registered{}
+	}
+	now := timestamppb.New(time.Now())
+	var changed int64
+	for _, g := range req.GetGpus() {
+		info := proto.Clone(g).(*telemetryv1.GpuInfo)
+		info.RegisteredAt = nil
+		if cur, ok := inv.byGPU[info.GpuId]; ok {
+			prev := proto.Clone(cur.info).(*telemetryv1.GpuInfo)
+			prev.RegisteredAt = nil
+			if proto.Equal(prev, info) {
+				continue
+			}
+		}
+		info.RegisteredAt = now
+		inv.rev++
+		inv.byGPU[info.GpuId] = &registered{info: info, rev: inv.rev}
+		changed++
+	}
+	metricGPUsRegistered.Set(float64(len(inv.byGPU)))
+	return &telemetryv1.RegisterGPUsResponse{Changed: changed}, nil
+}
+
+// ListGPUInfo returns the GPUs changed after req.after_revision. A revision
+// ahead of the broker's, as after a broker restart, lists every GPU.
+func (s *Server) ListGPUInfo(ctx context.Context, req *telemetryv1.ListGPUInfoRequest) (*telemetryv1.ListGPUInfoResponse, error) {
+	inv := &s.inventory
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	after := req.GetAfterRevision()
+	if after > inv.rev {
+		after = 0
+	}
+	out := &telemetryv1.ListGPUInfoResponse{Revision: inv.rev}
+	for _, r := range inv.byGPU {
+		if r.rev > after {
+			out.Gpus = append(out.Gpus, r.info)
+		}
+	}
+	sort.Slice(out.Gpus, func(i, j int) bool { return out.Gpus[i].GpuId < out.Gpus[j].GpuId })
+	return out, nil
+}
@@ -0,0 +1,64 @@
+package broker
+
+import (
+	"context"
+	"testing"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestInventory_RegisterAndListChanges(t *testing.T) {
+	// Scenario: two GPUs registered, then one re-registered unchanged and the
+	// other with a new driver; listings from revision 0, from the first
+	// listing's revision and from a revision ahead of the broker's
+	// Expect: only new or changed info counts and gets a revision; a listing
+	// after a revision returns just the later changes; a revision the broker
+	// never issued lists everything; a GPU without gpu_id is rejected
+	s := NewServer(10, 1)
+	ctx := context.Background()
+	reg := func(gpus ...*telemetryv1.GpuInfo) int64 {
+		t.Helper()
+		resp, err := s.RegisterGPUs(ctx, &telemetryv1.RegisterGPUsRequest{Gpus: gpus})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.GetChanged()
+	}
+	list := func(after uint64) *telemetryv1.ListGPUInfoResponse {
+		t.Helper()
+		resp, err := s.ListGPUInfo(ctx, &telemetryv1.ListGPUInfoRequest{AfterRevision: after})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if n := reg(&telemetryv1.GpuInfo{GpuId: "1", DriverVersion: "535"}, &telemetryv1.GpuInfo{GpuId: "0", DriverVersion: "535"}); n != 2 {
+		t.Fatalf("changed %d", n)
+	}
+	first := list(0)
+	if len(first.GetGpus()) != 2 || first.GetGpus()[0].GetGpuId() != "0" || first.GetGpus()[0].GetRegisteredAt() == nil {
+		t.Fatalf("first listing %v", first)
+	}
+	if n := reg(&telemetryv1.GpuInfo{GpuId: "0", DriverVersion: "535"}, &telemetryv1.GpuInfo{GpuId: "1", DriverVersion: "550"}); n != 1 {
+		t.Fatalf("changed %d", n)
+	}
+	later := list(first.GetRevision())
+	if len(later.GetGpus()) != 1 || later.GetGpus()[0].GetDriverVersion() != "550" || later.GetRevision() <= first.GetRevision() {
+		t.Fatalf("later listing %v", later)
+	}
+	if got := list(later.GetRevision()); len(got.GetGpus()) != 0 {
+		t.Fatalf("nothing changed, got %v", got)
+	}
+	if got := list(later.GetRevision() + 10); len(got.GetGpus()) != 2 {
+		t.Fatalf("unknown revision %v", got)
+	}
+
+	_, err := s.RegisterGPUs(ctx, &telemetryv1.RegisterGPUsRequest{Gpus: []*telemetryv1.GpuInfo{{GpuId: " "}}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("missing gpu_id: %v", err)
+	}
+}
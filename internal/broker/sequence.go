@@ -0,0 +1,49 @@
+package broker
+
+import (
+	"log"
+	"sync"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+)
+
+// sequences tracks the last accepted sequence number of each producer to
+// detect items that were published but never accepted. A producer's
+// sequence starts at 1 and grows by one per item, so a jump means a gap; a
+// 1 starts a new run (the producer restarted) and a number already seen is
+// a retry of an item accepted before. Items without a sequence are not
+// tracked.
+type sequences struct {
+	mu   sync.Mutex
+	last map[string]uint64
+}
+
+// observe records an accepted item and reports how many sequence numbers
+// were skipped before it.
+func (s *sequences) observe(item *telemetryv1.TelemetryData) uint64 {
+	seq := item.GetSequence()
+	if seq == 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil {
+		s.last = make(map[string]uint64)
+	}
+	producer := item.GetProducerId()
+	last, seen := s.last[producer]
+	switch {
+	case seq == 1 || !seen:
+		s.last[producer] = seq
+		return 0
+	case seq <= last:
+		return 0
+	}
+	s.last[producer] = seq
+	missing := seq - last - 1
+	if missing > 0 {
+		metricGaps.Inc()
+		log.Printf("broker: sequence gap producer=%s missing=%d after=%d batch=%s", producer, missing, last, item.GetBatchId())
+	}
+	return missing
+}
@@ -0,0 +1,45 @@
+package broker
+
+import (
+	"context"
+	"testing"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+)
+
+func TestSequences_DetectGaps(t *testing.T) {
+	// Scenario: producer p1 publishes 1-3, retries 3, skips 4-5, restarts at 1;
+	// p2 is first seen at 7 and then skips 8; an item has no sequence
+	// Expect: one gap of two for p1, none for the retry or the restart; p2's
+	// first item is no gap, its skip is; the item without sequence is ignored
+	var s sequences
+	item := func(producer string, seq uint64) *telemetryv1.TelemetryData {
+		return &telemetryv1.TelemetryData{ProducerId: producer, Sequence: seq}
+	}
+	steps := []struct {
+		item    *telemetryv1.TelemetryData
+		missing uint64
+	}{
+		{item("p1", 1), 0}, {item("p1", 2), 0}, {item("p1", 3), 0},
+		{item("p1", 3), 0}, {item("p1", 6), 2}, {item("p1", 1), 0}, {item("p1", 2), 0},
+		{item("p2", 7), 0}, {item("p2", 9), 1}, {item("p2", 0), 0},
+	}
+	for i, st := range steps {
+		if got := s.observe(st.item); got != st.missing {
+			t.Fatalf("step %d (%s #%d): missing %d, want %d", i, st.item.GetProducerId(), st.item.GetSequence(), got, st.missing)
+		}
+	}
+}
+
+func TestPublishBatch_StampsBatchID(t *testing.T) {
+	// Scenario: a batch with an id, one item carrying its own batch id
+	// Expect: items without one get the batch's id; the other keeps its own
+	s := NewServer(10, 1)
+	items := []*telemetryv1.TelemetryData{{GpuId: "0", Sequence: 1}, {GpuId: "0", Sequence: 2, BatchId: "b0"}}
+	if _, err := s.PublishBatch(context.Background(), &telemetryv1.TelemetryBatch{BatchId: "b1", Items: items}); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := items[0], items[1]; a.GetBatchId() != "b1" || b.GetBatchId() != "b0" {
+		t.Fatalf("batch ids %q %q", a.GetBatchId(), b.GetBatchId())
+	}
+}
@@ -0,0 +1,116 @@
+package broker
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+)
+
+// statsWindow is how often the rates GetStats reports are sampled.
+const statsWindow = 10 * time.Second
+
+// counts are the broker's running totals, kept next to the Prometheus
+// counters so GetStats can read them.
+type counts struct {
+	accepted, rejected, backpressure, delivered atomic.Uint64
+}
+
+// countSample is the totals at one point in time.
+type countSample struct {
+	at                            time.Time
+	accepted, rejected, delivered uint64
+}
+
+func (c *counts) sample(now time.Time) countSample {
+	return countSample{at: now, accepted: c.accepted.Load(), rejected: c.rejected.Load(), delivered: c.delivered.Load()}
+}
+
+// rates holds the totals sampled at the last two window boundaries. Rates
+// are the change since the older one, so they cover one to two windows and
+// are never taken over a moment. Until the first tick the window starts
+// with the broker at zero totals.
+type rates struct {
+	mu        sync.Mutex
+	prev, cur countSample
+}
+
+func (s *Server) sampleRates() {
+	s.rates.mu.Lock()
+	s.rates.cur = countSample{at: time.Now()}
+	s.rates.mu.Unlock()
+	ticker := time.NewTicker(statsWindow)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.rates.mu.Lock()
+		s.rates.prev, s.rates.cur = s.rates.cur, s.counts.sample(now)
+		s.rates.mu.Unlock()
+	}
+}
+
+// windowStart returns the sample the rates are measured from.
+func (r *rates) windowStart() countSample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.prev.at.IsZero() {
+		return r.cur
+	}
+	return r.prev
+}
+
+// GetStats reports the queue, the subscriber groups and their lag, and the
+// broker's totals and recent rates.
+func (s *Server) GetStats(ctx context.Context, req *telemetryv1.GetStatsRequest) (*telemetryv1.GetStatsResponse, error) {
+	subs := s.snapshotSubs()
+	byID := make(map[string]*telemetryv1.GroupStats, len(subs))
+	groups := map[string]*telemetryv1.GroupStats{}
+	for _, sub := range subs {
+		g := groups[sub.group]
+		if g == nil {
+			g = &telemetryv1.GroupStats{Group: sub.group}
+			groups[sub.group] = g
+		}
+		g.Subscribers++
+		g.Buffered += uint64(len(sub.ch))
+		byID[sub.id] = g
+	}
+	s.ackMu.Lock()
+	unacked := uint64(len(s.pending))
+	for _, p := range s.pending {
+		if g := byID[p.subID]; g != nil {
+			g.Unacked++
+		}
+	}
+	s.ackMu.Unlock()
+
+	resp := &telemetryv1.GetStatsResponse{
+		QueueDepth:        uint64(len(s.inbound)),
+		QueueCapacity:     uint64(cap(s.inbound)),
+		Subscribers:       uint32(len(subs)),
+		Unacked:           unacked,
+		AcceptedTotal:     s.counts.accepted.Load(),
+		RejectedTotal:     s.counts.rejected.Load(),
+		BackpressureTotal: s.counts.backpressure.Load(),
+		DeliveredTotal:    s.counts.delivered.Load(),
+	}
+	for _, g := range groups {
+		g.Lag = g.Buffered + g.Unacked
+		resp.Groups = append(resp.Groups, g)
+	}
+	sort.Slice(resp.Groups, func(i, j int) bool { return resp.Groups[i].Group < resp.Groups[j].Group })
+
+	start := s.rates.windowStart()
+	now := s.counts.sample(time.Now())
+	if !start.at.IsZero() {
+		if secs := now.at.Sub(start.at).Seconds(); secs > 0 {
+			resp.WindowSeconds = secs
+			resp.AcceptRate = float64(now.accepted-start.accepted) / secs
+			resp.RejectRate = float64(now.rejected-start.rejected) / secs
+			resp.DeliverRate = float64(now.delivered-start.delivered) / secs
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,47 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+)
+
+func TestGetStats_GroupsAndRates(t *testing.T) {
+	// Scenario: no dispatcher; two subscribers of group "a" holding one
+	// buffered item and one unacked item, one of group "b"; a batch with an
+	// invalid item, and one that hits the full queue; a window that started
+	// two seconds ago
+	// Expect: queue depth and capacity, per-group lag, totals and rates
+	s := &Server{inbound: make(chan *telemetryv1.TelemetryData, 3), pending: map[uint64]*pendingAck{}}
+	a1 := &subscriber{id: "a1", group: "a", ch: make(chan *telemetryv1.TelemetryData, 4)}
+	a1.ch <- &telemetryv1.TelemetryData{GpuId: "g9"}
+	s.addSubscriber(a1)
+	s.addSubscriber(&subscriber{id: "a2", group: "a", ch: make(chan *telemetryv1.TelemetryData, 4)})
+	s.addSubscriber(&subscriber{id: "b1", group: "b", ch: make(chan *telemetryv1.TelemetryData, 4)})
+	s.pending[7] = &pendingAck{msg: &telemetryv1.TelemetryData{GpuId: "g7"}, subID: "a2"}
+	s.pending[8] = &pendingAck{msg: &telemetryv1.TelemetryData{GpuId: "g8"}} // parked
+	s.rates.cur = countSample{at: time.Now().Add(-2 * time.Second)}
+
+	_, _ = s.PublishBatch(context.Background(), &telemetryv1.TelemetryBatch{Items: []*telemetryv1.TelemetryData{{GpuId: "g0"}, {}, {GpuId: "g1"}}})
+	_, _ = s.PublishBatch(context.Background(), &telemetryv1.TelemetryBatch{Items: []*telemetryv1.TelemetryData{{GpuId: "g2"}, {GpuId: "g3"}}})
+
+	st, err := s.GetStats(context.Background(), &telemetryv1.GetStatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.QueueDepth != 3 || st.QueueCapacity != 3 || st.Subscribers != 3 || st.Unacked != 2 {
+		t.Fatalf("queue: %v", st)
+	}
+	if len(st.Groups) != 2 || st.Groups[0].Group != "a" || st.Groups[0].Subscribers != 2 || st.Groups[0].Buffered != 1 || st.Groups[0].Unacked != 1 || st.Groups[0].Lag != 2 ||
+		st.Groups[1].Group != "b" || st.Groups[1].Lag != 0 {
+		t.Fatalf("groups: %v", st.Groups)
+	}
+	if st.AcceptedTotal != 3 || st.RejectedTotal != 1 || st.BackpressureTotal != 1 || st.DeliveredTotal != 0 {
+		t.Fatalf("totals: %v", st)
+	}
+	if st.WindowSeconds < 2 || st.AcceptRate <= 1 || st.AcceptRate > 1.5 || st.RejectRate <= 0 {
+		t.Fatalf("rates: window=%v accept=%v reject=%v", st.WindowSeconds, st.AcceptRate, st.RejectRate)
+	}
+}
@@ -0,0 +1,67 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	telemetryv2 "gpu-metric-collector/api/gen/v2"
+)
+
+// ServerName is reported to clients by GetCapabilities.
+const ServerName = "mq-broker/2"
+
+// Features lists what the broker supports, as reported by GetCapabilities.
+var Features = []telemetryv2.Feature{
+	telemetryv2.Feature_FEATURE_PUBLISH_STREAM,
+	telemetryv2.Feature_FEATURE_MANUAL_ACK,
+	telemetryv2.Feature_FEATURE_LABELS,
+	telemetryv2.Feature_FEATURE_ITEM_STATUS,
+	telemetryv2.Feature_FEATURE_TYPED_VALUES,
+	telemetryv2.Feature_FEATURE_SEQUENCE,
+	telemetryv2.Feature_FEATURE_GPU_REGISTRY,
+	telemetryv2.Feature_FEATURE_STATS,
+}
+
+// V2 serves the telemetry.v2 service on top of a Server, which keeps serving
+// telemetry.v1 to clients that do not negotiate.
+type V2 struct {
+	telemetryv2.UnimplementedTelemetryServer
+	s *Server
+}
+
+// NewV2 returns the telemetry.v2 service of s.
+func NewV2(s *Server) *V2 { return &V2{s: s} }
+
+// GetCapabilities reports the API versions and features the broker supports.
+func (v *V2) GetCapabilities(ctx context.Context, req *telemetryv2.GetCapabilitiesRequest) (*telemetryv2.Capabilities, error) {
+	if req.GetClient() != "" {
+		log.Printf("broker: capabilities requested by %s features=%v", req.GetClient(), req.GetFeatures())
+	}
+	return &telemetryv2.Capabilities{
+		ApiVersions: []uint32{1, 2},
+		Features:    Features,
+		Server:      ServerName,
+	}, nil
+}
+
+// PublishStream takes batches as PublishBatch does and answers each in turn.
+func (v *V2) PublishStream(stream telemetryv2.Telemetry_PublishStreamServer) error {
+	for {
+		batch, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		resp, err := v.s.PublishBatch(stream.Context(), batch)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package broker
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	telemetryv2 "gpu-metric-collector/api/gen/v2"
+
+	"google.golang.org/grpc"
+)
+
+// fakePublishStream feeds batches to PublishStream and records its responses.
+type fakePublishStream struct {
+	grpc.ServerStream
+	in  []*telemetryv1.TelemetryBatch
+	out []*telemetryv1.PublishResponse
+}
+
+func (f *fakePublishStream) Context() context.Context { return context.Background() }
+
+func (f *fakePublishStream) Recv() (*telemetryv1.TelemetryBatch, error) {
+	if len(f.in) == 0 {
+		return nil, io.EOF
+	}
+	b := f.in[0]
+	f.in = f.in[1:]
+	return b, nil
+}
+
+func (f *fakePublishStream) Send(r *telemetryv1.PublishResponse) error {
+	f.out = append(f.out, r)
+	return nil
+}
+
+func TestV2_GetCapabilities(t *testing.T) {
+	// Expect: both API versions and the streaming publish among the features
+	caps, err := NewV2(&Server{}).GetCapabilities(context.Background(), &telemetryv2.GetCapabilitiesRequest{Client: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(caps.GetApiVersions()) != 2 || caps.GetServer() != ServerName {
+		t.Fatalf("caps: %v", caps)
+	}
+	found := false
+	for _, f := range caps.GetFeatures() {
+		found = found || f == telemetryv2.Feature_FEATURE_PUBLISH_STREAM
+	}
+	if !found {
+		t.Fatalf("publish stream not advertised: %v", caps.GetFeatures())
+	}
+}
+
+func TestV2_PublishStreamAnswersEachBatch(t *testing.T) {
+	// Scenario: a queue with room for three items and no dispatcher; two
+	// batches of two on one stream
+	// Expect: one response per batch, in order: the first accepted, the
+	// second with backpressure after one item
+	s := &Server{inbound: make(chan *telemetryv1.TelemetryData, 3)}
+	stream := &fakePublishStream{in: []*telemetryv1.TelemetryBatch{
+		{Items: []*telemetryv1.TelemetryData{{GpuId: "g0"}, {GpuId: "g1"}}},
+		{Items: []*telemetryv1.TelemetryData{{GpuId: "g2"}, {GpuId: "g3"}}},
+	}}
+	if err := NewV2(s).PublishStream(stream); err != nil {
+		t.Fatal(err)
+	}
+	if len(stream.out) != 2 || stream.out[0].GetAccepted() != 2 || stream.out[0].GetStatus() != "OK" ||
+		stream.out[1].GetAccepted() != 1 || stream.out[1].GetStatus() != StatusBackpressure {
+		t.Fatalf("responses: %v", stream.out)
+	}
+}
@@ -0,0 +1,83 @@
+// Package cache holds byte values for a limited time, in process memory or
+// in Redis, so several gateway replicas can share one cache.
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache stores values under string keys until their TTL passes. A Get that
+// fails reports a miss along with the error; callers fall back to the source.
+type Cache interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// Memory is an in-process Cache holding at most maxEntries values.
+type Memory struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]memEntry
+	now     func() time.Time
+}
+
+type memEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory returns an empty in-process cache; maxEntries <= 0 means 10000.
+func NewMemory(maxEntries int) *Memory {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &Memory{max: maxEntries, entries: map[string]memEntry{}, now: time.Now}
+}
+
+func (m *Memory) Get(key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !m.now().Before(e.expires) {
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+// Set stores value. When the cache is full, expired entries are dropped
+// first, then the entry closest to expiry.
+func (m *Memory) Set(key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if _, ok := m.entries[key]; !ok && len(m.entries) >= m.max {
+		var victim string
+		var soonest time.Time
+		for k, e := range m.entries {
+			if !now.Before(e.expires) {
+				delete(m.entries, k)
+				continue
+			}
+			if victim == "" || e.expires.Before(soonest) {
+				victim, soonest = k, e.expires
+			}
+		}
+		if len(m.entries) >= m.max {
+			delete(m.entries, victim)
+		}
+	}
+	m.entries[key] = memEntry{value: value, expires: now.Add(ttl)}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet dropped.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemory_ExpiresAndEvicts(t *testing.T) {
+	now := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	m := NewMemory(2)
+	m.now = func() time.Time { return now }
+	_ = m.Set("a", []byte("1"), time.Minute)
+	_ = m.Set("b", []byte("2"), 2*time.Minute)
+	if v, ok, _ := m.Get("a"); !ok || string(v) != "1" {
+		t.Fatalf("get a: %q %v", v, ok)
+	}
+	// full: the entry closest to expiry (a) makes room for c
+	_ = m.Set("c", []byte("3"), 3*time.Minute)
+	if _, ok, _ := m.Get("a"); ok || m.Len() != 2 {
+		t.Fatalf("expected a evicted, len %d", m.Len())
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := m.Get("b"); ok {
+		t.Fatal("b should have expired")
+	}
+	if v, ok, _ := m.Get("c"); !ok || string(v) != "3" {
+		t.Fatalf("get c: %q %v", v, ok)
+	}
+}
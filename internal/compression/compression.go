@@ -0,0 +1,175 @@
+// Package compression registers the gRPC compressors the pipeline uses,
+// gzip and zstd, and provides the client and server options behind each
+// component's -grpc_compression flag. Importing it is enough for a server to
+// accept compressed requests; the flag only selects what a process sends.
+package compression
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/stats"
+)
+
+// Names accepted by -grpc_compression.
+const (
+	None = "none"
+	Gzip = gzip.Name
+	Zstd = "zstd"
+)
+
+func init() {
+	encoding.RegisterCompressor(&zstdCompressor{})
+}
+
+// Check returns an error for an unknown compressor name. Empty means None.
+func Check(name string) error {
+	switch name {
+	case "", None, Gzip, Zstd:
+		return nil
+	}
+	return fmt.Errorf("unknown grpc compression %q (want %s, %s or %s)", name, None, Gzip, Zstd)
+}
+
+// DialOptions makes a client compress every request with name, and the
+// server answer in kind. Servers that predate this package reject
+// compressed requests, so upgrade the broker first.
+func DialOptions(name string) []grpc.DialOption {
+	if name == "" || name == None {
+		return nil
+	}
+	return []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.UseCompressor(name))}
+}
+
+// ServerOptions makes a server compress its responses with name when the
+// client accepts it, even if the client sent its request uncompressed.
+// Responses to compressed requests use the request's compressor either way.
+func ServerOptions(name string) []grpc.ServerOption {
+	if name == "" || name == None {
+		return nil
+	}
+	set := func(ctx context.Context) {
+		if accepted, err := grpc.ClientSupportedCompressors(ctx); err == nil && slices.Contains(accepted, name) {
+			_ = grpc.SetSendCompressor(ctx, name)
+		}
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			set(ctx)
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			set(ss.Context())
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// zstdCompressor is a gRPC compressor backed by klauspost/compress, with
+// pooled encoders and decoders.
+type zstdCompressor struct {
+	encoders, decoders sync.Pool
+}
+
+func (c *zstdCompressor) Name() string { return Zstd }
+
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	enc, _ := c.encoders.Get().(*zstd.Encoder)
+	if enc == nil {
+		var err error
+		if enc, err = zstd.NewWriter(w, zstd.WithEncoderConcurrency(1)); err != nil {
+			return nil, err
+		}
+	} else {
+		enc.Reset(w)
+	}
+	return &zstdWriter{Encoder: enc, pool: &c.encoders}, nil
+}
+
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	dec, _ := c.decoders.Get().(*zstd.Decoder)
+	if dec == nil {
+		var err error
+		if dec, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1)); err != nil {
+			return nil, err
+		}
+	} else if err := dec.Reset(r); err != nil {
+		c.decoders.Put(dec)
+		return nil, err
+	}
+	return &zstdReader{dec: dec, pool: &c.decoders}, nil
+}
+
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+func (w *zstdWriter) Close() error {
+	err := w.Encoder.Close()
+	w.pool.Put(w.Encoder)
+	return err
+}
+
+// zstdReader returns its decoder to the pool once the message is read.
+type zstdReader struct {
+	dec  *zstd.Decoder
+	pool *sync.Pool
+}
+
+func (r *zstdReader) Read(p []byte) (int, error) {
+	if r.dec == nil {
+		return 0, io.EOF
+	}
+	n, err := r.dec.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r.dec)
+		r.dec = nil
+	}
+	return n, err
+}
+
+// StatsHandler counts the payload bytes of a process's gRPC messages before
+// and after compression, by direction, as
+// gpu_telemetry_<subsystem>_grpc_payload_bytes_total and
+// gpu_telemetry_<subsystem>_grpc_compressed_bytes_total.
+type StatsHandler struct {
+	raw, compressed *prometheus.CounterVec
+}
+
+// NewStatsHandler returns a handler whose counters are registered with reg.
+func NewStatsHandler(subsystem string, reg prometheus.Registerer) *StatsHandler {
+	h := &StatsHandler{
+		raw: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gpu_telemetry", Subsystem: subsystem, Name: "grpc_payload_bytes_total", Help: "gRPC message bytes before compression, by direction (sent, received).",
+		}, []string{"direction"}),
+		compressed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gpu_telemetry", Subsystem: subsystem, Name: "grpc_compressed_bytes_total", Help: "gRPC message bytes as sent on the wire, after compression, by direction (sent, received).",
+		}, []string{"direction"}),
+	}
+	reg.MustRegister(h.raw, h.compressed)
+	return h
+}
+
+func (h *StatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context   { return ctx }
+func (h *StatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+func (h *StatsHandler) HandleConn(context.Context, stats.ConnStats)                       {}
+
+func (h *StatsHandler) HandleRPC(_ context.Context, s stats.RPCStats) {
+	switch p := s.(type) {
+	case *stats.OutPayload:
+		h.raw.WithLabelValues("sent").Add(float64(p.Length))
+		h.compressed.WithLabelValues("sent").Add(float64(p.CompressedLength))
+	case *stats.InPayload:
+		h.raw.WithLabelValues("received").Add(float64(p.Length))
+		h.compressed.WithLabelValues("received").Add(float64(p.CompressedLength))
+	}
+}
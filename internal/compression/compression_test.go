@@ -0,0 +1,113 @@
+package compression
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestZstd_RoundTripReusesCoders(t *testing.T) {
+	// Expect: several messages compress and decompress to themselves, with
+	// pooled coders reused between them
+	c := &zstdCompressor{}
+	for i := 0; i < 3; i++ {
+		msg := []byte(strings.Repeat("DCGM_FI_DEV_GPU_TEMP ", 100+i))
+		var buf bytes.Buffer
+		w, err := c.Compress(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(msg)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() >= len(msg) {
+			t.Fatalf("not compressed: %d >= %d", buf.Len(), len(msg))
+		}
+		r, err := c.Decompress(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, msg) {
+			t.Fatalf("round trip %d: %v", i, err)
+		}
+	}
+	if Check("zstd") != nil || Check("") != nil || Check("lz4") == nil {
+		t.Fatal("Check")
+	}
+}
+
+// inventoryServer echoes registered GPUs back from ListGPUInfo.
+type inventoryServer struct {
+	telemetryv1.UnimplementedTelemetryServer
+	gpus []*telemetryv1.GpuInfo
+}
+
+func (s *inventoryServer) RegisterGPUs(_ context.Context, req *telemetryv1.RegisterGPUsRequest) (*telemetryv1.RegisterGPUsResponse, error) {
+	s.gpus = req.GetGpus()
+	return &telemetryv1.RegisterGPUsResponse{Changed: int64(len(s.gpus))}, nil
+}
+
+func (s *inventoryServer) ListGPUInfo(context.Context, *telemetryv1.ListGPUInfoRequest) (*telemetryv1.ListGPUInfoResponse, error) {
+	return &telemetryv1.ListGPUInfoResponse{Gpus: s.gpus}, nil
+}
+
+func TestCompression_ClientAndServer(t *testing.T) {
+	// Scenario: a client sending gzip to a server set to zstd, then a client
+	// without compression; both move a large, repetitive inventory
+	// Expect: the gzip request and its response, and the zstd response to
+	// the uncompressed client, are counted smaller on the wire than raw
+	reg := prometheus.NewRegistry()
+	h := NewStatsHandler("test", reg)
+	srv := grpc.NewServer(append(ServerOptions(Zstd), grpc.StatsHandler(h))...)
+	telemetryv1.RegisterTelemetryServer(srv, &inventoryServer{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	gpus := make([]*telemetryv1.GpuInfo, 200)
+	for i := range gpus {
+		gpus[i] = &telemetryv1.GpuInfo{GpuId: "gpu", Model: "NVIDIA H100 80GB HBM3", DriverVersion: "535.129.03", HostId: "node-1"}
+	}
+	dial := func(opts ...grpc.DialOption) telemetryv1.TelemetryClient {
+		conn, err := grpc.NewClient(lis.Addr().String(), append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return telemetryv1.NewTelemetryClient(conn)
+	}
+	raw := func(dir string) float64 { return testutil.ToFloat64(h.raw.WithLabelValues(dir)) }
+	wire := func(dir string) float64 { return testutil.ToFloat64(h.compressed.WithLabelValues(dir)) }
+
+	gz := dial(DialOptions(Gzip)...)
+	if _, err := gz.RegisterGPUs(context.Background(), &telemetryv1.RegisterGPUsRequest{Gpus: gpus}); err != nil {
+		t.Fatal(err)
+	}
+	if raw("received") == 0 || wire("received") >= raw("received")/2 {
+		t.Fatalf("gzip request: raw=%v wire=%v", raw("received"), wire("received"))
+	}
+
+	plain := dial()
+	resp, err := plain.ListGPUInfo(context.Background(), &telemetryv1.ListGPUInfoRequest{})
+	if err != nil || len(resp.GetGpus()) != len(gpus) {
+		t.Fatalf("list: %v", err)
+	}
+	if raw("sent") == 0 || wire("sent") >= raw("sent")/2 {
+		t.Fatalf("zstd response: raw=%v wire=%v", raw("sent"), wire("sent"))
+	}
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"time"
+
+	"gpu-metric-collector/internal/pipeline"
+	"gpu-metric-collector/internal/validation"
+)
+
+// Collector is the collector's config file schema. Fields tagged with `flag`
+// are bound to the command-line flag of that name; see Bind.
+type Collector struct {
+	MetricsAddr string          `yaml:"metrics_addr" flag:"metrics_addr"`
+	Broker      CollectorBroker `yaml:"broker"`
+	Store       Store           `yaml:"store"`
+	Batch       Batch           `yaml:"batch"`
+	Validation  Validation      `yaml:"validation"`
+	Inventory   Inventory       `yaml:"inventory"`
+	Anomaly     Anomaly         `yaml:"anomaly"`
+	Sinks       Sinks           `yaml:"sinks"`
+	Pipeline    Pipeline        `yaml:"pipeline"`
+	WAL         WAL             `yaml:"wal"`
+}
+
+type CollectorBroker struct {
+	Address               string `yaml:"address" flag:"broker"`
+	Group                 string `yaml:"group" flag:"group"`
+	ManualAck             bool   `yaml:"manual_ack" flag:"manual_ack"`
+	ShardIndex            uint   `yaml:"shard_index" flag:"shard_index"`
+	ShardCount            uint   `yaml:"shard_count" flag:"shard_count"`
+	TLS                   bool   `yaml:"tls" flag:"broker_tls"`
+	CAFile                string `yaml:"ca_file" flag:"broker_ca"`
+	CertFile              string `yaml:"cert_file" flag:"broker_cert"`
+	KeyFile               string `yaml:"key_file" flag:"broker_key"`
+	ServerName            string `yaml:"server_name" flag:"broker_server_name"`
+	Token                 string `yaml:"token" flag:"broker_token"`
+	TokenFile             string `yaml:"token_file" flag:"broker_token_file"`
+	Compression           string `yaml:"compression" flag:"grpc_compression"`
+	ReconnectBackoffMs    int    `yaml:"reconnect_backoff_ms" flag:"reconnect_backoff_ms"`
+	ReconnectBackoffMaxMs int    `yaml:"reconnect_backoff_max_ms" flag:"reconnect_backoff_max_ms"`
+	DrainMs               int    `yaml:"drain_ms" flag:"drain_ms"`
+	DrainIdleMs           int    `yaml:"drain_idle_ms" flag:"drain_idle_ms"`
+}
+
+// Store selects the storage backend. URI names it outright, e.g.
+// sqlite://telemetry.db (see storage.Open); otherwise Type is "influx",
+// "victoria", "memory" or empty (influx when fully configured, else victoria
+// when its URL is set, otherwise memory). LatestRedisURL also keeps each
+// GPU's newest point in Redis.
+type Store struct {
+	URI            string   `yaml:"uri" flag:"store_uri"`
+	Type           string   `yaml:"type" flag:"store"`
+	LatestRedisURL string   `yaml:"latest_redis_url" flag:"latest_redis_url"`
+	Influx         Influx   `yaml:"influx"`
+	Victoria       Victoria `yaml:"victoria"`
+	Memory         Memory   `yaml:"memory"`
+}
+
+// Victoria locates a VictoriaMetrics server.
+type Victoria struct {
+	URL string `yaml:"url" flag:"victoria_url"`
+}
+
+// Memory bounds the memory store; zero values are unlimited.
+type Memory struct {
+	MaxPoints int           `yaml:"max_points" flag:"memory_max_points"`
+	MaxAge    time.Duration `yaml:"max_age" flag:"memory_max_age"`
+}
+
+// Influx locates the InfluxDB bucket. With Async, raw telemetry is written
+// in the background in batches of Batch points; batches given up after
+// MaxRetries go to DeadLetterFile.
+type Influx struct {
+	URL            string        `yaml:"url" flag:"influx_url"`
+	Org            string        `yaml:"org" flag:"influx_org"`
+	Bucket         string        `yaml:"bucket" flag:"influx_bucket"`
+	Token          string        `yaml:"token" flag:"influx_token"`
+	Async          bool          `yaml:"async" flag:"influx_async"`
+	Batch          int           `yaml:"batch" flag:"influx_batch"`
+	Flush          time.Duration `yaml:"flush" flag:"influx_flush"`
+	RetryBuffer    int           `yaml:"retry_buffer" flag:"influx_retry_buffer"`
+	MaxRetries     int           `yaml:"max_retries" flag:"influx_max_retries"`
+	DeadLetterFile string        `yaml:"dead_letter_file" flag:"dead_letter_file"`
+}
+
+type Batch struct {
+	Size              int           `yaml:"size" flag:"batch"`
+	FlushMs           int           `yaml:"flush_ms" flag:"flush_ms"`
+	Workers           int           `yaml:"workers" flag:"workers"`
+	MaxInflightItems  int64         `yaml:"max_inflight_items" flag:"max_inflight_items"`
+	MaxInflightBytes  int64         `yaml:"max_inflight_bytes" flag:"max_inflight_bytes"`
+	ShutdownTimeoutMs int           `yaml:"shutdown_timeout_ms" flag:"shutdown_timeout_ms"`
+	StallTimeout      time.Duration `yaml:"stall_timeout" flag:"stall_timeout"`
+}
+
+// Validation holds range checks either as a separate JSON file or inline,
+// plus the policy for the metric catalog's bounds.
+type Validation struct {
+	RulesFile  string            `yaml:"rules_file" flag:"rules"`
+	Rules      []validation.Rule `yaml:"rules"`
+	SpecBounds string            `yaml:"spec_bounds" flag:"spec_bounds"`
+}
+
+type Inventory struct {
+	Source  string        `yaml:"source" flag:"inventory"`
+	Refresh time.Duration `yaml:"refresh" flag:"inventory_refresh"`
+	// Sync is how often registered GPU info is copied from the broker.
+	Sync time.Duration `yaml:"sync" flag:"inventory_sync"`
+}
+
+// Anomaly configures EWMA z-score detection; a zero ZScore disables it.
+type Anomaly struct {
+	ZScore float64 `yaml:"zscore" flag:"anomaly_z"`
+	Alpha  float64 `yaml:"alpha" flag:"anomaly_alpha"`
+	Warmup int     `yaml:"warmup" flag:"anomaly_warmup"`
+}
+
+type Sinks struct {
+	Rollups string `yaml:"rollups" flag:"rollups"`
+	OTLP    OTLP   `yaml:"otlp"`
+}
+
+// OTLP exports persisted telemetry to an OpenTelemetry collector; an empty
+// Endpoint disables it. Headers and Counters are comma-separated lists.
+type OTLP struct {
+	Endpoint string        `yaml:"endpoint" flag:"otlp_endpoint"`
+	TLS      bool          `yaml:"tls" flag:"otlp_tls"`
+	CAFile   string        `yaml:"ca_file" flag:"otlp_ca"`
+	Headers  string        `yaml:"headers" flag:"otlp_headers"`
+	Timeout  time.Duration `yaml:"timeout" flag:"otlp_timeout"`
+	Counters string        `yaml:"counters" flag:"otlp_counters"`
+}
+
+// Pipeline orders the collector's processor stages. Transforms configure the
+// transform stage and can only be set in the config file.
+type Pipeline struct {
+	Stages      string                   `yaml:"stages" flag:"pipeline"`
+	DedupWindow int                      `yaml:"dedup_window" flag:"dedup_window"`
+	Transforms  []pipeline.TransformRule `yaml:"transforms"`
+}
+
+// WAL configures the collector's local write-ahead journal; an empty Dir
+// disables it.
+type WAL struct {
+	Dir       string `yaml:"dir" flag:"wal_dir"`
+	SegmentMB int    `yaml:"segment_mb" flag:"wal_segment_mb"`
+	MaxMB     int    `yaml:"max_mb" flag:"wal_max_mb"`
+}
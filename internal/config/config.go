@@ -0,0 +1,101 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	yaml "go.yaml.in/yaml/v2"
+)
+
+// PathFromArgs returns the value of -config/--config in args, falling back to
+// the env variable. It lets a binary load its config file before flag.Parse.
+func PathFromArgs(args []string, env string) string {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			break
+		}
+		for _, name := range []string{"-config", "--config"} {
+			if a == name && i+1 < len(args) {
+				return args[i+1]
+			}
+			if strings.HasPrefix(a, name+"=") {
+				return strings.TrimPrefix(a, name+"=")
+			}
+		}
+	}
+	return os.Getenv(env)
+}
+
+// Bind loads the YAML file at path (optional) into dst and applies every setting
+// that is present in the file or the environment to the flag named by the
+// field's `flag` tag. Call it before fs.Parse so precedence is
+// defaults < file < environment < command-line flags.
+//
+// Environment variables are named envPrefix + "_" + the upper-cased YAML path,
+// e.g. COLLECTOR_BROKER_ADDRESS for broker.address.
+func Bind(fs *flag.FlagSet, dst any, path, envPrefix string) error {
+	var doc map[any]any
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("config: read %s: %w", path, err)
+		}
+		if err := yaml.UnmarshalStrict(b, dst); err != nil {
+			return fmt.Errorf("config: parse %s: %w", path, err)
+		}
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return fmt.Errorf("config: parse %s: %w", path, err)
+		}
+	}
+	t := reflect.TypeOf(dst)
+	if t.Kind() != reflect.Pointer || t.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: dst must be a pointer to struct")
+	}
+	return bindStruct(fs, t.Elem(), doc, "", envPrefix)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func bindStruct(fs *flag.FlagSet, t reflect.Type, node map[any]any, keyPath, envName string) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		path := key
+		if keyPath != "" {
+			path = keyPath + "." + key
+		}
+		env := envName + "_" + strings.ToUpper(key)
+		raw, inFile := node[key]
+
+		if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+			sub, _ := raw.(map[any]any)
+			if err := bindStruct(fs, f.Type, sub, path, env); err != nil {
+				return err
+			}
+			continue
+		}
+		name := f.Tag.Get("flag")
+		if name == "" {
+			continue
+		}
+		if inFile && raw != nil {
+			if err := fs.Set(name, fmt.Sprint(raw)); err != nil {
+				return fmt.Errorf("config: %s: %w", path, err)
+			}
+		}
+		if v, ok := os.LookupEnv(env); ok {
+			if err := fs.Set(name, v); err != nil {
+				return fmt.Errorf("config: %s: %w", env, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testSchema struct {
+	Addr  string `yaml:"addr" flag:"addr"`
+	Inner struct {
+		Workers int           `yaml:"workers" flag:"workers"`
+		Every   time.Duration `yaml:"every" flag:"every"`
+		Debug   bool          `yaml:"debug" flag:"debug"`
+	} `yaml:"inner"`
+	Tags []string `yaml:"tags"`
+}
+
+func newFlagSet() (*flag.FlagSet, *string, *int, *time.Duration, *bool) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	addr := fs.String("addr", ":1", "")
+	workers := fs.Int("workers", 1, "")
+	every := fs.Duration("every", time.Second, "")
+	debug := fs.Bool("debug", false, "")
+	return fs, addr, workers, every, debug
+}
+
+func writeFile(t *testing.T, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return p
+}
+
+func TestBind_Precedence(t *testing.T) {
+	path := writeFile(t, "addr: \":2\"\ninner:\n  workers: 8\n  every: 5m\ntags: [a, b]\n")
+	t.Setenv("TEST_INNER_WORKERS", "16")
+	t.Setenv("TEST_INNER_DEBUG", "true")
+
+	fs, addr, workers, every, debug := newFlagSet()
+	var cfg testSchema
+	if err := Bind(fs, &cfg, path, "TEST"); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if err := fs.Parse([]string{"-addr", ":3"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if *addr != ":3" {
+		t.Fatalf("flag must win over file, got %s", *addr)
+	}
+	if *workers != 16 {
+		t.Fatalf("env must win over file, got %d", *workers)
+	}
+	if *every != 5*time.Minute {
+		t.Fatalf("file must win over default, got %s", *every)
+	}
+	if !*debug {
+		t.Fatalf("env bool not applied")
+	}
+	if !reflect.DeepEqual(cfg.Tags, []string{"a", "b"}) {
+		t.Fatalf("non-flag fields must be decoded into dst, got %#v", cfg.Tags)
+	}
+}
+
+func TestBind_UnknownKeyAndBadValue(t *testing.T) {
+	fs, _, _, _, _ := newFlagSet()
+	if err := Bind(fs, &testSchema{}, writeFile(t, "nope: 1\n"), "TEST"); err == nil {
+		t.Fatalf("expected error for unknown key")
+	}
+	fs, _, _, _, _ = newFlagSet()
+	t.Setenv("TEST_INNER_WORKERS", "many")
+	if err := Bind(fs, &testSchema{}, "", "TEST"); err == nil {
+		t.Fatalf("expected error for invalid env value")
+	}
+}
+
+func TestPathFromArgs(t *testing.T) {
+	t.Setenv("X_CONFIG", "/from/env")
+	cases := map[string][]string{
+		"/a":        {"-config", "/a"},
+		"/b":        {"-workers=2", "--config=/b"},
+		"/from/env": {"-workers=2"},
+	}
+	for want, args := range cases {
+		if got := PathFromArgs(args, "X_CONFIG"); got != want {
+			t.Fatalf("PathFromArgs(%v)=%s want %s", args, got, want)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+// Package e2e runs the telemetry pipeline in one process for integration
+// tests: a real broker on a loopback gRPC listener, a synthetic source
+// publishing to it as a streamer does, a collector consuming into a store,
+// and the gateway's HTTP handler over that store.
+//
+// The collector loop and the gateway handler live in main packages, which
+// cannot be imported, so their tests plug them in through Options.Collector
+// and Options.Gateway. Without a collector the harness runs Consume, a plain
+// subscribe, save and ack consumer; without a gateway it serves no HTTP.
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/broker"
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Collector consumes from the broker through client into store until ctx
+// ends. It returns nil when stopped by ctx.
+type Collector func(ctx context.Context, client telemetryv1.TelemetryClient, store storage.Store) error
+
+// Options configures a Harness. The zero value runs a small broker, Consume
+// and a memory store, without a gateway.
+type Options struct {
+	// QueueCap and SubBuf size the broker (default 1000 and 64).
+	QueueCap, SubBuf int
+	// Store is where the collector writes (default a memory store).
+	Store storage.Store
+	// Collector consumes from the broker (default Consume).
+	Collector Collector
+	// Gateway, if set, builds the HTTP handler served over Store.
+	Gateway func(storage.Store) http.Handler
+}
+
+// Harness is a running pipeline. Everything it started is stopped when the
+// test ends.
+type Harness struct {
+	Broker *broker.Server
+	Client telemetryv1.TelemetryClient
+	Store  storage.Store
+	// Gateway serves Options.Gateway; nil without one.
+	Gateway *httptest.Server
+
+	t testing.TB
+}
+
+// collectorStopTimeout bounds how long the end of a test waits for the
+// collector to return.
+const collectorStopTimeout = 5 * time.Second
+
+// Start runs a pipeline for the test t.
+func Start(t testing.TB, opts Options) *Harness {
+	t.Helper()
+	if opts.QueueCap <= 0 {
+		opts.QueueCap = 1000
+	}
+	if opts.SubBuf <= 0 {
+		opts.SubBuf = 64
+	}
+	if opts.Store == nil {
+		opts.Store = storage.NewMemoryStore()
+	}
+	if opts.Collector == nil {
+		opts.Collector = Consume
+	}
+	h := &Harness{Broker: broker.NewServer(opts.QueueCap, opts.SubBuf), Store: opts.Store, t: t}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("e2e: listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	telemetryv1.RegisterTelemetryServer(srv, h.Broker)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("e2e: dial broker: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	h.Client = telemetryv1.NewTelemetryClient(conn)
+
+	if opts.Gateway != nil {
+		h.Gateway = httptest.NewServer(opts.Gateway(h.Store))
+		t.Cleanup(h.Gateway.Close)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- opts.Collector(ctx, h.Client, h.Store) }()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("e2e: collector: %v", err)
+			}
+		case <-time.After(collectorStopTimeout):
+			t.Errorf("e2e: collector did not stop within %s", collectorStopTimeout)
+		}
+	})
+	h.waitSubscribed()
+	return h
+}
+
+// waitSubscribed waits for the collector's subscription, so points are not
+// published before anyone can receive them.
+func (h *Harness) waitSubscribed() {
+	h.t.Helper()
+	deadline := time.Now().Add(collectorStopTimeout)
+	for time.Now().Before(deadline) {
+		s, err := h.Broker.GetStats(context.Background(), &telemetryv1.GetStatsRequest{})
+		if err == nil && s.GetSubscribers() > 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	h.t.Fatalf("e2e: the collector did not subscribe within %s", collectorStopTimeout)
+}
+
+// Consume is the default Collector: it subscribes with manual ack and saves
+// and acks every message as it arrives.
+func Consume(ctx context.Context, client telemetryv1.TelemetryClient, store storage.Store) error {
+	stream, err := client.Subscribe(ctx, &telemetryv1.SubscriptionRequest{Group: "e2e", ManualAck: true})
+	if err != nil {
+		return err
+	}
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("recv: %w", err)
+		}
+		if err := store.SaveTelemetry(ToModel(msg)); err != nil {
+			return fmt.Errorf("save: %w", err)
+		}
+		if _, err := client.Ack(ctx, &telemetryv1.AckRequest{Group: "e2e", Offsets: []uint64{msg.GetOffset()}}); err != nil && ctx.Err() == nil {
+			return fmt.Errorf("ack: %w", err)
+		}
+	}
+}
+
+// ToModel converts a message as the collector does, for comparing what was
+// published with what was stored.
+func ToModel(m *telemetryv1.TelemetryData) model.Telemetry {
+	out := model.Telemetry{
+		GPUId:          m.GetGpuId(),
+		HostId:         m.GetHostId(),
+		ProducerId:     m.GetProducerId(),
+		Timestamp:      m.GetTs().AsTime(),
+		Metrics:        map[string]float64{},
+		Labels:         m.GetLabels(),
+		IdempotencyKey: m.GetIdempotencyKey(),
+	}
+	for k, v := range m.GetMetrics() {
+		out.Metrics[k] = v
+	}
+	return out
+}
+
+// Source generates what a streamer publishes: every GPU reports every metric
+// once per Interval from Start on, with a distinct value per point.
+type Source struct {
+	Producer, Host string
+	GPUs, Metrics  []string
+	Start          time.Time
+	Interval       time.Duration
+}
+
+// Points returns the first rounds of the source, round by round, with the
+// idempotency keys and sequence numbers a streamer assigns.
+func (s Source) Points(rounds int) []*telemetryv1.TelemetryData {
+	var out []*telemetryv1.TelemetryData
+	var seq uint64
+	for r := 0; r < rounds; r++ {
+		ts := timestamppb.New(s.Start.Add(time.Duration(r) * s.Interval))
+		for g, gpu := range s.GPUs {
+			seq++
+			item := &telemetryv1.TelemetryData{
+				ProducerId:     s.Producer,
+				HostId:         s.Host,
+				GpuId:          gpu,
+				Ts:             ts,
+				Metrics:        make(map[string]float64, len(s.Metrics)),
+				IdempotencyKey: s.Producer + "-" + strconv.FormatUint(seq, 10),
+				Sequence:       seq,
+			}
+			for m, name := range s.Metrics {
+				item.Metrics[name] = float64(r*1000 + g*10 + m)
+			}
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// publishBackoff is the wait before resending what the broker refused.
+const publishBackoff = 10 * time.Millisecond
+
+// Publish publishes items in batches of up to size, resending what the
+// broker refuses with backpressure as a streamer does. Errors and rejected
+// items fail the test.
+func (h *Harness) Publish(items []*telemetryv1.TelemetryData, size int) {
+	h.t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for n := 0; len(items) > 0; n++ {
+		batch := &telemetryv1.TelemetryBatch{Items: items[:min(size, len(items))], BatchId: "e2e-b" + strconv.Itoa(n)}
+		items = items[len(batch.Items):]
+		for len(batch.Items) > 0 {
+			resp, err := h.Client.PublishBatch(context.Background(), batch)
+			if err != nil {
+				h.t.Fatalf("e2e: publish: %v", err)
+			}
+			var resend []*telemetryv1.TelemetryData
+			for _, st := range resp.GetItems() {
+				if st.GetStatus() != "BACKPRESSURE" {
+					h.t.Fatalf("e2e: item %v %s: %s", batch.Items[st.GetIndex()], st.GetStatus(), st.GetReason())
+				}
+				resend = append(resend, batch.Items[st.GetIndex()])
+			}
+			if len(resend) > 0 && time.Now().After(deadline) {
+				h.t.Fatalf("e2e: broker still refused %d items after 30s", len(resend))
+			}
+			batch.Items = resend
+			if len(resend) > 0 {
+				time.Sleep(publishBackoff)
+			}
+		}
+	}
+}
+
+// Stored returns every point in the store, ordered by GPU then time.
+func (h *Harness) Stored() ([]model.Telemetry, error) {
+	gpus, err := h.Store.ListGPUs()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(gpus)
+	var all []model.Telemetry
+	for _, gpu := range gpus {
+		items, err := h.Store.QueryTelemetry(gpu, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+	}
+	return all, nil
+}
+
+// WaitForPoints waits until the store holds at least n points and returns
+// them.
+func (h *Harness) WaitForPoints(n int, timeout time.Duration) []model.Telemetry {
+	h.t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		all, err := h.Stored()
+		if err != nil {
+			h.t.Fatalf("e2e: read store: %v", err)
+		}
+		if len(all) >= n {
+			return all
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatalf("e2e: %d of %d points stored after %s", len(all), n, timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// AssertDelivered waits for every published item to be stored and fails the
+// test unless each was stored exactly once with its GPU, time, host,
+// producer and metrics.
+func (h *Harness) AssertDelivered(published []*telemetryv1.TelemetryData, timeout time.Duration) {
+	h.t.Helper()
+	stored := h.WaitForPoints(len(published), timeout)
+	if len(stored) != len(published) {
+		h.t.Fatalf("e2e: %d points stored, %d published", len(stored), len(published))
+	}
+	key := func(t model.Telemetry) string { return t.GPUId + "@" + t.Timestamp.UTC().Format(time.RFC3339Nano) }
+	want := make(map[string]model.Telemetry, len(published))
+	for _, p := range published {
+		t := ToModel(p)
+		want[key(t)] = t
+	}
+	for _, got := range stored {
+		w, ok := want[key(got)]
+		if !ok {
+			h.t.Fatalf("e2e: stored point %s was not published, or was stored twice", key(got))
+		}
+		delete(want, key(got))
+		if got.HostId != w.HostId || got.ProducerId != w.ProducerId || !equalMetrics(got.Metrics, w.Metrics) {
+			h.t.Errorf("e2e: point %s stored as %+v, published as %+v", key(got), got, w)
+		}
+	}
+}
+
+func equalMetrics(a, b map[string]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// GetJSON decodes the gateway's response to a GET of path into out, failing
+// the test unless the status is 200.
+func (h *Harness) GetJSON(path string, out any) {
+	h.t.Helper()
+	if h.Gateway == nil {
+		h.t.Fatal("e2e: GetJSON without Options.Gateway")
+	}
+	resp, err := h.Gateway.Client().Get(h.Gateway.URL + path)
+	if err != nil {
+		h.t.Fatalf("e2e: GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		h.t.Fatalf("e2e: GET %s: %s %v", path, resp.Status, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		h.t.Fatalf("e2e: GET %s: decode: %v", path, err)
+	}
+}
@@ -0,0 +1,39 @@
+package e2e
+
+import (
+	"testing"
+	"time"
+)
+
+func testSource() Source {
+	return Source{
+		Producer: "streamer-e2e",
+		Host:     "node-1",
+		GPUs:     []string{"0", "1", "2"},
+		Metrics:  []string{"DCGM_FI_DEV_GPU_TEMP", "DCGM_FI_DEV_GPU_UTIL", "DCGM_FI_DEV_POWER_USAGE"},
+		Start:    time.Now().Add(-time.Hour).Truncate(time.Second),
+		Interval: time.Second,
+	}
+}
+
+func TestPipeline_DeliversEveryPoint(t *testing.T) {
+	// Scenario: 3 GPUs report 3 metrics for 20 rounds, published in batches of 25
+	// Expect: every point is stored once with its host, producer and metrics
+	h := Start(t, Options{})
+	points := testSource().Points(20)
+	h.Publish(points, 25)
+	h.AssertDelivered(points, 5*time.Second)
+}
+
+func TestPipeline_BackpressureIsResent(t *testing.T) {
+	// Scenario: a broker with a 5-item queue and 1-item subscriber buffer takes batches of 50
+	// Expect: the broker refuses with backpressure, the refused items are resent, and all are stored
+	h := Start(t, Options{QueueCap: 5, SubBuf: 1})
+	points := testSource().Points(100)
+	h.Publish(points, 50)
+	h.AssertDelivered(points, 10*time.Second)
+
+	if s, err := h.Broker.GetStats(t.Context(), nil); err != nil || s.GetBackpressureTotal() == 0 {
+		t.Fatalf("broker backpressure total = %d (err %v), want > 0", s.GetBackpressureTotal(), err)
+	}
+}
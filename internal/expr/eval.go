@@ -0,0 +1,448 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+// Lookback is how far back an instant selector looks for a series' latest
+// point; older series are absent at that instant.
+const Lookback = 5 * time.Minute
+
+// MaxSamples bounds the raw points one evaluation may load. Sources are
+// asked for no more than what is left of it. A variable so tests can lower it.
+var MaxSamples = 5_000_000
+
+// MetricLabel holds a series' metric name. Function and arithmetic results
+// drop it, as in PromQL.
+const MetricLabel = "__name__"
+
+// Error is an evaluation error caused by the query itself (too much data,
+// ambiguous matching) rather than by its Source.
+type Error struct{ msg string }
+
+func (e *Error) Error() string { return "expr: " + e.msg }
+
+func evalErrorf(format string, args ...any) error {
+	return &Error{msg: fmt.Sprintf(format, args...)}
+}
+
+// errTooManySamples is the error of an evaluation that would load more than
+// MaxSamples points.
+func errTooManySamples() error {
+	return evalErrorf("query loads more than %d points; narrow the range or selectors", MaxSamples)
+}
+
+// Point is one value of a series.
+type Point struct {
+	T time.Time `json:"timestamp"`
+	V float64   `json:"value"`
+}
+
+// Series is one label set's points, oldest first.
+type Series struct {
+	Labels map[string]string `json:"labels"`
+	Points []Point           `json:"points"`
+}
+
+// Sample is one element of an instant vector.
+type Sample struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+// Result is an expression's value at one instant: a scalar, or an instant
+// vector with one sample per label set.
+type Result struct {
+	IsScalar bool
+	Scalar   float64
+	Vector   []Sample
+}
+
+// Source loads the series of sel.Metric with points in [start, end]. It may
+// use sel's matchers to narrow what it reads; they are applied again after.
+// It reads at most limit points, failing with the error of too large a query
+// when there are more; it may also return them and leave the check to Eval.
+type Source interface {
+	Select(sel *Selector, start, end time.Time, limit int) ([]Series, error)
+}
+
+// Eval evaluates e at t.
+func Eval(e Expr, src Source, t time.Time) (Result, error) {
+	ev, err := newEvaluator(e, src, t, t)
+	if err != nil {
+		return Result{}, err
+	}
+	return ev.eval(e, t)
+}
+
+// EvalRange evaluates e at start, start+step, ... up to end and returns one
+// series per label set, sorted by labels; a scalar result is one series
+// without labels. Each selector is loaded from src once for the whole range.
+func EvalRange(e Expr, src Source, start, end time.Time, step time.Duration) ([]Series, error) {
+	if step <= 0 || end.Before(start) {
+		return nil, evalErrorf("invalid range")
+	}
+	ev, err := newEvaluator(e, src, start, end)
+	if err != nil {
+		return nil, err
+	}
+	bySig := map[string]*Series{}
+	for t := start; !t.After(end); t = t.Add(step) {
+		res, err := ev.eval(e, t)
+		if err != nil {
+			return nil, err
+		}
+		if res.IsScalar {
+			res.Vector = []Sample{{Labels: map[string]string{}, Value: res.Scalar}}
+		}
+		for _, s := range res.Vector {
+			sig := signature(s.Labels, false)
+			ser := bySig[sig]
+			if ser == nil {
+				ser = &Series{Labels: s.Labels}
+				bySig[sig] = ser
+			}
+			ser.Points = append(ser.Points, Point{T: t, V: s.Value})
+		}
+	}
+	sigs := make([]string, 0, len(bySig))
+	for sig := range bySig {
+		sigs = append(sigs, sig)
+	}
+	sort.Strings(sigs)
+	out := make([]Series, 0, len(sigs))
+	for _, sig := range sigs {
+		out = append(out, *bySig[sig])
+	}
+	return out, nil
+}
+
+type evaluator struct {
+	data map[*Selector][]Series
+}
+
+// newEvaluator loads every selector in e for evaluations between start and
+// end, applying its matchers.
+func newEvaluator(e Expr, src Source, start, end time.Time) (*evaluator, error) {
+	ev := &evaluator{data: map[*Selector][]Series{}}
+	loaded := 0
+	var load func(Expr) error
+	load = func(e Expr) error {
+		switch e := e.(type) {
+		case *Binary:
+			if err := load(e.LHS); err != nil {
+				return err
+			}
+			return load(e.RHS)
+		case *Call:
+			return load(e.Arg)
+		case *Selector:
+			back := e.Range
+			if back == 0 {
+				back = Lookback
+			}
+			series, err := src.Select(e, start.Add(-back), end, MaxSamples-loaded)
+			if err != nil {
+				return err
+			}
+			var kept []Series
+			for _, s := range series {
+				if matchAll(e.Matchers, s.Labels) {
+					kept = append(kept, s)
+					loaded += len(s.Points)
+				}
+			}
+			if loaded > MaxSamples {
+				return errTooManySamples()
+			}
+			ev.data[e] = kept
+		}
+		return nil
+	}
+	if err := load(e); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+func matchAll(ms []*Matcher, labels map[string]string) bool {
+	for _, m := range ms {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// window returns the points with from < T <= to.
+func window(points []Point, from, to time.Time) []Point {
+	lo := sort.Search(len(points), func(i int) bool { return points[i].T.After(from) })
+	hi := sort.Search(len(points), func(i int) bool { return points[i].T.After(to) })
+	return points[lo:hi]
+}
+
+func (ev *evaluator) eval(e Expr, t time.Time) (Result, error) {
+	switch e := e.(type) {
+	case *Number:
+		return Result{IsScalar: true, Scalar: e.Value}, nil
+	case *Selector:
+		var out []Sample
+		for _, s := range ev.data[e] {
+			if w := window(s.Points, t.Add(-Lookback), t); len(w) > 0 {
+				out = append(out, Sample{Labels: s.Labels, Value: w[len(w)-1].V})
+			}
+		}
+		return Result{Vector: out}, nil
+	case *Call:
+		var out []Sample
+		for _, s := range ev.data[e.Arg] {
+			w := window(s.Points, t.Add(-e.Arg.Range), t)
+			if v, ok := funcs[e.Func](w); ok {
+				out = append(out, Sample{Labels: dropMetric(s.Labels), Value: v})
+			}
+		}
+		return Result{Vector: out}, nil
+	case *Binary:
+		l, err := ev.eval(e.LHS, t)
+		if err != nil {
+			return Result{}, err
+		}
+		r, err := ev.eval(e.RHS, t)
+		if err != nil {
+			return Result{}, err
+		}
+		return binary(e.Op, l, r)
+	}
+	return Result{}, evalErrorf("unknown node %T", e)
+}
+
+func arith(op byte, a, b float64) float64 {
+	switch op {
+	case '+':
+		return a + b
+	case '-':
+		return a - b
+	case '*':
+		return a * b
+	default:
+		return a / b
+	}
+}
+
+// binary applies op. Vectors are matched one-to-one on all labels but the
+// metric name; samples without a partner, and results that are not finite
+// numbers (e.g. division by zero), are dropped.
+func binary(op byte, l, r Result) (Result, error) {
+	if l.IsScalar && r.IsScalar {
+		v := arith(op, l.Scalar, r.Scalar)
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return Result{}, evalErrorf("%g %c %g is not a finite number", l.Scalar, op, r.Scalar)
+		}
+		return Result{IsScalar: true, Scalar: v}, nil
+	}
+	var out []Sample
+	emit := func(labels map[string]string, v float64) {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			out = append(out, Sample{Labels: dropMetric(labels), Value: v})
+		}
+	}
+	switch {
+	case l.IsScalar:
+		for _, s := range r.Vector {
+			emit(s.Labels, arith(op, l.Scalar, s.Value))
+		}
+	case r.IsScalar:
+		for _, s := range l.Vector {
+			emit(s.Labels, arith(op, s.Value, r.Scalar))
+		}
+	default:
+		right := map[string]Sample{}
+		for _, s := range r.Vector {
+			sig := signature(s.Labels, true)
+			if _, dup := right[sig]; dup {
+				return Result{}, evalErrorf("right side of %c has several series with labels {%s}", op, sig)
+			}
+			right[sig] = s
+		}
+		seen := map[string]bool{}
+		for _, s := range l.Vector {
+			sig := signature(s.Labels, true)
+			if seen[sig] {
+				return Result{}, evalErrorf("left side of %c has several series with labels {%s}", op, sig)
+			}
+			seen[sig] = true
+			if rs, ok := right[sig]; ok {
+				emit(s.Labels, arith(op, s.Value, rs.Value))
+			}
+		}
+	}
+	return Result{Vector: out}, nil
+}
+
+func dropMetric(labels map[string]string) map[string]string {
+	if _, ok := labels[MetricLabel]; !ok {
+		return labels
+	}
+	out := make(map[string]string, len(labels)-1)
+	for k, v := range labels {
+		if k != MetricLabel {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// signature renders labels as sorted k="v" pairs, optionally without the
+// metric name.
+func signature(labels map[string]string, withoutMetric bool) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		if !withoutMetric || k != MetricLabel {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%q", k, labels[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// funcs are the range functions; ok is false when the window has too few
+// points for a value.
+var funcs = map[string]func([]Point) (float64, bool){
+	"avg_over_time": func(w []Point) (float64, bool) {
+		if len(w) == 0 {
+			return 0, false
+		}
+		sum := 0.0
+		for _, p := range w {
+			sum += p.V
+		}
+		return sum / float64(len(w)), true
+	},
+	"min_over_time": func(w []Point) (float64, bool) {
+		if len(w) == 0 {
+			return 0, false
+		}
+		v := w[0].V
+		for _, p := range w[1:] {
+			v = math.Min(v, p.V)
+		}
+		return v, true
+	},
+	"max_over_time": func(w []Point) (float64, bool) {
+		if len(w) == 0 {
+			return 0, false
+		}
+		v := w[0].V
+		for _, p := range w[1:] {
+			v = math.Max(v, p.V)
+		}
+		return v, true
+	},
+	"sum_over_time": func(w []Point) (float64, bool) {
+		sum := 0.0
+		for _, p := range w {
+			sum += p.V
+		}
+		return sum, len(w) > 0
+	},
+	"count_over_time": func(w []Point) (float64, bool) {
+		return float64(len(w)), len(w) > 0
+	},
+	"last_over_time": func(w []Point) (float64, bool) {
+		if len(w) == 0 {
+			return 0, false
+		}
+		return w[len(w)-1].V, true
+	},
+	// delta is the change between the first and last point in the window.
+	"delta": func(w []Point) (float64, bool) {
+		if len(w) < 2 {
+			return 0, false
+		}
+		return w[len(w)-1].V - w[0].V, true
+	},
+	// rate is delta per second between the first and last point.
+	"rate": func(w []Point) (float64, bool) {
+		if len(w) < 2 {
+			return 0, false
+		}
+		secs := w[len(w)-1].T.Sub(w[0].T).Seconds()
+		if secs <= 0 {
+			return 0, false
+		}
+		return (w[len(w)-1].V - w[0].V) / secs, true
+	},
+}
+
+func knownFunc(name string) bool {
+	_, ok := funcs[name]
+	return ok
+}
+
+// StoreSource reads selectors from s. The metric and equality matchers on
+// gpu_id and host_id narrow the store query. Series are labelled with
+// __name__, gpu_id, host_id and the points' labels.
+func StoreSource(s storage.Store) Source { return storeSource{store: s} }
+
+type storeSource struct{ store storage.Store }
+
+func (ss storeSource) Select(sel *Selector, start, end time.Time, limit int) ([]Series, error) {
+	// one point past limit tells a query that is too large from one that fits
+	q := storage.Query{Start: &start, End: &end, Metrics: []string{sel.Metric}, Limit: limit + 1}
+	var gpuIDs []string
+	if v, ok := sel.Equal("gpu_id"); ok {
+		gpuIDs = []string{v}
+	}
+	if v, ok := sel.Equal("host_id"); ok {
+		q.HostIDs = []string{v}
+	}
+	items, err := storage.ExecuteFleet(ss.store, gpuIDs, q)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > limit {
+		return nil, errTooManySamples()
+	}
+	return SeriesOf(sel.Metric, items), nil
+}
+
+// SeriesOf groups metric's points in items (time-ordered) into series.
+func SeriesOf(metric string, items []model.Telemetry) []Series {
+	var out []Series
+	index := map[string]int{}
+	for _, it := range items {
+		v, ok := it.Metrics[metric]
+		if !ok {
+			continue
+		}
+		labels := map[string]string{MetricLabel: metric, "gpu_id": it.GPUId}
+		if it.HostId != "" {
+			labels["host_id"] = it.HostId
+		}
+		for k, lv := range it.Labels {
+			if _, fixed := labels[k]; !fixed && k != "host_id" {
+				labels[k] = lv
+			}
+		}
+		sig := signature(labels, false)
+		i, ok := index[sig]
+		if !ok {
+			i = len(out)
+			index[sig] = i
+			out = append(out, Series{Labels: labels})
+		}
+		out[i].Points = append(out[i].Points, Point{T: it.Timestamp, V: v})
+	}
+	return out
+}
@@ -0,0 +1,193 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestParse_Errors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"temp[5m]",
+		"avg_over_time(temp)",
+		"median_over_time(temp[5m])",
+		`temp{gpu_id="a"`,
+		`temp{gpu_id=~"("}`,
+		"temp[5x]",
+		"(temp + 1",
+		"temp +",
+		`{gpu_id="a"}`,
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("%q: expected error", src)
+		}
+	}
+}
+
+func TestParse_Precedence(t *testing.T) {
+	e, err := Parse("1 + 2 * 3 - -4 / (1 + 1)")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	res, err := Eval(e, StoreSource(storage.NewMemoryStore()), time.Now())
+	if err != nil || !res.IsScalar || res.Scalar != 9 {
+		t.Fatalf("expected scalar 9, got %+v %v", res, err)
+	}
+}
+
+// fixture stores temp for two GPUs once a minute over ten minutes and power
+// for gpu-1 only.
+func fixture(t *testing.T) (Source, time.Time) {
+	t.Helper()
+	mem := storage.NewMemoryStore()
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	for i := 0; i <= 10; i++ {
+		ts := base.Add(time.Duration(i) * time.Minute)
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", HostId: "h1", Timestamp: ts, Metrics: map[string]float64{"temp": float64(60 + i), "power": 200}})
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", HostId: "h2", Timestamp: ts, Metrics: map[string]float64{"temp": 80}})
+	}
+	return StoreSource(mem), base.Add(10 * time.Minute)
+}
+
+func evalVector(t *testing.T, src Source, at time.Time, q string) map[string]float64 {
+	t.Helper()
+	e, err := Parse(q)
+	if err != nil {
+		t.Fatalf("%s: parse: %v", q, err)
+	}
+	res, err := Eval(e, src, at)
+	if err != nil {
+		t.Fatalf("%s: eval: %v", q, err)
+	}
+	out := map[string]float64{}
+	for _, s := range res.Vector {
+		out[s.Labels["gpu_id"]+"|"+s.Labels[MetricLabel]] = s.Value
+	}
+	return out
+}
+
+func TestEval_SelectorsFunctionsAndArithmetic(t *testing.T) {
+	src, end := fixture(t)
+	cases := map[string]map[string]float64{
+		`temp`:                                      {"gpu-1|temp": 70, "gpu-2|temp": 80},
+		`temp{gpu_id="gpu-1"}`:                      {"gpu-1|temp": 70},
+		`temp{host_id=~"h[23]"}`:                    {"gpu-2|temp": 80},
+		`temp{gpu_id!="gpu-2"} - 60`:                {"gpu-1|": 10},
+		`avg_over_time(temp{gpu_id="gpu-1"}[5m])`:   {"gpu-1|": 68}, // 66..70
+		`max_over_time(temp[1h])`:                   {"gpu-1|": 70, "gpu-2|": 80},
+		`count_over_time(temp{gpu_id="gpu-2"}[2m])`: {"gpu-2|": 2},
+		`rate(temp{gpu_id="gpu-1"}[10m]) * 60`:      {"gpu-1|": 1}, // 61..70 over 9m
+		`power / temp`:                              {"gpu-1|": 200.0 / 70},
+		`temp / (temp - temp)`:                      {}, // division by zero drops samples
+	}
+	for q, want := range cases {
+		got := evalVector(t, src, end, q)
+		if len(got) != len(want) {
+			t.Errorf("%s: got %v, want %v", q, got, want)
+			continue
+		}
+		for k, v := range want {
+			if g, ok := got[k]; !ok || g < v-1e-9 || g > v+1e-9 {
+				t.Errorf("%s: got %v, want %v", q, got, want)
+			}
+		}
+	}
+	if got := evalVector(t, src, end.Add(time.Hour), `temp`); len(got) != 0 {
+		t.Fatalf("instant selector beyond lookback: %v", got)
+	}
+}
+
+func TestEvalRange_StepsOverWindow(t *testing.T) {
+	src, end := fixture(t)
+	e, _ := Parse(`avg_over_time(temp{gpu_id="gpu-1"}[2m])`)
+	series, err := EvalRange(e, src, end.Add(-4*time.Minute), end, 2*time.Minute)
+	if err != nil {
+		t.Fatalf("eval: %v", err)
+	}
+	if len(series) != 1 || len(series[0].Points) != 3 {
+		t.Fatalf("unexpected series: %+v", series)
+	}
+	var vals []string
+	for _, p := range series[0].Points {
+		vals = append(vals, fmt.Sprintf("%g", p.V))
+	}
+	if strings.Join(vals, ",") != "65.5,67.5,69.5" {
+		t.Fatalf("unexpected values: %v", vals)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, want := range map[string]time.Duration{"30s": 30 * time.Second, "1h30m": 90 * time.Minute, "2d": 48 * time.Hour, "1w": 168 * time.Hour, "500ms": 500 * time.Millisecond} {
+		if d, err := ParseDuration(s); err != nil || d != want {
+			t.Errorf("%s: got %v %v", s, d, err)
+		}
+	}
+	for _, s := range []string{"", "5", "m", "-5m", "5y"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+// countingStore records the limit and result size of every fleet query.
+type countingStore struct {
+	*storage.MemoryStore
+	limits, returned []int
+}
+
+func (s *countingStore) QueryFleet(gpuIDs []string, q storage.Query) ([]model.Telemetry, error) {
+	items, err := storage.ExecuteFleet(s.MemoryStore, gpuIDs, q)
+	s.limits = append(s.limits, q.Limit)
+	s.returned = append(s.returned, len(items))
+	return items, err
+}
+
+func TestEval_StoreQueriesBoundedBySampleBudget(t *testing.T) {
+	// Scenario: a budget of 15 points; temp of two GPUs has 22 points over
+	// 10m, 12 over the 5m lookback; power of one GPU 6
+	// Expect: each store query is limited to what is left of the budget plus
+	// one; queries over it fail, without loading more than that
+	old := MaxSamples
+	MaxSamples = 15
+	defer func() { MaxSamples = old }()
+	mem := storage.NewMemoryStore()
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	for i := 0; i <= 10; i++ {
+		ts := base.Add(time.Duration(i) * time.Minute)
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: ts, Metrics: map[string]float64{"temp": 60, "power": 200}})
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", Timestamp: ts, Metrics: map[string]float64{"temp": 80}})
+	}
+	end := base.Add(10 * time.Minute)
+
+	for _, c := range []struct {
+		q      string
+		limits []int
+	}{
+		{"avg_over_time(temp[10m])", []int{16}},
+		{"temp + power", []int{16, 4}},
+	} {
+		st := &countingStore{MemoryStore: mem}
+		e, _ := Parse(c.q)
+		_, err := Eval(e, StoreSource(st), end)
+		if err == nil || !strings.Contains(err.Error(), "more than 15 points") {
+			t.Fatalf("%s: expected too many points, got %v", c.q, err)
+		}
+		if fmt.Sprint(st.limits) != fmt.Sprint(c.limits) {
+			t.Fatalf("%s: store limits %v, want %v", c.q, st.limits, c.limits)
+		}
+		for i, n := range st.returned {
+			if n > st.limits[i] {
+				t.Fatalf("%s: store returned %d points for limit %d", c.q, n, st.limits[i])
+			}
+		}
+	}
+	st := &countingStore{MemoryStore: mem}
+	if got := evalVector(t, StoreSource(st), end, "avg_over_time(power[5m])"); got["gpu-1|"] != 200 || fmt.Sprint(st.limits) != "[16]" {
+		t.Fatalf("within budget: %v, limits %v", got, st.limits)
+	}
+}
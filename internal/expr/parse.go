@@ -0,0 +1,419 @@
+// Package expr implements a small PromQL-like expression language over
+// stored telemetry: selectors (temp{gpu_id="gpu-1"}), range functions
+// (avg_over_time(temp[1h])) and arithmetic (+ - * /) between them and numbers.
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expr is a parsed expression: a *Number, *Selector, *Call or *Binary.
+type Expr interface{ expr() }
+
+// Number is a numeric literal.
+type Number struct{ Value float64 }
+
+// MatchOp is a label matcher's operator.
+type MatchOp string
+
+// Label matcher operators, as in PromQL. Regexps are anchored at both ends.
+const (
+	MatchEqual     MatchOp = "="
+	MatchNotEqual  MatchOp = "!="
+	MatchRegexp    MatchOp = "=~"
+	MatchNotRegexp MatchOp = "!~"
+)
+
+// Matcher tests one label; a series without the label has the empty value.
+type Matcher struct {
+	Name  string
+	Op    MatchOp
+	Value string
+	re    *regexp.Regexp
+}
+
+// Matches reports whether v satisfies the matcher.
+func (m *Matcher) Matches(v string) bool {
+	switch m.Op {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	default:
+		return !m.re.MatchString(v)
+	}
+}
+
+// Selector selects the series of one metric whose labels satisfy every
+// matcher. A non-zero Range makes it a range selector (temp[5m]), which is
+// only valid as a function argument.
+type Selector struct {
+	Metric   string
+	Matchers []*Matcher
+	Range    time.Duration
+}
+
+// Equal returns the value of an equality matcher on label name, if any.
+func (s *Selector) Equal(name string) (string, bool) {
+	for _, m := range s.Matchers {
+		if m.Name == name && m.Op == MatchEqual {
+			return m.Value, true
+		}
+	}
+	return "", false
+}
+
+// Call applies a range function to a range selector.
+type Call struct {
+	Func string
+	Arg  *Selector
+}
+
+// Binary is LHS Op RHS with Op one of + - * /.
+type Binary struct {
+	Op       byte
+	LHS, RHS Expr
+}
+
+func (*Number) expr()   {}
+func (*Selector) expr() {}
+func (*Call) expr()     {}
+func (*Binary) expr()   {}
+
+// Parse parses src. Precedence is PromQL's: * and / bind tighter than + and
+// -, and both are left-associative.
+func Parse(src string) (Expr, error) {
+	p := &parser{src: src}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return e, nil
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("expr: %s at position %d", fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end.
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	lhs, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for c := p.peek(); c == '+' || c == '-'; c = p.peek() {
+		p.pos++
+		rhs, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &Binary{Op: c, LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *parser) parseTerm() (Expr, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for c := p.peek(); c == '*' || c == '/'; c = p.peek() {
+		p.pos++
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &Binary{Op: c, LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	switch p.peek() {
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	case '-':
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := x.(*Number); ok {
+			return &Number{Value: -n.Value}, nil
+		}
+		return &Binary{Op: '-', LHS: &Number{}, RHS: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, p.errorf("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(')')
+	case c >= '0' && c <= '9' || c == '.':
+		return p.parseNumber()
+	case c == '{':
+		return p.parseSelector("", false)
+	case isIdentStart(c):
+		name := p.ident()
+		if p.peek() == '(' {
+			if !knownFunc(name) {
+				return nil, p.errorf("unknown function %q", name)
+			}
+			p.pos++
+			arg, err := p.parseSelectorArg()
+			if err != nil {
+				return nil, err
+			}
+			return &Call{Func: name, Arg: arg}, p.expect(')')
+		}
+		return p.parseSelector(name, false)
+	}
+	return nil, p.errorf("unexpected %q", c)
+}
+
+func (p *parser) parseNumber() (Expr, error) {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c >= '0' && c <= '9' || c == '.' ||
+			(c == 'e' || c == 'E') ||
+			((c == '+' || c == '-') && p.pos > start && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E')) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	v, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number")
+	}
+	return &Number{Value: v}, nil
+}
+
+// parseSelectorArg parses a function's range selector argument.
+func (p *parser) parseSelectorArg() (*Selector, error) {
+	name := ""
+	if isIdentStart(p.peek()) {
+		name = p.ident()
+	}
+	sel, err := p.parseSelector(name, true)
+	if err != nil {
+		return nil, err
+	}
+	if sel.Range == 0 {
+		return nil, p.errorf("function argument must be a range selector, e.g. temp[5m]")
+	}
+	return sel, nil
+}
+
+// parseSelector parses the optional {matchers} and [range] after a metric
+// name. Without a name, a __name__ equality matcher must give the metric.
+func (p *parser) parseSelector(name string, allowRange bool) (*Selector, error) {
+	sel := &Selector{Metric: name}
+	if p.peek() == '{' {
+		p.pos++
+		for p.peek() != '}' {
+			m, err := p.parseMatcher()
+			if err != nil {
+				return nil, err
+			}
+			if m.Name == "__name__" {
+				if m.Op != MatchEqual || sel.Metric != "" {
+					return nil, p.errorf("__name__ may only be matched with = and without a metric name")
+				}
+				sel.Metric = m.Value
+			} else {
+				sel.Matchers = append(sel.Matchers, m)
+			}
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+		if err := p.expect('}'); err != nil {
+			return nil, err
+		}
+	}
+	if sel.Metric == "" {
+		return nil, p.errorf("selector needs a metric name")
+	}
+	if p.peek() == '[' {
+		if !allowRange {
+			return nil, p.errorf("range selector is only allowed as a function argument")
+		}
+		p.pos++
+		end := strings.IndexByte(p.src[p.pos:], ']')
+		if end < 0 {
+			return nil, p.errorf("unterminated range")
+		}
+		d, err := ParseDuration(strings.TrimSpace(p.src[p.pos : p.pos+end]))
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.pos += end + 1
+		sel.Range = d
+	}
+	return sel, nil
+}
+
+func (p *parser) parseMatcher() (*Matcher, error) {
+	if !isIdentStart(p.peek()) {
+		return nil, p.errorf("expected label name")
+	}
+	m := &Matcher{Name: p.ident()}
+	p.skipSpace()
+	for _, op := range []MatchOp{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+		if strings.HasPrefix(p.src[p.pos:], string(op)) {
+			m.Op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if m.Op == "" {
+		return nil, p.errorf("expected =, !=, =~ or !~")
+	}
+	v, err := p.parseString()
+	if err != nil {
+		return nil, err
+	}
+	m.Value = v
+	if m.Op == MatchRegexp || m.Op == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + v + ")$")
+		if err != nil {
+			return nil, p.errorf("label %s: %v", m.Name, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// parseString parses a double- or single-quoted string with Go escapes.
+func (p *parser) parseString() (string, error) {
+	q := p.peek()
+	if q != '"' && q != '\'' {
+		return "", p.errorf("expected quoted string")
+	}
+	start := p.pos
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			i++
+		case q:
+			p.pos = i + 1
+			raw := p.src[start+1 : i]
+			if q == '\'' {
+				raw = strings.ReplaceAll(strings.ReplaceAll(raw, `\'`, `'`), `"`, `\"`)
+			}
+			s, err := strconv.Unquote(`"` + raw + `"`)
+			if err != nil {
+				p.pos = start
+				return "", p.errorf("invalid string")
+			}
+			return s, nil
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':'
+}
+
+// ident reads a metric, label or function name. Dots are allowed after the
+// first character because stored metric names may contain them.
+func (p *parser) ident() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if isIdentStart(c) || c >= '0' && c <= '9' || (c == '.' && p.pos > start) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.src[start:p.pos]
+}
+
+var durationUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+// ParseDuration parses PromQL durations such as 30s, 5m, 1h30m, 2d or 1w.
+func ParseDuration(s string) (time.Duration, error) {
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		j := i
+		for j < len(rest) && (rest[j] < '0' || rest[j] > '9') {
+			j++
+		}
+		n, err := strconv.Atoi(rest[:i])
+		unit, ok := durationUnits[rest[i:j]]
+		if err != nil || !ok {
+			return 0, fmt.Errorf("invalid duration %q (want e.g. 5m, 1h30m, 2d)", s)
+		}
+		total += time.Duration(n) * unit
+		rest = rest[j:]
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("invalid duration %q (want e.g. 5m, 1h30m, 2d)", s)
+	}
+	return total, nil
+}
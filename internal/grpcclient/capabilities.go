@@ -0,0 +1,42 @@
+package grpcclient
+
+import (
+	"context"
+
+	telemetryv2 "gpu-metric-collector/api/gen/v2"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Capabilities is what a broker reported from GetCapabilities. Legacy is set
+// for brokers that predate telemetry.v2: they speak v1 only and report no
+// features, though they may still support some.
+type Capabilities struct {
+	Legacy   bool
+	Server   string
+	Versions []uint32
+	features map[telemetryv2.Feature]bool
+}
+
+// Has reports whether the broker advertised f.
+func (c Capabilities) Has(f telemetryv2.Feature) bool { return c.features[f] }
+
+// Negotiate asks the broker on conn what it supports, telling it which
+// client is asking and the features that client can use. A broker that does
+// not implement telemetry.v2 yields Legacy capabilities, not an error.
+func Negotiate(ctx context.Context, conn grpc.ClientConnInterface, client string, want ...telemetryv2.Feature) (Capabilities, error) {
+	resp, err := telemetryv2.NewTelemetryClient(conn).GetCapabilities(ctx, &telemetryv2.GetCapabilitiesRequest{Client: client, Features: want})
+	if status.Code(err) == codes.Unimplemented {
+		return Capabilities{Legacy: true, Versions: []uint32{1}}, nil
+	}
+	if err != nil {
+		return Capabilities{}, err
+	}
+	c := Capabilities{Server: resp.GetServer(), Versions: resp.GetApiVersions(), features: map[telemetryv2.Feature]bool{}}
+	for _, f := range resp.GetFeatures() {
+		c.features[f] = true
+	}
+	return c, nil
+}
@@ -0,0 +1,57 @@
+package grpcclient
+
+import (
+	"context"
+	"testing"
+
+	telemetryv2 "gpu-metric-collector/api/gen/v2"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeConn answers unary calls with caps, or with err when set.
+type fakeConn struct {
+	caps *telemetryv2.Capabilities
+	err  error
+	req  *telemetryv2.GetCapabilitiesRequest
+}
+
+func (f *fakeConn) Invoke(_ context.Context, _ string, args, reply any, _ ...grpc.CallOption) error {
+	f.req = args.(*telemetryv2.GetCapabilitiesRequest)
+	if f.err != nil {
+		return f.err
+	}
+	proto.Merge(reply.(proto.Message), f.caps)
+	return nil
+}
+
+func (f *fakeConn) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "no streams")
+}
+
+func TestNegotiate(t *testing.T) {
+	// Scenario: a v2 broker, a broker from before telemetry.v2, and a broker
+	// that is down
+	// Expect: the advertised features; Legacy v1-only capabilities; the error
+	conn := &fakeConn{caps: &telemetryv2.Capabilities{ApiVersions: []uint32{1, 2}, Server: "mq-broker/2",
+		Features: []telemetryv2.Feature{telemetryv2.Feature_FEATURE_PUBLISH_STREAM, telemetryv2.Feature(99)}}}
+	c, err := Negotiate(context.Background(), conn, "streamer/2", telemetryv2.Feature_FEATURE_PUBLISH_STREAM)
+	if err != nil || c.Legacy || !c.Has(telemetryv2.Feature_FEATURE_PUBLISH_STREAM) || c.Has(telemetryv2.Feature_FEATURE_MANUAL_ACK) || c.Server != "mq-broker/2" {
+		t.Fatalf("v2: %+v %v", c, err)
+	}
+	if conn.req.GetClient() != "streamer/2" || len(conn.req.GetFeatures()) != 1 {
+		t.Fatalf("request: %v", conn.req)
+	}
+
+	c, err = Negotiate(context.Background(), &fakeConn{err: status.Error(codes.Unimplemented, "unknown service")}, "streamer/2")
+	if err != nil || !c.Legacy || c.Has(telemetryv2.Feature_FEATURE_PUBLISH_STREAM) || len(c.Versions) != 1 {
+		t.Fatalf("legacy: %+v %v", c, err)
+	}
+
+	if _, err := Negotiate(context.Background(), &fakeConn{err: status.Error(codes.Unavailable, "down")}, "streamer/2"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("unavailable: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package grpcclient
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDialOptions_PlaintextNoToken(t *testing.T) {
+	opts, err := Security{}.DialOptions()
+	if err != nil {
+		t.Fatalf("dial options: %v", err)
+	}
+	if len(opts) != 1 {
+		t.Fatalf("expected only transport credentials, got %d options", len(opts))
+	}
+}
+
+func TestDialOptions_TokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	opts, err := Security{TokenFile: path}.DialOptions()
+	if err != nil {
+		t.Fatalf("dial options: %v", err)
+	}
+	if len(opts) != 2 {
+		t.Fatalf("expected transport + per-rpc credentials, got %d options", len(opts))
+	}
+}
+
+func TestDialOptions_Errors(t *testing.T) {
+	cases := []Security{
+		{CAFile: "/does/not/exist.pem"},
+		{CertFile: "/only/cert.pem"},
+		{TokenFile: "/does/not/exist"},
+	}
+	for _, s := range cases {
+		if _, err := s.DialOptions(); err == nil {
+			t.Fatalf("expected error for %+v", s)
+		}
+	}
+	bad := filepath.Join(t.TempDir(), "ca.pem")
+	_ = os.WriteFile(bad, []byte("not a cert"), 0o600)
+	if _, err := (Security{CAFile: bad}).DialOptions(); err == nil {
+		t.Fatalf("expected error for invalid CA file")
+	}
+}
+
+func TestBearerToken_Metadata(t *testing.T) {
+	md, err := bearerToken{token: "abc"}.GetRequestMetadata(context.Background())
+	if err != nil {
+		t.Fatalf("metadata: %v", err)
+	}
+	if md["authorization"] != "Bearer abc" {
+		t.Fatalf("unexpected metadata: %#v", md)
+	}
+}
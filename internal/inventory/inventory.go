@@ -0,0 +1,143 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// Info is the static description of one GPU.
+type Info struct {
+	GPUId   string `json:"gpu_id"`
+	Model   string `json:"model,omitempty"`
+	Host    string `json:"host,omitempty"`
+	Rack    string `json:"rack,omitempty"`
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// Labels returns the non-empty fields of i as label key/value pairs.
+func (i Info) Labels() map[string]string {
+	out := map[string]string{}
+	if i.Model != "" {
+		out["model"] = i.Model
+	}
+	if i.Host != "" {
+		out["host"] = i.Host
+	}
+	if i.Rack != "" {
+		out["rack"] = i.Rack
+	}
+	if i.Cluster != "" {
+		out["cluster"] = i.Cluster
+	}
+	return out
+}
+
+type document struct {
+	GPUs []Info `json:"gpus"`
+}
+
+// Inventory maps gpu_id to Info. It is safe for concurrent use, and a nil
+// *Inventory enriches nothing.
+type Inventory struct {
+	source string
+	mu     sync.RWMutex
+	byGPU  map[string]Info
+}
+
+// New returns an inventory that loads from source: a local file path or an
+// http(s) URL serving {"gpus":[{"gpu_id":"0","model":"H100","host":"node-1","rack":"r1","cluster":"c1"}]}.
+func New(source string) *Inventory {
+	return &Inventory{source: source, byGPU: map[string]Info{}}
+}
+
+// Reload re-reads the source and atomically replaces the mapping.
+func (inv *Inventory) Reload(ctx context.Context) error {
+	var (
+		b   []byte
+		err error
+	)
+	if strings.HasPrefix(inv.source, "http://") || strings.HasPrefix(inv.source, "https://") {
+		b, err = fetch(ctx, inv.source)
+	} else {
+		b, err = os.ReadFile(inv.source)
+	}
+	if err != nil {
+		return fmt.Errorf("inventory: load %s: %w", inv.source, err)
+	}
+	var doc document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("inventory: parse %s: %w", inv.source, err)
+	}
+	m := make(map[string]Info, len(doc.GPUs))
+	for _, g := range doc.GPUs {
+		if g.GPUId == "" {
+			continue
+		}
+		m[g.GPUId] = g
+	}
+	inv.mu.Lock()
+	inv.byGPU = m
+	inv.mu.Unlock()
+	return nil
+}
+
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Len returns the number of known GPUs.
+func (inv *Inventory) Len() int {
+	if inv == nil {
+		return 0
+	}
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	return len(inv.byGPU)
+}
+
+// Lookup returns the Info for gpuID, if known.
+func (inv *Inventory) Lookup(gpuID string) (Info, bool) {
+	if inv == nil {
+		return Info{}, false
+	}
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	i, ok := inv.byGPU[gpuID]
+	return i, ok
+}
+
+// Enrich attaches inventory labels to t. Labels already present on t win.
+func (inv *Inventory) Enrich(t *model.Telemetry) {
+	info, ok := inv.Lookup(t.GPUId)
+	if !ok {
+		return
+	}
+	for k, v := range info.Labels() {
+		if t.Labels == nil {
+			t.Labels = map[string]string{}
+		}
+		if _, exists := t.Labels[k]; !exists {
+			t.Labels[k] = v
+		}
+	}
+}
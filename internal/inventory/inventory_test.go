@@ -0,0 +1,67 @@
+package inventory
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+const testDoc = `{"gpus":[{"gpu_id":"0","model":"H100","host":"node-1","rack":"r1","cluster":"c1"},{"gpu_id":"1","model":"A100"}]}`
+
+func TestReload_FileAndEnrich(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	if err := os.WriteFile(path, []byte(testDoc), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	inv := New(path)
+	if err := inv.Reload(context.Background()); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if inv.Len() != 2 {
+		t.Fatalf("expected 2 gpus, got %d", inv.Len())
+	}
+
+	tel := model.Telemetry{GPUId: "0", Timestamp: time.Now(), Labels: map[string]string{"cluster": "override"}}
+	inv.Enrich(&tel)
+	if tel.Labels["model"] != "H100" || tel.Labels["rack"] != "r1" || tel.Labels["host"] != "node-1" {
+		t.Fatalf("unexpected labels: %#v", tel.Labels)
+	}
+	if tel.Labels["cluster"] != "override" {
+		t.Fatalf("existing label must win, got %q", tel.Labels["cluster"])
+	}
+
+	unknown := model.Telemetry{GPUId: "9"}
+	inv.Enrich(&unknown)
+	if unknown.Labels != nil {
+		t.Fatalf("unknown gpu must not get labels: %#v", unknown.Labels)
+	}
+}
+
+func TestReload_HTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testDoc))
+	}))
+	defer srv.Close()
+	inv := New(srv.URL)
+	if err := inv.Reload(context.Background()); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if info, ok := inv.Lookup("1"); !ok || info.Model != "A100" {
+		t.Fatalf("unexpected lookup: %#v ok=%v", info, ok)
+	}
+}
+
+func TestNilInventory(t *testing.T) {
+	var inv *Inventory
+	tel := model.Telemetry{GPUId: "0"}
+	inv.Enrich(&tel)
+	if tel.Labels != nil || inv.Len() != 0 {
+		t.Fatalf("nil inventory must be a no-op")
+	}
+}
@@ -0,0 +1,181 @@
+// Package kube reads what a pod needs to know about its node from the
+// Kubernetes API server: the node's labels and GPU capacity, and which pods
+// on it were assigned which GPUs. It speaks plain REST with the pod's
+// service account, which is all a DaemonSet reading two resources needs.
+package kube
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServiceAccountDir is where Kubernetes mounts a pod's service account
+// token and the API server's CA.
+const ServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// GPUResource is the extended resource the NVIDIA device plugin advertises.
+const GPUResource = "nvidia.com/gpu"
+
+// InCluster reports whether the process runs in a Kubernetes pod: the API
+// server's service variables are set and a service account is mounted.
+func InCluster() bool {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" || os.Getenv("KUBERNETES_SERVICE_PORT") == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(ServiceAccountDir, "token"))
+	return err == nil
+}
+
+// Client GETs resources from an API server.
+type Client struct {
+	base      string
+	tokenFile string
+	http      *http.Client
+}
+
+// NewInCluster returns a client of the API server the pod runs under,
+// authenticated as its service account.
+func NewInCluster() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("kube: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	ca, err := os.ReadFile(filepath.Join(ServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("kube: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("kube: no certificate in the service account's ca.crt")
+	}
+	hc := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}},
+	}
+	return NewClient("https://"+net.JoinHostPort(host, port), filepath.Join(ServiceAccountDir, "token"), hc), nil
+}
+
+// NewClient returns a client of the API server at base. If tokenFile is set,
+// the bearer token is read from it on every request, since Kubernetes
+// rotates projected tokens.
+func NewClient(base, tokenFile string, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{base: strings.TrimRight(base, "/"), tokenFile: tokenFile, http: hc}
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.tokenFile != "" {
+		tok, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return fmt.Errorf("kube: read token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(tok)))
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("kube: GET %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("kube: GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("kube: GET %s: decode: %w", path, err)
+	}
+	return nil
+}
+
+type objectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// Node is the part of a node this package reads.
+type Node struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+	// GPUs is the node's GPUResource capacity; 0 without a device plugin.
+	GPUs int
+}
+
+// Node returns the node called name.
+func (c *Client) Node(ctx context.Context, name string) (Node, error) {
+	var n struct {
+		Metadata objectMeta `json:"metadata"`
+		Status   struct {
+			Capacity map[string]string `json:"capacity"`
+		} `json:"status"`
+	}
+	if err := c.get(ctx, "/api/v1/nodes/"+url.PathEscape(name), nil, &n); err != nil {
+		return Node{}, err
+	}
+	gpus, _ := strconv.Atoi(n.Status.Capacity[GPUResource])
+	return Node{Name: n.Metadata.Name, Labels: n.Metadata.Labels, Annotations: n.Metadata.Annotations, GPUs: gpus}, nil
+}
+
+// Pod is the part of a pod this package reads.
+type Pod struct {
+	Namespace, Name string
+	Labels          map[string]string
+	Annotations     map[string]string
+	// GPUs is the sum of its containers' GPUResource limits.
+	GPUs int
+}
+
+// NodePods returns the pods scheduled on node that have not terminated.
+func (c *Client) NodePods(ctx context.Context, node string) ([]Pod, error) {
+	var list struct {
+		Items []struct {
+			Metadata objectMeta `json:"metadata"`
+			Spec     struct {
+				Containers []struct {
+					Resources struct {
+						Limits map[string]string `json:"limits"`
+					} `json:"resources"`
+				} `json:"containers"`
+			} `json:"spec"`
+		} `json:"items"`
+	}
+	q := url.Values{"fieldSelector": {"spec.nodeName=" + node + ",status.phase!=Succeeded,status.phase!=Failed"}}
+	if err := c.get(ctx, "/api/v1/pods", q, &list); err != nil {
+		return nil, err
+	}
+	out := make([]Pod, 0, len(list.Items))
+	for _, it := range list.Items {
+		p := Pod{Namespace: it.Metadata.Namespace, Name: it.Metadata.Name, Labels: it.Metadata.Labels, Annotations: it.Metadata.Annotations}
+		for _, c := range it.Spec.Containers {
+			n, _ := strconv.Atoi(c.Resources.Limits[GPUResource])
+			p.GPUs += n
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
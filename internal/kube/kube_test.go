@@ -0,0 +1,124 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// apiServer serves node n1 with 4 GPUs and the pods given as JSON items,
+// answering only requests with the bearer token "tok".
+func apiServer(t *testing.T, pods string) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, `{"kind":"Status","code":401}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/nodes/n1":
+			_, _ = w.Write([]byte(`{"metadata":{"name":"n1","labels":{"topology.kubernetes.io/zone":"z1","nvidia.com/gpu.product":"H100"}},
+				"status":{"capacity":{"cpu":"64","nvidia.com/gpu":"4"}}}`))
+		case "/api/v1/pods":
+			if got := r.URL.Query().Get("fieldSelector"); got != "spec.nodeName=n1,status.phase!=Succeeded,status.phase!=Failed" {
+				http.Error(w, "field selector "+got, http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"items":[` + pods + `]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	token := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(token, []byte("tok\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(srv.URL, token, srv.Client())
+}
+
+func pod(name, annotations, gpus string) string {
+	return `{"metadata":{"namespace":"ml","name":"` + name + `","annotations":{` + annotations + `}},
+		"spec":{"containers":[{"resources":{"limits":{"nvidia.com/gpu":"` + gpus + `"}}},{"resources":{}}]}}`
+}
+
+func TestNodeMeta_AnnotatedPods(t *testing.T) {
+	// Scenario: pods a (GPU 0 and GPU-b by UUID) and b (GPU 2) annotated on a
+	// node with 4 GPUs; zone and product labels copied
+	// Expect: node labels on every GPU; pod and namespace on assigned ones only
+	c := apiServer(t, pod("a", `"gpus":"0, GPU-b"`, "2")+","+pod("b", `"gpus":"2"`, "1"))
+	m := NewNodeMeta(c, MetaConfig{Node: "n1", Annotation: "gpus", NodeLabels: map[string]string{
+		"topology.kubernetes.io/zone": "zone", "nvidia.com/gpu.product": LabelName("nvidia.com/gpu.product"), "absent": "x"}})
+	if m.Loaded() {
+		t.Fatal("loaded before Reload")
+	}
+	if err := m.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	node := map[string]string{"node": "n1", "zone": "z1", "gpu_product": "H100"}
+	withPod := func(p string) map[string]string {
+		out := map[string]string{"pod": p, "namespace": "ml"}
+		for k, v := range node {
+			out[k] = v
+		}
+		return out
+	}
+	for _, c := range []struct {
+		ids  []string
+		want map[string]string
+	}{
+		{[]string{"0"}, withPod("a")},
+		{[]string{"1", "GPU-b"}, withPod("a")},
+		{[]string{"2", ""}, withPod("b")},
+		{[]string{"3"}, node},
+	} {
+		if got := m.Labels(c.ids...); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Labels(%q) = %v, want %v", c.ids, got, c.want)
+		}
+	}
+	if !m.Loaded() || m.GPUs() != 4 {
+		t.Fatalf("loaded %v, gpus %d; want true, 4", m.Loaded(), m.GPUs())
+	}
+}
+
+func TestNodeMeta_WholeNodePod(t *testing.T) {
+	// Scenario: no annotations; one pod holds all 4 GPUs, another none.
+	// Then the holder only has 2 of them
+	// Expect: every GPU is attributed to the holder, then to no pod
+	m := NewNodeMeta(apiServer(t, pod("train", "", "4")+","+pod("web", "", "0")), MetaConfig{Node: "n1"})
+	if err := m.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Labels("3"); got["pod"] != "train" || got["namespace"] != "ml" {
+		t.Fatalf("whole node: %v", got)
+	}
+	m = NewNodeMeta(apiServer(t, pod("train", "", "2")), MetaConfig{Node: "n1"})
+	if err := m.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Labels("0"); got["pod"] != "" || got["node"] != "n1" {
+		t.Fatalf("partial holder: %v", got)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	// Scenario: an unknown node; a client without the token; a nil NodeMeta
+	// Expect: errors naming the request and status; a nil NodeMeta labels nothing
+	c := apiServer(t, "")
+	if _, err := c.Node(context.Background(), "n2"); err == nil || !strings.HasPrefix(err.Error(), "kube: GET /api/v1/nodes/n2: 404") {
+		t.Fatalf("unknown node: %v", err)
+	}
+	anon := NewClient(c.base, "", c.http)
+	if _, err := anon.NodePods(context.Background(), "n1"); err == nil {
+		t.Fatal("no error without the token")
+	}
+	var m *NodeMeta
+	if m.Labels("0") != nil || m.Loaded() || m.GPUs() != 0 {
+		t.Fatal("nil NodeMeta is not empty")
+	}
+}
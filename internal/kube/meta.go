@@ -0,0 +1,141 @@
+package kube
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// MetaConfig selects what NodeMeta reads.
+type MetaConfig struct {
+	// Node is the name of the node, usually from the downward API.
+	Node string
+	// NodeLabels maps node label keys to the telemetry label they are copied
+	// to, e.g. topology.kubernetes.io/zone to zone.
+	NodeLabels map[string]string
+	// Annotation is the pod annotation listing the GPUs assigned to the pod,
+	// comma-separated indices or UUIDs, as device plugins and GPU schedulers
+	// that annotate pods write it. Empty reads no annotation.
+	Annotation string
+}
+
+// NodeMeta maps the GPUs of one node to labels for their telemetry: the
+// node's name and chosen labels, and the namespace and name of the pod each
+// GPU is assigned to. It is safe for concurrent use, and a nil *NodeMeta
+// labels nothing.
+type NodeMeta struct {
+	client *Client
+	cfg    MetaConfig
+
+	mu     sync.RWMutex
+	loaded bool
+	node   Node
+	labels map[string]string // node-wide
+	pods   map[string]Pod    // by GPU index or UUID
+}
+
+// NewNodeMeta returns a NodeMeta reading from c. It is empty until Reload.
+func NewNodeMeta(c *Client, cfg MetaConfig) *NodeMeta {
+	return &NodeMeta{client: c, cfg: cfg}
+}
+
+// Reload reads the node and its pods and atomically replaces the mapping.
+//
+// A GPU is assigned to the pod whose annotation lists it. When no pod lists
+// any GPU and a single pod holds all of the node's GPUs, as whole-node jobs
+// do, every GPU is assigned to that pod; otherwise GPUs stay unassigned,
+// since the device plugin does not say which pod got which.
+func (m *NodeMeta) Reload(ctx context.Context) error {
+	node, err := m.client.Node(ctx, m.cfg.Node)
+	if err != nil {
+		return err
+	}
+	pods, err := m.client.NodePods(ctx, m.cfg.Node)
+	if err != nil {
+		return err
+	}
+	labels := map[string]string{"node": m.cfg.Node}
+	for key, name := range m.cfg.NodeLabels {
+		if v := node.Labels[key]; v != "" {
+			labels[name] = v
+		}
+	}
+	byGPU := map[string]Pod{}
+	var holders []Pod
+	for _, p := range pods {
+		if p.GPUs > 0 {
+			holders = append(holders, p)
+		}
+		if m.cfg.Annotation == "" {
+			continue
+		}
+		for _, id := range strings.Split(p.Annotations[m.cfg.Annotation], ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				byGPU[id] = p
+			}
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loaded, m.node, m.labels, m.pods = true, node, labels, byGPU
+	if len(byGPU) == 0 && len(holders) == 1 && node.GPUs > 0 && holders[0].GPUs >= node.GPUs {
+		m.pods = map[string]Pod{"*": holders[0]}
+	}
+	return nil
+}
+
+// Loaded reports whether a Reload has succeeded.
+func (m *NodeMeta) Loaded() bool {
+	if m == nil {
+		return false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.loaded
+}
+
+// GPUs returns the node's GPU capacity as of the last Reload.
+func (m *NodeMeta) GPUs() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.node.GPUs
+}
+
+// Labels returns the labels of a GPU known by any of ids, such as its index
+// and UUID: the node-wide labels, plus pod and namespace if the GPU is
+// assigned to a pod.
+func (m *NodeMeta) Labels(ids ...string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[string]string, len(m.labels)+2)
+	for k, v := range m.labels {
+		out[k] = v
+	}
+	p, ok := m.pods["*"]
+	for _, id := range ids {
+		if q, found := m.pods[id]; found && id != "" {
+			p, ok = q, true
+			break
+		}
+	}
+	if ok {
+		out["pod"], out["namespace"] = p.Name, p.Namespace
+	}
+	return out
+}
+
+// LabelName turns a node label key into a telemetry label name: its last
+// path segment with dots and dashes as underscores, so
+// node.kubernetes.io/instance-type becomes instance_type.
+func LabelName(key string) string {
+	if i := strings.LastIndexByte(key, '/'); i >= 0 {
+		key = key[i+1:]
+	}
+	return strings.NewReplacer(".", "_", "-", "_").Replace(key)
+}
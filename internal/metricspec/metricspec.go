@@ -0,0 +1,115 @@
+// Package metricspec is the catalog of GPU metrics the pipeline knows: their
+// canonical names, units, types and plausible bounds. It is seeded with the
+// DCGM fields dcgm-exporter publishes by default; metrics it does not list
+// pass through the pipeline unchanged.
+package metricspec
+
+import (
+	"sort"
+	"strings"
+)
+
+// Type says how a metric's values evolve.
+type Type string
+
+const (
+	// Gauge is a reading that goes up and down, such as a temperature.
+	Gauge Type = "gauge"
+	// Counter only grows, except when the GPU or driver resets it.
+	Counter Type = "counter"
+	// State is a discrete setting such as a P-state or ECC mode.
+	State Type = "state"
+)
+
+// Spec describes one metric. Min and Max, when set, are the values a
+// healthy device can report; anything outside them is a bad reading.
+type Spec struct {
+	Name    string   `json:"name"`
+	FieldID int      `json:"field_id,omitempty"`
+	Unit    string   `json:"unit,omitempty"`
+	Type    Type     `json:"type"`
+	Help    string   `json:"description"`
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	// Aliases are other names the metric is exported under, such as the
+	// nvidia-smi query fields.
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+func bound(v float64) *float64 { return &v }
+
+// catalog is the built-in list, by DCGM field id.
+var catalog = []Spec{
+	{Name: "DCGM_FI_DEV_SM_CLOCK", FieldID: 100, Unit: "MHz", Type: Gauge, Help: "SM clock frequency.", Min: bound(0), Aliases: []string{"clocks.sm"}},
+	{Name: "DCGM_FI_DEV_MEM_CLOCK", FieldID: 101, Unit: "MHz", Type: Gauge, Help: "Memory clock frequency.", Min: bound(0), Aliases: []string{"clocks.mem"}},
+	{Name: "DCGM_FI_DEV_MEMORY_TEMP", FieldID: 140, Unit: "C", Type: Gauge, Help: "Memory temperature.", Min: bound(0), Max: bound(150)},
+	{Name: "DCGM_FI_DEV_GPU_TEMP", FieldID: 150, Unit: "C", Type: Gauge, Help: "GPU temperature.", Min: bound(0), Max: bound(150), Aliases: []string{"temperature.gpu"}},
+	{Name: "DCGM_FI_DEV_POWER_USAGE", FieldID: 155, Unit: "W", Type: Gauge, Help: "Power draw.", Min: bound(0), Aliases: []string{"power.draw"}},
+	{Name: "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", FieldID: 156, Unit: "mJ", Type: Counter, Help: "Energy consumed since the driver was loaded.", Min: bound(0)},
+	{Name: "DCGM_FI_DEV_PSTATE", FieldID: 190, Type: State, Help: "Performance state, P0 (maximum) to P15 (minimum).", Aliases: []string{"pstate"}},
+	{Name: "DCGM_FI_DEV_PCIE_REPLAY_COUNTER", FieldID: 202, Type: Counter, Help: "PCIe replays.", Min: bound(0)},
+	{Name: "DCGM_FI_DEV_GPU_UTIL", FieldID: 203, Unit: "%", Type: Gauge, Help: "GPU utilization.", Min: bound(0), Max: bound(100), Aliases: []string{"utilization.gpu"}},
+	{Name: "DCGM_FI_DEV_MEM_COPY_UTIL", FieldID: 204, Unit: "%", Type: Gauge, Help: "Memory utilization.", Min: bound(0), Max: bound(100), Aliases: []string{"utilization.memory"}},
+	{Name: "DCGM_FI_DEV_ENC_UTIL", FieldID: 206, Unit: "%", Type: Gauge, Help: "Encoder utilization.", Min: bound(0), Max: bound(100), Aliases: []string{"utilization.encoder"}},
+	{Name: "DCGM_FI_DEV_DEC_UTIL", FieldID: 207, Unit: "%", Type: Gauge, Help: "Decoder utilization.", Min: bound(0), Max: bound(100), Aliases: []string{"utilization.decoder"}},
+	{Name: "DCGM_FI_DEV_XID_ERRORS", FieldID: 230, Type: Gauge, Help: "Value of the last XID error.", Min: bound(0)},
+	{Name: "DCGM_FI_DEV_POWER_VIOLATION", FieldID: 240, Unit: "us", Type: Counter, Help: "Time throttled by the power limit.", Min: bound(0)},
+	{Name: "DCGM_FI_DEV_THERMAL_VIOLATION", FieldID: 241, Unit: "us", Type: Counter, Help: "Time throttled by the thermal limit.", Min: bound(0)},
+	{Name: "DCGM_FI_DEV_FB_TOTAL", FieldID: 250, Unit: "MiB", Type: Gauge, Help: "Framebuffer memory size.", Min: bound(0), Aliases: []string{"memory.total"}},
+	{Name: "DCGM_FI_DEV_FB_FREE", FieldID: 251, Unit: "MiB", Type: Gauge, Help: "Free framebuffer memory.", Min: bound(0), Aliases: []string{"memory.free"}},
+	{Name: "DCGM_FI_DEV_FB_USED", FieldID: 252, Unit: "MiB", Type: Gauge, Help: "Used framebuffer memory.", Min: bound(0), Aliases: []string{"memory.used"}},
+	{Name: "DCGM_FI_DEV_ECC_SBE_VOL_TOTAL", FieldID: 310, Type: Counter, Help: "Single-bit volatile ECC errors.", Min: bound(0)},
+	{Name: "DCGM_FI_DEV_ECC_DBE_VOL_TOTAL", FieldID: 311, Type: Counter, Help: "Double-bit volatile ECC errors.", Min: bound(0)},
+	{Name: "DCGM_FI_DEV_NVLINK_BANDWIDTH_TOTAL", FieldID: 449, Type: Counter, Help: "NVLink bandwidth counter over all lanes.", Min: bound(0)},
+	{Name: "DCGM_FI_PROF_GR_ENGINE_ACTIVE", FieldID: 1001, Unit: "ratio", Type: Gauge, Help: "Fraction of time the graphics engine was active.", Min: bound(0), Max: bound(1)},
+	{Name: "DCGM_FI_PROF_SM_ACTIVE", FieldID: 1002, Unit: "ratio", Type: Gauge, Help: "Fraction of time at least one warp was active on an SM.", Min: bound(0), Max: bound(1)},
+	{Name: "DCGM_FI_PROF_SM_OCCUPANCY", FieldID: 1003, Unit: "ratio", Type: Gauge, Help: "Resident warps on the SMs over the maximum.", Min: bound(0), Max: bound(1)},
+	{Name: "DCGM_FI_PROF_PIPE_TENSOR_ACTIVE", FieldID: 1004, Unit: "ratio", Type: Gauge, Help: "Fraction of cycles the tensor pipe was active.", Min: bound(0), Max: bound(1)},
+	{Name: "DCGM_FI_PROF_DRAM_ACTIVE", FieldID: 1005, Unit: "ratio", Type: Gauge, Help: "Fraction of cycles the device memory interface was active.", Min: bound(0), Max: bound(1)},
+	{Name: "DCGM_FI_PROF_PIPE_FP64_ACTIVE", FieldID: 1006, Unit: "ratio", Type: Gauge, Help: "Fraction of cycles the FP64 pipe was active.", Min: bound(0), Max: bound(1)},
+	{Name: "DCGM_FI_PROF_PIPE_FP32_ACTIVE", FieldID: 1007, Unit: "ratio", Type: Gauge, Help: "Fraction of cycles the FP32 pipe was active.", Min: bound(0), Max: bound(1)},
+	{Name: "DCGM_FI_PROF_PIPE_FP16_ACTIVE", FieldID: 1008, Unit: "ratio", Type: Gauge, Help: "Fraction of cycles the FP16 pipe was active.", Min: bound(0), Max: bound(1)},
+	{Name: "DCGM_FI_PROF_PCIE_TX_BYTES", FieldID: 1009, Unit: "B/s", Type: Gauge, Help: "PCIe transmit rate.", Min: bound(0)},
+	{Name: "DCGM_FI_PROF_PCIE_RX_BYTES", FieldID: 1010, Unit: "B/s", Type: Gauge, Help: "PCIe receive rate.", Min: bound(0)},
+	{Name: "DCGM_FI_PROF_NVLINK_TX_BYTES", FieldID: 1011, Unit: "B/s", Type: Gauge, Help: "NVLink transmit rate.", Min: bound(0)},
+	{Name: "DCGM_FI_PROF_NVLINK_RX_BYTES", FieldID: 1012, Unit: "B/s", Type: Gauge, Help: "NVLink receive rate.", Min: bound(0)},
+}
+
+// byName indexes the catalog by lowercased name and alias.
+var byName = func() map[string]*Spec {
+	m := make(map[string]*Spec, 2*len(catalog))
+	for i := range catalog {
+		s := &catalog[i]
+		m[strings.ToLower(s.Name)] = s
+		for _, a := range s.Aliases {
+			m[strings.ToLower(a)] = s
+		}
+	}
+	return m
+}()
+
+// Lookup returns the spec of name, matched case-insensitively against the
+// canonical names and aliases.
+func Lookup(name string) (Spec, bool) {
+	s, ok := byName[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Spec{}, false
+	}
+	return *s, true
+}
+
+// Canonical returns the canonical name of a known metric and name itself
+// otherwise.
+func Canonical(name string) string {
+	if s, ok := byName[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return s.Name
+	}
+	return name
+}
+
+// All returns the catalog sorted by name.
+func All() []Spec {
+	out := append([]Spec(nil), catalog...)
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
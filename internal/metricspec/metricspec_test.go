@@ -0,0 +1,55 @@
+package metricspec
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookup_CaseAndAliases(t *testing.T) {
+	// Scenario: the streamer lowercases CSV metric names and nvidia-smi
+	// exports use its own query names.
+	// Expect: both resolve to the canonical DCGM name; unknown names do not.
+	for _, name := range []string{"DCGM_FI_DEV_GPU_TEMP", "dcgm_fi_dev_gpu_temp", " temperature.gpu "} {
+		s, ok := Lookup(name)
+		if !ok || s.Name != "DCGM_FI_DEV_GPU_TEMP" || s.Unit != "C" || s.Type != Gauge {
+			t.Fatalf("Lookup(%q) = %+v, %v", name, s, ok)
+		}
+		if got := Canonical(name); got != "DCGM_FI_DEV_GPU_TEMP" {
+			t.Fatalf("Canonical(%q) = %q", name, got)
+		}
+	}
+	if _, ok := Lookup("custom_metric"); ok {
+		t.Fatal("unknown metric found")
+	}
+	if got := Canonical("custom_metric"); got != "custom_metric" {
+		t.Fatalf("Canonical of unknown = %q", got)
+	}
+}
+
+func TestCatalog_Consistent(t *testing.T) {
+	// Expect: unique names and aliases, DCGM-style canonical names, and
+	// bounds that form a range.
+	seen := map[string]bool{}
+	ids := map[int]bool{}
+	for _, s := range All() {
+		if !strings.HasPrefix(s.Name, "DCGM_FI_") || s.Name != strings.ToUpper(s.Name) {
+			t.Fatalf("bad name %q", s.Name)
+		}
+		if s.Help == "" || s.Type == "" {
+			t.Fatalf("%s: help and type required", s.Name)
+		}
+		if ids[s.FieldID] {
+			t.Fatalf("%s: duplicate field id %d", s.Name, s.FieldID)
+		}
+		ids[s.FieldID] = true
+		for _, n := range append([]string{s.Name}, s.Aliases...) {
+			if seen[strings.ToLower(n)] {
+				t.Fatalf("duplicate name %q", n)
+			}
+			seen[strings.ToLower(n)] = true
+		}
+		if s.Min != nil && s.Max != nil && *s.Min > *s.Max {
+			t.Fatalf("%s: min > max", s.Name)
+		}
+	}
+}
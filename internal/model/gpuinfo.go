@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// GPUInfo is the static description of a GPU that its streamer registers,
+// kept in the store's inventory.
+type GPUInfo struct {
+	GPUId            string `json:"gpu_id"`
+	UUID             string `json:"uuid,omitempty"`
+	Model            string `json:"model,omitempty"`
+	VBIOSVersion     string `json:"vbios_version,omitempty"`
+	DriverVersion    string `json:"driver_version,omitempty"`
+	MemoryTotalBytes uint64 `json:"memory_total_bytes,omitempty"`
+	PCIBusId         string `json:"pci_bus_id,omitempty"`
+	HostId           string `json:"host_id,omitempty"`
+	ProducerId       string `json:"producer_id,omitempty"`
+	// RegisteredAt is when the broker last saw this info change.
+	RegisteredAt time.Time `json:"registered_at"`
+}
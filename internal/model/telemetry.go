@@ -2,8 +2,22 @@ package model
 
 import "time"
 
+// Telemetry is one sample of a GPU's metrics, attributed to the host and
+// producer (streamer) that reported it.
 type Telemetry struct {
-	GPUId     string             `json:"gpu_id"`
-	Timestamp time.Time          `json:"timestamp"`
-	Metrics   map[string]float64 `json:"metrics"`
+	GPUId string `json:"gpu_id"`
+	// HostId is the node the GPU is in; empty when the producer did not say.
+	HostId string `json:"host_id,omitempty"`
+	// ProducerId identifies the streamer instance that read the sample.
+	ProducerId string             `json:"producer_id,omitempty"`
+	Timestamp  time.Time          `json:"timestamp"`
+	Metrics    map[string]float64 `json:"metrics"`
+	// Labels are free-form string attributes such as cluster, rack or driver
+	// version. Stores keep them as tags and filter on them.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Values are the metrics Metrics cannot hold, by name. Aggregations and
+	// downsampling use Metrics only.
+	Values map[string]Value `json:"values,omitempty"`
+	// IdempotencyKey is the producer-assigned unique key; stores skip or overwrite duplicates.
+	IdempotencyKey string `json:"-"`
 }
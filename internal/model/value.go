@@ -0,0 +1,101 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ValueKind says which field of a Value is set.
+type ValueKind uint8
+
+const (
+	KindFloat ValueKind = iota + 1
+	KindInt
+	KindBool
+	KindString
+)
+
+// Value is a typed metric value: an integer too large for a float64, a flag
+// or a string such as a P-state, ECC mode or serial. In JSON it is the bare
+// value; a number without fraction or exponent decodes as an integer.
+type Value struct {
+	Kind  ValueKind
+	Float float64
+	Int   int64
+	Bool  bool
+	Str   string
+}
+
+// FloatValue, IntValue, BoolValue and StringValue return a Value of their kind.
+func FloatValue(f float64) Value { return Value{Kind: KindFloat, Float: f} }
+func IntValue(i int64) Value     { return Value{Kind: KindInt, Int: i} }
+func BoolValue(b bool) Value     { return Value{Kind: KindBool, Bool: b} }
+func StringValue(s string) Value { return Value{Kind: KindString, Str: s} }
+
+// ParseValue types a raw reading that is not a plain float: integers whose
+// float64 would lose digits, true/false, and anything else as a string. ok
+// is false for readings a float64 holds exactly, which belong in Metrics.
+func ParseValue(s string) (v Value, ok bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if i >= -1<<53 && i <= 1<<53 {
+			return Value{}, false
+		}
+		return IntValue(i), true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return Value{}, false
+	}
+	switch s {
+	case "true", "True", "TRUE":
+		return BoolValue(true), true
+	case "false", "False", "FALSE":
+		return BoolValue(false), true
+	}
+	return StringValue(s), true
+}
+
+func (v Value) MarshalJSON() ([]byte, error) {
+	switch v.Kind {
+	case KindFloat:
+		b, err := json.Marshal(v.Float)
+		if err == nil && !bytes.ContainsAny(b, ".eE") {
+			b = append(b, ".0"...) // keep it a float when read back
+		}
+		return b, err
+	case KindInt:
+		return strconv.AppendInt(nil, v.Int, 10), nil
+	case KindBool:
+		return strconv.AppendBool(nil, v.Bool), nil
+	case KindString:
+		return json.Marshal(v.Str)
+	}
+	return nil, fmt.Errorf("value of unknown kind %d", v.Kind)
+}
+
+func (v *Value) UnmarshalJSON(b []byte) error {
+	switch {
+	case bytes.Equal(b, []byte("true")), bytes.Equal(b, []byte("false")):
+		*v = BoolValue(b[0] == 't')
+	case len(b) > 0 && b[0] == '"':
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*v = StringValue(s)
+	case !bytes.ContainsAny(b, ".eE"):
+		i, err := strconv.ParseInt(string(b), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %s", b)
+		}
+		*v = IntValue(i)
+	default:
+		f, err := strconv.ParseFloat(string(b), 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %s", b)
+		}
+		*v = FloatValue(f)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/grpcclient"
+	"gpu-metric-collector/internal/model"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ScopeName identifies this exporter as the instrumentation scope of exported metrics.
+const ScopeName = "gpu-metric-collector"
+
+// Resource attribute keys. gpu_id, host_id and producer_id identify the
+// resource; labels (model, rack, ...) are exported as further attributes.
+const (
+	AttrGPUID      = "gpu.id"
+	AttrHostID     = "host.id"
+	AttrProducerID = "telemetry.producer.id"
+)
+
+// Config configures an Exporter.
+type Config struct {
+	// Endpoint is the OTLP/gRPC receiver, e.g. "otel-collector:4317".
+	Endpoint string
+	// Security controls TLS and bearer token auth to the receiver.
+	Security grpcclient.Security
+	// Headers are sent as gRPC metadata on every export (e.g. api keys).
+	Headers map[string]string
+	// Timeout bounds a single export; zero means 10s.
+	Timeout time.Duration
+	// Counters lists metrics exported as monotonic cumulative sums; all
+	// others become gauges.
+	Counters []string
+}
+
+// Exporter pushes telemetry to an OpenTelemetry collector over OTLP/gRPC.
+type Exporter struct {
+	conn     *grpc.ClientConn
+	client   colmetricspb.MetricsServiceClient
+	headers  metadata.MD
+	timeout  time.Duration
+	counters map[string]bool
+	start    uint64
+}
+
+func New(cfg Config) (*Exporter, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("otlp: missing endpoint")
+	}
+	opts, err := cfg.Security.DialOptions()
+	if err != nil {
+		return nil, fmt.Errorf("otlp: %w", err)
+	}
+	conn, err := grpc.Dial(cfg.Endpoint, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("otlp: dial %s: %w", cfg.Endpoint, err)
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	counters := make(map[string]bool, len(cfg.Counters))
+	for _, c := range cfg.Counters {
+		counters[c] = true
+	}
+	return &Exporter{
+		conn:     conn,
+		client:   colmetricspb.NewMetricsServiceClient(conn),
+		headers:  metadata.New(cfg.Headers),
+		timeout:  timeout,
+		counters: counters,
+		start:    uint64(time.Now().UnixNano()),
+	}, nil
+}
+
+// Export sends items in one request. Data points the receiver rejects are
+// reported as an error.
+func (e *Exporter) Export(ctx context.Context, items []model.Telemetry) error {
+	if len(items) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	if len(e.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, e.headers)
+	}
+	resp, err := e.client.Export(ctx, e.request(items))
+	if err != nil {
+		return fmt.Errorf("otlp: export: %w", err)
+	}
+	if ps := resp.GetPartialSuccess(); ps.GetRejectedDataPoints() > 0 {
+		return fmt.Errorf("otlp: receiver rejected %d data points: %s", ps.GetRejectedDataPoints(), ps.GetErrorMessage())
+	}
+	return nil
+}
+
+func (e *Exporter) Close() error {
+	return e.conn.Close()
+}
+
+// request groups items by resource (gpu, host, producer, labels) and, within
+// a resource, by metric name so each metric is one instrument with one data
+// point per sample.
+func (e *Exporter) request(items []model.Telemetry) *colmetricspb.ExportMetricsServiceRequest {
+	type group struct {
+		res     *resourcepb.Resource
+		metrics map[string]*metricspb.Metric
+		names   []string
+	}
+	groups := map[string]*group{}
+	var order []string
+	for _, t := range items {
+		attrs := resourceAttrs(t)
+		k := attrsKey(attrs)
+		g := groups[k]
+		if g == nil {
+			g = &group{res: &resourcepb.Resource{Attributes: attrs}, metrics: map[string]*metricspb.Metric{}}
+			groups[k] = g
+			order = append(order, k)
+		}
+		ts := uint64(t.Timestamp.UnixNano())
+		for name, v := range t.Metrics {
+			m := g.metrics[name]
+			if m == nil {
+				m = e.instrument(name)
+				g.metrics[name] = m
+				g.names = append(g.names, name)
+			}
+			dp := &metricspb.NumberDataPoint{TimeUnixNano: ts, Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: v}}
+			if s := m.GetSum(); s != nil {
+				dp.StartTimeUnixNano = e.start
+				s.DataPoints = append(s.DataPoints, dp)
+			} else {
+				m.GetGauge().DataPoints = append(m.GetGauge().DataPoints, dp)
+			}
+		}
+	}
+	req := &colmetricspb.ExportMetricsServiceRequest{}
+	for _, k := range order {
+		g := groups[k]
+		sort.Strings(g.names)
+		sm := &metricspb.ScopeMetrics{Scope: &commonpb.InstrumentationScope{Name: ScopeName}}
+		for _, n := range g.names {
+			sm.Metrics = append(sm.Metrics, g.metrics[n])
+		}
+		req.ResourceMetrics = append(req.ResourceMetrics, &metricspb.ResourceMetrics{Resource: g.res, ScopeMetrics: []*metricspb.ScopeMetrics{sm}})
+	}
+	return req
+}
+
+func (e *Exporter) instrument(name string) *metricspb.Metric {
+	if e.counters[name] {
+		return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}}}
+	}
+	return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{}}}
+}
+
+func resourceAttrs(t model.Telemetry) []*commonpb.KeyValue {
+	attrs := []*commonpb.KeyValue{str(AttrGPUID, t.GPUId)}
+	if t.HostId != "" {
+		attrs = append(attrs, str(AttrHostID, t.HostId))
+	}
+	if t.ProducerId != "" {
+		attrs = append(attrs, str(AttrProducerID, t.ProducerId))
+	}
+	keys := make([]string, 0, len(t.Labels))
+	for k := range t.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attrs = append(attrs, str(k, t.Labels[k]))
+	}
+	return attrs
+}
+
+func attrsKey(attrs []*commonpb.KeyValue) string {
+	var b strings.Builder
+	for _, a := range attrs {
+		b.WriteString(a.GetKey())
+		b.WriteByte('=')
+		b.WriteString(a.GetValue().GetStringValue())
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+func str(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
@@ -0,0 +1,112 @@
+package otlp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type fakeReceiver struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	reqs     chan *colmetricspb.ExportMetricsServiceRequest
+	md       chan metadata.MD
+	rejected int64
+}
+
+func (f *fakeReceiver) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	f.md <- md
+	f.reqs <- req
+	resp := &colmetricspb.ExportMetricsServiceResponse{}
+	if f.rejected > 0 {
+		resp.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{RejectedDataPoints: f.rejected, ErrorMessage: "bad"}
+	}
+	return resp, nil
+}
+
+func startReceiver(t *testing.T) (*fakeReceiver, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	f := &fakeReceiver{reqs: make(chan *colmetricspb.ExportMetricsServiceRequest, 1), md: make(chan metadata.MD, 1)}
+	colmetricspb.RegisterMetricsServiceServer(srv, f)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	return f, lis.Addr().String()
+}
+
+func TestExporter_MapsResourcesAndInstruments(t *testing.T) {
+	recv, addr := startReceiver(t)
+	e, err := New(Config{Endpoint: addr, Headers: map[string]string{"x-api-key": "k"}, Counters: []string{"energy"}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer e.Close()
+
+	ts := time.Unix(1700000000, 0)
+	items := []model.Telemetry{
+		{GPUId: "0", HostId: "node-1", ProducerId: "s1", Timestamp: ts, Metrics: map[string]float64{"temp": 60, "energy": 10}, Labels: map[string]string{"model": "H100"}},
+		{GPUId: "0", HostId: "node-1", ProducerId: "s1", Timestamp: ts.Add(time.Second), Metrics: map[string]float64{"temp": 61}, Labels: map[string]string{"model": "H100"}},
+		{GPUId: "1", HostId: "node-1", Timestamp: ts, Metrics: map[string]float64{"temp": 50}},
+	}
+	if err := e.Export(context.Background(), items); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	req := <-recv.reqs
+	if md := <-recv.md; len(md.Get("x-api-key")) != 1 {
+		t.Fatalf("header not sent: %v", md)
+	}
+
+	if len(req.ResourceMetrics) != 2 {
+		t.Fatalf("expected 2 resources (one per gpu), got %d", len(req.ResourceMetrics))
+	}
+	rm := req.ResourceMetrics[0]
+	attrs := map[string]string{}
+	for _, kv := range rm.Resource.Attributes {
+		attrs[kv.Key] = kv.Value.GetStringValue()
+	}
+	if attrs[AttrGPUID] != "0" || attrs[AttrHostID] != "node-1" || attrs[AttrProducerID] != "s1" || attrs["model"] != "H100" {
+		t.Fatalf("unexpected resource attributes: %v", attrs)
+	}
+	metrics := rm.ScopeMetrics[0].Metrics
+	if len(metrics) != 2 || metrics[0].Name != "energy" || metrics[1].Name != "temp" {
+		t.Fatalf("unexpected instruments: %v", metrics)
+	}
+	if s := metrics[0].GetSum(); s == nil || !s.IsMonotonic || len(s.DataPoints) != 1 {
+		t.Fatalf("energy should be a monotonic sum: %v", metrics[0])
+	}
+	g := metrics[1].GetGauge()
+	if g == nil || len(g.DataPoints) != 2 || g.DataPoints[1].GetAsDouble() != 61 || g.DataPoints[1].TimeUnixNano != uint64(ts.Add(time.Second).UnixNano()) {
+		t.Fatalf("temp should be a gauge with 2 points: %v", metrics[1])
+	}
+}
+
+func TestExporter_PartialSuccessIsError(t *testing.T) {
+	recv, addr := startReceiver(t)
+	recv.rejected = 1
+	e, err := New(Config{Endpoint: addr})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer e.Close()
+	err = e.Export(context.Background(), []model.Telemetry{{GPUId: "0", Timestamp: time.Now(), Metrics: map[string]float64{"temp": 1}}})
+	if err == nil {
+		t.Fatal("expected error for rejected data points")
+	}
+}
+
+func TestNew_RequiresEndpoint(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Fatal("expected error without endpoint")
+	}
+}
@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// Emit hands derived telemetry (rollups, anomaly events, ...) to the named sink.
+type Emit func(sink string, items []model.Telemetry)
+
+// Processor is one pipeline stage.
+type Processor interface {
+	Name() string
+	// Process may modify t in place. Returning false drops the sample and
+	// stops the pipeline for it.
+	Process(t *model.Telemetry, emit Emit) bool
+}
+
+// Flusher is implemented by stages that buffer state (e.g. open rollup windows)
+// which must be drained on shutdown.
+type Flusher interface {
+	Flush(emit Emit)
+}
+
+// Pipeline runs samples through processors in order. A nil *Pipeline passes
+// everything through unchanged.
+type Pipeline struct {
+	stages []Processor
+}
+
+func New(stages ...Processor) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Names lists the stages in execution order.
+func (p *Pipeline) Names() []string {
+	if p == nil {
+		return nil
+	}
+	out := make([]string, len(p.stages))
+	for i, s := range p.stages {
+		out[i] = s.Name()
+	}
+	return out
+}
+
+// Process runs t through every stage. When a stage drops t, keep is false and
+// droppedBy names that stage.
+func (p *Pipeline) Process(t *model.Telemetry, emit Emit) (keep bool, droppedBy string) {
+	if p == nil {
+		return true, ""
+	}
+	for _, s := range p.stages {
+		if !s.Process(t, emit) {
+			return false, s.Name()
+		}
+	}
+	return true, ""
+}
+
+// Flush drains every stage that implements Flusher, in order.
+func (p *Pipeline) Flush(emit Emit) {
+	if p == nil {
+		return
+	}
+	for _, s := range p.stages {
+		if f, ok := s.(Flusher); ok {
+			f.Flush(emit)
+		}
+	}
+}
+
+// Factory builds a configured stage. Returning a nil Processor and nil error
+// means the stage is not configured and is left out of the pipeline.
+type Factory func() (Processor, error)
+
+// Registry maps stage names to factories so pipelines can be assembled from config.
+type Registry struct {
+	factories map[string]Factory
+}
+
+func NewRegistry() *Registry {
+	return &Registry{factories: map[string]Factory{}}
+}
+
+// Register adds or replaces the factory for name.
+func (r *Registry) Register(name string, f Factory) {
+	r.factories[name] = f
+}
+
+// Names lists registered stage names, sorted.
+func (r *Registry) Names() []string {
+	out := make([]string, 0, len(r.factories))
+	for n := range r.factories {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Build assembles a pipeline from stage names in order, skipping stages whose
+// factory reports them as unconfigured.
+func (r *Registry) Build(names []string) (*Pipeline, error) {
+	var stages []Processor
+	seen := map[string]bool{}
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		if seen[n] {
+			return nil, fmt.Errorf("pipeline: stage %q listed twice", n)
+		}
+		seen[n] = true
+		f, ok := r.factories[n]
+		if !ok {
+			return nil, fmt.Errorf("pipeline: unknown stage %q (known: %s)", n, strings.Join(r.Names(), ", "))
+		}
+		p, err := f()
+		if err != nil {
+			return nil, fmt.Errorf("pipeline: stage %s: %w", n, err)
+		}
+		if p != nil {
+			stages = append(stages, p)
+		}
+	}
+	return New(stages...), nil
+}
@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+type tagStage struct{ name string }
+
+func (s tagStage) Name() string { return s.name }
+
+func (s tagStage) Process(t *model.Telemetry, _ Emit) bool {
+	if t.Labels == nil {
+		t.Labels = map[string]string{}
+	}
+	t.Labels["order"] += s.name
+	return t.Labels["drop"] != s.name
+}
+
+func TestRegistry_BuildInOrderSkippingUnconfigured(t *testing.T) {
+	r := NewRegistry()
+	r.Register("a", func() (Processor, error) { return tagStage{"a"}, nil })
+	r.Register("b", func() (Processor, error) { return tagStage{"b"}, nil })
+	r.Register("off", func() (Processor, error) { return nil, nil })
+
+	p, err := r.Build([]string{"b", " off", "a"})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if got := p.Names(); !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Fatalf("names = %v", got)
+	}
+	tel := model.Telemetry{}
+	if keep, _ := p.Process(&tel, nil); !keep || tel.Labels["order"] != "ba" {
+		t.Fatalf("keep=%v order=%q", keep, tel.Labels["order"])
+	}
+
+	tel = model.Telemetry{Labels: map[string]string{"drop": "b"}}
+	keep, by := p.Process(&tel, nil)
+	if keep || by != "b" || tel.Labels["order"] != "b" {
+		t.Fatalf("expected drop by b before a ran, got keep=%v by=%q order=%q", keep, by, tel.Labels["order"])
+	}
+}
+
+func TestRegistry_BuildErrors(t *testing.T) {
+	r := NewRegistry()
+	r.Register("a", func() (Processor, error) { return tagStage{"a"}, nil })
+	if _, err := r.Build([]string{"nope"}); err == nil {
+		t.Fatal("expected error for unknown stage")
+	}
+	if _, err := r.Build([]string{"a", "a"}); err == nil {
+		t.Fatal("expected error for duplicate stage")
+	}
+}
+
+func TestNilPipelinePassesThrough(t *testing.T) {
+	var p *Pipeline
+	if keep, _ := p.Process(&model.Telemetry{}, nil); !keep {
+		t.Fatal("nil pipeline must keep samples")
+	}
+	p.Flush(nil)
+}
+
+func TestDedup(t *testing.T) {
+	d := NewDedup(2)
+	ts := time.Unix(100, 0)
+	seq := []struct {
+		t    model.Telemetry
+		keep bool
+	}{
+		{model.Telemetry{IdempotencyKey: "k1"}, true},
+		{model.Telemetry{IdempotencyKey: "k1"}, false},
+		{model.Telemetry{GPUId: "g", Timestamp: ts}, true},
+		{model.Telemetry{GPUId: "g", Timestamp: ts}, false},
+		{model.Telemetry{IdempotencyKey: "k2"}, true},
+		// k1 has been evicted from the window of 2
+		{model.Telemetry{IdempotencyKey: "k1"}, true},
+	}
+	for i, c := range seq {
+		if got := d.Process(&c.t, nil); got != c.keep {
+			t.Fatalf("step %d: keep=%v want %v", i, got, c.keep)
+		}
+	}
+}
+
+func TestTransform_ScaleOffsetRename(t *testing.T) {
+	tr := NewTransform([]TransformRule{
+		{Metric: "power_mw", Rename: "power_w", Scale: 0.001},
+		{Metric: "temp_f", Scale: 5.0 / 9, Offset: -32 * 5.0 / 9},
+		{Metric: "util", Offset: 1},
+	})
+	tel := model.Telemetry{Metrics: map[string]float64{"power_mw": 250000, "temp_f": 212, "util": 1, "other": 7}}
+	if !tr.Process(&tel, nil) {
+		t.Fatal("transform must not drop")
+	}
+	want := map[string]float64{"power_w": 250, "temp_f": 100, "util": 2, "other": 7}
+	for k, v := range want {
+		if got := tel.Metrics[k]; got < v-1e-9 || got > v+1e-9 {
+			t.Fatalf("%s = %v want %v (metrics %v)", k, got, v, tel.Metrics)
+		}
+	}
+	if _, ok := tel.Metrics["power_mw"]; ok {
+		t.Fatal("renamed metric should be removed")
+	}
+}
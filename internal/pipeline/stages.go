@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"container/list"
+	"strconv"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// Dedup drops samples already seen among the most recent Size samples. Samples
+// are identified by their idempotency key, or by gpu/producer/timestamp without one.
+type Dedup struct {
+	size  int
+	order *list.List
+	seen  map[string]*list.Element
+}
+
+func NewDedup(size int) *Dedup {
+	return &Dedup{size: size, order: list.New(), seen: make(map[string]*list.Element, size)}
+}
+
+func (d *Dedup) Name() string { return "dedup" }
+
+func (d *Dedup) Process(t *model.Telemetry, _ Emit) bool {
+	k := t.IdempotencyKey
+	if k == "" {
+		k = t.GPUId + "|" + t.ProducerId + "|" + strconv.FormatInt(t.Timestamp.UnixNano(), 10)
+	}
+	if _, dup := d.seen[k]; dup {
+		return false
+	}
+	d.seen[k] = d.order.PushBack(k)
+	if d.order.Len() > d.size {
+		oldest := d.order.Front()
+		d.order.Remove(oldest)
+		delete(d.seen, oldest.Value.(string))
+	}
+	return true
+}
+
+// TransformRule rewrites one metric: value*Scale + Offset, optionally renamed.
+// A zero Scale is treated as 1.
+type TransformRule struct {
+	Metric string  `yaml:"metric"`
+	Rename string  `yaml:"rename"`
+	Scale  float64 `yaml:"scale"`
+	Offset float64 `yaml:"offset"`
+}
+
+// Transform applies unit conversions and renames, e.g. mW → W with Scale 0.001.
+type Transform struct {
+	rules map[string]TransformRule
+}
+
+func NewTransform(rules []TransformRule) *Transform {
+	m := make(map[string]TransformRule, len(rules))
+	for _, r := range rules {
+		if r.Scale == 0 {
+			r.Scale = 1
+		}
+		m[r.Metric] = r
+	}
+	return &Transform{rules: m}
+}
+
+func (tr *Transform) Name() string { return "transform" }
+
+func (tr *Transform) Process(t *model.Telemetry, _ Emit) bool {
+	var renamed map[string]float64
+	for name, v := range t.Metrics {
+		r, ok := tr.rules[name]
+		if !ok {
+			continue
+		}
+		v = v*r.Scale + r.Offset
+		if r.Rename != "" && r.Rename != name {
+			delete(t.Metrics, name)
+			if renamed == nil {
+				renamed = map[string]float64{}
+			}
+			renamed[r.Rename] = v
+			continue
+		}
+		t.Metrics[name] = v
+	}
+	for k, v := range renamed {
+		t.Metrics[k] = v
+	}
+	return true
+}
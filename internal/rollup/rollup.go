@@ -0,0 +1,172 @@
+package rollup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// Wildcard matches every metric that has no explicit rule in a Spec.
+const Wildcard = "*"
+
+// Spec maps a metric name to the rollup windows computed for it.
+// The Wildcard entry, when present, applies to all other metrics.
+type Spec map[string][]time.Duration
+
+// ParseSpec parses a rollup specification of the form
+// "metric=1m,5m;other=5m;*=5m". An empty string yields an empty Spec.
+func ParseSpec(s string) (Spec, error) {
+	spec := Spec{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, windows, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("rollup: invalid entry %q (want metric=window[,window])", entry)
+		}
+		for _, w := range strings.Split(windows, ",") {
+			d, err := time.ParseDuration(strings.TrimSpace(w))
+			if err != nil {
+				return nil, fmt.Errorf("rollup: metric %s: %w", name, err)
+			}
+			if d <= 0 {
+				return nil, fmt.Errorf("rollup: metric %s: window must be positive", name)
+			}
+			spec[name] = append(spec[name], d)
+		}
+	}
+	return spec, nil
+}
+
+// Windows returns the distinct windows referenced by the spec, ascending.
+func (s Spec) Windows() []time.Duration {
+	set := map[time.Duration]struct{}{}
+	for _, ws := range s {
+		for _, w := range ws {
+			set[w] = struct{}{}
+		}
+	}
+	out := make([]time.Duration, 0, len(set))
+	for w := range set {
+		out = append(out, w)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Name renders a window compactly for use in measurement or table names, e.g. "1m", "5m", "1h".
+func Name(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+func (s Spec) windowsFor(metric string) []time.Duration {
+	if ws, ok := s[metric]; ok {
+		return ws
+	}
+	return s[Wildcard]
+}
+
+// Point is a closed rollup window for one GPU. Metrics carries
+// <metric>_min, <metric>_max and <metric>_avg for every metric seen in the window,
+// and Timestamp is the window start.
+type Point struct {
+	Window time.Duration
+	model.Telemetry
+}
+
+type key struct {
+	gpuID  string
+	window time.Duration
+}
+
+type stat struct {
+	min, max, sum float64
+	n             int
+}
+
+type bucket struct {
+	start time.Time
+	stats map[string]*stat
+}
+
+// Aggregator folds raw telemetry into fixed, event-time aligned windows per GPU.
+// It is not safe for concurrent use.
+type Aggregator struct {
+	spec Spec
+	open map[key]*bucket
+}
+
+func NewAggregator(spec Spec) *Aggregator {
+	return &Aggregator{spec: spec, open: make(map[key]*bucket)}
+}
+
+// Add folds t into its open windows and returns any windows that t closed.
+// Samples older than the currently open window are ignored for rollup purposes.
+func (a *Aggregator) Add(t model.Telemetry) []Point {
+	var out []Point
+	for name, v := range t.Metrics {
+		for _, w := range a.spec.windowsFor(name) {
+			k := key{gpuID: t.GPUId, window: w}
+			start := t.Timestamp.Truncate(w)
+			b := a.open[k]
+			if b != nil && start.After(b.start) {
+				out = append(out, b.point(k))
+				b = nil
+			}
+			if b == nil {
+				b = &bucket{start: start, stats: map[string]*stat{}}
+				a.open[k] = b
+			}
+			if start.Before(b.start) {
+				continue
+			}
+			st := b.stats[name]
+			if st == nil {
+				st = &stat{min: v, max: v}
+				b.stats[name] = st
+			}
+			if v < st.min {
+				st.min = v
+			}
+			if v > st.max {
+				st.max = v
+			}
+			st.sum += v
+			st.n++
+		}
+	}
+	return out
+}
+
+// Flush closes and returns every open window.
+func (a *Aggregator) Flush() []Point {
+	out := make([]Point, 0, len(a.open))
+	for k, b := range a.open {
+		out = append(out, b.point(k))
+	}
+	a.open = make(map[key]*bucket)
+	return out
+}
+
+func (b *bucket) point(k key) Point {
+	metrics := make(map[string]float64, len(b.stats)*3)
+	for name, st := range b.stats {
+		metrics[name+"_min"] = st.min
+		metrics[name+"_max"] = st.max
+		metrics[name+"_avg"] = st.sum / float64(st.n)
+	}
+	return Point{Window: k.window, Telemetry: model.Telemetry{GPUId: k.gpuID, Timestamp: b.start, Metrics: metrics}}
+}
@@ -0,0 +1,76 @@
+package rollup
+
+import (
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+func TestParseSpec(t *testing.T) {
+	spec, err := ParseSpec("temp=1m,5m; *=5m")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(spec["temp"]) != 2 || spec["temp"][0] != time.Minute || spec["temp"][1] != 5*time.Minute {
+		t.Fatalf("unexpected temp windows: %v", spec["temp"])
+	}
+	if ws := spec.Windows(); len(ws) != 2 {
+		t.Fatalf("expected 2 distinct windows, got %v", ws)
+	}
+	if _, err := ParseSpec("temp"); err == nil {
+		t.Fatalf("expected error for entry without windows")
+	}
+	if _, err := ParseSpec("temp=-1m"); err == nil {
+		t.Fatalf("expected error for negative window")
+	}
+}
+
+func TestName(t *testing.T) {
+	cases := map[time.Duration]string{time.Minute: "1m", 5 * time.Minute: "5m", time.Hour: "1h", 30 * time.Second: "30s"}
+	for d, want := range cases {
+		if got := Name(d); got != want {
+			t.Fatalf("Name(%s)=%s want %s", d, got, want)
+		}
+	}
+}
+
+func TestAggregator_ClosesWindowOnNextBucket(t *testing.T) {
+	a := NewAggregator(Spec{"temp": {time.Minute}})
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	for i, v := range []float64{60, 70, 80} {
+		if out := a.Add(model.Telemetry{GPUId: "g1", Timestamp: base.Add(time.Duration(i) * 10 * time.Second), Metrics: map[string]float64{"temp": v, "power": 1}}); len(out) != 0 {
+			t.Fatalf("unexpected early rollup: %#v", out)
+		}
+	}
+	out := a.Add(model.Telemetry{GPUId: "g1", Timestamp: base.Add(time.Minute), Metrics: map[string]float64{"temp": 90}})
+	if len(out) != 1 {
+		t.Fatalf("expected 1 closed window, got %d", len(out))
+	}
+	p := out[0]
+	if p.Window != time.Minute || !p.Timestamp.Equal(base) || p.GPUId != "g1" {
+		t.Fatalf("unexpected point header: %#v", p)
+	}
+	if p.Metrics["temp_min"] != 60 || p.Metrics["temp_max"] != 80 || p.Metrics["temp_avg"] != 70 {
+		t.Fatalf("unexpected stats: %#v", p.Metrics)
+	}
+	if _, ok := p.Metrics["power_avg"]; ok {
+		t.Fatalf("power has no rule and should not be rolled up")
+	}
+	rest := a.Flush()
+	if len(rest) != 1 || rest[0].Metrics["temp_avg"] != 90 {
+		t.Fatalf("unexpected flush: %#v", rest)
+	}
+}
+
+func TestAggregator_WildcardAndLateSamples(t *testing.T) {
+	a := NewAggregator(Spec{Wildcard: {time.Minute}})
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	a.Add(model.Telemetry{GPUId: "g1", Timestamp: base.Add(time.Minute), Metrics: map[string]float64{"power": 200}})
+	// late sample for an earlier window is ignored
+	a.Add(model.Telemetry{GPUId: "g1", Timestamp: base, Metrics: map[string]float64{"power": 999}})
+	out := a.Flush()
+	if len(out) != 1 || out[0].Metrics["power_max"] != 200 {
+		t.Fatalf("unexpected flush: %#v", out)
+	}
+}
@@ -0,0 +1,22 @@
+// Package shard maps GPUs to collector shards. The broker routes each message
+// to a subscriber owning its shard, so every GPU is processed by exactly one
+// collector of a sharded group.
+package shard
+
+import "hash/crc32"
+
+// Of returns the shard in [0, count) that owns gpuID. It hashes with CRC-32
+// rather than the FNV-1a used to pick a collector worker; FNV variants agree in
+// their low bits, which would put all of a shard's GPUs on one worker.
+func Of(gpuID string, count uint32) uint32 {
+	if count == 0 {
+		return 0
+	}
+	return crc32.ChecksumIEEE([]byte(gpuID)) % count
+}
+
+// Owns reports whether shard index of count receives gpuID; count 0 means
+// unsharded and owns every GPU.
+func Owns(index, count uint32, gpuID string) bool {
+	return count == 0 || Of(gpuID, count) == index
+}
@@ -0,0 +1,51 @@
+package shard
+
+import (
+	"fmt"
+	"hash/fnv"
+	"testing"
+)
+
+func TestOf_PartitionsEveryGPUOnce(t *testing.T) {
+	const count = 4
+	perShard := make([]int, count)
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("gpu-%d", i)
+		owners := 0
+		for s := uint32(0); s < count; s++ {
+			if Owns(s, count, id) {
+				owners++
+				perShard[s]++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("%s owned by %d shards", id, owners)
+		}
+	}
+	for s, n := range perShard {
+		if n < 150 {
+			t.Fatalf("shard %d got only %d of 1000 GPUs", s, n)
+		}
+	}
+	if !Owns(3, 0, "gpu-1") {
+		t.Fatal("unsharded subscriber must own every GPU")
+	}
+}
+
+func TestOf_IndependentOfWorkerHash(t *testing.T) {
+	// Scenario: 4 shards, each collector running 4 workers (32-bit FNV-1a, as in the collector)
+	// Expect: one shard's GPUs still land on every worker
+	workers := map[uint32]bool{}
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("gpu-%d", i)
+		if Of(id, 4) != 0 {
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(id))
+		workers[h.Sum32()%4] = true
+	}
+	if len(workers) != 4 {
+		t.Fatalf("shard 0 GPUs only reach workers %v", workers)
+	}
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AggregateQuery reduces one metric of one GPU to a value per step-wide
+// bucket, aligned to the Unix epoch as for Query.Step.
+type AggregateQuery struct {
+	Metric string
+	// Start and End bound the window, both inclusive.
+	Start, End *time.Time
+	// Step is the bucket width; it must be positive.
+	Step time.Duration
+	// Agg is one of the Agg* names; empty means AggAvg.
+	Agg string
+	// Scope, if set, aggregates only points it allows.
+	Scope *Scope
+}
+
+// Bucket is one step of an aggregated series, timestamped at its start.
+type Bucket struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// AggregateQuerier is implemented by stores that can aggregate a metric per
+// time bucket in the backend.
+type AggregateQuerier interface {
+	AggregateTelemetry(gpuID string, q AggregateQuery) ([]Bucket, error)
+}
+
+// Aggregate returns gpuID's q.Metric reduced with q.Agg per bucket, ordered
+// by time; buckets without points are left out. Stores without an
+// AggregateQuerier read the metric's raw points and aggregate them here.
+func Aggregate(s Store, gpuID string, q AggregateQuery) ([]Bucket, error) {
+	if q.Agg == "" {
+		q.Agg = AggAvg
+	}
+	if !ValidAgg(q.Agg) {
+		return nil, fmt.Errorf("unknown aggregation %q", q.Agg)
+	}
+	if q.Step <= 0 {
+		return nil, errors.New("aggregate step must be positive")
+	}
+	if aq, ok := s.(AggregateQuerier); ok {
+		return aq.AggregateTelemetry(gpuID, q)
+	}
+	items, err := Execute(s, gpuID, Query{Start: q.Start, End: q.End, Scope: q.Scope, Metrics: []string{q.Metric}})
+	if err != nil {
+		return nil, err
+	}
+	var out []Bucket
+	var n int
+	for _, it := range items { // time-ordered, so buckets are too and last wins
+		v, ok := it.Metrics[q.Metric]
+		if !ok {
+			continue
+		}
+		b := BucketStart(it.Timestamp, q.Step)
+		if len(out) == 0 || !out[len(out)-1].Timestamp.Equal(b) {
+			if len(out) > 0 && q.Agg == AggAvg {
+				out[len(out)-1].Value /= float64(n)
+			}
+			out = append(out, Bucket{Timestamp: b, Value: v})
+			n = 1
+			continue
+		}
+		cur := &out[len(out)-1]
+		n++
+		switch q.Agg {
+		case AggAvg:
+			cur.Value += v
+		case AggMax:
+			cur.Value = max(cur.Value, v)
+		case AggMin:
+			cur.Value = min(cur.Value, v)
+		case AggLast:
+			cur.Value = v
+		}
+	}
+	if len(out) > 0 && q.Agg == AggAvg {
+		out[len(out)-1].Value /= float64(n)
+	}
+	return out, nil
+}
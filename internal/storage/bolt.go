@@ -0,0 +1,683 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of a BoltStore file. Points are kept in one nested bucket per GPU
+// under boltTelemetry, keyed by boltTime and a sequence number so a cursor
+// walks them in time order.
+var (
+	boltTelemetry = []byte("telemetry")
+	boltIdem      = []byte("idempotency") // key -> the point's timestamp
+	boltRules     = []byte("alert_rules")
+	boltWebhooks  = []byte("webhooks")
+	boltInventory = []byte("gpu_inventory")
+)
+
+// boltCheckEvery is how many points a scan reads between checks of its
+// context; bbolt itself cannot be interrupted.
+const boltCheckEvery = 4096
+
+// BoltStore implements Store in an embedded bbolt file, for single-node
+// deployments that need durable storage without running a database. Writes
+// of a batch share one transaction and one fsync. The file is locked by the
+// process that opens it, so only one process can use it at a time.
+type BoltStore struct {
+	db  *bolt.DB
+	ctx context.Context // nil means context.Background()
+}
+
+// NewBoltStore opens (and creates) the bbolt file at path. It fails after a
+// few seconds if another process holds the file.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{boltTelemetry, boltIdem, boltRules, boltWebhooks, boltInventory} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("init bolt: %w", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Close closes the file; views from WithContext share it.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// WithContext returns a view of s whose scans stop, with ctx's error, when
+// ctx is cancelled or its deadline passes.
+func (s *BoltStore) WithContext(ctx context.Context) Store {
+	return &BoltStore{db: s.db, ctx: ctx}
+}
+
+func (s *BoltStore) callCtx() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+// Ping fails once the file is closed.
+func (s *BoltStore) Ping(ctx context.Context) error {
+	return s.db.View(func(*bolt.Tx) error { return ctx.Err() })
+}
+
+func (s *BoltStore) SaveTelemetry(t model.Telemetry) error {
+	return s.SaveTelemetryBatch([]model.Telemetry{t})
+}
+
+// SaveTelemetryBatch writes items in one transaction. Points whose
+// idempotency key is already stored are skipped, so redelivered messages
+// are written once. Points without a GPU are reported in a *BatchError and
+// the rest are still committed.
+func (s *BoltStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	if len(items) == 0 {
+		return nil
+	}
+	var failed map[int]error
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		failed = nil // a retried transaction starts over
+		root, idem := tx.Bucket(boltTelemetry), tx.Bucket(boltIdem)
+		for i, t := range items {
+			if t.GPUId == "" {
+				if failed == nil {
+					failed = map[int]error{}
+				}
+				failed[i] = errors.New("bolt save telemetry: missing gpu_id")
+				continue
+			}
+			ts := boltTime(t.Timestamp)
+			if t.IdempotencyKey != "" {
+				if idem.Get([]byte(t.IdempotencyKey)) != nil {
+					continue
+				}
+				if err := idem.Put([]byte(t.IdempotencyKey), ts[:]); err != nil {
+					return err
+				}
+			}
+			b, err := root.CreateBucketIfNotExists([]byte(t.GPUId))
+			if err != nil {
+				return err
+			}
+			// the sequence keeps points with equal timestamps apart, in insertion order
+			seq, _ := b.NextSequence()
+			key := binary.BigEndian.AppendUint64(ts[:], seq)
+			if err := b.Put(key, encodeBoltPoint(t)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("bolt save telemetry: %w", err)
+	}
+	if failed != nil {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+func (s *BoltStore) ListGPUs() ([]string, error) {
+	var out []string
+	err := s.view(func(tx *bolt.Tx, _ func() error) error {
+		return tx.Bucket(boltTelemetry).ForEachBucket(func(k []byte) error {
+			out = append(out, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt list gpus: %w", err)
+	}
+	return out, nil
+}
+
+// ListGPUsIn lists the GPUs with at least one point in sc, reading each
+// GPU's points until one is found.
+func (s *BoltStore) ListGPUsIn(sc Scope) ([]string, error) {
+	var out []string
+	err := s.view(func(tx *bolt.Tx, check func() error) error {
+		root := tx.Bucket(boltTelemetry)
+		return root.ForEachBucket(func(id []byte) error {
+			c := root.Bucket(id).Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				if err := check(); err != nil {
+					return err
+				}
+				t, err := decodeBoltPoint(string(id), k, v)
+				if err != nil {
+					return err
+				}
+				if sc.Allows(t) {
+					out = append(out, string(id))
+					break
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt list gpus: %w", err)
+	}
+	return out, nil
+}
+
+func (s *BoltStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
+	return s.QueryTelemetryWith(gpuID, Query{Start: start, End: end})
+}
+
+// QueryTelemetryWith reads only the window of the GPU's bucket; the rest of
+// q is applied to the points read.
+func (s *BoltStore) QueryTelemetryWith(gpuID string, q Query) ([]model.Telemetry, error) {
+	return s.QueryFleet([]string{gpuID}, q)
+}
+
+// QueryFleet is QueryTelemetryWith over several GPUs (all when gpuIDs is
+// empty), ordered by time, then GPU.
+func (s *BoltStore) QueryFleet(gpuIDs []string, q Query) ([]model.Telemetry, error) {
+	filter := Query{HostIDs: q.HostIDs, ProducerIDs: q.ProducerIDs, Labels: q.Labels, Scope: q.Scope, Metrics: q.Metrics}
+	var end []byte
+	if q.End != nil {
+		end = boltTimeBytes(*q.End)
+	}
+	var items []model.Telemetry
+	err := s.view(func(tx *bolt.Tx, check func() error) error {
+		root := tx.Bucket(boltTelemetry)
+		ids := gpuIDs
+		if len(ids) == 0 {
+			_ = root.ForEachBucket(func(k []byte) error {
+				ids = append(ids, string(k))
+				return nil
+			})
+		}
+		for _, id := range ids {
+			b := root.Bucket([]byte(id))
+			if b == nil {
+				continue
+			}
+			var its []model.Telemetry
+			c := b.Cursor()
+			k, v := c.First()
+			if q.Start != nil {
+				from := boltTime(*q.Start)
+				k, v = c.Seek(from[:])
+			}
+			for ; k != nil; k, v = c.Next() {
+				if err := check(); err != nil {
+					return err
+				}
+				if end != nil && bytes.Compare(k[:8], end) > 0 {
+					break
+				}
+				t, err := decodeBoltPoint(id, k, v)
+				if err != nil {
+					return err
+				}
+				its = append(its, t)
+			}
+			its = Apply(its, filter)
+			if q.Step > 0 {
+				its = Downsample(its, q.Step)
+				for i := range its {
+					its[i].GPUId = id
+				}
+			}
+			items = append(items, its...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt query telemetry: %w", err)
+	}
+	sortFleet(items)
+	return Page(items, q.Desc, q.Offset, q.Limit), nil
+}
+
+// LatestTelemetry reads the last key of the GPU's bucket.
+func (s *BoltStore) LatestTelemetry(gpuID string) (*model.Telemetry, error) {
+	out, err := s.QueryLatest([]string{gpuID}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return out[gpuID], nil
+}
+
+// QueryLatest walks each GPU's bucket back from its last key, to the newest
+// point sc allows when sc is set.
+func (s *BoltStore) QueryLatest(gpuIDs []string, sc *Scope) (map[string]*model.Telemetry, error) {
+	out := make(map[string]*model.Telemetry, len(gpuIDs))
+	err := s.view(func(tx *bolt.Tx, check func() error) error {
+		root := tx.Bucket(boltTelemetry)
+		for _, id := range gpuIDs {
+			b := root.Bucket([]byte(id))
+			if b == nil {
+				continue
+			}
+			c := b.Cursor()
+			for k, v := c.Last(); k != nil; k, v = c.Prev() {
+				if err := check(); err != nil {
+					return err
+				}
+				t, err := decodeBoltPoint(id, k, v)
+				if err != nil {
+					return err
+				}
+				if sc == nil || sc.Allows(t) {
+					out[id] = &t
+					break
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt query latest telemetry: %w", err)
+	}
+	return out, nil
+}
+
+// DeleteTelemetry removes a GPU's whole bucket, or the keys before before.
+// Idempotency keys are kept, as in MemoryStore, except when points of every
+// GPU are deleted by age: then the keys of the deleted points go too.
+func (s *BoltStore) DeleteTelemetry(gpuID string, before time.Time) (int64, error) {
+	var n int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(boltTelemetry)
+		var ids [][]byte
+		if gpuID != "" {
+			ids = [][]byte{[]byte(gpuID)}
+		} else {
+			_ = root.ForEachBucket(func(k []byte) error {
+				ids = append(ids, append([]byte(nil), k...))
+				return nil
+			})
+		}
+		for _, id := range ids {
+			b := root.Bucket(id)
+			if b == nil {
+				continue
+			}
+			if before.IsZero() {
+				n += int64(b.Stats().KeyN)
+				if err := root.DeleteBucket(id); err != nil {
+					return err
+				}
+				continue
+			}
+			limit := boltTimeBytes(before)
+			c := b.Cursor()
+			// Delete moves the cursor onto the next key
+			for k, _ := c.First(); k != nil && bytes.Compare(k[:8], limit) < 0; k, _ = c.First() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				n++
+			}
+			if k, _ := c.First(); k == nil {
+				if err := root.DeleteBucket(id); err != nil {
+					return err
+				}
+			}
+		}
+		if gpuID == "" && !before.IsZero() {
+			limit := boltTimeBytes(before)
+			idem := tx.Bucket(boltIdem)
+			var expired [][]byte
+			_ = idem.ForEach(func(k, v []byte) error {
+				if bytes.Compare(v, limit) < 0 {
+					expired = append(expired, append([]byte(nil), k...))
+				}
+				return nil
+			})
+			for _, k := range expired {
+				if err := idem.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("bolt delete telemetry: %w", err)
+	}
+	return n, nil
+}
+
+// DeleteMetrics rewrites each matching point without metrics, or deletes it
+// when none are left. Idempotency keys are kept.
+func (s *BoltStore) DeleteMetrics(gpuID string, metrics []string, before time.Time) (int64, error) {
+	var n int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(boltTelemetry)
+		var ids [][]byte
+		if gpuID != "" {
+			ids = [][]byte{[]byte(gpuID)}
+		} else {
+			_ = root.ForEachBucket(func(k []byte) error {
+				ids = append(ids, append([]byte(nil), k...))
+				return nil
+			})
+		}
+		for _, id := range ids {
+			b := root.Bucket(id)
+			if b == nil {
+				continue
+			}
+			// a bucket cannot be changed while a cursor walks it
+			changed := map[string][]byte{} // key -> new value, nil to delete
+			c := b.Cursor()
+			for k, v := c.First(); k != nil && (before.IsZero() || bytes.Compare(k[:8], boltTimeBytes(before)) < 0); k, v = c.Next() {
+				t, err := decodeBoltPoint(string(id), k, v)
+				if err != nil {
+					return err
+				}
+				var dropped int
+				if t.Metrics, dropped = withoutMetrics(t.Metrics, metrics); dropped == 0 {
+					continue
+				}
+				n += int64(dropped)
+				if len(t.Metrics) == 0 && len(t.Values) == 0 {
+					changed[string(k)] = nil
+				} else {
+					changed[string(k)] = encodeBoltPoint(t)
+				}
+			}
+			for k, v := range changed {
+				var err error
+				if v == nil {
+					err = b.Delete([]byte(k))
+				} else {
+					err = b.Put([]byte(k), v)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if k, _ := b.Cursor().First(); k == nil {
+				if err := root.DeleteBucket(id); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("bolt delete metrics: %w", err)
+	}
+	return n, nil
+}
+
+func (s *BoltStore) SaveRule(id string, doc []byte) error { return s.saveDoc(boltRules, id, doc) }
+
+func (s *BoltStore) DeleteRule(id string) (bool, error) { return s.deleteDoc(boltRules, id) }
+
+func (s *BoltStore) ListRules() (map[string][]byte, error) { return s.listDocs(boltRules) }
+
+func (s *BoltStore) SaveWebhook(id string, doc []byte) error { return s.saveDoc(boltWebhooks, id, doc) }
+
+func (s *BoltStore) DeleteWebhook(id string) (bool, error) { return s.deleteDoc(boltWebhooks, id) }
+
+func (s *BoltStore) ListWebhooks() (map[string][]byte, error) { return s.listDocs(boltWebhooks) }
+
+func (s *BoltStore) SaveGPUInfo(gpuID string, doc []byte) error {
+	return s.saveDoc(boltInventory, gpuID, doc)
+}
+
+func (s *BoltStore) ListGPUInfo() (map[string][]byte, error) { return s.listDocs(boltInventory) }
+
+// saveDoc, deleteDoc and listDocs work on the buckets of opaque JSON
+// documents keyed by id.
+func (s *BoltStore) saveDoc(bucket []byte, id string, doc []byte) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(id), doc)
+	})
+	if err != nil {
+		return fmt.Errorf("bolt save into %s: %w", bucket, err)
+	}
+	return nil
+}
+
+func (s *BoltStore) deleteDoc(bucket []byte, id string) (bool, error) {
+	var found bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if found = b.Get([]byte(id)) != nil; !found {
+			return nil
+		}
+		return b.Delete([]byte(id))
+	})
+	if err != nil {
+		return false, fmt.Errorf("bolt delete from %s: %w", bucket, err)
+	}
+	return found, nil
+}
+
+func (s *BoltStore) listDocs(bucket []byte) (map[string][]byte, error) {
+	out := map[string][]byte{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+			// values are only valid during the transaction
+			out[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt list %s: %w", bucket, err)
+	}
+	return out, nil
+}
+
+// view runs fn in a read transaction. fn calls check as it scans, which
+// fails once the store's context is done.
+func (s *BoltStore) view(fn func(tx *bolt.Tx, check func() error) error) error {
+	ctx := s.callCtx()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var n int
+	check := func() error {
+		if n++; n%boltCheckEvery == 0 {
+			return ctx.Err()
+		}
+		return nil
+	}
+	return s.db.View(func(tx *bolt.Tx) error { return fn(tx, check) })
+}
+
+// boltTime is t's key prefix: Unix nanoseconds with the sign bit flipped,
+// big-endian, so keys sort by time for dates before 1970 too.
+func boltTime(t time.Time) [8]byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(t.UnixNano())^1<<63)
+	return b
+}
+
+func boltTimeBytes(t time.Time) []byte {
+	b := boltTime(t)
+	return b[:]
+}
+
+// encodeBoltPoint encodes all of t but its GPU (the bucket), timestamp (the
+// key) and idempotency key: host, producer, labels sorted by name, then each
+// metric's name and float64 bits, then, if there are any, each typed value's
+// name, kind and value. Strings are length-prefixed.
+func encodeBoltPoint(t model.Telemetry) []byte {
+	b := make([]byte, 0, 64+24*len(t.Metrics))
+	str := func(s string) {
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+	str(t.HostId)
+	str(t.ProducerId)
+	b = binary.AppendUvarint(b, uint64(len(t.Labels)))
+	for _, k := range sortedKeys(t.Labels) {
+		str(k)
+		str(t.Labels[k])
+	}
+	b = binary.AppendUvarint(b, uint64(len(t.Metrics)))
+	for _, k := range sortedKeys(t.Metrics) {
+		str(k)
+		b = binary.BigEndian.AppendUint64(b, math.Float64bits(t.Metrics[k]))
+	}
+	if len(t.Values) == 0 {
+		return b // points written before typed values end here
+	}
+	b = binary.AppendUvarint(b, uint64(len(t.Values)))
+	for _, k := range sortedKeys(t.Values) {
+		v := t.Values[k]
+		str(k)
+		b = append(b, byte(v.Kind))
+		switch v.Kind {
+		case model.KindFloat:
+			b = binary.BigEndian.AppendUint64(b, math.Float64bits(v.Float))
+		case model.KindInt:
+			b = binary.AppendVarint(b, v.Int)
+		case model.KindBool:
+			if v.Bool {
+				b = append(b, 1)
+			} else {
+				b = append(b, 0)
+			}
+		default:
+			str(v.Str)
+		}
+	}
+	return b
+}
+
+// decodeBoltPoint is the inverse of encodeBoltPoint for the point stored
+// under key in gpuID's bucket.
+func decodeBoltPoint(gpuID string, key, v []byte) (model.Telemetry, error) {
+	bad := errors.New("corrupt point")
+	uvarint := func() (uint64, bool) {
+		n, w := binary.Uvarint(v)
+		if w <= 0 {
+			return 0, false
+		}
+		v = v[w:]
+		return n, true
+	}
+	str := func() (string, bool) {
+		n, ok := uvarint()
+		if !ok || uint64(len(v)) < n {
+			return "", false
+		}
+		s := string(v[:n])
+		v = v[n:]
+		return s, true
+	}
+	if len(key) < 8 {
+		return model.Telemetry{}, bad
+	}
+	t := model.Telemetry{GPUId: gpuID, Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(key)^1<<63)).UTC()}
+	var ok bool
+	if t.HostId, ok = str(); !ok {
+		return t, bad
+	}
+	if t.ProducerId, ok = str(); !ok {
+		return t, bad
+	}
+	n, ok := uvarint()
+	if !ok {
+		return t, bad
+	}
+	if n > 0 {
+		t.Labels = make(map[string]string, min(n, 64))
+	}
+	for ; n > 0; n-- {
+		k, ok1 := str()
+		val, ok2 := str()
+		if !ok1 || !ok2 {
+			return t, bad
+		}
+		t.Labels[k] = val
+	}
+	if n, ok = uvarint(); !ok {
+		return t, bad
+	}
+	t.Metrics = make(map[string]float64, min(n, 1024))
+	for ; n > 0; n-- {
+		k, ok := str()
+		if !ok || len(v) < 8 {
+			return t, bad
+		}
+		t.Metrics[k] = math.Float64frombits(binary.BigEndian.Uint64(v))
+		v = v[8:]
+	}
+	if len(v) == 0 {
+		return t, nil
+	}
+	if n, ok = uvarint(); !ok {
+		return t, bad
+	}
+	t.Values = make(map[string]model.Value, min(n, 1024))
+	for ; n > 0; n-- {
+		k, ok := str()
+		if !ok || len(v) == 0 {
+			return t, bad
+		}
+		kind := model.ValueKind(v[0])
+		v = v[1:]
+		switch kind {
+		case model.KindFloat:
+			if len(v) < 8 {
+				return t, bad
+			}
+			t.Values[k] = model.FloatValue(math.Float64frombits(binary.BigEndian.Uint64(v)))
+			v = v[8:]
+		case model.KindInt:
+			i, w := binary.Varint(v)
+			if w <= 0 {
+				return t, bad
+			}
+			t.Values[k] = model.IntValue(i)
+			v = v[w:]
+		case model.KindBool:
+			if len(v) == 0 {
+				return t, bad
+			}
+			t.Values[k] = model.BoolValue(v[0] == 1)
+			v = v[1:]
+		case model.KindString:
+			s, ok := str()
+			if !ok {
+				return t, bad
+			}
+			t.Values[k] = model.StringValue(s)
+		default:
+			return t, bad
+		}
+	}
+	return t, nil
+}
+
+// sortedKeys returns m's keys in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
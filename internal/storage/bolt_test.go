@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+func openBolt(t testing.TB, path string) *BoltStore {
+	t.Helper()
+	st, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	return st
+}
+
+func TestBoltStore_SaveAndQuery(t *testing.T) {
+	// Scenario: a batch with two points of g1 at the same second, one of g2,
+	// a redelivered idempotency key and a point without GPU; the file is
+	// closed and reopened
+	// Expect: the point without GPU fails alone, the duplicate is skipped;
+	// after reopening, points come back with every field, in time order and
+	// insertion order within a timestamp, windowed and paged
+	path := filepath.Join(t.TempDir(), "t.bolt")
+	st := openBolt(t, path)
+	t0 := time.Unix(1700000000, 500).UTC()
+	err := st.SaveTelemetryBatch([]model.Telemetry{
+		{GPUId: "g1", HostId: "h1", ProducerId: "p1", Timestamp: t0.Add(time.Minute), Labels: map[string]string{"cluster": "c1"}, Metrics: map[string]float64{"temp": 61, "util": 0.5}, IdempotencyKey: "k1"},
+		{GPUId: "g1", HostId: "h1", Timestamp: t0, Metrics: map[string]float64{"temp": 60}},
+		{GPUId: "g1", HostId: "h1", Timestamp: t0, Metrics: map[string]float64{"temp": 59}},
+		{Timestamp: t0, Metrics: map[string]float64{"temp": 1}},
+		{GPUId: "g2", Timestamp: t0, Metrics: map[string]float64{"temp": 70}},
+	})
+	if be, ok := err.(*BatchError); !ok || len(be.Failed) != 1 || be.Failed[3] == nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if err := st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0, Metrics: map[string]float64{"temp": 99}, IdempotencyKey: "k1"}); err != nil {
+		t.Fatalf("redelivery: %v", err)
+	}
+	_ = st.Close()
+
+	st = openBolt(t, path)
+	all, err := st.QueryTelemetry("g1", nil, nil)
+	want := []model.Telemetry{
+		{GPUId: "g1", HostId: "h1", Timestamp: t0, Metrics: map[string]float64{"temp": 60}},
+		{GPUId: "g1", HostId: "h1", Timestamp: t0, Metrics: map[string]float64{"temp": 59}},
+		{GPUId: "g1", HostId: "h1", ProducerId: "p1", Timestamp: t0.Add(time.Minute), Labels: map[string]string{"cluster": "c1"}, Metrics: map[string]float64{"temp": 61, "util": 0.5}},
+	}
+	if err != nil || !reflect.DeepEqual(all, want) {
+		t.Fatalf("query: %v %+v", err, all)
+	}
+	start, end := t0.Add(time.Nanosecond), t0.Add(time.Minute)
+	if got, err := st.QueryTelemetry("g1", &start, &end); err != nil || len(got) != 1 || got[0].Metrics["temp"] != 61 {
+		t.Fatalf("window: %v %+v", err, got)
+	}
+	if got, err := st.QueryTelemetryWith("g1", Query{Desc: true, Offset: 1, Limit: 1, Metrics: []string{"temp"}}); err != nil || len(got) != 1 || got[0].Metrics["temp"] != 59 {
+		t.Fatalf("page: %v %+v", err, got)
+	}
+	fleet, err := st.QueryFleet(nil, Query{End: &t0})
+	if err != nil || len(fleet) != 3 || fleet[2].GPUId != "g2" {
+		t.Fatalf("fleet: %v %+v", err, fleet)
+	}
+	if ids, err := st.ListGPUs(); err != nil || !reflect.DeepEqual(ids, []string{"g1", "g2"}) {
+		t.Fatalf("list: %v %v", ids, err)
+	}
+}
+
+func TestBoltStore_Scoped(t *testing.T) {
+	st := openBolt(t, filepath.Join(t.TempDir(), "t.bolt"))
+	scopeFixture(t, st)
+	checkScoped(t, st)
+}
+
+func TestBoltStore_FiltersAttribution(t *testing.T) {
+	checkAttributionFilters(t, openBolt(t, filepath.Join(t.TempDir(), "t.bolt")))
+}
+
+func TestBoltStore_DeleteMetrics(t *testing.T) {
+	checkDeleteMetrics(t, openBolt(t, filepath.Join(t.TempDir(), "t.bolt")))
+}
+
+func TestBoltStore_TypedValues(t *testing.T) {
+	checkTypedValues(t, openBolt(t, filepath.Join(t.TempDir(), "t.bolt")))
+}
+
+func TestBoltStore_QueryLatest(t *testing.T) {
+	// Scenario: g1 has a point in cluster c1, then a newer one in c2
+	// Expect: the newest point overall, the c1 one within cluster c1, and
+	// nothing for a GPU without points
+	st := openBolt(t, filepath.Join(t.TempDir(), "t.bolt"))
+	t0 := time.Unix(1700000000, 0).UTC()
+	_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0, Labels: map[string]string{"cluster": "c1"}, Metrics: map[string]float64{"temp": 60}})
+	_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Second), Labels: map[string]string{"cluster": "c2"}, Metrics: map[string]float64{"temp": 61}})
+	if it, err := Latest(st, "g1"); err != nil || it == nil || it.Metrics["temp"] != 61 {
+		t.Fatalf("latest: %v %+v", err, it)
+	}
+	got, err := st.QueryLatest([]string{"g1", "g9"}, &Scope{Clusters: []string{"c1"}})
+	if err != nil || len(got) != 1 || got["g1"].Metrics["temp"] != 60 {
+		t.Fatalf("scoped latest: %v %+v", err, got)
+	}
+}
+
+func TestBoltStore_DeleteTelemetry(t *testing.T) {
+	// Scenario: two GPUs with keyed points at t0 and t0+1m; delete everything
+	// before t0+1m, then all of g2, then resend the deleted keys
+	// Expect: counts 2 and 1; only g1's newer point is left; the keys of
+	// points deleted by age can be written again, the one of the newer
+	// point still cannot
+	st := openBolt(t, filepath.Join(t.TempDir(), "t.bolt"))
+	t0 := time.Unix(1700000000, 0).UTC()
+	for _, id := range []string{"g1", "g2"} {
+		_ = st.SaveTelemetry(model.Telemetry{GPUId: id, Timestamp: t0, Metrics: map[string]float64{"a": 1}, IdempotencyKey: id + "-old"})
+		_ = st.SaveTelemetry(model.Telemetry{GPUId: id, Timestamp: t0.Add(time.Minute), Metrics: map[string]float64{"a": 2}, IdempotencyKey: id + "-new"})
+	}
+	if n, err := st.DeleteTelemetry("", t0.Add(time.Minute)); err != nil || n != 2 {
+		t.Fatalf("delete before: %d %v", n, err)
+	}
+	if n, err := st.DeleteTelemetry("g2", time.Time{}); err != nil || n != 1 {
+		t.Fatalf("delete g2: %d %v", n, err)
+	}
+	ids, _ := st.ListGPUs()
+	out, _ := st.QueryTelemetry("g1", nil, nil)
+	if len(ids) != 1 || len(out) != 1 || out[0].Metrics["a"] != 2 {
+		t.Fatalf("left: %v %v", ids, out)
+	}
+	_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0, Metrics: map[string]float64{"a": 1}, IdempotencyKey: "g1-old"})
+	_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Minute), Metrics: map[string]float64{"a": 2}, IdempotencyKey: "g1-new"})
+	if out, _ := st.QueryTelemetry("g1", nil, nil); len(out) != 2 {
+		t.Fatalf("after resend: %v", out)
+	}
+}
+
+func TestBoltStore_RulesAndContext(t *testing.T) {
+	st := openBolt(t, filepath.Join(t.TempDir(), "t.bolt"))
+	_ = st.SaveRule("a", []byte(`{"v":1}`))
+	_ = st.SaveRule("a", []byte(`{"v":2}`))
+	_ = st.SaveWebhook("w", []byte(`{}`))
+	if ok, err := st.DeleteRule("a"); !ok || err != nil {
+		t.Fatalf("delete: %v %v", ok, err)
+	}
+	_ = st.SaveRule("b", []byte(`{"v":3}`))
+	rules, err := st.ListRules()
+	hooks, _ := st.ListWebhooks()
+	if err != nil || len(rules) != 1 || string(rules["b"]) != `{"v":3}` || len(hooks) != 1 {
+		t.Fatalf("docs: %q %q %v", rules, hooks, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := WithContext(ctx, st).ListGPUs(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// benchmarkBoltSave is benchmarkSQLiteSave on a BoltStore.
+func benchmarkBoltSave(b *testing.B, batch int) {
+	st := openBolt(b, filepath.Join(b.TempDir(), "bench.bolt"))
+	t0 := time.Unix(1700000000, 0).UTC()
+	items := make([]model.Telemetry, 0, batch)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		it := model.Telemetry{GPUId: fmt.Sprint("g", i%8), HostId: "h1", Timestamp: t0.Add(time.Duration(i) * time.Second),
+			Metrics: map[string]float64{"temp": 60, "power": 300, "util": 90}}
+		if items = append(items, it); len(items) == batch || i == b.N-1 {
+			if err := st.SaveTelemetryBatch(items); err != nil {
+				b.Fatal(err)
+			}
+			items = items[:0]
+		}
+	}
+}
+
+func BenchmarkBoltStore_SaveRow(b *testing.B)   { benchmarkBoltSave(b, 1) }
+func BenchmarkBoltStore_SaveBatch(b *testing.B) { benchmarkBoltSave(b, 500) }
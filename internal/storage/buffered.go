@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// ErrClosed is returned by writes to a closed BufferedStore.
+var ErrClosed = errors.New("store closed")
+
+// BufferedOptions configures NewBufferedStore. Zero fields take the
+// defaults.
+type BufferedOptions struct {
+	// MaxItems flushes once this many points are buffered, and is the
+	// largest batch written (default 1000).
+	MaxItems int
+	// Interval flushes a partial buffer after this long (default 1s).
+	Interval time.Duration
+	// MaxPending bounds the buffered points (default 4 * MaxItems). Writes
+	// block while it is reached, so a slow backend slows the writers rather
+	// than growing the buffer.
+	MaxPending int
+	// OnError, if set, is called from the flushing goroutine with the points
+	// of a batch the base store did not write, and its error.
+	OnError func(items []model.Telemetry, err error)
+}
+
+// BufferedStore collects writes in memory and saves them to the base store
+// in batches from one goroutine, in the order they were buffered: once
+// MaxItems points are buffered, every Interval, and on Flush or Close.
+//
+// Writes return once buffered, so their errors reach OnError and the next
+// Flush instead. Reads go to the base store and do not see buffered points;
+// deletions flush first so they cover them.
+type BufferedStore struct {
+	base Store
+	buf  *writeBuffer
+}
+
+// writeBuffer is the state a BufferedStore shares with its context-bound
+// copies.
+type writeBuffer struct {
+	base    Store
+	opts    BufferedOptions
+	mu      sync.Mutex
+	space   *sync.Cond // signalled when the buffer is taken or closed
+	items   []model.Telemetry
+	closed  bool
+	err     error              // first failed batch since the last Flush
+	full    chan struct{}      // MaxItems points are buffered
+	flushes chan chan struct{} // closed once the buffer is written
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewBufferedStore returns base with buffered writes; Close it to write the
+// last points.
+func NewBufferedStore(base Store, opts BufferedOptions) *BufferedStore {
+	if opts.MaxItems <= 0 {
+		opts.MaxItems = 1000
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = 4 * opts.MaxItems
+	}
+	b := &writeBuffer{base: base, opts: opts, full: make(chan struct{}, 1), flushes: make(chan chan struct{}),
+		stop: make(chan struct{}), done: make(chan struct{})}
+	b.space = sync.NewCond(&b.mu)
+	go b.run()
+	return &BufferedStore{base: base, buf: b}
+}
+
+func (b *writeBuffer) run() {
+	defer close(b.done)
+	tick := time.NewTicker(b.opts.Interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-b.full:
+			b.writeBuffered()
+		case <-tick.C:
+			b.writeBuffered()
+		case req := <-b.flushes:
+			b.writeBuffered()
+			close(req)
+		case <-b.stop:
+			b.writeBuffered()
+			return
+		}
+	}
+}
+
+// writeBuffered takes the buffer and writes it in batches of MaxItems.
+func (b *writeBuffer) writeBuffered() {
+	b.mu.Lock()
+	items := b.items
+	b.items = nil
+	b.space.Broadcast()
+	b.mu.Unlock()
+	for len(items) > 0 {
+		n := min(len(items), b.opts.MaxItems)
+		b.write(items[:n])
+		items = items[n:]
+	}
+}
+
+func (b *writeBuffer) write(items []model.Telemetry) {
+	err := b.base.SaveTelemetryBatch(items)
+	failed := FailedItems(err, len(items))
+	if len(failed) == 0 {
+		return
+	}
+	b.mu.Lock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.mu.Unlock()
+	if b.opts.OnError != nil {
+		lost := make([]model.Telemetry, 0, len(failed))
+		for i := range items {
+			if _, ok := failed[i]; ok {
+				lost = append(lost, items[i])
+			}
+		}
+		b.opts.OnError(lost, err)
+	}
+}
+
+func (b *writeBuffer) add(items []model.Telemetry) error {
+	b.mu.Lock()
+	// a batch larger than MaxPending is let into an empty buffer
+	for !b.closed && len(b.items) > 0 && len(b.items)+len(items) > b.opts.MaxPending {
+		b.space.Wait()
+	}
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	b.items = append(b.items, items...)
+	full := len(b.items) >= b.opts.MaxItems
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default: // already signalled
+		}
+	}
+	return nil
+}
+
+// drain waits until the buffer is written; stop also stops the goroutine,
+// failing later writes.
+func (b *writeBuffer) drain(stop bool) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	if stop {
+		b.closed = true
+		b.space.Broadcast()
+	}
+	b.mu.Unlock()
+	if stop {
+		// the goroutine writes the buffer before it returns
+		close(b.stop)
+		<-b.done
+		return
+	}
+	req := make(chan struct{})
+	select {
+	case b.flushes <- req:
+		<-req
+	case <-b.done: // closed meanwhile, which wrote the buffer
+	}
+}
+
+// flush drains the buffer and returns the first error since the last flush.
+func (b *writeBuffer) flush(stop bool) error {
+	b.drain(stop)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.err
+	b.err = nil
+	return err
+}
+
+func (s *BufferedStore) WithContext(ctx context.Context) Store {
+	return &BufferedStore{base: WithContext(ctx, s.base), buf: s.buf}
+}
+
+// Flush writes the buffered points and returns the first error of the
+// batches written since the last Flush.
+func (s *BufferedStore) Flush() error { return s.buf.flush(false) }
+
+// Close flushes and stops the flushing goroutine; later writes fail with
+// ErrClosed. It does not close the base store.
+func (s *BufferedStore) Close() error { return s.buf.flush(true) }
+
+func (s *BufferedStore) SaveTelemetry(t model.Telemetry) error {
+	return s.buf.add([]model.Telemetry{t})
+}
+
+func (s *BufferedStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	return s.buf.add(items)
+}
+
+func (s *BufferedStore) ListGPUs() ([]string, error) { return s.base.ListGPUs() }
+
+func (s *BufferedStore) ListGPUsIn(sc Scope) ([]string, error) { return Scoped(s.base, sc).ListGPUs() }
+
+func (s *BufferedStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
+	return s.base.QueryTelemetry(gpuID, start, end)
+}
+
+func (s *BufferedStore) QueryTelemetryWith(gpuID string, q Query) ([]model.Telemetry, error) {
+	return Execute(s.base, gpuID, q)
+}
+
+func (s *BufferedStore) QueryFleet(gpuIDs []string, q Query) ([]model.Telemetry, error) {
+	return ExecuteFleet(s.base, gpuIDs, q)
+}
+
+func (s *BufferedStore) LatestTelemetry(gpuID string) (*model.Telemetry, error) {
+	return Latest(s.base, gpuID)
+}
+
+func (s *BufferedStore) QueryLatest(gpuIDs []string, sc *Scope) (map[string]*model.Telemetry, error) {
+	return LatestMany(s.base, gpuIDs, sc)
+}
+
+func (s *BufferedStore) TopGPUs(q TopQuery) ([]GPUValue, error) { return Top(s.base, q) }
+
+func (s *BufferedStore) AggregateTelemetry(gpuID string, q AggregateQuery) ([]Bucket, error) {
+	return Aggregate(s.base, gpuID, q)
+}
+
+func (s *BufferedStore) SummarizeTelemetry(gpuID string, q Query) (map[string]MetricSummary, error) {
+	return Summarize(s.base, gpuID, q)
+}
+
+func (s *BufferedStore) ListMetrics(gpuIDs []string, q Query) (map[string][]MetricInfo, error) {
+	return ListMetrics(s.base, gpuIDs, q)
+}
+
+// DeleteTelemetry writes the buffer first, so buffered points are deleted
+// too; a failed write is still reported by the next Flush.
+func (s *BufferedStore) DeleteTelemetry(gpuID string, before time.Time) (int64, error) {
+	d, ok := s.base.(Deleter)
+	if !ok {
+		return 0, fmt.Errorf("buffered delete telemetry: the store cannot delete")
+	}
+	s.buf.drain(false)
+	return d.DeleteTelemetry(gpuID, before)
+}
+
+// DeleteMetrics writes the buffer first, as DeleteTelemetry does.
+func (s *BufferedStore) DeleteMetrics(gpuID string, metrics []string, before time.Time) (int64, error) {
+	d, ok := s.base.(MetricDeleter)
+	if !ok {
+		return 0, fmt.Errorf("buffered delete metrics: the store cannot delete metrics")
+	}
+	s.buf.drain(false)
+	return d.DeleteMetrics(gpuID, metrics, before)
+}
+
+func (s *BufferedStore) Ping(ctx context.Context) error {
+	if p, ok := s.base.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
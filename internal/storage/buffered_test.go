@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// gatedStore is a MemoryStore whose batch writes wait for gate when it is
+// set, and fail for GPU "bad".
+type gatedStore struct {
+	*MemoryStore
+	gate chan struct{}
+}
+
+func (s *gatedStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	if s.gate != nil {
+		<-s.gate
+	}
+	var ok []model.Telemetry
+	failed := map[int]error{}
+	for i, t := range items {
+		if t.GPUId == "bad" {
+			failed[i] = errors.New("rejected")
+		} else {
+			ok = append(ok, t)
+		}
+	}
+	_ = s.MemoryStore.SaveTelemetryBatch(ok)
+	if len(failed) > 0 {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+// waitPoints waits until base holds n points of g1.
+func waitPoints(t *testing.T, base Store, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, _ := base.QueryTelemetry("g1", nil, nil)
+		if len(got) == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("base holds %d points, want %d", len(got), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBufferedStore_FlushesOnSizeIntervalAndClose(t *testing.T) {
+	// Scenario: writes below and reaching MaxItems, a partial buffer left
+	// for the interval, a rejected point, a deletion, then Close and a write
+	// after it
+	// Expect: nothing is written below MaxItems; a full buffer and an old
+	// partial one are written; the rejected point reaches OnError and the
+	// next Flush only; the deletion covers buffered points; Close writes the
+	// rest and later writes fail
+	base := &gatedStore{MemoryStore: NewMemoryStore()}
+	var lost []model.Telemetry
+	st := NewBufferedStore(base, BufferedOptions{MaxItems: 3, Interval: time.Hour, OnError: func(items []model.Telemetry, err error) {
+		lost = append(lost, items...)
+	}})
+	t0 := time.Unix(1700000000, 0).UTC()
+	pt := func(gpu string, sec int) model.Telemetry {
+		return model.Telemetry{GPUId: gpu, Timestamp: t0.Add(time.Duration(sec) * time.Second), Metrics: map[string]float64{"m": float64(sec)}}
+	}
+	_ = st.SaveTelemetryBatch([]model.Telemetry{pt("g1", 0), pt("g1", 1)})
+	time.Sleep(20 * time.Millisecond)
+	if got, _ := base.QueryTelemetry("g1", nil, nil); len(got) != 0 {
+		t.Fatalf("written before MaxItems: %d", len(got))
+	}
+	_ = st.SaveTelemetry(pt("g1", 2))
+	waitPoints(t, base, 3)
+
+	_ = st.SaveTelemetry(pt("bad", 3))
+	if err := st.Flush(); err == nil || len(lost) != 1 || lost[0].GPUId != "bad" {
+		t.Fatalf("flush: %v %+v", err, lost)
+	}
+	if err := st.Flush(); err != nil {
+		t.Fatalf("the error was reported twice: %v", err)
+	}
+
+	_ = st.SaveTelemetry(pt("g1", 4))
+	if n, err := st.DeleteTelemetry("g1", t0.Add(10*time.Second)); err != nil || n != 4 {
+		t.Fatalf("delete: %v %d", err, n)
+	}
+
+	_ = st.SaveTelemetry(pt("g1", 5))
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	waitPoints(t, base, 1)
+	if err := st.SaveTelemetry(pt("g1", 6)); !errors.Is(err, ErrClosed) {
+		t.Fatalf("write after close: %v", err)
+	}
+
+	ticking := NewBufferedStore(NewMemoryStore(), BufferedOptions{Interval: 10 * time.Millisecond})
+	defer ticking.Close()
+	_ = ticking.SaveTelemetry(pt("g1", 0))
+	waitPoints(t, ticking.base, 1)
+}
+
+func TestBufferedStore_BlocksWhenFull(t *testing.T) {
+	// Scenario: the base store stalls on the first batch while writers fill
+	// MaxPending
+	// Expect: the write past MaxPending waits until the base store takes the
+	// buffer, and every point is written in order
+	base := &gatedStore{MemoryStore: NewMemoryStore(), gate: make(chan struct{})}
+	st := NewBufferedStore(base, BufferedOptions{MaxItems: 1, MaxPending: 2, Interval: time.Hour})
+	t0 := time.Unix(1700000000, 0).UTC()
+	pending := func() int {
+		st.buf.mu.Lock()
+		defer st.buf.mu.Unlock()
+		return len(st.buf.items)
+	}
+	_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0})
+	for pending() > 0 { // wait for the base store to take it and stall
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i < 3; i++ {
+		_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Duration(i) * time.Second)})
+	}
+	returned := make(chan struct{})
+	go func() {
+		_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0.Add(3 * time.Second)})
+		close(returned)
+	}()
+	select {
+	case <-returned:
+		t.Fatal("a write past MaxPending did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(base.gate)
+	<-returned
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := base.QueryTelemetry("g1", nil, nil)
+	if len(got) != 4 || !got[3].Timestamp.Equal(t0.Add(3*time.Second)) {
+		t.Fatalf("%+v", got)
+	}
+}
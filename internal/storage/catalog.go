@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// MetricInfo describes a metric a GPU reported: when it was first and last
+// seen and how many values it has.
+type MetricInfo struct {
+	Name      string    `json:"name"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Samples   int64     `json:"samples"`
+}
+
+// MetricLister is implemented by stores that can list the metrics of GPUs in
+// the backend.
+type MetricLister interface {
+	ListMetrics(gpuIDs []string, q Query) (map[string][]MetricInfo, error)
+}
+
+// ListMetrics returns the metrics each of gpuIDs (every GPU when empty)
+// reported within q's window, filters and Scope, keyed by GPU and sorted by
+// name; GPUs without points are absent. Step, paging and order do not apply.
+// Stores without a MetricLister read the raw points and count them here.
+func ListMetrics(s Store, gpuIDs []string, q Query) (map[string][]MetricInfo, error) {
+	q.Step, q.Offset, q.Limit, q.Desc = 0, 0, 0, false
+	if ml, ok := s.(MetricLister); ok {
+		return ml.ListMetrics(gpuIDs, q)
+	}
+	if len(gpuIDs) == 0 {
+		lister := s
+		if q.Scope != nil {
+			lister = Scoped(s, *q.Scope)
+		}
+		var err error
+		if gpuIDs, err = lister.ListGPUs(); err != nil {
+			return nil, err
+		}
+	}
+	keep := map[string]bool{}
+	for _, m := range q.Metrics {
+		keep[m] = true
+	}
+	out := make(map[string][]MetricInfo, len(gpuIDs))
+	for _, id := range gpuIDs {
+		items, err := Execute(s, id, q)
+		if err != nil {
+			return nil, err
+		}
+		seen := map[string]*MetricInfo{}
+		for _, it := range items {
+			for m := range it.Metrics {
+				if len(keep) > 0 && !keep[m] {
+					continue
+				}
+				mi := seen[m]
+				if mi == nil {
+					mi = &MetricInfo{Name: m, FirstSeen: it.Timestamp, LastSeen: it.Timestamp}
+					seen[m] = mi
+				}
+				mi.Samples++
+				if it.Timestamp.Before(mi.FirstSeen) {
+					mi.FirstSeen = it.Timestamp
+				}
+				if it.Timestamp.After(mi.LastSeen) {
+					mi.LastSeen = it.Timestamp
+				}
+			}
+		}
+		if len(seen) == 0 {
+			continue
+		}
+		list := make([]MetricInfo, 0, len(seen))
+		for _, mi := range seen {
+			list = append(list, *mi)
+		}
+		sortMetricInfo(list)
+		out[id] = list
+	}
+	return out, nil
+}
+
+func sortMetricInfo(list []MetricInfo) {
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+}
+
+// mergeMetricInfo combines the listings of disjoint windows, as a store
+// split in time returns them.
+func mergeMetricInfo(a, b map[string][]MetricInfo) map[string][]MetricInfo {
+	for id, list := range b {
+		byName := map[string]int{}
+		for i, mi := range a[id] {
+			byName[mi.Name] = i
+		}
+		for _, mi := range list {
+			i, ok := byName[mi.Name]
+			if !ok {
+				a[id] = append(a[id], mi)
+				continue
+			}
+			cur := &a[id][i]
+			cur.Samples += mi.Samples
+			if mi.FirstSeen.Before(cur.FirstSeen) {
+				cur.FirstSeen = mi.FirstSeen
+			}
+			if mi.LastSeen.After(cur.LastSeen) {
+				cur.LastSeen = mi.LastSeen
+			}
+		}
+		sortMetricInfo(a[id])
+	}
+	return a
+}
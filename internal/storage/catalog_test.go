@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+func TestListMetrics_Stores(t *testing.T) {
+	// Scenario: g1 reports temp on three points and util on the last two,
+	// one of them from another host; g2 reports power once; listed from a
+	// memory store (the generic path) and SQLite stores of both schemas
+	// Expect: per GPU and metric the sample count and first and last seen;
+	// a window, a host filter and a metric filter narrow the listing
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return t0.Add(time.Duration(sec) * time.Second) }
+	points := []model.Telemetry{
+		{GPUId: "g1", HostId: "h1", Timestamp: at(0), Metrics: map[string]float64{"temp": 1}},
+		{GPUId: "g1", HostId: "h1", Timestamp: at(10), Metrics: map[string]float64{"temp": 2, "util": 5}},
+		{GPUId: "g1", HostId: "h2", Timestamp: at(20), Metrics: map[string]float64{"temp": 3, "util": 6}},
+		{GPUId: "g2", HostId: "h1", Timestamp: at(5), Metrics: map[string]float64{"power": 100}},
+	}
+	dir := t.TempDir()
+	stores := map[string]Store{"memory": NewMemoryStore()}
+	for name, schema := range map[string]SQLiteSchema{"json": SQLiteJSON, "normalized": SQLiteNormalized} {
+		s, err := NewSQLiteStoreWith(filepath.Join(dir, name+".db"), SQLiteOptions{Schema: schema})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores["sqlite "+name] = s
+	}
+	for name, s := range stores {
+		if err := s.SaveTelemetryBatch(points); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		all, err := ListMetrics(s, nil, Query{})
+		want := map[string][]MetricInfo{
+			"g1": {{Name: "temp", FirstSeen: at(0), LastSeen: at(20), Samples: 3}, {Name: "util", FirstSeen: at(10), LastSeen: at(20), Samples: 2}},
+			"g2": {{Name: "power", FirstSeen: at(5), LastSeen: at(5), Samples: 1}},
+		}
+		if err != nil || !reflect.DeepEqual(all, want) {
+			t.Fatalf("%s all: %v %+v", name, err, all)
+		}
+		start := at(5)
+		got, err := ListMetrics(s, []string{"g1"}, Query{Start: &start, HostIDs: []string{"h1"}, Metrics: []string{"util"}})
+		if err != nil || len(got) != 1 || !reflect.DeepEqual(got["g1"], []MetricInfo{{Name: "util", FirstSeen: at(10), LastSeen: at(10), Samples: 1}}) {
+			t.Fatalf("%s filtered: %v %+v", name, err, got)
+		}
+	}
+}
+
+func TestReadRouter_ListMetricsMergesStores(t *testing.T) {
+	// Scenario: temp in the archive before the cut and in recent after it
+	// Expect: one entry spanning both stores with the samples of both
+	recent, archive := NewMemoryStore(), NewMemoryStore()
+	now := time.Now()
+	_ = archive.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: now.Add(-2 * time.Hour), Metrics: map[string]float64{"temp": 1}})
+	_ = recent.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: now.Add(-time.Minute), Metrics: map[string]float64{"temp": 2, "util": 1}})
+	r := NewReadRouter(recent, archive, time.Hour)
+	got, err := ListMetrics(r, nil, Query{})
+	if err != nil || len(got["g1"]) != 2 || got["g1"][0].Samples != 2 || !got["g1"][0].FirstSeen.Equal(now.Add(-2*time.Hour)) || got["g1"][1].Name != "util" {
+		t.Fatalf("%v %+v", err, got)
+	}
+}
@@ -0,0 +1,44 @@
+package storage
+
+import "time"
+
+// Deleter is implemented by stores that can delete telemetry, for retention
+// and cleanup.
+type Deleter interface {
+	// DeleteTelemetry removes the points of gpuID ("" for every GPU) older
+	// than before (the zero time for every point). It returns how many were
+	// removed, or -1 when the store cannot tell.
+	DeleteTelemetry(gpuID string, before time.Time) (int64, error)
+}
+
+// MetricDeleter is implemented by stores that can delete single metrics of
+// their points, for per-metric retention.
+type MetricDeleter interface {
+	// DeleteMetrics removes metrics from the points of gpuID ("" for every
+	// GPU) older than before (the zero time for every point); a point left
+	// without metrics is removed. It returns how many values were removed,
+	// or -1 when the store cannot tell.
+	DeleteMetrics(gpuID string, metrics []string, before time.Time) (int64, error)
+}
+
+// withoutMetrics returns m without names and how many of them it held; m
+// itself is returned, unchanged, when it held none.
+func withoutMetrics(m map[string]float64, names []string) (map[string]float64, int) {
+	n := 0
+	for _, k := range names {
+		if _, ok := m[k]; ok {
+			n++
+		}
+	}
+	if n == 0 {
+		return m, 0
+	}
+	out := make(map[string]float64, len(m)-n)
+	for k, v := range m {
+		out[k] = v
+	}
+	for _, k := range names {
+		delete(out, k)
+	}
+	return out, n
+}
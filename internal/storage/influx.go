@@ -2,73 +2,324 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
 	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"gpu-metric-collector/internal/model"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
 )
 
 // InfluxStore implements Store backed by InfluxDB v2.
 type InfluxStore struct {
-	client influxdb2.Client
-	org    string
-	bucket string
-	wapi   api.WriteAPIBlocking
-	qapi   api.QueryAPI
+	client      influxdb2.Client
+	org         string
+	bucket      string
+	measurement string
+	wapi        api.WriteAPIBlocking
+	qapi        api.QueryAPI
+	ctx         context.Context // nil means context.Background()
+	// async, when set, takes the writes instead of wapi; see NewInfluxStoreAsync.
+	async api.WriteAPI
+	stats *influxWriteStats
 }
 
+// InfluxAsync configures the non-blocking writes of NewInfluxStoreAsync.
+// Zero values keep the client's defaults.
+type InfluxAsync struct {
+	// BatchSize is the points sent per write request (default 5000).
+	BatchSize uint
+	// FlushInterval sends a partial batch after this long (default 1s).
+	FlushInterval time.Duration
+	// RetryBufferLimit bounds the points kept for retrying (default 50000);
+	// the oldest batch is discarded, without a callback, when it is full.
+	RetryBufferLimit uint
+	// MaxRetries is how often a batch is retried after a connection error,
+	// 429 or 5xx (default 5), starting RetryInterval apart (default 5s) and
+	// backing off exponentially.
+	MaxRetries    uint
+	RetryInterval time.Duration
+	// OnWriteFailed, if set, is called with the line protocol of each batch
+	// that is given up after its retries, so it can be kept elsewhere. The
+	// client does not return batches the server rejects outright (other
+	// 4xx), so those are only counted.
+	OnWriteFailed func(lines string, err error)
+}
+
+// InfluxWriteStats counts the failures of non-blocking writes.
+type InfluxWriteStats struct {
+	// Errors counts failed write requests, retried ones included.
+	Errors uint64
+	// Dropped counts batches given up: rejected by the server, or failed
+	// after their last retry.
+	Dropped uint64
+}
+
+type influxWriteStats struct{ errors, dropped atomic.Uint64 }
+
 // NewInfluxStore builds a Store using InfluxDB v2 client.
 // url example: http://localhost:8086
 // org: your org name
 // bucket: your bucket name
 // token: auth token (PAT)
 func NewInfluxStore(url, org, bucket, token string) (Store, error) {
+	return NewInfluxStoreMeasurement(url, org, bucket, token, "telemetry")
+}
+
+// NewInfluxStoreMeasurement is like NewInfluxStore but reads and writes the given
+// measurement instead of "telemetry" (e.g., "telemetry_rollup_5m" for rollups).
+func NewInfluxStoreMeasurement(url, org, bucket, token, measurement string) (Store, error) {
 	if url == "" || org == "" || bucket == "" || token == "" {
 		return nil, fmt.Errorf("influx: missing url/org/bucket/token")
 	}
+	if measurement == "" {
+		return nil, fmt.Errorf("influx: missing measurement")
+	}
 	client := influxdb2.NewClient(url, token)
 	st := &InfluxStore{
-		client: client,
-		org:    org,
-		bucket: bucket,
-		wapi:   client.WriteAPIBlocking(org, bucket),
-		qapi:   client.QueryAPI(org),
+		client:      client,
+		org:         org,
+		bucket:      bucket,
+		measurement: measurement,
+		wapi:        client.WriteAPIBlocking(org, bucket),
+		qapi:        client.QueryAPI(org),
 	}
 	return st, nil
 }
 
+// NewInfluxStoreAsync is like NewInfluxStoreMeasurement, but SaveTelemetry
+// and SaveTelemetryBatch only buffer the points: the client sends them in
+// batches in the background and retries failed requests. A nil error thus
+// does not mean the points are stored; failures are counted in WriteStats and
+// passed to cfg.OnWriteFailed. Close flushes the buffer.
+func NewInfluxStoreAsync(url, org, bucket, token, measurement string, cfg InfluxAsync) (*InfluxStore, error) {
+	if url == "" || org == "" || bucket == "" || token == "" {
+		return nil, fmt.Errorf("influx: missing url/org/bucket/token")
+	}
+	if measurement == "" {
+		return nil, fmt.Errorf("influx: missing measurement")
+	}
+	opts := influxdb2.DefaultOptions()
+	if cfg.BatchSize > 0 {
+		opts.SetBatchSize(cfg.BatchSize)
+	}
+	if cfg.FlushInterval > 0 {
+		opts.SetFlushInterval(uint(max(cfg.FlushInterval.Milliseconds(), 1)))
+	}
+	if cfg.RetryBufferLimit > 0 {
+		opts.SetRetryBufferLimit(cfg.RetryBufferLimit)
+	}
+	if cfg.MaxRetries > 0 {
+		opts.SetMaxRetries(cfg.MaxRetries)
+	}
+	if cfg.RetryInterval > 0 {
+		opts.SetRetryInterval(uint(max(cfg.RetryInterval.Milliseconds(), 1)))
+	}
+	client := influxdb2.NewClientWithOptions(url, token, opts)
+	st := &InfluxStore{
+		client:      client,
+		org:         org,
+		bucket:      bucket,
+		measurement: measurement,
+		wapi:        client.WriteAPIBlocking(org, bucket),
+		qapi:        client.QueryAPI(org),
+		async:       client.WriteAPI(org, bucket),
+		stats:       &influxWriteStats{},
+	}
+	maxRetries := opts.MaxRetries()
+	// called for retryable failures only; the client discards the batch when
+	// it returns false
+	st.async.SetWriteFailedCallback(func(batch string, err http2.Error, attempts uint) bool {
+		if attempts < maxRetries {
+			return true
+		}
+		st.stats.dropped.Add(1)
+		if cfg.OnWriteFailed != nil {
+			cfg.OnWriteFailed(batch, &err)
+		}
+		return false
+	})
+	errs := st.async.Errors() // closed by Close
+	go func() {
+		for err := range errs {
+			st.stats.errors.Add(1)
+			var he *http2.Error
+			if errors.As(err, &he) && he.StatusCode > 0 && he.StatusCode < http.StatusTooManyRequests {
+				st.stats.dropped.Add(1)
+			}
+		}
+	}()
+	return st, nil
+}
+
+// WriteStats returns the failures of non-blocking writes so far; it is zero
+// for a store with blocking writes.
+func (s *InfluxStore) WriteStats() InfluxWriteStats {
+	if s.stats == nil {
+		return InfluxWriteStats{}
+	}
+	return InfluxWriteStats{Errors: s.stats.errors.Load(), Dropped: s.stats.dropped.Load()}
+}
+
+// Close sends the points still buffered by non-blocking writes and releases
+// the client. Batches waiting for a retry are tried once more; the client
+// only logs them if that fails.
+func (s *InfluxStore) Close() error {
+	s.client.Close()
+	return nil
+}
+
+// WithContext returns a view of s whose queries and writes use ctx, so they
+// stop when it is cancelled or its deadline passes.
+func (s *InfluxStore) WithContext(ctx context.Context) Store {
+	cp := *s
+	cp.ctx = ctx
+	return &cp
+}
+
+func (s *InfluxStore) callCtx() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
 func (s *InfluxStore) SaveTelemetry(t model.Telemetry) error {
-	// measurement: telemetry
-	// tag: gpu_id
-	// fields: metrics map
-	if len(t.Metrics) == 0 {
+	if s.async != nil {
+		s.async.WritePoint(s.point(t))
+		return nil
+	}
+	return s.wapi.WritePoint(s.callCtx(), s.point(t))
+}
+
+// SaveTelemetryBatch writes all items in a single request; InfluxDB accepts or
+// rejects the request as a whole, so a failure applies to every item. With
+// non-blocking writes the items join the client's buffer instead.
+func (s *InfluxStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if s.async != nil {
+		for _, t := range items {
+			s.async.WritePoint(s.point(t))
+		}
+		return nil
+	}
+	points := make([]*write.Point, len(items))
+	for i, t := range items {
+		points[i] = s.point(t)
+	}
+	return s.wapi.WritePoint(s.callCtx(), points...)
+}
+
+func (s *InfluxStore) point(t model.Telemetry) *write.Point {
+	return influxPoint(s.measurement, t)
+}
+
+// influxValuePrefix marks the fields of typed values, which keep their own
+// InfluxDB type. Prefixed, they never clash with a float field of the same
+// name, and numeric reductions can leave them out.
+const influxValuePrefix = "_v_"
+
+// influxNumeric is the Flux predicate of the fields holding metrics.
+const influxNumeric = `r._field != "_heartbeat" and r._field !~ /^_v_/`
+
+// influxPoint is t as a point of measurement: tags gpu_id, host_id,
+// producer_id and labels, one field per metric and per typed value.
+func influxPoint(measurement string, t model.Telemetry) *write.Point {
+	// A redelivered point has the same series and timestamp, so InfluxDB overwrites
+	// it in place; that makes writes idempotent without an explicit key.
+	if len(t.Metrics) == 0 && len(t.Values) == 0 {
 		// still write a heartbeat point so GPU is discoverable
 		fields := map[string]interface{}{"_heartbeat": 1}
-		p := influxdb2.NewPoint("telemetry", map[string]string{"gpu_id": t.GPUId}, fields, t.Timestamp)
-		return s.wapi.WritePoint(context.Background(), p)
+		return influxdb2.NewPoint(measurement, influxTags(t), fields, t.Timestamp)
 	}
-	fields := make(map[string]interface{}, len(t.Metrics))
+	fields := make(map[string]interface{}, len(t.Metrics)+len(t.Values))
 	for k, v := range t.Metrics {
 		fields[k] = v
 	}
-	p := influxdb2.NewPoint("telemetry", map[string]string{"gpu_id": t.GPUId}, fields, t.Timestamp)
-	return s.wapi.WritePoint(context.Background(), p)
+	for k, v := range t.Values {
+		switch v.Kind {
+		case model.KindFloat:
+			fields[influxValuePrefix+k] = v.Float
+		case model.KindInt:
+			fields[influxValuePrefix+k] = v.Int
+		case model.KindBool:
+			fields[influxValuePrefix+k] = v.Bool
+		case model.KindString:
+			fields[influxValuePrefix+k] = v.Str
+		}
+	}
+	return influxdb2.NewPoint(measurement, influxTags(t), fields, t.Timestamp)
+}
+
+// influxFields is names and their typed value fields.
+func influxFields(names []string) []string {
+	out := append([]string(nil), names...)
+	for _, n := range names {
+		out = append(out, influxValuePrefix+n)
+	}
+	return out
+}
+
+// Ping checks that the InfluxDB server is reachable; it does not validate the token.
+func (s *InfluxStore) Ping(ctx context.Context) error {
+	ok, err := s.client.Ping(ctx)
+	if err != nil {
+		return fmt.Errorf("influx ping: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("influx ping: server not ready")
+	}
+	return nil
+}
+
+// influxTags returns the tag set for t; gpu_id, host_id and producer_id always win
+// over same-named labels.
+func influxTags(t model.Telemetry) map[string]string {
+	tags := make(map[string]string, len(t.Labels)+3)
+	for k, v := range t.Labels {
+		tags[k] = v
+	}
+	tags["gpu_id"] = t.GPUId
+	if t.HostId != "" {
+		tags["host_id"] = t.HostId
+	}
+	if t.ProducerId != "" {
+		tags["producer_id"] = t.ProducerId
+	}
+	return tags
 }
 
 func (s *InfluxStore) ListGPUs() ([]string, error) {
+	return s.listGPUs("")
+}
+
+// ListGPUsIn lists the GPUs with at least one point in sc.
+func (s *InfluxStore) ListGPUsIn(sc Scope) ([]string, error) {
+	return s.listGPUs("\n  |> filter(fn: (r) => " + fluxScope(&sc) + ")")
+}
+
+// listGPUs returns the distinct gpu_id tags, after the extra filter if any.
+func (s *InfluxStore) listGPUs(filter string) ([]string, error) {
 	// Query distinct tag values for gpu_id across data in bucket
 	// Flux: from |> range(start: 0) |> filter(m == "telemetry") |> group(columns: ["gpu_id"]) |> distinct(column: "gpu_id")
 	q := `from(bucket: "` + s.bucket + `")
   |> range(start: 0)
-  |> filter(fn: (r) => r._measurement == "telemetry")
+  |> filter(fn: (r) => r._measurement == "` + s.measurement + `")` + filter + `
   |> keep(columns: ["gpu_id"]) 
   |> group()
   |> distinct(column: "gpu_id")`
-	res, err := s.qapi.Query(context.Background(), q)
+	res, err := s.qapi.Query(s.callCtx(), q)
 	if err != nil {
 		return nil, fmt.Errorf("influx list gpus: %w", err)
 	}
@@ -99,29 +350,392 @@ func (s *InfluxStore) ListGPUs() ([]string, error) {
 
 // timeLiteral returns a Flux time literal suitable for range(), e.g., time(v: "2026-01-27T00:00:00Z").
 func timeLiteral(t time.Time) string {
-	return fmt.Sprintf("time(v: %q)", t.UTC().Format(time.RFC3339))
+	return fmt.Sprintf("time(v: %q)", t.UTC().Format(time.RFC3339Nano))
 }
 
-func (s *InfluxStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
-	if gpuID == "" {
-		return nil, fmt.Errorf("gpuID required")
-	}
+// rangeExpr returns the range() arguments for an optional window. range()
+// excludes its stop, so it is set just past end to keep points at end.
+func rangeExpr(start, end *time.Time) string {
 	startExpr := "0"
 	if start != nil {
 		startExpr = timeLiteral(*start)
 	}
 	stopExpr := ""
 	if end != nil {
-		stopExpr = ", stop: " + timeLiteral(*end)
+		stopExpr = ", stop: " + timeLiteral(end.Add(time.Nanosecond))
+	}
+	return "start: " + startExpr + stopExpr
+}
+
+func (s *InfluxStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
+	return s.QueryTelemetryWith(gpuID, Query{Start: start, End: end})
+}
+
+// QueryTelemetryWith does all of q in Flux: fields are filtered before the
+// pivot, downsampling merges series per field (so tags drop out) before
+// aggregateWindow, and tables are merged before sorting so the limit applies
+// to the GPU as a whole rather than per tag set.
+func (s *InfluxStore) QueryTelemetryWith(gpuID string, q Query) ([]model.Telemetry, error) {
+	if gpuID == "" {
+		return nil, fmt.Errorf("gpuID required")
+	}
+	return s.QueryFleet([]string{gpuID}, q)
+}
+
+// fluxAny returns a predicate matching r.<col> against any of vals.
+func fluxAny(col string, vals []string) string {
+	conds := make([]string, len(vals))
+	for i, v := range vals {
+		conds[i] = fmt.Sprintf("r.%s == %q", col, v)
+	}
+	return strings.Join(conds, " or ")
+}
+
+// fluxLabels returns a predicate matching every label of labels. Labels are
+// tags, so points without one lack the column, hence the exists checks.
+func fluxLabels(labels map[string]string) string {
+	conds := make([]string, 0, len(labels))
+	for _, k := range sortedKeys(labels) {
+		conds = append(conds, fmt.Sprintf("(exists r[%q] and r[%q] == %q)", k, k, labels[k]))
+	}
+	return strings.Join(conds, " and ")
+}
+
+// fluxScope returns a predicate for the points sc allows. Points without a
+// cluster tag lack the column, hence the exists check.
+func fluxScope(sc *Scope) string {
+	var conds []string
+	if len(sc.HostIDs) > 0 {
+		conds = append(conds, fluxAny("host_id", sc.HostIDs))
+	}
+	if len(sc.Clusters) > 0 {
+		conds = append(conds, "(exists r."+ClusterLabel+" and ("+fluxAny(ClusterLabel, sc.Clusters)+"))")
+	}
+	if len(conds) == 0 {
+		return "false"
+	}
+	return strings.Join(conds, " or ")
+}
+
+// QueryFleet is QueryTelemetryWith over several GPUs (all when gpuIDs is
+// empty). Downsampled series stay split by GPU, and equal timestamps are
+// ordered by GPU.
+func (s *InfluxStore) QueryFleet(gpuIDs []string, q Query) ([]model.Telemetry, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "from(bucket: %q)\n  |> range(%s)\n", s.bucket, rangeExpr(q.Start, q.End))
+	fmt.Fprintf(&b, "  |> filter(fn: (r) => r._measurement == %q)\n", s.measurement)
+	if len(gpuIDs) > 0 {
+		fmt.Fprintf(&b, "  |> filter(fn: (r) => %s)\n", fluxAny("gpu_id", gpuIDs))
+	}
+	if len(q.HostIDs) > 0 {
+		fmt.Fprintf(&b, "  |> filter(fn: (r) => %s)\n", fluxAny("host_id", q.HostIDs))
+	}
+	if len(q.ProducerIDs) > 0 {
+		fmt.Fprintf(&b, "  |> filter(fn: (r) => %s)\n", fluxAny("producer_id", q.ProducerIDs))
+	}
+	if len(q.Labels) > 0 {
+		fmt.Fprintf(&b, "  |> filter(fn: (r) => %s)\n", fluxLabels(q.Labels))
+	}
+	if q.Scope != nil {
+		fmt.Fprintf(&b, "  |> filter(fn: (r) => %s)\n", fluxScope(q.Scope))
+	}
+	if len(q.Metrics) > 0 {
+		fmt.Fprintf(&b, "  |> filter(fn: (r) => %s)\n", fluxAny("_field", influxFields(q.Metrics)))
+	}
+	if q.Step > 0 {
+		fmt.Fprintf(&b, "  |> filter(fn: (r) => %s)\n  |> group(columns: [\"gpu_id\", \"_field\"])\n", influxNumeric)
+		fmt.Fprintf(&b, "  |> aggregateWindow(every: %dns, fn: mean, createEmpty: false, timeSrc: \"_start\")\n", q.Step.Nanoseconds())
 	}
 	// Pivot fields so each timestamp becomes one row with all metric columns
-	q := fmt.Sprintf(`from(bucket: "%s")
-  |> range(start: %s%s)
-  |> filter(fn: (r) => r._measurement == "telemetry" and r.gpu_id == "%s")
+	b.WriteString("  |> pivot(rowKey:[\"_time\"], columnKey:[\"_field\"], valueColumn:\"_value\")\n  |> group()\n")
+	fmt.Fprintf(&b, "  |> sort(columns: [\"_time\", \"gpu_id\"], desc: %t)\n", q.Desc)
+	if q.Limit > 0 || q.Offset > 0 {
+		n := q.Limit
+		if n <= 0 {
+			n = math.MaxInt32 // limit() requires n; an offset alone keeps the rest
+		}
+		fmt.Fprintf(&b, "  |> limit(n: %d, offset: %d)\n", n, q.Offset)
+	}
+	return s.queryRows(b.String())
+}
+
+// LatestTelemetry takes last() of each series, which Influx answers from the
+// newest shard without scanning the window, and keeps the newest row.
+func (s *InfluxStore) LatestTelemetry(gpuID string) (*model.Telemetry, error) {
+	if gpuID == "" {
+		return nil, fmt.Errorf("gpuID required")
+	}
+	q := fmt.Sprintf(`from(bucket: %q)
+  |> range(start: 0)
+  |> filter(fn: (r) => r._measurement == %q and r.gpu_id == %q)
+  |> last()
   |> pivot(rowKey:["_time"], columnKey:["_field"], valueColumn:"_value")
-  |> sort(columns: ["_time"], desc: false)
-`, s.bucket, startExpr, stopExpr, gpuID)
-	res, err := s.qapi.Query(context.Background(), q)
+  |> group()
+  |> sort(columns: ["_time"], desc: true)
+  |> limit(n: 1)`, s.bucket, s.measurement, gpuID)
+	out, err := s.queryRows(q)
+	if err != nil || len(out) == 0 {
+		return nil, err
+	}
+	return &out[0], nil
+}
+
+// QueryLatest is LatestTelemetry for many GPUs in one query, keeping the
+// newest row of each.
+func (s *InfluxStore) QueryLatest(gpuIDs []string, sc *Scope) (map[string]*model.Telemetry, error) {
+	out := make(map[string]*model.Telemetry, len(gpuIDs))
+	if len(gpuIDs) == 0 {
+		return out, nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "from(bucket: %q)\n  |> range(start: 0)\n", s.bucket)
+	fmt.Fprintf(&b, "  |> filter(fn: (r) => r._measurement == %q)\n  |> filter(fn: (r) => %s)\n", s.measurement, fluxAny("gpu_id", gpuIDs))
+	if sc != nil {
+		fmt.Fprintf(&b, "  |> filter(fn: (r) => %s)\n", fluxScope(sc))
+	}
+	b.WriteString("  |> last()\n  |> pivot(rowKey:[\"_time\"], columnKey:[\"_field\"], valueColumn:\"_value\")\n")
+	b.WriteString("  |> group(columns: [\"gpu_id\"])\n  |> sort(columns: [\"_time\"], desc: true)\n  |> limit(n: 1)\n  |> group()")
+	items, err := s.queryRows(b.String())
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		out[items[i].GPUId] = &items[i]
+	}
+	return out, nil
+}
+
+// TopGPUs aggregates the metric per GPU in Flux and ranks the (one per GPU)
+// results here.
+func (s *InfluxStore) TopGPUs(q TopQuery) ([]GPUValue, error) {
+	fn := map[string]string{AggAvg: "mean", AggMax: "max", AggMin: "min", AggLast: "last"}[q.Agg]
+	if fn == "" {
+		return nil, fmt.Errorf("unknown aggregation %q", q.Agg)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "from(bucket: %q)\n  |> range(%s)\n", s.bucket, rangeExpr(q.Start, q.End))
+	fmt.Fprintf(&b, "  |> filter(fn: (r) => r._measurement == %q and r._field == %q)\n", s.measurement, q.Metric)
+	if q.Scope != nil {
+		fmt.Fprintf(&b, "  |> filter(fn: (r) => %s)\n", fluxScope(q.Scope))
+	}
+	// one table per GPU, whatever its other tags; last() needs it time-ordered
+	b.WriteString("  |> group(columns: [\"gpu_id\"])\n")
+	if q.Agg == AggLast {
+		b.WriteString("  |> sort(columns: [\"_time\"])\n")
+	}
+	fmt.Fprintf(&b, "  |> %s()\n", fn)
+	res, err := s.qapi.Query(s.callCtx(), b.String())
+	if err != nil {
+		return nil, fmt.Errorf("influx query: %w; flux=%s", err, b.String())
+	}
+	defer res.Close()
+	var out []GPUValue
+	for res.Next() {
+		rec := res.Record()
+		id, _ := rec.ValueByKey("gpu_id").(string)
+		var v float64
+		switch val := rec.Value().(type) {
+		case float64:
+			v = val
+		case int64:
+			v = float64(val)
+		case uint64:
+			v = float64(val)
+		default:
+			continue
+		}
+		out = append(out, GPUValue{GPUId: id, Value: v})
+	}
+	if err := res.Err(); err != nil {
+		return nil, fmt.Errorf("influx query: %w", err)
+	}
+	return RankValues(out, q.Asc, q.N), nil
+}
+
+// AggregateTelemetry buckets the field with aggregateWindow. Series of the
+// GPU that differ in other tags are merged first so each bucket is one value.
+func (s *InfluxStore) AggregateTelemetry(gpuID string, q AggregateQuery) ([]Bucket, error) {
+	fn := map[string]string{AggAvg: "mean", AggMax: "max", AggMin: "min", AggLast: "last"}[q.Agg]
+	if fn == "" {
+		return nil, fmt.Errorf("unknown aggregation %q", q.Agg)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "from(bucket: %q)\n  |> range(%s)\n", s.bucket, rangeExpr(q.Start, q.End))
+	fmt.Fprintf(&b, "  |> filter(fn: (r) => r._measurement == %q and r.gpu_id == %q and r._field == %q)\n", s.measurement, gpuID, q.Metric)
+	if q.Scope != nil {
+		fmt.Fprintf(&b, "  |> filter(fn: (r) => %s)\n", fluxScope(q.Scope))
+	}
+	b.WriteString("  |> group()\n  |> sort(columns: [\"_time\"])\n")
+	fmt.Fprintf(&b, "  |> aggregateWindow(every: %dns, fn: %s, createEmpty: false, timeSrc: \"_start\")\n", q.Step.Nanoseconds(), fn)
+	res, err := s.qapi.Query(s.callCtx(), b.String())
+	if err != nil {
+		return nil, fmt.Errorf("influx query: %w; flux=%s", err, b.String())
+	}
+	defer res.Close()
+	var out []Bucket
+	for res.Next() {
+		rec := res.Record()
+		var v float64
+		switch val := rec.Value().(type) {
+		case float64:
+			v = val
+		case int64:
+			v = float64(val)
+		case uint64:
+			v = float64(val)
+		default:
+			continue
+		}
+		out = append(out, Bucket{Timestamp: rec.Time().UTC(), Value: v})
+	}
+	if err := res.Err(); err != nil {
+		return nil, fmt.Errorf("influx query: %w", err)
+	}
+	return out, nil
+}
+
+// influxSummaryStats are the Flux reductions behind each MetricSummary
+// field, keyed by the stat tag SummarizeTelemetry sets on their results.
+var influxSummaryStats = [][2]string{
+	{"count", "count() |> toFloat()"},
+	{"min", "min()"},
+	{"max", "max()"},
+	{"mean", "mean()"},
+	{"stddev", "stddev(mode: \"population\")"},
+	{"p95", "quantile(q: 0.95, method: \"exact_selector\")"},
+}
+
+// SummarizeTelemetry reduces each field of the GPU in Flux, one union
+// branch per stat, and reassembles the rows here.
+func (s *InfluxStore) SummarizeTelemetry(gpuID string, q Query) (map[string]MetricSummary, error) {
+	var b strings.Builder
+	s.fluxValues(&b, []string{gpuID}, q)
+	b.WriteString("  |> group(columns: [\"_field\"])\nunion(tables: [\n")
+	for _, st := range influxSummaryStats {
+		fmt.Fprintf(&b, "  data |> %s |> keep(columns: [\"_field\", \"_value\"]) |> set(key: \"stat\", value: %q),\n", st[1], st[0])
+	}
+	b.WriteString("])\n")
+	res, err := s.qapi.Query(s.callCtx(), b.String())
+	if err != nil {
+		return nil, fmt.Errorf("influx query: %w; flux=%s", err, b.String())
+	}
+	defer res.Close()
+	out := map[string]MetricSummary{}
+	for res.Next() {
+		rec := res.Record()
+		v, ok := rec.Value().(float64)
+		if !ok {
+			continue
+		}
+		stat, _ := rec.ValueByKey("stat").(string)
+		sum := out[rec.Field()]
+		switch stat {
+		case "count":
+			sum.Count = int(v)
+		case "min":
+			sum.Min = v
+		case "max":
+			sum.Max = v
+		case "mean":
+			sum.Mean = v
+		case "stddev":
+			sum.StdDev = v
+		case "p95":
+			sum.P95 = v
+		}
+		out[rec.Field()] = sum
+	}
+	if err := res.Err(); err != nil {
+		return nil, fmt.Errorf("influx query: %w", err)
+	}
+	return out, nil
+}
+
+// fluxValues writes "data = ", the values of gpuIDs (every GPU when empty)
+// within q's window, filters and Scope, as floats.
+func (s *InfluxStore) fluxValues(b *strings.Builder, gpuIDs []string, q Query) {
+	fmt.Fprintf(b, "data = from(bucket: %q)\n  |> range(%s)\n", s.bucket, rangeExpr(q.Start, q.End))
+	fmt.Fprintf(b, "  |> filter(fn: (r) => r._measurement == %q and %s)\n", s.measurement, influxNumeric)
+	if len(gpuIDs) > 0 {
+		fmt.Fprintf(b, "  |> filter(fn: (r) => %s)\n", fluxAny("gpu_id", gpuIDs))
+	}
+	if len(q.HostIDs) > 0 {
+		fmt.Fprintf(b, "  |> filter(fn: (r) => %s)\n", fluxAny("host_id", q.HostIDs))
+	}
+	if len(q.ProducerIDs) > 0 {
+		fmt.Fprintf(b, "  |> filter(fn: (r) => %s)\n", fluxAny("producer_id", q.ProducerIDs))
+	}
+	if len(q.Labels) > 0 {
+		fmt.Fprintf(b, "  |> filter(fn: (r) => %s)\n", fluxLabels(q.Labels))
+	}
+	if q.Scope != nil {
+		fmt.Fprintf(b, "  |> filter(fn: (r) => %s)\n", fluxScope(q.Scope))
+	}
+	if len(q.Metrics) > 0 {
+		fmt.Fprintf(b, "  |> filter(fn: (r) => %s)\n", fluxAny("_field", q.Metrics))
+	}
+	b.WriteString("  |> toFloat()\n")
+}
+
+// ListMetrics counts the values of each GPU and field in Flux, with the
+// oldest and newest value's time, one union branch per stat.
+func (s *InfluxStore) ListMetrics(gpuIDs []string, q Query) (map[string][]MetricInfo, error) {
+	var b strings.Builder
+	s.fluxValues(&b, gpuIDs, q)
+	b.WriteString(`  |> group(columns: ["gpu_id", "_field"])
+union(tables: [
+  data |> count() |> keep(columns: ["gpu_id", "_field", "_value"]) |> set(key: "stat", value: "count"),
+  data |> min(column: "_time") |> keep(columns: ["gpu_id", "_field", "_time"]) |> set(key: "stat", value: "first"),
+  data |> max(column: "_time") |> keep(columns: ["gpu_id", "_field", "_time"]) |> set(key: "stat", value: "last"),
+])
+`)
+	res, err := s.qapi.Query(s.callCtx(), b.String())
+	if err != nil {
+		return nil, fmt.Errorf("influx query: %w; flux=%s", err, b.String())
+	}
+	defer res.Close()
+	byGPU := map[string]map[string]*MetricInfo{}
+	for res.Next() {
+		rec := res.Record()
+		gpuID, _ := rec.ValueByKey("gpu_id").(string)
+		if byGPU[gpuID] == nil {
+			byGPU[gpuID] = map[string]*MetricInfo{}
+		}
+		mi := byGPU[gpuID][rec.Field()]
+		if mi == nil {
+			mi = &MetricInfo{Name: rec.Field()}
+			byGPU[gpuID][rec.Field()] = mi
+		}
+		switch stat, _ := rec.ValueByKey("stat").(string); stat {
+		case "count":
+			n, _ := rec.Value().(int64)
+			mi.Samples = n
+		case "first":
+			mi.FirstSeen = rec.Time().UTC()
+		case "last":
+			mi.LastSeen = rec.Time().UTC()
+		}
+	}
+	if err := res.Err(); err != nil {
+		return nil, fmt.Errorf("influx query: %w", err)
+	}
+	out := make(map[string][]MetricInfo, len(byGPU))
+	for id, metrics := range byGPU {
+		list := make([]MetricInfo, 0, len(metrics))
+		for _, mi := range metrics {
+			list = append(list, *mi)
+		}
+		sortMetricInfo(list)
+		out[id] = list
+	}
+	return out, nil
+}
+
+// queryRows runs a query whose rows are pivoted to one timestamp each and
+// decodes them: numeric columns are metrics, remaining string columns labels,
+// and columns of typed value fields values.
+func (s *InfluxStore) queryRows(q string) ([]model.Telemetry, error) {
+	res, err := s.qapi.Query(s.callCtx(), q)
 	if err != nil {
 		return nil, fmt.Errorf("influx query: %w; flux=%s", err, q)
 	}
@@ -131,12 +745,54 @@ func (s *InfluxStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]mod
 		rec := res.Record()
 		ts := rec.Time().UTC()
 		metrics := map[string]float64{}
-		// Collect all columns except metadata
+		var labels map[string]string
+		var values map[string]model.Value
+		var gpuID, hostID, producerID string
+		// Collect all columns except metadata; remaining string columns are tags (labels)
 		for k, v := range rec.Values() {
-			if k == "_time" || k == "_measurement" || k == "result" || k == "table" || k == "gpu_id" {
+			if k == "_time" || k == "_measurement" || k == "result" || k == "table" {
+				continue
+			}
+			if name, ok := strings.CutPrefix(k, influxValuePrefix); ok {
+				var tv model.Value
+				switch val := v.(type) {
+				case float64:
+					tv = model.FloatValue(val)
+				case int64:
+					tv = model.IntValue(val)
+				case bool:
+					tv = model.BoolValue(val)
+				case string:
+					tv = model.StringValue(val)
+				default:
+					continue // nil: the point does not have it
+				}
+				if values == nil {
+					values = map[string]model.Value{}
+				}
+				values[name] = tv
 				continue
 			}
 			switch val := v.(type) {
+			case string:
+				if strings.HasPrefix(k, "_") || val == "" {
+					continue
+				}
+				switch k {
+				case "gpu_id":
+					gpuID = val
+					continue
+				case "host_id":
+					hostID = val
+					continue
+				case "producer_id":
+					producerID = val
+					continue
+				}
+				if labels == nil {
+					labels = map[string]string{}
+				}
+				labels[k] = val
 			case int64:
 				metrics[k] = float64(val)
 			case float64:
@@ -149,7 +805,7 @@ func (s *InfluxStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]mod
 				metrics[k] = float64(val)
 			}
 		}
-		out = append(out, model.Telemetry{GPUId: gpuID, Timestamp: ts, Metrics: metrics})
+		out = append(out, model.Telemetry{GPUId: gpuID, HostId: hostID, ProducerId: producerID, Timestamp: ts, Metrics: metrics, Labels: labels, Values: values})
 	}
 	if err := res.Err(); err != nil {
 		return nil, fmt.Errorf("influx query: %w", err)
@@ -160,3 +816,117 @@ func (s *InfluxStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]mod
 func timeToRFC3339(t time.Time) string {
 	return fmt.Sprintf("%q", t.UTC().Format(time.RFC3339))
 }
+
+// influxMinTime and influxMaxTime are the earliest and latest times
+// InfluxDB can store; the two lowest nanosecond values are reserved.
+var (
+	influxMinTime = time.Unix(0, math.MinInt64+2).UTC()
+	influxMaxTime = time.Unix(0, math.MaxInt64).UTC()
+)
+
+// DeleteTelemetry uses the delete API, which does not report how many points
+// it removed. The range starts at the earliest storable time, so a purge of a
+// GPU also removes points timestamped before 1970.
+func (s *InfluxStore) DeleteTelemetry(gpuID string, before time.Time) (int64, error) {
+	stop := influxMaxTime
+	if !before.IsZero() {
+		// the delete range includes stop
+		stop = before.Add(-time.Nanosecond)
+	}
+	predicate := fmt.Sprintf("_measurement=%q", s.measurement)
+	if gpuID != "" {
+		predicate += fmt.Sprintf(" AND gpu_id=%q", gpuID)
+	}
+	if err := s.client.DeleteAPI().DeleteWithName(s.callCtx(), s.org, s.bucket, influxMinTime, stop, predicate); err != nil {
+		return 0, fmt.Errorf("influx delete: %w", err)
+	}
+	return -1, nil
+}
+
+// Alert rules live in the "alert_rules" measurement, one series per rule_id
+// whose latest doc field is the current document; deleting writes an empty
+// doc. Webhook subscriptions live in "webhooks" the same way, keyed by
+// webhook_id, and GPU inventory in "gpu_inventory", keyed by gpu_id. The
+// bucket's retention applies, so it must outlive them.
+const (
+	influxRulesMeasurement     = "alert_rules"
+	influxWebhooksMeasurement  = "webhooks"
+	influxInventoryMeasurement = "gpu_inventory"
+)
+
+func (s *InfluxStore) SaveRule(id string, doc []byte) error {
+	return s.writeDoc(influxRulesMeasurement, "rule_id", id, string(doc))
+}
+
+func (s *InfluxStore) DeleteRule(id string) (bool, error) {
+	return s.deleteDoc(influxRulesMeasurement, "rule_id", id)
+}
+
+func (s *InfluxStore) ListRules() (map[string][]byte, error) {
+	return s.listDocs(influxRulesMeasurement, "rule_id")
+}
+
+func (s *InfluxStore) SaveWebhook(id string, doc []byte) error {
+	return s.writeDoc(influxWebhooksMeasurement, "webhook_id", id, string(doc))
+}
+
+func (s *InfluxStore) DeleteWebhook(id string) (bool, error) {
+	return s.deleteDoc(influxWebhooksMeasurement, "webhook_id", id)
+}
+
+func (s *InfluxStore) ListWebhooks() (map[string][]byte, error) {
+	return s.listDocs(influxWebhooksMeasurement, "webhook_id")
+}
+
+func (s *InfluxStore) SaveGPUInfo(gpuID string, doc []byte) error {
+	return s.writeDoc(influxInventoryMeasurement, "gpu_id", gpuID, string(doc))
+}
+
+func (s *InfluxStore) ListGPUInfo() (map[string][]byte, error) {
+	return s.listDocs(influxInventoryMeasurement, "gpu_id")
+}
+
+func (s *InfluxStore) deleteDoc(measurement, tag, id string) (bool, error) {
+	docs, err := s.listDocs(measurement, tag)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := docs[id]; !ok {
+		return false, nil
+	}
+	return true, s.writeDoc(measurement, tag, id, "")
+}
+
+func (s *InfluxStore) writeDoc(measurement, tag, id, doc string) error {
+	p := influxdb2.NewPoint(measurement, map[string]string{tag: id}, map[string]interface{}{"doc": doc}, time.Now())
+	if err := s.wapi.WritePoint(s.callCtx(), p); err != nil {
+		return fmt.Errorf("influx save %s: %w", measurement, err)
+	}
+	return nil
+}
+
+func (s *InfluxStore) listDocs(measurement, tag string) (map[string][]byte, error) {
+	q := fmt.Sprintf(`from(bucket: %q)
+  |> range(start: 0)
+  |> filter(fn: (r) => r._measurement == %q and r._field == "doc")
+  |> group(columns: [%q])
+  |> last()`, s.bucket, measurement, tag)
+	res, err := s.qapi.Query(s.callCtx(), q)
+	if err != nil {
+		return nil, fmt.Errorf("influx query: %w; flux=%s", err, q)
+	}
+	defer res.Close()
+	out := map[string][]byte{}
+	for res.Next() {
+		rec := res.Record()
+		id, _ := rec.ValueByKey(tag).(string)
+		doc, _ := rec.Value().(string)
+		if id != "" && doc != "" {
+			out[id] = []byte(doc)
+		}
+	}
+	if err := res.Err(); err != nil {
+		return nil, fmt.Errorf("influx query: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,292 @@
+//go:build integration
+
+// Integration tests against a real InfluxDB, started in Docker with
+// testcontainers-go. Run them with
+//
+//	go test -tags integration ./internal/storage/
+//
+// They are skipped when no Docker daemon is reachable. One container serves
+// the whole run; each test writes to a bucket of its own.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	influxITImage = "influxdb:2.7"
+	influxITOrg   = "it"
+	influxITToken = "integration-token"
+)
+
+var influxIT struct {
+	once sync.Once
+	ctr  testcontainers.Container
+	url  string
+	err  error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if influxIT.ctr != nil {
+		_ = testcontainers.TerminateContainer(influxIT.ctr)
+	}
+	os.Exit(code)
+}
+
+// influxITStore returns an InfluxStore on a new, empty bucket of the shared
+// container, starting it on first use. The test is skipped if it cannot be
+// started.
+func influxITStore(t *testing.T) *InfluxStore {
+	t.Helper()
+	influxIT.once.Do(func() {
+		// testcontainers panics when it finds no Docker host at all
+		defer func() {
+			if r := recover(); r != nil {
+				influxIT.err = fmt.Errorf("%v", r)
+			}
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+		defer cancel()
+		influxIT.ctr, influxIT.err = testcontainers.Run(ctx, influxITImage,
+			testcontainers.WithExposedPorts("8086/tcp"),
+			testcontainers.WithEnv(map[string]string{
+				"DOCKER_INFLUXDB_INIT_MODE":        "setup",
+				"DOCKER_INFLUXDB_INIT_USERNAME":    "it",
+				"DOCKER_INFLUXDB_INIT_PASSWORD":    "integration-password",
+				"DOCKER_INFLUXDB_INIT_ORG":         influxITOrg,
+				"DOCKER_INFLUXDB_INIT_BUCKET":      "default",
+				"DOCKER_INFLUXDB_INIT_ADMIN_TOKEN": influxITToken,
+			}),
+			testcontainers.WithWaitStrategy(wait.ForHTTP("/health").WithPort("8086/tcp").WithStartupTimeout(2*time.Minute)),
+		)
+		if influxIT.err == nil {
+			influxIT.url, influxIT.err = influxIT.ctr.PortEndpoint(ctx, "8086/tcp", "http")
+		}
+	})
+	if influxIT.err != nil {
+		t.Skipf("influxdb container unavailable: %v", influxIT.err)
+	}
+
+	bucket := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	client := influxdb2.NewClient(influxIT.url, influxITToken)
+	defer client.Close()
+	ctx := context.Background()
+	org, err := client.OrganizationsAPI().FindOrganizationByName(ctx, influxITOrg)
+	if err != nil {
+		t.Fatalf("find org: %v", err)
+	}
+	if _, err := client.BucketsAPI().CreateBucketWithName(ctx, org, bucket); err != nil {
+		t.Fatalf("create bucket %s: %v", bucket, err)
+	}
+	st, err := NewInfluxStore(influxIT.url, influxITOrg, bucket, influxITToken)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = st.(*InfluxStore).Close() })
+	return st.(*InfluxStore)
+}
+
+// integrationFixture saves, in batches of 25, 60 points a minute apart for
+// g1 (h1, rack r1) and g2 (h2, rack r2) with temp and util, plus one g3
+// point, into every store. It returns the time of the first point.
+func integrationFixture(t *testing.T, stores ...Store) time.Time {
+	t.Helper()
+	t0 := time.Unix(1700000000, 0).UTC()
+	var items []model.Telemetry
+	for i := 0; i < 60; i++ {
+		for g, gpu := range []string{"g1", "g2"} {
+			items = append(items, model.Telemetry{
+				GPUId:      gpu,
+				HostId:     fmt.Sprintf("h%d", g+1),
+				ProducerId: "p1",
+				Labels:     map[string]string{"rack": fmt.Sprintf("r%d", g+1)},
+				Timestamp:  t0.Add(time.Duration(i) * time.Minute),
+				Metrics:    map[string]float64{"temp": float64(50 + g*10 + i%7), "util": float64(i*13%100 + g)},
+			})
+		}
+	}
+	items = append(items, model.Telemetry{GPUId: "g3", HostId: "h3", Timestamp: t0, Metrics: map[string]float64{"temp": 40}})
+	for _, st := range stores {
+		for i := 0; i < len(items); i += 25 {
+			if err := st.SaveTelemetryBatch(items[i:min(i+25, len(items))]); err != nil {
+				t.Fatalf("save batch: %v", err)
+			}
+		}
+	}
+	return t0
+}
+
+// sameItems reports how got, read from InfluxDB, differs from want, read
+// from the memory store, or "" if it does not. Host, producer and labels are
+// compared unless the query downsampled.
+func sameItems(got, want []model.Telemetry, step bool) string {
+	if len(got) != len(want) {
+		return fmt.Sprintf("%d items, want %d", len(got), len(want))
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if g.GPUId != w.GPUId || !g.Timestamp.Equal(w.Timestamp) || !reflect.DeepEqual(g.Metrics, w.Metrics) {
+			return fmt.Sprintf("item %d = %s@%s %v, want %s@%s %v", i, g.GPUId, g.Timestamp, g.Metrics, w.GPUId, w.Timestamp, w.Metrics)
+		}
+		if step {
+			continue
+		}
+		if g.HostId != w.HostId || g.ProducerId != w.ProducerId || len(g.Labels) != len(w.Labels) ||
+			(len(w.Labels) > 0 && !reflect.DeepEqual(g.Labels, w.Labels)) {
+			return fmt.Sprintf("item %d attribution = %s %s %v, want %s %s %v", i, g.HostId, g.ProducerId, g.Labels, w.HostId, w.ProducerId, w.Labels)
+		}
+	}
+	return ""
+}
+
+func TestInfluxIntegration_BatchWritesAndWindows(t *testing.T) {
+	// Scenario: the fixture saved in batches to InfluxDB and to the memory
+	// store, then queried per GPU and across the fleet with windows whose
+	// ends fall on points, filters, metric selection, downsampling and paging
+	// Expect: InfluxDB answers every query as the memory store does
+	st, mem := influxITStore(t), NewMemoryStore()
+	t0 := integrationFixture(t, st, mem)
+	if ids, err := st.ListGPUs(); err != nil || strings.Join(ids, ",") != "g1,g2,g3" {
+		t.Fatalf("gpus: %v %v", ids, err)
+	}
+	at := func(m int) *time.Time { ts := t0.Add(time.Duration(m) * time.Minute); return &ts }
+	for name, q := range map[string]Query{
+		"all":          {},
+		"window":       {Start: at(10), End: at(20)},
+		"open end":     {Start: at(55)},
+		"hosts":        {HostIDs: []string{"h2", "h3"}, End: at(5)},
+		"labels":       {Labels: map[string]string{"rack": "r1"}, Start: at(30)},
+		"metrics":      {Metrics: []string{"util"}, End: at(9)},
+		"step":         {Step: 10 * time.Minute},
+		"step window":  {Step: 5 * time.Minute, Start: at(20), End: at(40)},
+		"desc paged":   {Desc: true, Offset: 3, Limit: 7},
+		"offset alone": {Offset: 50},
+	} {
+		for _, gpu := range []string{"g1", "g3"} {
+			got, err := Execute(st, gpu, q)
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, gpu, err)
+			}
+			want, _ := Execute(mem, gpu, q)
+			if diff := sameItems(got, want, q.Step > 0); diff != "" {
+				t.Errorf("%s %s: %s", name, gpu, diff)
+			}
+		}
+		got, err := ExecuteFleet(st, nil, q)
+		if err != nil {
+			t.Fatalf("%s fleet: %v", name, err)
+		}
+		want, _ := ExecuteFleet(mem, nil, q)
+		if diff := sameItems(got, want, q.Step > 0); diff != "" {
+			t.Errorf("%s fleet: %s", name, diff)
+		}
+	}
+}
+
+func TestInfluxIntegration_Aggregates(t *testing.T) {
+	// Scenario: the fixture in InfluxDB and the memory store, aggregated per
+	// 10-minute bucket with every function, ranked across GPUs and summarized
+	// Expect: the Flux aggregations give the memory store's results
+	st, mem := influxITStore(t), NewMemoryStore()
+	t0 := integrationFixture(t, st, mem)
+	start, end := t0.Add(10*time.Minute), t0.Add(50*time.Minute)
+	for _, agg := range []string{AggAvg, AggMax, AggMin, AggLast} {
+		q := AggregateQuery{Metric: "temp", Start: &start, End: &end, Step: 10 * time.Minute, Agg: agg}
+		got, err := Aggregate(st, "g1", q)
+		if err != nil {
+			t.Fatalf("aggregate %s: %v", agg, err)
+		}
+		want, _ := Aggregate(mem, "g1", q)
+		if len(got) != len(want) {
+			t.Fatalf("aggregate %s: %v, want %v", agg, got, want)
+		}
+		for i := range got {
+			if !got[i].Timestamp.Equal(want[i].Timestamp) || math.Abs(got[i].Value-want[i].Value) > 1e-9 {
+				t.Errorf("aggregate %s bucket %d = %v, want %v", agg, i, got[i], want[i])
+			}
+		}
+
+		top, err := Top(st, TopQuery{Metric: "temp", Agg: agg})
+		if err != nil {
+			t.Fatalf("top %s: %v", agg, err)
+		}
+		wantTop, _ := Top(mem, TopQuery{Metric: "temp", Agg: agg})
+		if len(top) != len(wantTop) {
+			t.Fatalf("top %s: %v, want %v", agg, top, wantTop)
+		}
+		for i := range top {
+			if top[i].GPUId != wantTop[i].GPUId || math.Abs(top[i].Value-wantTop[i].Value) > 1e-9 {
+				t.Errorf("top %s = %v, want %v", agg, top, wantTop)
+				break
+			}
+		}
+	}
+
+	q := Query{Start: &start, End: &end}
+	got, err := Summarize(st, "g2", q)
+	if err != nil {
+		t.Fatalf("summarize: %v", err)
+	}
+	want, _ := Summarize(mem, "g2", q)
+	if len(got) != len(want) {
+		t.Fatalf("summarize: %v, want %v", got, want)
+	}
+	for m, w := range want {
+		g := got[m]
+		if g.Count != w.Count || g.Min != w.Min || g.Max != w.Max || g.P95 != w.P95 ||
+			math.Abs(g.Mean-w.Mean) > 1e-9 || math.Abs(g.StdDev-w.StdDev) > 1e-9 {
+			t.Errorf("summary of %s = %+v, want %+v", m, g, w)
+		}
+	}
+}
+
+func TestInfluxIntegration_Retention(t *testing.T) {
+	// Scenario: g1's points before minute 30 deleted, then all of g3
+	// Expect: g1 keeps minutes 30 to 59, g2 is untouched and g3 is gone
+	st := influxITStore(t)
+	t0 := integrationFixture(t, st)
+	if _, err := st.DeleteTelemetry("g1", t0.Add(30*time.Minute)); err != nil {
+		t.Fatalf("delete g1: %v", err)
+	}
+	items, err := st.QueryTelemetry("g1", nil, nil)
+	if err != nil || len(items) != 30 || !items[0].Timestamp.Equal(t0.Add(30*time.Minute)) {
+		t.Fatalf("g1 after delete: %d items %v", len(items), err)
+	}
+	if items, _ := st.QueryTelemetry("g2", nil, nil); len(items) != 60 {
+		t.Fatalf("g2 after deleting g1: %d items", len(items))
+	}
+	if _, err := st.DeleteTelemetry("g3", time.Time{}); err != nil {
+		t.Fatalf("delete g3: %v", err)
+	}
+	if ids, err := st.ListGPUs(); err != nil || strings.Join(ids, ",") != "g1,g2" {
+		t.Fatalf("gpus after purge: %v %v", ids, err)
+	}
+}
+
+func TestInfluxIntegration_SharedChecks(t *testing.T) {
+	// Scenario: checks the embedded stores pass, each on a bucket of its own
+	// Expect: attribution filters and scoped views behave as on those stores
+	t.Run("attribution", func(t *testing.T) {
+		checkAttributionFilters(t, influxITStore(t))
+	})
+	t.Run("scoped", func(t *testing.T) {
+		st := influxITStore(t)
+		scopeFixture(t, st)
+		checkScoped(t, st)
+	})
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+func TestInfluxStoreAsync_WriteFailures(t *testing.T) {
+	// Scenario: a server answering 503 to gpu-a's writes and 400 to the
+	// others; batches of one point and one retry allowed; gpu-a is written,
+	// then gpu-b after the retry delay, then gpu-c
+	// Expect: the saves return at once; gpu-a's batch reaches OnWriteFailed
+	// when gpu-b's write retries it; gpu-c's rejection is counted as dropped
+	// but, as the client does not return it, not passed on
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "gpu_id=gpu-a") {
+			http.Error(w, `{"code":"unavailable","message":"down"}`, http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, `{"code":"invalid","message":"bad point"}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	var mu sync.Mutex
+	var failed []string
+	st, err := NewInfluxStoreAsync(srv.URL, "org", "bucket", "token", "telemetry", InfluxAsync{
+		BatchSize: 1, MaxRetries: 1, RetryInterval: time.Millisecond,
+		OnWriteFailed: func(lines string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, lines)
+		},
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer st.Close()
+	waitFor := func(what string, ok func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !ok(); time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+	if err := st.SaveTelemetry(model.Telemetry{GPUId: "gpu-a", Timestamp: t0, Metrics: map[string]float64{"temp": 60}}); err != nil {
+		t.Fatalf("save a: %v", err)
+	}
+	waitFor("gpu-a's first attempt", func() bool { return st.WriteStats().Errors == 1 })
+	time.Sleep(20 * time.Millisecond)
+	if err := st.SaveTelemetryBatch([]model.Telemetry{{GPUId: "gpu-b", Timestamp: t0, Metrics: map[string]float64{"temp": 61}}}); err != nil {
+		t.Fatalf("save b: %v", err)
+	}
+	waitFor("gpu-a to be given up", func() bool { mu.Lock(); defer mu.Unlock(); return len(failed) == 1 })
+	if !strings.Contains(failed[0], "gpu_id=gpu-a") || !strings.Contains(failed[0], "temp=60") {
+		t.Fatalf("failed batch: %q", failed[0])
+	}
+
+	st2, err := NewInfluxStoreAsync(srv.URL, "org", "bucket", "token", "telemetry", InfluxAsync{BatchSize: 1,
+		OnWriteFailed: func(string, error) { t.Error("rejected batch passed on") }})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer st2.Close()
+	_ = st2.SaveTelemetry(model.Telemetry{GPUId: "gpu-c", Timestamp: t0, Metrics: map[string]float64{"temp": 62}})
+	waitFor("gpu-c to be dropped", func() bool { return st2.WriteStats() == InfluxWriteStats{Errors: 1, Dropped: 1} })
+}
+
+func TestRangeExpr_IncludesEnd(t *testing.T) {
+	// Scenario: windows with sub-second bounds, open at either end
+	// Expect: nanosecond-precise literals; the stop is 1ns past End, as
+	// range() excludes its stop and Query.End is inclusive
+	start := time.Date(2026, 1, 27, 10, 0, 0, 500, time.UTC)
+	end := time.Date(2026, 1, 27, 11, 0, 0, 250000000, time.UTC)
+	for _, c := range []struct {
+		start, end *time.Time
+		want       string
+	}{
+		{&start, &end, `start: time(v: "2026-01-27T10:00:00.0000005Z"), stop: time(v: "2026-01-27T11:00:00.250000001Z")`},
+		{nil, &end, `start: 0, stop: time(v: "2026-01-27T11:00:00.250000001Z")`},
+		{&start, nil, `start: time(v: "2026-01-27T10:00:00.0000005Z")`},
+		{nil, nil, `start: 0`},
+	} {
+		if got := rangeExpr(c.start, c.end); got != c.want {
+			t.Errorf("rangeExpr = %s, want %s", got, c.want)
+		}
+	}
+}
+
+func TestInfluxPoint_RedeliveryOverwrites(t *testing.T) {
+	// Scenario: the same point encoded twice, its labels and metrics built in
+	// different orders
+	// Expect: the same line, so InfluxDB overwrites the first write in place
+	t0 := time.Unix(1700000000, 123).UTC()
+	a := model.Telemetry{GPUId: "g1", HostId: "h1", Timestamp: t0, Labels: map[string]string{"rack": "r1", "cluster": "c1"},
+		Metrics: map[string]float64{"temp": 60, "util": 5, "power": 300}}
+	b := model.Telemetry{GPUId: "g1", HostId: "h1", Timestamp: t0, Labels: map[string]string{"cluster": "c1", "rack": "r1"},
+		Metrics: map[string]float64{"power": 300, "util": 5, "temp": 60}}
+	la := write.PointToLineProtocol(influxPoint("telemetry", a), time.Nanosecond)
+	if lb := write.PointToLineProtocol(influxPoint("telemetry", b), time.Nanosecond); la != lb || !strings.HasSuffix(strings.TrimSpace(la), " 1700000000000000123") {
+		t.Fatalf("%q != %q", la, lb)
+	}
+}
+
+func TestInfluxPoint_TypedValues(t *testing.T) {
+	// Scenario: a point with a metric and typed values of each kind
+	// Expect: the metric as a float field; each value as a prefixed field of
+	// its own InfluxDB type
+	p := model.Telemetry{GPUId: "g1", Timestamp: time.Unix(1700000000, 0).UTC(), Metrics: map[string]float64{"temp": 60},
+		Values: map[string]model.Value{"pstate": model.StringValue("P0"), "serial": model.IntValue(1 << 60), "ecc": model.BoolValue(true)}}
+	line := write.PointToLineProtocol(influxPoint("telemetry", p), time.Nanosecond)
+	for _, want := range []string{`_v_ecc=true`, `_v_pstate="P0"`, `_v_serial=1152921504606846976i`, `temp=60`} {
+		if !strings.Contains(line, want) {
+			t.Fatalf("%q lacks %s", line, want)
+		}
+	}
+}
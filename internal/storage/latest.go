@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// LatestIndex holds the newest point of each GPU outside the time-series
+// store, e.g. in Redis, for current-state reads.
+type LatestIndex interface {
+	// Put records each point unless the index holds a newer one of its GPU.
+	Put(ctx context.Context, items []model.Telemetry) error
+	// Get returns the held points of gpuIDs; GPUs without one are absent.
+	Get(ctx context.Context, gpuIDs []string) (map[string]*model.Telemetry, error)
+	// Forget drops the held point of gpuID (every GPU when empty) if it is
+	// older than before (of any age when before is zero).
+	Forget(ctx context.Context, gpuID string, before time.Time) error
+}
+
+// LatestCache answers latest-point reads from a LatestIndex it updates on
+// every write, so current-state views do not query the time-series store.
+// GPUs the index misses, or whose held point a scope rejects, are read from
+// base; an unscoped miss is put back into the index.
+//
+// The index is best effort for writes and reads: its errors are passed to
+// onErr, reads falling back to base. A point the index failed to take leaves
+// the GPU's held point stale until its next write. Deletions do fail when
+// the index cannot drop the points they covered.
+type LatestCache struct {
+	base  Store
+	index LatestIndex
+	onErr func(error)
+	ctx   context.Context
+}
+
+// NewLatestCache returns base with latest reads served from index; onErr
+// may be nil.
+func NewLatestCache(base Store, index LatestIndex, onErr func(error)) *LatestCache {
+	if onErr == nil {
+		onErr = func(error) {}
+	}
+	return &LatestCache{base: base, index: index, onErr: onErr, ctx: context.Background()}
+}
+
+func (s *LatestCache) WithContext(ctx context.Context) Store {
+	return &LatestCache{base: WithContext(ctx, s.base), index: s.index, onErr: s.onErr, ctx: ctx}
+}
+
+func (s *LatestCache) put(items []model.Telemetry) {
+	// only the newest point of each GPU can change the index
+	newest := map[string]int{}
+	for i, t := range items {
+		if j, ok := newest[t.GPUId]; !ok || t.Timestamp.After(items[j].Timestamp) {
+			newest[t.GPUId] = i
+		}
+	}
+	if len(newest) == 0 {
+		return
+	}
+	put := make([]model.Telemetry, 0, len(newest))
+	for _, id := range sortedKeys(newest) {
+		put = append(put, items[newest[id]])
+	}
+	if err := s.index.Put(s.ctx, put); err != nil {
+		s.onErr(fmt.Errorf("latest index put: %w", err))
+	}
+}
+
+func (s *LatestCache) SaveTelemetry(t model.Telemetry) error {
+	if err := s.base.SaveTelemetry(t); err != nil {
+		return err
+	}
+	s.put([]model.Telemetry{t})
+	return nil
+}
+
+func (s *LatestCache) SaveTelemetryBatch(items []model.Telemetry) error {
+	err := s.base.SaveTelemetryBatch(items)
+	failed := FailedItems(err, len(items))
+	if len(failed) == len(items) {
+		return err
+	}
+	written := items
+	if len(failed) > 0 {
+		written = make([]model.Telemetry, 0, len(items)-len(failed))
+		for i, t := range items {
+			if _, ok := failed[i]; !ok {
+				written = append(written, t)
+			}
+		}
+	}
+	s.put(written)
+	return err
+}
+
+func (s *LatestCache) ListGPUs() ([]string, error) { return s.base.ListGPUs() }
+
+func (s *LatestCache) ListGPUsIn(sc Scope) ([]string, error) { return Scoped(s.base, sc).ListGPUs() }
+
+func (s *LatestCache) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
+	return s.base.QueryTelemetry(gpuID, start, end)
+}
+
+func (s *LatestCache) QueryTelemetryWith(gpuID string, q Query) ([]model.Telemetry, error) {
+	return Execute(s.base, gpuID, q)
+}
+
+func (s *LatestCache) QueryFleet(gpuIDs []string, q Query) ([]model.Telemetry, error) {
+	return ExecuteFleet(s.base, gpuIDs, q)
+}
+
+func (s *LatestCache) LatestTelemetry(gpuID string) (*model.Telemetry, error) {
+	m, err := s.QueryLatest([]string{gpuID}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return m[gpuID], nil
+}
+
+func (s *LatestCache) QueryLatest(gpuIDs []string, sc *Scope) (map[string]*model.Telemetry, error) {
+	held, err := s.index.Get(s.ctx, gpuIDs)
+	if err != nil {
+		s.onErr(fmt.Errorf("latest index get: %w", err))
+		held = nil
+	}
+	out := make(map[string]*model.Telemetry, len(gpuIDs))
+	var rest []string
+	for _, id := range gpuIDs {
+		if t, ok := held[id]; ok && (sc == nil || sc.Allows(*t)) {
+			out[id] = t
+		} else {
+			rest = append(rest, id)
+		}
+	}
+	if len(rest) == 0 {
+		return out, nil
+	}
+	found, err := LatestMany(s.base, rest, sc)
+	var refill []model.Telemetry
+	for id, t := range found {
+		out[id] = t
+		if sc == nil {
+			refill = append(refill, *t)
+		}
+	}
+	if len(refill) > 0 {
+		if perr := s.index.Put(s.ctx, refill); perr != nil {
+			s.onErr(fmt.Errorf("latest index put: %w", perr))
+		}
+	}
+	return out, err
+}
+
+func (s *LatestCache) TopGPUs(q TopQuery) ([]GPUValue, error) { return Top(s.base, q) }
+
+func (s *LatestCache) AggregateTelemetry(gpuID string, q AggregateQuery) ([]Bucket, error) {
+	return Aggregate(s.base, gpuID, q)
+}
+
+func (s *LatestCache) SummarizeTelemetry(gpuID string, q Query) (map[string]MetricSummary, error) {
+	return Summarize(s.base, gpuID, q)
+}
+
+func (s *LatestCache) ListMetrics(gpuIDs []string, q Query) (map[string][]MetricInfo, error) {
+	return ListMetrics(s.base, gpuIDs, q)
+}
+
+// DeleteTelemetry deletes from base, then drops the held points the
+// deletion covered; the next read of those GPUs finds what base kept.
+func (s *LatestCache) DeleteTelemetry(gpuID string, before time.Time) (int64, error) {
+	d, ok := s.base.(Deleter)
+	if !ok {
+		return 0, fmt.Errorf("latest cache delete telemetry: the store cannot delete")
+	}
+	n, err := d.DeleteTelemetry(gpuID, before)
+	if err != nil {
+		return n, err
+	}
+	if err := s.index.Forget(s.ctx, gpuID, before); err != nil {
+		return n, fmt.Errorf("latest index forget: %w", err)
+	}
+	return n, nil
+}
+
+// DeleteMetrics deletes from base, then drops the held points the deletion
+// covered, as DeleteTelemetry does.
+func (s *LatestCache) DeleteMetrics(gpuID string, metrics []string, before time.Time) (int64, error) {
+	d, ok := s.base.(MetricDeleter)
+	if !ok {
+		return 0, fmt.Errorf("latest cache delete metrics: the store cannot delete metrics")
+	}
+	n, err := d.DeleteMetrics(gpuID, metrics, before)
+	if err != nil {
+		return n, err
+	}
+	if err := s.index.Forget(s.ctx, gpuID, before); err != nil {
+		return n, fmt.Errorf("latest index forget: %w", err)
+	}
+	return n, nil
+}
+
+func (s *LatestCache) Ping(ctx context.Context) error {
+	if p, ok := s.base.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
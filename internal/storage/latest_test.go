@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// mapIndex is a LatestIndex in a map; with down set, Get fails.
+type mapIndex struct {
+	held map[string]model.Telemetry
+	down bool
+}
+
+func (m *mapIndex) Put(_ context.Context, items []model.Telemetry) error {
+	for _, t := range items {
+		if cur, ok := m.held[t.GPUId]; !ok || t.Timestamp.After(cur.Timestamp) {
+			m.held[t.GPUId] = t
+		}
+	}
+	return nil
+}
+
+func (m *mapIndex) Get(_ context.Context, gpuIDs []string) (map[string]*model.Telemetry, error) {
+	if m.down {
+		return nil, errors.New("down")
+	}
+	out := map[string]*model.Telemetry{}
+	for _, id := range gpuIDs {
+		if t, ok := m.held[id]; ok {
+			out[id] = &t
+		}
+	}
+	return out, nil
+}
+
+func (m *mapIndex) Forget(_ context.Context, gpuID string, before time.Time) error {
+	for id, t := range m.held {
+		if (gpuID == "" || id == gpuID) && (before.IsZero() || t.Timestamp.Before(before)) {
+			delete(m.held, id)
+		}
+	}
+	return nil
+}
+
+func TestLatestCache_ServesLatestFromIndex(t *testing.T) {
+	// Scenario: a batch of two GPUs written through the cache, a GPU the
+	// index misses, a scope rejecting a held point, the index down, and a
+	// deletion of a GPU's newest points
+	// Expect: the index holds each GPU's newest point and answers for it; a
+	// miss is read from base and put back; the scoped read and the outage
+	// fall back to base; the deletion drops the held point
+	base, idx := NewMemoryStore(), &mapIndex{held: map[string]model.Telemetry{}}
+	var errs []error
+	st := NewLatestCache(base, idx, func(err error) { errs = append(errs, err) })
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pt := func(gpu, host string, sec int, temp float64) model.Telemetry {
+		return model.Telemetry{GPUId: gpu, HostId: host, Timestamp: t0.Add(time.Duration(sec) * time.Second), Metrics: map[string]float64{"temp": temp}}
+	}
+	if err := st.SaveTelemetryBatch([]model.Telemetry{pt("g1", "h1", 2, 2), pt("g1", "h2", 1, 1), pt("g2", "h1", 1, 5)}); err != nil {
+		t.Fatal(err)
+	}
+	if idx.held["g1"].Metrics["temp"] != 2 || idx.held["g2"].Metrics["temp"] != 5 {
+		t.Fatalf("held: %+v", idx.held)
+	}
+	// a value only the index has shows the read did not reach base
+	idx.held["g2"] = pt("g2", "h1", 1, 50)
+	if l, err := st.LatestTelemetry("g2"); err != nil || l.Metrics["temp"] != 50 {
+		t.Fatalf("from index: %v %+v", err, l)
+	}
+
+	_ = base.SaveTelemetry(pt("g3", "h1", 1, 7))
+	if l, err := st.LatestTelemetry("g3"); err != nil || l.Metrics["temp"] != 7 || idx.held["g3"].Metrics["temp"] != 7 {
+		t.Fatalf("miss: %v %+v %+v", err, l, idx.held["g3"])
+	}
+
+	m, err := st.QueryLatest([]string{"g1", "g2"}, &Scope{HostIDs: []string{"h2"}})
+	if err != nil || len(m) != 1 || m["g1"].Metrics["temp"] != 1 {
+		t.Fatalf("scoped: %v %+v", err, m)
+	}
+	if idx.held["g1"].Metrics["temp"] != 2 {
+		t.Fatalf("a scoped read replaced the held point: %+v", idx.held["g1"])
+	}
+
+	idx.down = true
+	if l, err := st.LatestTelemetry("g2"); err != nil || l.Metrics["temp"] != 5 || len(errs) != 1 {
+		t.Fatalf("index down: %v %+v %v", err, l, errs)
+	}
+	idx.down = false
+
+	if _, err := st.DeleteTelemetry("g1", t0.Add(3*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := idx.held["g1"]; ok {
+		t.Fatal("the deleted point is still held")
+	}
+	if l, err := st.LatestTelemetry("g1"); err != nil || l != nil {
+		t.Fatalf("after delete: %v %+v", err, l)
+	}
+}
+
+func TestRedisTS_OrdersAsStrings(t *testing.T) {
+	a, b := redisTS(time.Unix(9, 0)), redisTS(time.Unix(10, 0))
+	if len(a) != 20 || !(a < b) || redisTS(time.Unix(-1, 0)) != redisTS(time.Unix(0, 0)) {
+		t.Fatalf("%s %s", a, b)
+	}
+}
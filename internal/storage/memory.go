@@ -10,22 +10,160 @@ import (
 
 // MemoryStore is a threadsafe in-memory implementation of Store.
 type MemoryStore struct {
-	mu   sync.RWMutex
-	data map[string][]model.Telemetry // gpuID -> ordered by time asc
+	mu       sync.RWMutex
+	data     map[string][]model.Telemetry // gpuID -> ordered by time asc
+	keys     map[string]struct{}          // idempotency keys already stored
+	rules    map[string][]byte            // alert rule id -> document
+	webhooks map[string][]byte            // webhook id -> document
+	gpuInfo  map[string][]byte            // gpu id -> inventory document
+
+	limits  MemoryLimits
+	now     func() time.Time
+	swept   time.Time // last expiry pass over every GPU
+	evicted MemoryEvictions
+}
+
+// MemoryLimits bound a MemoryStore. Zero fields are unlimited.
+type MemoryLimits struct {
+	// MaxPointsPerGPU keeps only the newest points of each GPU.
+	MaxPointsPerGPU int
+	// MaxAge drops points older than this, by their timestamp.
+	MaxAge time.Duration
 }
 
+// MemoryEvictions counts the points a bounded MemoryStore dropped, by the
+// limit that dropped them.
+type MemoryEvictions struct {
+	Capacity uint64 // over MaxPointsPerGPU
+	Age      uint64 // older than MaxAge
+}
+
+// memorySweepEvery is how often a write also expires the points of GPUs
+// that are not being written to.
+const memorySweepEvery = time.Minute
+
 func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{data: make(map[string][]model.Telemetry)}
+	return NewBoundedMemoryStore(MemoryLimits{})
+}
+
+// NewBoundedMemoryStore returns a MemoryStore that evicts points beyond
+// limits as it is written to. The idempotency keys of evicted points are
+// forgotten, so the keys do not grow without bound either.
+func NewBoundedMemoryStore(limits MemoryLimits) *MemoryStore {
+	return &MemoryStore{data: make(map[string][]model.Telemetry), keys: make(map[string]struct{}), limits: limits, now: time.Now}
+}
+
+// Evictions returns the points dropped so far to stay within the limits.
+func (m *MemoryStore) Evictions() MemoryEvictions {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.evicted
+}
+
+// evict drops the points of gpuID beyond the limits: first the expired
+// ones, then the oldest over the cap. The series is resliced rather than
+// copied, so the freed head is reclaimed when append next grows the array;
+// the caller must hold mu for writing.
+func (m *MemoryStore) evict(gpuID string, now time.Time) {
+	s := m.data[gpuID]
+	drop := 0
+	if m.limits.MaxAge > 0 {
+		cutoff := now.Add(-m.limits.MaxAge)
+		drop = sort.Search(len(s), func(i int) bool { return !s[i].Timestamp.Before(cutoff) })
+		m.evicted.Age += uint64(drop)
+	}
+	if max := m.limits.MaxPointsPerGPU; max > 0 && len(s)-drop > max {
+		over := len(s) - drop - max
+		m.evicted.Capacity += uint64(over)
+		drop += over
+	}
+	if drop == 0 {
+		return
+	}
+	for _, t := range s[:drop] {
+		if t.IdempotencyKey != "" {
+			delete(m.keys, t.IdempotencyKey)
+		}
+	}
+	clear(s[:drop]) // release the dropped points' maps
+	if drop == len(s) {
+		delete(m.data, gpuID)
+		return
+	}
+	m.data[gpuID] = s[drop:]
+}
+
+// enforce evicts from the written GPUs, and from every GPU once per
+// memorySweepEvery when points expire; the caller must hold mu for writing.
+func (m *MemoryStore) enforce(written map[string]struct{}) {
+	if m.limits == (MemoryLimits{}) {
+		return
+	}
+	now := m.now()
+	if m.limits.MaxAge > 0 && now.Sub(m.swept) >= memorySweepEvery {
+		m.swept = now
+		for id := range m.data {
+			m.evict(id, now)
+		}
+		return
+	}
+	for id := range written {
+		m.evict(id, now)
+	}
 }
 
 func (m *MemoryStore) SaveTelemetry(t model.Telemetry) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	s := m.data[t.GPUId]
-	s = append(s, t)
-	// maintain order by timestamp (append then sort stable; small overhead acceptable for demo)
-	sort.SliceStable(s, func(i, j int) bool { return s[i].Timestamp.Before(s[j].Timestamp) })
-	m.data[t.GPUId] = s
+	if t.IdempotencyKey != "" {
+		if _, dup := m.keys[t.IdempotencyKey]; dup {
+			return nil
+		}
+		m.keys[t.IdempotencyKey] = struct{}{}
+	}
+	m.data[t.GPUId] = insertOrdered(m.data[t.GPUId], t)
+	m.enforce(map[string]struct{}{t.GPUId: {}})
+	return nil
+}
+
+// insertOrdered adds t to s, which is ordered by time, after any points with
+// the same timestamp. Points usually arrive in order, so that is an append.
+func insertOrdered(s []model.Telemetry, t model.Telemetry) []model.Telemetry {
+	i := len(s)
+	if i > 0 && t.Timestamp.Before(s[i-1].Timestamp) {
+		i = sort.Search(len(s), func(j int) bool { return s[j].Timestamp.After(t.Timestamp) })
+	}
+	s = append(s, model.Telemetry{})
+	copy(s[i+1:], s[i:])
+	s[i] = t
+	return s
+}
+
+// SaveTelemetryBatch stores items under one lock; it never fails. Series
+// that received points out of order are sorted once at the end.
+func (m *MemoryStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	unordered, written := map[string]struct{}{}, map[string]struct{}{}
+	for _, t := range items {
+		if t.IdempotencyKey != "" {
+			if _, dup := m.keys[t.IdempotencyKey]; dup {
+				continue
+			}
+			m.keys[t.IdempotencyKey] = struct{}{}
+		}
+		s := m.data[t.GPUId]
+		if n := len(s); n > 0 && t.Timestamp.Before(s[n-1].Timestamp) {
+			unordered[t.GPUId] = struct{}{}
+		}
+		m.data[t.GPUId] = append(s, t)
+		written[t.GPUId] = struct{}{}
+	}
+	for id := range unordered {
+		s := m.data[id]
+		sort.SliceStable(s, func(i, j int) bool { return s[i].Timestamp.Before(s[j].Timestamp) })
+	}
+	m.enforce(written)
 	return nil
 }
 
@@ -40,24 +178,199 @@ func (m *MemoryStore) ListGPUs() ([]string, error) {
 	return out, nil
 }
 
+// QueryTelemetry copies the stored window, found by binary search.
 func (m *MemoryStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	w := m.window(gpuID, start, end)
+	return append(make([]model.Telemetry, 0, len(w)), w...), nil
+}
+
+// window returns the stored points of gpuID within [start, end]; the caller
+// must hold mu.
+func (m *MemoryStore) window(gpuID string, start, end *time.Time) []model.Telemetry {
+	s := m.data[gpuID]
+	lo, hi := 0, len(s)
+	if start != nil {
+		lo = sort.Search(len(s), func(i int) bool { return !s[i].Timestamp.Before(*start) })
+	}
+	if end != nil {
+		hi = sort.Search(len(s), func(i int) bool { return s[i].Timestamp.After(*end) })
+	}
+	if lo >= hi {
+		return nil
+	}
+	return s[lo:hi]
+}
+
+// QueryTelemetryWith applies q to the stored window without copying the
+// points outside it. A query that only pages the window copies just the
+// page, so its cost does not grow with the history kept.
+func (m *MemoryStore) QueryTelemetryWith(gpuID string, q Query) ([]model.Telemetry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	w := m.window(gpuID, q.Start, q.End)
+	if q.Step > 0 || len(q.HostIDs) > 0 || len(q.ProducerIDs) > 0 || len(q.Labels) > 0 || q.Scope != nil || len(q.Metrics) > 0 {
+		return Apply(w, q), nil
+	}
+	return pageWindow(w, q.Desc, q.Offset, q.Limit), nil
+}
+
+// pageWindow is Page for a time-ordered window it must not change: it
+// copies the page alone.
+func pageWindow(w []model.Telemetry, desc bool, offset, limit int) []model.Telemetry {
+	if offset >= len(w) {
+		return nil
+	}
+	n := len(w) - offset
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	out := make([]model.Telemetry, n)
+	if !desc {
+		copy(out, w[offset:offset+n])
+		return out
+	}
+	for i := range out {
+		out[i] = w[len(w)-1-offset-i]
+	}
+	return out
+}
+
+// LatestTelemetry returns the last stored point of gpuID.
+func (m *MemoryStore) LatestTelemetry(gpuID string) (*model.Telemetry, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	s := m.data[gpuID]
-	if start == nil && end == nil {
-		out := make([]model.Telemetry, len(s))
-		copy(out, s)
-		return out, nil
-	}
-	var out []model.Telemetry
-	for _, it := range s {
-		if start != nil && it.Timestamp.Before(*start) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	last := s[len(s)-1]
+	return &last, nil
+}
+
+// QueryLatest looks at the tail of each series, walking back past points
+// outside sc.
+func (m *MemoryStore) QueryLatest(gpuIDs []string, sc *Scope) (map[string]*model.Telemetry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[string]*model.Telemetry, len(gpuIDs))
+	for _, id := range gpuIDs {
+		s := m.data[id]
+		for i := len(s) - 1; i >= 0; i-- {
+			if sc == nil || sc.Allows(s[i]) {
+				last := s[i]
+				out[id] = &last
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) SaveRule(id string, doc []byte) error { return m.saveDoc(&m.rules, id, doc) }
+
+func (m *MemoryStore) DeleteRule(id string) (bool, error) { return m.deleteDoc(&m.rules, id) }
+
+func (m *MemoryStore) ListRules() (map[string][]byte, error) { return m.listDocs(&m.rules) }
+
+func (m *MemoryStore) SaveWebhook(id string, doc []byte) error {
+	return m.saveDoc(&m.webhooks, id, doc)
+}
+
+func (m *MemoryStore) DeleteWebhook(id string) (bool, error) { return m.deleteDoc(&m.webhooks, id) }
+
+func (m *MemoryStore) ListWebhooks() (map[string][]byte, error) { return m.listDocs(&m.webhooks) }
+
+func (m *MemoryStore) SaveGPUInfo(gpuID string, doc []byte) error {
+	return m.saveDoc(&m.gpuInfo, gpuID, doc)
+}
+
+func (m *MemoryStore) ListGPUInfo() (map[string][]byte, error) { return m.listDocs(&m.gpuInfo) }
+
+// saveDoc, deleteDoc and listDocs work on one of the document maps, taken
+// by pointer so it is only read under the lock.
+func (m *MemoryStore) saveDoc(docs *map[string][]byte, id string, doc []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if *docs == nil {
+		*docs = map[string][]byte{}
+	}
+	(*docs)[id] = append([]byte(nil), doc...)
+	return nil
+}
+
+func (m *MemoryStore) deleteDoc(docs *map[string][]byte, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := (*docs)[id]
+	delete(*docs, id)
+	return ok, nil
+}
+
+func (m *MemoryStore) listDocs(docs *map[string][]byte) (map[string][]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[string][]byte, len(*docs))
+	for id, doc := range *docs {
+		out[id] = doc
+	}
+	return out, nil
+}
+
+// DeleteTelemetry drops matching points, a prefix of each series found by
+// binary search. Their idempotency keys are kept, so a redelivered point is
+// still not stored again.
+func (m *MemoryStore) DeleteTelemetry(gpuID string, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for id, items := range m.data {
+		if gpuID != "" && id != gpuID {
 			continue
 		}
-		if end != nil && it.Timestamp.After(*end) {
+		drop := len(items)
+		if !before.IsZero() {
+			drop = sort.Search(len(items), func(i int) bool { return !items[i].Timestamp.Before(before) })
+		}
+		n += int64(drop)
+		clear(items[:drop]) // release the dropped points' maps
+		if drop == len(items) {
+			delete(m.data, id)
+		} else {
+			m.data[id] = items[drop:]
+		}
+	}
+	return n, nil
+}
+
+// DeleteMetrics drops metrics from matching points, copying the metrics of
+// each point it changes so earlier query results are not altered.
+func (m *MemoryStore) DeleteMetrics(gpuID string, metrics []string, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for id, items := range m.data {
+		if gpuID != "" && id != gpuID {
 			continue
 		}
-		out = append(out, it)
+		keep := items[:0]
+		for _, t := range items {
+			if before.IsZero() || t.Timestamp.Before(before) {
+				var dropped int
+				t.Metrics, dropped = withoutMetrics(t.Metrics, metrics)
+				n += int64(dropped)
+				if dropped > 0 && len(t.Metrics) == 0 && len(t.Values) == 0 {
+					continue
+				}
+			}
+			keep = append(keep, t)
+		}
+		if len(keep) == 0 {
+			delete(m.data, id)
+		} else {
+			m.data[id] = keep
+		}
 	}
-	return out, nil
+	return n, nil
 }
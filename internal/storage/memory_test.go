@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -61,3 +63,241 @@ func TestMemoryStore_QueryWindow(t *testing.T) {
 		t.Fatalf("want 3 got %d", len(out))
 	}
 }
+
+func TestMemoryStore_IdempotencyKeyDedup(t *testing.T) {
+	st := NewMemoryStore()
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: now, IdempotencyKey: "p1-1"})
+	}
+	_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: now})
+	_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: now})
+	out, _ := st.QueryTelemetry("g1", nil, nil)
+	if len(out) != 3 {
+		t.Fatalf("want 1 keyed + 2 unkeyed rows, got %d", len(out))
+	}
+}
+
+func TestMemoryStore_SaveBatch(t *testing.T) {
+	st := NewMemoryStore()
+	base := time.Now()
+	err := st.SaveTelemetryBatch([]model.Telemetry{
+		{GPUId: "g1", Timestamp: base.Add(2 * time.Second), IdempotencyKey: "k1"},
+		{GPUId: "g1", Timestamp: base, IdempotencyKey: "k2"},
+		{GPUId: "g1", Timestamp: base, IdempotencyKey: "k1"},
+		{GPUId: "g2", Timestamp: base},
+	})
+	if err != nil {
+		t.Fatalf("save batch: %v", err)
+	}
+	out, _ := st.QueryTelemetry("g1", nil, nil)
+	if len(out) != 2 || !out[0].Timestamp.Equal(base) {
+		t.Fatalf("want 2 rows ordered by time, got %#v", out)
+	}
+}
+
+func TestSaveEach_ReportsFailedIndexes(t *testing.T) {
+	boom := errors.New("boom")
+	err := SaveEach(func(t model.Telemetry) error {
+		if t.GPUId == "bad" {
+			return boom
+		}
+		return nil
+	}, []model.Telemetry{{GPUId: "ok"}, {GPUId: "bad"}, {GPUId: "ok"}})
+	failed := FailedItems(err, 3)
+	if len(failed) != 1 || failed[1] != boom {
+		t.Fatalf("expected index 1 failed, got %v", err)
+	}
+	if all := FailedItems(boom, 3); len(all) != 3 {
+		t.Fatalf("a plain error fails the whole batch, got %v", all)
+	}
+	if FailedItems(nil, 3) != nil {
+		t.Fatal("nil error has no failures")
+	}
+}
+
+func TestMemoryStore_DownsampledMatchesGeneric(t *testing.T) {
+	s := NewMemoryStore()
+	t0 := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	var items []model.Telemetry
+	for i := 0; i < 10; i++ {
+		items = append(items, model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Duration(i*30) * time.Second), Metrics: map[string]float64{"temp": float64(i)}})
+	}
+	// a heartbeat without metrics does not create a bucket
+	items = append(items, model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Hour)})
+	_ = s.SaveTelemetryBatch(items)
+
+	end := t0.Add(4 * time.Minute)
+	out, err := s.QueryTelemetryWith("g1", Query{Start: &t0, End: &end, Step: 2 * time.Minute})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	// points 0..8 (t0..t0+4m): buckets [0,2m) -> 0..3, [2m,4m) -> 4..7, [4m,6m) -> 8
+	want := []float64{1.5, 5.5, 8}
+	if len(out) != len(want) {
+		t.Fatalf("buckets = %#v", out)
+	}
+	for i, w := range want {
+		if out[i].Metrics["temp"] != w || !out[i].Timestamp.Equal(t0.Add(time.Duration(i)*2*time.Minute)) {
+			t.Fatalf("bucket %d = %#v, want mean %v", i, out[i], w)
+		}
+	}
+	raw, _ := s.QueryTelemetry("g1", &t0, &end)
+	if generic := Downsample(raw, 2*time.Minute); len(generic) != len(out) || generic[2].Metrics["temp"] != 8 {
+		t.Fatalf("generic downsample differs: %#v", generic)
+	}
+}
+
+func TestMemoryStore_Scoped(t *testing.T) {
+	// generic paths: no ScopeLister or TopQuerier
+	st := NewMemoryStore()
+	scopeFixture(t, st)
+	checkScoped(t, st)
+}
+
+func TestMemoryStore_FiltersAttribution(t *testing.T) {
+	checkAttributionFilters(t, NewMemoryStore())
+}
+
+func TestMemoryStore_DeleteMetrics(t *testing.T) {
+	checkDeleteMetrics(t, NewMemoryStore())
+}
+
+func TestMemoryStore_TypedValues(t *testing.T) {
+	checkTypedValues(t, NewMemoryStore())
+}
+
+func TestMemoryStore_DeleteTelemetry(t *testing.T) {
+	// Scenario: two GPUs with points at t0 and t0+1m; delete g1 before t0+1m,
+	// then everything of g2
+	// Expect: counts 1 and 2; g1 keeps its newer point and g2 is gone
+	st := NewMemoryStore()
+	t0 := time.Now().UTC()
+	for _, id := range []string{"g1", "g2"} {
+		_ = st.SaveTelemetry(model.Telemetry{GPUId: id, Timestamp: t0, Metrics: map[string]float64{"a": 1}})
+		_ = st.SaveTelemetry(model.Telemetry{GPUId: id, Timestamp: t0.Add(time.Minute), Metrics: map[string]float64{"a": 2}})
+	}
+	if n, err := st.DeleteTelemetry("g1", t0.Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("delete g1: %d %v", n, err)
+	}
+	if n, err := st.DeleteTelemetry("g2", time.Time{}); err != nil || n != 2 {
+		t.Fatalf("delete g2: %d %v", n, err)
+	}
+	ids, _ := st.ListGPUs()
+	out, _ := st.QueryTelemetry("g1", nil, nil)
+	if len(ids) != 1 || len(out) != 1 || out[0].Metrics["a"] != 2 {
+		t.Fatalf("left: %v %v", ids, out)
+	}
+}
+
+func TestMemoryStore_BoundedEviction(t *testing.T) {
+	// Scenario: a store capped at 3 points per GPU and 10 minutes of age gets
+	// 5 points of g1 (one batch, one out of order), then time moves on while
+	// only g2 is written
+	// Expect: g1 keeps its newest 3 points, the evicted keys can be stored
+	// again; a sweep later expires g1 entirely and counts it by age
+	now := time.Unix(1700000000, 0).UTC()
+	st := NewBoundedMemoryStore(MemoryLimits{MaxPointsPerGPU: 3, MaxAge: 10 * time.Minute})
+	st.now = func() time.Time { return now }
+	var batch []model.Telemetry
+	for _, i := range []int{0, 1, 2, 4, 3} {
+		batch = append(batch, model.Telemetry{GPUId: "g1", Timestamp: now.Add(time.Duration(i-5) * time.Second), IdempotencyKey: fmt.Sprint("k", i), Metrics: map[string]float64{"m": float64(i)}})
+	}
+	_ = st.SaveTelemetryBatch(batch)
+	out, _ := st.QueryTelemetry("g1", nil, nil)
+	if len(out) != 3 || out[0].Metrics["m"] != 2 || out[2].Metrics["m"] != 4 {
+		t.Fatalf("want points 2-4, got %v", out)
+	}
+	if ev := st.Evictions(); ev.Capacity != 2 || ev.Age != 0 {
+		t.Fatalf("evictions: %+v", ev)
+	}
+	// k0 was evicted, so it is stored again, and evicted again as the oldest
+	_ = st.SaveTelemetry(batch[0])
+	if ev := st.Evictions(); ev.Capacity != 3 {
+		t.Fatalf("re-saved evicted key not stored: %+v", ev)
+	}
+
+	now = now.Add(time.Hour)
+	_ = st.SaveTelemetry(model.Telemetry{GPUId: "g2", Timestamp: now, Metrics: map[string]float64{"m": 1}})
+	if ids, _ := st.ListGPUs(); len(ids) != 1 || ids[0] != "g2" {
+		t.Fatalf("g1 not expired: %v", ids)
+	}
+	if ev := st.Evictions(); ev.Age != 3 {
+		t.Fatalf("evictions by age: %+v", ev)
+	}
+}
+
+func TestMemoryStore_PagesWindowInPlace(t *testing.T) {
+	// Scenario: ten points paged ascending and descending, past the end,
+	// then a result changed by the caller
+	// Expect: the pages of the generic Page; the store is not changed
+	st := NewMemoryStore()
+	t0 := time.Unix(1700000000, 0).UTC()
+	var all []model.Telemetry
+	for i := 0; i < 10; i++ {
+		p := model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Duration(i) * time.Second), Metrics: map[string]float64{"m": float64(i)}}
+		all = append(all, p)
+		_ = st.SaveTelemetry(p)
+	}
+	start, end := t0.Add(2*time.Second), t0.Add(8*time.Second)
+	for _, q := range []Query{
+		{Start: &start, End: &end, Offset: 1, Limit: 3},
+		{Start: &start, End: &end, Desc: true, Offset: 2, Limit: 2},
+		{Desc: true, Limit: 1},
+		{Offset: 20},
+	} {
+		got, _ := st.QueryTelemetryWith("g1", q)
+		window := all
+		if q.Start != nil {
+			window = all[2:9]
+		}
+		want := Apply(window, q)
+		if len(got) != len(want) {
+			t.Fatalf("%+v: %d points, want %d", q, len(got), len(want))
+		}
+		for i := range got {
+			if !got[i].Timestamp.Equal(want[i].Timestamp) {
+				t.Fatalf("%+v: point %d at %v, want %v", q, i, got[i].Timestamp, want[i].Timestamp)
+			}
+		}
+		if len(got) > 0 {
+			got[0] = model.Telemetry{}
+		}
+	}
+	if out, _ := st.QueryTelemetry("g1", nil, nil); len(out) != 10 || out[9].Metrics["m"] != 9 {
+		t.Fatalf("store changed: %+v", out)
+	}
+}
+
+// benchmarkMemoryWindow queries the same 100-point window of a series
+// holding history points, so the cost should not grow with history.
+func benchmarkMemoryWindow(b *testing.B, history int, q Query) {
+	st := NewMemoryStore()
+	t0 := time.Unix(1700000000, 0).UTC()
+	items := make([]model.Telemetry, history)
+	for i := range items {
+		items[i] = model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Duration(i) * time.Second), Metrics: map[string]float64{"m": 1}}
+	}
+	_ = st.SaveTelemetryBatch(items)
+	start := t0.Add(time.Duration(history/2) * time.Second)
+	end := start.Add(99 * time.Second)
+	q.Start, q.End = &start, &end
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if out, _ := st.QueryTelemetryWith("g1", q); len(out) == 0 {
+			b.Fatal("empty window")
+		}
+	}
+}
+
+func BenchmarkMemoryStore_Window(b *testing.B) {
+	for _, history := range []int{1_000, 100_000, 1_000_000} {
+		b.Run(fmt.Sprint(history), func(b *testing.B) { benchmarkMemoryWindow(b, history, Query{}) })
+	}
+}
+
+func BenchmarkMemoryStore_WindowLatestFirst(b *testing.B) {
+	for _, history := range []int{1_000, 100_000, 1_000_000} {
+		b.Run(fmt.Sprint(history), func(b *testing.B) { benchmarkMemoryWindow(b, history, Query{Desc: true, Limit: 10}) })
+	}
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Options configures Open beyond what its URI says.
+type Options struct {
+	// Measurement is the series a store reads and writes, "telemetry" when
+	// empty. File stores keep any other measurement in a file of their own,
+	// path + "." + measurement; a memory store is always new and empty.
+	Measurement string
+	// Memory bounds a mem:// store.
+	Memory MemoryLimits
+	// InfluxAsync, when set, opens an influx store with non-blocking writes;
+	// see NewInfluxStoreAsync.
+	InfluxAsync *InfluxAsync
+}
+
+// Open opens the store uri names, so a service selects its backend with one
+// setting:
+//
+//	mem://
+//	influx://host:8086?org=o&bucket=b&token=t   (influxs:// for HTTPS)
+//	victoria://host:8428                         (victorias:// for HTTPS)
+//	sqlite://telemetry.db, sqlite:///var/lib/gpu/telemetry.db  (?schema=normalized for one row per metric, ?upsert=true to overwrite redelivered points)
+//	bolt://telemetry.db, bolt:///var/lib/gpu/telemetry.db
+//
+// A path after the host of influx and victoria is kept, e.g. behind a proxy.
+func Open(uri string, opts Options) (Store, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("store uri: %w", err)
+	}
+	measurement := opts.Measurement
+	if measurement == "" {
+		measurement = "telemetry"
+	}
+	file := func() (string, error) {
+		p := u.Host + u.Path
+		if p == "" {
+			return "", fmt.Errorf("store uri %s: missing file path", RedactURI(uri))
+		}
+		if measurement != "telemetry" {
+			p += "." + measurement
+		}
+		return p, nil
+	}
+	switch u.Scheme {
+	case "mem", "memory":
+		return NewBoundedMemoryStore(opts.Memory), nil
+	case "influx", "influxs":
+		q := u.Query()
+		server := httpURL(u, "influx")
+		if opts.InfluxAsync != nil {
+			return NewInfluxStoreAsync(server, q.Get("org"), q.Get("bucket"), q.Get("token"), measurement, *opts.InfluxAsync)
+		}
+		return NewInfluxStoreMeasurement(server, q.Get("org"), q.Get("bucket"), q.Get("token"), measurement)
+	case "victoria", "victorias":
+		return NewVictoriaStore(httpURL(u, "victoria"), measurement)
+	case "sqlite":
+		p, err := file()
+		if err != nil {
+			return nil, err
+		}
+		var so SQLiteOptions
+		switch schema := u.Query().Get("schema"); schema {
+		case "", "json":
+		case "normalized":
+			so.Schema = SQLiteNormalized
+		default:
+			return nil, fmt.Errorf("store uri %s: unknown sqlite schema %q (want json or normalized)", RedactURI(uri), schema)
+		}
+		if v := u.Query().Get("upsert"); v != "" {
+			if so.Upsert, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("store uri %s: upsert: %w", RedactURI(uri), err)
+			}
+		}
+		return NewSQLiteStoreWith(p, so)
+	case "bolt":
+		p, err := file()
+		if err != nil {
+			return nil, err
+		}
+		return NewBoltStore(p)
+	}
+	return nil, fmt.Errorf("store uri %s: unknown scheme %q (want mem, influx, victoria, sqlite or bolt)", RedactURI(uri), u.Scheme)
+}
+
+// httpURL returns the server URL of an influx or victoria URI: http, or
+// https for the scheme ending in s, without the query.
+func httpURL(u *url.URL, plain string) string {
+	scheme := "http"
+	if u.Scheme != plain {
+		scheme = "https"
+	}
+	return (&url.URL{Scheme: scheme, Host: u.Host, Path: u.Path}).String()
+}
+
+// BackendURI returns the URI of the influx or victoria server at serverURL,
+// e.g. http://localhost:8086, with params (org, bucket, token) as its query.
+func BackendURI(scheme, serverURL string, params url.Values) (string, error) {
+	u, err := url.Parse(strings.TrimRight(serverURL, "/"))
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = scheme
+	case "https":
+		u.Scheme = scheme + "s"
+	default:
+		return "", fmt.Errorf("%s url %s: want http or https", scheme, serverURL)
+	}
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
+// RedactURI returns uri with its token and password hidden, for logs.
+func RedactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "<invalid uri>"
+	}
+	if q := u.Query(); q.Has("token") {
+		q.Set("token", "xxxxx")
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+func TestOpen_Schemes(t *testing.T) {
+	// Scenario: a URI of each scheme, measurements on file stores, and bad URIs
+	// Expect: the matching backend, http(s) server URLs without the query,
+	// measurement files next to the main one, errors naming the problem
+	if s, err := Open("mem://", Options{Memory: MemoryLimits{MaxPointsPerGPU: 2}}); err != nil || s.(*MemoryStore).limits.MaxPointsPerGPU != 2 {
+		t.Fatalf("mem: %v %T", err, s)
+	}
+	for uri, want := range map[string]string{
+		"victoria://vm:8428":         "http://vm:8428",
+		"victorias://vm:8428/select": "https://vm:8428/select",
+	} {
+		s, err := Open(uri, Options{Measurement: "rollup"})
+		if err != nil || s.(*VictoriaStore).url != want || s.(*VictoriaStore).measurement != "rollup" {
+			t.Fatalf("%s: %v %+v", uri, err, s)
+		}
+	}
+	s, err := Open("influxs://influx:8086?org=o&bucket=b&token=t", Options{})
+	if is, ok := s.(*InfluxStore); err != nil || !ok || is.org != "o" || is.bucket != "b" || is.measurement != "telemetry" {
+		t.Fatalf("influx: %v %+v", err, s)
+	}
+	if _, err := Open("influx://influx:8086?org=o", Options{}); err == nil {
+		t.Fatal("expected an error for an influx uri without bucket and token")
+	}
+
+	dir := t.TempDir()
+	for _, scheme := range []string{"sqlite", "bolt"} {
+		path := filepath.Join(dir, scheme+".db")
+		for _, m := range []string{"", "events"} {
+			s, err := Open(scheme+"://"+path, Options{Measurement: m})
+			if err != nil {
+				t.Fatalf("%s %q: %v", scheme, m, err)
+			}
+			if err := s.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: time.Now(), Metrics: map[string]float64{"temp": 1}}); err != nil {
+				t.Fatalf("%s save: %v", scheme, err)
+			}
+			if c, ok := s.(interface{ Close() error }); ok {
+				_ = c.Close()
+			}
+		}
+		for _, f := range []string{path, path + ".events"} {
+			if _, err := os.Stat(f); err != nil {
+				t.Fatalf("%s: %v", scheme, err)
+			}
+		}
+	}
+	if s, err := Open("sqlite://"+filepath.Join(dir, "norm.db")+"?schema=normalized", Options{}); err != nil || !s.(*SQLiteStore).normalized {
+		t.Fatalf("normalized sqlite: %v", err)
+	}
+	if s, err := Open("sqlite://"+filepath.Join(dir, "upsert.db")+"?upsert=true", Options{}); err != nil || !s.(*SQLiteStore).upsert {
+		t.Fatalf("upsert sqlite: %v", err)
+	}
+	for _, uri := range []string{"postgres://db", "bolt://", "::", "sqlite://x.db?schema=wide", "sqlite://x.db?upsert=maybe"} {
+		if _, err := Open(uri, Options{}); err == nil {
+			t.Fatalf("%s: expected an error", uri)
+		}
+	}
+}
+
+func TestBackendURI_RoundTripsAndRedacts(t *testing.T) {
+	uri, err := BackendURI("influx", "https://influx:8086/", url.Values{"org": {"o"}, "bucket": {"b"}, "token": {"secret"}})
+	if err != nil || uri != "influxs://influx:8086?bucket=b&org=o&token=secret" {
+		t.Fatalf("uri: %v %s", err, uri)
+	}
+	if r := RedactURI(uri); strings.Contains(r, "secret") || !strings.Contains(r, "org=o") {
+		t.Fatalf("redacted: %s", r)
+	}
+	if _, err := BackendURI("victoria", "vm:8428", nil); err == nil {
+		t.Fatal("expected an error for a url without http(s)")
+	}
+}
@@ -0,0 +1,348 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// Query shapes a telemetry query beyond its time window. The zero value
+// returns every raw point in time order, like QueryTelemetry.
+type Query struct {
+	// Start and End bound the window, both inclusive.
+	Start, End *time.Time
+	// HostIDs keeps only points reported from these hosts. Empty keeps all.
+	HostIDs []string
+	// ProducerIDs keeps only points from these producers. Empty keeps all.
+	ProducerIDs []string
+	// Labels keeps only points carrying every one of these label values.
+	Labels map[string]string
+	// Scope, if set, keeps only the points it allows (see Scoped).
+	Scope *Scope
+	// Metrics keeps only the named metrics; points with none of them are
+	// left out. Empty keeps all.
+	Metrics []string
+	// Step, if positive, returns one point per step-wide bucket that has data,
+	// timestamped at the bucket start (aligned to the Unix epoch), with the
+	// mean of each metric over the bucket. Host, producer and labels are not
+	// carried over since a bucket may mix them.
+	Step time.Duration
+	// Desc orders newest first. Offset items are skipped, then at most Limit
+	// (0 = all) are returned.
+	Desc   bool
+	Offset int
+	Limit  int
+}
+
+// Querier is implemented by stores that can filter, downsample and page a
+// query in the backend instead of returning the whole raw window.
+type Querier interface {
+	QueryTelemetryWith(gpuID string, q Query) ([]model.Telemetry, error)
+}
+
+// Execute runs q through s's Querier if it has one, and otherwise applies it
+// to the raw query result.
+func Execute(s Store, gpuID string, q Query) ([]model.Telemetry, error) {
+	if qr, ok := s.(Querier); ok {
+		return qr.QueryTelemetryWith(gpuID, q)
+	}
+	items, err := s.QueryTelemetry(gpuID, q.Start, q.End)
+	if err != nil {
+		return nil, err
+	}
+	return Apply(items, q), nil
+}
+
+// LatestQuerier is implemented by stores that can find a GPU's most recent
+// point more cheaply than a descending query.
+type LatestQuerier interface {
+	// LatestTelemetry returns nil when gpuID has no points.
+	LatestTelemetry(gpuID string) (*model.Telemetry, error)
+}
+
+// Latest returns gpuID's most recent point, or nil if it has none.
+func Latest(s Store, gpuID string) (*model.Telemetry, error) {
+	if lq, ok := s.(LatestQuerier); ok {
+		return lq.LatestTelemetry(gpuID)
+	}
+	items, err := Execute(s, gpuID, Query{Desc: true, Limit: 1})
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// latestWorkers bounds the concurrent lookups of LatestMany's fallback.
+const latestWorkers = 8
+
+// LatestManyQuerier is implemented by stores that can find the most recent
+// point of many GPUs in one query.
+type LatestManyQuerier interface {
+	// QueryLatest considers only points sc allows, when sc is set.
+	QueryLatest(gpuIDs []string, sc *Scope) (map[string]*model.Telemetry, error)
+}
+
+// LatestMany returns the most recent point of each of gpuIDs, within sc when
+// it is set. GPUs without points are absent from the map. Stores without a
+// LatestManyQuerier are asked once per GPU, latestWorkers at a time; the
+// first error is returned along with whatever was found.
+func LatestMany(s Store, gpuIDs []string, sc *Scope) (map[string]*model.Telemetry, error) {
+	if lq, ok := s.(LatestManyQuerier); ok {
+		return lq.QueryLatest(gpuIDs, sc)
+	}
+	if sc != nil {
+		s = Scoped(s, *sc)
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		out      = make(map[string]*model.Telemetry, len(gpuIDs))
+	)
+	next := make(chan string)
+	for i := 0; i < latestWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range next {
+				it, err := Latest(s, id)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if it != nil {
+					out[id] = it
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, id := range gpuIDs {
+		next <- id
+	}
+	close(next)
+	wg.Wait()
+	return out, firstErr
+}
+
+// FleetQuerier is implemented by stores that can run one query across many
+// GPUs; see ExecuteFleet.
+type FleetQuerier interface {
+	QueryFleet(gpuIDs []string, q Query) ([]model.Telemetry, error)
+}
+
+// ExecuteFleet runs q over gpuIDs (every GPU when empty) and returns the
+// points ordered by time, then GPU. Downsampling is per GPU; Offset and Limit
+// apply to the combined result. Stores without a FleetQuerier are queried
+// once per GPU.
+func ExecuteFleet(s Store, gpuIDs []string, q Query) ([]model.Telemetry, error) {
+	if fq, ok := s.(FleetQuerier); ok {
+		return fq.QueryFleet(gpuIDs, q)
+	}
+	if len(gpuIDs) == 0 {
+		var err error
+		if gpuIDs, err = s.ListGPUs(); err != nil {
+			return nil, err
+		}
+	}
+	per := q
+	per.Offset, per.Limit = 0, 0
+	if q.Limit > 0 {
+		// no GPU can contribute more than this to the page
+		per.Limit = q.Offset + q.Limit
+	}
+	var all []model.Telemetry
+	for _, id := range gpuIDs {
+		items, err := Execute(s, id, per)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if !all[i].Timestamp.Equal(all[j].Timestamp) {
+			return all[i].Timestamp.Before(all[j].Timestamp)
+		}
+		return all[i].GPUId < all[j].GPUId
+	})
+	return Page(all, q.Desc, q.Offset, q.Limit), nil
+}
+
+// Apply filters, downsamples and pages items that are already within q's
+// window. items is not modified.
+func Apply(items []model.Telemetry, q Query) []model.Telemetry {
+	out := FilterHosts(items, q.HostIDs)
+	out = FilterProducers(out, q.ProducerIDs)
+	out = FilterLabels(out, q.Labels)
+	out = FilterScope(out, q.Scope)
+	out = FilterMetrics(out, q.Metrics)
+	if q.Step > 0 {
+		out = Downsample(out, q.Step)
+	} else {
+		out = append([]model.Telemetry(nil), out...)
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+	}
+	return Page(out, q.Desc, q.Offset, q.Limit)
+}
+
+// FilterHosts returns the items reported from one of hosts; empty hosts
+// returns items unchanged.
+func FilterHosts(items []model.Telemetry, hosts []string) []model.Telemetry {
+	if len(hosts) == 0 {
+		return items
+	}
+	var out []model.Telemetry
+	for _, it := range items {
+		for _, h := range hosts {
+			if it.HostId == h {
+				out = append(out, it)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// FilterProducers returns the items from one of producers; empty producers
+// returns items unchanged.
+func FilterProducers(items []model.Telemetry, producers []string) []model.Telemetry {
+	if len(producers) == 0 {
+		return items
+	}
+	var out []model.Telemetry
+	for _, it := range items {
+		for _, p := range producers {
+			if it.ProducerId == p {
+				out = append(out, it)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// FilterLabels returns the items carrying every label of labels with its
+// value; empty labels returns items unchanged.
+func FilterLabels(items []model.Telemetry, labels map[string]string) []model.Telemetry {
+	if len(labels) == 0 {
+		return items
+	}
+	var out []model.Telemetry
+next:
+	for _, it := range items {
+		for k, v := range labels {
+			if got, ok := it.Labels[k]; !ok || got != v {
+				continue next
+			}
+		}
+		out = append(out, it)
+	}
+	return out
+}
+
+// FilterMetrics returns items with only the named metrics and typed
+// values, dropping items that have none of them; empty names returns items
+// unchanged.
+func FilterMetrics(items []model.Telemetry, names []string) []model.Telemetry {
+	if len(names) == 0 {
+		return items
+	}
+	var out []model.Telemetry
+	for _, it := range items {
+		m := make(map[string]float64, len(names))
+		for _, n := range names {
+			if v, ok := it.Metrics[n]; ok {
+				m[n] = v
+			}
+		}
+		it.Metrics = m
+		it.Values = keepValues(it.Values, names)
+		if len(m) == 0 && len(it.Values) == 0 {
+			continue
+		}
+		out = append(out, it)
+	}
+	return out
+}
+
+// keepValues returns the values of the named keys, nil if there are none.
+func keepValues(values map[string]model.Value, names []string) map[string]model.Value {
+	var out map[string]model.Value
+	for _, n := range names {
+		if v, ok := values[n]; ok {
+			if out == nil {
+				out = make(map[string]model.Value, len(names))
+			}
+			out[n] = v
+		}
+	}
+	return out
+}
+
+// Page takes the requested slice of time-ordered items, reversing them first
+// for desc. It may reorder items in place.
+func Page(items []model.Telemetry, desc bool, offset, limit int) []model.Telemetry {
+	if desc {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// BucketStart truncates t to a multiple of step since the Unix epoch.
+func BucketStart(t time.Time, step time.Duration) time.Time {
+	ns := t.UnixNano()
+	off := ns % int64(step)
+	if off < 0 {
+		off += int64(step)
+	}
+	return time.Unix(0, ns-off).UTC()
+}
+
+// Downsample averages items (all for one GPU) into step-wide buckets, as
+// described on Query.Step. The result is ordered by time.
+func Downsample(items []model.Telemetry, step time.Duration) []model.Telemetry {
+	if len(items) == 0 || step <= 0 {
+		return items
+	}
+	type acc struct {
+		sum map[string]float64
+		n   map[string]int
+	}
+	buckets := map[time.Time]*acc{}
+	for _, it := range items {
+		if len(it.Metrics) == 0 {
+			continue
+		}
+		b := BucketStart(it.Timestamp, step)
+		a := buckets[b]
+		if a == nil {
+			a = &acc{sum: map[string]float64{}, n: map[string]int{}}
+			buckets[b] = a
+		}
+		for k, v := range it.Metrics {
+			a.sum[k] += v
+			a.n[k]++
+		}
+	}
+	out := make([]model.Telemetry, 0, len(buckets))
+	for b, a := range buckets {
+		m := make(map[string]float64, len(a.sum))
+		for k, s := range a.sum {
+			m[k] = s / float64(a.n[k])
+		}
+		out = append(out, model.Telemetry{GPUId: items[0].GPUId, Timestamp: b, Metrics: m})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+	return out
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisLatestTimeout bounds each round trip of RedisLatest; a slow index
+// must not hold up the flush or the read it serves.
+const redisLatestTimeout = 500 * time.Millisecond
+
+// redisPutNewer sets the hash KEYS[1] to ts ARGV[1] and doc ARGV[2] unless it
+// holds a newer ts. Timestamps are zero-padded so strings compare as numbers.
+var redisPutNewer = redis.NewScript(`
+local cur = redis.call('HGET', KEYS[1], 'ts')
+if cur and cur >= ARGV[1] then return 0 end
+redis.call('HSET', KEYS[1], 'ts', ARGV[1], 'doc', ARGV[2])
+return 1`)
+
+// redisForgetOlder deletes KEYS[1] if its ts is below ARGV[1], or at once
+// when ARGV[1] is empty.
+var redisForgetOlder = redis.NewScript(`
+local cur = redis.call('HGET', KEYS[1], 'ts')
+if cur and (ARGV[1] == '' or cur < ARGV[1]) then redis.call('DEL', KEYS[1]) return 1 end
+return 0`)
+
+// RedisLatest is a LatestIndex in a Redis server: one hash per GPU at
+// prefix+"latest:"+gpuID holding the point as JSON. Every collector and
+// gateway using the same server and prefix shares it.
+type RedisLatest struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisLatest connects to url (redis://[user:password@]host:port[/db])
+// and checks the server answers.
+func NewRedisLatest(url, prefix string) (*RedisLatest, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("redis url: %w", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("redis ping: %w", err)
+	}
+	return &RedisLatest{client: client, prefix: prefix}, nil
+}
+
+func (r *RedisLatest) key(gpuID string) string { return r.prefix + "latest:" + gpuID }
+
+// redisTS formats t as a fixed-width count of nanoseconds.
+func redisTS(t time.Time) string {
+	ns := t.UnixNano()
+	if ns < 0 {
+		ns = 0
+	}
+	return fmt.Sprintf("%020d", ns)
+}
+
+func (r *RedisLatest) Put(ctx context.Context, items []model.Telemetry) error {
+	if len(items) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, redisLatestTimeout)
+	defer cancel()
+	keys := make([]string, len(items))
+	args := make([][]any, len(items))
+	for i, t := range items {
+		doc, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		keys[i], args[i] = r.key(t.GPUId), []any{redisTS(t.Timestamp), doc}
+	}
+	run := func(eval func(redis.Pipeliner, []string, ...any) *redis.Cmd) error {
+		_, err := r.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+			for i := range keys {
+				eval(p, []string{keys[i]}, args[i]...)
+			}
+			return nil
+		})
+		return err
+	}
+	err := run(func(p redis.Pipeliner, k []string, a ...any) *redis.Cmd {
+		return redisPutNewer.EvalSha(ctx, p, k, a...)
+	})
+	if err != nil && redis.HasErrorPrefix(err, "NOSCRIPT") {
+		// first use on this server: send the script itself
+		err = run(func(p redis.Pipeliner, k []string, a ...any) *redis.Cmd { return redisPutNewer.Eval(ctx, p, k, a...) })
+	}
+	if err != nil {
+		return fmt.Errorf("redis put latest: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisLatest) Get(ctx context.Context, gpuIDs []string) (map[string]*model.Telemetry, error) {
+	out := make(map[string]*model.Telemetry, len(gpuIDs))
+	if len(gpuIDs) == 0 {
+		return out, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, redisLatestTimeout)
+	defer cancel()
+	cmds := make([]*redis.StringCmd, len(gpuIDs))
+	_, err := r.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, id := range gpuIDs {
+			cmds[i] = p.HGet(ctx, r.key(id), "doc")
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("redis get latest: %w", err)
+	}
+	for i, id := range gpuIDs {
+		b, err := cmds[i].Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("redis get latest: %w", err)
+		}
+		var t model.Telemetry
+		if err := json.Unmarshal(b, &t); err != nil {
+			return nil, fmt.Errorf("redis latest %s: %w", id, err)
+		}
+		out[id] = &t
+	}
+	return out, nil
+}
+
+func (r *RedisLatest) Forget(ctx context.Context, gpuID string, before time.Time) error {
+	bound := ""
+	if !before.IsZero() {
+		bound = redisTS(before)
+	}
+	forget := func(key string) error {
+		ctx, cancel := context.WithTimeout(ctx, redisLatestTimeout)
+		defer cancel()
+		if err := redisForgetOlder.Run(ctx, r.client, []string{key}, bound).Err(); err != nil {
+			return fmt.Errorf("redis forget latest: %w", err)
+		}
+		return nil
+	}
+	if gpuID != "" {
+		return forget(r.key(gpuID))
+	}
+	it := r.client.Scan(ctx, 0, r.key("*"), 1000).Iterator()
+	for it.Next(ctx) {
+		if err := forget(it.Val()); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("redis forget latest: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection pool.
+func (r *RedisLatest) Close() error { return r.client.Close() }
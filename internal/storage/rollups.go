@@ -0,0 +1,452 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// RollupCountPrefix marks the metric holding how many raw values a rollup
+// point's metric of the same name averages, e.g. "_n_temp" for "temp".
+const RollupCountPrefix = "_n_"
+
+// rollupChunk is how many tier buckets of raw points one refresh step reads.
+const rollupChunk = 1000
+
+// RollupTier is one rollup of the raw telemetry: per GPU and Step-wide
+// bucket, the mean of each metric and its count, kept in Store.
+type RollupTier struct {
+	Step  time.Duration
+	Store Store
+}
+
+// RollupConfig tunes a RollupStore. Zero fields use the defaults.
+type RollupConfig struct {
+	// Backfill is how far back a tier that holds no points of a GPU is first
+	// rolled up from (default 24h).
+	Backfill time.Duration
+	// Delay is how long after a bucket ends it is rolled up, so that points
+	// arriving late are counted (default 1m).
+	Delay time.Duration
+}
+
+// RollupStore maintains rollup tiers of a raw store and answers downsampled
+// queries from the coarsest tier whose step divides the query's. Refresh
+// rolls up the buckets closed since the last refresh; a query is answered
+// from a tier only for the whole buckets the tier covers, and from raw
+// before and after them. Queries filtered by host, producer, labels or scope
+// always read raw, since rollups do not keep attribution. Writes, deletes
+// and every other read go to raw.
+type RollupStore struct {
+	raw   Store
+	tiers []RollupTier // by step, descending
+	cfg   RollupConfig
+	now   func() time.Time
+	state *rollupState // shared with the views from WithContext
+}
+
+type rollupState struct {
+	mu       sync.Mutex
+	coverage map[time.Duration]map[string]*rollupSpan // tier step -> gpu -> span
+}
+
+// rollupSpan is the range of buckets a tier holds for a GPU: from From up
+// to Done, exclusive.
+type rollupSpan struct {
+	From, Done time.Time
+}
+
+// NewRollupStore returns a RollupStore over raw. It holds no rollups until
+// Refresh runs; call it periodically.
+func NewRollupStore(raw Store, tiers []RollupTier, cfg RollupConfig) *RollupStore {
+	if cfg.Backfill <= 0 {
+		cfg.Backfill = 24 * time.Hour
+	}
+	if cfg.Delay <= 0 {
+		cfg.Delay = time.Minute
+	}
+	ts := append([]RollupTier(nil), tiers...)
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Step > ts[j].Step })
+	cov := make(map[time.Duration]map[string]*rollupSpan, len(ts))
+	for _, t := range ts {
+		cov[t.Step] = map[string]*rollupSpan{}
+	}
+	return &RollupStore{raw: raw, tiers: ts, cfg: cfg, now: time.Now, state: &rollupState{coverage: cov}}
+}
+
+// Refresh rolls up, for every GPU of raw, each tier's buckets that ended at
+// least Delay ago and are not rolled up yet. The first refresh of a GPU
+// resumes after the tier's newest point, or starts Backfill ago when the
+// tier has none.
+func (s *RollupStore) Refresh(ctx context.Context) error {
+	raw := WithContext(ctx, s.raw)
+	ids, err := raw.ListGPUs()
+	if err != nil {
+		return fmt.Errorf("list gpus: %w", err)
+	}
+	now := s.now()
+	for _, tier := range s.tiers {
+		store := WithContext(ctx, tier.Store)
+		end := BucketStart(now.Add(-s.cfg.Delay), tier.Step)
+		for _, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			span, err := s.span(store, tier.Step, id, now)
+			if err != nil {
+				return fmt.Errorf("rollup %s of %s: %w", tier.Step, id, err)
+			}
+			for from := span.Done; from.Before(end); {
+				to := from.Add(rollupChunk * tier.Step)
+				if to.After(end) {
+					to = end
+				}
+				if err := s.rollUp(raw, store, tier.Step, id, from, to); err != nil {
+					return fmt.Errorf("rollup %s of %s: %w", tier.Step, id, err)
+				}
+				s.state.mu.Lock()
+				span.Done = to
+				s.state.mu.Unlock()
+				from = to
+			}
+		}
+	}
+	return nil
+}
+
+// span returns the GPU's span in the tier, reading it from the tier store
+// the first time.
+func (s *RollupStore) span(tier Store, step time.Duration, gpuID string, now time.Time) (*rollupSpan, error) {
+	s.state.mu.Lock()
+	span := s.state.coverage[step][gpuID]
+	s.state.mu.Unlock()
+	if span != nil {
+		return span, nil
+	}
+	start := BucketStart(now.Add(-s.cfg.Backfill), step)
+	span = &rollupSpan{From: start, Done: start}
+	first, err := Execute(tier, gpuID, Query{Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	last, err := Latest(tier, gpuID)
+	if err != nil {
+		return nil, err
+	}
+	if len(first) > 0 && last != nil {
+		span.From, span.Done = first[0].Timestamp, last.Timestamp.Add(step)
+	}
+	s.state.mu.Lock()
+	s.state.coverage[step][gpuID] = span
+	s.state.mu.Unlock()
+	return span, nil
+}
+
+// rollUp writes the rollup points of the GPU's raw points in [from, to).
+// Each point has an idempotency key, so rewriting a bucket is harmless.
+func (s *RollupStore) rollUp(raw, tier Store, step time.Duration, gpuID string, from, to time.Time) error {
+	end := to.Add(-time.Nanosecond)
+	items, err := Execute(raw, gpuID, Query{Start: &from, End: &end})
+	if err != nil {
+		return err
+	}
+	points := rollupPoints(items, step)
+	if len(points) == 0 {
+		return nil
+	}
+	for i := range points {
+		points[i].GPUId = gpuID
+		points[i].IdempotencyKey = fmt.Sprintf("rollup:%s:%s:%d", step, gpuID, points[i].Timestamp.UnixNano())
+	}
+	return tier.SaveTelemetryBatch(points)
+}
+
+// rollupPoints buckets items by step into rollup points: each metric's
+// mean, and its count under RollupCountPrefix. Items that are rollup points
+// themselves are weighted by their counts, so a coarser step can be built
+// from a finer tier.
+func rollupPoints(items []model.Telemetry, step time.Duration) []model.Telemetry {
+	type acc struct {
+		sum map[string]float64
+		n   map[string]float64
+	}
+	buckets := map[time.Time]*acc{}
+	for _, it := range items {
+		b := BucketStart(it.Timestamp, step)
+		a := buckets[b]
+		for k, v := range it.Metrics {
+			if strings.HasPrefix(k, RollupCountPrefix) {
+				continue
+			}
+			if a == nil {
+				a = &acc{sum: map[string]float64{}, n: map[string]float64{}}
+				buckets[b] = a
+			}
+			n, ok := it.Metrics[RollupCountPrefix+k]
+			if !ok {
+				n = 1
+			}
+			a.sum[k] += v * n
+			a.n[k] += n
+		}
+	}
+	out := make([]model.Telemetry, 0, len(buckets))
+	for b, a := range buckets {
+		m := make(map[string]float64, 2*len(a.sum))
+		for k, sum := range a.sum {
+			m[k] = sum / a.n[k]
+			m[RollupCountPrefix+k] = a.n[k]
+		}
+		out = append(out, model.Telemetry{Timestamp: b, Metrics: m})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+	return out
+}
+
+// routable reports whether q may be answered from a tier at all.
+func routable(q Query) bool {
+	return q.Step > 0 && len(q.HostIDs) == 0 && len(q.ProducerIDs) == 0 && len(q.Labels) == 0 && q.Scope == nil
+}
+
+// plan picks the tier for the GPU's query and the whole q.Step buckets
+// [a, b) it answers; ok is false when no tier covers any of them.
+func (s *RollupStore) plan(gpuID string, q Query) (tier RollupTier, a, b time.Time, ok bool) {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	for _, t := range s.tiers {
+		if q.Step%t.Step != 0 {
+			continue
+		}
+		span := s.state.coverage[t.Step][gpuID]
+		if span == nil {
+			continue
+		}
+		a, b = span.From, span.Done
+		if q.Start != nil && q.Start.After(a) {
+			a = *q.Start
+		}
+		// the first bucket is answered from a tier only when it is whole
+		if start := BucketStart(a, q.Step); !start.Equal(a) {
+			a = start.Add(q.Step)
+		}
+		b = BucketStart(b, q.Step)
+		if q.End != nil {
+			// the bucket holding End may go past it, so raw answers it
+			if last := BucketStart(*q.End, q.Step); last.Before(b) {
+				b = last
+			}
+		}
+		if a.Before(b) {
+			return t, a, b, true
+		}
+	}
+	return RollupTier{}, time.Time{}, time.Time{}, false
+}
+
+func (s *RollupStore) WithContext(ctx context.Context) Store {
+	tiers := make([]RollupTier, len(s.tiers))
+	for i, t := range s.tiers {
+		tiers[i] = RollupTier{Step: t.Step, Store: WithContext(ctx, t.Store)}
+	}
+	return &RollupStore{raw: WithContext(ctx, s.raw), tiers: tiers, cfg: s.cfg, now: s.now, state: s.state}
+}
+
+func (s *RollupStore) SaveTelemetry(t model.Telemetry) error { return s.raw.SaveTelemetry(t) }
+
+func (s *RollupStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	return s.raw.SaveTelemetryBatch(items)
+}
+
+func (s *RollupStore) ListGPUs() ([]string, error) { return s.raw.ListGPUs() }
+
+func (s *RollupStore) ListGPUsIn(sc Scope) ([]string, error) { return Scoped(s.raw, sc).ListGPUs() }
+
+func (s *RollupStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
+	return s.raw.QueryTelemetry(gpuID, start, end)
+}
+
+// QueryTelemetryWith answers the whole buckets a tier covers from the tier
+// and the rest of the window from raw; the parts do not overlap in time, so
+// merging is concatenation.
+func (s *RollupStore) QueryTelemetryWith(gpuID string, q Query) ([]model.Telemetry, error) {
+	if !routable(q) {
+		return Execute(s.raw, gpuID, q)
+	}
+	tier, a, b, ok := s.plan(gpuID, q)
+	if !ok {
+		return Execute(s.raw, gpuID, q)
+	}
+	part := Query{Start: q.Start, End: q.End, Metrics: q.Metrics, Step: q.Step}
+	var out []model.Telemetry
+	if q.Start == nil || q.Start.Before(a) {
+		head := part
+		beforeA := a.Add(-time.Nanosecond)
+		head.End = &beforeA
+		items, err := Execute(s.raw, gpuID, head)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, items...)
+	}
+	beforeB := b.Add(-time.Nanosecond)
+	mid := Query{Start: &a, End: &beforeB}
+	for _, m := range q.Metrics {
+		mid.Metrics = append(mid.Metrics, m, RollupCountPrefix+m)
+	}
+	items, err := Execute(tier.Store, gpuID, mid)
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range rollupPoints(items, q.Step) {
+		for k := range it.Metrics {
+			if strings.HasPrefix(k, RollupCountPrefix) {
+				delete(it.Metrics, k)
+			}
+		}
+		it.GPUId = gpuID
+		out = append(out, it)
+	}
+	if q.End == nil || !q.End.Before(b) {
+		tail := part
+		tail.Start = &b
+		items, err := Execute(s.raw, gpuID, tail)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, items...)
+	}
+	return Page(out, q.Desc, q.Offset, q.Limit), nil
+}
+
+// QueryFleet routes each GPU's part of a routable query on its own.
+func (s *RollupStore) QueryFleet(gpuIDs []string, q Query) ([]model.Telemetry, error) {
+	if !routable(q) {
+		return ExecuteFleet(s.raw, gpuIDs, q)
+	}
+	if len(gpuIDs) == 0 {
+		var err error
+		if gpuIDs, err = s.raw.ListGPUs(); err != nil {
+			return nil, err
+		}
+	}
+	per := q
+	per.Desc, per.Offset, per.Limit = false, 0, 0
+	var all []model.Telemetry
+	for _, id := range gpuIDs {
+		items, err := s.QueryTelemetryWith(id, per)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if !all[i].Timestamp.Equal(all[j].Timestamp) {
+			return all[i].Timestamp.Before(all[j].Timestamp)
+		}
+		return all[i].GPUId < all[j].GPUId
+	})
+	return Page(all, q.Desc, q.Offset, q.Limit), nil
+}
+
+func (s *RollupStore) LatestTelemetry(gpuID string) (*model.Telemetry, error) {
+	return Latest(s.raw, gpuID)
+}
+
+func (s *RollupStore) QueryLatest(gpuIDs []string, sc *Scope) (map[string]*model.Telemetry, error) {
+	return LatestMany(s.raw, gpuIDs, sc)
+}
+
+func (s *RollupStore) TopGPUs(q TopQuery) ([]GPUValue, error) { return Top(s.raw, q) }
+
+func (s *RollupStore) AggregateTelemetry(gpuID string, q AggregateQuery) ([]Bucket, error) {
+	return Aggregate(s.raw, gpuID, q)
+}
+
+func (s *RollupStore) SummarizeTelemetry(gpuID string, q Query) (map[string]MetricSummary, error) {
+	return Summarize(s.raw, gpuID, q)
+}
+
+func (s *RollupStore) ListMetrics(gpuIDs []string, q Query) (map[string][]MetricInfo, error) {
+	return ListMetrics(s.raw, gpuIDs, q)
+}
+
+// DeleteTelemetry deletes from raw and every tier that can delete, and
+// returns raw's count. Deleted buckets are not rolled up again.
+func (s *RollupStore) DeleteTelemetry(gpuID string, before time.Time) (int64, error) {
+	d, ok := s.raw.(Deleter)
+	if !ok {
+		return 0, fmt.Errorf("rollup delete telemetry: the raw store cannot delete")
+	}
+	n, err := d.DeleteTelemetry(gpuID, before)
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range s.tiers {
+		if td, ok := t.Store.(Deleter); ok {
+			if _, err := td.DeleteTelemetry(gpuID, before); err != nil {
+				return n, fmt.Errorf("rollup delete %s: %w", t.Step, err)
+			}
+		}
+		s.state.mu.Lock()
+		for id, span := range s.state.coverage[t.Step] {
+			if gpuID != "" && id != gpuID {
+				continue
+			}
+			if before.IsZero() {
+				span.From = span.Done
+			} else if span.From.Before(before) {
+				// the bucket holding before lost its older points
+				span.From = BucketStart(before, t.Step).Add(t.Step)
+				if span.Done.Before(span.From) {
+					span.Done = span.From
+				}
+			}
+		}
+		s.state.mu.Unlock()
+	}
+	return n, nil
+}
+
+// DeleteMetrics deletes metrics from raw and, with their counts, from the
+// tier buckets that end by before, so a bucket is never left rolling up
+// values raw still holds. Tiers that cannot delete metrics keep them.
+func (s *RollupStore) DeleteMetrics(gpuID string, metrics []string, before time.Time) (int64, error) {
+	d, ok := s.raw.(MetricDeleter)
+	if !ok {
+		return 0, fmt.Errorf("rollup delete metrics: the raw store cannot delete metrics")
+	}
+	n, err := d.DeleteMetrics(gpuID, metrics, before)
+	if err != nil {
+		return 0, err
+	}
+	names := append([]string(nil), metrics...)
+	for _, m := range metrics {
+		names = append(names, RollupCountPrefix+m)
+	}
+	for _, t := range s.tiers {
+		td, ok := t.Store.(MetricDeleter)
+		if !ok {
+			continue
+		}
+		cut := before
+		if !before.IsZero() {
+			cut = BucketStart(before, t.Step)
+		}
+		if _, err := td.DeleteMetrics(gpuID, names, cut); err != nil {
+			return n, fmt.Errorf("rollup delete metrics %s: %w", t.Step, err)
+		}
+	}
+	return n, nil
+}
+
+func (s *RollupStore) Ping(ctx context.Context) error {
+	if p, ok := s.raw.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// rollupFixture holds one point of g1 every 10s over minutes 0-59 (temp
+// the minute, util only on even minutes) in raw, with 1m and 5m tiers
+// refreshed at minute 61.
+func rollupFixture(t *testing.T) (*RollupStore, *MemoryStore, map[time.Duration]*MemoryStore, time.Time) {
+	t.Helper()
+	raw := NewMemoryStore()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for s := 0; s < 3600; s += 10 {
+		m := map[string]float64{"temp": float64(s / 60)}
+		if (s/60)%2 == 0 {
+			m["util"] = float64(s % 60)
+		}
+		_ = raw.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Duration(s) * time.Second), Metrics: m})
+	}
+	tiers := map[time.Duration]*MemoryStore{time.Minute: NewMemoryStore(), 5 * time.Minute: NewMemoryStore()}
+	st := NewRollupStore(raw, []RollupTier{{Step: time.Minute, Store: tiers[time.Minute]}, {Step: 5 * time.Minute, Store: tiers[5*time.Minute]}},
+		RollupConfig{Backfill: 2 * time.Hour, Delay: time.Minute})
+	st.now = func() time.Time { return t0.Add(61 * time.Minute) }
+	if err := st.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	return st, raw, tiers, t0
+}
+
+func TestRollupStore_RefreshWritesTiers(t *testing.T) {
+	// Scenario: an hour of points every 10s, refreshed at minute 61 with a
+	// 1m delay, then again
+	// Expect: 60 one-minute and 12 five-minute rollup points with the mean
+	// and count of each metric; the second refresh writes nothing new
+	st, _, tiers, t0 := rollupFixture(t)
+	one, _ := tiers[time.Minute].QueryTelemetry("g1", nil, nil)
+	five, _ := tiers[5*time.Minute].QueryTelemetry("g1", nil, nil)
+	if len(one) != 60 || len(five) != 12 {
+		t.Fatalf("points: %d %d", len(one), len(five))
+	}
+	want := map[string]float64{"temp": 2, RollupCountPrefix + "temp": 6, "util": 25, RollupCountPrefix + "util": 6}
+	if !one[2].Timestamp.Equal(t0.Add(2*time.Minute)) || !reflect.DeepEqual(one[2].Metrics, want) {
+		t.Fatalf("minute 2: %+v", one[2])
+	}
+	if five[0].Metrics["temp"] != 2 || five[0].Metrics[RollupCountPrefix+"util"] != 18 {
+		t.Fatalf("first 5m: %+v", five[0])
+	}
+	if err := st.Refresh(context.Background()); err != nil {
+		t.Fatalf("second refresh: %v", err)
+	}
+	if again, _ := tiers[time.Minute].QueryTelemetry("g1", nil, nil); len(again) != 60 {
+		t.Fatalf("after second refresh: %d", len(again))
+	}
+}
+
+func TestRollupStore_RoutedQueriesMatchRaw(t *testing.T) {
+	// Scenario: downsampled queries over windows that start and end inside
+	// buckets, partly past the rolled-up range, with metric filters, paging,
+	// a step no tier divides, and a host filter
+	// Expect: every result equals downsampling raw; the 10m query reads the
+	// 5m tier for its whole buckets
+	st, raw, tiers, t0 := rollupFixture(t)
+	at := func(d time.Duration) *time.Time { ts := t0.Add(d); return &ts }
+	for _, q := range []Query{
+		{Step: 10 * time.Minute},
+		{Step: 10 * time.Minute, Start: at(7*time.Minute + 30*time.Second), End: at(45*time.Minute + 5*time.Second)},
+		{Step: 2 * time.Minute, Start: at(3 * time.Minute), Metrics: []string{"util"}},
+		{Step: 5 * time.Minute, Desc: true, Offset: 2, Limit: 3},
+		{Step: 90 * time.Second},
+		{Step: 5 * time.Minute, HostIDs: []string{"h1"}},
+	} {
+		got, err := st.QueryTelemetryWith("g1", q)
+		want := Apply(raw.window("g1", q.Start, q.End), q)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%+v:\n got %v %+v\nwant %+v", q, err, got, want)
+		}
+	}
+	// the 5m tier answers: change its first bucket and the result follows
+	_ = tiers[5*time.Minute].SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0, Metrics: map[string]float64{"temp": 100, RollupCountPrefix + "temp": 30}})
+	got, _ := st.QueryTelemetryWith("g1", Query{Step: 10 * time.Minute, Metrics: []string{"temp"}})
+	if got[0].Metrics["temp"] != (2*30+100*30+7*30)/90.0 {
+		t.Fatalf("tier not used: %+v", got[0])
+	}
+	fleet, err := st.QueryFleet(nil, Query{Step: 10 * time.Minute, Desc: true, Limit: 1})
+	if err != nil || len(fleet) != 1 || !fleet[0].Timestamp.Equal(t0.Add(50*time.Minute)) || fleet[0].GPUId != "g1" {
+		t.Fatalf("fleet: %v %+v", err, fleet)
+	}
+}
+
+func TestRollupStore_DeleteShrinksCoverage(t *testing.T) {
+	st, raw, tiers, t0 := rollupFixture(t)
+	if _, err := st.DeleteTelemetry("g1", t0.Add(30*time.Minute)); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if one, _ := tiers[time.Minute].QueryTelemetry("g1", nil, nil); len(one) != 30 {
+		t.Fatalf("1m tier left: %d", len(one))
+	}
+	q := Query{Step: 10 * time.Minute}
+	if got, _ := st.QueryTelemetryWith("g1", q); !reflect.DeepEqual(got, Apply(raw.window("g1", nil, nil), q)) {
+		t.Fatalf("after delete: %+v", got)
+	}
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// NewReadRouter returns a store that reads the last window of data from
+// recent, a fast store, and anything older from archive, merging the two
+// halves of a window that spans both. Writes go to archive, the store of
+// record; recent is expected to be filled by whatever keeps it (a tiering
+// job, or a collector writing to both).
+func NewReadRouter(recent, archive Store, window time.Duration) Store {
+	return &readRouter{recent: recent, archive: archive, window: window, now: time.Now}
+}
+
+type readRouter struct {
+	recent, archive Store
+	window          time.Duration
+	now             func() time.Time
+	// since, when set, is when recent started holding data; it takes over no
+	// earlier than that.
+	since time.Time
+}
+
+func (r *readRouter) WithContext(ctx context.Context) Store {
+	return r.withContext(ctx)
+}
+
+func (r *readRouter) withContext(ctx context.Context) *readRouter {
+	return &readRouter{recent: WithContext(ctx, r.recent), archive: WithContext(ctx, r.archive), window: r.window, now: r.now, since: r.since}
+}
+
+// cut returns where recent takes over: now minus the window, rounded down to
+// step so no downsampling bucket is split between the stores. Before recent
+// has held a full window, the cut is since rounded up to step instead.
+func (r *readRouter) cut(step time.Duration) time.Time {
+	c := r.now().Add(-r.window)
+	if r.since.After(c) {
+		c = r.since
+		if step > 0 && !BucketStart(c, step).Equal(c) {
+			c = BucketStart(c, step).Add(step)
+		}
+		return c
+	}
+	if step > 0 {
+		c = BucketStart(c, step)
+	}
+	return c
+}
+
+func (r *readRouter) SaveTelemetry(t model.Telemetry) error { return r.archive.SaveTelemetry(t) }
+
+func (r *readRouter) SaveTelemetryBatch(items []model.Telemetry) error {
+	return r.archive.SaveTelemetryBatch(items)
+}
+
+// ListGPUs lists the GPUs of both stores.
+func (r *readRouter) ListGPUs() ([]string, error) {
+	return r.union(r.recent.ListGPUs, r.archive.ListGPUs)
+}
+
+func (r *readRouter) ListGPUsIn(sc Scope) ([]string, error) {
+	return r.union(Scoped(r.recent, sc).ListGPUs, Scoped(r.archive, sc).ListGPUs)
+}
+
+func (r *readRouter) union(lists ...func() ([]string, error)) ([]string, error) {
+	seen := map[string]bool{}
+	var out []string
+	for _, list := range lists {
+		ids, err := list()
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				out = append(out, id)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (r *readRouter) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
+	return r.QueryTelemetryWith(gpuID, Query{Start: start, End: end})
+}
+
+func (r *readRouter) QueryTelemetryWith(gpuID string, q Query) ([]model.Telemetry, error) {
+	return r.route(q, func(s Store, q Query) ([]model.Telemetry, error) { return Execute(s, gpuID, q) })
+}
+
+func (r *readRouter) QueryFleet(gpuIDs []string, q Query) ([]model.Telemetry, error) {
+	return r.route(q, func(s Store, q Query) ([]model.Telemetry, error) { return ExecuteFleet(s, gpuIDs, q) })
+}
+
+// route runs q on the store(s) holding its window. A window spanning the cut
+// is queried in two halves; as each half pages from its own start, both are
+// asked for Offset+Limit items and the page is taken from the merged result.
+// The halves do not overlap in time, so merging is concatenation.
+func (r *readRouter) route(q Query, run func(Store, Query) ([]model.Telemetry, error)) ([]model.Telemetry, error) {
+	cut := r.cut(q.Step)
+	if q.Start != nil && !q.Start.Before(cut) {
+		return run(r.recent, q)
+	}
+	if q.End != nil && q.End.Before(cut) {
+		return run(r.archive, q)
+	}
+	older, newer := q, q
+	beforeCut := cut.Add(-time.Nanosecond)
+	older.End, newer.Start = &beforeCut, &cut
+	older.Offset, newer.Offset = 0, 0
+	if q.Limit > 0 {
+		older.Limit, newer.Limit = q.Offset+q.Limit, q.Offset+q.Limit
+	}
+	a, err := run(r.archive, older)
+	if err != nil {
+		return nil, err
+	}
+	b, err := run(r.recent, newer)
+	if err != nil {
+		return nil, err
+	}
+	first, second := a, b
+	if q.Desc {
+		first, second = b, a
+	}
+	return Page(append(first, second...), false, q.Offset, q.Limit), nil
+}
+
+// LatestTelemetry prefers recent, and falls back to archive for a GPU that
+// has not reported within the window.
+func (r *readRouter) LatestTelemetry(gpuID string) (*model.Telemetry, error) {
+	t, err := Latest(r.recent, gpuID)
+	if err != nil || t != nil {
+		return t, err
+	}
+	return Latest(r.archive, gpuID)
+}
+
+// QueryLatest asks recent first and archive for the GPUs recent lacks.
+func (r *readRouter) QueryLatest(gpuIDs []string, sc *Scope) (map[string]*model.Telemetry, error) {
+	out, err := LatestMany(r.recent, gpuIDs, sc)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, id := range gpuIDs {
+		if out[id] == nil {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+	older, err := LatestMany(r.archive, missing, sc)
+	if err != nil {
+		return nil, err
+	}
+	for id, it := range older {
+		out[id] = it
+	}
+	return out, nil
+}
+
+// TopGPUs ranks on recent when the window is within it. An average cannot be
+// merged from two partial rankings, so longer windows are ranked by archive.
+func (r *readRouter) TopGPUs(q TopQuery) ([]GPUValue, error) {
+	if q.Start != nil && !q.Start.Before(r.cut(0)) {
+		return Top(r.recent, q)
+	}
+	return Top(r.archive, q)
+}
+
+// AggregateTelemetry splits a window spanning the cut like route: the cut is
+// aligned to the step, so no bucket has points in both stores.
+func (r *readRouter) AggregateTelemetry(gpuID string, q AggregateQuery) ([]Bucket, error) {
+	cut := r.cut(q.Step)
+	if q.Start != nil && !q.Start.Before(cut) {
+		return Aggregate(r.recent, gpuID, q)
+	}
+	if q.End != nil && q.End.Before(cut) {
+		return Aggregate(r.archive, gpuID, q)
+	}
+	older, newer := q, q
+	beforeCut := cut.Add(-time.Nanosecond)
+	older.End, newer.Start = &beforeCut, &cut
+	a, err := Aggregate(r.archive, gpuID, older)
+	if err != nil {
+		return nil, err
+	}
+	b, err := Aggregate(r.recent, gpuID, newer)
+	if err != nil {
+		return nil, err
+	}
+	return append(a, b...), nil
+}
+
+// SummarizeTelemetry works like TopGPUs: percentiles cannot be merged either.
+func (r *readRouter) SummarizeTelemetry(gpuID string, q Query) (map[string]MetricSummary, error) {
+	if q.Start != nil && !q.Start.Before(r.cut(0)) {
+		return Summarize(r.recent, gpuID, q)
+	}
+	return Summarize(r.archive, gpuID, q)
+}
+
+// ListMetrics splits a window spanning the cut like route; counts and first
+// and last seen merge exactly.
+func (r *readRouter) ListMetrics(gpuIDs []string, q Query) (map[string][]MetricInfo, error) {
+	cut := r.cut(0)
+	if q.Start != nil && !q.Start.Before(cut) {
+		return ListMetrics(r.recent, gpuIDs, q)
+	}
+	if q.End != nil && q.End.Before(cut) {
+		return ListMetrics(r.archive, gpuIDs, q)
+	}
+	older, newer := q, q
+	beforeCut := cut.Add(-time.Nanosecond)
+	older.End, newer.Start = &beforeCut, &cut
+	a, err := ListMetrics(r.archive, gpuIDs, older)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ListMetrics(r.recent, gpuIDs, newer)
+	if err != nil {
+		return nil, err
+	}
+	return mergeMetricInfo(a, b), nil
+}
+
+func (r *readRouter) Ping(ctx context.Context) error {
+	for _, s := range []Store{r.recent, r.archive} {
+		if p, ok := s.(Pinger); ok {
+			if err := p.Ping(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
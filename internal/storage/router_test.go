@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// routerFixture holds minutes 0-9 of g1 in archive and minutes 6-9 in
+// recent, with the cut at minute 6. Each store marks its points so the test
+// can tell which one answered.
+func routerFixture(t *testing.T) (*readRouter, time.Time) {
+	t.Helper()
+	recent, archive := NewMemoryStore(), NewMemoryStore()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		ts := t0.Add(time.Duration(i) * time.Minute)
+		_ = archive.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: ts, Metrics: map[string]float64{"m": float64(i), "archive": 1}})
+		if i >= 6 {
+			_ = recent.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: ts, Metrics: map[string]float64{"m": float64(i), "recent": 1}})
+		}
+	}
+	_ = archive.SaveTelemetry(model.Telemetry{GPUId: "g2", Timestamp: t0, Metrics: map[string]float64{"m": 1}})
+	r := &readRouter{recent: recent, archive: archive, window: 4 * time.Minute, now: func() time.Time { return t0.Add(10 * time.Minute) }}
+	return r, t0
+}
+
+func TestReadRouter_SplitsAndMergesWindows(t *testing.T) {
+	r, t0 := routerFixture(t)
+	at := func(min int) *time.Time { ts := t0.Add(time.Duration(min) * time.Minute); return &ts }
+
+	items, err := r.QueryTelemetryWith("g1", Query{Start: at(2), End: at(8)})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(items) != 7 {
+		t.Fatalf("want minutes 2-8, got %d items", len(items))
+	}
+	for i, it := range items {
+		min := i + 2
+		fromRecent := it.Metrics["recent"] == 1
+		if it.Metrics["m"] != float64(min) || fromRecent != (min >= 6) {
+			t.Fatalf("item %d: %v", i, it.Metrics)
+		}
+	}
+
+	// newest first, second page of three: minutes 6, 5, 4
+	items, _ = r.QueryTelemetryWith("g1", Query{Desc: true, Offset: 3, Limit: 3})
+	if len(items) != 3 || items[0].Metrics["m"] != 6 || items[0].Metrics["recent"] != 1 || items[2].Metrics["m"] != 4 {
+		t.Fatalf("desc page: %v", items)
+	}
+
+	items, _ = r.QueryTelemetryWith("g1", Query{Start: at(7)})
+	if len(items) != 3 || items[0].Metrics["recent"] != 1 {
+		t.Fatalf("recent only: %v", items)
+	}
+	items, _ = r.QueryTelemetryWith("g1", Query{End: at(3)})
+	if len(items) != 4 || items[3].Metrics["archive"] != 1 {
+		t.Fatalf("archive only: %v", items)
+	}
+}
+
+func TestReadRouter_ListLatestAndTop(t *testing.T) {
+	r, t0 := routerFixture(t)
+	ids, err := r.ListGPUs()
+	if err != nil || len(ids) != 2 || ids[0] != "g1" || ids[1] != "g2" {
+		t.Fatalf("list: %v %v", ids, err)
+	}
+	if l, _ := r.LatestTelemetry("g1"); l == nil || l.Metrics["recent"] != 1 {
+		t.Fatalf("latest g1: %v", l)
+	}
+	if l, _ := r.LatestTelemetry("g2"); l == nil || !l.Timestamp.Equal(t0) {
+		t.Fatalf("latest g2 from archive: %v", l)
+	}
+	start := t0.Add(7 * time.Minute)
+	top, _ := r.TopGPUs(TopQuery{Metric: "recent", Start: &start})
+	if len(top) != 1 {
+		t.Fatalf("top within window should rank recent: %v", top)
+	}
+	top, _ = r.TopGPUs(TopQuery{Metric: "archive"})
+	if len(top) != 1 || top[0].GPUId != "g1" {
+		t.Fatalf("top over everything should rank archive: %v", top)
+	}
+}
+
+func TestReadRouter_AggregateSplitsAtBucketBoundary(t *testing.T) {
+	// Scenario: max of m per 2m over the whole fleet window, the cut at
+	// minute 6 falling on a bucket boundary
+	// Expect: buckets 0-8 from both stores with each bucket's max; archive
+	// answers for the buckets before the cut only, recent for those after
+	r, t0 := routerFixture(t)
+	got, err := Aggregate(r, "g1", AggregateQuery{Metric: "m", Step: 2 * time.Minute, Agg: AggMax})
+	if err != nil {
+		t.Fatalf("aggregate: %v", err)
+	}
+	if len(got) != 5 {
+		t.Fatalf("want 5 buckets, got %+v", got)
+	}
+	for i, b := range got {
+		if !b.Timestamp.Equal(t0.Add(time.Duration(2*i)*time.Minute)) || b.Value != float64(2*i+1) {
+			t.Fatalf("bucket %d: %+v", i, b)
+		}
+	}
+	for metric, n := range map[string]int{"archive": 3, "recent": 2} {
+		if got, _ := Aggregate(r, "g1", AggregateQuery{Metric: metric, Step: 2 * time.Minute}); len(got) != n {
+			t.Fatalf("%s: want %d buckets, got %+v", metric, n, got)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package storage
+
+// RuleStore is implemented by stores that can persist alert rules. Rules are
+// opaque JSON documents keyed by id, so storage does not depend on the
+// alerting package.
+type RuleStore interface {
+	SaveRule(id string, doc []byte) error
+	// DeleteRule reports whether the rule existed.
+	DeleteRule(id string) (bool, error)
+	ListRules() (map[string][]byte, error)
+}
+
+// WebhookStore is implemented by stores that can persist webhook
+// subscriptions, opaque JSON documents keyed by id like rules.
+type WebhookStore interface {
+	SaveWebhook(id string, doc []byte) error
+	// DeleteWebhook reports whether the subscription existed.
+	DeleteWebhook(id string) (bool, error)
+	ListWebhooks() (map[string][]byte, error)
+}
+
+// InventoryStore is implemented by stores that can persist GPU inventory:
+// the static description each GPU's streamer registers (model, driver, PCI
+// bus, ...), one opaque JSON document per gpu_id.
+type InventoryStore interface {
+	SaveGPUInfo(gpuID string, doc []byte) error
+	ListGPUInfo() (map[string][]byte, error)
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// ClusterLabel is the label naming a GPU's cluster, set by the collector's
+// inventory enrichment.
+const ClusterLabel = "cluster"
+
+// Scope is the part of the fleet a tenant may see: points reported from one
+// of HostIDs or labelled with one of Clusters. The zero Scope sees nothing.
+type Scope struct {
+	HostIDs  []string
+	Clusters []string
+}
+
+// Allows reports whether t is within the scope.
+func (sc *Scope) Allows(t model.Telemetry) bool {
+	for _, h := range sc.HostIDs {
+		if t.HostId == h {
+			return true
+		}
+	}
+	if c, ok := t.Labels[ClusterLabel]; ok {
+		for _, want := range sc.Clusters {
+			if c == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FilterScope returns the items sc allows; a nil sc returns items unchanged.
+func FilterScope(items []model.Telemetry, sc *Scope) []model.Telemetry {
+	if sc == nil {
+		return items
+	}
+	var out []model.Telemetry
+	for _, it := range items {
+		if sc.Allows(it) {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+// ScopeLister is implemented by stores that can list the GPUs with data in a
+// scope without querying each GPU.
+type ScopeLister interface {
+	ListGPUsIn(sc Scope) ([]string, error)
+}
+
+// Scoped returns a read view of s limited to sc: every query, listing,
+// latest point and ranking only sees points sc allows. Writes pass through.
+func Scoped(s Store, sc Scope) Store {
+	return &scopedStore{base: s, scope: sc}
+}
+
+type scopedStore struct {
+	base  Store
+	scope Scope
+}
+
+func (s *scopedStore) WithContext(ctx context.Context) Store {
+	return &scopedStore{base: WithContext(ctx, s.base), scope: s.scope}
+}
+
+func (s *scopedStore) SaveTelemetry(t model.Telemetry) error { return s.base.SaveTelemetry(t) }
+
+func (s *scopedStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	return s.base.SaveTelemetryBatch(items)
+}
+
+func (s *scopedStore) ListGPUs() ([]string, error) {
+	if sl, ok := s.base.(ScopeLister); ok {
+		return sl.ListGPUsIn(s.scope)
+	}
+	ids, err := s.base.ListGPUs()
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, id := range ids {
+		items, err := Execute(s.base, id, Query{Scope: &s.scope, Limit: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(items) > 0 {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+func (s *scopedStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
+	return s.QueryTelemetryWith(gpuID, Query{Start: start, End: end})
+}
+
+func (s *scopedStore) QueryTelemetryWith(gpuID string, q Query) ([]model.Telemetry, error) {
+	q.Scope = &s.scope
+	return Execute(s.base, gpuID, q)
+}
+
+func (s *scopedStore) QueryFleet(gpuIDs []string, q Query) ([]model.Telemetry, error) {
+	q.Scope = &s.scope
+	return ExecuteFleet(s.base, gpuIDs, q)
+}
+
+func (s *scopedStore) LatestTelemetry(gpuID string) (*model.Telemetry, error) {
+	items, err := s.QueryTelemetryWith(gpuID, Query{Desc: true, Limit: 1})
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+func (s *scopedStore) QueryLatest(gpuIDs []string, _ *Scope) (map[string]*model.Telemetry, error) {
+	return LatestMany(s.base, gpuIDs, &s.scope)
+}
+
+func (s *scopedStore) TopGPUs(q TopQuery) ([]GPUValue, error) {
+	q.Scope = &s.scope
+	return Top(s.base, q)
+}
+
+func (s *scopedStore) AggregateTelemetry(gpuID string, q AggregateQuery) ([]Bucket, error) {
+	q.Scope = &s.scope
+	return Aggregate(s.base, gpuID, q)
+}
+
+func (s *scopedStore) SummarizeTelemetry(gpuID string, q Query) (map[string]MetricSummary, error) {
+	q.Scope = &s.scope
+	return Summarize(s.base, gpuID, q)
+}
+
+func (s *scopedStore) ListMetrics(gpuIDs []string, q Query) (map[string][]MetricInfo, error) {
+	q.Scope = &s.scope
+	return ListMetrics(s.base, gpuIDs, q)
+}
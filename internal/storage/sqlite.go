@@ -1,9 +1,13 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"gpu-metric-collector/internal/model"
@@ -11,54 +15,489 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-// SQLiteStore implements Store backed by a single table with JSON metrics.
+// SQLiteStore implements Store backed by a table of points, with their
+// metrics in a JSON column or, in the normalized schema, one row per metric.
 type SQLiteStore struct {
-	db *sql.DB
+	db  *sql.DB
+	ctx context.Context // nil means context.Background()
+	// insert writes one row, insertChunk sqliteBatchRows rows; in the
+	// normalized schema insert returns the new row's rowid and insertChunk
+	// is not used
+	insert, insertChunk *sql.Stmt
+	normalized          bool
+	// upsert replaces a stored point with a write of the same GPU, producer
+	// and second
+	upsert bool
 }
 
-// NewSQLiteStore opens (and initializes) an SQLite database.
-// Example DSN: file:gpu-telemetry.db?_busy_timeout=5000
+// SQLiteSchema selects how an SQLite store lays out metrics.
+type SQLiteSchema int
+
+const (
+	// SQLiteJSON keeps each point's metrics in one JSON column.
+	SQLiteJSON SQLiteSchema = iota
+	// SQLiteNormalized keeps one (gpu_id, ts, metric, value) row per metric
+	// in telemetry_values, indexed by metric, so per-metric filters and
+	// aggregations only read that metric's rows.
+	SQLiteNormalized
+)
+
+// SQLiteOptions configures NewSQLiteStoreWith.
+type SQLiteOptions struct {
+	Schema SQLiteSchema
+	// Upsert makes (gpu_id, producer_id, ts) unique, so a redelivered point
+	// overwrites the stored one instead of adding a row even without an
+	// idempotency key. ts is in seconds: a producer's points of one GPU
+	// within a second replace each other. A database keeps upsert once it
+	// was opened with it, and cannot enable it while it holds duplicates.
+	Upsert bool
+}
+
+// sqlitePragmas are applied to every connection unless the DSN sets them:
+// WAL lets readers run alongside the writer, busy_timeout makes a writer
+// wait for the lock instead of failing with SQLITE_BUSY, and synchronous
+// NORMAL is durable in WAL mode except for the last commits on power loss.
+var sqlitePragmas = [][2]string{
+	{"journal_mode", "WAL"},
+	{"busy_timeout", "5000"},
+	{"synchronous", "NORMAL"},
+}
+
+// sqliteDSN adds the sqlitePragmas the DSN does not set itself.
+func sqliteDSN(dsn string) string {
+	var add []string
+	for _, p := range sqlitePragmas {
+		if !strings.Contains(dsn, p[0]) {
+			add = append(add, "_pragma="+p[0]+"("+p[1]+")")
+		}
+	}
+	if len(add) == 0 {
+		return dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + strings.Join(add, "&")
+}
+
+// NewSQLiteStore opens (and initializes) an SQLite database in WAL mode
+// with a busy timeout; see sqlitePragmas.
+// Example DSN: file:gpu-telemetry.db or file:gpu-telemetry.db?_pragma=busy_timeout(10000)
 func NewSQLiteStore(dsn string) (Store, error) {
-	db, err := sql.Open("sqlite", dsn)
+	return NewSQLiteStoreWith(dsn, SQLiteOptions{})
+}
+
+// NewSQLiteStoreWith is NewSQLiteStore with the given options. A database
+// keeps the schema it was created with; opening it with the other fails.
+func NewSQLiteStoreWith(dsn string, opts SQLiteOptions) (Store, error) {
+	db, err := sql.Open("sqlite", sqliteDSN(dsn))
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite: %w", err)
 	}
-	if err := initSchema(db); err != nil {
+	normalized := opts.Schema == SQLiteNormalized
+	upsert, err := initSchema(db, normalized, opts.Upsert)
+	if err != nil {
 		_ = db.Close()
 		return nil, err
 	}
-	return &SQLiteStore{db: db}, nil
+	s := &SQLiteStore{db: db, normalized: normalized, upsert: upsert}
+	if normalized {
+		s.insert, err = db.Prepare(s.insertRows(1) + ` RETURNING rowid`)
+	} else if s.insert, err = db.Prepare(s.insertRows(1)); err == nil {
+		s.insertChunk, err = db.Prepare(s.insertRows(sqliteBatchRows))
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("prepare insert: %w", err)
+	}
+	return s, nil
 }
 
-func initSchema(db *sql.DB) error {
+// WithContext returns a view of s whose statements use ctx, so they stop
+// when it is cancelled or its deadline passes.
+func (s *SQLiteStore) WithContext(ctx context.Context) Store {
+	return &SQLiteStore{db: s.db, ctx: ctx, insert: s.insert, insertChunk: s.insertChunk, normalized: s.normalized, upsert: s.upsert}
+}
+
+func (s *SQLiteStore) callCtx() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+// initSchema creates the tables and indexes and reports whether the
+// database upserts: when upsert is set or an earlier open enabled it.
+func initSchema(db *sql.DB, normalized, upsert bool) (bool, error) {
 	_, err := db.Exec(`
 CREATE TABLE IF NOT EXISTS telemetry (
   gpu_id TEXT NOT NULL,
   ts INTEGER NOT NULL,
-  metrics TEXT NOT NULL
+  metrics TEXT NOT NULL,
+  idem_key TEXT,
+  host_id TEXT NOT NULL DEFAULT '',
+  producer_id TEXT NOT NULL DEFAULT '',
+  labels TEXT,
+  typed_values TEXT
 );
 CREATE INDEX IF NOT EXISTS idx_telemetry_gpu_ts ON telemetry(gpu_id, ts);
+CREATE TABLE IF NOT EXISTS alert_rules (
+  id TEXT PRIMARY KEY,
+  doc TEXT NOT NULL,
+  updated_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS webhooks (
+  id TEXT PRIMARY KEY,
+  doc TEXT NOT NULL,
+  updated_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS gpu_inventory (
+  id TEXT PRIMARY KEY,
+  doc TEXT NOT NULL,
+  updated_at INTEGER NOT NULL
+);
 `)
 	if err != nil {
-		return fmt.Errorf("init schema: %w", err)
+		return false, fmt.Errorf("init schema: %w", err)
 	}
-	return nil
+	// databases created by older versions lack the newer columns
+	for _, c := range []struct{ name, decl string }{
+		{"idem_key", "TEXT"},
+		{"host_id", "TEXT NOT NULL DEFAULT ''"},
+		{"producer_id", "TEXT NOT NULL DEFAULT ''"},
+		{"labels", "TEXT"},
+		{"typed_values", "TEXT"},
+	} {
+		if err := addColumnIfMissing(db, "telemetry", c.name, c.decl); err != nil {
+			return false, fmt.Errorf("init schema: %w", err)
+		}
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_telemetry_idem ON telemetry(idem_key) WHERE idem_key IS NOT NULL`); err != nil {
+		return false, fmt.Errorf("init schema: %w", err)
+	}
+	if upsert {
+		if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_telemetry_point ON telemetry(gpu_id, producer_id, ts)`); err != nil {
+			return false, fmt.Errorf("init schema: upsert needs one point per gpu, producer and second, and the database holds more: %w", err)
+		}
+	}
+	var hasValues, hasPoints bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'telemetry_values'), EXISTS (SELECT 1 FROM telemetry),
+  EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'index' AND name = 'idx_telemetry_point')`).Scan(&hasValues, &hasPoints, &upsert); err != nil {
+		return false, fmt.Errorf("init schema: %w", err)
+	}
+	switch {
+	case hasValues && !normalized:
+		return false, fmt.Errorf("init schema: the database has the normalized schema")
+	case !hasValues && normalized && hasPoints:
+		return false, fmt.Errorf("init schema: the database has the JSON schema")
+	case !normalized:
+		return upsert, nil
+	}
+	// gpu_id and ts are copied from the point so the metric index covers
+	// a GPU's window
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS telemetry_values (
+  point INTEGER NOT NULL,
+  gpu_id TEXT NOT NULL,
+  ts INTEGER NOT NULL,
+  metric TEXT NOT NULL,
+  value REAL NOT NULL,
+  PRIMARY KEY (point, metric)
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS idx_telemetry_values_metric ON telemetry_values(metric, gpu_id, ts);
+`)
+	if err != nil {
+		return false, fmt.Errorf("init schema: %w", err)
+	}
+	return upsert, nil
 }
 
-func (s *SQLiteStore) SaveTelemetry(t model.Telemetry) error {
+// metricsColumn is the JSON object of a telemetry row's metrics, only keys
+// when set; the keys are appended to args.
+func (s *SQLiteStore) metricsColumn(keys []string, args []any) (string, []any) {
+	if !s.normalized && len(keys) == 0 {
+		return `metrics`, args
+	}
+	if !s.normalized {
+		in, args := sqliteIn(`key`, keys, args)
+		return `(SELECT json_group_object(key, value) FROM json_each(telemetry.metrics) WHERE ` + in + `)`, args
+	}
+	col := `(SELECT json_group_object(metric, value) FROM telemetry_values WHERE point = telemetry.rowid`
+	if len(keys) > 0 {
+		var in string
+		in, args = sqliteIn(`metric`, keys, args)
+		col += ` AND ` + in
+	}
+	return col + `)`, args
+}
+
+// valuesFrom joins telemetry to one row m(key, value) per metric.
+func (s *SQLiteStore) valuesFrom() string {
+	if !s.normalized {
+		return `telemetry, json_each(telemetry.metrics) AS m`
+	}
+	return `telemetry JOIN (SELECT point, gpu_id AS point_gpu, ts AS point_ts, metric AS key, value FROM telemetry_values) AS m
+  ON m.point = telemetry.rowid AND m.point_gpu = telemetry.gpu_id AND m.point_ts = telemetry.ts`
+}
+
+func addColumnIfMissing(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl))
+	return err
+}
+
+// nullIfEmpty maps "" to SQL NULL so rows without a key never conflict.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// sqliteRow returns the column values of t after gpu_id and ts: metrics,
+// idempotency key, host, producer, labels and typed values (each NULL when
+// there are none).
+func sqliteRow(t model.Telemetry) ([]any, error) {
 	b, err := json.Marshal(t.Metrics)
 	if err != nil {
-		return fmt.Errorf("marshal metrics: %w", err)
+		return nil, fmt.Errorf("marshal metrics: %w", err)
+	}
+	var labels any
+	if len(t.Labels) > 0 {
+		l, err := json.Marshal(t.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("marshal labels: %w", err)
+		}
+		labels = string(l)
+	}
+	var values any
+	if len(t.Values) > 0 {
+		v, err := json.Marshal(t.Values)
+		if err != nil {
+			return nil, fmt.Errorf("marshal values: %w", err)
+		}
+		values = string(v)
+	}
+	return []any{t.GPUId, t.Timestamp.Unix(), string(b), nullIfEmpty(t.IdempotencyKey), t.HostId, t.ProducerId, labels, values}, nil
+}
+
+const (
+	sqliteInsertHead = `INSERT INTO telemetry(gpu_id, ts, metrics, idem_key, host_id, producer_id, labels, typed_values) VALUES`
+	sqliteInsertRow  = `(?, ?, ?, ?, ?, ?, ?, ?)`
+	sqliteInsertTail = ` ON CONFLICT DO NOTHING`
+	// sqliteUpsertTail still skips a duplicate by idempotency key, and
+	// overwrites the point of the same GPU, producer and second; the key it
+	// was first stored with is kept
+	sqliteUpsertTail = ` ON CONFLICT(idem_key) WHERE idem_key IS NOT NULL DO NOTHING
+ON CONFLICT(gpu_id, producer_id, ts) DO UPDATE SET metrics = excluded.metrics, host_id = excluded.host_id, labels = excluded.labels,
+  typed_values = excluded.typed_values`
+)
+
+// insertRows is the INSERT of n rows.
+func (s *SQLiteStore) insertRows(n int) string {
+	tail := sqliteInsertTail
+	if s.upsert {
+		tail = sqliteUpsertTail
+	}
+	return sqliteInsertHead + strings.Repeat(sqliteInsertRow+", ", n-1) + sqliteInsertRow + tail
+}
+
+func (s *SQLiteStore) SaveTelemetry(t model.Telemetry) error {
+	if s.normalized {
+		err := s.saveNormalized([]model.Telemetry{t})
+		if failed := FailedItems(err, 1); failed != nil {
+			return failed[0]
+		}
+		return nil
+	}
+	row, err := sqliteRow(t)
+	if err != nil {
+		return err
 	}
-	_, err = s.db.Exec(`INSERT INTO telemetry(gpu_id, ts, metrics) VALUES(?, ?, ?)`, t.GPUId, t.Timestamp.Unix(), string(b))
+	// duplicates by idempotency key are ignored, so redelivered messages are written once
+	_, err = s.insert.ExecContext(s.callCtx(), row...)
 	if err != nil {
 		return fmt.Errorf("insert telemetry: %w", err)
 	}
 	return nil
 }
 
+// sqliteBatchRows is how many rows one multi-row INSERT of a batch carries:
+// as many rows of 8 values (sqliteInsertRow) as fit SQLite's default limit of
+// 999 variables, 124 rows or 992 variables.
+const sqliteBatchRows = 999 / 8
+
+// SaveTelemetryBatch inserts items in one transaction, sqliteBatchRows per
+// statement. A statement that fails is retried row by row so the failing
+// items can be told apart; they are reported in a *BatchError and the rest
+// are still committed.
+func (s *SQLiteStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if s.normalized {
+		return s.saveNormalized(items)
+	}
+	tx, err := s.db.BeginTx(s.callCtx(), nil)
+	if err != nil {
+		return fmt.Errorf("begin batch: %w", err)
+	}
+	defer tx.Rollback()
+	ctx := s.callCtx()
+	one, chunk := tx.StmtContext(ctx, s.insert), tx.StmtContext(ctx, s.insertChunk)
+	var failed map[int]error
+	fail := func(i int, err error) {
+		if failed == nil {
+			failed = map[int]error{}
+		}
+		failed[i] = fmt.Errorf("insert telemetry: %w", err)
+	}
+	var idx []int
+	var args []any
+	flush := func() {
+		if len(idx) == 0 {
+			return
+		}
+		var err error
+		if len(idx) == sqliteBatchRows {
+			_, err = chunk.ExecContext(ctx, args...)
+		} else {
+			_, err = tx.ExecContext(ctx, s.insertRows(len(idx)), args...)
+		}
+		if err != nil {
+			// a failed statement leaves the transaction usable; find the culprits
+			for k, i := range idx {
+				if _, err := one.ExecContext(ctx, args[k*8:k*8+8]...); err != nil {
+					fail(i, err)
+				}
+			}
+		}
+		idx, args = idx[:0], args[:0]
+	}
+	for i, t := range items {
+		row, err := sqliteRow(t)
+		if err != nil {
+			fail(i, err)
+			continue
+		}
+		idx = append(idx, i)
+		args = append(args, row...)
+		if len(idx) == sqliteBatchRows {
+			flush()
+		}
+	}
+	flush()
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit batch: %w", err)
+	}
+	if failed != nil {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+// sqliteValueRows is how many metric rows one INSERT into telemetry_values
+// carries; 5 values each stays under SQLite's default limit of 999.
+const sqliteValueRows = 199
+
+// saveNormalized inserts items in one transaction: each point's row, then
+// its metrics when the row is new. Items whose metrics cannot be stored
+// are reported in a *BatchError; any other failure fails the batch.
+func (s *SQLiteStore) saveNormalized(items []model.Telemetry) error {
+	ctx := s.callCtx()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin batch: %w", err)
+	}
+	defer tx.Rollback()
+	insert := tx.StmtContext(ctx, s.insert)
+	var failed map[int]error
+	var args []any
+	written := map[int64]bool{} // points of the batch, with upsert
+	flush := func() error {
+		if len(args) == 0 {
+			return nil
+		}
+		n := len(args) / 5
+		_, err := tx.ExecContext(ctx, `INSERT INTO telemetry_values(point, gpu_id, ts, metric, value) VALUES`+
+			strings.Repeat(`(?, ?, ?, ?, ?), `, n-1)+`(?, ?, ?, ?, ?)`, args...)
+		args = args[:0]
+		return err
+	}
+	for i, t := range items {
+		// the JSON encoding rejects what a REAL column cannot hold, e.g. NaN
+		row, err := sqliteRow(t)
+		if err != nil {
+			if failed == nil {
+				failed = map[int]error{}
+			}
+			failed[i] = err
+			continue
+		}
+		row[2] = "{}"
+		var point int64
+		if err := insert.QueryRowContext(ctx, row...).Scan(&point); errors.Is(err, sql.ErrNoRows) {
+			continue // a duplicate by idempotency key
+		} else if err != nil {
+			return fmt.Errorf("insert telemetry: %w", err)
+		}
+		if s.upsert {
+			// an overwritten point drops its old values, including any of
+			// this batch still waiting in args
+			if written[point] {
+				if err := flush(); err != nil {
+					return fmt.Errorf("insert telemetry values: %w", err)
+				}
+			}
+			written[point] = true
+			if _, err := tx.ExecContext(ctx, `DELETE FROM telemetry_values WHERE point = ?`, point); err != nil {
+				return fmt.Errorf("replace telemetry values: %w", err)
+			}
+		}
+		for _, k := range sortedKeys(t.Metrics) {
+			args = append(args, point, t.GPUId, t.Timestamp.Unix(), k, t.Metrics[k])
+			if len(args) == sqliteValueRows*5 {
+				if err := flush(); err != nil {
+					return fmt.Errorf("insert telemetry values: %w", err)
+				}
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("insert telemetry values: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit batch: %w", err)
+	}
+	if failed != nil {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 func (s *SQLiteStore) ListGPUs() ([]string, error) {
-	rows, err := s.db.Query(`SELECT DISTINCT gpu_id FROM telemetry ORDER BY gpu_id`)
+	rows, err := s.db.QueryContext(s.callCtx(), `SELECT DISTINCT gpu_id FROM telemetry ORDER BY gpu_id`)
 	if err != nil {
 		return nil, fmt.Errorf("list gpus: %w", err)
 	}
@@ -74,35 +513,531 @@ func (s *SQLiteStore) ListGPUs() ([]string, error) {
 	return out, rows.Err()
 }
 
+// ListGPUsIn lists the GPUs with at least one point in sc.
+func (s *SQLiteStore) ListGPUsIn(sc Scope) ([]string, error) {
+	where, args := s.where(nil, Query{Scope: &sc})
+	rows, err := s.db.QueryContext(s.callCtx(), `SELECT DISTINCT gpu_id FROM telemetry`+where+` ORDER BY gpu_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
 func (s *SQLiteStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
-	q := `SELECT ts, metrics FROM telemetry WHERE gpu_id = ?`
-	args := []any{gpuID}
-	if start != nil {
-		q += ` AND ts >= ?`
-		args = append(args, start.Unix())
+	return s.QueryTelemetryWith(gpuID, Query{Start: start, End: end})
+}
+
+// sqliteIn returns "col IN (?, ...)" for vals, appending them to args.
+func sqliteIn(col string, vals []string, args []any) (string, []any) {
+	for _, v := range vals {
+		args = append(args, v)
+	}
+	return col + ` IN (?` + strings.Repeat(`, ?`, len(vals)-1) + `)`, args
+}
+
+// where builds the shared WHERE clause: GPUs (all when empty), window,
+// hosts, producers, labels, scope and, with metrics, only rows holding at
+// least one of them.
+func (s *SQLiteStore) where(gpuIDs []string, q Query) (string, []any) {
+	w := ` WHERE 1 = 1`
+	var args []any
+	var in string
+	if len(gpuIDs) > 0 {
+		in, args = sqliteIn(`gpu_id`, gpuIDs, args)
+		w += ` AND ` + in
+	}
+	if q.Start != nil {
+		w += ` AND ts >= ?`
+		args = append(args, q.Start.Unix())
+	}
+	if q.End != nil {
+		w += ` AND ts <= ?`
+		args = append(args, q.End.Unix())
+	}
+	if len(q.HostIDs) > 0 {
+		in, args = sqliteIn(`host_id`, q.HostIDs, args)
+		w += ` AND ` + in
+	}
+	if len(q.ProducerIDs) > 0 {
+		in, args = sqliteIn(`producer_id`, q.ProducerIDs, args)
+		w += ` AND ` + in
+	}
+	for _, k := range sortedKeys(q.Labels) {
+		w += ` AND EXISTS (SELECT 1 FROM json_each(telemetry.labels) WHERE key = ? AND value = ?)`
+		args = append(args, k, q.Labels[k])
+	}
+	if sc := q.Scope; sc != nil {
+		var conds []string
+		if len(sc.HostIDs) > 0 {
+			in, args = sqliteIn(`host_id`, sc.HostIDs, args)
+			conds = append(conds, in)
+		}
+		if len(sc.Clusters) > 0 {
+			in, args = sqliteIn(`json_extract(labels, '$.`+ClusterLabel+`')`, sc.Clusters, args)
+			conds = append(conds, in)
+		}
+		if len(conds) == 0 {
+			conds = []string{`0`}
+		}
+		w += ` AND (` + strings.Join(conds, ` OR `) + `)`
+	}
+	if len(q.Metrics) > 0 {
+		var holds string
+		if s.normalized {
+			in, args = sqliteIn(`metric`, q.Metrics, args)
+			holds = `EXISTS (SELECT 1 FROM telemetry_values WHERE point = telemetry.rowid AND ` + in + `)`
+		} else {
+			in, args = sqliteIn(`key`, q.Metrics, args)
+			holds = `EXISTS (SELECT 1 FROM json_each(telemetry.metrics) WHERE ` + in + `)`
+		}
+		in, args = sqliteIn(`key`, q.Metrics, args)
+		w += ` AND (` + holds + ` OR EXISTS (SELECT 1 FROM json_each(telemetry.typed_values) WHERE ` + in + `))`
+	}
+	return w, args
+}
+
+// QueryTelemetryWith filters and pages in SQL, ordering equal timestamps by
+// insertion so pages are stable across requests. Downsampled buckets are
+// computed in SQL and paged afterwards.
+func (s *SQLiteStore) QueryTelemetryWith(gpuID string, q Query) ([]model.Telemetry, error) {
+	return s.QueryFleet([]string{gpuID}, q)
+}
+
+// QueryFleet is QueryTelemetryWith over several GPUs (all when gpuIDs is
+// empty), ordering equal timestamps by GPU.
+func (s *SQLiteStore) QueryFleet(gpuIDs []string, q Query) ([]model.Telemetry, error) {
+	if q.Step > 0 {
+		out, err := s.downsample(gpuIDs, q)
+		if err != nil {
+			return nil, err
+		}
+		return Page(out, q.Desc, q.Offset, q.Limit), nil
+	}
+	where, args := s.where(gpuIDs, q)
+	// only the requested keys leave the database
+	metrics, sel := s.metricsColumn(q.Metrics, nil)
+	args = append(sel, args...)
+	stmt := `SELECT gpu_id, ts, ` + metrics + `, host_id, producer_id, labels, typed_values FROM telemetry` + where
+	if q.Desc {
+		stmt += ` ORDER BY ts DESC, gpu_id DESC, rowid DESC`
+	} else {
+		stmt += ` ORDER BY ts ASC, gpu_id ASC, rowid ASC`
 	}
-	if end != nil {
-		q += ` AND ts <= ?`
-		args = append(args, end.Unix())
+	if q.Limit > 0 || q.Offset > 0 {
+		limit := q.Limit
+		if limit <= 0 {
+			limit = -1 // SQLite: no limit
+		}
+		stmt += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, q.Offset)
 	}
-	q += ` ORDER BY ts ASC`
-	rows, err := s.db.Query(q, args...)
+	out, err := s.queryRows(stmt, args)
 	if err != nil {
 		return nil, fmt.Errorf("query telemetry: %w", err)
 	}
+	if len(q.Metrics) > 0 {
+		for i := range out {
+			out[i].Values = keepValues(out[i].Values, q.Metrics)
+		}
+	}
+	return out, nil
+}
+
+// queryRows runs a query selecting gpu_id, ts, metrics, host_id,
+// producer_id, labels and typed_values, in that order, and decodes the rows.
+func (s *SQLiteStore) queryRows(stmt string, args []any) ([]model.Telemetry, error) {
+	rows, err := s.db.QueryContext(s.callCtx(), stmt, args...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 	var out []model.Telemetry
 	for rows.Next() {
 		var ts int64
-		var mjson string
-		if err := rows.Scan(&ts, &mjson); err != nil {
+		var gpuID, mjson, hostID, producerID string
+		var ljson, vjson sql.NullString
+		if err := rows.Scan(&gpuID, &ts, &mjson, &hostID, &producerID, &ljson, &vjson); err != nil {
 			return nil, err
 		}
 		m := map[string]float64{}
 		if err := json.Unmarshal([]byte(mjson), &m); err != nil {
 			return nil, fmt.Errorf("unmarshal metrics: %w", err)
 		}
-		out = append(out, model.Telemetry{GPUId: gpuID, Timestamp: time.Unix(ts, 0).UTC(), Metrics: m})
+		var labels map[string]string
+		if ljson.Valid {
+			if err := json.Unmarshal([]byte(ljson.String), &labels); err != nil {
+				return nil, fmt.Errorf("unmarshal labels: %w", err)
+			}
+		}
+		var values map[string]model.Value
+		if vjson.Valid {
+			if err := json.Unmarshal([]byte(vjson.String), &values); err != nil {
+				return nil, fmt.Errorf("unmarshal values: %w", err)
+			}
+		}
+		out = append(out, model.Telemetry{GPUId: gpuID, HostId: hostID, ProducerId: producerID, Timestamp: time.Unix(ts, 0).UTC(), Metrics: m, Labels: labels, Values: values})
+	}
+	return out, rows.Err()
+}
+
+// sqliteLatestChunk caps the GPUs of one QueryLatest statement, keeping its
+// variables under SQLite's default limit of 999 with room for a scope.
+const sqliteLatestChunk = 500
+
+// QueryLatest picks each GPU's MAX(ts) row with the (gpu_id, ts) index,
+// relying on SQLite taking bare columns from that row.
+func (s *SQLiteStore) QueryLatest(gpuIDs []string, sc *Scope) (map[string]*model.Telemetry, error) {
+	out := make(map[string]*model.Telemetry, len(gpuIDs))
+	for len(gpuIDs) > 0 {
+		chunk := gpuIDs[:min(len(gpuIDs), sqliteLatestChunk)]
+		gpuIDs = gpuIDs[len(chunk):]
+		where, args := s.where(chunk, Query{Scope: sc})
+		metrics, _ := s.metricsColumn(nil, nil)
+		items, err := s.queryRows(`SELECT gpu_id, MAX(ts), `+metrics+`, host_id, producer_id, labels, typed_values FROM telemetry`+where+` GROUP BY gpu_id`, args)
+		if err != nil {
+			return nil, fmt.Errorf("query latest telemetry: %w", err)
+		}
+		for i := range items {
+			out[items[i].GPUId] = &items[i]
+		}
+	}
+	return out, nil
+}
+
+// downsample averages each metric per GPU and step-wide bucket in SQL.
+// Timestamps are stored in whole seconds, so the step is rounded up to one.
+func (s *SQLiteStore) downsample(gpuIDs []string, q Query) ([]model.Telemetry, error) {
+	sec := int64((q.Step + time.Second - 1) / time.Second)
+	if sec < 1 {
+		sec = 1
+	}
+	where, args := s.where(gpuIDs, q)
+	stmt := `SELECT gpu_id, ts - (ts % ?) AS bucket, m.key, AVG(m.value) FROM ` + s.valuesFrom() + where
+	args = append([]any{sec}, args...)
+	if len(q.Metrics) > 0 {
+		var in string
+		in, args = sqliteIn(`m.key`, q.Metrics, args)
+		stmt += ` AND ` + in
+	}
+	stmt += ` GROUP BY bucket, gpu_id, m.key ORDER BY bucket ASC, gpu_id ASC`
+	rows, err := s.db.QueryContext(s.callCtx(), stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query downsampled telemetry: %w", err)
+	}
+	defer rows.Close()
+	var out []model.Telemetry
+	for rows.Next() {
+		var gpuID, key string
+		var bucket int64
+		var avg float64
+		if err := rows.Scan(&gpuID, &bucket, &key, &avg); err != nil {
+			return nil, err
+		}
+		if n := len(out); n == 0 || out[n-1].Timestamp.Unix() != bucket || out[n-1].GPUId != gpuID {
+			out = append(out, model.Telemetry{GPUId: gpuID, Timestamp: time.Unix(bucket, 0).UTC(), Metrics: map[string]float64{}})
+		}
+		out[len(out)-1].Metrics[key] = avg
+	}
+	return out, rows.Err()
+}
+
+// TopGPUs aggregates the metric per GPU in SQL. For AggLast it relies on
+// SQLite returning the other columns of the MAX(ts) row.
+func (s *SQLiteStore) TopGPUs(q TopQuery) ([]GPUValue, error) {
+	agg := map[string]string{AggAvg: "AVG(m.value)", AggMax: "MAX(m.value)", AggMin: "MIN(m.value)", AggLast: "m.value, MAX(ts)"}[q.Agg]
+	if agg == "" {
+		return nil, fmt.Errorf("unknown aggregation %q", q.Agg)
+	}
+	where, args := s.where(nil, Query{Start: q.Start, End: q.End, Scope: q.Scope})
+	stmt := `SELECT gpu_id, ` + agg + ` FROM ` + s.valuesFrom() + where + ` AND m.key = ? GROUP BY gpu_id`
+	rows, err := s.db.QueryContext(s.callCtx(), stmt, append(args, q.Metric)...)
+	if err != nil {
+		return nil, fmt.Errorf("query top gpus: %w", err)
+	}
+	defer rows.Close()
+	var out []GPUValue
+	for rows.Next() {
+		var v GPUValue
+		dest := []any{&v.GPUId, &v.Value}
+		if q.Agg == AggLast {
+			var ts int64
+			dest = append(dest, &ts)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return RankValues(out, q.Asc, q.N), nil
+}
+
+// AggregateTelemetry groups the metric by bucket in SQL. As for Query.Step,
+// the step is rounded up to whole seconds, and AggLast relies on SQLite
+// taking bare columns from the MAX(ts) row.
+func (s *SQLiteStore) AggregateTelemetry(gpuID string, q AggregateQuery) ([]Bucket, error) {
+	agg := map[string]string{AggAvg: "AVG(m.value)", AggMax: "MAX(m.value)", AggMin: "MIN(m.value)", AggLast: "m.value, MAX(ts)"}[q.Agg]
+	if agg == "" {
+		return nil, fmt.Errorf("unknown aggregation %q", q.Agg)
+	}
+	sec := int64((q.Step + time.Second - 1) / time.Second)
+	if sec < 1 {
+		sec = 1
+	}
+	where, args := s.where([]string{gpuID}, Query{Start: q.Start, End: q.End, Scope: q.Scope})
+	stmt := `SELECT ts - (ts % ?) AS bucket, ` + agg + ` FROM ` + s.valuesFrom() + where + ` AND m.key = ? GROUP BY bucket ORDER BY bucket ASC`
+	args = append(append([]any{sec}, args...), q.Metric)
+	rows, err := s.db.QueryContext(s.callCtx(), stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query aggregated telemetry: %w", err)
+	}
+	defer rows.Close()
+	var out []Bucket
+	for rows.Next() {
+		var bucket, ts int64
+		var b Bucket
+		dest := []any{&bucket, &b.Value}
+		if q.Agg == AggLast {
+			dest = append(dest, &ts)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		b.Timestamp = time.Unix(bucket, 0).UTC()
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// SummarizeTelemetry summarizes each metric in SQL. The p95 is picked by
+// rank with a window function; the variance comes from the mean of squares.
+func (s *SQLiteStore) SummarizeTelemetry(gpuID string, q Query) (map[string]MetricSummary, error) {
+	where, args := s.where([]string{gpuID}, q)
+	if len(q.Metrics) > 0 {
+		var in string
+		in, args = sqliteIn(`m.key`, q.Metrics, args)
+		where += ` AND ` + in
+	}
+	stmt := `WITH v AS (SELECT m.key AS key, m.value AS value FROM ` + s.valuesFrom() + where + `),
+s AS (SELECT key, COUNT(*) AS n, MIN(value) AS lo, MAX(value) AS hi, AVG(value) AS mean, AVG(value * value) AS sq FROM v GROUP BY key),
+r AS (SELECT key, value, ROW_NUMBER() OVER (PARTITION BY key ORDER BY value) AS rn FROM v)
+SELECT s.key, s.n, s.lo, s.hi, s.mean, s.sq, r.value FROM s JOIN r ON r.key = s.key AND r.rn = (95 * s.n + 99) / 100`
+	rows, err := s.db.QueryContext(s.callCtx(), stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query telemetry summary: %w", err)
+	}
+	defer rows.Close()
+	out := map[string]MetricSummary{}
+	for rows.Next() {
+		var key string
+		var sum MetricSummary
+		var sq float64
+		if err := rows.Scan(&key, &sum.Count, &sum.Min, &sum.Max, &sum.Mean, &sq, &sum.P95); err != nil {
+			return nil, err
+		}
+		sum.StdDev = math.Sqrt(math.Max(sq-sum.Mean*sum.Mean, 0)) // rounding can dip below 0
+		out[key] = sum
+	}
+	return out, rows.Err()
+}
+
+// ListMetrics groups the values of the GPUs by metric in SQL; first and last
+// seen have the store's one-second resolution.
+func (s *SQLiteStore) ListMetrics(gpuIDs []string, q Query) (map[string][]MetricInfo, error) {
+	where, args := s.where(gpuIDs, q)
+	if len(q.Metrics) > 0 {
+		var in string
+		in, args = sqliteIn(`m.key`, q.Metrics, args)
+		where += ` AND ` + in
+	}
+	stmt := `SELECT gpu_id, m.key, MIN(ts), MAX(ts), COUNT(*) FROM ` + s.valuesFrom() + where + ` GROUP BY gpu_id, m.key ORDER BY gpu_id, m.key`
+	rows, err := s.db.QueryContext(s.callCtx(), stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query telemetry metrics: %w", err)
+	}
+	defer rows.Close()
+	out := map[string][]MetricInfo{}
+	for rows.Next() {
+		var gpuID string
+		var first, last int64
+		var mi MetricInfo
+		if err := rows.Scan(&gpuID, &mi.Name, &first, &last, &mi.Samples); err != nil {
+			return nil, err
+		}
+		mi.FirstSeen, mi.LastSeen = time.Unix(first, 0).UTC(), time.Unix(last, 0).UTC()
+		out[gpuID] = append(out[gpuID], mi)
+	}
+	return out, rows.Err()
+}
+
+// DeleteTelemetry works at the store's one-second resolution: before is
+// rounded down to the second.
+func (s *SQLiteStore) DeleteTelemetry(gpuID string, before time.Time) (int64, error) {
+	where, args := sqliteDeleteWhere(gpuID, before)
+	ctx := s.callCtx()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite delete telemetry: %w", err)
+	}
+	defer tx.Rollback()
+	if s.normalized {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM telemetry_values`+where, args...); err != nil {
+			return 0, fmt.Errorf("sqlite delete telemetry: %w", err)
+		}
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM telemetry`+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite delete telemetry: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("sqlite delete telemetry: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// sqliteDeleteWhere selects the points of gpuID ("" for all) before before
+// (any time when zero). telemetry_values copies gpu_id and ts, so the
+// condition fits both tables.
+func sqliteDeleteWhere(gpuID string, before time.Time) (string, []any) {
+	where, args := ` WHERE 1 = 1`, []any{}
+	if gpuID != "" {
+		where += ` AND gpu_id = ?`
+		args = append(args, gpuID)
+	}
+	if !before.IsZero() {
+		where += ` AND ts < ?`
+		args = append(args, before.Unix())
+	}
+	return where, args
+}
+
+// DeleteMetrics works at the store's one-second resolution, like
+// DeleteTelemetry. Points left without metrics or typed values are deleted
+// first, while their values still show which ones those are.
+func (s *SQLiteStore) DeleteMetrics(gpuID string, metrics []string, before time.Time) (int64, error) {
+	if len(metrics) == 0 {
+		return 0, nil
+	}
+	where, args := sqliteDeleteWhere(gpuID, before)
+	cat := func(parts ...[]any) []any {
+		var out []any
+		for _, p := range parts {
+			out = append(out, p...)
+		}
+		return out
+	}
+	ctx := s.callCtx()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite delete metrics: %w", err)
+	}
+	defer tx.Rollback()
+	var n int64
+	if s.normalized {
+		in, inArgs := sqliteIn(`metric`, metrics, nil)
+		_, err := tx.ExecContext(ctx, `DELETE FROM telemetry`+where+` AND rowid IN (SELECT point FROM telemetry_values`+where+` AND `+in+`)
+AND NOT EXISTS (SELECT 1 FROM telemetry_values v WHERE v.point = telemetry.rowid AND NOT v.`+in+`) AND typed_values IS NULL`, cat(args, args, inArgs, inArgs)...)
+		if err != nil {
+			return 0, fmt.Errorf("sqlite delete metrics: %w", err)
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM telemetry_values`+where+` AND `+in, cat(args, inArgs)...)
+		if err != nil {
+			return 0, fmt.Errorf("sqlite delete metrics: %w", err)
+		}
+		n, _ = res.RowsAffected()
+	} else {
+		// json_remove keeps the other values' text, so they do not lose digits
+		paths := make([]any, len(metrics))
+		for i, m := range metrics {
+			if strings.ContainsRune(m, '"') {
+				return 0, fmt.Errorf("sqlite delete metrics: metric name %q contains a quote", m)
+			}
+			paths[i] = `$."` + m + `"`
+		}
+		in, inArgs := sqliteIn(`key`, metrics, nil)
+		holds := ` AND EXISTS (SELECT 1 FROM json_each(telemetry.metrics) WHERE ` + in + `)`
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM telemetry, json_each(telemetry.metrics)`+where+` AND `+in,
+			cat(args, inArgs)...).Scan(&n); err != nil {
+			return 0, fmt.Errorf("sqlite delete metrics: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM telemetry`+where+holds+`
+AND NOT EXISTS (SELECT 1 FROM json_each(telemetry.metrics) WHERE NOT `+in+`) AND typed_values IS NULL`, cat(args, inArgs, inArgs)...); err != nil {
+			return 0, fmt.Errorf("sqlite delete metrics: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE telemetry SET metrics = json_remove(metrics`+strings.Repeat(`, ?`, len(paths))+`)`+where+holds,
+			cat(paths, args, inArgs)...); err != nil {
+			return 0, fmt.Errorf("sqlite delete metrics: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("sqlite delete metrics: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLiteStore) SaveRule(id string, doc []byte) error { return s.saveDoc("alert_rules", id, doc) }
+
+func (s *SQLiteStore) DeleteRule(id string) (bool, error) { return s.deleteDoc("alert_rules", id) }
+
+func (s *SQLiteStore) ListRules() (map[string][]byte, error) { return s.listDocs("alert_rules") }
+
+func (s *SQLiteStore) SaveWebhook(id string, doc []byte) error { return s.saveDoc("webhooks", id, doc) }
+
+func (s *SQLiteStore) DeleteWebhook(id string) (bool, error) { return s.deleteDoc("webhooks", id) }
+
+func (s *SQLiteStore) ListWebhooks() (map[string][]byte, error) { return s.listDocs("webhooks") }
+
+func (s *SQLiteStore) SaveGPUInfo(gpuID string, doc []byte) error {
+	return s.saveDoc("gpu_inventory", gpuID, doc)
+}
+
+func (s *SQLiteStore) ListGPUInfo() (map[string][]byte, error) { return s.listDocs("gpu_inventory") }
+
+// saveDoc, deleteDoc and listDocs work on the (id, doc) tables of opaque
+// JSON documents.
+func (s *SQLiteStore) saveDoc(table, id string, doc []byte) error {
+	_, err := s.db.ExecContext(s.callCtx(), `INSERT INTO `+table+`(id, doc, updated_at) VALUES(?, ?, ?)
+ON CONFLICT(id) DO UPDATE SET doc = excluded.doc, updated_at = excluded.updated_at`, id, string(doc), time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("sqlite save into %s: %w", table, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) deleteDoc(table, id string) (bool, error) {
+	res, err := s.db.ExecContext(s.callCtx(), `DELETE FROM `+table+` WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("sqlite delete from %s: %w", table, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *SQLiteStore) listDocs(table string) (map[string][]byte, error) {
+	rows, err := s.db.QueryContext(s.callCtx(), `SELECT id, doc FROM `+table)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite list %s: %w", table, err)
+	}
+	defer rows.Close()
+	out := map[string][]byte{}
+	for rows.Next() {
+		var id, doc string
+		if err := rows.Scan(&id, &doc); err != nil {
+			return nil, fmt.Errorf("sqlite list %s: %w", table, err)
+		}
+		out[id] = []byte(doc)
 	}
 	return out, rows.Err()
 }
@@ -0,0 +1,915 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+func TestSQLiteStore_SaveAndQuery(t *testing.T) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+	for i := 0; i < 3; i++ {
+		if err := st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Duration(i) * time.Second), Metrics: map[string]float64{"temp": float64(60 + i)}}); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	start, end := t0.Add(time.Second), t0.Add(2*time.Second)
+	out, err := st.QueryTelemetry("g1", &start, &end)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(out) != 2 || out[0].Metrics["temp"] != 61 {
+		t.Fatalf("unexpected rows: %#v", out)
+	}
+}
+
+func TestSQLiteStore_IdempotencyKeyUpsert(t *testing.T) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: now, Metrics: map[string]float64{"temp": 1}, IdempotencyKey: "p1-42"}); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	// rows without a key are never deduplicated
+	_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: now, Metrics: map[string]float64{"temp": 2}})
+	_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: now, Metrics: map[string]float64{"temp": 2}})
+	out, err := st.QueryTelemetry("g1", nil, nil)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("want 3 rows, got %d", len(out))
+	}
+}
+
+func TestSQLiteStore_HostAndProducer(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "t.db")
+	// a database created by an older version without the host/producer/key columns
+	old, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := old.Exec(`CREATE TABLE telemetry (gpu_id TEXT NOT NULL, ts INTEGER NOT NULL, metrics TEXT NOT NULL)`); err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+	_ = old.Close()
+
+	st, err := NewSQLiteStore(dsn)
+	if err != nil {
+		t.Fatalf("open with migration: %v", err)
+	}
+	if err := st.SaveTelemetry(model.Telemetry{GPUId: "g1", HostId: "node-1", ProducerId: "streamer-1", Timestamp: time.Now(), Metrics: map[string]float64{}}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	out, err := st.QueryTelemetry("g1", nil, nil)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(out) != 1 || out[0].HostId != "node-1" || out[0].ProducerId != "streamer-1" {
+		t.Fatalf("unexpected rows: %#v", out)
+	}
+}
+
+func TestSQLiteStore_BatchPartialFailure(t *testing.T) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+	items := []model.Telemetry{
+		{GPUId: "g1", Timestamp: t0, Metrics: map[string]float64{"temp": 60}},
+		{GPUId: "g1", Timestamp: t0.Add(time.Second), Metrics: map[string]float64{"temp": math.NaN()}}, // not JSON-encodable
+		{GPUId: "g1", Timestamp: t0.Add(2 * time.Second), Metrics: map[string]float64{"temp": 62}},
+	}
+	err = st.SaveTelemetryBatch(items)
+	failed := FailedItems(err, len(items))
+	if _, ok := failed[1]; len(failed) != 1 || !ok {
+		t.Fatalf("expected only item 1 to fail, got %v", err)
+	}
+	out, err := st.QueryTelemetry("g1", nil, nil)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("expected the 2 good items committed, got %d", len(out))
+	}
+}
+
+func TestSQLiteStore_BatchAcrossStatements(t *testing.T) {
+	// Scenario: a batch of 250 points, more than one multi-row INSERT holds,
+	// repeating an idempotency key and with a bad point in the second statement
+	// Expect: only the bad point fails; the duplicate is stored once
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+	items := make([]model.Telemetry, 250)
+	for i := range items {
+		items[i] = model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Duration(i) * time.Second), Metrics: map[string]float64{"temp": float64(i)}}
+	}
+	items[10].IdempotencyKey, items[200].IdempotencyKey = "k", "k"
+	items[170].Metrics["temp"] = math.Inf(1)
+	err = st.SaveTelemetryBatch(items)
+	failed := FailedItems(err, len(items))
+	if _, ok := failed[170]; len(failed) != 1 || !ok {
+		t.Fatalf("expected only item 170 to fail, got %v", err)
+	}
+	out, err := st.QueryTelemetry("g1", nil, nil)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(out) != 248 {
+		t.Fatalf("expected 248 rows, got %d", len(out))
+	}
+}
+
+func TestSQLiteStore_Downsampled(t *testing.T) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	// 6 points 20s apart: buckets [0,60) -> 60,61,62 and [60,120) -> 63,64,65; power only in the first
+	t0 := time.Unix(1700000040, 0).UTC() // multiple of 60
+	for i := 0; i < 6; i++ {
+		m := map[string]float64{"temp": float64(60 + i)}
+		if i == 0 {
+			m["power"] = 300
+		}
+		if err := st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Duration(i*20) * time.Second), Metrics: m}); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	out, err := st.(Querier).QueryTelemetryWith("g1", Query{Step: time.Minute})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(out) != 2 || !out[0].Timestamp.Equal(t0) || !out[1].Timestamp.Equal(t0.Add(time.Minute)) {
+		t.Fatalf("unexpected buckets: %#v", out)
+	}
+	if out[0].Metrics["temp"] != 61 || out[0].Metrics["power"] != 300 || out[1].Metrics["temp"] != 64 {
+		t.Fatalf("unexpected means: %#v", out)
+	}
+	if _, ok := out[1].Metrics["power"]; ok {
+		t.Fatalf("bucket without power samples has power: %#v", out[1])
+	}
+}
+
+func TestSQLiteStore_QueryPage(t *testing.T) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+	for i := 0; i < 5; i++ {
+		if err := st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Duration(i) * time.Second), Metrics: map[string]float64{"temp": float64(i)}}); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	out, err := st.(Querier).QueryTelemetryWith("g1", Query{Desc: true, Offset: 1, Limit: 2})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(out) != 2 || out[0].Metrics["temp"] != 3 || out[1].Metrics["temp"] != 2 {
+		t.Fatalf("unexpected page: %#v", out)
+	}
+	rest, err := st.(Querier).QueryTelemetryWith("g1", Query{Offset: 3})
+	if err != nil || len(rest) != 2 || rest[0].Metrics["temp"] != 3 {
+		t.Fatalf("offset without limit: %#v %v", rest, err)
+	}
+}
+
+func TestSQLiteStore_MetricFilter(t *testing.T) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+	// odd points carry only util; the filter must skip them before the limit applies
+	for i := 0; i < 6; i++ {
+		m := map[string]float64{"util": float64(i)}
+		if i%2 == 0 {
+			m["temp"], m["power"] = float64(60+i), 300
+		}
+		if err := st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Duration(i) * time.Second), Metrics: m}); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	out, err := st.(Querier).QueryTelemetryWith("g1", Query{Metrics: []string{"temp"}, Limit: 2})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(out) != 2 || len(out[0].Metrics) != 1 || out[0].Metrics["temp"] != 60 || out[1].Metrics["temp"] != 62 {
+		t.Fatalf("unexpected rows: %#v", out)
+	}
+	ds, err := st.(Querier).QueryTelemetryWith("g1", Query{Metrics: []string{"temp", "util"}, Step: time.Hour})
+	if err != nil {
+		t.Fatalf("downsample: %v", err)
+	}
+	if len(ds) != 1 || len(ds[0].Metrics) != 2 || ds[0].Metrics["util"] != 2.5 {
+		t.Fatalf("unexpected buckets: %#v", ds)
+	}
+}
+
+func TestSQLiteStore_QueryFleet(t *testing.T) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+	for i, id := range []string{"g2", "g1", "g3"} {
+		host := "h1"
+		if id == "g3" {
+			host = "h2"
+		}
+		for j := 0; j < 2; j++ {
+			if err := st.SaveTelemetry(model.Telemetry{GPUId: id, HostId: host, Timestamp: t0.Add(time.Duration(j) * time.Second), Metrics: map[string]float64{"temp": float64(10*i + j)}}); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+		}
+	}
+	fq := st.(FleetQuerier)
+	out, err := fq.QueryFleet([]string{"g1", "g2"}, Query{})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	var ids []string
+	for _, it := range out {
+		ids = append(ids, it.GPUId)
+	}
+	if strings.Join(ids, ",") != "g1,g2,g1,g2" {
+		t.Fatalf("unexpected order: %v", ids)
+	}
+	out, err = fq.QueryFleet(nil, Query{HostIDs: []string{"h2"}, Step: time.Minute})
+	if err != nil {
+		t.Fatalf("downsample: %v", err)
+	}
+	if len(out) != 1 || out[0].GPUId != "g3" || out[0].Metrics["temp"] != 20.5 {
+		t.Fatalf("unexpected buckets: %#v", out)
+	}
+}
+
+func TestLatest_GenericPath(t *testing.T) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if it, err := Latest(st, "g1"); err != nil || it != nil {
+		t.Fatalf("empty store: %v %v", it, err)
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+	for _, d := range []int{2, 0, 1} {
+		if err := st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Duration(d) * time.Second), Metrics: map[string]float64{"temp": float64(d)}}); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	it, err := Latest(st, "g1")
+	if err != nil || it == nil || it.Metrics["temp"] != 2 {
+		t.Fatalf("latest: %#v %v", it, err)
+	}
+}
+
+func TestSQLiteStore_TopGPUs(t *testing.T) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+	for _, p := range []struct {
+		id   string
+		sec  int
+		temp float64
+	}{{"a", 0, 90}, {"a", 1, 50}, {"b", 0, 60}, {"b", 1, 70}, {"c", 1, 65}} {
+		if err := st.SaveTelemetry(model.Telemetry{GPUId: p.id, Timestamp: t0.Add(time.Duration(p.sec) * time.Second), Metrics: map[string]float64{"temp": p.temp, "util": 1}}); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	for agg, want := range map[string]string{AggAvg: "a=70,b=65,c=65", AggMax: "a=90,b=70,c=65", AggMin: "c=65,b=60,a=50", AggLast: "b=70,c=65,a=50"} {
+		got, err := Top(st, TopQuery{Metric: "temp", Agg: agg})
+		if err != nil {
+			t.Fatalf("%s: %v", agg, err)
+		}
+		var parts []string
+		for _, v := range got {
+			parts = append(parts, fmt.Sprintf("%s=%g", v.GPUId, v.Value))
+		}
+		if s := strings.Join(parts, ","); s != want {
+			t.Fatalf("%s: got %s, want %s", agg, s, want)
+		}
+	}
+}
+
+func TestSQLiteStore_SummarizeMatchesGeneric(t *testing.T) {
+	// Scenario: temp 1..20 and a constant util for one GPU, plus another GPU,
+	// summarized in SQL and by the generic path over a memory store
+	// Expect: identical summaries (p95 is the 19th of 20 values), only the
+	// asked-for metrics when filtered, and nothing outside the window
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	mem := NewMemoryStore()
+	t0 := time.Unix(1700000000, 0).UTC()
+	for i := 1; i <= 20; i++ {
+		for _, s := range []Store{st, mem} {
+			_ = s.SaveTelemetry(model.Telemetry{GPUId: "a", Timestamp: t0.Add(time.Duration(i) * time.Second), Metrics: map[string]float64{"temp": float64(21 - i), "util": 7}})
+			_ = s.SaveTelemetry(model.Telemetry{GPUId: "b", Timestamp: t0.Add(time.Duration(i) * time.Second), Metrics: map[string]float64{"temp": 99}})
+		}
+	}
+	want := MetricSummary{Count: 20, Min: 1, Max: 20, Mean: 10.5, StdDev: math.Sqrt(33.25), P95: 19}
+	for name, s := range map[string]Store{"sqlite": st, "generic": mem} {
+		got, err := Summarize(s, "a", Query{})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		temp := got["temp"]
+		if len(got) != 2 || temp.Count != want.Count || temp.Min != want.Min || temp.Max != want.Max || temp.P95 != want.P95 ||
+			math.Abs(temp.Mean-want.Mean) > 1e-9 || math.Abs(temp.StdDev-want.StdDev) > 1e-9 {
+			t.Fatalf("%s: got %+v, want temp %+v", name, got, want)
+		}
+		if u := got["util"]; u.Count != 20 || u.StdDev != 0 || u.P95 != 7 {
+			t.Fatalf("%s util: %+v", name, u)
+		}
+		if got, _ := Summarize(s, "a", Query{Metrics: []string{"util"}}); len(got) != 1 || got["util"].Count != 20 {
+			t.Fatalf("%s filtered: %+v", name, got)
+		}
+		late := t0.Add(time.Hour)
+		if got, _ := Summarize(s, "a", Query{Start: &late}); len(got) != 0 {
+			t.Fatalf("%s outside window: %+v", name, got)
+		}
+	}
+}
+
+func TestSQLiteStore_AggregateMatchesGeneric(t *testing.T) {
+	// Scenario: temp 0..9 for one GPU 20s apart from a minute boundary, util
+	// in between and another GPU, aggregated per minute in SQL and by the
+	// generic path over a memory store, with each aggregation
+	// Expect: identical buckets 0-2, 3-5, 6-8 and 9; nothing for a window
+	// without points
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	mem := NewMemoryStore()
+	t0 := time.Unix(1700000040, 0).UTC() // multiple of 60
+	for i := 0; i < 10; i++ {
+		for _, s := range []Store{st, mem} {
+			ts := t0.Add(time.Duration(i*20) * time.Second)
+			_ = s.SaveTelemetry(model.Telemetry{GPUId: "a", Timestamp: ts, Metrics: map[string]float64{"temp": float64(i)}})
+			_ = s.SaveTelemetry(model.Telemetry{GPUId: "a", Timestamp: ts.Add(time.Second), Metrics: map[string]float64{"util": 50}})
+			_ = s.SaveTelemetry(model.Telemetry{GPUId: "b", Timestamp: ts, Metrics: map[string]float64{"temp": 99}})
+		}
+	}
+	want := map[string][]float64{AggAvg: {1, 4, 7, 9}, AggMax: {2, 5, 8, 9}, AggMin: {0, 3, 6, 9}, AggLast: {2, 5, 8, 9}}
+	for name, s := range map[string]Store{"sqlite": st, "generic": mem} {
+		for agg, vals := range want {
+			got, err := Aggregate(s, "a", AggregateQuery{Metric: "temp", Step: time.Minute, Agg: agg})
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, agg, err)
+			}
+			if len(got) != len(vals) {
+				t.Fatalf("%s %s: got %+v, want %v", name, agg, got, vals)
+			}
+			for i, b := range got {
+				if !b.Timestamp.Equal(t0.Add(time.Duration(i)*time.Minute)) || b.Value != vals[i] {
+					t.Fatalf("%s %s: got %+v, want %v", name, agg, got, vals)
+				}
+			}
+		}
+		late := t0.Add(time.Hour)
+		if got, _ := Aggregate(s, "a", AggregateQuery{Metric: "temp", Step: time.Minute, Start: &late}); len(got) != 0 {
+			t.Fatalf("%s outside window: %+v", name, got)
+		}
+	}
+}
+
+func TestSQLiteStore_QueryLatest(t *testing.T) {
+	// Scenario: three points per GPU for two GPUs, the newest of g1 on
+	// another host, looked up in SQL and by the memory store's tail lookup
+	// Expect: each GPU's newest point with its host and labels; a GPU without
+	// data is absent; no GPUs asks nothing
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	mem := NewMemoryStore()
+	t0 := time.Unix(1700000000, 0).UTC()
+	for i := 0; i < 3; i++ {
+		for _, s := range []Store{st, mem} {
+			host := "h1"
+			if i == 2 {
+				host = "h2"
+			}
+			_ = s.SaveTelemetry(model.Telemetry{GPUId: "g1", HostId: host, Timestamp: t0.Add(time.Duration(i) * time.Second), Metrics: map[string]float64{"temp": float64(i)}})
+			_ = s.SaveTelemetry(model.Telemetry{GPUId: "g2", Timestamp: t0.Add(time.Duration(10-i) * time.Second), Metrics: map[string]float64{"temp": float64(10 - i)}, Labels: map[string]string{"cluster": "c1"}})
+		}
+	}
+	for name, s := range map[string]Store{"sqlite": st, "memory": mem} {
+		got, err := LatestMany(s, []string{"g1", "g2", "g9"}, nil)
+		if err != nil || len(got) != 2 {
+			t.Fatalf("%s: %v %v", name, got, err)
+		}
+		if g1 := got["g1"]; g1.HostId != "h2" || g1.Metrics["temp"] != 2 || !g1.Timestamp.Equal(t0.Add(2*time.Second)) {
+			t.Fatalf("%s g1: %+v", name, g1)
+		}
+		if g2 := got["g2"]; g2.Metrics["temp"] != 10 || g2.Labels["cluster"] != "c1" {
+			t.Fatalf("%s g2: %+v", name, g2)
+		}
+		if got, err := LatestMany(s, nil, nil); err != nil || len(got) != 0 {
+			t.Fatalf("%s none: %v %v", name, got, err)
+		}
+		// within h1 only, g1's newest point is the one before it moved
+		if got, _ := LatestMany(s, []string{"g1", "g2"}, &Scope{HostIDs: []string{"h1"}}); len(got) != 1 || got["g1"].Metrics["temp"] != 1 {
+			t.Fatalf("%s scoped: %v", name, got)
+		}
+	}
+}
+
+// scopeFixture stores g1 on h1 (cluster c1), g2 on h2 (cluster c2) and g3 on
+// h3 without a cluster, one point each.
+func scopeFixture(t *testing.T, st Store) {
+	t.Helper()
+	t0 := time.Unix(1700000000, 0).UTC()
+	for i, p := range []model.Telemetry{
+		{GPUId: "g1", HostId: "h1", Labels: map[string]string{"cluster": "c1"}},
+		{GPUId: "g2", HostId: "h2", Labels: map[string]string{"cluster": "c2", "model": "H100"}},
+		{GPUId: "g3", HostId: "h3"},
+	} {
+		p.Timestamp = t0.Add(time.Duration(i) * time.Second)
+		p.Metrics = map[string]float64{"temp": float64(60 + i)}
+		if err := st.SaveTelemetry(p); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+}
+
+// checkScoped verifies that a view scoped to host h3 or cluster c1 only sees g1 and g3.
+func checkScoped(t *testing.T, st Store) {
+	t.Helper()
+	sc := Scoped(st, Scope{HostIDs: []string{"h3"}, Clusters: []string{"c1"}})
+	ids, err := sc.ListGPUs()
+	if err != nil || strings.Join(ids, ",") != "g1,g3" {
+		t.Fatalf("list: %v %v", ids, err)
+	}
+	if items, err := sc.QueryTelemetry("g2", nil, nil); err != nil || len(items) != 0 {
+		t.Fatalf("foreign gpu visible: %v %v", items, err)
+	}
+	items, err := ExecuteFleet(sc, nil, Query{})
+	if err != nil || len(items) != 2 || items[0].Labels["cluster"] != "c1" {
+		t.Fatalf("fleet: %#v %v", items, err)
+	}
+	if it, err := Latest(sc, "g2"); err != nil || it != nil {
+		t.Fatalf("latest foreign: %v %v", it, err)
+	}
+	latest, err := LatestMany(sc, []string{"g1", "g2", "g3"}, nil)
+	if err != nil || len(latest) != 2 || latest["g1"] == nil || latest["g3"] == nil {
+		t.Fatalf("latest many: %v %v", latest, err)
+	}
+	top, err := Top(sc, TopQuery{Metric: "temp"})
+	if err != nil || len(top) != 2 || top[0].GPUId != "g3" {
+		t.Fatalf("top: %v %v", top, err)
+	}
+	if ids, _ := Scoped(st, Scope{}).ListGPUs(); len(ids) != 0 {
+		t.Fatalf("empty scope sees %v", ids)
+	}
+}
+
+// checkAttributionFilters saves points of g1 from two producers and racks
+// and verifies that queries filtered by producer and labels keep only the
+// matching ones, with their host, producer and labels intact.
+func checkAttributionFilters(t *testing.T, st Store) {
+	t.Helper()
+	t0 := time.Unix(1700000000, 0).UTC()
+	for i, p := range []model.Telemetry{
+		{HostId: "h1", ProducerId: "p1", Labels: map[string]string{"rack": "r1", "pod": "a"}},
+		{HostId: "h1", ProducerId: "p2", Labels: map[string]string{"rack": "r1"}},
+		{HostId: "h2", ProducerId: "p1", Labels: map[string]string{"rack": "r2"}},
+		{HostId: "h2", ProducerId: "p1"},
+	} {
+		p.GPUId, p.Timestamp, p.Metrics = "g1", t0.Add(time.Duration(i)*time.Second), map[string]float64{"temp": float64(60 + i)}
+		if err := st.SaveTelemetry(p); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	items, err := Execute(st, "g1", Query{ProducerIDs: []string{"p1"}, Labels: map[string]string{"rack": "r1"}})
+	if err != nil || len(items) != 1 || items[0].HostId != "h1" || items[0].ProducerId != "p1" || items[0].Labels["pod"] != "a" {
+		t.Fatalf("producer and rack: %#v %v", items, err)
+	}
+	if items, err := Execute(st, "g1", Query{ProducerIDs: []string{"p1"}}); err != nil || len(items) != 3 {
+		t.Fatalf("producer: %#v %v", items, err)
+	}
+	if items, err := ExecuteFleet(st, nil, Query{Labels: map[string]string{"rack": "r1", "pod": "b"}}); err != nil || len(items) != 0 {
+		t.Fatalf("no match: %#v %v", items, err)
+	}
+}
+
+// checkDeleteMetrics saves g1 points at 0s (temp, clock), 10s (clock) and
+// 20s (temp, clock) and g2 at 0s (clock), deletes clock of g1 before 15s,
+// then clock of every GPU, and verifies what is left of each point.
+func checkDeleteMetrics(t *testing.T, st Store) {
+	t.Helper()
+	t0 := time.Unix(1700000000, 0).UTC()
+	for _, p := range []model.Telemetry{
+		{GPUId: "g1", Timestamp: t0, Metrics: map[string]float64{"temp": 60.5, "clock": 1400}},
+		{GPUId: "g1", Timestamp: t0.Add(10 * time.Second), Metrics: map[string]float64{"clock": 1410}},
+		{GPUId: "g1", Timestamp: t0.Add(20 * time.Second), Metrics: map[string]float64{"temp": 62, "clock": 1420}},
+		{GPUId: "g2", Timestamp: t0, Metrics: map[string]float64{"clock": 1300}},
+	} {
+		if err := st.SaveTelemetry(p); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	d := st.(MetricDeleter)
+	if n, err := d.DeleteMetrics("g1", []string{"clock", "fan"}, t0.Add(15*time.Second)); err != nil || n != 2 {
+		t.Fatalf("delete g1: %d %v", n, err)
+	}
+	items, err := st.QueryTelemetry("g1", nil, nil)
+	if err != nil || len(items) != 2 || !reflect.DeepEqual(items[0].Metrics, map[string]float64{"temp": 60.5}) ||
+		items[1].Metrics["clock"] != 1420 {
+		t.Fatalf("g1 after delete: %v %+v", err, items)
+	}
+	if n, err := d.DeleteMetrics("", []string{"clock"}, time.Time{}); err != nil || n != 2 {
+		t.Fatalf("delete all: %d %v", n, err)
+	}
+	if ids, _ := st.ListGPUs(); strings.Join(ids, ",") != "g1" {
+		t.Fatalf("gpus: %v", ids)
+	}
+	if items, _ := st.QueryTelemetry("g1", nil, nil); len(items) != 2 || len(items[1].Metrics) != 1 || items[1].Metrics["temp"] != 62 {
+		t.Fatalf("g1 after delete all: %+v", items)
+	}
+}
+
+func TestSQLiteStore_DeleteMetrics(t *testing.T) {
+	dir := t.TempDir()
+	for _, schema := range []SQLiteSchema{SQLiteJSON, SQLiteNormalized} {
+		st, err := NewSQLiteStoreWith("file:"+filepath.Join(dir, fmt.Sprint(schema, ".db")), SQLiteOptions{Schema: schema})
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		checkDeleteMetrics(t, st)
+	}
+}
+
+// checkTypedValues saves a g1 point with a metric and typed values of every
+// kind and one with typed values only, then reads them back whole, by
+// metric name, and after deleting the metric.
+func checkTypedValues(t *testing.T, st Store) {
+	t.Helper()
+	t0 := time.Unix(1700000000, 0).UTC()
+	full := map[string]model.Value{"pstate": model.StringValue("P0"), "serial": model.IntValue(1<<60 + 1),
+		"ecc": model.BoolValue(true), "ratio": model.FloatValue(2)}
+	for _, p := range []model.Telemetry{
+		{GPUId: "g1", Timestamp: t0, Metrics: map[string]float64{"temp": 60}, Values: full},
+		{GPUId: "g1", Timestamp: t0.Add(time.Second), Metrics: map[string]float64{}, Values: map[string]model.Value{"pstate": model.StringValue("P8")}},
+	} {
+		if err := st.SaveTelemetry(p); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	items, err := st.QueryTelemetry("g1", nil, nil)
+	if err != nil || len(items) != 2 || !reflect.DeepEqual(items[0].Values, full) || items[1].Values["pstate"] != model.StringValue("P8") {
+		t.Fatalf("stored: %+v %v", items, err)
+	}
+	items, err = Execute(st, "g1", Query{Metrics: []string{"pstate"}})
+	if err != nil || len(items) != 2 || len(items[0].Values) != 1 || len(items[0].Metrics) != 0 || items[0].Values["pstate"] != model.StringValue("P0") {
+		t.Fatalf("pstate only: %+v %v", items, err)
+	}
+	if _, err := st.(MetricDeleter).DeleteMetrics("g1", []string{"temp"}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := st.QueryTelemetry("g1", nil, nil); len(items) != 2 || !reflect.DeepEqual(items[0].Values, full) {
+		t.Fatalf("after deleting temp: %+v", items)
+	}
+}
+
+func TestSQLiteStore_TypedValues(t *testing.T) {
+	dir := t.TempDir()
+	for _, schema := range []SQLiteSchema{SQLiteJSON, SQLiteNormalized} {
+		st, err := NewSQLiteStoreWith("file:"+filepath.Join(dir, fmt.Sprint(schema, ".db")), SQLiteOptions{Schema: schema})
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		checkTypedValues(t, st)
+	}
+}
+
+func TestSQLiteStore_FiltersAttribution(t *testing.T) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	checkAttributionFilters(t, st)
+}
+
+func TestSQLiteStore_Scoped(t *testing.T) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	scopeFixture(t, st)
+	items, err := st.QueryTelemetry("g2", nil, nil)
+	if err != nil || len(items) != 1 || items[0].Labels["model"] != "H100" {
+		t.Fatalf("labels not stored: %#v %v", items, err)
+	}
+	checkScoped(t, st)
+}
+
+func TestInventoryStores_KeepLatestDocPerGPU(t *testing.T) {
+	// Scenario: GPU info saved twice for g1 and once for g2 in the memory,
+	// SQLite and bbolt stores
+	// Expect: one document per GPU, the latest one for g1
+	sq, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "t.bolt"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer bolt.Close()
+	for name, st := range map[string]InventoryStore{"memory": NewMemoryStore(), "sqlite": sq.(InventoryStore), "bolt": bolt} {
+		_ = st.SaveGPUInfo("g1", []byte(`{"driver_version":"535"}`))
+		_ = st.SaveGPUInfo("g1", []byte(`{"driver_version":"550"}`))
+		_ = st.SaveGPUInfo("g2", []byte(`{}`))
+		docs, err := st.ListGPUInfo()
+		if err != nil || len(docs) != 2 || string(docs["g1"]) != `{"driver_version":"550"}` {
+			t.Fatalf("%s: %q %v", name, docs, err)
+		}
+	}
+}
+
+func TestSQLiteStore_Rules(t *testing.T) {
+	s, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	st := s.(RuleStore)
+	_ = st.SaveRule("a", []byte(`{"v":1}`))
+	_ = st.SaveRule("a", []byte(`{"v":2}`))
+	_ = st.SaveRule("b", []byte(`{}`))
+	if ok, err := st.DeleteRule("b"); !ok || err != nil {
+		t.Fatalf("delete: %v %v", ok, err)
+	}
+	if ok, _ := st.DeleteRule("b"); ok {
+		t.Fatal("deleted twice")
+	}
+	rules, err := st.ListRules()
+	if err != nil || len(rules) != 1 || string(rules["a"]) != `{"v":2}` {
+		t.Fatalf("unexpected rules: %q %v", rules, err)
+	}
+}
+
+func TestSQLiteStore_WithContextCancels(t *testing.T) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: time.Unix(1700000000, 0), Metrics: map[string]float64{"temp": 1}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := WithContext(ctx, st).ListGPUs(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if ids, err := st.ListGPUs(); err != nil || len(ids) != 1 {
+		t.Fatalf("unbound store: %v %v", ids, err)
+	}
+}
+
+func TestSQLiteStore_DeleteTelemetry(t *testing.T) {
+	// Scenario: two GPUs with points at t0 and t0+1m; delete everything before
+	// t0+1m, then all of g2
+	// Expect: counts 2 and 1; only g1's newer point is left
+	st, err := NewSQLiteStore("file:" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+	for _, id := range []string{"g1", "g2"} {
+		_ = st.SaveTelemetry(model.Telemetry{GPUId: id, Timestamp: t0, Metrics: map[string]float64{"a": 1}})
+		_ = st.SaveTelemetry(model.Telemetry{GPUId: id, Timestamp: t0.Add(time.Minute), Metrics: map[string]float64{"a": 2}})
+	}
+	d := st.(Deleter)
+	if n, err := d.DeleteTelemetry("", t0.Add(time.Minute)); err != nil || n != 2 {
+		t.Fatalf("delete before: %d %v", n, err)
+	}
+	if n, err := d.DeleteTelemetry("g2", time.Time{}); err != nil || n != 1 {
+		t.Fatalf("delete g2: %d %v", n, err)
+	}
+	ids, _ := st.ListGPUs()
+	out, _ := st.QueryTelemetry("g1", nil, nil)
+	if len(ids) != 1 || len(out) != 1 || out[0].Metrics["a"] != 2 {
+		t.Fatalf("left: %v %v", ids, out)
+	}
+}
+
+func TestSQLiteStore_Pragmas(t *testing.T) {
+	// Scenario: one store opened with a plain file DSN, one whose DSN sets
+	// its own busy timeout
+	// Expect: WAL and the default busy timeout on the first; the DSN's
+	// timeout kept on the second, with WAL still added
+	dir := t.TempDir()
+	for dsn, timeout := range map[string]int{
+		"file:" + filepath.Join(dir, "a.db"):                                 5000,
+		"file:" + filepath.Join(dir, "b.db") + "?_pragma=busy_timeout(1234)": 1234,
+	} {
+		st, err := NewSQLiteStore(dsn)
+		if err != nil {
+			t.Fatalf("open %s: %v", dsn, err)
+		}
+		db := st.(*SQLiteStore).db
+		var mode string
+		var busy int
+		if err := db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil || mode != "wal" {
+			t.Fatalf("%s: journal_mode %q %v", dsn, mode, err)
+		}
+		if err := db.QueryRow(`PRAGMA busy_timeout`).Scan(&busy); err != nil || busy != timeout {
+			t.Fatalf("%s: busy_timeout %d %v", dsn, busy, err)
+		}
+	}
+}
+
+// benchmarkSQLiteSave writes b.N points in batches of batch (1 = one
+// SaveTelemetry per point) to a store opened with the DSN's query string.
+func TestSQLiteStore_NormalizedMatchesJSON(t *testing.T) {
+	// Scenario: the same points, with a duplicate by idempotency key and an
+	// unstorable NaN, in a JSON and a normalized store
+	// Expect: every read returns the same in both; deletes count the same
+	// points and leave no metric rows behind
+	dir := t.TempDir()
+	js, err := NewSQLiteStore("file:" + filepath.Join(dir, "json.db"))
+	if err != nil {
+		t.Fatalf("open json: %v", err)
+	}
+	ns, err := NewSQLiteStoreWith("file:"+filepath.Join(dir, "norm.db"), SQLiteOptions{Schema: SQLiteNormalized})
+	if err != nil {
+		t.Fatalf("open normalized: %v", err)
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+	var items []model.Telemetry
+	for i := 0; i < 40; i++ {
+		m := map[string]float64{"temp": float64(60 + i%7), "util": float64(i)}
+		if i%3 == 0 {
+			m["power"] = float64(300 - i)
+		}
+		items = append(items, model.Telemetry{GPUId: fmt.Sprint("g", i%2), HostId: fmt.Sprint("h", i%2), Timestamp: t0.Add(time.Duration(i) * 10 * time.Second),
+			Metrics: m, Labels: map[string]string{"cluster": "c1"}, IdempotencyKey: fmt.Sprint("k", i)})
+	}
+	items = append(items, items[3], model.Telemetry{GPUId: "g0", Timestamp: t0, Metrics: map[string]float64{"temp": math.NaN()}})
+	for name, st := range map[string]Store{"json": js, "normalized": ns} {
+		if failed := FailedItems(st.SaveTelemetryBatch(items), len(items)); len(failed) != 1 || failed[len(items)-1] == nil {
+			t.Fatalf("%s batch: %v", name, failed)
+		}
+	}
+	same := func(what string, read func(Store) (any, error)) {
+		t.Helper()
+		a, errA := read(js)
+		b, errB := read(ns)
+		if errA != nil || errB != nil || fmt.Sprint(a) != fmt.Sprint(b) || fmt.Sprint(a) == "[]" || fmt.Sprint(a) == "map[]" {
+			t.Fatalf("%s:\n json %v %v\n norm %v %v", what, errA, a, errB, b)
+		}
+	}
+	sc := &Scope{Clusters: []string{"c1"}}
+	same("query", func(s Store) (any, error) { return Execute(s, "g0", Query{}) })
+	same("metric filter", func(s Store) (any, error) {
+		return Execute(s, "g1", Query{Metrics: []string{"power"}, Desc: true, Limit: 3})
+	})
+	same("fleet downsampled", func(s Store) (any, error) {
+		return ExecuteFleet(s, nil, Query{Step: time.Minute, Metrics: []string{"temp", "power"}})
+	})
+	same("latest", func(s Store) (any, error) {
+		m, err := LatestMany(s, []string{"g0", "g1"}, sc)
+		return []any{*m["g0"], *m["g1"]}, err
+	})
+	same("top", func(s Store) (any, error) { return Top(s, TopQuery{Metric: "util", Agg: AggLast}) })
+	same("aggregate", func(s Store) (any, error) {
+		return Aggregate(s, "g0", AggregateQuery{Metric: "temp", Agg: AggMax, Step: time.Minute})
+	})
+	same("summary", func(s Store) (any, error) { return Summarize(s, "g1", Query{}) })
+	same("delete", func(s Store) (any, error) { return s.(Deleter).DeleteTelemetry("g0", t0.Add(200*time.Second)) })
+	var left int
+	if err := ns.(*SQLiteStore).db.QueryRow(`SELECT COUNT(*) FROM telemetry_values WHERE gpu_id = 'g0' AND ts < ?`, t0.Add(200*time.Second).Unix()).Scan(&left); err != nil || left != 0 {
+		t.Fatalf("metric rows left: %d %v", left, err)
+	}
+}
+
+func TestSQLiteStore_SchemaMismatch(t *testing.T) {
+	dir := t.TempDir()
+	dsn := "file:" + filepath.Join(dir, "norm.db")
+	if _, err := NewSQLiteStoreWith(dsn, SQLiteOptions{Schema: SQLiteNormalized}); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := NewSQLiteStore(dsn); err == nil {
+		t.Fatal("expected an error opening a normalized database with the JSON schema")
+	}
+	dsn = "file:" + filepath.Join(dir, "json.db")
+	st, _ := NewSQLiteStore(dsn)
+	_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: time.Now(), Metrics: map[string]float64{"temp": 1}})
+	if _, err := NewSQLiteStoreWith(dsn, SQLiteOptions{Schema: SQLiteNormalized}); err == nil {
+		t.Fatal("expected an error normalizing a JSON database with points")
+	}
+}
+
+func benchmarkSQLiteSave(b *testing.B, query string, batch int) {
+	st, err := NewSQLiteStore("file:" + filepath.Join(b.TempDir(), "bench.db") + query)
+	if err != nil {
+		b.Fatalf("open: %v", err)
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+	items := make([]model.Telemetry, 0, batch)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		it := model.Telemetry{GPUId: fmt.Sprint("g", i%8), HostId: "h1", Timestamp: t0.Add(time.Duration(i) * time.Second),
+			Metrics: map[string]float64{"temp": 60, "power": 300, "util": 90}}
+		if batch == 1 {
+			if err := st.SaveTelemetry(it); err != nil {
+				b.Fatal(err)
+			}
+			continue
+		}
+		if items = append(items, it); len(items) == batch || i == b.N-1 {
+			if err := st.SaveTelemetryBatch(items); err != nil {
+				b.Fatal(err)
+			}
+			items = items[:0]
+		}
+	}
+}
+
+// The rollback journal with full sync is SQLite's default, and what stores
+// opened before WAL was enabled used.
+const sqliteDefaultPragmas = "?_pragma=journal_mode(DELETE)&_pragma=synchronous(FULL)"
+
+func BenchmarkSQLiteStore_SaveRowDefault(b *testing.B) {
+	benchmarkSQLiteSave(b, sqliteDefaultPragmas, 1)
+}
+func BenchmarkSQLiteStore_SaveRowWAL(b *testing.B) { benchmarkSQLiteSave(b, "", 1) }
+func BenchmarkSQLiteStore_SaveBatchDefault(b *testing.B) {
+	benchmarkSQLiteSave(b, sqliteDefaultPragmas, 500)
+}
+func BenchmarkSQLiteStore_SaveBatchWAL(b *testing.B) { benchmarkSQLiteSave(b, "", 500) }
+
+func TestSQLiteStore_Upsert(t *testing.T) {
+	// Scenario: in an upsert store of each schema, a point redelivered with
+	// other metrics, a batch holding one point twice, a duplicate by
+	// idempotency key, and another producer's point of the same second;
+	// then the database reopened without upsert, and a database with
+	// duplicates opened with it
+	// Expect: one row per GPU, producer and second holding the last write,
+	// the keyed duplicate skipped; upsert kept on reopening; an error for
+	// the duplicates
+	dir := t.TempDir()
+	t0 := time.Unix(1700000000, 0).UTC()
+	pt := func(producer string, temp float64, key string) model.Telemetry {
+		return model.Telemetry{GPUId: "g1", ProducerId: producer, Timestamp: t0, Metrics: map[string]float64{"temp": temp}, IdempotencyKey: key}
+	}
+	for _, schema := range []SQLiteSchema{SQLiteJSON, SQLiteNormalized} {
+		dsn := "file:" + filepath.Join(dir, fmt.Sprint("upsert", schema, ".db"))
+		st, err := NewSQLiteStoreWith(dsn, SQLiteOptions{Schema: schema, Upsert: true})
+		if err != nil {
+			t.Fatalf("open %d: %v", schema, err)
+		}
+		_ = st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0, Metrics: map[string]float64{"temp": 1, "util": 5}, IdempotencyKey: "k1"})
+		if err := st.SaveTelemetry(pt("", 2, "")); err != nil {
+			t.Fatalf("redeliver %d: %v", schema, err)
+		}
+		if err := st.SaveTelemetryBatch([]model.Telemetry{pt("", 3, ""), pt("", 4, ""), pt("", 9, "k1"), pt("p2", 7, "")}); err != nil {
+			t.Fatalf("batch %d: %v", schema, err)
+		}
+		items, err := st.QueryTelemetry("g1", nil, nil)
+		if err != nil || len(items) != 2 {
+			t.Fatalf("%d: %v %+v", schema, err, items)
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].ProducerId < items[j].ProducerId })
+		if !reflect.DeepEqual(items[0].Metrics, map[string]float64{"temp": 4}) || items[1].Metrics["temp"] != 7 {
+			t.Fatalf("%d: %+v", schema, items)
+		}
+		again, err := NewSQLiteStoreWith(dsn, SQLiteOptions{Schema: schema})
+		if err != nil || !again.(*SQLiteStore).upsert {
+			t.Fatalf("reopen %d: %v", schema, err)
+		}
+	}
+	dsn := "file:" + filepath.Join(dir, "dups.db")
+	st, _ := NewSQLiteStore(dsn)
+	_ = st.SaveTelemetryBatch([]model.Telemetry{pt("", 1, ""), pt("", 2, "")})
+	if _, err := NewSQLiteStoreWith(dsn, SQLiteOptions{Upsert: true}); err == nil {
+		t.Fatal("expected an error enabling upsert on a database with duplicates")
+	}
+}
@@ -1,6 +1,9 @@
 package storage
 
 import (
+	"context"
+	"fmt"
+	"sort"
 	"time"
 
 	"gpu-metric-collector/internal/model"
@@ -8,6 +11,82 @@ import (
 
 type Store interface {
 	SaveTelemetry(t model.Telemetry) error
+	// SaveTelemetryBatch writes items in as few round trips as the backend allows.
+	// When only some items fail the error is a *BatchError naming them; any other
+	// error means none were written.
+	SaveTelemetryBatch(items []model.Telemetry) error
 	ListGPUs() ([]string, error)
 	QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error)
 }
+
+// Pinger is implemented by stores that can check connectivity to their backend.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ContextBinder is implemented by stores whose calls can be bound to a
+// context, so a caller's deadline or cancellation stops a running query.
+type ContextBinder interface {
+	WithContext(ctx context.Context) Store
+}
+
+// WithContext returns s with its calls bound to ctx, or s itself when it
+// cannot be bound.
+func WithContext(ctx context.Context, s Store) Store {
+	if b, ok := s.(ContextBinder); ok {
+		return b.WithContext(ctx)
+	}
+	return s
+}
+
+// BatchError reports the items of a batch that were not written, by index.
+type BatchError struct {
+	Failed map[int]error
+}
+
+func (e *BatchError) Error() string {
+	idx := make([]int, 0, len(e.Failed))
+	for i := range e.Failed {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	if len(idx) == 0 {
+		return "batch: no failures"
+	}
+	return fmt.Sprintf("batch: %d items failed, first at %d: %v", len(idx), idx[0], e.Failed[idx[0]])
+}
+
+// FailedItems maps the error returned by SaveTelemetryBatch for a batch of n
+// items to the failed indexes: none for nil, the listed ones for a *BatchError,
+// and all of them otherwise.
+func FailedItems(err error, n int) map[int]error {
+	if err == nil {
+		return nil
+	}
+	if be, ok := err.(*BatchError); ok {
+		return be.Failed
+	}
+	all := make(map[int]error, n)
+	for i := 0; i < n; i++ {
+		all[i] = err
+	}
+	return all
+}
+
+// SaveEach implements SaveTelemetryBatch for stores without a native batch
+// write by calling save per item.
+func SaveEach(save func(model.Telemetry) error, items []model.Telemetry) error {
+	var failed map[int]error
+	for i, t := range items {
+		if err := save(t); err != nil {
+			if failed == nil {
+				failed = map[int]error{}
+			}
+			failed[i] = err
+		}
+	}
+	if failed != nil {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"math"
+	"sort"
+)
+
+// MetricSummary describes one metric's values over a window. P95 is the
+// nearest-rank 95th percentile: the smallest value that at least 95% of the
+// values do not exceed. StdDev is the population standard deviation.
+type MetricSummary struct {
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	P95    float64 `json:"p95"`
+}
+
+// SummaryQuerier is implemented by stores that can summarize metrics in the
+// backend.
+type SummaryQuerier interface {
+	SummarizeTelemetry(gpuID string, q Query) (map[string]MetricSummary, error)
+}
+
+// Summarize summarizes each metric of gpuID within q's window, Metrics and
+// Scope, keyed by metric; metrics without points are absent. Step, paging
+// and order do not apply. Stores without a SummaryQuerier read the raw
+// points and summarize them here.
+func Summarize(s Store, gpuID string, q Query) (map[string]MetricSummary, error) {
+	q.Step, q.Offset, q.Limit, q.Desc = 0, 0, 0, false
+	if sq, ok := s.(SummaryQuerier); ok {
+		return sq.SummarizeTelemetry(gpuID, q)
+	}
+	items, err := Execute(s, gpuID, q)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string][]float64{}
+	keep := map[string]bool{}
+	for _, m := range q.Metrics {
+		keep[m] = true
+	}
+	for _, it := range items {
+		for m, v := range it.Metrics {
+			if len(keep) == 0 || keep[m] {
+				values[m] = append(values[m], v)
+			}
+		}
+	}
+	out := make(map[string]MetricSummary, len(values))
+	for m, vs := range values {
+		out[m] = SummarizeValues(vs)
+	}
+	return out, nil
+}
+
+// SummarizeValues summarizes vs, which must not be empty. It sorts vs.
+func SummarizeValues(vs []float64) MetricSummary {
+	sort.Float64s(vs)
+	var sum float64
+	for _, v := range vs {
+		sum += v
+	}
+	n := float64(len(vs))
+	mean := sum / n
+	var sq float64
+	for _, v := range vs {
+		sq += (v - mean) * (v - mean)
+	}
+	return MetricSummary{
+		Count:  len(vs),
+		Min:    vs[0],
+		Max:    vs[len(vs)-1],
+		Mean:   mean,
+		StdDev: math.Sqrt(sq / n),
+		P95:    vs[P95Rank(len(vs))-1],
+	}
+}
+
+// P95Rank is the 1-based nearest rank of the 95th percentile of n values.
+func P95Rank(n int) int { return (95*n + 99) / 100 }
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// TieredStore keeps the last window of telemetry in memory in front of a
+// cold store of record. Writes go to both; reads within the window are
+// answered from memory, older ones from cold, and a window spanning both is
+// merged as by NewReadRouter. The memory tier only holds what was written
+// through the TieredStore since it was created, so until a full window has
+// passed reads before its creation still go to cold.
+type TieredStore struct {
+	*readRouter
+	hot *MemoryStore
+}
+
+// NewTieredStore returns a TieredStore over cold whose memory tier keeps
+// points for window, by their timestamp.
+func NewTieredStore(cold Store, window time.Duration) *TieredStore {
+	hot := NewBoundedMemoryStore(MemoryLimits{MaxAge: window})
+	return &TieredStore{
+		readRouter: &readRouter{recent: hot, archive: cold, window: window, now: time.Now, since: time.Now()},
+		hot:        hot,
+	}
+}
+
+// Hot returns the memory tier, e.g. to read its eviction counts.
+func (t *TieredStore) Hot() *MemoryStore { return t.hot }
+
+// WithContext binds the cold store's calls to ctx; the memory tier does not
+// block.
+func (t *TieredStore) WithContext(ctx context.Context) Store {
+	return &TieredStore{readRouter: t.readRouter.withContext(ctx), hot: t.hot}
+}
+
+// SaveTelemetry writes t to cold, then to memory once cold has it.
+func (t *TieredStore) SaveTelemetry(it model.Telemetry) error {
+	if err := t.archive.SaveTelemetry(it); err != nil {
+		return err
+	}
+	return t.hot.SaveTelemetry(it)
+}
+
+// SaveTelemetryBatch writes items to cold, then the ones cold accepted to
+// memory, so memory never answers with points cold does not have. Cold's
+// error is returned.
+func (t *TieredStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	err := t.archive.SaveTelemetryBatch(items)
+	var be *BatchError
+	if err != nil && !errors.As(err, &be) {
+		return err
+	}
+	written := items
+	if be != nil {
+		written = make([]model.Telemetry, 0, len(items))
+		for i, it := range items {
+			if _, failed := be.Failed[i]; !failed {
+				written = append(written, it)
+			}
+		}
+	}
+	_ = t.hot.SaveTelemetryBatch(written) // never fails
+	return err
+}
+
+// DeleteTelemetry deletes from both tiers and returns cold's count. It fails
+// when cold cannot delete.
+func (t *TieredStore) DeleteTelemetry(gpuID string, before time.Time) (int64, error) {
+	d, ok := t.archive.(Deleter)
+	if !ok {
+		return 0, errors.New("tiered delete telemetry: the cold store cannot delete")
+	}
+	n, err := d.DeleteTelemetry(gpuID, before)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = t.hot.DeleteTelemetry(gpuID, before)
+	return n, nil
+}
+
+// DeleteMetrics deletes metrics from both tiers and returns cold's count. It
+// fails when cold cannot delete metrics.
+func (t *TieredStore) DeleteMetrics(gpuID string, metrics []string, before time.Time) (int64, error) {
+	d, ok := t.archive.(MetricDeleter)
+	if !ok {
+		return 0, errors.New("tiered delete metrics: the cold store cannot delete metrics")
+	}
+	n, err := d.DeleteMetrics(gpuID, metrics, before)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = t.hot.DeleteMetrics(gpuID, metrics, before)
+	return n, nil
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// tieredFixture returns a TieredStore with a 4m memory tier created at
+// minute 3, at minute 10, over a cold store holding minutes 0-2 of g1 from
+// before it was created; minutes 3-9 are written through it.
+func tieredFixture(t *testing.T) (*TieredStore, *MemoryStore, time.Time) {
+	t.Helper()
+	cold := NewMemoryStore()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		_ = cold.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: t0.Add(time.Duration(i) * time.Minute), Metrics: map[string]float64{"m": float64(i)}})
+	}
+	st := NewTieredStore(cold, 4*time.Minute)
+	now := t0.Add(3 * time.Minute)
+	clock := func() time.Time { return now }
+	st.now, st.since, st.hot.now = clock, now, clock
+	for i := 3; i < 10; i++ {
+		now = t0.Add(time.Duration(i) * time.Minute)
+		if err := st.SaveTelemetry(model.Telemetry{GPUId: "g1", Timestamp: now, Metrics: map[string]float64{"m": float64(i)}}); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	now = t0.Add(10 * time.Minute)
+	return st, cold, t0
+}
+
+func TestTieredStore_WritesBothAndMergesReads(t *testing.T) {
+	// Scenario: minutes 0-9 of g1, 3-9 written through the store at their
+	// own time, read at minute 10 with a 4m window
+	// Expect: cold has all ten points; memory kept minutes 5-9 only (older
+	// ones expired); a full read returns the ten points in order, once each
+	st, cold, t0 := tieredFixture(t)
+	if all, _ := cold.QueryTelemetry("g1", nil, nil); len(all) != 10 {
+		t.Fatalf("cold: %d points", len(all))
+	}
+	if hot, _ := st.Hot().QueryTelemetry("g1", nil, nil); len(hot) != 5 || !hot[0].Timestamp.Equal(t0.Add(5*time.Minute)) {
+		t.Fatalf("hot: %v", hot)
+	}
+	items, err := st.QueryTelemetryWith("g1", Query{})
+	if err != nil || len(items) != 10 {
+		t.Fatalf("query: %v %v", err, items)
+	}
+	for i, it := range items {
+		if it.Metrics["m"] != float64(i) {
+			t.Fatalf("item %d: %v", i, it.Metrics)
+		}
+	}
+	start := t0.Add(7 * time.Minute)
+	if items, _ := st.QueryTelemetryWith("g1", Query{Start: &start, Desc: true, Limit: 1}); len(items) != 1 || items[0].Metrics["m"] != 9 {
+		t.Fatalf("recent: %v", items)
+	}
+}
+
+func TestTieredStore_CutWaitsForAFullWindow(t *testing.T) {
+	// Scenario: a 1h memory tier created at 10:00:30
+	// Expect: at 10:20 the cut is its creation, rounded up to the step;
+	// from 11:00:30 on it is now minus the window
+	st := NewTieredStore(NewMemoryStore(), time.Hour)
+	since := time.Date(2024, 1, 1, 10, 0, 30, 0, time.UTC)
+	now := since.Add(20 * time.Minute)
+	st.since, st.now = since, func() time.Time { return now }
+	if c := st.cut(0); !c.Equal(since) {
+		t.Fatalf("cut: %v", c)
+	}
+	if c := st.cut(time.Minute); !c.Equal(since.Add(30 * time.Second)) {
+		t.Fatalf("cut per minute: %v", c)
+	}
+	now = since.Add(90 * time.Minute)
+	if c := st.cut(time.Minute); !c.Equal(since.Add(29*time.Minute + 30*time.Second)) {
+		t.Fatalf("cut after a window: %v", c)
+	}
+}
+
+func TestTieredStore_DeleteBothTiers(t *testing.T) {
+	st, cold, _ := tieredFixture(t)
+	if n, err := st.DeleteTelemetry("g1", time.Time{}); err != nil || n != 10 {
+		t.Fatalf("delete: %d %v", n, err)
+	}
+	if ids, _ := st.ListGPUs(); len(ids) != 0 {
+		t.Fatalf("left: %v", ids)
+	}
+	if _, err := NewTieredStore(struct{ Store }{cold}, time.Minute).DeleteTelemetry("", time.Time{}); err == nil {
+		t.Fatal("expected an error for a cold store without deletes")
+	}
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Aggregations accepted by TopQuery.Agg.
+const (
+	AggAvg  = "avg"
+	AggMax  = "max"
+	AggMin  = "min"
+	AggLast = "last"
+)
+
+// ValidAgg reports whether agg is one of the Agg* names.
+func ValidAgg(agg string) bool {
+	switch agg {
+	case AggAvg, AggMax, AggMin, AggLast:
+		return true
+	}
+	return false
+}
+
+// TopQuery ranks GPUs by one metric aggregated over a window.
+type TopQuery struct {
+	Metric string
+	// Start and End bound the window, both inclusive.
+	Start, End *time.Time
+	// Agg is one of the Agg* names; empty means AggAvg.
+	Agg string
+	// Asc ranks lowest first instead of highest first.
+	Asc bool
+	// N caps the result; 0 returns every GPU with data.
+	N int
+	// Scope, if set, ranks only points it allows.
+	Scope *Scope
+}
+
+// GPUValue is one GPU's aggregated value in a ranking.
+type GPUValue struct {
+	GPUId string  `json:"gpu_id"`
+	Value float64 `json:"value"`
+}
+
+// TopQuerier is implemented by stores that can aggregate and rank per GPU in
+// the backend.
+type TopQuerier interface {
+	TopGPUs(q TopQuery) ([]GPUValue, error)
+}
+
+// Top ranks GPUs as described by q, highest first unless q.Asc; ties are
+// ordered by GPU. Stores without a TopQuerier read the metric's raw points
+// for the whole fleet and aggregate them here.
+func Top(s Store, q TopQuery) ([]GPUValue, error) {
+	if q.Agg == "" {
+		q.Agg = AggAvg
+	}
+	if !ValidAgg(q.Agg) {
+		return nil, fmt.Errorf("unknown aggregation %q", q.Agg)
+	}
+	if tq, ok := s.(TopQuerier); ok {
+		return tq.TopGPUs(q)
+	}
+	items, err := ExecuteFleet(s, nil, Query{Start: q.Start, End: q.End, Scope: q.Scope, Metrics: []string{q.Metric}})
+	if err != nil {
+		return nil, err
+	}
+	type acc struct {
+		sum, min, max, last float64
+		n                   int
+	}
+	per := map[string]*acc{}
+	for _, it := range items { // time-ordered, so last wins
+		v := it.Metrics[q.Metric]
+		a := per[it.GPUId]
+		if a == nil {
+			a = &acc{min: v, max: v}
+			per[it.GPUId] = a
+		}
+		a.sum += v
+		a.n++
+		a.last = v
+		if v < a.min {
+			a.min = v
+		}
+		if v > a.max {
+			a.max = v
+		}
+	}
+	out := make([]GPUValue, 0, len(per))
+	for id, a := range per {
+		v := a.sum / float64(a.n)
+		switch q.Agg {
+		case AggMax:
+			v = a.max
+		case AggMin:
+			v = a.min
+		case AggLast:
+			v = a.last
+		}
+		out = append(out, GPUValue{GPUId: id, Value: v})
+	}
+	return RankValues(out, q.Asc, q.N), nil
+}
+
+// RankValues sorts vals (highest first unless asc, ties by GPU) and keeps at
+// most n (0 = all).
+func RankValues(vals []GPUValue, asc bool, n int) []GPUValue {
+	sort.Slice(vals, func(i, j int) bool {
+		if vals[i].Value != vals[j].Value {
+			return (vals[i].Value < vals[j].Value) == asc
+		}
+		return vals[i].GPUId < vals[j].GPUId
+	})
+	if n > 0 && n < len(vals) {
+		vals = vals[:n]
+	}
+	return vals
+}
@@ -0,0 +1,366 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// VictoriaStore implements Store on VictoriaMetrics. Points are written to
+// its InfluxDB line protocol endpoint, where each metric becomes the series
+// <measurement>_<metric> labelled with gpu_id, host_id, producer_id and the
+// point's labels; reads use its export API, which returns raw samples.
+// VictoriaMetrics keeps millisecond timestamps, and only drops duplicate
+// samples when run with -dedup.minScrapeInterval.
+type VictoriaStore struct {
+	url         string
+	measurement string
+	client      *http.Client
+	ctx         context.Context // nil means context.Background()
+}
+
+// NewVictoriaStore builds a Store for the VictoriaMetrics server at url,
+// e.g. http://localhost:8428, reading and writing measurement ("telemetry"
+// for raw data).
+func NewVictoriaStore(url, measurement string) (*VictoriaStore, error) {
+	if url == "" {
+		return nil, fmt.Errorf("victoriametrics: missing url")
+	}
+	if measurement == "" {
+		return nil, fmt.Errorf("victoriametrics: missing measurement")
+	}
+	return &VictoriaStore{url: strings.TrimRight(url, "/"), measurement: measurement, client: &http.Client{Timeout: time.Minute}}, nil
+}
+
+// WithContext returns a view of s whose requests use ctx.
+func (s *VictoriaStore) WithContext(ctx context.Context) Store {
+	cp := *s
+	cp.ctx = ctx
+	return &cp
+}
+
+func (s *VictoriaStore) callCtx() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+func (s *VictoriaStore) SaveTelemetry(t model.Telemetry) error {
+	return s.SaveTelemetryBatch([]model.Telemetry{t})
+}
+
+// SaveTelemetryBatch writes all items in a single request, which is accepted
+// or rejected as a whole. VictoriaMetrics holds numbers only, so typed
+// values are not written.
+func (s *VictoriaStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	if len(items) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	for _, t := range items {
+		t.Values = nil
+		write.PointToLineProtocolBuffer(influxPoint(s.measurement, t), &b, time.Nanosecond)
+	}
+	resp, err := s.do(http.MethodPost, "/write", nil, strings.NewReader(b.String()))
+	if err != nil {
+		return fmt.Errorf("victoriametrics write: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Ping checks that the server answers its health check.
+func (s *VictoriaStore) Ping(ctx context.Context) error {
+	resp, err := s.WithContext(ctx).(*VictoriaStore).do(http.MethodGet, "/health", nil, nil)
+	if err != nil {
+		return fmt.Errorf("victoriametrics ping: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *VictoriaStore) ListGPUs() ([]string, error) {
+	return s.listGPUs(s.selectors("", Query{}))
+}
+
+// ListGPUsIn lists the GPUs with at least one point in sc.
+func (s *VictoriaStore) ListGPUsIn(sc Scope) ([]string, error) {
+	sels := s.selectors("", Query{Scope: &sc})
+	if len(sels) == 0 {
+		return nil, nil
+	}
+	return s.listGPUs(sels)
+}
+
+func (s *VictoriaStore) listGPUs(sels []string) ([]string, error) {
+	// without start the server only looks at the current day
+	v := url.Values{"match[]": sels, "start": {"0"}}
+	resp, err := s.do(http.MethodGet, "/api/v1/label/gpu_id/values", v, nil)
+	if err != nil {
+		return nil, fmt.Errorf("victoriametrics list gpus: %w", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Data []string `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("victoriametrics list gpus: %w", err)
+	}
+	sort.Strings(body.Data)
+	return body.Data, nil
+}
+
+func (s *VictoriaStore) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
+	return s.QueryTelemetryWith(gpuID, Query{Start: start, End: end})
+}
+
+// QueryTelemetryWith selects the GPU, hosts, producers, labels, scope and
+// metrics in the server; downsampling and paging are applied to the points
+// it returns.
+func (s *VictoriaStore) QueryTelemetryWith(gpuID string, q Query) ([]model.Telemetry, error) {
+	return s.QueryFleet([]string{gpuID}, q)
+}
+
+// QueryFleet is QueryTelemetryWith over several GPUs (all when gpuIDs is
+// empty), ordered by time, then GPU.
+func (s *VictoriaStore) QueryFleet(gpuIDs []string, q Query) ([]model.Telemetry, error) {
+	var gpus string
+	if len(gpuIDs) > 0 {
+		gpus = promRegex(gpuIDs)
+	}
+	sels := s.selectors(gpus, q)
+	if len(sels) == 0 {
+		return nil, nil
+	}
+	items, err := s.export(sels, q.Start, q.End)
+	if err != nil {
+		return nil, err
+	}
+	if q.Step <= 0 || len(gpuIDs) == 1 {
+		return Apply(items, Query{Step: q.Step, Desc: q.Desc, Offset: q.Offset, Limit: q.Limit}), nil
+	}
+	byGPU := map[string][]model.Telemetry{}
+	for _, it := range items {
+		byGPU[it.GPUId] = append(byGPU[it.GPUId], it)
+	}
+	items = items[:0]
+	for id, its := range byGPU {
+		for _, it := range Downsample(its, q.Step) {
+			it.GPUId = id
+			items = append(items, it)
+		}
+	}
+	sortFleet(items)
+	return Apply(items, Query{Desc: q.Desc, Offset: q.Offset, Limit: q.Limit}), nil
+}
+
+// DeleteTelemetry deletes whole series: VictoriaMetrics cannot delete a time
+// range, so before must be zero. Use its -retentionPeriod to age data out.
+func (s *VictoriaStore) DeleteTelemetry(gpuID string, before time.Time) (int64, error) {
+	if !before.IsZero() {
+		return 0, errors.New("victoriametrics deletes whole series only; set its -retentionPeriod to drop old points")
+	}
+	var gpus string
+	if gpuID != "" {
+		gpus = promRegex([]string{gpuID})
+	}
+	resp, err := s.do(http.MethodPost, "/api/v1/admin/tsdb/delete_series", url.Values{"match[]": s.selectors(gpus, Query{})}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("victoriametrics delete: %w", err)
+	}
+	resp.Body.Close()
+	return -1, nil
+}
+
+// selectors returns the series selectors of q's points of the GPUs matching
+// the gpus regex (any if empty); their results are unioned. A scope becomes
+// one selector for its hosts and one for its clusters, and none when it
+// sees nothing.
+func (s *VictoriaStore) selectors(gpus string, q Query) []string {
+	name := regexp.QuoteMeta(s.measurement) + "_.+"
+	if len(q.Metrics) > 0 {
+		names := make([]string, len(q.Metrics))
+		for i, m := range q.Metrics {
+			names[i] = s.measurement + "_" + m
+		}
+		name = promRegex(names)
+	}
+	base := []string{"__name__=~" + strconv.Quote(name)}
+	if gpus != "" {
+		base = append(base, "gpu_id=~"+strconv.Quote(gpus))
+	}
+	if len(q.HostIDs) > 0 {
+		base = append(base, "host_id=~"+strconv.Quote(promRegex(q.HostIDs)))
+	}
+	if len(q.ProducerIDs) > 0 {
+		base = append(base, "producer_id=~"+strconv.Quote(promRegex(q.ProducerIDs)))
+	}
+	for _, k := range sortedKeys(q.Labels) {
+		base = append(base, k+"="+strconv.Quote(q.Labels[k]))
+	}
+	if q.Scope == nil {
+		return []string{"{" + strings.Join(base, ",") + "}"}
+	}
+	var out []string
+	for label, values := range map[string][]string{"host_id": q.Scope.HostIDs, ClusterLabel: q.Scope.Clusters} {
+		if len(values) > 0 {
+			out = append(out, "{"+strings.Join(append(base[:len(base):len(base)], label+"=~"+strconv.Quote(promRegex(values))), ",")+"}")
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// victoriaSeries is one line of the export API's answer.
+type victoriaSeries struct {
+	Metric     map[string]string `json:"metric"`
+	Values     []float64         `json:"values"`
+	Timestamps []int64           `json:"timestamps"`
+}
+
+// export reads the raw samples of the series matching sels within start and
+// end, both inclusive, and joins the samples of one GPU, host, producer,
+// label set and timestamp into a point, ordered by time, then GPU.
+func (s *VictoriaStore) export(sels []string, start, end *time.Time) ([]model.Telemetry, error) {
+	v := url.Values{"match[]": sels}
+	if start != nil {
+		v.Set("start", victoriaTime(*start))
+	}
+	if end != nil {
+		v.Set("end", victoriaTime(*end))
+	}
+	resp, err := s.do(http.MethodGet, "/api/v1/export", v, nil)
+	if err != nil {
+		return nil, fmt.Errorf("victoriametrics query: %w", err)
+	}
+	defer resp.Body.Close()
+	prefix := s.measurement + "_"
+	points := map[string]*model.Telemetry{}
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		var ser victoriaSeries
+		if err := json.Unmarshal(sc.Bytes(), &ser); err != nil {
+			return nil, fmt.Errorf("victoriametrics query: %w", err)
+		}
+		metric, ok := strings.CutPrefix(ser.Metric["__name__"], prefix)
+		if !ok || len(ser.Values) != len(ser.Timestamps) {
+			continue
+		}
+		base := model.Telemetry{GPUId: ser.Metric["gpu_id"], HostId: ser.Metric["host_id"], ProducerId: ser.Metric["producer_id"]}
+		for k, val := range ser.Metric {
+			switch k {
+			case "__name__", "gpu_id", "host_id", "producer_id":
+				continue
+			}
+			if base.Labels == nil {
+				base.Labels = map[string]string{}
+			}
+			base.Labels[k] = val
+		}
+		seriesKey := seriesID(base)
+		for i, ms := range ser.Timestamps {
+			key := strconv.FormatInt(ms, 10) + "\x00" + seriesKey
+			p := points[key]
+			if p == nil {
+				p = &model.Telemetry{GPUId: base.GPUId, HostId: base.HostId, ProducerId: base.ProducerId, Labels: base.Labels,
+					Timestamp: time.UnixMilli(ms).UTC(), Metrics: map[string]float64{}}
+				points[key] = p
+			}
+			p.Metrics[metric] = ser.Values[i]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("victoriametrics query: %w", err)
+	}
+	out := make([]model.Telemetry, 0, len(points))
+	for _, p := range points {
+		out = append(out, *p)
+	}
+	sortFleet(out)
+	return out, nil
+}
+
+// do sends a request to the server and returns the response of a 2xx
+// answer; the caller closes its body.
+func (s *VictoriaStore) do(method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	u := s.url + path
+	var form io.Reader = body
+	if method == http.MethodPost && body == nil {
+		form = strings.NewReader(query.Encode()) // keeps long selectors out of the URL
+	} else if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(s.callCtx(), method, u, form)
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPost && body == nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// victoriaTime renders t as Unix seconds with millisecond precision.
+func victoriaTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', 3, 64)
+}
+
+// promRegex is a regex matching exactly the given values (selector regexes
+// are anchored).
+func promRegex(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = regexp.QuoteMeta(v)
+	}
+	return strings.Join(quoted, "|")
+}
+
+// seriesID identifies t's GPU, host, producer and labels.
+func seriesID(t model.Telemetry) string {
+	keys := make([]string, 0, len(t.Labels))
+	for k := range t.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(t.GPUId + "\x00" + t.HostId + "\x00" + t.ProducerId)
+	for _, k := range keys {
+		b.WriteString("\x00" + k + "=" + t.Labels[k])
+	}
+	return b.String()
+}
+
+// sortFleet orders items by time, then GPU, then host, producer and labels.
+func sortFleet(items []model.Telemetry) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].Timestamp.Equal(items[j].Timestamp) {
+			return items[i].Timestamp.Before(items[j].Timestamp)
+		}
+		return seriesID(items[i]) < seriesID(items[j])
+	})
+}
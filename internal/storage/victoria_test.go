@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+func TestVictoriaStore_WriteAndQuery(t *testing.T) {
+	// Scenario: a fake VictoriaMetrics that records writes and exports the
+	// temp and util series of g1 (util labelled with a cluster only at its
+	// second sample) for any selector
+	// Expect: a batch is posted as line protocol; the export is joined into
+	// one point per series and timestamp with the measurement prefix
+	// stripped; selectors carry the GPU, metrics, producers, labels and scope;
+	// 4xx is an error
+	var written string
+	var matches [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/write":
+			b, _ := io.ReadAll(r.Body)
+			if strings.Contains(string(b), "bad") {
+				http.Error(w, "cannot parse", http.StatusBadRequest)
+				return
+			}
+			written = string(b)
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/v1/export":
+			matches = append(matches, r.URL.Query()["match[]"])
+			_, _ = io.WriteString(w, `{"metric":{"__name__":"telemetry_temp","gpu_id":"g1","host_id":"h1"},"values":[60,61],"timestamps":[1700000000000,1700000060000]}
+{"metric":{"__name__":"telemetry_util","gpu_id":"g1","host_id":"h1"},"values":[90],"timestamps":[1700000000000]}
+{"metric":{"__name__":"telemetry_util","gpu_id":"g1","host_id":"h1","cluster":"c1"},"values":[95],"timestamps":[1700000060000]}
+`)
+		case "/api/v1/label/gpu_id/values":
+			matches = append(matches, r.URL.Query()["match[]"])
+			_, _ = io.WriteString(w, `{"status":"success","data":["g2","g1"]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	st, err := NewVictoriaStore(srv.URL+"/", "telemetry")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t0 := time.Unix(1700000000, 0).UTC()
+
+	if err := st.SaveTelemetryBatch([]model.Telemetry{
+		{GPUId: "g1", HostId: "h1", Timestamp: t0, Metrics: map[string]float64{"util": 90, "temp": 60}},
+		{GPUId: "g2", Timestamp: t0, Labels: map[string]string{"cluster": "c1"}, Metrics: map[string]float64{"temp": 70}},
+	}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if want := "telemetry,gpu_id=g1,host_id=h1 temp=60,util=90 1700000000000000000\ntelemetry,cluster=c1,gpu_id=g2 temp=70 1700000000000000000\n"; written != want {
+		t.Fatalf("written:\n%s", written)
+	}
+	if err := st.SaveTelemetry(model.Telemetry{GPUId: "bad", Timestamp: t0, Metrics: map[string]float64{"temp": 1}}); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("rejected write: %v", err)
+	}
+
+	got, err := st.QueryTelemetryWith("g1", Query{Metrics: []string{"temp", "util"}})
+	want := []model.Telemetry{
+		{GPUId: "g1", HostId: "h1", Timestamp: t0, Metrics: map[string]float64{"temp": 60, "util": 90}},
+		{GPUId: "g1", HostId: "h1", Timestamp: t0.Add(time.Minute), Metrics: map[string]float64{"temp": 61}},
+		{GPUId: "g1", HostId: "h1", Timestamp: t0.Add(time.Minute), Labels: map[string]string{"cluster": "c1"}, Metrics: map[string]float64{"util": 95}},
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("query: %v %+v", err, got)
+	}
+	if m := matches[len(matches)-1]; len(m) != 1 || m[0] != `{__name__=~"telemetry_temp|telemetry_util",gpu_id=~"g1"}` {
+		t.Fatalf("selector: %q", m)
+	}
+	if _, err := st.QueryTelemetryWith("g1", Query{ProducerIDs: []string{"p1"}, Labels: map[string]string{"rack": "r1", "pod": "a"}}); err != nil {
+		t.Fatalf("attribution query: %v", err)
+	}
+	if m := matches[len(matches)-1]; len(m) != 1 || m[0] != `{__name__=~"telemetry_.+",gpu_id=~"g1",producer_id=~"p1",pod="a",rack="r1"}` {
+		t.Fatalf("attribution selector: %q", m)
+	}
+
+	ids, err := st.ListGPUsIn(Scope{HostIDs: []string{"h.1"}, Clusters: []string{"c1"}})
+	if err != nil || !reflect.DeepEqual(ids, []string{"g1", "g2"}) {
+		t.Fatalf("list: %v %v", ids, err)
+	}
+	if m := matches[len(matches)-1]; !reflect.DeepEqual(m, []string{`{__name__=~"telemetry_.+",cluster=~"c1"}`, `{__name__=~"telemetry_.+",host_id=~"h\\.1"}`}) {
+		t.Fatalf("scope selectors: %q", m)
+	}
+	if ids, err := st.ListGPUsIn(Scope{}); err != nil || len(ids) != 0 {
+		t.Fatalf("empty scope: %v %v", ids, err)
+	}
+	if _, err := st.DeleteTelemetry("", t0); err == nil {
+		t.Fatal("range delete: no error")
+	}
+}
@@ -0,0 +1,171 @@
+// Package storemetrics records Prometheus metrics for the calls a service
+// makes to its store, whichever backend it is, under the same names in every
+// service.
+package storemetrics
+
+import (
+	"context"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Metrics holds one service's store metrics; register Collectors once.
+type Metrics struct {
+	// Duration is the latency of each call by op and result (ok or error).
+	Duration *prometheus.HistogramVec
+	// Errors counts failed calls by op; a batch that failed only in part
+	// counts once, and its items in FailedItems.
+	Errors *prometheus.CounterVec
+	// BatchItems is the size of each SaveTelemetryBatch call.
+	BatchItems prometheus.Histogram
+	// FailedItems counts the items of batches the store rejected.
+	FailedItems prometheus.Counter
+}
+
+// New returns the store metrics of the service subsystem, e.g. "collector".
+func New(subsystem string) *Metrics {
+	return &Metrics{
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "gpu_telemetry", Subsystem: subsystem, Name: "store_query_duration_seconds", Help: "Store call latency by operation and result (ok or error).",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"op", "result"}),
+		Errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gpu_telemetry", Subsystem: subsystem, Name: "store_errors_total", Help: "Failed store calls by operation.",
+		}, []string{"op"}),
+		BatchItems: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "gpu_telemetry", Subsystem: subsystem, Name: "store_batch_items", Help: "Items per batch written to the store.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+		}),
+		FailedItems: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "gpu_telemetry", Subsystem: subsystem, Name: "store_failed_items_total", Help: "Items of batches the store rejected.",
+		}),
+	}
+}
+
+// Collectors returns the metrics to register.
+func (m *Metrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.Duration, m.Errors, m.BatchItems, m.FailedItems}
+}
+
+// Store times every call that reaches base and passes its query pushdowns
+// through. With a tracer, a call made once the store is bound to a
+// request's context is also recorded as a span of the request's trace.
+type Store struct {
+	base   storage.Store
+	m      *Metrics
+	tracer trace.Tracer
+	ctx    context.Context
+}
+
+// Wrap returns base recording into m; tracer may be nil.
+func (m *Metrics) Wrap(base storage.Store, tracer trace.Tracer) *Store {
+	return &Store{base: base, m: m, tracer: tracer, ctx: context.Background()}
+}
+
+// observed runs call and records its latency, error and span under op.
+func observed[T any](s *Store, op string, call func() (T, error), attrs ...attribute.KeyValue) (T, error) {
+	var span trace.Span
+	if s.tracer != nil {
+		_, span = s.tracer.Start(s.ctx, "store."+op, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(append(attrs, attribute.String("db.operation.name", op))...))
+		defer span.End()
+	}
+	start := time.Now()
+	v, err := call()
+	result := "ok"
+	if err != nil {
+		result = "error"
+		s.m.Errors.WithLabelValues(op).Inc()
+		if span != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	s.m.Duration.WithLabelValues(op, result).Observe(time.Since(start).Seconds())
+	return v, err
+}
+
+func gpuAttr(gpuID string) attribute.KeyValue { return attribute.String("gpu.id", gpuID) }
+
+func (s *Store) WithContext(ctx context.Context) storage.Store {
+	return &Store{base: storage.WithContext(ctx, s.base), m: s.m, tracer: s.tracer, ctx: ctx}
+}
+
+func (s *Store) SaveTelemetry(t model.Telemetry) error {
+	_, err := observed(s, "save", func() (struct{}, error) { return struct{}{}, s.base.SaveTelemetry(t) }, gpuAttr(t.GPUId))
+	if err != nil {
+		s.m.FailedItems.Inc()
+	}
+	return err
+}
+
+func (s *Store) SaveTelemetryBatch(items []model.Telemetry) error {
+	s.m.BatchItems.Observe(float64(len(items)))
+	_, err := observed(s, "save_batch", func() (struct{}, error) { return struct{}{}, s.base.SaveTelemetryBatch(items) },
+		attribute.Int("batch.items", len(items)))
+	s.m.FailedItems.Add(float64(len(storage.FailedItems(err, len(items)))))
+	return err
+}
+
+func (s *Store) ListGPUs() ([]string, error) {
+	return observed(s, "list_gpus", s.base.ListGPUs)
+}
+
+func (s *Store) ListGPUsIn(sc storage.Scope) ([]string, error) {
+	return observed(s, "list_gpus", storage.Scoped(s.base, sc).ListGPUs)
+}
+
+func (s *Store) QueryTelemetry(gpuID string, start, end *time.Time) ([]model.Telemetry, error) {
+	return observed(s, "query", func() ([]model.Telemetry, error) { return s.base.QueryTelemetry(gpuID, start, end) }, gpuAttr(gpuID))
+}
+
+func (s *Store) QueryTelemetryWith(gpuID string, q storage.Query) ([]model.Telemetry, error) {
+	return observed(s, "query", func() ([]model.Telemetry, error) { return storage.Execute(s.base, gpuID, q) }, gpuAttr(gpuID))
+}
+
+func (s *Store) QueryFleet(gpuIDs []string, q storage.Query) ([]model.Telemetry, error) {
+	return observed(s, "fleet_query", func() ([]model.Telemetry, error) { return storage.ExecuteFleet(s.base, gpuIDs, q) },
+		attribute.Int("gpu.count", len(gpuIDs)))
+}
+
+func (s *Store) LatestTelemetry(gpuID string) (*model.Telemetry, error) {
+	return observed(s, "latest", func() (*model.Telemetry, error) { return storage.Latest(s.base, gpuID) }, gpuAttr(gpuID))
+}
+
+func (s *Store) QueryLatest(gpuIDs []string, sc *storage.Scope) (map[string]*model.Telemetry, error) {
+	return observed(s, "latest_many", func() (map[string]*model.Telemetry, error) { return storage.LatestMany(s.base, gpuIDs, sc) },
+		attribute.Int("gpu.count", len(gpuIDs)))
+}
+
+func (s *Store) TopGPUs(q storage.TopQuery) ([]storage.GPUValue, error) {
+	return observed(s, "top", func() ([]storage.GPUValue, error) { return storage.Top(s.base, q) }, attribute.String("metric", q.Metric))
+}
+
+func (s *Store) AggregateTelemetry(gpuID string, q storage.AggregateQuery) ([]storage.Bucket, error) {
+	return observed(s, "aggregate", func() ([]storage.Bucket, error) { return storage.Aggregate(s.base, gpuID, q) }, gpuAttr(gpuID))
+}
+
+func (s *Store) SummarizeTelemetry(gpuID string, q storage.Query) (map[string]storage.MetricSummary, error) {
+	return observed(s, "summary", func() (map[string]storage.MetricSummary, error) { return storage.Summarize(s.base, gpuID, q) }, gpuAttr(gpuID))
+}
+
+func (s *Store) ListMetrics(gpuIDs []string, q storage.Query) (map[string][]storage.MetricInfo, error) {
+	return observed(s, "list_metrics", func() (map[string][]storage.MetricInfo, error) { return storage.ListMetrics(s.base, gpuIDs, q) },
+		attribute.Int("gpu.count", len(gpuIDs)))
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	p, ok := s.base.(storage.Pinger)
+	if !ok {
+		return nil
+	}
+	_, err := observed(s, "ping", func() (struct{}, error) { return struct{}{}, p.Ping(ctx) })
+	return err
+}
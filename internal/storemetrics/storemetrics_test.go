@@ -0,0 +1,84 @@
+package storemetrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// flakyStore rejects the items of GPU bad and fails its ping.
+type flakyStore struct{ *storage.MemoryStore }
+
+func (f flakyStore) SaveTelemetryBatch(items []model.Telemetry) error {
+	return storage.SaveEach(func(t model.Telemetry) error {
+		if t.GPUId == "bad" {
+			return errors.New("rejected")
+		}
+		return f.MemoryStore.SaveTelemetry(t)
+	}, items)
+}
+
+func (f flakyStore) Ping(context.Context) error { return errors.New("down") }
+
+func samples(t *testing.T, h prometheus.Observer) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestStore_RecordsCallsErrorsAndBatches(t *testing.T) {
+	// Scenario: a batch of three with one rejected item, two queries and a
+	// failing ping through a wrapped store
+	// Expect: the batch size observed, one save_batch error and one failed
+	// item, two query samples, a ping error; results pass through unchanged
+	m := New("test")
+	s := m.Wrap(flakyStore{storage.NewMemoryStore()}, nil)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := s.SaveTelemetryBatch([]model.Telemetry{
+		{GPUId: "g1", Timestamp: t0, Metrics: map[string]float64{"temp": 1}},
+		{GPUId: "bad", Timestamp: t0},
+		{GPUId: "g1", Timestamp: t0.Add(time.Second), Metrics: map[string]float64{"temp": 2}},
+	})
+	if len(storage.FailedItems(err, 3)) != 1 {
+		t.Fatalf("batch error: %v", err)
+	}
+	if items, err := s.QueryTelemetryWith("g1", storage.Query{Metrics: []string{"temp"}}); err != nil || len(items) != 2 {
+		t.Fatalf("query: %v %v", err, items)
+	}
+	if l, err := s.WithContext(context.Background()).(storage.LatestQuerier).LatestTelemetry("g1"); err != nil || l.Metrics["temp"] != 2 {
+		t.Fatalf("latest: %v %v", err, l)
+	}
+	if s.Ping(context.Background()) == nil {
+		t.Fatal("expected the ping error")
+	}
+
+	if n := samples(t, m.BatchItems); n != 1 {
+		t.Fatalf("batch samples: %d", n)
+	}
+	if got := testutil.ToFloat64(m.Errors.WithLabelValues("save_batch")); got != 1 {
+		t.Fatalf("save_batch errors: %v", got)
+	}
+	if got := testutil.ToFloat64(m.FailedItems); got != 1 {
+		t.Fatalf("failed items: %v", got)
+	}
+	if n := samples(t, m.Duration.WithLabelValues("query", "ok")); n != 1 {
+		t.Fatalf("query samples: %d", n)
+	}
+	if n := samples(t, m.Duration.WithLabelValues("latest", "ok")); n != 1 {
+		t.Fatalf("latest samples: %d", n)
+	}
+	if got := testutil.ToFloat64(m.Errors.WithLabelValues("ping")); got != 1 {
+		t.Fatalf("ping errors: %v", got)
+	}
+}
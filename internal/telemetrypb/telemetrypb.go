@@ -0,0 +1,41 @@
+// Package telemetrypb converts the model's telemetry to its wire form, for
+// the commands that publish stored or ingested telemetry to the broker.
+package telemetrypb
+
+import (
+	telemetryv1 "gpu-metric-collector/api/gen"
+	"gpu-metric-collector/internal/model"
+)
+
+// Value converts a typed value to its wire form; nil for a Value without a
+// kind.
+func Value(v model.Value) *telemetryv1.MetricValue {
+	switch v.Kind {
+	case model.KindFloat:
+		return &telemetryv1.MetricValue{Value: &telemetryv1.MetricValue_FloatValue{FloatValue: v.Float}}
+	case model.KindInt:
+		return &telemetryv1.MetricValue{Value: &telemetryv1.MetricValue_IntValue{IntValue: v.Int}}
+	case model.KindBool:
+		return &telemetryv1.MetricValue{Value: &telemetryv1.MetricValue_BoolValue{BoolValue: v.Bool}}
+	case model.KindString:
+		return &telemetryv1.MetricValue{Value: &telemetryv1.MetricValue_StringValue{StringValue: v.Str}}
+	}
+	return nil
+}
+
+// Values converts typed values to their wire form, leaving out values
+// without a kind; nil when none is left.
+func Values(values map[string]model.Value) map[string]*telemetryv1.MetricValue {
+	var out map[string]*telemetryv1.MetricValue
+	for k, v := range values {
+		mv := Value(v)
+		if mv == nil {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]*telemetryv1.MetricValue, len(values))
+		}
+		out[k] = mv
+	}
+	return out
+}
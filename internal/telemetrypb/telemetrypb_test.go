@@ -0,0 +1,25 @@
+package telemetrypb
+
+import (
+	"testing"
+
+	"gpu-metric-collector/internal/model"
+)
+
+func TestValues_EveryKind(t *testing.T) {
+	// Scenario: one value of each kind and one without a kind; then only the one without
+	// Expect: each kind in its wire field, the kindless one left out; nil when none is left
+	got := Values(map[string]model.Value{
+		"f": model.FloatValue(1.5), "i": model.IntValue(1 << 60), "b": model.BoolValue(true),
+		"s": model.StringValue("P0"), "none": {},
+	})
+	if len(got) != 4 {
+		t.Fatalf("got %d values, want 4: %v", len(got), got)
+	}
+	if got["f"].GetFloatValue() != 1.5 || got["i"].GetIntValue() != 1<<60 || !got["b"].GetBoolValue() || got["s"].GetStringValue() != "P0" {
+		t.Fatalf("values = %v", got)
+	}
+	if out := Values(map[string]model.Value{"none": {}}); out != nil {
+		t.Fatalf("only kindless values: %v", out)
+	}
+}
@@ -0,0 +1,64 @@
+// Package tracing sends OpenTelemetry spans to an OTLP/gRPC endpoint.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"gpu-metric-collector/internal/grpcclient"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+)
+
+// Config configures Setup.
+type Config struct {
+	// Endpoint is the OTLP/gRPC receiver, e.g. "otel-collector:4317".
+	Endpoint string
+	// Security controls TLS and bearer token auth to the receiver.
+	Security grpcclient.Security
+	// ServiceName is the service.name resource attribute, e.g. "api-gateway".
+	ServiceName string
+	// SampleRatio is the fraction of new traces recorded; a request that
+	// arrives with a sampled parent is always recorded.
+	SampleRatio float64
+}
+
+// Setup installs a global tracer provider that batches spans to
+// cfg.Endpoint, and the W3C traceparent propagator. Call shutdown on exit to
+// flush the spans still buffered.
+func Setup(cfg Config) (shutdown func(context.Context) error, err error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("tracing: missing endpoint")
+	}
+	opts, err := cfg.Security.DialOptions()
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	conn, err := grpc.Dial(cfg.Endpoint, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: dial %s: %w", cfg.Endpoint, err)
+	}
+	exp, err := otlptracegrpc.New(context.Background(), otlptracegrpc.WithGRPCConn(conn))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		conn.Close()
+		return err
+	}, nil
+}
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+)
+
+type fakeReceiver struct {
+	coltracepb.UnimplementedTraceServiceServer
+	reqs chan *coltracepb.ExportTraceServiceRequest
+}
+
+func (f *fakeReceiver) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	f.reqs <- req
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func TestSetup_ExportsSpansOnShutdown(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	recv := &fakeReceiver{reqs: make(chan *coltracepb.ExportTraceServiceRequest, 1)}
+	coltracepb.RegisterTraceServiceServer(srv, recv)
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	shutdown, err := Setup(Config{Endpoint: lis.Addr().String(), ServiceName: "api-gateway", SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "GET /api/v1/gpus")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	req := <-recv.reqs
+	rs := req.GetResourceSpans()
+	if len(rs) != 1 || len(rs[0].GetScopeSpans()) != 1 || rs[0].GetScopeSpans()[0].GetSpans()[0].GetName() != "GET /api/v1/gpus" {
+		t.Fatalf("unexpected export: %v", req)
+	}
+	attrs := rs[0].GetResource().GetAttributes()
+	if len(attrs) != 1 || attrs[0].GetKey() != "service.name" || attrs[0].GetValue().GetStringValue() != "api-gateway" {
+		t.Fatalf("resource: %v", attrs)
+	}
+}
+
+func TestSetup_RequiresEndpoint(t *testing.T) {
+	if _, err := Setup(Config{}); err == nil {
+		t.Fatal("expected an error without an endpoint")
+	}
+}
@@ -0,0 +1,169 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"gpu-metric-collector/internal/model"
+)
+
+// Policy selects what happens when a metric falls outside its range.
+type Policy string
+
+const (
+	// PolicyDrop discards the whole sample.
+	PolicyDrop Policy = "drop"
+	// PolicyClamp pulls the value back into [min, max]; non-finite values are removed.
+	PolicyClamp Policy = "clamp"
+	// PolicyFlag keeps the value and adds a "<metric>_out_of_range" = 1 marker metric.
+	PolicyFlag Policy = "flag"
+)
+
+// FlagSuffix is appended to a metric name to mark a flagged value.
+const FlagSuffix = "_out_of_range"
+
+// Rule is a sanity range for a single metric. Min and Max are optional.
+type Rule struct {
+	Metric string   `json:"metric" yaml:"metric"`
+	Min    *float64 `json:"min,omitempty" yaml:"min"`
+	Max    *float64 `json:"max,omitempty" yaml:"max"`
+	Policy Policy   `json:"policy" yaml:"policy"`
+}
+
+// Action records a rule that fired for a sample.
+type Action struct {
+	Metric string
+	Policy Policy
+}
+
+// Rules is an immutable, metric-indexed rule set. A nil *Rules accepts everything.
+type Rules struct {
+	byMetric map[string]Rule
+}
+
+type rulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Load reads a JSON rules file of the form
+// {"rules":[{"metric":"temp","min":0,"max":120,"policy":"clamp"}]}.
+func Load(path string) (*Rules, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rules: %w", err)
+	}
+	return Parse(b)
+}
+
+// Parse decodes and checks a JSON rules document.
+func Parse(data []byte) (*Rules, error) {
+	var f rulesFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse rules: %w", err)
+	}
+	return New(f.Rules)
+}
+
+// New builds a rule set, rejecting duplicates, empty ranges and unknown policies.
+func New(rules []Rule) (*Rules, error) {
+	r := &Rules{byMetric: make(map[string]Rule, len(rules))}
+	for _, rule := range rules {
+		if rule.Metric == "" {
+			return nil, fmt.Errorf("rules: metric name required")
+		}
+		if _, dup := r.byMetric[rule.Metric]; dup {
+			return nil, fmt.Errorf("rules: duplicate rule for %s", rule.Metric)
+		}
+		switch rule.Policy {
+		case PolicyDrop, PolicyClamp, PolicyFlag:
+		case "":
+			rule.Policy = PolicyDrop
+		default:
+			return nil, fmt.Errorf("rules: %s: unknown policy %q", rule.Metric, rule.Policy)
+		}
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return nil, fmt.Errorf("rules: %s: min > max", rule.Metric)
+		}
+		r.byMetric[rule.Metric] = rule
+	}
+	return r, nil
+}
+
+// WithDefaults returns r plus each of defaults whose metric r has no rule
+// for, so explicit rules win over catalog bounds. A nil r yields just the
+// defaults.
+func (r *Rules) WithDefaults(defaults []Rule) (*Rules, error) {
+	rules := make([]Rule, 0, r.Len()+len(defaults))
+	if r != nil {
+		for _, rule := range r.byMetric {
+			rules = append(rules, rule)
+		}
+	}
+	for _, rule := range defaults {
+		if r != nil {
+			if _, ok := r.byMetric[rule.Metric]; ok {
+				continue
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return New(rules)
+}
+
+// Len returns the number of rules.
+func (r *Rules) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.byMetric)
+}
+
+// Apply checks t against the rules, clamping or flagging in place.
+// keep is false when a drop rule fired; actions lists every rule that fired.
+func (r *Rules) Apply(t *model.Telemetry) (keep bool, actions []Action) {
+	if r == nil {
+		return true, nil
+	}
+	keep = true
+	for name, v := range t.Metrics {
+		rule, ok := r.byMetric[name]
+		if !ok || rule.inRange(v) {
+			continue
+		}
+		actions = append(actions, Action{Metric: name, Policy: rule.Policy})
+		switch rule.Policy {
+		case PolicyDrop:
+			keep = false
+		case PolicyClamp:
+			if rule.Min != nil && v < *rule.Min {
+				v = *rule.Min
+			}
+			if rule.Max != nil && v > *rule.Max {
+				v = *rule.Max
+			}
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				delete(t.Metrics, name)
+				continue
+			}
+			t.Metrics[name] = v
+		case PolicyFlag:
+			t.Metrics[name+FlagSuffix] = 1
+		}
+	}
+	return keep, actions
+}
+
+func (rule Rule) inRange(v float64) bool {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return false
+	}
+	if rule.Min != nil && v < *rule.Min {
+		return false
+	}
+	if rule.Max != nil && v > *rule.Max {
+		return false
+	}
+	return true
+}
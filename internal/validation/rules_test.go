@@ -0,0 +1,104 @@
+package validation
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+const testRules = `{"rules":[
+  {"metric":"temp","min":0,"max":120,"policy":"clamp"},
+  {"metric":"util","min":0,"max":100,"policy":"drop"},
+  {"metric":"power","max":700,"policy":"flag"}
+]}`
+
+func sample(metrics map[string]float64) model.Telemetry {
+	return model.Telemetry{GPUId: "g1", Timestamp: time.Now(), Metrics: metrics}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, doc := range []string{
+		`{"rules":[{"min":0}]}`,
+		`{"rules":[{"metric":"a","policy":"explode"}]}`,
+		`{"rules":[{"metric":"a","min":5,"max":1}]}`,
+		`{"rules":[{"metric":"a"},{"metric":"a"}]}`,
+		`not json`,
+	} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Fatalf("expected error for %s", doc)
+		}
+	}
+}
+
+func TestApply_Policies(t *testing.T) {
+	r, err := Parse([]byte(testRules))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	s := sample(map[string]float64{"temp": 150, "util": 50, "power": 800})
+	keep, actions := r.Apply(&s)
+	if !keep {
+		t.Fatalf("expected sample to be kept")
+	}
+	if len(actions) != 2 {
+		t.Fatalf("expected 2 actions, got %#v", actions)
+	}
+	if s.Metrics["temp"] != 120 {
+		t.Fatalf("expected temp clamped to 120, got %v", s.Metrics["temp"])
+	}
+	if s.Metrics["power"] != 800 || s.Metrics["power"+FlagSuffix] != 1 {
+		t.Fatalf("expected power kept and flagged, got %#v", s.Metrics)
+	}
+
+	s = sample(map[string]float64{"util": 101})
+	if keep, _ := r.Apply(&s); keep {
+		t.Fatalf("expected drop for util out of range")
+	}
+
+	s = sample(map[string]float64{"temp": math.NaN()})
+	if keep, _ := r.Apply(&s); !keep {
+		t.Fatalf("clamp must not drop the sample")
+	}
+	if _, ok := s.Metrics["temp"]; ok {
+		t.Fatalf("expected NaN temp to be removed")
+	}
+}
+
+func TestApply_NilRules(t *testing.T) {
+	var r *Rules
+	s := sample(map[string]float64{"temp": 1e9})
+	if keep, actions := r.Apply(&s); !keep || actions != nil {
+		t.Fatalf("nil rules must accept everything")
+	}
+}
+
+func TestWithDefaults_ExplicitRulesWin(t *testing.T) {
+	// Scenario: an explicit clamp rule for temp, defaults for temp and util
+	// Expect: temp keeps its explicit rule, util gets the default; a nil set
+	// takes the defaults as they are
+	r, err := Parse([]byte(`{"rules":[{"metric":"temp","min":0,"max":120,"policy":"clamp"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hi := 100.0
+	defaults := []Rule{{Metric: "temp", Max: &hi, Policy: PolicyDrop}, {Metric: "util", Max: &hi, Policy: PolicyDrop}}
+	merged, err := r.WithDefaults(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sample(map[string]float64{"temp": 110, "util": 50})
+	if keep, actions := merged.Apply(&s); !keep || len(actions) != 0 || merged.Len() != 2 {
+		t.Fatalf("keep=%v actions=%v len=%d", keep, actions, merged.Len())
+	}
+	s = sample(map[string]float64{"util": 150})
+	if keep, _ := merged.Apply(&s); keep {
+		t.Fatal("expected the default util rule to drop")
+	}
+	var none *Rules
+	if only, err := none.WithDefaults(defaults); err != nil || only.Len() != 2 {
+		t.Fatalf("nil set: %v %v", only.Len(), err)
+	}
+}
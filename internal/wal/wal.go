@@ -0,0 +1,331 @@
+// Package wal is a local write-ahead journal of telemetry batches. Records are
+// appended to numbered segment files and committed once persisted downstream;
+// on open, every record after the last committed one is available for replay.
+package wal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+const (
+	segmentExt     = ".wal"
+	checkpointFile = "checkpoint"
+	headerSize     = 8 // payload length + crc32
+)
+
+// DefaultSegmentBytes is the size at which a new segment file is started.
+const DefaultSegmentBytes = 64 << 20
+
+// ErrNotFound is returned by Read for sequence numbers that are committed or unknown.
+var ErrNotFound = errors.New("wal: record not found")
+
+type location struct {
+	segment uint64 // first seq of the segment
+	offset  int64
+	size    int64
+}
+
+type segment struct {
+	first uint64
+	last  uint64
+	f     *os.File
+	size  int64
+}
+
+// Log is a segmented journal. It is safe for concurrent use.
+type Log struct {
+	mu           sync.Mutex
+	dir          string
+	segmentBytes int64
+	segments     []*segment // ascending by first seq; the last one is appended to
+	index        map[uint64]location
+	next         uint64 // seq of the next append
+	committed    uint64 // every seq <= committed is persisted downstream
+	done         map[uint64]bool
+	size         int64
+}
+
+// Open opens or creates the journal in dir. A torn record at the tail of the
+// last segment (e.g. after a crash mid-write) is truncated away.
+func Open(dir string, segmentBytes int64) (*Log, error) {
+	if segmentBytes <= 0 {
+		segmentBytes = DefaultSegmentBytes
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+	l := &Log{dir: dir, segmentBytes: segmentBytes, index: map[uint64]location{}, done: map[uint64]bool{}}
+	if b, err := os.ReadFile(filepath.Join(dir, checkpointFile)); err == nil {
+		if l.committed, err = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64); err != nil {
+			return nil, fmt.Errorf("wal: bad checkpoint: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+	l.next = l.committed + 1
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		first, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seg, err := l.load(name, first)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		if seg.last != 0 && seg.last <= l.committed {
+			// fully committed; left over from a crash before it was removed
+			seg.f.Close()
+			os.Remove(name)
+			continue
+		}
+		l.segments = append(l.segments, seg)
+		l.size += seg.size
+	}
+	if len(l.segments) == 0 {
+		if err := l.roll(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// load scans one segment, indexing uncommitted records and truncating a torn tail.
+func (l *Log) load(name string, first uint64) (*segment, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+	seg := &segment{first: first, f: f}
+	var off int64
+	for {
+		seq, n, err := readRecordHeader(f, off)
+		if err != nil {
+			if err != io.EOF {
+				if terr := f.Truncate(off); terr != nil {
+					f.Close()
+					return nil, fmt.Errorf("wal: truncate torn record in %s: %w", name, terr)
+				}
+			}
+			break
+		}
+		if seq > l.committed {
+			l.index[seq] = location{segment: first, offset: off, size: n}
+		}
+		seg.last = seq
+		if seq >= l.next {
+			l.next = seq + 1
+		}
+		off += n
+	}
+	seg.size = off
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+	return seg, nil
+}
+
+// readRecordHeader validates the record at off and returns its seq and total size.
+func readRecordHeader(f *os.File, off int64) (uint64, int64, error) {
+	var hdr [headerSize]byte
+	if _, err := f.ReadAt(hdr[:], off); err != nil {
+		if err == io.EOF {
+			// a partial header is a torn write unless nothing was written at all
+			if st, serr := f.Stat(); serr == nil && st.Size() > off {
+				return 0, 0, io.ErrUnexpectedEOF
+			}
+		}
+		return 0, 0, err
+	}
+	n := binary.BigEndian.Uint32(hdr[0:4])
+	payload := make([]byte, n)
+	if _, err := f.ReadAt(payload, off+headerSize); err != nil {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(hdr[4:8]) || n < 8 {
+		return 0, 0, fmt.Errorf("wal: checksum mismatch at %d", off)
+	}
+	return binary.BigEndian.Uint64(payload[:8]), headerSize + int64(n), nil
+}
+
+// roll starts a new segment named after the next seq.
+func (l *Log) roll() error {
+	name := filepath.Join(l.dir, fmt.Sprintf("%020d%s", l.next, segmentExt))
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("wal: %w", err)
+	}
+	l.segments = append(l.segments, &segment{first: l.next, f: f})
+	return nil
+}
+
+// record is the on-disk form of a telemetry item; unlike model.Telemetry's
+// JSON it keeps the idempotency key, so replayed writes stay idempotent.
+type record struct {
+	GPUId          string                 `json:"g"`
+	HostId         string                 `json:"h,omitempty"`
+	ProducerId     string                 `json:"p,omitempty"`
+	Timestamp      time.Time              `json:"t"`
+	Metrics        map[string]float64     `json:"m,omitempty"`
+	Labels         map[string]string      `json:"l,omitempty"`
+	IdempotencyKey string                 `json:"k,omitempty"`
+	Values         map[string]model.Value `json:"v,omitempty"`
+}
+
+// Append durably writes items as one record and returns its sequence number.
+func (l *Log) Append(items []model.Telemetry) (uint64, error) {
+	recs := make([]record, len(items))
+	for i, t := range items {
+		recs[i] = record{t.GPUId, t.HostId, t.ProducerId, t.Timestamp, t.Metrics, t.Labels, t.IdempotencyKey, t.Values}
+	}
+	body, err := json.Marshal(recs)
+	if err != nil {
+		return 0, fmt.Errorf("wal: encode: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seg := l.segments[len(l.segments)-1]
+	if seg.size >= l.segmentBytes {
+		if err := l.roll(); err != nil {
+			return 0, err
+		}
+		seg = l.segments[len(l.segments)-1]
+	}
+	seq := l.next
+	buf := make([]byte, headerSize+8+len(body))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(8+len(body)))
+	binary.BigEndian.PutUint64(buf[headerSize:headerSize+8], seq)
+	copy(buf[headerSize+8:], body)
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(buf[headerSize:]))
+	if _, err := seg.f.WriteAt(buf, seg.size); err != nil {
+		return 0, fmt.Errorf("wal: write: %w", err)
+	}
+	if err := seg.f.Sync(); err != nil {
+		return 0, fmt.Errorf("wal: sync: %w", err)
+	}
+	l.index[seq] = location{segment: seg.first, offset: seg.size, size: int64(len(buf))}
+	seg.size += int64(len(buf))
+	seg.last = seq
+	l.size += int64(len(buf))
+	l.next++
+	return seq, nil
+}
+
+// Read returns the items of an uncommitted record.
+func (l *Log) Read(seq uint64) ([]model.Telemetry, error) {
+	l.mu.Lock()
+	loc, ok := l.index[seq]
+	var f *os.File
+	for _, s := range l.segments {
+		if s.first == loc.segment {
+			f = s.f
+		}
+	}
+	l.mu.Unlock()
+	if !ok || f == nil {
+		return nil, ErrNotFound
+	}
+	buf := make([]byte, loc.size)
+	if _, err := f.ReadAt(buf, loc.offset); err != nil {
+		return nil, fmt.Errorf("wal: read %d: %w", seq, err)
+	}
+	var recs []record
+	if err := json.Unmarshal(buf[headerSize+8:], &recs); err != nil {
+		return nil, fmt.Errorf("wal: decode %d: %w", seq, err)
+	}
+	items := make([]model.Telemetry, len(recs))
+	for i, r := range recs {
+		items[i] = model.Telemetry{GPUId: r.GPUId, HostId: r.HostId, ProducerId: r.ProducerId, Timestamp: r.Timestamp, Metrics: r.Metrics, Labels: r.Labels, Values: r.Values, IdempotencyKey: r.IdempotencyKey}
+	}
+	return items, nil
+}
+
+// Pending returns the range of uncommitted sequence numbers, first > last when
+// there are none.
+func (l *Log) Pending() (first, last uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.committed + 1, l.next - 1
+}
+
+// Size is the number of bytes held in segment files.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// Commit marks seq as persisted downstream. Records may be committed in any
+// order; the checkpoint only advances over a contiguous prefix, and segments
+// behind it are deleted.
+func (l *Log) Commit(seq uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if seq <= l.committed {
+		return nil
+	}
+	l.done[seq] = true
+	advanced := false
+	for l.done[l.committed+1] {
+		delete(l.done, l.committed+1)
+		delete(l.index, l.committed+1)
+		l.committed++
+		advanced = true
+	}
+	if !advanced {
+		return nil
+	}
+	tmp := filepath.Join(l.dir, checkpointFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(l.committed, 10)), 0o644); err != nil {
+		return fmt.Errorf("wal: checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(l.dir, checkpointFile)); err != nil {
+		return fmt.Errorf("wal: checkpoint: %w", err)
+	}
+	// drop segments that are fully committed, never the one being appended to
+	for len(l.segments) > 1 && l.segments[0].last <= l.committed {
+		s := l.segments[0]
+		s.f.Close()
+		if err := os.Remove(s.f.Name()); err != nil {
+			return fmt.Errorf("wal: remove segment: %w", err)
+		}
+		l.size -= s.size
+		l.segments = l.segments[1:]
+	}
+	return nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var first error
+	for _, s := range l.segments {
+		if err := s.f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	l.segments = nil
+	return first
+}
@@ -0,0 +1,122 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+)
+
+func batch(gpu string, n int) []model.Telemetry {
+	out := make([]model.Telemetry, n)
+	for i := range out {
+		out[i] = model.Telemetry{GPUId: gpu, Timestamp: time.Unix(int64(i), 0).UTC(), Metrics: map[string]float64{"temp": float64(i)}, IdempotencyKey: gpu + "-" + string(rune('a'+i))}
+	}
+	return out
+}
+
+func TestLog_ReplaysUncommittedAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, g := range []string{"g1", "g2", "g3"} {
+		if _, err := l.Append(batch(g, 2)); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	// out-of-order commit: 3 alone must not advance the checkpoint past 2
+	if err := l.Commit(1); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := l.Commit(3); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	l.Close()
+
+	l, err = Open(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer l.Close()
+	first, last := l.Pending()
+	if first != 2 || last != 3 {
+		t.Fatalf("pending = [%d,%d], want [2,3]", first, last)
+	}
+	items, err := l.Read(2)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(items) != 2 || items[0].GPUId != "g2" || items[1].IdempotencyKey != "g2-b" || items[1].Metrics["temp"] != 1 {
+		t.Fatalf("read back %#v", items)
+	}
+	if _, err := l.Read(1); err != ErrNotFound {
+		t.Fatalf("committed record: err = %v", err)
+	}
+	if seq, _ := l.Append(batch("g4", 1)); seq != 4 {
+		t.Fatalf("next seq = %d, want 4", seq)
+	}
+}
+
+func TestLog_TruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	l.Append(batch("g1", 1))
+	l.Append(batch("g2", 1))
+	l.Close()
+
+	// simulate a crash halfway through the second record
+	names, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	st, _ := os.Stat(names[0])
+	if err := os.Truncate(names[0], st.Size()-5); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = Open(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer l.Close()
+	if first, last := l.Pending(); first != 1 || last != 1 {
+		t.Fatalf("pending = [%d,%d], want [1,1]", first, last)
+	}
+	if seq, err := l.Append(batch("g3", 1)); err != nil || seq != 2 {
+		t.Fatalf("append after truncate: seq=%d err=%v", seq, err)
+	}
+	if items, err := l.Read(2); err != nil || items[0].GPUId != "g3" {
+		t.Fatalf("read after truncate: %v %v", items, err)
+	}
+}
+
+func TestLog_RemovesCommittedSegments(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 1) // every record starts a new segment
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer l.Close()
+	for i := 0; i < 4; i++ {
+		l.Append(batch("g1", 1))
+	}
+	if n, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt)); len(n) != 4 {
+		t.Fatalf("segments = %d, want 4", len(n))
+	}
+	for seq := uint64(1); seq <= 4; seq++ {
+		if err := l.Commit(seq); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+	}
+	// the active segment is kept for appends
+	if n, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt)); len(n) != 1 {
+		t.Fatalf("segments after commit = %d, want 1", len(n))
+	}
+	if first, last := l.Pending(); first <= last {
+		t.Fatalf("pending = [%d,%d], want none", first, last)
+	}
+}
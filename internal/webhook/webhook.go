@@ -0,0 +1,503 @@
+// Package webhook notifies subscribers over HTTP when a GPU's metric crosses
+// a threshold. Subscriptions are persisted through a storage.WebhookStore;
+// deliveries are retried and the most recent ones are kept in memory for
+// inspection.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gpu-metric-collector/internal/expr"
+	"gpu-metric-collector/internal/storage"
+)
+
+// Directions of a subscription: above notifies when the value rises over
+// the threshold, below when it falls under it.
+const (
+	DirectionAbove = "above"
+	DirectionBelow = "below"
+)
+
+// Delivery states. A delivery is pending while attempts remain.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// maxDeliveries is how many deliveries are kept per subscription.
+const maxDeliveries = 100
+
+// Subscription asks for a POST to URL whenever a GPU's latest Metric value
+// crosses Threshold in Direction.
+type Subscription struct {
+	ID        string  `json:"id"`
+	Metric    string  `json:"metric"`
+	Threshold float64 `json:"threshold"`
+	Direction string  `json:"direction"`
+	URL       string  `json:"url"`
+	// Owner is the tenant that created the subscription; its scope limits
+	// the GPUs it sees. Empty for fleet-wide subscriptions.
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SubscriptionError reports an invalid subscription.
+type SubscriptionError struct{ msg string }
+
+func (e *SubscriptionError) Error() string { return e.msg }
+
+// Validate checks the subscription.
+func (s *Subscription) Validate() error {
+	if strings.TrimSpace(s.Metric) == "" {
+		return &SubscriptionError{"subscription needs a metric"}
+	}
+	if s.Direction != DirectionAbove && s.Direction != DirectionBelow {
+		return &SubscriptionError{fmt.Sprintf("direction %q must be %s or %s", s.Direction, DirectionAbove, DirectionBelow)}
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &SubscriptionError{fmt.Sprintf("url %q must be an absolute http or https URL", s.URL)}
+	}
+	return nil
+}
+
+func (s *Subscription) beyond(v float64) bool {
+	if s.Direction == DirectionBelow {
+		return v < s.Threshold
+	}
+	return v > s.Threshold
+}
+
+// Event is the JSON body posted for a crossing.
+type Event struct {
+	SubscriptionID string    `json:"subscription_id"`
+	GPUId          string    `json:"gpu_id"`
+	Metric         string    `json:"metric"`
+	Value          float64   `json:"value"`
+	Threshold      float64   `json:"threshold"`
+	Direction      string    `json:"direction"`
+	Time           time.Time `json:"time"`
+}
+
+// Delivery is one event and the outcome of posting it. Its ID is sent as
+// the X-Webhook-Delivery header, so receivers can drop retried duplicates.
+type Delivery struct {
+	ID          string     `json:"id"`
+	Event       Event      `json:"event"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	// StatusCode is the HTTP status of the last attempt, 0 if it got none.
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Config tunes deliveries.
+type Config struct {
+	// MaxAttempts caps the posts of one event; 0 means 5.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled after each; 0
+	// means 1s.
+	Backoff time.Duration
+	// Timeout bounds one post; 0 means 10s.
+	Timeout time.Duration
+	// AllowedHosts are hosts subscriptions may post to at any address, such
+	// as a receiver inside the cluster: a host name or IP, or ".example.com"
+	// for its subdomains. Every other host must be a public address, checked
+	// when the post connects, so a name that resolves to loopback, private or
+	// link-local addresses is refused too.
+	AllowedHosts []string
+}
+
+// Notifier holds the subscriptions, detects crossings and delivers them.
+type Notifier struct {
+	store storage.Store
+	subs  storage.WebhookStore
+	// scopeFor resolves an owner to its scope (nil for the whole fleet);
+	// false means the owner no longer exists.
+	scopeFor func(owner string) (*storage.Scope, bool)
+	cfg      Config
+	client   *http.Client
+
+	// ctx is cancelled by Close to abandon retries.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu         sync.Mutex
+	byID       map[string]*Subscription
+	crossed    map[string]map[string]bool // subscription id -> gpu -> beyond threshold
+	deliveries map[string][]*Delivery     // subscription id -> oldest first
+}
+
+// NewNotifier loads the persisted subscriptions. scopeFor may be nil when
+// every subscription sees the whole fleet.
+func NewNotifier(store storage.Store, subs storage.WebhookStore, scopeFor func(owner string) (*storage.Scope, bool), cfg Config) (*Notifier, error) {
+	if scopeFor == nil {
+		scopeFor = func(string) (*storage.Scope, bool) { return nil, true }
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{store: store, subs: subs, scopeFor: scopeFor, cfg: cfg,
+		ctx: ctx, cancel: cancel, byID: map[string]*Subscription{}, crossed: map[string]map[string]bool{}, deliveries: map[string][]*Delivery{}}
+	n.client = n.newClient()
+	docs, err := subs.ListWebhooks()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("load webhooks: %w", err)
+	}
+	for id, doc := range docs {
+		s := &Subscription{}
+		if err := json.Unmarshal(doc, s); err != nil {
+			log.Printf("webhook: skipping subscription %s: %v", id, err)
+			continue
+		}
+		if err := n.validate(s); err != nil {
+			log.Printf("webhook: skipping subscription %s: %v", id, err)
+			continue
+		}
+		s.ID = id
+		n.byID[id] = s
+	}
+	return n, nil
+}
+
+// validate checks s and that its URL is a target subscriptions may post to:
+// an allowed host, or one that is not a loopback, private or link-local
+// address. Host names are checked again at every post, once resolved.
+func (n *Notifier) validate(s *Subscription) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	u, _ := url.Parse(s.URL)
+	host := strings.ToLower(u.Hostname())
+	if n.allowed(host) {
+		return nil
+	}
+	if ip := net.ParseIP(host); (ip != nil && !publicIP(ip)) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return &SubscriptionError{fmt.Sprintf("url host %s is not a public address; it must be in the allowed webhook hosts", host)}
+	}
+	return nil
+}
+
+// allowed reports whether host is in cfg.AllowedHosts.
+func (n *Notifier) allowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, a := range n.cfg.AllowedHosts {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a != "" && (host == a || (strings.HasPrefix(a, ".") && strings.HasSuffix(host, a))) {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedAddressSpace is 100.64.0.0/10, carrier-grade NAT and common for
+// cluster pod networks.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip is a unicast address outside the loopback,
+// private, shared and link-local ranges, such as 169.254.169.254.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || sharedAddressSpace.Contains(ip))
+}
+
+// newClient returns the client deliveries are posted with. It connects to
+// hosts not in cfg.AllowedHosts only at public addresses, checking the
+// address actually dialled so DNS rebinding cannot get around validate, and
+// it neither follows redirects nor uses a proxy from the environment, either
+// of which would reach a host that was not checked.
+func (n *Notifier) newClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	public := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("webhook: refusing to connect to %s, not a public address", host)
+			}
+			return nil
+		}}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = nil
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(addr); err == nil && n.allowed(host) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		return public.DialContext(ctx, network, addr)
+	}
+	return &http.Client{
+		Timeout:   n.cfg.Timeout,
+		Transport: tr,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func newID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// Add validates s, assigns it an id and persists it.
+func (n *Notifier) Add(s Subscription) (Subscription, error) {
+	if err := n.validate(&s); err != nil {
+		return Subscription{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Subscription{}, fmt.Errorf("webhook id: %w", err)
+	}
+	s.ID = id
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now().UTC()
+	}
+	doc, err := json.Marshal(s)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if err := n.subs.SaveWebhook(s.ID, doc); err != nil {
+		return Subscription{}, err
+	}
+	n.mu.Lock()
+	n.byID[s.ID] = &s
+	n.mu.Unlock()
+	return s, nil
+}
+
+// Delete removes a subscription and its deliveries, reporting whether it
+// existed. Deliveries in flight still finish.
+func (n *Notifier) Delete(id string) (bool, error) {
+	ok, err := n.subs.DeleteWebhook(id)
+	if err != nil {
+		return false, err
+	}
+	n.mu.Lock()
+	_, known := n.byID[id]
+	delete(n.byID, id)
+	delete(n.crossed, id)
+	delete(n.deliveries, id)
+	n.mu.Unlock()
+	return ok || known, nil
+}
+
+// Subscription returns the subscription with the given id.
+func (n *Notifier) Subscription(id string) (Subscription, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	s, ok := n.byID[id]
+	if !ok {
+		return Subscription{}, false
+	}
+	return *s, true
+}
+
+// Subscriptions returns every subscription, oldest first.
+func (n *Notifier) Subscriptions() []Subscription {
+	n.mu.Lock()
+	out := make([]Subscription, 0, len(n.byID))
+	for _, s := range n.byID {
+		out = append(out, *s)
+	}
+	n.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Deliveries returns the subscription's recent deliveries, newest first.
+func (n *Notifier) Deliveries(id string) []Delivery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ds := n.deliveries[id]
+	out := make([]Delivery, len(ds))
+	for i, d := range ds {
+		out[len(ds)-1-i] = *d
+	}
+	return out
+}
+
+// Run evaluates every interval until ctx is done.
+func (n *Notifier) Run(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			n.Evaluate(now)
+		}
+	}
+}
+
+// Evaluate compares each GPU's latest value (within expr.Lookback of t)
+// with every subscription and starts a delivery for each GPU that crossed
+// since the last evaluation. A GPU already beyond the threshold when first
+// seen counts as crossing; one that stops reporting keeps its state.
+func (n *Notifier) Evaluate(t time.Time) {
+	n.mu.Lock()
+	subs := make([]*Subscription, 0, len(n.byID))
+	for _, s := range n.byID {
+		subs = append(subs, s)
+	}
+	n.mu.Unlock()
+
+	start := t.Add(-expr.Lookback)
+	for _, s := range subs {
+		sc, ok := n.scopeFor(s.Owner)
+		if !ok {
+			continue // owner removed: the subscription sees nothing
+		}
+		vals, err := storage.Top(n.store, storage.TopQuery{Metric: s.Metric, Start: &start, End: &t, Agg: storage.AggLast, Scope: sc})
+		if err != nil {
+			log.Printf("webhook: subscription %s: %v", s.ID, err)
+			continue
+		}
+		n.mu.Lock()
+		if _, ok := n.byID[s.ID]; !ok { // deleted meanwhile
+			n.mu.Unlock()
+			continue
+		}
+		crossed := n.crossed[s.ID]
+		if crossed == nil {
+			crossed = map[string]bool{}
+			n.crossed[s.ID] = crossed
+		}
+		var fired []*Delivery
+		for _, v := range vals {
+			beyond := s.beyond(v.Value)
+			if beyond && !crossed[v.GPUId] {
+				id, err := newID()
+				if err != nil {
+					log.Printf("webhook: delivery id: %v", err)
+					continue
+				}
+				d := &Delivery{ID: id, Status: StatusPending, Event: Event{SubscriptionID: s.ID, GPUId: v.GPUId, Metric: s.Metric,
+					Value: v.Value, Threshold: s.Threshold, Direction: s.Direction, Time: t}}
+				ds := append(n.deliveries[s.ID], d)
+				if len(ds) > maxDeliveries {
+					ds = ds[len(ds)-maxDeliveries:]
+				}
+				n.deliveries[s.ID] = ds
+				fired = append(fired, d)
+			}
+			crossed[v.GPUId] = beyond
+		}
+		n.mu.Unlock()
+		for _, d := range fired {
+			n.wg.Add(1)
+			go n.deliver(s.URL, d)
+		}
+	}
+}
+
+// deliver posts d until it is accepted, rejected with a client error other
+// than 429, or out of attempts.
+func (n *Notifier) deliver(target string, d *Delivery) {
+	defer n.wg.Done()
+	body, err := json.Marshal(d.Event) // the event is never modified
+	if err != nil {
+		n.finish(d, StatusFailed, err)
+		return
+	}
+	wait := n.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		code, err := n.post(target, d.ID, body)
+		retry := err != nil || code == http.StatusTooManyRequests || code >= 500
+		if err == nil && code >= 300 {
+			err = fmt.Errorf("unexpected status %d", code)
+		}
+		n.mu.Lock()
+		now := time.Now().UTC()
+		d.Attempts, d.LastAttempt, d.StatusCode, d.Error = attempt, &now, code, ""
+		if err != nil {
+			d.Error = err.Error()
+		}
+		n.mu.Unlock()
+		switch {
+		case err == nil:
+			n.finish(d, StatusDelivered, nil)
+			return
+		case !retry || attempt >= n.cfg.MaxAttempts:
+			n.finish(d, StatusFailed, err)
+			return
+		}
+		select {
+		case <-n.ctx.Done():
+			n.finish(d, StatusFailed, err)
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (n *Notifier) finish(d *Delivery, status string, err error) {
+	n.mu.Lock()
+	d.Status = status
+	n.mu.Unlock()
+	if err != nil {
+		log.Printf("webhook: delivery %s to subscription %s failed: %v", d.ID, d.Event.SubscriptionID, err)
+	}
+}
+
+func (n *Notifier) post(target, deliveryID string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Delivery", deliveryID)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Wait blocks until every started delivery has finished.
+func (n *Notifier) Wait() { n.wg.Wait() }
+
+// Close abandons pending retries and waits for deliveries to finish.
+func (n *Notifier) Close() {
+	n.cancel()
+	n.wg.Wait()
+}
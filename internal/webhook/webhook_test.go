@@ -0,0 +1,174 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gpu-metric-collector/internal/model"
+	"gpu-metric-collector/internal/storage"
+)
+
+func TestNotifier_CrossingsAreDeliveredWithRetry(t *testing.T) {
+	// Scenario: a subscription "temp above 80" over two GPUs, only one of
+	// which runs hot, then cools and heats up again; the receiver fails the
+	// first post with 503
+	// Expect: one event per crossing (none while it stays hot), the first
+	// delivered on the second attempt with the same delivery id; the
+	// subscription survives a restart through the store
+	var (
+		mu     sync.Mutex
+		events []Event
+		ids    []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		ids = append(ids, r.Header.Get("X-Webhook-Delivery"))
+		if len(ids) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e Event
+		_ = json.NewDecoder(r.Body).Decode(&e)
+		events = append(events, e)
+	}))
+	defer srv.Close()
+
+	mem := storage.NewMemoryStore()
+	n, err := NewNotifier(mem, mem, nil, Config{Backoff: time.Millisecond, AllowedHosts: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatalf("notifier: %v", err)
+	}
+	defer n.Close()
+	sub, err := n.Add(Subscription{Metric: "temp", Threshold: 80, Direction: DirectionAbove, URL: srv.URL})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	for _, bad := range []Subscription{
+		{Metric: "temp", Direction: "sideways", URL: srv.URL},
+		{Metric: "temp", Direction: DirectionBelow, URL: "ftp://example.com"},
+		{Direction: DirectionAbove, URL: srv.URL},
+	} {
+		if _, err := n.Add(bad); err == nil {
+			t.Fatalf("expected %+v to be rejected", bad)
+		}
+	}
+
+	base := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	for i, v := range []float64{90, 95, 70, 85} {
+		ts := base.Add(time.Duration(i) * time.Minute)
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: ts, Metrics: map[string]float64{"temp": v}})
+		_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-2", Timestamp: ts, Metrics: map[string]float64{"temp": 60}})
+		n.Evaluate(ts)
+		n.Wait()
+	}
+
+	mu.Lock()
+	if len(events) != 2 || events[0].GPUId != "gpu-1" || events[0].Value != 90 || events[1].Value != 85 || events[1].SubscriptionID != sub.ID {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if len(ids) != 3 || ids[0] != ids[1] || ids[1] == ids[2] {
+		t.Fatalf("unexpected delivery ids %v", ids)
+	}
+	mu.Unlock()
+	ds := n.Deliveries(sub.ID)
+	if len(ds) != 2 || ds[1].Status != StatusDelivered || ds[1].Attempts != 2 || ds[0].Attempts != 1 || ds[1].StatusCode != http.StatusOK {
+		t.Fatalf("unexpected deliveries %+v", ds)
+	}
+
+	reloaded, err := NewNotifier(mem, mem, nil, Config{AllowedHosts: []string{"127.0.0.1"}})
+	if err != nil || len(reloaded.Subscriptions()) != 1 || reloaded.Subscriptions()[0].URL != srv.URL {
+		t.Fatalf("subscriptions not reloaded: %+v %v", reloaded.Subscriptions(), err)
+	}
+	if ok, err := reloaded.Delete(sub.ID); !ok || err != nil {
+		t.Fatalf("delete: %v %v", ok, err)
+	}
+}
+
+func TestNotifier_GivesUp(t *testing.T) {
+	// Scenario: a "power below 10" subscription whose receiver always fails
+	// with 500, and one whose receiver rejects with 400
+	// Expect: the first is failed after MaxAttempts, the second after one
+	// attempt; both record the last status code and error
+	fail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }))
+	defer fail.Close()
+	reject := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadRequest) }))
+	defer reject.Close()
+
+	mem := storage.NewMemoryStore()
+	n, err := NewNotifier(mem, mem, nil, Config{MaxAttempts: 3, Backoff: time.Millisecond, AllowedHosts: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatalf("notifier: %v", err)
+	}
+	defer n.Close()
+	a, _ := n.Add(Subscription{Metric: "power", Threshold: 10, Direction: DirectionBelow, URL: fail.URL})
+	b, _ := n.Add(Subscription{Metric: "power", Threshold: 10, Direction: DirectionBelow, URL: reject.URL})
+	now := time.Now().UTC()
+	_ = mem.SaveTelemetry(model.Telemetry{GPUId: "gpu-1", Timestamp: now, Metrics: map[string]float64{"power": 5}})
+	n.Evaluate(now)
+	n.Wait()
+
+	if ds := n.Deliveries(a.ID); len(ds) != 1 || ds[0].Status != StatusFailed || ds[0].Attempts != 3 || ds[0].StatusCode != 500 || ds[0].Error == "" {
+		t.Fatalf("retried delivery: %+v", ds)
+	}
+	if ds := n.Deliveries(b.ID); len(ds) != 1 || ds[0].Status != StatusFailed || ds[0].Attempts != 1 || ds[0].StatusCode != 400 {
+		t.Fatalf("rejected delivery: %+v", ds)
+	}
+}
+
+func TestNotifier_RefusesInternalTargets(t *testing.T) {
+	// Scenario: subscriptions to loopback, private, link-local and localhost
+	// URLs; a post to a loopback receiver that passed validation, as a name
+	// rebound to it would; an allowed receiver that redirects
+	// Expect: the URLs rejected unless allowed, the post refused when
+	// connecting, the redirect not followed
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	mem := storage.NewMemoryStore()
+	n, err := NewNotifier(mem, mem, nil, Config{})
+	if err != nil {
+		t.Fatalf("notifier: %v", err)
+	}
+	defer n.Close()
+	for _, u := range []string{"http://127.0.0.1/", "http://[::1]:8080/", "http://10.0.0.7/", "http://169.254.169.254/latest/meta-data",
+		"http://100.64.1.1/", "http://localhost:9000/", "https://api.localhost/"} {
+		_, err := n.Add(Subscription{Metric: "temp", Direction: DirectionAbove, URL: u})
+		var bad *SubscriptionError
+		if !errors.As(err, &bad) {
+			t.Errorf("%s: expected a SubscriptionError, got %v", u, err)
+		}
+	}
+	if _, err := n.Add(Subscription{Metric: "temp", Direction: DirectionAbove, URL: "https://hooks.example.com/gpu"}); err != nil {
+		t.Fatalf("public host rejected: %v", err)
+	}
+	if code, err := n.post(srv.URL, "d1", nil); err == nil || !strings.Contains(err.Error(), "not a public address") || hits != 0 {
+		t.Fatalf("post to loopback: code %d, err %v, hits %d", code, err, hits)
+	}
+
+	allowed, err := NewNotifier(mem, mem, nil, Config{AllowedHosts: []string{"127.0.0.1", ".svc.cluster.local"}})
+	if err != nil {
+		t.Fatalf("notifier: %v", err)
+	}
+	defer allowed.Close()
+	for _, u := range []string{srv.URL, "http://receiver.ops.svc.cluster.local/hook"} {
+		if _, err := allowed.Add(Subscription{Metric: "temp", Direction: DirectionAbove, URL: u}); err != nil {
+			t.Fatalf("%s: allowed host rejected: %v", u, err)
+		}
+	}
+	if code, err := allowed.post(srv.URL+"/moved", "d2", nil); err != nil || code != http.StatusFound || hits != 1 {
+		t.Fatalf("redirect: code %d, err %v, hits %d; want 302 unfollowed", code, err, hits)
+	}
+}